@@ -353,3 +353,15 @@ func GetSystemOverview(c *gin.Context) {
 
 	common.RespSuccess(c, overview)
 }
+
+// GetLiveStats godoc
+// @Summary 获取实时调用速率
+// @Description 返回每个服务最近一分钟/一小时的 tools/call 调用数，用于容量规划（进程内计数，重启后清零）
+// @Tags Analytics
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse{data=[]model.LiveServiceStats}
+// @Router /api/stats/live [get]
+func GetLiveStats(c *gin.Context) {
+	common.RespSuccess(c, model.GetLiveStats())
+}
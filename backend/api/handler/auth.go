@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -60,6 +61,8 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	ensureUserToken(user)
+
 	accessToken, err := service.GenerateToken(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -89,6 +92,17 @@ func Login(c *gin.Context) {
 	})
 }
 
+// ensureUserToken gives a user without a proxy access token a new one when AutoGenerateUserToken is enabled,
+// so the token is part of the login response. Failures are logged and do not block the login.
+func ensureUserToken(user *model.User) {
+	if !common.GetAutoGenerateUserToken() {
+		return
+	}
+	if err := user.EnsureToken(); err != nil {
+		common.SysError(fmt.Sprintf("Failed to generate proxy token for user %d: %v", user.ID, err))
+	}
+}
+
 // RefreshTokenRequest represents the request body for refreshing a token
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
@@ -257,6 +271,8 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	ensureUserToken(user)
+
 	accessToken, err := service.GenerateToken(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
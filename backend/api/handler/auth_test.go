@@ -9,6 +9,7 @@ import (
 	"os"
 	"testing"
 
+	"one-mcp/backend/api/middleware"
 	"one-mcp/backend/common"
 	"one-mcp/backend/model"
 
@@ -183,3 +184,183 @@ func TestLogin_NonExistentUser(t *testing.T) {
 
 // You might need to adjust model.InitModels() or ensure it can be called multiple times / in a test context.
 // For example, by making thing.Setup idempotent or providing a reset mechanism for tests.
+
+func setAutoGenerateUserToken(t *testing.T, value string) {
+	t.Helper()
+	common.OptionMapRWMutex.Lock()
+	original, existed := common.OptionMap[common.OptionAutoGenerateUserToken]
+	common.OptionMap[common.OptionAutoGenerateUserToken] = value
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		defer common.OptionMapRWMutex.Unlock()
+		if existed {
+			common.OptionMap[common.OptionAutoGenerateUserToken] = original
+		} else {
+			delete(common.OptionMap, common.OptionAutoGenerateUserToken)
+		}
+	})
+}
+
+func TestRegister_AutoGeneratesProxyToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		option    string
+		wantToken bool
+	}{
+		{"enabled by default", "", true},
+		{"explicitly disabled", "false", false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			teardown := setupTestDB(t)
+			defer teardown()
+			setAutoGenerateUserToken(t, tt.option)
+
+			username := fmt.Sprintf("newuser%d", i)
+			payload, _ := json.Marshal(RegisterRequest{Username: username, Password: "password123", Email: username + "@example.com"})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/auth/register", bytes.NewBuffer(payload))
+			c.Request.Header.Set("Content-Type", "application/json")
+			Register(c)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var resp struct {
+				Data struct {
+					User struct {
+						Token string `json:"token"`
+					} `json:"user"`
+				} `json:"data"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			users, err := model.UserDB.Where("username = ?", username).Fetch(0, 1)
+			assert.NoError(t, err)
+			if !assert.Len(t, users, 1) {
+				return
+			}
+			assert.Equal(t, users[0].Token, resp.Data.User.Token)
+			if !tt.wantToken {
+				assert.Empty(t, resp.Data.User.Token)
+				return
+			}
+			assert.NotEmpty(t, resp.Data.User.Token)
+			// 令牌可直接用于代理认证
+			tokenUser := model.ValidateUserTokenByTokenString(resp.Data.User.Token)
+			if assert.NotNil(t, tokenUser) {
+				assert.Equal(t, username, tokenUser.Username)
+			}
+		})
+	}
+}
+
+func TestLogin_GeneratesMissingProxyToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	teardown := setupTestDB(t)
+	defer teardown()
+	setAutoGenerateUserToken(t, "true")
+
+	hashedPassword, err := common.Password2Hash("secret123")
+	assert.NoError(t, err)
+	legacy := &model.User{Username: "legacy", Password: hashedPassword, Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, model.UserDB.Save(legacy))
+
+	payload, _ := json.Marshal(LoginRequest{Username: "legacy", Password: "secret123"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(payload))
+	c.Request.Header.Set("Content-Type", "application/json")
+	Login(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data struct {
+			User struct {
+				Token string `json:"token"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.Data.User.Token)
+	stored, err := model.UserDB.ByID(legacy.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.Data.User.Token, stored.Token)
+}
+
+func TestRotateToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	teardown := setupTestDB(t)
+	defer teardown()
+
+	user := &model.User{Username: "rotator", Password: "secret123", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, Token: "old-token-value"}
+	assert.NoError(t, user.Insert())
+	group := &model.MCPServiceGroup{UserID: user.ID, Name: "rotated-group", DisplayName: "Rotated", Enabled: true}
+	group.SetServiceIDs([]int64{})
+	assert.NoError(t, group.Insert())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", user.ID)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/user/token/rotate", nil)
+	RotateToken(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Token          string `json:"token"`
+			ReexportGroups []struct {
+				Name      string `json:"name"`
+				ExportURL string `json:"export_url"`
+			} `json:"reexport_groups"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Success)
+	assert.NotEmpty(t, resp.Data.Token)
+	assert.NotEqual(t, "old-token-value", resp.Data.Token)
+	if assert.Len(t, resp.Data.ReexportGroups, 1) {
+		assert.Equal(t, "rotated-group", resp.Data.ReexportGroups[0].Name)
+		assert.Equal(t, fmt.Sprintf("/api/groups/%d/export", group.ID), resp.Data.ReexportGroups[0].ExportURL)
+	}
+
+	router := gin.New()
+	router.Use(middleware.TokenAuth())
+	router.GET("/proxy/svc/mcp", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt64("user_id")})
+	})
+	tests := []struct {
+		name     string
+		url      string
+		header   string
+		wantCode int
+		wantUser bool
+	}{
+		{"new token via query", "/proxy/svc/mcp?key=" + resp.Data.Token, "", http.StatusOK, true},
+		{"new token via header", "/proxy/svc/mcp", "Bearer " + resp.Data.Token, http.StatusOK, true},
+		{"old token via query", "/proxy/svc/mcp?key=old-token-value", "", http.StatusUnauthorized, false},
+		{"old token via header", "/proxy/svc/mcp", "Bearer old-token-value", http.StatusUnauthorized, false},
+		{"no token keeps global access", "/proxy/svc/mcp", "", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			if tt.wantCode != http.StatusOK {
+				assert.Contains(t, recorder.Body.String(), "rotated")
+				return
+			}
+			var body struct {
+				UserID int64 `json:"user_id"`
+			}
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantUser, body.UserID == user.ID)
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/market"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// diagnosticsLogLimit 诊断包中包含的最近日志条数
+	diagnosticsLogLimit = 200
+	// diagnosticsOutputLimit 安装输出的最大字节数（保留末尾）
+	diagnosticsOutputLimit = 64 * 1024
+	// minSecretValueLength 短于该长度的配置值不做全文替换，避免误伤普通文本
+	minSecretValueLength = 4
+)
+
+// GetMCPServiceDiagnostics godoc
+// @Summary 下载服务诊断包
+// @Description 返回包含脱敏后的有效配置、最近日志、健康历史、工具缓存与安装任务的 zip，便于附加到问题报告
+// @Tags MCP Services
+// @Produce application/zip
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {file} file
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/diagnostics [get]
+func GetMCPServiceDiagnostics(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+
+	service, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+
+	buf, err := buildDiagnosticsBundle(c.Request.Context(), service)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("diagnostics_bundle_failed", lang), err)
+		return
+	}
+
+	filename := fmt.Sprintf("diagnostics-%s-%s.zip", normalizeSkillName(service.Name), time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// diagnosticsScrubber 对诊断包中的文本做脱敏：先按服务的日志脱敏规则处理，再替换已知的配置密钥值
+type diagnosticsScrubber struct {
+	redactor *common.Redactor
+	secrets  []string
+}
+
+func newDiagnosticsScrubber(svc *model.MCPService) *diagnosticsScrubber {
+	scrubber := &diagnosticsScrubber{redactor: svc.LogRedactor()}
+	for _, raw := range []string{svc.ActiveDefaultEnvsJSON(), svc.HeadersJSON} {
+		values := map[string]string{}
+		if err := json.Unmarshal([]byte(raw), &values); err != nil {
+			continue
+		}
+		for _, value := range values {
+			if len(value) >= minSecretValueLength {
+				scrubber.secrets = append(scrubber.secrets, value)
+			}
+		}
+	}
+	// 长的值先替换，避免其中包含的短值留下残片
+	sort.Slice(scrubber.secrets, func(i, j int) bool { return len(scrubber.secrets[i]) > len(scrubber.secrets[j]) })
+	return scrubber
+}
+
+func (d *diagnosticsScrubber) scrub(text string) string {
+	for _, secret := range d.secrets {
+		text = strings.ReplaceAll(text, secret, common.RedactedPlaceholder)
+	}
+	return d.redactor.RedactString(text)
+}
+
+// scrubCommand 脱敏命令行，命令参数可能传递凭据（如 --token x）
+func (d *diagnosticsScrubber) scrubCommand(command string) string {
+	return d.scrub(strings.Join(d.redactor.RedactArgs(strings.Fields(command)), " "))
+}
+
+// scrubEndpoint 脱敏服务的端点：SSE/HTTP 为 URL，stdio 为命令
+func (d *diagnosticsScrubber) scrubEndpoint(svc *model.MCPService, endpoint string) string {
+	if svc.Type == model.ServiceTypeStdio {
+		return d.scrubCommand(endpoint)
+	}
+	return d.scrub(redactURL(endpoint))
+}
+
+// maskMapValues 保留键名，所有值替换为占位符
+func maskMapValues(raw string) map[string]string {
+	values := map[string]string{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return values
+	}
+	for key := range values {
+		values[key] = common.RedactedPlaceholder
+	}
+	return values
+}
+
+// redactURL 去掉 URL 中的用户密码并隐藏所有查询参数值
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	if u.User != nil {
+		u.User = url.User(common.RedactedPlaceholder)
+	}
+	query := u.Query()
+	for key := range query {
+		query.Set(key, common.RedactedPlaceholder)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// diagnosticsServiceConfig 返回服务的有效配置，环境变量与请求头的值全部隐藏，参数与命令按规则脱敏
+func diagnosticsServiceConfig(svc *model.MCPService, scrubber *diagnosticsScrubber) map[string]any {
+	config := map[string]any{}
+	data, _ := json.Marshal(svc)
+	_ = json.Unmarshal(data, &config)
+
+	config["default_envs_json"] = maskMapValues(svc.ActiveDefaultEnvsJSON())
+	config["headers_json"] = maskMapValues(svc.HeadersJSON)
+	if svc.OAuthConfigJSON != "" {
+		config["oauth_config_json"] = svc.MaskedOAuthConfigJSON()
+	}
+
+	for key, argsJSON := range map[string]string{"args_json": svc.ArgsJSON, "runtime_args_json": svc.RuntimeArgsJSON} {
+		var args []string
+		if err := json.Unmarshal([]byte(argsJSON), &args); err == nil {
+			config[key] = scrubber.redactor.RedactArgs(args)
+		} else if argsJSON != "" {
+			config[key] = scrubber.scrub(argsJSON)
+		}
+	}
+
+	config["command"] = scrubber.scrubEndpoint(svc, svc.Command)
+	if endpoints, err := svc.FallbackEndpoints(); err == nil && len(endpoints) > 0 {
+		scrubbed := make([]string, len(endpoints))
+		for i, endpoint := range endpoints {
+			scrubbed[i] = scrubber.scrubEndpoint(svc, endpoint)
+		}
+		config["fallback_endpoints_json"] = scrubbed
+	} else if svc.FallbackEndpointsJSON != "" {
+		config["fallback_endpoints_json"] = scrubber.scrub(svc.FallbackEndpointsJSON)
+	}
+	for key, rawURL := range map[string]string{"health_check_url": svc.HealthCheckURL, "uvx_index_url": svc.UVXIndexURL} {
+		if rawURL != "" {
+			config[key] = scrubber.scrub(redactURL(rawURL))
+		}
+	}
+	for key, command := range map[string]string{"pre_start_command": svc.PreStartCommand, "post_stop_command": svc.PostStopCommand, "probe_command": svc.ProbeCommand} {
+		if command != "" {
+			config[key] = scrubber.scrubCommand(command)
+		}
+	}
+	return config
+}
+
+type diagnosticsInstallTask struct {
+	Status         string    `json:"status"`
+	PackageName    string    `json:"package_name"`
+	PackageManager string    `json:"package_manager"`
+	Version        string    `json:"version"`
+	Command        string    `json:"command"`
+	Args           []string  `json:"args"`
+	EnvVarNames    []string  `json:"env_var_names"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time,omitempty"`
+	TimedOut       bool      `json:"timed_out"`
+	Error          string    `json:"error,omitempty"`
+	Output         string    `json:"output,omitempty"`
+}
+
+func diagnosticsInstallTasks(serviceID int64, scrubber *diagnosticsScrubber) []diagnosticsInstallTask {
+	tasks := []diagnosticsInstallTask{}
+	task, ok := market.GetInstallationManager().GetTaskStatus(serviceID)
+	if !ok {
+		return tasks
+	}
+
+	envNames := make([]string, 0, len(task.EnvVars))
+	for name, value := range task.EnvVars {
+		envNames = append(envNames, name)
+		if len(value) >= minSecretValueLength {
+			scrubber.secrets = append(scrubber.secrets, value)
+		}
+	}
+	sort.Strings(envNames)
+
+	output := task.Output
+	if len(output) > diagnosticsOutputLimit {
+		output = "... [truncated]\n" + output[len(output)-diagnosticsOutputLimit:]
+	}
+	return append(tasks, diagnosticsInstallTask{
+		Status:         string(task.Status),
+		PackageName:    task.PackageName,
+		PackageManager: task.PackageManager,
+		Version:        task.Version,
+		Command:        task.Command,
+		Args:           scrubber.redactor.RedactArgs(task.Args),
+		EnvVarNames:    envNames,
+		StartTime:      task.StartTime,
+		EndTime:        task.EndTime,
+		TimedOut:       task.TimedOut,
+		Error:          scrubber.scrub(task.Error),
+		Output:         scrubber.scrub(output),
+	})
+}
+
+func buildDiagnosticsBundle(ctx context.Context, svc *model.MCPService) (*bytes.Buffer, error) {
+	scrubber := newDiagnosticsScrubber(svc)
+	installTasks := diagnosticsInstallTasks(svc.ID, scrubber)
+
+	logs, _, err := model.GetMCPLogs(ctx, &svc.ID, nil, nil, nil, 1, diagnosticsLogLimit)
+	if err != nil {
+		return nil, err
+	}
+	logEntries := make([]map[string]any, 0, len(logs))
+	for _, entry := range logs {
+		logEntries = append(logEntries, map[string]any{
+			"created_at": entry.CreatedAt,
+			"phase":      entry.Phase,
+			"level":      entry.Level,
+			"message":    scrubber.scrub(entry.Message),
+		})
+	}
+
+	healthCache := proxy.GetHealthCacheManager()
+	health := map[string]any{"current": nil, "history": healthCache.GetServiceHealthHistory(svc.ID)}
+	if current, ok := healthCache.GetServiceHealth(svc.ID); ok {
+		health["current"] = current
+	}
+
+	tools := map[string]any{"cached": false}
+	if entry, ok := proxy.GetToolsCacheManager().GetServiceTools(svc.ID); ok {
+		tools = map[string]any{"cached": true, "fetched_at": entry.FetchedAt, "tools": entry.Tools}
+	}
+
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"service.json", diagnosticsServiceConfig(svc, scrubber)},
+		{"logs.json", logEntries},
+		{"health.json", health},
+		{"tools.json", tools},
+		{"install_tasks.json", installTasks},
+	}
+
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+	for _, file := range files {
+		data, err := json.MarshalIndent(file.content, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", file.name, err)
+		}
+		// 最后再做一次全文替换，兜底任何残留的密钥值
+		if err := addFileToZip(zipWriter, file.name, scrubber.scrub(string(data))); err != nil {
+			return nil, err
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFeedbackRequestIDLength 限制客户端请求 ID 的长度，避免被用来夹带内容
+const maxFeedbackRequestIDLength = 128
+
+// toolFeedbackPayload 只接收定位工具与评分所需的字段，不接收任何调用参数或结果
+type toolFeedbackPayload struct {
+	ServiceID   int64  `json:"service_id"`
+	ServiceName string `json:"service_name"`
+	ToolName    string `json:"tool_name"`
+	RequestID   string `json:"request_id"`
+	Rating      string `json:"rating"` // "up" or "down"
+}
+
+// SubmitToolFeedback godoc
+// @Summary 提交工具调用反馈
+// @Description 客户端报告一次工具调用是否有用（up/down），用于工具排行与搜索排序。只记录评分，不记录调用内容。
+// @Tags Analytics
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 401 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/stats/feedback [post]
+func SubmitToolFeedback(c *gin.Context) {
+	lang := c.GetString("lang")
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return
+	}
+
+	var payload toolFeedbackPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+		return
+	}
+
+	toolName := strings.TrimSpace(payload.ToolName)
+	requestID := strings.TrimSpace(payload.RequestID)
+	rating := strings.ToLower(strings.TrimSpace(payload.Rating))
+	if toolName == "" || len(requestID) > maxFeedbackRequestIDLength || (rating != "up" && rating != "down") {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+		return
+	}
+
+	var svc *model.MCPService
+	var err error
+	if payload.ServiceID > 0 {
+		svc, err = model.GetServiceByID(payload.ServiceID)
+	} else if name := strings.TrimSpace(payload.ServiceName); name != "" {
+		svc, err = model.GetServiceByName(name)
+	} else {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+		return
+	}
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+
+	feedback := &model.ToolFeedback{
+		ServiceID: svc.ID,
+		ToolName:  toolName,
+		UserID:    userID,
+		RequestID: requestID,
+		Useful:    rating == "up",
+	}
+	if err := model.SaveToolFeedback(feedback); err != nil {
+		common.RespError(c, http.StatusInternalServerError, "failed to save feedback", err)
+		return
+	}
+	common.RespSuccess(c, feedback)
+}
+
+// GetToolFeedbackStats godoc
+// @Summary 获取工具反馈统计
+// @Description 按服务/工具聚合的 up/down 反馈数量与好评率，可按 service_id 过滤
+// @Tags Analytics
+// @Accept json
+// @Produce json
+// @Param service_id query int false "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse{data=[]model.ToolFeedbackSummary}
+// @Failure 400 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/analytics/tools/feedback [get]
+func GetToolFeedbackStats(c *gin.Context) {
+	lang := c.GetString("lang")
+	var serviceID int64
+	if raw := c.Query("service_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+			return
+		}
+		serviceID = id
+	}
+
+	summaries, err := model.GetToolFeedbackSummaries(serviceID)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, "failed to aggregate feedback", err)
+		return
+	}
+	common.RespSuccess(c, summaries)
+}
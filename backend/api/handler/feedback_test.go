@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func postToolFeedback(t *testing.T, userID int64, payload map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = newJSONRequest(t, http.MethodPost, "/api/stats/feedback", payload)
+	if userID > 0 {
+		ctx.Set("user_id", userID)
+	}
+	ctx.Set("lang", "en")
+	SubmitToolFeedback(ctx)
+	return recorder
+}
+
+func fetchToolFeedbackStats(t *testing.T, query string) []model.ToolFeedbackSummary {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request, _ = http.NewRequest(http.MethodGet, "/api/analytics/tools/feedback"+query, nil)
+	GetToolFeedbackStats(ctx)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var summaries []model.ToolFeedbackSummary
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &summaries))
+	return summaries
+}
+
+func TestToolFeedbackAggregation(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+	gin.SetMode(gin.TestMode)
+
+	svcA := &model.MCPService{Name: "feedback-a", DisplayName: "Feedback A", Type: model.ServiceTypeStdio, Enabled: true}
+	svcB := &model.MCPService{Name: "feedback-b", DisplayName: "Feedback B", Type: model.ServiceTypeStdio, Enabled: true}
+	assert.NoError(t, model.CreateService(svcA))
+	assert.NoError(t, model.CreateService(svcB))
+
+	// Rejected submissions do not touch aggregation
+	tests := []struct {
+		name     string
+		userID   int64
+		payload  map[string]any
+		wantCode int
+	}{
+		{"anonymous", 0, map[string]any{"service_id": svcA.ID, "tool_name": "search", "rating": "up"}, http.StatusUnauthorized},
+		{"bad rating", 1, map[string]any{"service_id": svcA.ID, "tool_name": "search", "rating": "meh"}, http.StatusBadRequest},
+		{"missing tool", 1, map[string]any{"service_id": svcA.ID, "rating": "up"}, http.StatusBadRequest},
+		{"missing service", 1, map[string]any{"tool_name": "search", "rating": "up"}, http.StatusBadRequest},
+		{"unknown service", 1, map[string]any{"service_name": "nope", "tool_name": "search", "rating": "up"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantCode, postToolFeedback(t, tt.userID, tt.payload).Code)
+		})
+	}
+	assert.Empty(t, fetchToolFeedbackStats(t, ""))
+
+	accepted := []struct {
+		userID  int64
+		payload map[string]any
+	}{
+		{1, map[string]any{"service_id": svcA.ID, "tool_name": "search", "rating": "up", "request_id": "req-1"}},
+		{2, map[string]any{"service_name": "feedback-a", "tool_name": "search", "rating": "UP"}},
+		{3, map[string]any{"service_id": svcA.ID, "tool_name": "search", "rating": "down"}},
+		{1, map[string]any{"service_id": svcB.ID, "tool_name": "fetch", "rating": "down", "request_id": "req-2"}},
+		// Re-rating the same request replaces the earlier vote instead of adding one
+		{1, map[string]any{"service_id": svcB.ID, "tool_name": "fetch", "rating": "up", "request_id": "req-2"}},
+	}
+	for _, fb := range accepted {
+		assert.Equal(t, http.StatusOK, postToolFeedback(t, fb.userID, fb.payload).Code)
+	}
+
+	summaries := fetchToolFeedbackStats(t, "")
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, model.ToolFeedbackSummary{ServiceID: svcA.ID, ToolName: "search", Up: 2, Down: 1, Score: 2.0 / 3.0}, summaries[0])
+	assert.Equal(t, model.ToolFeedbackSummary{ServiceID: svcB.ID, ToolName: "fetch", Up: 1, Down: 0, Score: 1}, summaries[1])
+
+	filtered := fetchToolFeedbackStats(t, "?service_id="+strconv.FormatInt(svcB.ID, 10))
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, "fetch", filtered[0].ToolName)
+}
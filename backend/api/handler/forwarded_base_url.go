@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"one-mcp/backend/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseEndpointEventPrefix is how the mcp-go SSE server starts the event telling the client where to POST messages
+const sseEndpointEventPrefix = "event: endpoint\ndata: "
+
+// forwardedBaseURL returns the externally visible base URL of the request when it comes directly from one of
+// common.TrustedForwardedProxies and carries X-Forwarded-Host; the path of the configured ServerAddress is kept.
+// It returns "" when the configured ServerAddress should be used as is.
+func forwardedBaseURL(r *http.Request, remoteIP string) string {
+	host := firstForwardedValue(r.Header.Get("X-Forwarded-Host"))
+	if host == "" || !common.IsTrustedForwardedProxy(remoteIP) {
+		return ""
+	}
+	scheme := strings.ToLower(firstForwardedValue(r.Header.Get("X-Forwarded-Proto")))
+	if scheme != "http" && scheme != "https" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	base := &url.URL{Scheme: scheme, Host: host}
+	if configured, err := url.Parse(common.GetServerAddress()); err == nil {
+		base.Path = strings.TrimSuffix(configured.Path, "/")
+	}
+	return base.String()
+}
+
+// sseCallbackWriter returns the writer for an SSE stream of the proxy. Behind a trusted load balancer the
+// message callback in the endpoint event is rewritten to the external address the client connected through.
+func sseCallbackWriter(c *gin.Context) http.ResponseWriter {
+	if externalBaseURL := forwardedBaseURL(c.Request, c.RemoteIP()); externalBaseURL != "" {
+		return newSSEEndpointRewriter(c.Writer, common.GetServerAddress(), externalBaseURL)
+	}
+	return c.Writer
+}
+
+// firstForwardedValue returns the first entry of a comma separated X-Forwarded-* header, the one set by the
+// proxy closest to the client
+func firstForwardedValue(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
+
+// sseEndpointRewriter replaces the configured base URL in the endpoint event of an SSE stream, so the
+// message callback points at the address the client actually connected through. Later events pass through.
+type sseEndpointRewriter struct {
+	http.ResponseWriter
+	from, to []byte
+	done     bool
+}
+
+func newSSEEndpointRewriter(w http.ResponseWriter, configuredBaseURL, externalBaseURL string) *sseEndpointRewriter {
+	return &sseEndpointRewriter{
+		ResponseWriter: w,
+		from:           []byte(sseEndpointEventPrefix + strings.TrimSuffix(configuredBaseURL, "/") + "/"),
+		to:             []byte(sseEndpointEventPrefix + strings.TrimSuffix(externalBaseURL, "/") + "/"),
+	}
+}
+
+func (s *sseEndpointRewriter) Write(p []byte) (int, error) {
+	if s.done {
+		return s.ResponseWriter.Write(p)
+	}
+	s.done = true
+	if !bytes.HasPrefix(p, s.from) {
+		return s.ResponseWriter.Write(p)
+	}
+	if _, err := s.ResponseWriter.Write(append(append([]byte(nil), s.to...), p[len(s.from):]...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *sseEndpointRewriter) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *sseEndpointRewriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
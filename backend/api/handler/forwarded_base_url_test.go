@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/common"
+
+	"github.com/gin-gonic/gin"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSECallbackHonorsTrustedForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalProxies := common.TrustedForwardedProxies
+	common.OptionMapRWMutex.Lock()
+	originalAddress := common.OptionMap["ServerAddress"]
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.TrustedForwardedProxies = originalProxies
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap["ServerAddress"] = originalAddress
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	tests := []struct {
+		name          string
+		serverAddress string
+		proxies       string
+		headers       map[string]string
+		wantEndpoint  string
+	}{
+		{"trusted proxy", "http://10.0.0.2:3000", "127.0.0.1", map[string]string{"X-Forwarded-Host": "mcp.example.com", "X-Forwarded-Proto": "https"}, "https://mcp.example.com/proxy/sse-svc/message"},
+		{"first hop of a proxy chain", "http://10.0.0.2:3000", "127.0.0.0/8", map[string]string{"X-Forwarded-Host": "mcp.example.com, lb.internal", "X-Forwarded-Proto": "https, http"}, "https://mcp.example.com/proxy/sse-svc/message"},
+		{"configured path prefix is kept", "http://10.0.0.2:3000/one-mcp/", "127.0.0.1", map[string]string{"X-Forwarded-Host": "mcp.example.com"}, "http://mcp.example.com/one-mcp/proxy/sse-svc/message"},
+		{"untrusted peer", "http://10.0.0.2:3000", "10.0.0.0/8", map[string]string{"X-Forwarded-Host": "evil.example.com", "X-Forwarded-Proto": "https"}, "http://10.0.0.2:3000/proxy/sse-svc/message"},
+		{"no forwarded host", "http://10.0.0.2:3000", "127.0.0.1", map[string]string{"X-Forwarded-Proto": "https"}, "http://10.0.0.2:3000/proxy/sse-svc/message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.TrustedForwardedProxies = tt.proxies
+			common.OptionMapRWMutex.Lock()
+			common.OptionMap["ServerAddress"] = tt.serverAddress
+			common.OptionMapRWMutex.Unlock()
+
+			// 与 proxy.createSSEHttpHandler 相同的配置
+			sseServer := mcpserver.NewSSEServer(mcpserver.NewMCPServer("sse-svc", "1.0.0"),
+				mcpserver.WithStaticBasePath("sse-svc"),
+				mcpserver.WithBaseURL(strings.TrimSuffix(tt.serverAddress, "/")+"/proxy"),
+			)
+			router := gin.New()
+			router.GET(sseServer.CompleteSsePath(), func(c *gin.Context) {
+				serveSSEWithBackpressure(sseCallbackWriter(c), c.Request, sseServer, nil, 0)
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL+sseServer.CompleteSsePath(), nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			reader := bufio.NewReader(resp.Body)
+			event, _ := reader.ReadString('\n')
+			assert.Equal(t, "event: endpoint\n", event)
+			data, _ := reader.ReadString('\n')
+			assert.True(t, strings.HasPrefix(data, "data: "+tt.wantEndpoint+"?sessionId="), data)
+		})
+	}
+}
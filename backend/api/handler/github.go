@@ -148,6 +148,8 @@ func GitHubOAuth(c *gin.Context) {
 		})
 		return
 	}
+	ensureUserToken(&user)
+
 	// Generate JWT tokens
 	accessToken, err := service.GenerateToken(&user)
 	if err != nil {
@@ -169,6 +169,8 @@ func GoogleOAuth(c *gin.Context) {
 		return
 	}
 
+	ensureUserToken(&user)
+
 	// Generate JWT tokens
 	accessToken, err := service.GenerateToken(&user)
 	if err != nil {
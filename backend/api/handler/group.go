@@ -2,10 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"one-mcp/backend/common"
 	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -13,11 +16,80 @@ import (
 )
 
 type groupPayload struct {
-	Name           string `json:"name"`
-	DisplayName    string `json:"display_name"`
-	Description    string `json:"description"`
-	ServiceIDsJSON string `json:"service_ids_json"`
-	Enabled        *bool  `json:"enabled"`
+	Name             string  `json:"name"`
+	DisplayName      string  `json:"display_name"`
+	Description      string  `json:"description"`
+	Instructions     *string `json:"instructions"`
+	ServiceHintsJSON *string `json:"service_hints_json"`
+	ServiceIDsJSON   string  `json:"service_ids_json"`
+	Mode             *string `json:"mode"`
+	Enabled          *bool   `json:"enabled"`
+	ACLJSON          *string `json:"acl_json"`
+	ToolDescMaxLen   *int    `json:"tool_desc_max_len"`
+}
+
+// groupSaveResponse is a created or updated group along with the tool name collisions among its members
+type groupSaveResponse struct {
+	*model.MCPServiceGroup
+	ToolNameWarnings []string `json:"tool_name_warnings,omitempty"`
+}
+
+// groupToolNameWarnings reports tool names provided by several member services and, for flat groups, member tools
+// that map to the same namespaced name (only one of them is reachable). Only cached tool lists are used, so saving
+// a group never waits on an upstream; members whose tools were not fetched yet are not checked.
+func groupToolNameWarnings(group *model.MCPServiceGroup) []string {
+	providers := map[string][]string{}
+	flatSources := map[string][]string{}
+	for _, id := range group.GetServiceIDs() {
+		svc, err := model.GetServiceByID(id)
+		if err != nil {
+			continue
+		}
+		entry, ok := proxy.GetToolsCacheManager().GetServiceTools(id)
+		if !ok {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, tool := range entry.Tools {
+			if !seen[tool.Name] {
+				seen[tool.Name] = true
+				providers[tool.Name] = append(providers[tool.Name], svc.Name)
+			}
+			flatName := flatGroupToolName(svc.Name, tool.Name)
+			flatSources[flatName] = append(flatSources[flatName], svc.Name+"/"+tool.Name)
+		}
+	}
+
+	var warnings []string
+	for name, services := range providers {
+		if len(services) > 1 {
+			warnings = append(warnings, fmt.Sprintf("tool '%s' is provided by %s", name, strings.Join(services, ", ")))
+		}
+	}
+	if group.IsFlat() {
+		for flatName, sources := range flatSources {
+			if len(sources) > 1 {
+				warnings = append(warnings, fmt.Sprintf("flat tool name '%s' is shared by %s, only one of them is reachable", flatName, strings.Join(sources, ", ")))
+			}
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// checkGroupToolNames applies the GroupToolNameCollisions option to the group about to be saved. It returns the
+// warnings to report, or false after responding with an error when collisions must be rejected.
+func checkGroupToolNames(c *gin.Context, group *model.MCPServiceGroup) ([]string, bool) {
+	policy := common.GetGroupToolNameCollisions()
+	if policy == common.GroupToolNameCollisionsOff {
+		return nil, true
+	}
+	warnings := groupToolNameWarnings(group)
+	if policy == common.GroupToolNameCollisionsReject && len(warnings) > 0 {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("group_tool_name_collision", c.GetString("lang"))+": "+strings.Join(warnings, "; "))
+		return nil, false
+	}
+	return warnings, true
 }
 
 func GetGroups(c *gin.Context) {
@@ -58,12 +130,52 @@ func CreateGroup(c *gin.Context) {
 	if payload.Enabled != nil {
 		group.Enabled = *payload.Enabled
 	}
+	if payload.Instructions != nil {
+		group.Instructions = strings.TrimSpace(*payload.Instructions)
+	}
+	if payload.ServiceHintsJSON != nil {
+		hintsJSON, ok := normalizeServiceHintsJSON(*payload.ServiceHintsJSON)
+		if !ok {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+			return
+		}
+		group.ServiceHintsJSON = hintsJSON
+	}
+
+	if payload.Mode != nil {
+		mode := strings.TrimSpace(*payload.Mode)
+		if !model.IsValidGroupMode(mode) {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+			return
+		}
+		group.Mode = mode
+	}
+	if payload.ACLJSON != nil {
+		aclJSON, err := normalizeGroupACLJSON(*payload.ACLJSON)
+		if err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+			return
+		}
+		group.ACLJSON = aclJSON
+	}
+	if payload.ToolDescMaxLen != nil {
+		if *payload.ToolDescMaxLen < 0 {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+			return
+		}
+		group.ToolDescMaxLen = *payload.ToolDescMaxLen
+	}
+
+	warnings, ok := checkGroupToolNames(c, group)
+	if !ok {
+		return
+	}
 
 	if err := group.Insert(); err != nil {
 		common.RespError(c, http.StatusInternalServerError, "failed to create group", err)
 		return
 	}
-	common.RespSuccess(c, group)
+	common.RespSuccess(c, groupSaveResponse{MCPServiceGroup: group, ToolNameWarnings: warnings})
 }
 
 func UpdateGroup(c *gin.Context) {
@@ -103,12 +215,53 @@ func UpdateGroup(c *gin.Context) {
 	if payload.Enabled != nil {
 		group.Enabled = *payload.Enabled
 	}
+	// Instructions/hints 使用指针以便显式清空
+	if payload.Instructions != nil {
+		group.Instructions = strings.TrimSpace(*payload.Instructions)
+	}
+	if payload.ServiceHintsJSON != nil {
+		hintsJSON, ok := normalizeServiceHintsJSON(*payload.ServiceHintsJSON)
+		if !ok {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+			return
+		}
+		group.ServiceHintsJSON = hintsJSON
+	}
+
+	if payload.Mode != nil {
+		mode := strings.TrimSpace(*payload.Mode)
+		if !model.IsValidGroupMode(mode) {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+			return
+		}
+		group.Mode = mode
+	}
+	if payload.ACLJSON != nil {
+		aclJSON, err := normalizeGroupACLJSON(*payload.ACLJSON)
+		if err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+			return
+		}
+		group.ACLJSON = aclJSON
+	}
+	if payload.ToolDescMaxLen != nil {
+		if *payload.ToolDescMaxLen < 0 {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+			return
+		}
+		group.ToolDescMaxLen = *payload.ToolDescMaxLen
+	}
+
+	warnings, ok := checkGroupToolNames(c, group)
+	if !ok {
+		return
+	}
 
 	if err := group.Update(); err != nil {
 		common.RespError(c, http.StatusInternalServerError, "failed to update group", err)
 		return
 	}
-	common.RespSuccess(c, group)
+	common.RespSuccess(c, groupSaveResponse{MCPServiceGroup: group, ToolNameWarnings: warnings})
 }
 
 func DeleteGroup(c *gin.Context) {
@@ -134,6 +287,45 @@ func DeleteGroup(c *gin.Context) {
 	common.RespSuccess(c, nil)
 }
 
+// normalizeGroupACLJSON validates a group ACL JSON array; an empty list is stored as "" (owner only)
+func normalizeGroupACLJSON(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+	entries, err := model.ParseGroupACL(raw)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", nil
+	}
+	result, _ := json.Marshal(entries)
+	return string(result), nil
+}
+
+// normalizeServiceHintsJSON validates a service-name -> hint JSON object and drops empty hints
+func normalizeServiceHintsJSON(raw string) (string, bool) {
+	if strings.TrimSpace(raw) == "" {
+		return "", true
+	}
+	var hints map[string]string
+	if err := json.Unmarshal([]byte(raw), &hints); err != nil {
+		return "", false
+	}
+	cleaned := make(map[string]string, len(hints))
+	for name, hint := range hints {
+		name, hint = strings.TrimSpace(name), strings.TrimSpace(hint)
+		if name != "" && hint != "" {
+			cleaned[name] = hint
+		}
+	}
+	if len(cleaned) == 0 {
+		return "", true
+	}
+	result, _ := json.Marshal(cleaned)
+	return string(result), true
+}
+
 // filterEnabledServiceIDs removes disabled service IDs from the JSON array
 func filterEnabledServiceIDs(serviceIDsJSON string) string {
 	if serviceIDsJSON == "" {
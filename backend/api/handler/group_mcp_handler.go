@@ -2,12 +2,17 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
 	"one-mcp/backend/common"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,13 +21,18 @@ import (
 )
 
 type groupSearchArgs struct {
-	MCPName string
+	MCPName    string
+	DetailTool string // 可选：只返回该工具，描述不截断
 }
 
 type executeArgs struct {
 	MCPName   string
 	ToolName  string
 	Arguments map[string]any
+	DryRun    bool // 只校验参数并返回将要发送的请求，不调用上游
+	Confirm   bool // 确认调用标注为 destructive 的工具(服务开启 ConfirmDestructive 时必需)
+	// ArgumentsWarning 说明参数不是从 arguments 读取时使用了哪种兼容方式(ExecuteArgsStrictness 为 warn 时)
+	ArgumentsWarning string
 }
 
 type contextKey string
@@ -30,6 +40,7 @@ type contextKey string
 const (
 	clientNameKey contextKey = "client_name"
 	userIDKey     contextKey = "user_id"
+	tokenIDKey    contextKey = "token_id"
 )
 
 func GroupMCPHandler(c *gin.Context) {
@@ -42,7 +53,7 @@ func GroupMCPHandler(c *gin.Context) {
 		return
 	}
 
-	group, err := model.GetMCPServiceGroupByName(groupName, userID)
+	group, err := model.GetAccessibleMCPServiceGroupByName(groupName, userID, c.GetInt("role"), model.GroupPermissionExecute)
 	if err != nil {
 		common.RespJSONRPCError(c, http.StatusNotFound, common.JSONRPCErrorCodeInvalidRequest,
 			"Group not found: "+err.Error())
@@ -55,7 +66,11 @@ func GroupMCPHandler(c *gin.Context) {
 		return
 	}
 
-	handler, err := getOrCreateGroupMCPHandler(group, userID)
+	if !normalizeJSONRequestBody(c) {
+		return
+	}
+
+	handler, err := getOrCreateGroupMCPHandler(c.Request.Context(), group, userID)
 	if err != nil {
 		common.RespJSONRPCError(c, http.StatusInternalServerError, common.JSONRPCErrorCodeInvalidRequest,
 			"Failed to create MCP handler: "+err.Error())
@@ -67,6 +82,8 @@ func GroupMCPHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 	ctx = context.WithValue(ctx, clientNameKey, clientName)
 	ctx = context.WithValue(ctx, userIDKey, userID)
+	ctx = context.WithValue(ctx, tokenIDKey, c.GetString("token_id"))
+	ctx = proxy.WithRequestID(ctx, ensureRequestID(c))
 	c.Request = c.Request.WithContext(ctx)
 
 	handler.ServeHTTP(c.Writer, c.Request)
@@ -90,8 +107,10 @@ func parseGroupSearchArgs(args map[string]any) (*groupSearchArgs, error) {
 	if strings.TrimSpace(mcpName) == "" {
 		return nil, fmt.Errorf("mcp_name is required")
 	}
+	detailTool, _ := args["detail_tool"].(string)
 	return &groupSearchArgs{
-		MCPName: strings.TrimSpace(mcpName),
+		MCPName:    strings.TrimSpace(mcpName),
+		DetailTool: strings.TrimSpace(detailTool),
 	}, nil
 }
 
@@ -103,27 +122,59 @@ func parseExecuteArgs(args map[string]any) (*executeArgs, error) {
 	}
 
 	// Parse arguments - support both object and JSON string
-	// Also supports "parameters" field name for client compatibility
-	arguments, fieldFound := parseArgumentsValue(args)
-	if !fieldFound {
+	// Unless ExecuteArgsStrictness is strict, "parameters" is also accepted for client compatibility
+	strictness := common.GetExecuteArgsStrictness()
+	arguments, fieldName := parseArgumentsValue(args)
+	var warning string
+	switch {
+	case fieldName == "arguments":
+	case strictness == common.ExecuteArgsStrict && fieldName == "parameters":
+		return nil, fmt.Errorf("tool arguments must be passed in 'arguments', not 'parameters'")
+	case strictness == common.ExecuteArgsStrict:
+		return nil, fmt.Errorf("arguments is required: pass the tool arguments as an object in 'arguments'")
+	case fieldName == "parameters":
+		warning = "tool arguments were read from 'parameters', pass them in 'arguments' instead"
+	default:
 		// Fallback: collect all other fields as arguments (for dumb LLMs)
 		arguments = extractRemainingAsArguments(args)
+		if len(arguments) > 0 {
+			warning = fmt.Sprintf("'arguments' is missing, the top-level fields [%s] were used as tool arguments, pass them in 'arguments' instead",
+				strings.Join(slices.Sorted(maps.Keys(arguments)), ", "))
+		}
 	}
 	if arguments == nil {
 		arguments = map[string]any{}
 	}
+	if strictness == common.ExecuteArgsLenient {
+		warning = ""
+	}
 
 	return &executeArgs{
-		MCPName:   strings.TrimSpace(mcpName),
-		ToolName:  strings.TrimSpace(toolName),
-		Arguments: arguments,
+		MCPName:          strings.TrimSpace(mcpName),
+		ToolName:         strings.TrimSpace(toolName),
+		Arguments:        arguments,
+		DryRun:           parseBoolArg(args["dry_run"]),
+		Confirm:          parseBoolArg(args["confirm"]),
+		ArgumentsWarning: warning,
 	}, nil
 }
 
-// extractRemainingAsArguments collects all fields except mcp_name/tool_name as arguments
+// parseBoolArg accepts a boolean flag sent either as a JSON boolean or as a string
+func parseBoolArg(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		parsed, _ := strconv.ParseBool(strings.TrimSpace(v))
+		return parsed
+	}
+	return false
+}
+
+// extractRemainingAsArguments collects all fields except mcp_name/tool_name/dry_run/confirm as arguments
 // This handles cases where LLM puts tool params at top level instead of in arguments
 func extractRemainingAsArguments(args map[string]any) map[string]any {
-	reserved := map[string]bool{"mcp_name": true, "tool_name": true, "arguments": true, "parameters": true}
+	reserved := map[string]bool{"mcp_name": true, "tool_name": true, "arguments": true, "parameters": true, "dry_run": true, "confirm": true}
 	result := make(map[string]any)
 	for k, v := range args {
 		if !reserved[k] {
@@ -135,14 +186,14 @@ func extractRemainingAsArguments(args map[string]any) map[string]any {
 
 // parseArgumentsValue parses arguments that could be either a map or a JSON string
 // Supports field names: "arguments" or "parameters"
-// Returns (parsed map, field was found)
-func parseArgumentsValue(args map[string]any) (map[string]any, bool) {
+// Returns (parsed map, name of the field found or "" if neither is set)
+func parseArgumentsValue(args map[string]any) (map[string]any, string) {
 	for _, fieldName := range []string{"arguments", "parameters"} {
 		if v, ok := args[fieldName]; ok && v != nil {
-			return common.ParseAnyToMap(v), true
+			return common.ParseAnyToMap(v), fieldName
 		}
 	}
-	return nil, false
+	return nil, ""
 }
 
 func searchGroupTools(ctx context.Context, group *model.MCPServiceGroup, args *groupSearchArgs) (any, error) {
@@ -154,29 +205,38 @@ func searchGroupTools(ctx context.Context, group *model.MCPServiceGroup, args *g
 
 	currentTime := time.Now().Format("2006-01-02 15:04")
 
-	toolsCacheMgr := proxy.GetToolsCacheManager()
-	entry, ok := toolsCacheMgr.GetServiceTools(svc.ID)
+	tools, err := getServiceTools(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
 
-	var tools []mcp.Tool
-	// If cache is empty, fetch tools by connecting to the service
-	if !ok || len(entry.Tools) == 0 {
-		fetchedTools, fetchErr := fetchToolsFromService(ctx, svc)
-		if fetchErr != nil {
-			return nil, fmt.Errorf("failed to fetch tools from %s: %v", svc.Name, fetchErr)
+	// A single tool is returned with its full description; the listing trims long descriptions
+	maxDescLen := group.ToolDescriptionMaxLength()
+	if args.DetailTool != "" {
+		var matched []mcp.Tool
+		for _, tool := range tools {
+			if tool.Name == args.DetailTool {
+				matched = append(matched, tool)
+				break
+			}
 		}
-		tools = fetchedTools
-	} else {
-		tools = entry.Tools
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("tool '%s' not found in '%s'", args.DetailTool, svc.Name)
+		}
+		tools, maxDescLen = matched, 0
 	}
 
 	// Convert to YAML for compact response
-	yamlTools := convertToolsToYAML(tools, svc.Name)
+	yamlTools := convertToolsToYAML(tools, svc.Name, maxDescLen)
 	yamlBytes, err := yaml.Marshal(yamlTools)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize tools: %v", err)
 	}
 
 	toolsSummary := string(yamlBytes)
+	if maxDescLen > 0 {
+		toolsSummary = fmt.Sprintf("# descriptions are truncated to %d characters, call search_tools with detail_tool for the full description\n%s", maxDescLen, toolsSummary)
+	}
 
 	// Return in content for Cursor compatibility (Cursor doesn't read structuredContent)
 	// Prepend current_time as a comment in YAML
@@ -191,6 +251,210 @@ func searchGroupTools(ctx context.Context, group *model.MCPServiceGroup, args *g
 	}, nil
 }
 
+// groupServiceTools is one reachable member service in the list_all_tools output
+type groupServiceTools struct {
+	MCPName string     `yaml:"mcp_name"`
+	Tools   []yamlTool `yaml:"tools"`
+}
+
+// groupServiceFailure is a member service whose tools could not be listed
+type groupServiceFailure struct {
+	MCPName string `yaml:"mcp_name" json:"mcp_name"`
+	Error   string `yaml:"error" json:"error"`
+}
+
+// listAllGroupTools collects the tools of every member service through fetchGroupServiceTools. Services that
+// fail or time out are reported under "failed" instead of failing the whole call.
+func listAllGroupTools(ctx context.Context, group *model.MCPServiceGroup) (any, error) {
+	services := groupMemberServices(group)
+	tools, errs := fetchGroupServiceTools(ctx, services)
+
+	listed := []groupServiceTools{}
+	failed := []groupServiceFailure{}
+	toolCount := 0
+	maxDescLen := group.ToolDescriptionMaxLength()
+	for i, svc := range services {
+		if errs[i] != nil {
+			failed = append(failed, groupServiceFailure{MCPName: svc.Name, Error: errs[i].Error()})
+			continue
+		}
+		listed = append(listed, groupServiceTools{MCPName: svc.Name, Tools: convertToolsToYAML(tools[i], svc.Name, maxDescLen)})
+		toolCount += len(tools[i])
+	}
+
+	yamlBytes, err := yaml.Marshal(map[string]any{"services": listed, "failed": failed})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize tools: %v", err)
+	}
+	return map[string]any{
+		"content": []map[string]any{
+			{
+				"type": mcp.ContentTypeText,
+				"text": fmt.Sprintf("# current_time: %s\n%s", time.Now().Format("2006-01-02 15:04"), string(yamlBytes)),
+			},
+		},
+		"structuredContent": map[string]any{
+			"tool_count": toolCount,
+			"failed":     failed,
+		},
+	}, nil
+}
+
+// groupMemberServices returns the member services of a group that still exist, in group order
+func groupMemberServices(group *model.MCPServiceGroup) []*model.MCPService {
+	var services []*model.MCPService
+	for _, id := range group.GetServiceIDs() {
+		if svc, err := model.GetServiceByID(id); err == nil {
+			services = append(services, svc)
+		}
+	}
+	return services
+}
+
+// fetchGroupServiceTools loads the tools of several services with at most GroupToolsFetchConcurrency fetches in
+// flight, so one slow service cannot stall the others. The whole load is bounded by GroupToolsFetchTimeout:
+// services that did not answer by then, or were still waiting for a slot, are reported as timed out. Fresh cached
+// tools are used without connecting. Results are indexed like services; a failed service has its error set.
+func fetchGroupServiceTools(ctx context.Context, services []*model.MCPService) ([][]mcp.Tool, []error) {
+	concurrency, timeout := common.GetGroupToolsFetchConfig()
+	if concurrency <= 0 || concurrency > len(services) {
+		concurrency = len(services)
+	}
+	tools := make([][]mcp.Tool, len(services))
+	errs := make([]error, len(services))
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, svc := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-fetchCtx.Done():
+				errs[i] = fetchTimeoutError(ctx, timeout)
+				return
+			}
+			// A fetch that ignores its context keeps its slot until it returns, so the limit also holds for stuck services
+			tools[i], errs[i] = fetchServiceToolsWithin(fetchCtx, ctx, svc, timeout, func() { <-slots })
+		}()
+	}
+	wg.Wait()
+	return tools, errs
+}
+
+// fetchServiceToolsWithin returns the tools of svc, giving up when fetchCtx is done even if the fetch ignores
+// it (for example while the shared instance is still starting). release is called once the fetch has returned.
+func fetchServiceToolsWithin(fetchCtx, ctx context.Context, svc *model.MCPService, timeout time.Duration, release func()) ([]mcp.Tool, error) {
+	type fetchResult struct {
+		tools []mcp.Tool
+		err   error
+	}
+	done := make(chan fetchResult, 1)
+	go func() {
+		defer release()
+		tools, err := getServiceTools(fetchCtx, svc)
+		done <- fetchResult{tools: tools, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.tools, r.err
+	case <-fetchCtx.Done():
+		return nil, fetchTimeoutError(ctx, timeout)
+	}
+}
+
+// fetchTimeoutError is the error of a service whose tools were not loaded within timeout, or the error of ctx
+// when the caller gave up first
+func fetchTimeoutError(ctx context.Context, timeout time.Duration) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("timed out after %s", timeout)
+}
+
+// toolsRefreshTimeout bounds how long a stale tools cache entry may block on a refresh
+var toolsRefreshTimeout = 5 * time.Second
+
+// toolsRefreshBackoff is how long the stale tools of a service are served without a refresh attempt after a
+// refresh failed, so a service that is down does not delay every request by toolsRefreshTimeout
+var toolsRefreshBackoff = time.Minute
+
+var (
+	toolsRefreshFailuresMu sync.Mutex
+	toolsRefreshFailures   = map[int64]time.Time{} // service ID -> time of the last failed refresh
+)
+
+// toolsRefreshBackingOff reports whether a refresh of the tools of svc failed within toolsRefreshBackoff and
+// since the service was last updated
+func toolsRefreshBackingOff(svc *model.MCPService) bool {
+	toolsRefreshFailuresMu.Lock()
+	defer toolsRefreshFailuresMu.Unlock()
+	failedAt, ok := toolsRefreshFailures[svc.ID]
+	if ok && (time.Since(failedAt) >= toolsRefreshBackoff || svc.UpdatedAt.After(failedAt)) {
+		delete(toolsRefreshFailures, svc.ID)
+		return false
+	}
+	return ok
+}
+
+// recordToolsRefreshResult starts the refresh backoff of serviceID after a failure and ends it after a success
+func recordToolsRefreshResult(serviceID int64, err error) {
+	toolsRefreshFailuresMu.Lock()
+	defer toolsRefreshFailuresMu.Unlock()
+	if err != nil {
+		toolsRefreshFailures[serviceID] = time.Now()
+	} else {
+		delete(toolsRefreshFailures, serviceID)
+	}
+}
+
+// isToolsCacheStale reports whether the cached tools predate the service's last update or
+// the start of its current instance, in which case the upstream may expose different tools.
+// Entries without a fetch time are treated as fresh.
+func isToolsCacheStale(svc *model.MCPService, entry *proxy.ToolsCacheEntry) bool {
+	if entry.FetchedAt.IsZero() {
+		return false
+	}
+	if svc.UpdatedAt.After(entry.FetchedAt) {
+		return true
+	}
+	if health, ok := proxy.GetHealthCacheManager().GetServiceHealth(svc.ID); ok && health.StartTime.After(entry.FetchedAt) {
+		return true
+	}
+	return false
+}
+
+// getServiceTools returns the cached tools of a service, fetching them from the service when the cache is empty.
+// A stale cache entry is refreshed within toolsRefreshTimeout; if the refresh fails the cached tools are kept
+// and served without further attempts for toolsRefreshBackoff.
+func getServiceTools(ctx context.Context, svc *model.MCPService) ([]mcp.Tool, error) {
+	toolsCache := proxy.GetToolsCacheManager()
+	entry, ok := toolsCache.GetServiceTools(svc.ID)
+	if ok && len(entry.Tools) > 0 {
+		if !isToolsCacheStale(svc, entry) || toolsRefreshBackingOff(svc) {
+			return entry.Tools, nil
+		}
+		refreshCtx, cancel := context.WithTimeout(ctx, toolsRefreshTimeout)
+		defer cancel()
+		tools, err := fetchToolsFromService(refreshCtx, svc)
+		recordToolsRefreshResult(svc.ID, err)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("[Tools] refreshing stale tools of %s failed, using cached tools: %v", svc.Name, err))
+			return entry.Tools, nil
+		}
+		toolsCache.SetServiceTools(svc.ID, &proxy.ToolsCacheEntry{Tools: tools, FetchedAt: time.Now()})
+		return tools, nil
+	}
+	// If cache is empty, fetch tools by connecting to the service
+	tools, err := fetchToolsFromService(ctx, svc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tools from %s: %v", svc.Name, err)
+	}
+	return tools, nil
+}
+
 func fetchToolsFromService(ctx context.Context, svc *model.MCPService) ([]mcp.Tool, error) {
 	sharedInst, err := proxy.GetOrCreateSharedMcpInstanceWithKey(ctx, svc, proxy.SharedServiceCacheKey(svc.ID), proxy.SharedServiceInstanceName(svc.ID), svc.DefaultEnvsJSON)
 	if err != nil {
@@ -210,23 +474,39 @@ func fetchToolsFromService(ctx context.Context, svc *model.MCPService) ([]mcp.To
 
 // yamlTool is a compact YAML-friendly tool representation
 type yamlTool struct {
-	Name   string         `yaml:"name"`
-	Desc   string         `yaml:"desc,omitempty"`
-	Params map[string]any `yaml:"params,omitempty"`
+	Name        string             `yaml:"name"`
+	Desc        string             `yaml:"desc,omitempty"`
+	ReadOnly    bool               `yaml:"read_only,omitempty"`
+	Destructive bool               `yaml:"destructive,omitempty"`
+	Params      *orderedProperties `yaml:"params,omitempty"`
+	Output      *orderedProperties `yaml:"output,omitempty"`
 }
 
-func convertToolsToYAML(tools []mcp.Tool, mcpName string) []yamlTool {
+// toolSafetyHints reads the readOnlyHint/destructiveHint annotations of a tool. Only explicit hints count:
+// the MCP default of destructiveHint (true) would otherwise flag every unannotated tool, and a read-only
+// tool is never destructive.
+func toolSafetyHints(tool mcp.Tool) (readOnly, destructive bool) {
+	readOnly = tool.Annotations.ReadOnlyHint != nil && *tool.Annotations.ReadOnlyHint
+	destructive = !readOnly && tool.Annotations.DestructiveHint != nil && *tool.Annotations.DestructiveHint
+	return readOnly, destructive
+}
+
+// convertToolsToYAML sorts tools and their properties so the serialized output is deterministic.
+// Descriptions longer than maxDescLen runes are truncated with an ellipsis; 0 keeps them whole.
+func convertToolsToYAML(tools []mcp.Tool, mcpName string, maxDescLen int) []yamlTool {
 	result := make([]yamlTool, 0, len(tools))
-	for _, tool := range tools {
-		yt := yamlTool{
-			Name: tool.Name,
-			Desc: tool.Description,
-		}
-		// Extract just the properties from inputSchema for compactness
-		if len(tool.InputSchema.Properties) > 0 {
-			yt.Params = tool.InputSchema.Properties
-		}
-		result = append(result, yt)
+	for _, tool := range sortToolsByName(tools) {
+		readOnly, destructive := toolSafetyHints(tool)
+		result = append(result, yamlTool{
+			Name:        tool.Name,
+			Desc:        truncateString(tool.Description, maxDescLen),
+			ReadOnly:    readOnly,
+			Destructive: destructive,
+			// Extract just the properties from inputSchema for compactness
+			Params: newOrderedProperties(tool.InputSchema.Properties),
+			// Output schema is optional; only properties are kept, same as inputs
+			Output: newOrderedProperties(tool.OutputSchema.Properties),
+		})
 	}
 	return result
 }
@@ -240,15 +520,34 @@ func executeGroupTool(ctx context.Context, group *model.MCPServiceGroup, args *e
 		return nil, fmt.Errorf("mcp_name '%s' not in group, available: %v", args.MCPName, available)
 	}
 
+	if args.DryRun {
+		return dryRunGroupTool(ctx, svc, args)
+	}
+
+	if common.GetRejectUnknownTools() {
+		if err := checkToolExists(ctx, svc, args.ToolName); err != nil {
+			return nil, err
+		}
+	}
+
+	if svc.ConfirmDestructive && !args.Confirm {
+		if err := checkDestructiveConfirmation(ctx, svc, args.ToolName); err != nil {
+			return nil, err
+		}
+	}
+
 	// Get userID from context for RPD check and stats
 	var userID int64
 	if uid, ok := ctx.Value(userIDKey).(int64); ok {
 		userID = uid
 	}
 
+	tokenID, _ := ctx.Value(tokenIDKey).(string)
+	limitTokenID := svc.LimitTokenID(tokenID)
+
 	// Check daily request limit (RPD) if limit is set
 	if userID > 0 && svc.RPDLimit > 0 {
-		if rpdErr := checkDailyRequestLimit(svc.ID, userID, svc.RPDLimit); rpdErr != nil {
+		if rpdErr := checkDailyRequestLimit(svc.ID, userID, limitTokenID, svc.RPDLimit); rpdErr != nil {
 			return nil, rpdErr
 		}
 	}
@@ -261,14 +560,36 @@ func executeGroupTool(ctx context.Context, group *model.MCPServiceGroup, args *e
 	callReq := mcp.CallToolRequest{}
 	callReq.Params.Name = args.ToolName
 	callReq.Params.Arguments = args.Arguments
+	if svc.CoerceArguments {
+		// Opt-in: convert string-encoded numbers/booleans according to the tool's input schema
+		if tools, toolsErr := getServiceTools(ctx, svc); toolsErr == nil {
+			for _, tool := range tools {
+				if tool.Name == args.ToolName {
+					callReq.Params.Arguments = proxy.CoerceToolArguments(tool, args.Arguments)
+					break
+				}
+			}
+		}
+	}
+
+	// Wait for a slot when the instance is at its concurrency limit; the queue is fair across users
+	release, err := sharedInst.AcquireToolCallSlot(proxy.WithToolCallCaller(ctx, strconv.FormatInt(userID, 10)))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	// Create a new context with configurable timeout for the tool call
 	// This allows long-running MCP services (e.g., LLM-based services) to complete without being canceled
 	toolCallCtx, cancel := context.WithTimeout(ctx, proxy.McpToolCallTimeout())
 	defer cancel()
 
-	result, err := sharedInst.Client.CallTool(toolCallCtx, callReq)
+	// Sampling/roots requests the upstream sends during the call are relayed to this group session
+	untrack := sharedInst.TrackDownstreamRequest(ctx)
+	result, err := sharedInst.Client.CallTool(toolCallCtx, proxy.WithCorrelationMeta(ctx, callReq))
+	untrack()
 	duration := time.Since(start)
+	sharedInst.RecordUpstreamCallResult(err)
 
 	// Get client name from context
 	clientName := ""
@@ -285,6 +606,7 @@ func executeGroupTool(ctx context.Context, group *model.MCPServiceGroup, args *e
 			svc.ID,
 			svc.Name,
 			userID,
+			limitTokenID,
 			model.ProxyRequestTypeHTTP,
 			"tools/call",
 			fmt.Sprintf("/group/%s/mcp", group.Name),
@@ -294,18 +616,20 @@ func executeGroupTool(ctx context.Context, group *model.MCPServiceGroup, args *e
 		)
 	}
 
-	// Log the execution
+	// Log the execution; arguments are not logged, tool name and error are redacted and callReq is forwarded untouched
+	redactor := svc.LogRedactor()
+	toolForLog := redactor.RedactString(args.ToolName)
 	logLevel := model.MCPLogLevelInfo
 	logMsg := fmt.Sprintf("Group execute_tool OK | group=%s | mcp=%s | tool=%s | duration=%dms | client=%s",
-		group.Name, svc.Name, args.ToolName, duration.Milliseconds(), clientName)
+		group.Name, svc.Name, toolForLog, duration.Milliseconds(), clientName)
 	if err != nil {
 		logLevel = model.MCPLogLevelError
-		logMsg = fmt.Sprintf("Group execute_tool FAILED | group=%s | mcp=%s | tool=%s | duration=%dms | client=%s | error=%v",
-			group.Name, svc.Name, args.ToolName, duration.Milliseconds(), clientName, err)
+		logMsg = fmt.Sprintf("Group execute_tool FAILED | group=%s | mcp=%s | tool=%s | duration=%dms | client=%s | error=%s",
+			group.Name, svc.Name, toolForLog, duration.Milliseconds(), clientName, redactor.RedactString(err.Error()))
 	} else if result != nil && result.IsError {
 		logLevel = model.MCPLogLevelError
 		logMsg = fmt.Sprintf("Group execute_tool ERROR | group=%s | mcp=%s | tool=%s | duration=%dms | client=%s | isError=true",
-			group.Name, svc.Name, args.ToolName, duration.Milliseconds(), clientName)
+			group.Name, svc.Name, toolForLog, duration.Milliseconds(), clientName)
 	}
 	if saveErr := model.SaveMCPLog(ctx, svc.ID, svc.Name, model.MCPLogPhaseRun, logLevel, logMsg); saveErr != nil {
 		common.SysError(fmt.Sprintf("Failed to save MCP log for %s: %v", svc.Name, saveErr))
@@ -332,3 +656,129 @@ func executeGroupTool(ctx context.Context, group *model.MCPServiceGroup, args *e
 
 	return resp, nil
 }
+
+// toolNotFoundError reports a tool name the service does not list. The available tools are included so the
+// caller can correct the name or run search_tools again.
+type toolNotFoundError struct {
+	service   string
+	tool      string
+	available []string
+}
+
+func newToolNotFoundError(svc *model.MCPService, toolName string, tools []mcp.Tool) *toolNotFoundError {
+	available := make([]string, 0, len(tools))
+	for _, tool := range sortToolsByName(tools) {
+		available = append(available, tool.Name)
+	}
+	return &toolNotFoundError{service: svc.Name, tool: toolName, available: available}
+}
+
+func (e *toolNotFoundError) Error() string {
+	return fmt.Sprintf("tool '%s' not found in %s, available tools: [%s]. Call search_tools to see their parameters",
+		e.tool, e.service, strings.Join(e.available, ", "))
+}
+
+func containsTool(tools []mcp.Tool, toolName string) bool {
+	for _, tool := range tools {
+		if tool.Name == toolName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkToolExists returns a *toolNotFoundError when the service does not list toolName. A name missing from
+// the cached tools is looked up again in a freshly fetched list, as the upstream may have added it since.
+func checkToolExists(ctx context.Context, svc *model.MCPService, toolName string) error {
+	tools, err := getServiceTools(ctx, svc)
+	if err != nil {
+		return err
+	}
+	if containsTool(tools, toolName) {
+		return nil
+	}
+	if fresh, err := fetchToolsFromService(ctx, svc); err == nil {
+		proxy.GetToolsCacheManager().SetServiceTools(svc.ID, &proxy.ToolsCacheEntry{Tools: fresh, FetchedAt: time.Now()})
+		if containsTool(fresh, toolName) {
+			return nil
+		}
+		tools = fresh
+	}
+	return newToolNotFoundError(svc, toolName, tools)
+}
+
+// checkDestructiveConfirmation rejects a call to a tool annotated as destructive that was not confirmed.
+// The check fails closed: if the tools of the service cannot be loaded the call is rejected as well.
+func checkDestructiveConfirmation(ctx context.Context, svc *model.MCPService, toolName string) error {
+	tools, err := getServiceTools(ctx, svc)
+	if err != nil {
+		return err
+	}
+	for _, tool := range tools {
+		if tool.Name != toolName {
+			continue
+		}
+		if _, destructive := toolSafetyHints(tool); destructive {
+			return fmt.Errorf("tool '%s' of %s is marked destructive and requires confirmation: ask the user, then call execute_tool again with confirm: true", toolName, svc.Name)
+		}
+		return nil
+	}
+	return nil
+}
+
+// dryRunGroupTool validates the arguments of an execute_tool call against the tool's input schema and
+// returns the request that would be sent, with schema defaults resolved. The upstream CallTool is never invoked;
+// an invalid request is reported with isError so the caller can fix the arguments first.
+func dryRunGroupTool(ctx context.Context, svc *model.MCPService, args *executeArgs) (any, error) {
+	tools, err := getServiceTools(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	var tool *mcp.Tool
+	for i := range tools {
+		if tools[i].Name == args.ToolName {
+			tool = &tools[i]
+			break
+		}
+	}
+	if tool == nil {
+		return nil, newToolNotFoundError(svc, args.ToolName, tools)
+	}
+
+	arguments := args.Arguments
+	if svc.CoerceArguments {
+		arguments = proxy.CoerceToolArguments(*tool, arguments)
+	}
+	arguments, defaults := applyToolArgumentDefaults(*tool, arguments)
+	errs := validateToolArguments(*tool, arguments)
+	if errs == nil {
+		errs = []string{}
+	}
+
+	structured := map[string]any{
+		"dry_run":   true,
+		"valid":     len(errs) == 0,
+		"errors":    errs,
+		"mcp_name":  svc.Name,
+		"tool_name": args.ToolName,
+		"arguments": arguments,
+		"defaults":  defaults,
+	}
+	text, err := json.Marshal(structured)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize dry run result: %v", err)
+	}
+	resp := map[string]any{
+		"content": []map[string]any{
+			{
+				"type": mcp.ContentTypeText,
+				"text": "DRY RUN - the tool was not executed.\n" + string(text),
+			},
+		},
+		"structuredContent": structured,
+	}
+	if len(errs) > 0 {
+		resp["isError"] = true
+	}
+	return resp, nil
+}
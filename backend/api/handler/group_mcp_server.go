@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 
 	mcp "github.com/mark3labs/mcp-go/mcp"
@@ -20,6 +21,7 @@ import (
 type groupMCPHandlerEntry struct {
 	handler     http.Handler
 	fingerprint string
+	expiresAt   time.Time // zero for handlers built with the tools of every member service
 }
 
 var (
@@ -27,27 +29,34 @@ var (
 	groupMCPHandlersMu sync.RWMutex
 )
 
-func getOrCreateGroupMCPHandler(group *model.MCPServiceGroup, userID int64) (http.Handler, error) {
+// incompleteGroupHandlerTTL is how long a flat group handler missing the tools of some member services is reused
+// before it is rebuilt, so sessions survive an unavailable member without every request fetching its tools again
+var incompleteGroupHandlerTTL = 30 * time.Second
+
+func getOrCreateGroupMCPHandler(ctx context.Context, group *model.MCPServiceGroup, userID int64) (http.Handler, error) {
 	cacheKey := groupHandlerCacheKey(group.ID, userID)
-	fingerprint := groupHandlerFingerprint(group)
 
 	groupMCPHandlersMu.RLock()
-	if entry, ok := groupMCPHandlers[cacheKey]; ok && entry.fingerprint == fingerprint {
+	if entry, ok := groupMCPHandlers[cacheKey]; ok && entry.fingerprint == groupHandlerFingerprint(group) &&
+		(entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt)) {
 		groupMCPHandlersMu.RUnlock()
 		return entry.handler, nil
 	}
 	groupMCPHandlersMu.RUnlock()
 
-	handler, err := buildGroupMCPHandler(group)
+	handler, complete, err := buildGroupMCPHandler(ctx, group)
 	if err != nil {
 		return nil, err
 	}
+	// Taken after the build, which may have refreshed the tools of member services
+	entry := &groupMCPHandlerEntry{handler: handler, fingerprint: groupHandlerFingerprint(group)}
+	// flat 模式下若有服务的工具未能加载，只短暂缓存，之后重新构建
+	if !complete {
+		entry.expiresAt = time.Now().Add(incompleteGroupHandlerTTL)
+	}
 
 	groupMCPHandlersMu.Lock()
-	groupMCPHandlers[cacheKey] = &groupMCPHandlerEntry{
-		handler:     handler,
-		fingerprint: fingerprint,
-	}
+	groupMCPHandlers[cacheKey] = entry
 	groupMCPHandlersMu.Unlock()
 
 	return handler, nil
@@ -57,38 +66,104 @@ func groupHandlerCacheKey(groupID int64, userID int64) string {
 	return fmt.Sprintf("group-%d-user-%d", groupID, userID)
 }
 
+// groupHandlerFingerprint identifies what a group handler was built from: the group's settings and membership and,
+// for flat groups whose tools are registered up front, the tool lists of the member services
 func groupHandlerFingerprint(group *model.MCPServiceGroup) string {
-	return fmt.Sprintf("%s|%s|%s", group.Name, group.Description, group.ServiceIDsJSON)
+	fingerprint := fmt.Sprintf("%s|%s|%s|%s|%s|%s", group.Name, group.Mode, group.Description, group.Instructions, group.ServiceHintsJSON, group.ServiceIDsJSON)
+	if !group.IsFlat() {
+		return fingerprint
+	}
+	toolsCache := proxy.GetToolsCacheManager()
+	var b strings.Builder
+	b.WriteString(fingerprint)
+	for _, serviceID := range group.GetServiceIDs() {
+		fmt.Fprintf(&b, "|%d:%d", serviceID, toolsCache.ToolsVersion(serviceID))
+	}
+	return b.String()
 }
 
-func buildGroupMCPHandler(group *model.MCPServiceGroup) (http.Handler, error) {
-	server, err := buildGroupMCPServer(group)
+func buildGroupMCPHandler(ctx context.Context, group *model.MCPServiceGroup) (http.Handler, bool, error) {
+	server, complete, err := buildGroupMCPServer(ctx, group)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	streamable := mcpserver.NewStreamableHTTPServer(server,
 		mcpserver.WithHeartbeatInterval(30*time.Second),
 	)
 
-	return streamable, nil
+	return streamable, complete, nil
 }
 
-func buildGroupMCPServer(group *model.MCPServiceGroup) (*mcpserver.MCPServer, error) {
+// buildGroupMCPServer builds the group MCP server. The returned bool is false when
+// a flat group could not load the tools of every member service.
+func buildGroupMCPServer(ctx context.Context, group *model.MCPServiceGroup) (*mcpserver.MCPServer, bool, error) {
 	serverName := fmt.Sprintf("one-mcp-group-%s", group.Name)
-	serverOptions := []mcpserver.ServerOption{}
-	if strings.TrimSpace(group.Description) != "" {
-		serverOptions = append(serverOptions, mcpserver.WithInstructions(group.Description))
+	serverOptions := []mcpserver.ServerOption{
+		mcpserver.WithInstructions(buildGroupInstructions(group)),
+		mcpserver.WithHooks(proxy.ProtocolVersionHooks()),
 	}
 
 	server := mcpserver.NewMCPServer(serverName, "1.0.0", serverOptions...)
-	if err := addGroupTools(server, group); err != nil {
-		return nil, err
+	complete := true
+	if group.IsFlat() {
+		var err error
+		if complete, err = addGroupFlatTools(ctx, server, group); err != nil {
+			return nil, false, err
+		}
+	} else if err := addGroupTools(server, group); err != nil {
+		return nil, false, err
 	}
 	if err := addGroupResources(server, group); err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	return server, complete, nil
+}
+
+const defaultGroupInstructions = "This server groups several MCP services behind two tools. " +
+	"Always call search_tools first with the mcp_name to discover the available tools and their parameters, " +
+	"then call execute_tool with the exact tool_name and arguments from the search result. " +
+	"Do not guess tool names or parameters."
+
+const defaultFlatGroupInstructions = "This server aggregates the tools of several MCP services. " +
+	"Tool names are prefixed with the owning service name followed by \"" + groupFlatToolSeparator + "\"."
+
+// buildGroupInstructions 生成 initialize 返回的 instructions：
+// 优先使用 group.Instructions，否则使用 group.Description + 默认两步调用说明；
+// 最后追加属于该 group 的服务提示。
+func buildGroupInstructions(group *model.MCPServiceGroup) string {
+	var b strings.Builder
+	if instructions := strings.TrimSpace(group.Instructions); instructions != "" {
+		b.WriteString(instructions)
+	} else {
+		if description := strings.TrimSpace(group.Description); description != "" {
+			b.WriteString(description)
+			b.WriteString("\n\n")
+		}
+		if group.IsFlat() {
+			b.WriteString(defaultFlatGroupInstructions)
+		} else {
+			b.WriteString(defaultGroupInstructions)
+		}
+	}
+
+	hints := group.GetServiceHints()
+	if len(hints) == 0 {
+		return b.String()
+	}
+	headerWritten := false
+	for _, name := range getGroupServiceNames(group) {
+		hint := strings.TrimSpace(hints[name])
+		if hint == "" {
+			continue
+		}
+		if !headerWritten {
+			b.WriteString("\n\nService notes:")
+			headerWritten = true
+		}
+		b.WriteString(fmt.Sprintf("\n- %s: %s", name, hint))
 	}
-	return server, nil
+	return b.String()
 }
 
 func addGroupTools(server *mcpserver.MCPServer, group *model.MCPServiceGroup) error {
@@ -109,6 +184,10 @@ func addGroupTools(server *mcpserver.MCPServer, group *model.MCPServiceGroup) er
 					"enum":        serviceNames,
 					"description": "MCP service name",
 				},
+				"detail_tool": map[string]any{
+					"type":        "string",
+					"description": "Optional: return only this tool, with its full description",
+				},
 			},
 			Required: []string{"mcp_name"},
 		},
@@ -133,11 +212,28 @@ func addGroupTools(server *mcpserver.MCPServer, group *model.MCPServiceGroup) er
 					"type":        "object",
 					"description": "Tool arguments. Example: {\"message\": \"hello\"} for a tool with message param",
 				},
+				"dry_run": map[string]any{
+					"type":        "boolean",
+					"description": "Validate the arguments and return the request that would be sent, without executing the tool",
+				},
+				"confirm": map[string]any{
+					"type":        "boolean",
+					"description": "Confirm the call of a tool marked destructive in search_tools, after the user approved it",
+				},
 			},
 			Required: []string{"mcp_name", "tool_name", "arguments"},
 		},
 	}
 
+	listAllTool := mcp.Tool{
+		Name:        "list_all_tools",
+		Description: "List the tools of every service in this group at once. Services that are unreachable are listed under failed with the reason.",
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{},
+		},
+	}
+
 	server.AddTool(searchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		args := common.ParseAnyToMap(request.Params.Arguments)
 		if args == nil {
@@ -163,7 +259,18 @@ func addGroupTools(server *mcpserver.MCPServer, group *model.MCPServiceGroup) er
 		if err != nil {
 			return toolErrorResult(err), nil
 		}
+		if parsed.ArgumentsWarning != "" {
+			common.SysLog(fmt.Sprintf("Group %s execute_tool %s/%s: %s", group.Name, parsed.MCPName, parsed.ToolName, parsed.ArgumentsWarning))
+		}
 		result, err := executeGroupTool(ctx, group, parsed)
+		if err != nil {
+			return withArgumentsWarning(toolErrorResult(err), parsed.ArgumentsWarning), nil
+		}
+		return withArgumentsWarning(toolResultFromStructured(result), parsed.ArgumentsWarning), nil
+	})
+
+	server.AddTool(listAllTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := listAllGroupTools(ctx, group)
 		if err != nil {
 			return toolErrorResult(err), nil
 		}
@@ -173,6 +280,86 @@ func addGroupTools(server *mcpserver.MCPServer, group *model.MCPServiceGroup) er
 	return nil
 }
 
+// groupFlatToolSeparator separates the service name and tool name in flat mode
+const groupFlatToolSeparator = "__"
+
+func flatGroupToolName(serviceName, toolName string) string {
+	return serviceName + groupFlatToolSeparator + toolName
+}
+
+// addGroupFlatTools registers every member tool under a namespaced name and routes calls
+// to the owning service through executeGroupTool (RPD, stats and logs are shared with execute_tool).
+// Returns false if any service's tools could not be loaded.
+func addGroupFlatTools(ctx context.Context, server *mcpserver.MCPServer, group *model.MCPServiceGroup) (bool, error) {
+	if server == nil {
+		return false, errors.New("mcp server is nil")
+	}
+
+	complete := true
+	services := groupMemberServices(group)
+	serviceTools, errs := fetchGroupServiceTools(ctx, services)
+	for i, svc := range services {
+		tools, err := serviceTools[i], errs[i]
+		if err != nil {
+			common.SysError(fmt.Sprintf("Group %s (flat): failed to load tools for %s: %v", group.Name, svc.Name, err))
+			complete = false
+			continue
+		}
+
+		serviceName := svc.Name
+		for _, tool := range tools {
+			originalName := tool.Name
+			_, ownConfirm := tool.InputSchema.Properties["confirm"]
+			flatTool := withFlatConfirmArgument(svc, tool)
+			flatTool.Name = flatGroupToolName(serviceName, originalName)
+			server.AddTool(flatTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				args := common.ParseAnyToMap(request.Params.Arguments)
+				if args == nil {
+					args = map[string]any{}
+				}
+				// Confirmation of destructive tools comes from the call arguments, as with execute_tool;
+				// the flag is not forwarded unless the upstream tool declares its own "confirm" argument
+				confirm := parseBoolArg(args["confirm"])
+				if !ownConfirm {
+					delete(args, "confirm")
+				}
+				result, err := executeGroupTool(ctx, group, &executeArgs{
+					MCPName:   serviceName,
+					ToolName:  originalName,
+					Arguments: args,
+					Confirm:   confirm,
+				})
+				if err != nil {
+					return toolErrorResult(err), nil
+				}
+				return toolResultFromStructured(result), nil
+			})
+		}
+	}
+	return complete, nil
+}
+
+// withFlatConfirmArgument returns the flat variant of a destructive tool of a service that requires
+// confirmation, with a "confirm" argument added to its input schema. Other tools are returned unchanged.
+func withFlatConfirmArgument(svc *model.MCPService, tool mcp.Tool) mcp.Tool {
+	if _, destructive := toolSafetyHints(tool); !destructive || !svc.ConfirmDestructive || tool.RawInputSchema != nil {
+		return tool
+	}
+	if _, exists := tool.InputSchema.Properties["confirm"]; exists {
+		return tool
+	}
+	properties := make(map[string]any, len(tool.InputSchema.Properties)+1)
+	for key, value := range tool.InputSchema.Properties {
+		properties[key] = value
+	}
+	properties["confirm"] = map[string]any{
+		"type":        "boolean",
+		"description": "Must be true: the tool is destructive and the service requires confirmation. Ask the user first",
+	}
+	tool.InputSchema.Properties = properties
+	return tool
+}
+
 func addGroupResources(server *mcpserver.MCPServer, group *model.MCPServiceGroup) error {
 	if server == nil {
 		return errors.New("mcp server is nil")
@@ -239,7 +426,7 @@ func addGroupResources(server *mcpserver.MCPServer, group *model.MCPServiceGroup
 }
 
 func toolErrorResult(err error) *mcp.CallToolResult {
-	return &mcp.CallToolResult{
+	result := &mcp.CallToolResult{
 		IsError: true,
 		Content: []mcp.Content{
 			mcp.TextContent{
@@ -248,6 +435,18 @@ func toolErrorResult(err error) *mcp.CallToolResult {
 			},
 		},
 	}
+	// Tool handler errors cannot carry a JSON-RPC code, so an unknown tool reports METHOD_NOT_FOUND here
+	var notFound *toolNotFoundError
+	if errors.As(err, &notFound) {
+		result.StructuredContent = map[string]any{
+			"error": map[string]any{
+				"code":    mcp.METHOD_NOT_FOUND,
+				"message": err.Error(),
+			},
+			"available_tools": notFound.available,
+		}
+	}
+	return result
 }
 
 func toolResultFromStructured(result any) *mcp.CallToolResult {
@@ -259,6 +458,9 @@ func toolResultFromStructured(result any) *mcp.CallToolResult {
 	callResult := &mcp.CallToolResult{
 		Content: contents,
 	}
+	if isError, _ := resultMap["isError"].(bool); isError {
+		callResult.IsError = true
+	}
 	// Only set StructuredContent if the key exists in the result map
 	if resultMap != nil {
 		if sc, exists := resultMap["structuredContent"]; exists {
@@ -272,6 +474,14 @@ func toolResultFromStructured(result any) *mcp.CallToolResult {
 	return callResult
 }
 
+// withArgumentsWarning appends the warning about how execute_tool arguments were read, so the client sees it
+func withArgumentsWarning(result *mcp.CallToolResult, warning string) *mcp.CallToolResult {
+	if warning != "" {
+		result.Content = append(result.Content, mcp.NewTextContent("Warning: "+warning))
+	}
+	return result
+}
+
 func extractContent(result map[string]any) []mcp.Content {
 	if result == nil {
 		return nil
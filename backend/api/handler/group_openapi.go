@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	mcp "github.com/mark3labs/mcp-go/mcp"
+)
+
+// GetGroupOpenAPI returns an OpenAPI 3 document describing every tool of the group
+// as an operation on the group execute endpoint.
+// GET /api/groups/:id/openapi
+func GetGroupOpenAPI(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+		return
+	}
+
+	group, err := model.GetAccessibleMCPServiceGroupByID(id, c.GetInt64("user_id"), c.GetInt("role"), model.GroupPermissionRead)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, "group not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, buildGroupOpenAPI(c.Request.Context(), group, requestServerAddress(c)))
+}
+
+// groupExecutePath is the plain HTTP execute endpoint of a group tool, relative to the server address
+func groupExecutePath(groupName, serviceName, toolName string) string {
+	return fmt.Sprintf("/group/%s/tools/%s/%s", url.PathEscape(groupName), url.PathEscape(serviceName), url.PathEscape(toolName))
+}
+
+// buildGroupOpenAPI generates the OpenAPI document. Tools are listed the same way as the flat
+// MCP facade: every member service in group order, operationId namespaced as <service>__<tool>.
+// Services whose tools cannot be loaded are skipped.
+func buildGroupOpenAPI(ctx context.Context, group *model.MCPServiceGroup, serverAddress string) map[string]any {
+	paths := map[string]any{}
+	services := groupMemberServices(group)
+	serviceTools, errs := fetchGroupServiceTools(ctx, services)
+	for i, svc := range services {
+		if errs[i] != nil {
+			common.SysError(fmt.Sprintf("Group %s (openapi): failed to load tools for %s: %v", group.Name, svc.Name, errs[i]))
+			continue
+		}
+		for _, tool := range sortToolsByName(serviceTools[i]) {
+			paths[groupExecutePath(group.Name, svc.Name, tool.Name)] = map[string]any{
+				"post": groupToolOperation(svc, tool),
+			}
+		}
+	}
+
+	description := strings.TrimSpace(group.Description)
+	if description == "" {
+		description = buildGroupInstructions(group)
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       group.DisplayName,
+			"description": description,
+			"version":     "1.0.0",
+		},
+		"servers": []map[string]any{{"url": serverAddress}},
+		"paths":   paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+				"apiKey":     map[string]any{"type": "apiKey", "in": "query", "name": "key"},
+			},
+		},
+		"security": []map[string]any{{"bearerAuth": []string{}}, {"apiKey": []string{}}},
+	}
+}
+
+func groupToolOperation(svc *model.MCPService, tool mcp.Tool) map[string]any {
+	inputSchema := toolSchemaMap(tool, "inputSchema")
+	if inputSchema == nil {
+		inputSchema = map[string]any{"type": "object"}
+	}
+	resultProperties := map[string]any{
+		"content": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+		"isError": map[string]any{"type": "boolean"},
+	}
+	if outputSchema := toolSchemaMap(tool, "outputSchema"); outputSchema != nil {
+		resultProperties["structuredContent"] = outputSchema
+	} else {
+		resultProperties["structuredContent"] = map[string]any{"type": "object"}
+	}
+
+	operation := map[string]any{
+		"operationId": flatGroupToolName(svc.Name, tool.Name),
+		"summary":     tool.Name,
+		"tags":        []string{svc.Name},
+		"requestBody": map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": inputSchema},
+			},
+		},
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": "Tool result",
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"success": map[string]any{"type": "boolean"},
+								"message": map[string]any{"type": "string"},
+								"data":    map[string]any{"type": "object", "properties": resultProperties},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if tool.Description != "" {
+		operation["description"] = tool.Description
+	}
+	readOnly, destructive := toolSafetyHints(tool)
+	if readOnly {
+		operation["x-mcp-read-only"] = true
+	}
+	if destructive {
+		operation["x-mcp-destructive"] = true
+		if svc.ConfirmDestructive {
+			operation["parameters"] = []map[string]any{{
+				"name":        "confirm",
+				"in":          "query",
+				"required":    true,
+				"description": "Must be true: the tool is destructive and the service requires confirmation",
+				"schema":      map[string]any{"type": "boolean"},
+			}}
+		}
+	}
+	return operation
+}
+
+// toolSchemaMap returns the JSON form of one of the tool's schemas (raw schemas included), or nil if unset
+func toolSchemaMap(tool mcp.Tool, field string) map[string]any {
+	data, err := json.Marshal(tool)
+	if err != nil {
+		return nil
+	}
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(decoded[field], &schema); err != nil || len(schema) == 0 {
+		return nil
+	}
+	// OpenAPI 3.0 要求 required 至少包含一个元素
+	if required, ok := schema["required"].([]any); ok && len(required) == 0 {
+		delete(schema, "required")
+	}
+	return schema
+}
+
+// GroupExecuteToolHandler executes a group tool over plain HTTP; the request body is the tool arguments.
+// Destructive tools of services that require confirmation need ?confirm=true.
+// POST /group/:name/tools/:mcp_name/:tool_name
+func GroupExecuteToolHandler(c *gin.Context) {
+	lang := c.GetString("lang")
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return
+	}
+
+	group, err := model.GetAccessibleMCPServiceGroupByName(c.Param("name"), userID, c.GetInt("role"), model.GroupPermissionExecute)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, "group not found", err)
+		return
+	}
+	if !group.Enabled {
+		common.RespErrorStr(c, http.StatusServiceUnavailable, "group is disabled")
+		return
+	}
+	if _, err := group.GetServiceByName(c.Param("mcp_name")); err != nil {
+		common.RespError(c, http.StatusNotFound, fmt.Sprintf("mcp_name '%s' not in group", c.Param("mcp_name")), err)
+		return
+	}
+
+	arguments := map[string]any{}
+	if c.Request.Body != nil {
+		if err := c.ShouldBindJSON(&arguments); err != nil && !errors.Is(err, io.EOF) {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+			return
+		}
+	}
+
+	ctx := context.WithValue(c.Request.Context(), clientNameKey, c.Request.Header.Get("User-Agent"))
+	ctx = context.WithValue(ctx, userIDKey, userID)
+	ctx = context.WithValue(ctx, tokenIDKey, c.GetString("token_id"))
+	ctx = proxy.WithRequestID(ctx, ensureRequestID(c))
+	confirm, _ := strconv.ParseBool(c.Query("confirm"))
+	result, err := executeGroupTool(ctx, group, &executeArgs{
+		MCPName:   c.Param("mcp_name"),
+		ToolName:  c.Param("tool_name"),
+		Arguments: arguments,
+		Confirm:   confirm,
+	})
+	if err != nil {
+		var notFound *toolNotFoundError
+		if errors.As(err, &notFound) {
+			common.RespError(c, http.StatusNotFound, "tool not found", err)
+			return
+		}
+		common.RespError(c, http.StatusBadGateway, "tool execution failed", err)
+		return
+	}
+	common.RespSuccess(c, result)
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetGroupOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	serviceTools := map[string][]mcp.Tool{
+		"search-svc": {
+			{Name: "web_search", Description: "Search the web", InputSchema: mcp.ToolInputSchema{
+				Type:       "object",
+				Properties: map[string]any{"query": map[string]any{"type": "string"}},
+				Required:   []string{"query"},
+			}},
+			{Name: "news", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+		},
+		"fetch-svc": {
+			{Name: "fetch", InputSchema: mcp.ToolInputSchema{
+				Type:       "object",
+				Properties: map[string]any{"url": map[string]any{"type": "string", "format": "uri"}},
+			}},
+		},
+	}
+	var ids []int64
+	for _, name := range []string{"search-svc", "fetch-svc"} {
+		svc := &model.MCPService{Name: name, DisplayName: name, Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+		assert.NoError(t, model.CreateService(svc))
+		proxy.GetToolsCacheManager().SetServiceTools(svc.ID, &proxy.ToolsCacheEntry{Tools: serviceTools[name]})
+		defer proxy.GetToolsCacheManager().DeleteServiceTools(svc.ID)
+		ids = append(ids, svc.ID)
+	}
+	group := &model.MCPServiceGroup{UserID: 1, Name: "research", DisplayName: "Research", Description: "Research tools", Enabled: true}
+	group.SetServiceIDs(ids)
+	assert.NoError(t, group.Insert())
+
+	originalAddress := common.OptionMap["ServerAddress"]
+	common.OptionMap["ServerAddress"] = "https://mcp.example.com"
+	defer func() { common.OptionMap["ServerAddress"] = originalAddress }()
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Set("user_id", int64(1))
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(group.ID, 10)}}
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/api/groups/1/openapi", nil)
+	GetGroupOpenAPI(ctx)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]struct {
+			Post struct {
+				OperationID string   `json:"operationId"`
+				Tags        []string `json:"tags"`
+				RequestBody struct {
+					Content map[string]struct {
+						Schema map[string]any `json:"schema"`
+					} `json:"content"`
+				} `json:"requestBody"`
+			} `json:"post"`
+		} `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+	assert.Equal(t, "Research", spec.Info.Title)
+	if assert.Len(t, spec.Servers, 1) {
+		assert.Equal(t, "https://mcp.example.com", spec.Servers[0].URL)
+	}
+	assert.Len(t, spec.Paths, 3)
+
+	tests := []struct {
+		path        string
+		operationID string
+		tag         string
+		schema      string
+	}{
+		{"/group/research/tools/search-svc/web_search", "search-svc__web_search", "search-svc",
+			`{"type":"object","properties":{"query":{"type":"string"}},"required":["query"]}`},
+		{"/group/research/tools/search-svc/news", "search-svc__news", "search-svc", `{"type":"object","properties":{}}`},
+		{"/group/research/tools/fetch-svc/fetch", "fetch-svc__fetch", "fetch-svc",
+			`{"type":"object","properties":{"url":{"type":"string","format":"uri"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operationID, func(t *testing.T) {
+			op, ok := spec.Paths[tt.path]
+			if !assert.True(t, ok, "missing path %s", tt.path) {
+				return
+			}
+			assert.Equal(t, tt.operationID, op.Post.OperationID)
+			assert.Equal(t, []string{tt.tag}, op.Post.Tags)
+			schema, err := json.Marshal(op.Post.RequestBody.Content["application/json"].Schema)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.schema, string(schema))
+		})
+	}
+}
+
+func TestGroupExecuteToolHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	upstream := mcpserver.NewMCPServer("echo", "1.0.0")
+	upstream.AddTool(mcp.Tool{Name: "echo", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("echo: " + request.GetString("message", "")), nil
+		})
+	cli, err := mcpclient.NewInProcessClient(upstream)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Client: cli}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	svc := &model.MCPService{Name: "echo-svc", DisplayName: "Echo", Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+	assert.NoError(t, model.CreateService(svc))
+	group := &model.MCPServiceGroup{UserID: 1, Name: "plain", DisplayName: "Plain", Enabled: true}
+	group.SetServiceIDs([]int64{svc.ID})
+	assert.NoError(t, group.Insert())
+
+	tests := []struct {
+		name     string
+		userID   int64
+		service  string
+		wantCode int
+		wantText string
+	}{
+		{"executes tool", 1, "echo-svc", http.StatusOK, "echo: hi"},
+		{"service not in group", 1, "other", http.StatusNotFound, ""},
+		{"unauthenticated", 0, "echo-svc", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Set("user_id", tt.userID)
+			ctx.Params = gin.Params{{Key: "name", Value: "plain"}, {Key: "mcp_name", Value: tt.service}, {Key: "tool_name", Value: "echo"}}
+			ctx.Request = newJSONRequest(t, http.MethodPost, "/group/plain/tools/"+tt.service+"/echo", map[string]any{"message": "hi"})
+			GroupExecuteToolHandler(ctx)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			if tt.wantText != "" {
+				assert.Contains(t, recorder.Body.String(), tt.wantText)
+			}
+		})
+	}
+}
@@ -2,19 +2,28 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"one-mcp/backend/common"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 
 	"github.com/gin-gonic/gin"
+	mcpclient "github.com/mark3labs/mcp-go/client"
 	mcp "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 type apiResponse struct {
@@ -204,6 +213,91 @@ func TestGroupCRUDHandlers(t *testing.T) {
 	assert.Len(t, groupsAfter, 0)
 }
 
+func TestGroupSaveReportsToolNameCollisions(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+	gin.SetMode(gin.TestMode)
+
+	newService := func(name string, tools ...string) *model.MCPService {
+		svc := &model.MCPService{Name: name, DisplayName: name, Type: model.ServiceTypeStdio, Command: "echo", ArgsJSON: `[]`, Enabled: true}
+		assert.NoError(t, model.CreateService(svc))
+		entry := &proxy.ToolsCacheEntry{}
+		for _, tool := range tools {
+			entry.Tools = append(entry.Tools, mcp.Tool{Name: tool})
+		}
+		proxy.GetToolsCacheManager().SetServiceTools(svc.ID, entry)
+		t.Cleanup(func() { proxy.GetToolsCacheManager().DeleteServiceTools(svc.ID) })
+		return svc
+	}
+	github := newService("github", "search", "create_issue")
+	gitlab := newService("gitlab", "search", "merge")
+	// "a__b" + "c" and "a" + "b__c" map to the same flat name
+	nested := newService("a__b", "c")
+	plain := newService("a", "b__c")
+	uncached := &model.MCPService{Name: "uncached", DisplayName: "uncached", Type: model.ServiceTypeStdio, Command: "echo", ArgsJSON: `[]`, Enabled: true}
+	assert.NoError(t, model.CreateService(uncached))
+
+	save := func(handler gin.HandlerFunc, id string, payload map[string]any) (*httptest.ResponseRecorder, []string) {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = newJSONRequest(t, http.MethodPost, "/api/groups", payload)
+		if id != "" {
+			ctx.Params = gin.Params{{Key: "id", Value: id}}
+		}
+		ctx.Set("user_id", int64(1))
+		ctx.Set("lang", "en")
+		handler(ctx)
+		var data struct {
+			ID               int64    `json:"id"`
+			ToolNameWarnings []string `json:"tool_name_warnings"`
+		}
+		if recorder.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &data))
+		}
+		return recorder, data.ToolNameWarnings
+	}
+	ids := func(services ...*model.MCPService) string {
+		parts := make([]string, 0, len(services))
+		for _, svc := range services {
+			parts = append(parts, strconv.FormatInt(svc.ID, 10))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	}
+
+	recorder, warnings := save(CreateGroup, "", map[string]any{"name": "vcs", "display_name": "VCS", "service_ids_json": ids(github, gitlab, uncached)})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{"tool 'search' is provided by github, gitlab"}, warnings)
+
+	recorder, warnings = save(CreateGroup, "", map[string]any{"name": "no-clash", "display_name": "No Clash", "service_ids_json": ids(github, nested)})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, warnings)
+	assert.NotContains(t, recorder.Body.String(), "tool_name_warnings")
+
+	// Flat groups also report namespaced names that collide
+	recorder, warnings = save(CreateGroup, "", map[string]any{"name": "flat", "display_name": "Flat", "mode": model.GroupModeFlat, "service_ids_json": ids(nested, plain)})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{"flat tool name 'a__b__c' is shared by a__b/c, a/b__c, only one of them is reachable"}, warnings)
+
+	common.OptionMapRWMutex.Lock()
+	original := common.OptionMap[common.OptionGroupToolNameCollisions]
+	common.OptionMap[common.OptionGroupToolNameCollisions] = common.GroupToolNameCollisionsReject
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionGroupToolNameCollisions] = original
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	group, err := model.GetMCPServiceGroupByName("no-clash", 1)
+	assert.NoError(t, err)
+	recorder, _ = save(UpdateGroup, strconv.FormatInt(group.ID, 10), map[string]any{"service_ids_json": ids(github, gitlab)})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, decodeAPIResponse(t, recorder).Message, "tool 'search' is provided by github, gitlab")
+	group, err = model.GetMCPServiceGroupByName("no-clash", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, ids(github, nested), group.ServiceIDsJSON, "a rejected update must not be saved")
+}
+
 func TestGroupMCPHandlerUnauthorized(t *testing.T) {
 	teardown := setupGroupTestDB(t)
 	defer teardown()
@@ -268,7 +362,80 @@ func TestGroupMCPHandlerToolsList(t *testing.T) {
 	resp := decodeMCPResponse(t, recorder)
 	tools, ok := resp.Result["tools"].([]any)
 	assert.True(t, ok)
-	assert.Len(t, tools, 2)
+	assert.Len(t, tools, 3)
+}
+
+func TestGroupMCPHandlerToleratesContentType(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	group := &model.MCPServiceGroup{
+		UserID:      1,
+		Name:        "group-content-type",
+		DisplayName: "Group Content Type",
+		Enabled:     true,
+	}
+	group.SetServiceIDs([]int64{})
+	assert.NoError(t, group.Insert())
+
+	sessionID, _ := initializeGroupSession(t, "group-content-type", 1)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantTools   bool
+	}{
+		{"text/plain with JSON", "text/plain", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, http.StatusOK, true},
+		{"missing content type with JSON", "", `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`, http.StatusOK, true},
+		{"text/plain with non-JSON", "text/plain", "method=tools/list", http.StatusBadRequest, false},
+		{"empty body", "", "", http.StatusBadRequest, false},
+		{"text/plain over the size limit", "text/plain", `{"jsonrpc":"2.0","id":3,"method":"tools/list","params":{"pad":"` + strings.Repeat("x", 128) + `"}}`, http.StatusRequestEntityTooLarge, false},
+	}
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap[common.OptionMCPRequestBodyMaxSize] = "100"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		delete(common.OptionMap, common.OptionMCPRequestBodyMaxSize)
+		common.OptionMapRWMutex.Unlock()
+	}()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/group/group-content-type/mcp", strings.NewReader(tt.body))
+			assert.NoError(t, err)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req.Header.Set("Mcp-Session-Id", sessionID)
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = req
+			ctx.Params = gin.Params{{Key: "name", Value: "group-content-type"}}
+			ctx.Set("user_id", int64(1))
+
+			GroupMCPHandler(ctx)
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+
+			resp := decodeMCPResponse(t, recorder)
+			if tt.wantTools {
+				tools, ok := resp.Result["tools"].([]any)
+				assert.True(t, ok)
+				assert.NotEmpty(t, tools)
+				return
+			}
+			if !assert.NotNil(t, resp.Error) {
+				return
+			}
+			if tt.wantStatus == http.StatusRequestEntityTooLarge {
+				assert.Contains(t, resp.Error["message"], "exceeds 100 bytes")
+				return
+			}
+			assert.Equal(t, float64(common.JSONRPCErrorCodeParseError), resp.Error["code"])
+			assert.Contains(t, resp.Error["message"], "not valid JSON")
+		})
+	}
 }
 
 func TestGroupMCPHandlerSearchToolsValidation(t *testing.T) {
@@ -433,3 +600,1005 @@ func TestGroupMCPHandlerInvalidSessionReturnsNotFound(t *testing.T) {
 	GroupMCPHandler(ctx)
 	assert.Equal(t, http.StatusNotFound, recorder.Code)
 }
+
+func TestGroupMCPHandlerInitializeInstructions(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	svc := &model.MCPService{
+		Name:        "svc-hinted",
+		DisplayName: "Svc Hinted",
+		Type:        model.ServiceTypeStdio,
+		Command:     "echo",
+		ArgsJSON:    `[]`,
+		Enabled:     true,
+	}
+	assert.NoError(t, model.CreateService(svc))
+	dbService, err := model.GetServiceByName("svc-hinted")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		group       *model.MCPServiceGroup
+		contains    []string
+		notContains []string
+		serviceIDs  []int64
+	}{
+		{
+			name: "custom instructions with service hints",
+			group: &model.MCPServiceGroup{
+				Name:             "group-custom-instructions",
+				Description:      "plain description",
+				Instructions:     "Always call search_tools first, then execute_tool.",
+				ServiceHintsJSON: `{"svc-hinted":"prefer the alpha tool","not-in-group":"ignored"}`,
+			},
+			serviceIDs:  []int64{dbService.ID},
+			contains:    []string{"Always call search_tools first, then execute_tool.", "- svc-hinted: prefer the alpha tool"},
+			notContains: []string{"plain description", "not-in-group"},
+		},
+		{
+			name: "default instructions keep description",
+			group: &model.MCPServiceGroup{
+				Name:        "group-default-instructions",
+				Description: "plain description",
+			},
+			contains: []string{"plain description", "Always call search_tools first"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.group.UserID = 1
+			tt.group.DisplayName = tt.group.Name
+			tt.group.Enabled = true
+			tt.group.SetServiceIDs(tt.serviceIDs)
+			assert.NoError(t, tt.group.Insert())
+
+			_, resp := initializeGroupSession(t, tt.group.Name, 1)
+			instructions, _ := resp.Result["instructions"].(string)
+			for _, s := range tt.contains {
+				assert.Contains(t, instructions, s)
+			}
+			for _, s := range tt.notContains {
+				assert.NotContains(t, instructions, s)
+			}
+		})
+	}
+}
+
+func TestConvertToolsToYAMLOutputSchema(t *testing.T) {
+	tools := []mcp.Tool{
+		{
+			Name:        "with-output",
+			Description: "tool with output schema",
+			InputSchema: mcp.ToolInputSchema{
+				Type:       "object",
+				Properties: map[string]any{"query": map[string]any{"type": "string"}},
+			},
+			OutputSchema: mcp.ToolOutputSchema{
+				Type:       "object",
+				Properties: map[string]any{"total_count": map[string]any{"type": "integer"}},
+			},
+		},
+		{
+			Name:        "without-output",
+			InputSchema: mcp.ToolInputSchema{Type: "object"},
+		},
+	}
+
+	yamlBytes, err := yaml.Marshal(convertToolsToYAML(tools, "svc", 0))
+	assert.NoError(t, err)
+
+	var decoded []map[string]any
+	assert.NoError(t, yaml.Unmarshal(yamlBytes, &decoded))
+	assert.Len(t, decoded, 2)
+
+	output, ok := decoded[0]["output"].(map[string]any)
+	assert.True(t, ok, "output schema should be emitted under output")
+	assert.Contains(t, output, "total_count")
+	assert.NotContains(t, decoded[1], "output")
+}
+
+func TestToolYAMLDeterministicOrdering(t *testing.T) {
+	props := map[string]any{}
+	for _, name := range []string{"zeta", "alpha", "mid", "beta", "omega", "gamma"} {
+		props[name] = map[string]any{"type": "string", "description": name + " param"}
+	}
+	props["first"] = map[string]any{"type": "string", "x-order": float64(0)}
+	tools := []mcp.Tool{
+		{Name: "z-tool", InputSchema: mcp.ToolInputSchema{Type: "object", Properties: props, Required: []string{"mid"}}},
+		{Name: "a-tool", InputSchema: mcp.ToolInputSchema{Type: "object", Properties: props}},
+	}
+
+	baseline, err := yaml.Marshal(convertToolsToYAML(tools, "svc", 0))
+	assert.NoError(t, err)
+	baselineSchema := convertInputSchemaToYAML(tools[0].InputSchema)
+	for i := 0; i < 20; i++ {
+		again, err := yaml.Marshal(convertToolsToYAML(tools, "svc", 0))
+		assert.NoError(t, err)
+		assert.Equal(t, string(baseline), string(again))
+		assert.Equal(t, baselineSchema, convertInputSchemaToYAML(tools[0].InputSchema))
+	}
+
+	// Tools are sorted by name without reordering the caller's slice
+	assert.Equal(t, "z-tool", tools[0].Name)
+	out := string(baseline)
+	assert.Less(t, strings.Index(out, "name: a-tool"), strings.Index(out, "name: z-tool"))
+
+	// Properties follow the x-order hint first, then name
+	expectedOrder := []string{"first:", "alpha:", "beta:", "gamma:", "mid:", "omega:", "zeta:"}
+	last := -1
+	for _, key := range expectedOrder {
+		idx := strings.Index(baselineSchema, key)
+		assert.Greater(t, idx, last, "expected %s after previous params in:\n%s", key, baselineSchema)
+		last = idx
+	}
+	assert.Contains(t, baselineSchema, "required: true")
+}
+
+func TestSearchToolsTrimsDescriptions(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	svc := &model.MCPService{Name: "svc-long-desc", DisplayName: "Svc Long Desc", Type: model.ServiceTypeStdio, Command: "echo", ArgsJSON: `[]`, Enabled: true}
+	assert.NoError(t, model.CreateService(svc))
+	dbService, err := model.GetServiceByName("svc-long-desc")
+	assert.NoError(t, err)
+
+	longDesc := strings.Repeat("描述", 30)
+	cache := proxy.GetToolsCacheManager()
+	cache.SetServiceTools(dbService.ID, &proxy.ToolsCacheEntry{Tools: []mcp.Tool{
+		{Name: "long", Description: longDesc, InputSchema: mcp.ToolInputSchema{Type: "object"}},
+		{Name: "short", Description: "short tool", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+	}})
+	defer cache.DeleteServiceTools(dbService.ID)
+
+	group := &model.MCPServiceGroup{UserID: 1, Name: "group-long-desc", DisplayName: "Group Long Desc", Enabled: true, ToolDescMaxLen: 20}
+	group.SetServiceIDs([]int64{dbService.ID})
+
+	search := func(args *groupSearchArgs) []yamlTool {
+		result, err := searchGroupTools(context.Background(), group, args)
+		assert.NoError(t, err)
+		text := result.(map[string]any)["content"].([]map[string]any)[0]["text"].(string)
+		var tools []yamlTool
+		assert.NoError(t, yaml.Unmarshal([]byte(text), &tools))
+		return tools
+	}
+
+	tools := search(&groupSearchArgs{MCPName: "svc-long-desc"})
+	assert.Len(t, tools, 2)
+	assert.Equal(t, 20, len([]rune(tools[0].Desc)))
+	assert.True(t, strings.HasSuffix(tools[0].Desc, "..."))
+	assert.Equal(t, "short tool", tools[1].Desc)
+
+	// detail_tool returns the full description of one tool
+	tools = search(&groupSearchArgs{MCPName: "svc-long-desc", DetailTool: "long"})
+	assert.Len(t, tools, 1)
+	assert.Equal(t, longDesc, tools[0].Desc)
+	_, err = searchGroupTools(context.Background(), group, &groupSearchArgs{MCPName: "svc-long-desc", DetailTool: "missing"})
+	assert.Error(t, err)
+
+	// Without a group limit the global option applies
+	common.OptionMapRWMutex.Lock()
+	original := common.OptionMap[common.OptionToolDescriptionMaxLength]
+	common.OptionMap[common.OptionToolDescriptionMaxLength] = "8"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionToolDescriptionMaxLength] = original
+		common.OptionMapRWMutex.Unlock()
+	}()
+	group.ToolDescMaxLen = 0
+	tools = search(&groupSearchArgs{MCPName: "svc-long-desc"})
+	assert.Equal(t, "描述描述描...", tools[0].Desc)
+	assert.Equal(t, "short...", tools[1].Desc)
+}
+
+func TestGroupMCPHandlerFlatMode(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	// Each member service is backed by an in-process MCP server whose "echo" tool reports its owner
+	upstreamClients := map[string]*mcpclient.Client{}
+	var serviceIDs []int64
+	for _, name := range []string{"svc-flat-a", "svc-flat-b"} {
+		svc := &model.MCPService{
+			Name:        name,
+			DisplayName: name,
+			Type:        model.ServiceTypeStdio,
+			Command:     "echo",
+			ArgsJSON:    `[]`,
+			Enabled:     true,
+		}
+		assert.NoError(t, model.CreateService(svc))
+		dbService, err := model.GetServiceByName(name)
+		assert.NoError(t, err)
+		serviceIDs = append(serviceIDs, dbService.ID)
+
+		owner := name
+		upstream := mcpserver.NewMCPServer(owner, "1.0.0")
+		echoTool := mcp.Tool{Name: "echo", InputSchema: mcp.ToolInputSchema{Type: "object"}}
+		upstream.AddTool(echoTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("handled by " + owner), nil
+		})
+		cli, err := mcpclient.NewInProcessClient(upstream)
+		assert.NoError(t, err)
+		initReq := mcp.InitializeRequest{}
+		initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+		_, err = cli.Initialize(context.Background(), initReq)
+		assert.NoError(t, err)
+		upstreamClients[name] = cli
+
+		proxy.GetToolsCacheManager().SetServiceTools(dbService.ID, &proxy.ToolsCacheEntry{Tools: []mcp.Tool{echoTool}})
+		defer proxy.GetToolsCacheManager().DeleteServiceTools(dbService.ID)
+	}
+
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Client: upstreamClients[svc.Name]}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	group := &model.MCPServiceGroup{
+		UserID:      1,
+		Name:        "group-flat",
+		DisplayName: "Group Flat",
+		Mode:        model.GroupModeFlat,
+		Enabled:     true,
+	}
+	group.SetServiceIDs(serviceIDs)
+	assert.NoError(t, group.Insert())
+
+	sessionID, _ := initializeGroupSession(t, "group-flat", 1)
+
+	post := func(body map[string]any) mcpResponse {
+		req := newJSONRequest(t, http.MethodPost, "/group/group-flat/mcp", body)
+		req.Header.Set("Mcp-Session-Id", sessionID)
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = req
+		ctx.Params = gin.Params{{Key: "name", Value: "group-flat"}}
+		ctx.Set("user_id", int64(1))
+		GroupMCPHandler(ctx)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		return decodeMCPResponse(t, recorder)
+	}
+
+	listResp := post(map[string]any{"jsonrpc": "2.0", "id": 1, "method": "tools/list"})
+	tools, ok := listResp.Result["tools"].([]any)
+	assert.True(t, ok)
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.(map[string]any)["name"].(string))
+	}
+	assert.ElementsMatch(t, []string{"svc-flat-a__echo", "svc-flat-b__echo"}, names)
+
+	callResp := post(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "svc-flat-b__echo", "arguments": map[string]any{}},
+	})
+	assert.Nil(t, callResp.Error)
+	content, ok := callResp.Result["content"].([]any)
+	assert.True(t, ok)
+	assert.NotEmpty(t, content)
+	assert.Equal(t, "handled by svc-flat-b", content[0].(map[string]any)["text"])
+
+	// The cached handler is reused until the tool list of a member service actually changes
+	handler, err := getOrCreateGroupMCPHandler(context.Background(), group, 1)
+	assert.NoError(t, err)
+	again, err := getOrCreateGroupMCPHandler(context.Background(), group, 1)
+	assert.NoError(t, err)
+	assert.Same(t, handler, again)
+	echoTool := mcp.Tool{Name: "echo", InputSchema: mcp.ToolInputSchema{Type: "object"}}
+	proxy.GetToolsCacheManager().SetServiceTools(serviceIDs[0], &proxy.ToolsCacheEntry{Tools: []mcp.Tool{echoTool}, FetchedAt: time.Now()})
+	again, err = getOrCreateGroupMCPHandler(context.Background(), group, 1)
+	assert.NoError(t, err)
+	assert.Same(t, handler, again, "refreshing an unchanged tool list keeps the handler")
+	proxy.GetToolsCacheManager().SetServiceTools(serviceIDs[0], &proxy.ToolsCacheEntry{Tools: []mcp.Tool{echoTool, {Name: "ping", InputSchema: mcp.ToolInputSchema{Type: "object"}}}})
+	again, err = getOrCreateGroupMCPHandler(context.Background(), group, 1)
+	assert.NoError(t, err)
+	assert.NotSame(t, handler, again, "a changed tool list rebuilds the handler")
+}
+
+func TestExecuteGroupToolDoesNotLogArguments(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	svc := &model.MCPService{
+		Name:               "svc-redact",
+		DisplayName:        "Redact",
+		Type:               model.ServiceTypeStdio,
+		Command:            "echo",
+		ArgsJSON:           `[]`,
+		Enabled:            true,
+		RedactionRulesJSON: `{"keys":["ssn"],"patterns":["[a-z]+@example\\.com"]}`,
+	}
+	assert.NoError(t, model.CreateService(svc))
+
+	// 上游收到的参数必须是原样转发的
+	var received map[string]any
+	upstream := mcpserver.NewMCPServer("redact", "1.0.0")
+	upstream.AddTool(mcp.Tool{Name: "lookup", InputSchema: mcp.ToolInputSchema{Type: "object"}}, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		received = request.GetArguments()
+		return mcp.NewToolResultText("ok"), nil
+	})
+	cli, err := mcpclient.NewInProcessClient(upstream)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Client: cli}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	group := &model.MCPServiceGroup{UserID: 1, Name: "group-redact", DisplayName: "Group Redact", Enabled: true}
+	group.SetServiceIDs([]int64{svc.ID})
+	assert.NoError(t, group.Insert())
+
+	arguments := map[string]any{
+		"ssn":      "123-45-6789",
+		"password": "hunter2",
+		"contact":  "alice@example.com",
+		"query":    "weather",
+	}
+	_, err = executeGroupTool(context.Background(), group, &executeArgs{MCPName: "svc-redact", ToolName: "lookup", Arguments: arguments})
+	assert.NoError(t, err)
+	assert.Equal(t, arguments, received)
+
+	logs, _, err := model.GetMCPLogs(context.Background(), &svc.ID, nil, nil, nil, 1, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 1) {
+		// 参数值（包括自由文本中可能含有的个人信息）一律不写入日志
+		message := logs[0].Message
+		assert.Contains(t, message, "tool=lookup")
+		assert.NotContains(t, message, "args=")
+		for _, value := range []string{"123-45-6789", "hunter2", "alice@example.com", "weather"} {
+			assert.NotContains(t, message, value)
+		}
+	}
+}
+
+func TestListAllGroupToolsPartialResults(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	common.OptionMapRWMutex.Lock()
+	originalTimeout := common.OptionMap[common.OptionGroupToolsFetchTimeout]
+	common.OptionMap[common.OptionGroupToolsFetchTimeout] = "200ms"
+	common.OptionMapRWMutex.Unlock()
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		if svc.Name == "svc-slow" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return nil, errors.New("connection refused")
+	}
+	defer func() {
+		proxy.GetOrCreateSharedMcpInstanceWithKey = original
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionGroupToolsFetchTimeout] = originalTimeout
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	var ids []int64
+	for _, name := range []string{"svc-up", "svc-down", "svc-slow"} {
+		svc := &model.MCPService{Name: name, DisplayName: name, Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+		assert.NoError(t, model.CreateService(svc))
+		ids = append(ids, svc.ID)
+	}
+	cache := proxy.GetToolsCacheManager()
+	cache.SetServiceTools(ids[0], &proxy.ToolsCacheEntry{Tools: []mcp.Tool{{Name: "alpha", InputSchema: mcp.ToolInputSchema{Type: "object"}}}})
+	defer cache.DeleteServiceTools(ids[0])
+
+	group := &model.MCPServiceGroup{UserID: 1, Name: "group-partial", DisplayName: "Partial", Enabled: true}
+	group.SetServiceIDs(ids)
+	assert.NoError(t, group.Insert())
+
+	start := time.Now()
+	result, err := listAllGroupTools(context.Background(), group)
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	callResult := toolResultFromStructured(result)
+	assert.False(t, callResult.IsError)
+	text := callResult.Content[0].(mcp.TextContent).Text
+	var listed struct {
+		Services []struct {
+			MCPName string `yaml:"mcp_name"`
+			Tools   []struct {
+				Name string `yaml:"name"`
+			} `yaml:"tools"`
+		} `yaml:"services"`
+		Failed []groupServiceFailure `yaml:"failed"`
+	}
+	assert.NoError(t, yaml.Unmarshal([]byte(text), &listed))
+	if assert.Len(t, listed.Services, 1) {
+		assert.Equal(t, "svc-up", listed.Services[0].MCPName)
+		assert.Equal(t, "alpha", listed.Services[0].Tools[0].Name)
+	}
+	if assert.Len(t, listed.Failed, 2) {
+		assert.Equal(t, "svc-down", listed.Failed[0].MCPName)
+		assert.Contains(t, listed.Failed[0].Error, "connection refused")
+		assert.Equal(t, "svc-slow", listed.Failed[1].MCPName)
+	}
+	structured, ok := callResult.StructuredContent.(map[string]any)
+	if assert.True(t, ok) {
+		assert.Equal(t, 1, structured["tool_count"])
+	}
+}
+
+func TestFetchGroupServiceToolsBoundsConcurrencyAndTimeout(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	common.OptionMapRWMutex.Lock()
+	originalConcurrency := common.OptionMap[common.OptionGroupToolsFetchConcurrency]
+	originalTimeout := common.OptionMap[common.OptionGroupToolsFetchTimeout]
+	common.OptionMap[common.OptionGroupToolsFetchConcurrency] = "2"
+	common.OptionMap[common.OptionGroupToolsFetchTimeout] = "300ms"
+	common.OptionMapRWMutex.Unlock()
+
+	// stuck 忽略 ctx，模拟实例启动时卡住的服务
+	stuck := make(chan struct{})
+	var inFlight, maxInFlight atomic.Int32
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			observed := maxInFlight.Load()
+			if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		if strings.HasPrefix(svc.Name, "fetch-stuck") {
+			<-stuck
+			return nil, errors.New("released")
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil, errors.New("connection refused")
+	}
+	defer func() {
+		close(stuck)
+		proxy.GetOrCreateSharedMcpInstanceWithKey = original
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionGroupToolsFetchConcurrency] = originalConcurrency
+		common.OptionMap[common.OptionGroupToolsFetchTimeout] = originalTimeout
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	var services []*model.MCPService
+	for _, name := range []string{"fetch-cached", "fetch-down-1", "fetch-stuck", "fetch-down-2", "fetch-down-3", "fetch-down-4"} {
+		svc := &model.MCPService{Name: name, DisplayName: name, Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+		assert.NoError(t, model.CreateService(svc))
+		services = append(services, svc)
+	}
+	cache := proxy.GetToolsCacheManager()
+	cache.SetServiceTools(services[0].ID, &proxy.ToolsCacheEntry{Tools: []mcp.Tool{{Name: "alpha", InputSchema: mcp.ToolInputSchema{Type: "object"}}}, FetchedAt: time.Now()})
+	defer cache.DeleteServiceTools(services[0].ID)
+
+	start := time.Now()
+	tools, errs := fetchGroupServiceTools(context.Background(), services)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	assert.Equal(t, int32(2), maxInFlight.Load(), "no more than GroupToolsFetchConcurrency services are fetched at once")
+	assert.NoError(t, errs[0])
+	if assert.Len(t, tools[0], 1) {
+		assert.Equal(t, "alpha", tools[0][0].Name)
+	}
+	for _, i := range []int{1, 3, 4, 5} {
+		if assert.Error(t, errs[i], services[i].Name) {
+			assert.Contains(t, errs[i].Error(), "connection refused")
+		}
+	}
+	if assert.Error(t, errs[2]) {
+		assert.Equal(t, "timed out after 300ms", errs[2].Error())
+	}
+
+	// 卡住的服务一直占用名额，排在后面的服务在整体超时后报告超时，而不是超出并发上限
+	maxInFlight.Store(0)
+	services = nil
+	for _, name := range []string{"fetch-stuck-a", "fetch-stuck-b", "fetch-stuck-c"} {
+		svc := &model.MCPService{Name: name, DisplayName: name, Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+		assert.NoError(t, model.CreateService(svc))
+		services = append(services, svc)
+	}
+	start = time.Now()
+	_, errs = fetchGroupServiceTools(context.Background(), services)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, int32(3), maxInFlight.Load(), "the stuck fetch of the previous call plus two of this one")
+	for _, err := range errs {
+		if assert.Error(t, err) {
+			assert.Equal(t, "timed out after 300ms", err.Error())
+		}
+	}
+}
+
+func TestExecuteGroupToolDryRun(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	svc := &model.MCPService{Name: "svc-dry", DisplayName: "Dry", Type: model.ServiceTypeStdio, Command: "echo", ArgsJSON: `[]`, Enabled: true}
+	assert.NoError(t, model.CreateService(svc))
+	defer proxy.GetToolsCacheManager().DeleteServiceTools(svc.ID)
+
+	calls := 0
+	upstream := mcpserver.NewMCPServer("dry", "1.0.0")
+	upstream.AddTool(mcp.Tool{
+		Name: "deploy",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"env":      map[string]any{"type": "string", "enum": []any{"staging", "prod"}},
+				"replicas": map[string]any{"type": "integer", "default": 1},
+			},
+			Required: []string{"env"},
+		},
+	}, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls++
+		return mcp.NewToolResultText("deployed"), nil
+	})
+	cli, err := mcpclient.NewInProcessClient(upstream)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Client: cli}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	group := &model.MCPServiceGroup{UserID: 1, Name: "group-dry", DisplayName: "Group Dry", Enabled: true}
+	group.SetServiceIDs([]int64{svc.ID})
+	assert.NoError(t, group.Insert())
+
+	tests := []struct {
+		name          string
+		toolName      string
+		arguments     map[string]any
+		wantErr       string
+		wantValid     bool
+		wantErrors    []string
+		wantArguments string
+		wantDefaults  string
+	}{
+		{"valid arguments resolve defaults", "deploy", map[string]any{"env": "staging"}, "", true, []string{}, `{"env":"staging","replicas":1}`, `{"replicas":1}`},
+		{"invalid arguments", "deploy", map[string]any{"env": "qa", "replicas": "two"}, "", false, []string{`argument "env" must be one of [staging prod]`, `argument "replicas" must be of type integer`}, `{"env":"qa","replicas":"two"}`, `{}`},
+		{"missing required argument", "deploy", map[string]any{}, "", false, []string{`missing required argument "env"`}, `{"replicas":1}`, `{"replicas":1}`},
+		{"unknown tool", "destroy", map[string]any{}, "tool 'destroy' not found", false, nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := executeGroupTool(context.Background(), group, &executeArgs{MCPName: "svc-dry", ToolName: tt.toolName, Arguments: tt.arguments, DryRun: true})
+			assert.Equal(t, 0, calls, "dry run must not call the upstream tool")
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+
+			callResult := toolResultFromStructured(result)
+			assert.Equal(t, !tt.wantValid, callResult.IsError)
+			assert.Contains(t, callResult.Content[0].(mcp.TextContent).Text, "DRY RUN")
+			structured, ok := callResult.StructuredContent.(map[string]any)
+			if !assert.True(t, ok) {
+				return
+			}
+			assert.Equal(t, true, structured["dry_run"])
+			assert.Equal(t, tt.wantValid, structured["valid"])
+			assert.Equal(t, tt.wantErrors, structured["errors"])
+			arguments, _ := json.Marshal(structured["arguments"])
+			assert.JSONEq(t, tt.wantArguments, string(arguments))
+			defaults, _ := json.Marshal(structured["defaults"])
+			assert.JSONEq(t, tt.wantDefaults, string(defaults))
+		})
+	}
+
+	args, err := parseExecuteArgs(map[string]any{"mcp_name": "svc-dry", "tool_name": "deploy", "dry_run": true, "env": "prod"})
+	assert.NoError(t, err)
+	assert.True(t, args.DryRun)
+	assert.Equal(t, map[string]any{"env": "prod"}, args.Arguments)
+}
+
+func TestParseExecuteArgsStrictness(t *testing.T) {
+	common.OptionMapRWMutex.Lock()
+	original := common.OptionMap[common.OptionExecuteArgsStrictness]
+	common.OptionMapRWMutex.Unlock()
+	setStrictness := func(value string) {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionExecuteArgsStrictness] = value
+		common.OptionMapRWMutex.Unlock()
+	}
+	defer setStrictness(original)
+
+	shapes := map[string]map[string]any{
+		"arguments":      {"mcp_name": "svc", "tool_name": "echo", "arguments": map[string]any{"message": "hi"}},
+		"arguments json": {"mcp_name": "svc", "tool_name": "echo", "arguments": `{"message": "hi"}`},
+		"parameters":     {"mcp_name": "svc", "tool_name": "echo", "parameters": map[string]any{"message": "hi"}},
+		"top level":      {"mcp_name": "svc", "tool_name": "echo", "message": "hi", "dry_run": true},
+		"no arguments":   {"mcp_name": "svc", "tool_name": "echo"},
+	}
+	tests := []struct {
+		strictness  string
+		shape       string
+		wantErr     string
+		wantArgs    map[string]any
+		wantWarning string
+	}{
+		{common.ExecuteArgsLenient, "arguments", "", map[string]any{"message": "hi"}, ""},
+		{common.ExecuteArgsLenient, "parameters", "", map[string]any{"message": "hi"}, ""},
+		{common.ExecuteArgsLenient, "top level", "", map[string]any{"message": "hi"}, ""},
+		{common.ExecuteArgsLenient, "no arguments", "", map[string]any{}, ""},
+		{common.ExecuteArgsWarn, "arguments", "", map[string]any{"message": "hi"}, ""},
+		{common.ExecuteArgsWarn, "arguments json", "", map[string]any{"message": "hi"}, ""},
+		{common.ExecuteArgsWarn, "parameters", "", map[string]any{"message": "hi"}, "read from 'parameters'"},
+		{common.ExecuteArgsWarn, "top level", "", map[string]any{"message": "hi"}, "top-level fields [message]"},
+		{common.ExecuteArgsWarn, "no arguments", "", map[string]any{}, ""},
+		{"", "parameters", "", map[string]any{"message": "hi"}, "read from 'parameters'"},
+		{common.ExecuteArgsStrict, "arguments", "", map[string]any{"message": "hi"}, ""},
+		{common.ExecuteArgsStrict, "arguments json", "", map[string]any{"message": "hi"}, ""},
+		{common.ExecuteArgsStrict, "parameters", "not 'parameters'", nil, ""},
+		{common.ExecuteArgsStrict, "top level", "arguments is required", nil, ""},
+		{common.ExecuteArgsStrict, "no arguments", "arguments is required", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strictness+"/"+tt.shape, func(t *testing.T) {
+			setStrictness(tt.strictness)
+			args, err := parseExecuteArgs(shapes[tt.shape])
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.wantArgs, args.Arguments)
+			if tt.wantWarning == "" {
+				assert.Empty(t, args.ArgumentsWarning)
+			} else {
+				assert.Contains(t, args.ArgumentsWarning, tt.wantWarning)
+			}
+		})
+	}
+
+	// 警告附加在工具结果末尾，客户端可以看到
+	result := withArgumentsWarning(mcp.NewToolResultText("ok"), "tool arguments were read from 'parameters'")
+	if assert.Len(t, result.Content, 2) {
+		text, _ := result.Content[1].(mcp.TextContent)
+		assert.Equal(t, "Warning: tool arguments were read from 'parameters'", text.Text)
+	}
+	assert.Len(t, withArgumentsWarning(mcp.NewToolResultText("ok"), "").Content, 1)
+}
+
+func TestExecuteGroupToolUnknownTool(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	calls := 0
+	upstream := mcpserver.NewMCPServer("unknown-tool", "1.0.0")
+	for _, name := range []string{"search", "fetch"} {
+		upstream.AddTool(mcp.Tool{Name: name, InputSchema: mcp.ToolInputSchema{Type: "object"}}, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls++
+			return mcp.NewToolResultText("ok"), nil
+		})
+	}
+	cli, err := mcpclient.NewInProcessClient(upstream)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Client: cli}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	svc := &model.MCPService{Name: "svc-unknown-tool", DisplayName: "Unknown Tool", Type: model.ServiceTypeStdio, Command: "echo", ArgsJSON: `[]`, Enabled: true}
+	assert.NoError(t, model.CreateService(svc))
+	// The cache predates the "fetch" tool; a miss is checked again against the upstream
+	proxy.GetToolsCacheManager().SetServiceTools(svc.ID, &proxy.ToolsCacheEntry{Tools: []mcp.Tool{{Name: "search"}}})
+	defer proxy.GetToolsCacheManager().DeleteServiceTools(svc.ID)
+
+	group := &model.MCPServiceGroup{UserID: 1, Name: "group-unknown-tool", DisplayName: "Group Unknown Tool", Enabled: true}
+	group.SetServiceIDs([]int64{svc.ID})
+	assert.NoError(t, group.Insert())
+
+	_, err = executeGroupTool(context.Background(), group, &executeArgs{MCPName: svc.Name, ToolName: "fetch", Arguments: map[string]any{}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	_, err = executeGroupTool(context.Background(), group, &executeArgs{MCPName: svc.Name, ToolName: "serach", Arguments: map[string]any{}})
+	var notFound *toolNotFoundError
+	if assert.ErrorAs(t, err, &notFound) {
+		assert.Equal(t, []string{"fetch", "search"}, notFound.available)
+		assert.Contains(t, err.Error(), "tool 'serach' not found in svc-unknown-tool, available tools: [fetch, search]")
+		assert.Contains(t, err.Error(), "search_tools")
+	}
+	assert.Equal(t, 1, calls, "an unknown tool must not be forwarded upstream")
+
+	result := toolErrorResult(err)
+	assert.True(t, result.IsError)
+	structured, ok := result.StructuredContent.(map[string]any)
+	if assert.True(t, ok) {
+		assert.Equal(t, mcp.METHOD_NOT_FOUND, structured["error"].(map[string]any)["code"])
+		assert.Equal(t, []string{"fetch", "search"}, structured["available_tools"])
+	}
+
+	// With the check disabled the call is forwarded and the upstream answers
+	common.OptionMapRWMutex.Lock()
+	originalOption := common.OptionMap[common.OptionRejectUnknownTools]
+	common.OptionMap[common.OptionRejectUnknownTools] = "false"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionRejectUnknownTools] = originalOption
+		common.OptionMapRWMutex.Unlock()
+	}()
+	_, err = executeGroupTool(context.Background(), group, &executeArgs{MCPName: svc.Name, ToolName: "serach", Arguments: map[string]any{}})
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &notFound))
+}
+
+func TestDestructiveToolHints(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	dropTool := mcp.NewTool("drop_table", mcp.WithDestructiveHintAnnotation(true))
+	readTool := mcp.NewTool("read_table", mcp.WithReadOnlyHintAnnotation(true))
+	plainTool := mcp.Tool{Name: "plain", InputSchema: mcp.ToolInputSchema{Type: "object"}}
+
+	calls := 0
+	var lastArgs map[string]any
+	upstream := mcpserver.NewMCPServer("destructive", "1.0.0")
+	for _, tool := range []mcp.Tool{dropTool, readTool, plainTool} {
+		upstream.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls++
+			lastArgs = request.GetArguments()
+			return mcp.NewToolResultText("ok"), nil
+		})
+	}
+	cli, err := mcpclient.NewInProcessClient(upstream)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Client: cli}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	svc := &model.MCPService{Name: "svc-destructive", DisplayName: "Destructive", Type: model.ServiceTypeStdio, Command: "echo", ArgsJSON: `[]`, Enabled: true}
+	assert.NoError(t, model.CreateService(svc))
+	proxy.GetToolsCacheManager().SetServiceTools(svc.ID, &proxy.ToolsCacheEntry{Tools: []mcp.Tool{dropTool, readTool, plainTool}})
+	defer proxy.GetToolsCacheManager().DeleteServiceTools(svc.ID)
+
+	group := &model.MCPServiceGroup{UserID: 1, Name: "group-destructive", DisplayName: "Group Destructive", Enabled: true}
+	group.SetServiceIDs([]int64{svc.ID})
+	assert.NoError(t, group.Insert())
+
+	// search_tools surfaces the hints
+	result, err := searchGroupTools(context.Background(), group, &groupSearchArgs{MCPName: svc.Name})
+	assert.NoError(t, err)
+	var listed []yamlTool
+	assert.NoError(t, yaml.Unmarshal([]byte(result.(map[string]any)["content"].([]map[string]any)[0]["text"].(string)), &listed))
+	hints := map[string][2]bool{}
+	for _, tool := range listed {
+		hints[tool.Name] = [2]bool{tool.ReadOnly, tool.Destructive}
+	}
+	assert.Equal(t, map[string][2]bool{"drop_table": {false, true}, "read_table": {true, false}, "plain": {false, false}}, hints)
+
+	// The OpenAPI operations carry them as extensions
+	operation := groupToolOperation(svc, dropTool)
+	assert.Equal(t, true, operation["x-mcp-destructive"])
+	assert.NotContains(t, operation, "parameters")
+	assert.Equal(t, true, groupToolOperation(svc, readTool)["x-mcp-read-only"])
+	assert.NotContains(t, groupToolOperation(svc, plainTool), "x-mcp-destructive")
+
+	// Without ConfirmDestructive destructive tools run unconfirmed
+	_, err = executeGroupTool(context.Background(), group, &executeArgs{MCPName: svc.Name, ToolName: "drop_table", Arguments: map[string]any{}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	svc.ConfirmDestructive = true
+	assert.NoError(t, model.UpdateService(svc))
+	assert.Contains(t, groupToolOperation(svc, dropTool), "parameters")
+
+	_, err = executeGroupTool(context.Background(), group, &executeArgs{MCPName: svc.Name, ToolName: "drop_table", Arguments: map[string]any{}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "confirm: true")
+	}
+	assert.Equal(t, 1, calls, "an unconfirmed destructive call must not reach the upstream")
+
+	args, err := parseExecuteArgs(map[string]any{"mcp_name": svc.Name, "tool_name": "drop_table", "arguments": map[string]any{}, "confirm": "true"})
+	assert.NoError(t, err)
+	assert.True(t, args.Confirm)
+	_, err = executeGroupTool(context.Background(), group, args)
+	assert.NoError(t, err)
+	_, err = executeGroupTool(context.Background(), group, &executeArgs{MCPName: svc.Name, ToolName: "read_table", Arguments: map[string]any{}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// Flat tools advertise the confirm argument and take it from the call arguments like execute_tool
+	flatServer := mcpserver.NewMCPServer("flat-destructive", "1.0.0")
+	complete, err := addGroupFlatTools(context.Background(), flatServer, group)
+	assert.NoError(t, err)
+	assert.True(t, complete)
+	flatClient, err := mcpclient.NewInProcessClient(flatServer)
+	assert.NoError(t, err)
+	_, err = flatClient.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+	flatTools, err := flatClient.ListTools(context.Background(), mcp.ListToolsRequest{})
+	assert.NoError(t, err)
+	for _, tool := range flatTools.Tools {
+		_, hasConfirm := tool.InputSchema.Properties["confirm"]
+		assert.Equal(t, tool.Name == flatGroupToolName(svc.Name, "drop_table"), hasConfirm, tool.Name)
+	}
+
+	callFlat := func(arguments map[string]any) *mcp.CallToolResult {
+		request := mcp.CallToolRequest{}
+		request.Params.Name = flatGroupToolName(svc.Name, "drop_table")
+		request.Params.Arguments = arguments
+		result, err := flatClient.CallTool(context.Background(), request)
+		assert.NoError(t, err)
+		return result
+	}
+	assert.True(t, callFlat(map[string]any{}).IsError)
+	assert.Equal(t, 3, calls, "an unconfirmed flat call must not reach the upstream")
+	assert.False(t, callFlat(map[string]any{"confirm": true}).IsError)
+	assert.Equal(t, 4, calls)
+	assert.NotContains(t, lastArgs, "confirm", "the confirmation flag is not forwarded upstream")
+}
+
+func TestGroupInitializeProtocolVersion(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	common.OptionMapRWMutex.Lock()
+	original := common.OptionMap[common.OptionMCPProtocolVersion]
+	common.OptionMapRWMutex.Unlock()
+	defer model.UpdateOptionMap(common.OptionMCPProtocolVersion, original)
+
+	server, _, err := buildGroupMCPServer(context.Background(), &model.MCPServiceGroup{Name: "protocol", ServiceIDsJSON: "[]"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		configured string
+		requested  string
+		want       string
+	}{
+		{"defaults to the library latest", "", mcp.LATEST_PROTOCOL_VERSION, mcp.LATEST_PROTOCOL_VERSION},
+		{"echoes an older client version", "", "2024-11-05", "2024-11-05"},
+		{"unknown client version gets the advertised one", "", "1999-01-01", mcp.LATEST_PROTOCOL_VERSION},
+		{"configured version caps newer clients", "2025-03-26", mcp.LATEST_PROTOCOL_VERSION, "2025-03-26"},
+		{"configured version keeps older clients", "2025-03-26", "2024-11-05", "2024-11-05"},
+		{"invalid configuration falls back to latest", "not-a-version", "2025-06-18", "2025-06-18"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model.UpdateOptionMap(common.OptionMCPProtocolVersion, tt.configured)
+			cli, err := mcpclient.NewInProcessClient(server)
+			assert.NoError(t, err)
+			defer cli.Close()
+
+			initReq := mcp.InitializeRequest{}
+			initReq.Params.ProtocolVersion = tt.requested
+			result, err := cli.Initialize(context.Background(), initReq)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, result.ProtocolVersion)
+		})
+	}
+}
+
+func TestSharedGroupACL(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+	gin.SetMode(gin.TestMode)
+
+	newUser := func(username string, role int) *model.User {
+		user := &model.User{Username: username, DisplayName: username, Role: role, Status: common.UserStatusEnabled, Token: username + "-token"}
+		assert.NoError(t, user.Insert())
+		return user
+	}
+	owner := newUser("acl-owner", common.RoleCommonUser)
+	member := newUser("acl-member", common.RoleCommonUser)
+	reader := newUser("acl-admin-reader", common.RoleAdminUser)
+	outsider := newUser("acl-outsider", common.RoleCommonUser)
+
+	acl, _ := json.Marshal([]model.GroupACLEntry{
+		{UserID: member.ID, Permission: model.GroupPermissionExecute},
+		{Role: common.RoleAdminUser, Permission: model.GroupPermissionRead},
+	})
+	group := &model.MCPServiceGroup{UserID: owner.ID, Name: "acl-shared-group", DisplayName: "Shared", Enabled: true, ACLJSON: string(acl)}
+	group.SetServiceIDs([]int64{})
+	assert.NoError(t, group.Insert())
+
+	initialize := func(user *model.User) int {
+		req := newJSONRequest(t, http.MethodPost, "/group/acl-shared-group/mcp", map[string]any{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "initialize",
+			"params": map[string]any{
+				"protocolVersion": mcp.LATEST_PROTOCOL_VERSION,
+				"clientInfo":      map[string]any{"name": "acl-test", "version": "0.0.0"},
+				"capabilities":    map[string]any{},
+			},
+		})
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = req
+		ctx.Params = gin.Params{{Key: "name", Value: "acl-shared-group"}}
+		ctx.Set("user_id", user.ID)
+		ctx.Set("role", user.Role)
+		GroupMCPHandler(ctx)
+		return recorder.Code
+	}
+	export := func(user *model.User) int {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/api/groups/"+strconv.FormatInt(group.ID, 10)+"/export", nil)
+		ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(group.ID, 10)}}
+		ctx.Set("user_id", user.ID)
+		ctx.Set("role", user.Role)
+		ExportGroupSkill(ctx)
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name        string
+		user        *model.User
+		wantMCP     int
+		wantExport  int
+		description string
+	}{
+		{"owner", owner, http.StatusOK, http.StatusOK, "single owner keeps full access"},
+		{"member with execute", member, http.StatusOK, http.StatusOK, "execute implies read"},
+		{"role with read only", reader, http.StatusNotFound, http.StatusOK, "read does not allow the MCP endpoint"},
+		{"unauthorized user", outsider, http.StatusNotFound, http.StatusNotFound, "no entry grants access"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantMCP, initialize(tt.user), tt.description)
+			assert.Equal(t, tt.wantExport, export(tt.user), tt.description)
+		})
+	}
+
+	// 分组设置只有所有者可以修改
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = newJSONRequest(t, http.MethodPut, "/api/groups/"+strconv.FormatInt(group.ID, 10), map[string]any{"acl_json": ""})
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(group.ID, 10)}}
+	ctx.Set("user_id", member.ID)
+	UpdateGroup(ctx)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// 非法的 ACL 条目被拒绝
+	recorder = httptest.NewRecorder()
+	ctx, _ = gin.CreateTestContext(recorder)
+	ctx.Request = newJSONRequest(t, http.MethodPut, "/api/groups/"+strconv.FormatInt(group.ID, 10), map[string]any{"acl_json": `[{"user_id":1,"role":10,"permission":"execute"}]`})
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(group.ID, 10)}}
+	ctx.Set("user_id", owner.ID)
+	UpdateGroup(ctx)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -2,10 +2,10 @@ package handler
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"one-mcp/backend/common"
@@ -14,6 +14,8 @@ import (
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 	"one-mcp/backend/service"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -71,6 +73,67 @@ func sanitizeServiceName(raw string) string {
 	return name
 }
 
+// uniqueServiceName returns base, or base with the first free numeric suffix ("base-2", "base-3", ...)
+// when a service with that name already exists.
+func uniqueServiceName(base string) string {
+	name := base
+	for i := 2; ; i++ {
+		if existing, err := model.GetServiceByName(name); err != nil || existing == nil {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// installerName returns the username of the user who installed a service, or "" for services created by the
+// system (batch import) or whose installer no longer exists.
+func installerName(userID int64) string {
+	if userID == 0 {
+		return ""
+	}
+	user, err := model.GetUserById(userID, false)
+	if err != nil {
+		return ""
+	}
+	return user.Username
+}
+
+// logServiceInstaller records who installed the service in its install log, so admins can tell who added it
+func logServiceInstaller(ctx context.Context, svc *model.MCPService) {
+	installer := "system"
+	if name := installerName(svc.InstalledByUserID); name != "" {
+		installer = fmt.Sprintf("%s (ID: %d)", name, svc.InstalledByUserID)
+	}
+	msg := fmt.Sprintf("Service %s installed by %s", svc.Name, installer)
+	if err := model.SaveMCPLog(ctx, svc.ID, svc.Name, model.MCPLogPhaseInstall, model.MCPLogLevelInfo, msg); err != nil {
+		common.SysError(fmt.Sprintf("Failed to save installer log for %s: %v", svc.Name, err))
+	}
+}
+
+// canUninstallService applies the UninstallInstallerOnly option: when enabled only the installer of a service
+// or a root user may uninstall it. Services created by the system can be uninstalled by any admin.
+func canUninstallService(c *gin.Context, svc *model.MCPService) bool {
+	if !common.GetUninstallInstallerOnly() || svc.InstalledByUserID == 0 {
+		return true
+	}
+	return c.GetInt("role") >= common.RoleRootUser || c.GetInt64("user_id") == svc.InstalledByUserID
+}
+
+// packageSharedWithOtherServices reports whether another service is installed from the same package,
+// in which case uninstalling the service must leave the package in place.
+func packageSharedWithOtherServices(svc *model.MCPService) bool {
+	services, err := model.GetServicesByPackageDetails(svc.PackageManager, svc.SourcePackageName)
+	if err != nil {
+		return false
+	}
+	for _, other := range services {
+		if other.ID != svc.ID {
+			return true
+		}
+	}
+	return false
+}
+
 // GetPackageDetails godoc
 // @Summary 获取包详情
 // @Description 获取指定包的详细信息
@@ -200,13 +263,8 @@ func GetPackageDetails(c *gin.Context) {
 			if serviceErr != nil {
 				common.SysLog(fmt.Sprintf("Error fetching service details for ID %d: %v", installedServiceID, serviceErr))
 			} else {
-				// 1. 从 DefaultEnvsJSON 加载默认环境变量
-				finalEnvValues := make(map[string]string)
-				if installedService.DefaultEnvsJSON != "" {
-					if err := json.Unmarshal([]byte(installedService.DefaultEnvsJSON), &finalEnvValues); err != nil {
-						common.SysLog(fmt.Sprintf("Error unmarshaling DefaultEnvsJSON for service ID %d: %v", installedServiceID, err))
-					}
-				}
+				// 1. 从 DefaultEnvsJSON 加载当前环境的默认环境变量
+				finalEnvValues := installedService.ActiveDefaultEnvs()
 
 				// 2. 如果用户已登录，尝试加载并合并UserConfig（用户特定配置应覆盖默认配置）
 				if userID != 0 {
@@ -337,16 +395,38 @@ func DiscoverEnvVars(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	// 根据包管理器类型发现环境变量
+	envVarDefinitions, _, err := discoverEnvVarDefinitions(ctx, packageManager, packageName)
+	if err != nil {
+		if errors.Is(err, errUnsupportedPackageManager) {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_package_manager", lang))
+			return
+		}
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_npm_package_details_failed", lang), err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"env_vars": envVarDefinitions,
+	}
+
+	common.RespSuccess(c, response)
+}
+
+// errUnsupportedPackageManager is returned by env var discovery for package managers without discovery support
+var errUnsupportedPackageManager = errors.New("unsupported package manager")
+
+// discoverEnvVarDefinitions 从包详情与 README 中发现环境变量定义；可在测试中替换以模拟 registry。
+// authoritative 表示所有定义都来自包的 MCP 配置或 RequiresEnv 声明，而不是从 README 文本猜测的
+var discoverEnvVarDefinitions = func(ctx context.Context, packageManager, packageName string) ([]model.EnvVarDefinition, bool, error) {
 	var envVars []string
+	guessed := false
 
 	switch packageManager {
 	case "npm":
 		// 获取包详情
 		details, err := market.GetNPMPackageDetails(ctx, packageName)
 		if err != nil {
-			common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_npm_package_details_failed", lang), err)
-			return
+			return nil, false, err
 		}
 
 		// 获取README内容
@@ -367,6 +447,7 @@ func DiscoverEnvVars(c *gin.Context) {
 		// 如果MCP配置中没有找到环境变量，则从README中猜测
 		if len(envVars) == 0 {
 			envVars = market.GuessMCPEnvVarsFromReadme(readme)
+			guessed = len(envVars) > 0
 		}
 
 		// 如果包中声明了RequiresEnv字段
@@ -379,8 +460,7 @@ func DiscoverEnvVars(c *gin.Context) {
 		}
 
 	default:
-		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_package_manager", lang))
-		return
+		return nil, false, errUnsupportedPackageManager
 	}
 
 	// 将猜测到的环境变量转换为EnvVarDefinition格式
@@ -394,12 +474,7 @@ func DiscoverEnvVars(c *gin.Context) {
 		}
 		envVarDefinitions = append(envVarDefinitions, definition)
 	}
-
-	response := map[string]interface{}{
-		"env_vars": envVarDefinitions,
-	}
-
-	common.RespSuccess(c, response)
+	return envVarDefinitions, !guessed, nil
 }
 
 // validateAndGetPyPIPackageInfo validates if PyPI package exists and retrieves description info
@@ -415,23 +490,16 @@ func validateAndGetPyPIPackageInfo(ctx context.Context, packageName string) (str
 
 	// Send request
 	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	statusCode, data, err := market.FetchRegistry(ctx, client, req)
 	if err != nil {
 		return "", fmt.Errorf("failed to check package: %w", err)
 	}
-	defer resp.Body.Close()
 
 	// Check HTTP status code
-	if resp.StatusCode == http.StatusNotFound {
+	if statusCode == http.StatusNotFound {
 		return "", fmt.Errorf("package not found in PyPI")
-	} else if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("PyPI API returned error: status code %d", resp.StatusCode)
-	}
-
-	// Read response content
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	} else if statusCode != http.StatusOK {
+		return "", fmt.Errorf("PyPI API returned error: status code %d", statusCode)
 	}
 
 	// Parse JSON to get package info
@@ -585,9 +653,28 @@ var (
 	tasksMutex       = &sync.Mutex{}
 )
 
+// rejectDisallowedInstallCategory responds 403 and returns true when the caller's role may not install
+// services of the given category (see common.OptionInstallCategoryAllowlist)
+func rejectDisallowedInstallCategory(c *gin.Context, lang string, category model.ServiceCategory) bool {
+	allowed, restricted := common.GetInstallCategoryAllowlist(c.GetInt("role"))
+	if !restricted || slices.Contains(allowed, strings.ToLower(string(category))) {
+		return false
+	}
+	common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("install_category_not_allowed", lang, category))
+	return true
+}
+
+// Package runner checks and task submission used by InstallOrAddService; tests replace them to avoid
+// depending on npx/uvx and running real installations.
+var (
+	checkNPXAvailable      = market.CheckNPXAvailable
+	checkUVXAvailable      = market.CheckUVXAvailable
+	submitInstallationTask = func(task market.InstallationTask) { market.GetInstallationManager().SubmitTask(task) }
+)
+
 // InstallOrAddService godoc
 // @Summary 安装或添加服务
-// @Description 从市场安装服务或添加现有服务
+// @Description 从市场安装服务或添加现有服务；force_new 为 true 时即使包已安装也创建一个独立的服务（名称自动加序号），以便同一个包使用不同的配置
 // @Tags Market
 // @Accept json
 // @Produce json
@@ -612,6 +699,10 @@ func InstallOrAddService(c *gin.Context) {
 		Category            model.ServiceCategory  `json:"category"`               // Optional: for creating MCPService
 		Headers             map[string]string      `json:"headers"`                // Optional: for SSE/HTTP services custom headers
 		CustomArgs          []string               `json:"custom_args"`            // Optional: for stdio services custom arguments
+		InstallTimeoutSecs  int                    `json:"install_timeout"`        // Optional: overrides the global McpInstallTimeout (seconds)
+		ForceNew            bool                   `json:"force_new"`              // Optional: create a separate service even if the package is already installed
+		PythonVersion       string                 `json:"python_version"`         // Optional: uvx --python for python packages, overrides the global UVXPythonVersion
+		IndexURL            string                 `json:"index_url"`              // Optional: uvx --index-url for python packages, overrides the global UVXIndexURL
 	}
 
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
@@ -619,6 +710,17 @@ func InstallOrAddService(c *gin.Context) {
 		return
 	}
 
+	requestBody.PythonVersion = strings.TrimSpace(requestBody.PythonVersion)
+	requestBody.IndexURL = strings.TrimSpace(requestBody.IndexURL)
+	if err := model.ValidatePythonVersion(requestBody.PythonVersion); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_uvx_options", lang), err)
+		return
+	}
+	if err := model.ValidateIndexURL(requestBody.IndexURL); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_uvx_options", lang), err)
+		return
+	}
+
 	userID := getUserIDFromContext(c)
 	if userID == 0 && requestBody.SourceType != "predefined" { // Predefined might be admin setup
 		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
@@ -644,6 +746,14 @@ func InstallOrAddService(c *gin.Context) {
 		// For predefined, userID might be 0 if it's an admin setting up global defaults or if auth is handled differently.
 		// The addServiceInstanceForUser function should be robust enough or this path needs specific logic for userID=0.
 		// For now, we pass the userID obtained. If it's 0, addServiceInstanceForUser might need to handle it.
+		predefinedService, err := model.GetServiceByID(requestBody.MCServiceID)
+		if err != nil {
+			common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+			return
+		}
+		if rejectDisallowedInstallCategory(c, lang, predefinedService.Category) {
+			return
+		}
 		if err := addServiceInstanceForUser(c, userID, requestBody.MCServiceID, sanitizedEnvVarsForUser); err != nil {
 			common.RespError(c, http.StatusInternalServerError, i18n.Translate("add_service_instance_failed", lang), err)
 			return
@@ -662,11 +772,11 @@ func InstallOrAddService(c *gin.Context) {
 		uvSourceSpec := resolveUVSourceSpec(requestBody.PackageName, requestBody.CustomArgs)
 
 		// Check tool availability
-		if requestBody.PackageManager == "npm" && !market.CheckNPXAvailable() {
+		if requestBody.PackageManager == "npm" && !checkNPXAvailable() {
 			common.RespErrorStr(c, http.StatusInternalServerError, i18n.Translate("npx_not_available", lang))
 			return
 		}
-		if (requestBody.PackageManager == "pypi" || requestBody.PackageManager == "uv" || requestBody.PackageManager == "pip") && !market.CheckUVXAvailable() {
+		if (requestBody.PackageManager == "pypi" || requestBody.PackageManager == "uv" || requestBody.PackageManager == "pip") && !checkUVXAvailable() {
 			// Assuming "pip" also uses "uv" for now or this check is sufficient
 			common.RespErrorStr(c, http.StatusInternalServerError, i18n.Translate("uv_not_available", lang))
 			return
@@ -679,8 +789,12 @@ func InstallOrAddService(c *gin.Context) {
 			existingServices, err = model.GetServicesByPackageDetails(requestBody.PackageManager, requestBody.PackageName)
 		}
 
-		if err == nil && len(existingServices) > 0 {
+		// force_new 时即使已安装也创建独立的服务，以便同一个包使用不同的配置
+		if err == nil && len(existingServices) > 0 && !requestBody.ForceNew {
 			mcpServiceID := existingServices[0].ID
+			if rejectDisallowedInstallCategory(c, lang, existingServices[0].Category) {
+				return
+			}
 			if err := addServiceInstanceForUser(c, userID, mcpServiceID, sanitizedEnvVarsForUser); err != nil {
 				common.RespError(c, http.StatusInternalServerError, i18n.Translate("add_service_instance_failed", lang), err)
 				return
@@ -694,6 +808,25 @@ func InstallOrAddService(c *gin.Context) {
 		}
 
 		// New package, create MCPService, then submit installation task
+		category := requestBody.Category
+		if category == "" {
+			category = model.CategoryAI
+		}
+		if rejectDisallowedInstallCategory(c, lang, category) {
+			return
+		}
+
+		// 限制单个用户同时进行中的安装数量，避免占满安装队列；名额在检查时即预留，任务提交后归还
+		if userID != 0 {
+			limit := common.GetMaxConcurrentInstallsPerUser()
+			release, ok := market.GetInstallationManager().ReserveInstallSlot(userID, limit)
+			if !ok {
+				common.RespErrorStr(c, http.StatusTooManyRequests, i18n.Translate("install_limit_reached", lang, limit))
+				return
+			}
+			defer release()
+		}
+
 		displayName := requestBody.DisplayName
 		if displayName == "" {
 			displayName = requestBody.PackageName
@@ -747,25 +880,12 @@ func InstallOrAddService(c *gin.Context) {
 			// TODO: Implement automatic environment variable discovery for PyPI packages
 		}
 		// Check if all required environment variables are provided
-		var missingEnvVars []string
+		envVarDefinitions := make([]model.EnvVarDefinition, 0, len(requiredEnvVars))
 		for _, env := range requiredEnvVars {
-			if env == "" {
-				continue
-			}
-			if _, ok := envVarsForTask[env]; !ok {
-				missingEnvVars = append(missingEnvVars, env)
-			}
+			envVarDefinitions = append(envVarDefinitions, model.EnvVarDefinition{Name: env})
 		}
-		if len(missingEnvVars) > 0 && !isCustomSource {
-			// Use i18n for the error message
-			msg := i18n.Translate("missing_required_env_vars", lang, strings.Join(missingEnvVars, ", "))
-			c.JSON(http.StatusOK, common.APIResponse{ // use 200 OK, because this is not an error, but requires user input
-				Success: false, // require next action from user
-				Message: msg,
-				Data: gin.H{
-					"required_env_vars": missingEnvVars,
-				},
-			})
+		if missingEnvVars := model.MissingRequiredEnvVars(envVarDefinitions, envVarsForTask); len(missingEnvVars) > 0 && !isCustomSource {
+			respondMissingEnvVars(c, lang, missingEnvVars)
 			return
 		}
 
@@ -779,20 +899,19 @@ func InstallOrAddService(c *gin.Context) {
 			Name:                  sanitizeServiceName(requestBody.PackageName),
 			DisplayName:           displayName,
 			Description:           serviceDescription,
-			Category:              requestBody.Category,
-			Icon:                  requestBody.ServiceIconURL,
+			Category:              category,
+			Icon:                  service.ResolveServiceIcon(c.Request.Context(), requestBody.ServiceIconURL),
 			Type:                  model.ServiceTypeStdio,
 			PackageManager:        requestBody.PackageManager,
 			SourcePackageName:     requestBody.PackageName,
 			ClientConfigTemplates: "{}",
 			Enabled:               true, // 安装时直接启用服务
 			HealthStatus:          string(market.StatusPending),
-			InstallerUserID:       userID, // 记录安装者
+			InstalledByUserID:     userID, // 记录安装者
 		}
-		if newService.Category == "" {
-			newService.Category = model.CategoryAI
+		if requestBody.ForceNew {
+			newService.Name = uniqueServiceName(newService.Name)
 		}
-
 		// Check if the processed service name already exists
 		existingServiceByName, errByName := model.GetServiceByName(newService.Name)
 		if errByName == nil && existingServiceByName != nil {
@@ -833,6 +952,8 @@ func InstallOrAddService(c *gin.Context) {
 			}
 		case "pypi", "uv", "pip":
 			newService.Command = "uvx"
+			newService.UVXPythonVersion = requestBody.PythonVersion
+			newService.UVXIndexURL = requestBody.IndexURL
 			var args []string
 			if len(requestBody.CustomArgs) > 0 {
 				// Use custom arguments provided by user
@@ -880,17 +1001,16 @@ func InstallOrAddService(c *gin.Context) {
 			return
 		}
 		log.Printf("[InstallOrAddService] Successfully created service with ID: %d, Command='%s', ArgsJSON='%s', DefaultEnvsJSON='%s'", newService.ID, newService.Command, newService.ArgsJSON, newService.DefaultEnvsJSON)
+		logServiceInstaller(c.Request.Context(), &newService)
 
 		// Note: No longer create ConfigService during installation, as installation environment variables are default configuration
 		// ConfigService is only created dynamically when users need personal configuration
 
-		// Parse ArgsJSON to get command arguments
-		var args []string
-		if newService.ArgsJSON != "" {
-			if err := json.Unmarshal([]byte(newService.ArgsJSON), &args); err != nil {
-				log.Printf("[InstallOrAddService] Failed to parse ArgsJSON for service %d: %v", newService.ID, err)
-				args = []string{} // Use empty args on parse error
-			}
+		// Build the command arguments the service runs with (ArgsJSON + RuntimeArgsJSON)
+		args, err := newService.CommandArgs()
+		if err != nil {
+			log.Printf("[InstallOrAddService] Failed to build args for service %d: %v", newService.ID, err)
+			args = []string{} // Use empty args on parse error
 		}
 
 		installationTask := market.InstallationTask{
@@ -903,11 +1023,14 @@ func InstallOrAddService(c *gin.Context) {
 			Args:           args,
 			EnvVars:        envVarsForTask,
 		}
+		if requestBody.InstallTimeoutSecs > 0 {
+			installationTask.Timeout = time.Duration(requestBody.InstallTimeoutSecs) * time.Second
+		}
 
 		log.Printf("[InstallOrAddService] About to submit installation task for ServiceID=%d, Package=%s, Manager=%s, Version=%s, EnvVars=%v",
 			newService.ID, requestBody.PackageName, requestBody.PackageManager, requestBody.Version, envVarsForTask)
 
-		market.GetInstallationManager().SubmitTask(installationTask)
+		submitInstallationTask(installationTask)
 
 		log.Printf("[InstallOrAddService] Installation task submitted successfully for ServiceID=%d", newService.ID)
 
@@ -922,6 +1045,78 @@ func InstallOrAddService(c *gin.Context) {
 	}
 }
 
+// ReinstallService godoc
+// @Summary 重新安装服务
+// @Description 为已安装的 npm/PyPI stdio 服务重新提交安装任务，用于命令因缓存被清理等原因不存在（健康状态为 needs_reinstall）时恢复服务
+// @Tags Market
+// @Accept json
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 409 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/reinstall [post]
+func ReinstallService(c *gin.Context) {
+	lang := c.GetString("lang")
+	serviceID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+	service, err := model.GetServiceByID(serviceID)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+	if service.IsFileManaged() {
+		common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("service_managed_by_file", lang))
+		return
+	}
+	switch service.PackageManager {
+	case "npm", "pypi", "uv", "pip":
+	default:
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("service_not_reinstallable", lang))
+		return
+	}
+	if service.Type != model.ServiceTypeStdio || service.SourcePackageName == "" {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("service_not_reinstallable", lang))
+		return
+	}
+	if market.GetInstallationManager().IsInstalling(service.ID) {
+		common.RespErrorStr(c, http.StatusConflict, i18n.Translate("installation_in_progress", lang))
+		return
+	}
+
+	// Reinstall with the arguments the service runs with, including its runtime args
+	args, err := service.CommandArgs()
+	if err != nil {
+		log.Printf("[ReinstallService] Failed to build args for service %d: %v", service.ID, err)
+		args = []string{}
+	}
+	envVars := service.ActiveDefaultEnvs()
+
+	submitInstallationTask(market.InstallationTask{
+		ServiceID:      service.ID,
+		UserID:         getUserIDFromContext(c),
+		PackageName:    service.SourcePackageName,
+		PackageManager: service.PackageManager,
+		Version:        service.InstalledVersion,
+		Command:        service.Command,
+		Args:           args,
+		EnvVars:        envVars,
+	})
+	log.Printf("[ReinstallService] Reinstallation task submitted for ServiceID=%d, Package=%s", service.ID, service.SourcePackageName)
+
+	common.RespSuccess(c, gin.H{
+		"message":        i18n.Translate("reinstall_submitted", lang),
+		"mcp_service_id": service.ID,
+		"task_id":        service.ID,
+		"status":         market.StatusPending,
+	})
+}
+
 // GetInstallationStatus godoc
 // @Summary 获取安装状态
 // @Description 获取指定服务的安装状态
@@ -990,6 +1185,7 @@ func GetInstallationStatus(c *gin.Context) {
 		"package_name": task.PackageName,
 		"status":       task.Status,
 		"start_time":   task.StartTime,
+		"elapsed":      task.Elapsed().Seconds(),
 	}
 
 	if task.Status == market.StatusCompleted || task.Status == market.StatusFailed {
@@ -998,6 +1194,7 @@ func GetInstallationStatus(c *gin.Context) {
 
 		if task.Status == market.StatusFailed {
 			response["error"] = task.Error
+			response["timed_out"] = task.TimedOut
 		}
 	}
 
@@ -1042,6 +1239,16 @@ func UninstallService(c *gin.Context) {
 		return
 	}
 
+	if service.IsFileManaged() {
+		common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("service_managed_by_file", lang))
+		return
+	}
+
+	if !canUninstallService(c, service) {
+		common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("uninstall_installer_only", lang))
+		return
+	}
+
 	// 检查是否是处于安装中的服务
 	isPendingOrInstalling := false
 	if service.InstalledVersion == "" || service.InstalledVersion == "installing" {
@@ -1096,7 +1303,10 @@ func UninstallService(c *gin.Context) {
 		// 卸载服务 - 根据 PackageManager 调用相应的卸载逻辑
 		// 注意: 只有 stdio 类型且有 PackageManager 的服务才涉及物理卸载
 		// SSE/HTTP 类型服务通常没有物理包卸载步骤，主要是DB记录的清理
-		if service.Type == model.ServiceTypeStdio && service.PackageManager != "" && service.SourcePackageName != "" {
+		hasPackage := service.Type == model.ServiceTypeStdio && service.PackageManager != "" && service.SourcePackageName != ""
+		if hasPackage && packageSharedWithOtherServices(service) {
+			log.Printf("Package %s of service ID %d is still used by other services. Skipping physical uninstall.", service.SourcePackageName, serviceID)
+		} else if hasPackage {
 			switch service.PackageManager {
 			case "npm":
 				if err := market.UninstallNPMPackage(service.SourcePackageName); err != nil {
@@ -1139,6 +1349,18 @@ func UninstallService(c *gin.Context) {
 
 // 辅助函数
 
+// respondMissingEnvVars asks the client to supply the listed environment variables before installing
+func respondMissingEnvVars(c *gin.Context, lang string, missingEnvVars []string) {
+	msg := i18n.Translate("missing_required_env_vars", lang, strings.Join(missingEnvVars, ", "))
+	c.JSON(http.StatusOK, common.APIResponse{ // use 200 OK, because this is not an error, but requires user input
+		Success: false, // require next action from user
+		Message: msg,
+		Data: gin.H{
+			"required_env_vars": missingEnvVars,
+		},
+	})
+}
+
 // addServiceInstanceForUser adds or updates UserConfig entries for a given user and MCPService.
 // It now also ensures that ConfigService entries exist for each provided environment variable.
 func addServiceInstanceForUser(c *gin.Context, userID int64, serviceID int64, userProvidedEnvVars map[string]interface{}) error {
@@ -1242,6 +1464,15 @@ func getInstalledPackages() (map[string]bool, error) {
 	return installedPackages, nil
 }
 
+// parseTagQuery 解析 ?tag= 查询参数，支持逗号分隔与重复参数
+func parseTagQuery(c *gin.Context) []string {
+	var tags []string
+	for _, value := range c.QueryArray("tag") {
+		tags = append(tags, strings.Split(value, ",")...)
+	}
+	return model.NormalizeServiceTags(tags)
+}
+
 // getUserIDFromContext 从上下文中获取用户ID
 func getUserIDFromContext(c *gin.Context) int64 {
 	userID, exists := c.Get("user_id")
@@ -1273,15 +1504,19 @@ func contains(slice []string, s string) bool {
 
 // SearchMCPMarket godoc
 // @Summary 搜索 MCP 市场服务
-// @Description 支持从 npm、PyPI、推荐列表聚合搜索
+// @Description 支持从 npm、PyPI 聚合搜索（PyPI 没有全文搜索 API，按搜索词推导的 MCP 项目名查询）。传入 cursor 参数（首页可为空）时使用游标分页，
+// @Description 返回 {items, next_cursor}；否则按 page/size 分页并直接返回结果数组
 // @Tags Market
 // @Accept json
 // @Produce json
 // @Param query query string false "搜索关键词"
-// @Param sources query string false "数据源, 逗号分隔 (npm,pypi,recommended)"
+// @Param sources query string false "数据源, 逗号分隔 (npm,pypi)，默认 npm"
 // @Param page query int false "页码"
 // @Param size query int false "每页数量"
+// @Param cursor query string false "上一页返回的 next_cursor，首页传空字符串"
+// @Param group_by_source query bool false "为 true 时按数据源分组返回（组顺序按 MarketSourcePriority），默认跨数据源按 score 交错排序"
 // @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
 // @Failure 500 {object} common.APIResponse
 // @Router /api/mcp_market/search [get]
 func SearchMCPMarket(c *gin.Context) {
@@ -1302,35 +1537,206 @@ func SearchMCPMarket(c *gin.Context) {
 		page = p
 	}
 	if s, err := strconv.Atoi(sizeStr); err == nil && s > 0 {
-		size = s
+		size = min(s, marketSearchMaxPageSize)
 	}
 
-	var results []market.SearchPackageResult
+	groupBySource, _ := strconv.ParseBool(c.Query("group_by_source"))
+
+	if rawCursor, ok := c.GetQuery("cursor"); ok {
+		searchMCPMarketByCursor(c, rawCursor, finalQuery, sources, size, groupBySource)
+		return
+	}
+
+	var sourceResults []market.SearchSourceResults
 	var err error
 
-	// 目前仅实现 npm，后续可扩展 pypi/recommended
 	if strings.Contains(sources, "npm") {
 		// Use finalQuery for searching
-		npmResult, e := market.SearchNPMPackages(ctx, finalQuery, size, page)
+		npmResult, e := searchNPMPackagesAt(ctx, finalQuery, size, (page-1)*size)
 		if e != nil {
 			err = e
 		} else {
-			// 查询已安装包的 numeric IDs
-			installedServiceIDs, err_installed := market.GetInstalledMCPServersFromDB() // Returns map[string]int64 now
-			if err_installed != nil {
-				common.SysLog("SearchMCPMarket: Error fetching installed server IDs: " + err_installed.Error())
-				// Continue without installed info if this fails, or handle error more strictly
-			}
-			results = append(results, market.ConvertNPMToSearchResult(ctx, npmResult, installedServiceIDs)...)
+			sourceResults = append(sourceResults, market.SearchSourceResults{Source: "npm", Results: market.ConvertNPMToSearchResult(npmResult, installedPackageIDs())})
 		}
 	}
-	// TODO: 支持 pypi、recommended
+	if strings.Contains(sources, "pypi") && err == nil {
+		pypiResults, _, e := searchPyPIPackagesAt(ctx, finalQuery, size, (page-1)*size, installedPackageIDs())
+		if e != nil {
+			err = e
+		} else {
+			sourceResults = append(sourceResults, market.SearchSourceResults{Source: "pypi", Results: pypiResults})
+		}
+	}
+	// TODO: 支持 recommended
 
 	if err != nil {
 		common.RespError(c, 500, "market_search_failed", err)
 		return
 	}
-	common.RespSuccess(c, results)
+	common.RespSuccess(c, market.MergeSearchResults(sourceResults, common.GetMarketSourcePriority(), groupBySource))
+}
+
+// searchNPMPackagesAt 按偏移量搜索 npm，测试中可替换
+var searchNPMPackagesAt = market.SearchNPMPackagesAt
+
+// searchPyPIPackagesAt 按偏移量搜索 PyPI，测试中可替换
+var searchPyPIPackagesAt = market.SearchPyPIPackagesAt
+
+// enrichNPMPackage 按需获取 npm 包的 stars 等元数据，测试中可替换
+var enrichNPMPackage = market.EnrichNPMPackage
+
+// EnrichMCPMarketPackage godoc
+// @Summary 按需补充市场包元数据
+// @Description 返回单个 npm 包的 GitHub stars、仓库地址等元数据。搜索结果不含 stars 以保证响应速度，前端为可见的结果逐个调用此接口；结果会被缓存
+// @Tags Market
+// @Accept json
+// @Produce json
+// @Param name query string true "包名"
+// @Param package_manager query string false "包管理器，目前仅支持 npm"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 502 {object} common.APIResponse
+// @Router /api/mcp_market/enrich [get]
+func EnrichMCPMarketPackage(c *gin.Context) {
+	lang := c.GetString("lang")
+	packageName := strings.TrimSpace(c.Query("name"))
+	if packageName == "" {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("package_name_required", lang))
+		return
+	}
+	if packageManager := c.DefaultQuery("package_manager", "npm"); packageManager != "npm" {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_package_manager", lang))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	enrichment, err := enrichNPMPackage(ctx, packageName)
+	if err != nil {
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("get_npm_package_details_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, enrichment)
+}
+
+// installedPackageIDs 查询已安装包的 numeric IDs，失败时返回 nil 并继续搜索
+func installedPackageIDs() map[string]int64 {
+	installedServiceIDs, err := market.GetInstalledMCPServersFromDB()
+	if err != nil {
+		common.SysLog("SearchMCPMarket: Error fetching installed server IDs: " + err.Error())
+	}
+	return installedServiceIDs
+}
+
+// marketSearchMaxPageSize 市场搜索每页数量上限，同时作用于 size 参数与游标中携带的数量
+const marketSearchMaxPageSize = 100
+
+// marketSearchCursor 是 next_cursor 的解码形式：查询条件、各数据源下一次请求的偏移量，
+// 以及上一页返回过的包名。结果在两次请求之间发生漂移时，用 Seen 过滤掉重复项。
+type marketSearchCursor struct {
+	Query   string         `json:"q"`
+	Sources string         `json:"src"`
+	Size    int            `json:"n"`
+	Offsets map[string]int `json:"o"`
+	Seen    []string       `json:"s,omitempty"`
+}
+
+func (cur *marketSearchCursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeMarketSearchCursor(raw string) (*marketSearchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cur marketSearchCursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, err
+	}
+	if cur.Size <= 0 || cur.Offsets == nil {
+		return nil, errors.New("incomplete cursor")
+	}
+	// 游标由客户端回传，不能信任其中的每页数量
+	cur.Size = min(cur.Size, marketSearchMaxPageSize)
+	return &cur, nil
+}
+
+// searchMCPMarketByCursor 游标分页搜索。空 cursor 表示第一页；非空 cursor 自带查询条件与每页数量，
+// 以保证后续页与第一页一致。next_cursor 为空表示没有更多结果。
+func searchMCPMarketByCursor(c *gin.Context, rawCursor string, query string, sources string, size int, groupBySource bool) {
+	ctx := c.Request.Context()
+	lang := c.GetString("lang")
+
+	// 第一页从各数据源的起点开始；已耗尽的数据源不会出现在后续游标的 Offsets 中
+	cur := &marketSearchCursor{Query: query, Sources: sources, Size: size, Offsets: map[string]int{}}
+	if strings.Contains(sources, "npm") {
+		cur.Offsets["npm"] = 0
+	}
+	if strings.Contains(sources, "pypi") {
+		cur.Offsets["pypi"] = 0
+	}
+	if rawCursor != "" {
+		decoded, err := decodeMarketSearchCursor(rawCursor)
+		if err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_market_cursor", lang), err)
+			return
+		}
+		cur = decoded
+	}
+
+	seen := make(map[string]bool, len(cur.Seen))
+	for _, name := range cur.Seen {
+		seen[name] = true
+	}
+	next := &marketSearchCursor{Query: cur.Query, Sources: cur.Sources, Size: cur.Size, Offsets: map[string]int{}}
+	hasMore := false
+	var sourceResults []market.SearchSourceResults
+
+	if offset, ok := cur.Offsets["npm"]; ok {
+		npmResult, err := searchNPMPackagesAt(ctx, cur.Query, cur.Size, offset)
+		if err != nil {
+			common.RespError(c, 500, "market_search_failed", err)
+			return
+		}
+		npmItems := []market.SearchPackageResult{}
+		for _, result := range market.ConvertNPMToSearchResult(npmResult, installedPackageIDs()) {
+			next.Seen = append(next.Seen, result.Name)
+			if !seen[result.Name] {
+				npmItems = append(npmItems, result)
+			}
+		}
+		sourceResults = append(sourceResults, market.SearchSourceResults{Source: "npm", Results: npmItems})
+		nextOffset := offset + len(npmResult.Objects)
+		if len(npmResult.Objects) > 0 && nextOffset < npmResult.Total {
+			next.Offsets["npm"] = nextOffset
+			hasMore = true
+		}
+	}
+	if offset, ok := cur.Offsets["pypi"]; ok {
+		// PyPI 的候选项目由搜索词确定，翻页时结果不会移动，无需按 Seen 去重
+		pypiResults, total, err := searchPyPIPackagesAt(ctx, cur.Query, cur.Size, offset, installedPackageIDs())
+		if err != nil {
+			common.RespError(c, 500, "market_search_failed", err)
+			return
+		}
+		sourceResults = append(sourceResults, market.SearchSourceResults{Source: "pypi", Results: pypiResults})
+		if nextOffset := offset + len(pypiResults); len(pypiResults) > 0 && nextOffset < total {
+			next.Offsets["pypi"] = nextOffset
+			hasMore = true
+		}
+	}
+
+	nextCursor := ""
+	if hasMore {
+		nextCursor = next.encode()
+	}
+	common.RespSuccess(c, gin.H{
+		"items":       market.MergeSearchResults(sourceResults, common.GetMarketSourcePriority(), groupBySource),
+		"next_cursor": nextCursor,
+	})
 }
 
 // ListInstalledMCPServices godoc
@@ -1339,6 +1745,9 @@ func SearchMCPMarket(c *gin.Context) {
 // @Tags Market
 // @Accept json
 // @Produce json
+// @Param enabled query bool false "仅返回启用的服务"
+// @Param tag query string false "按标签过滤, 逗号分隔或重复参数"
+// @Param tag_match query string false "标签匹配方式: any (默认) 或 all"
 // @Success 200 {object} common.APIResponse
 // @Failure 500 {object} common.APIResponse
 // @Router /api/mcp_market/installed [get]
@@ -1361,6 +1770,11 @@ func ListInstalledMCPServices(c *gin.Context) {
 		return
 	}
 
+	// 按标签过滤：?tag=a,b 或 ?tag=a&tag=b；tag_match=all 时需同时具备全部标签，默认任一即可
+	if tags := parseTagQuery(c); len(tags) > 0 {
+		services = model.FilterServicesByTags(services, tags, strings.EqualFold(c.Query("tag_match"), "all"))
+	}
+
 	userID := int64(0)
 	if uid, exists := c.Get("user_id"); exists {
 		userID, _ = uid.(int64)
@@ -1368,16 +1782,13 @@ func ListInstalledMCPServices(c *gin.Context) {
 
 	// 获取缓存管理器
 	cacheManager := proxy.GetHealthCacheManager()
+	// 安装者用户名，多个服务常由同一管理员安装
+	installerNames := make(map[int64]string)
 
 	var result []map[string]interface{}
 	for _, svc := range services {
-		// 1. 从 DefaultEnvsJSON 加载默认环境变量
-		finalEnvVars := make(map[string]string)
-		if svc.DefaultEnvsJSON != "" {
-			if err := json.Unmarshal([]byte(svc.DefaultEnvsJSON), &finalEnvVars); err != nil {
-				common.SysLog(fmt.Sprintf("Error unmarshaling DefaultEnvsJSON for service ID %d: %v", svc.ID, err))
-			}
-		}
+		// 1. 从 DefaultEnvsJSON 加载当前环境的默认环境变量
+		finalEnvVars := svc.ActiveDefaultEnvs()
 
 		// 2. 如果用户已登录，获取并合并 UserConfig
 		if userID != 0 {
@@ -1403,6 +1814,21 @@ func ListInstalledMCPServices(c *gin.Context) {
 		b, _ := json.Marshal(svc)
 		_ = json.Unmarshal(b, &svcMap)
 		svcMap["env_vars"] = finalEnvVars // 使用合并后的环境变量
+		// OAuth 配置含 client_secret：管理员看到脱敏后的配置，其他用户不返回
+		if c.GetInt("role") >= common.RoleAdminUser && svc.OAuthConfigJSON != "" {
+			svcMap["oauth_config_json"] = svc.MaskedOAuthConfigJSON()
+		} else {
+			delete(svcMap, "oauth_config_json")
+		}
+		if _, ok := installerNames[svc.InstalledByUserID]; !ok {
+			installerNames[svc.InstalledByUserID] = installerName(svc.InstalledByUserID)
+		}
+		svcMap["installed_by"] = installerNames[svc.InstalledByUserID]
+		if tags, err := svc.GetTags(); err == nil {
+			svcMap["tags"] = tags
+		} else {
+			svcMap["tags"] = []string{}
+		}
 
 		// tool_count 从健康缓存读取，默认为 0
 		svcMap["tool_count"] = 0
@@ -1411,7 +1837,7 @@ func ListInstalledMCPServices(c *gin.Context) {
 		if svc.RPDLimit > 0 && userID > 0 {
 			// 获取用户今日请求数
 			today := time.Now().Format("2006-01-02")
-			userCacheKey := fmt.Sprintf("user_request:%s:%d:%d:count", today, svc.ID, userID)
+			userCacheKey := model.RequestCounterKey(today, svc.ID, userID, svc.LimitTokenID(c.GetString("token_id")))
 
 			cacheClient := thing.Cache()
 			if cacheClient != nil {
@@ -1515,11 +1941,17 @@ func PatchEnvVar(c *gin.Context) {
 		ServiceID int64  `json:"service_id" binding:"required"`
 		VarName   string `json:"var_name" binding:"required"`
 		VarValue  string `json:"var_value" binding:"required"`
+		Profile   string `json:"profile"` // 普通用户可保存到命名 profile, 为空时为默认 profile
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
 		return
 	}
+	profile, ok := model.NormalizeEnvProfileName(req.Profile)
+	if !ok {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+		return
+	}
 
 	userID := getUserIDFromContext(c)
 	if userID == 0 {
@@ -1528,14 +1960,12 @@ func PatchEnvVar(c *gin.Context) {
 	}
 
 	// 检查用户权限
-	user, err := model.GetUserById(userID, false)
+	isAdmin, err := editsDefaultEnvs(userID)
 	if err != nil {
 		common.RespError(c, http.StatusInternalServerError, "Failed to get user info", err)
 		return
 	}
 
-	isAdmin := user.Role == common.RoleAdminUser
-
 	if isAdmin {
 		// 管理员：更新服务的默认环境变量配置
 		service, err := model.GetServiceByID(req.ServiceID)
@@ -1544,28 +1974,16 @@ func PatchEnvVar(c *gin.Context) {
 			return
 		}
 
-		// 解析现有的默认环境变量
-		var defaultEnvs map[string]string
-		if service.DefaultEnvsJSON != "" {
-			if err := json.Unmarshal([]byte(service.DefaultEnvsJSON), &defaultEnvs); err != nil {
-				log.Printf("[PatchEnvVar] Error unmarshaling existing DefaultEnvsJSON for service %d: %v", req.ServiceID, err)
-				defaultEnvs = make(map[string]string)
-			}
-		} else {
-			defaultEnvs = make(map[string]string)
+		if service.IsFileManaged() {
+			common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("service_managed_by_file", lang))
+			return
 		}
 
-		// 更新指定的环境变量
-		defaultEnvs[req.VarName] = req.VarValue
-
-		// 重新序列化并保存
-		defaultEnvsJSON, err := json.Marshal(defaultEnvs)
-		if err != nil {
-			common.RespError(c, http.StatusInternalServerError, "Failed to marshal default envs", err)
+		// 更新指定的环境变量；使用环境 profile 的服务写入当前环境的 profile，其他 profile 保持不变
+		if err := service.SetDefaultEnv(req.VarName, req.VarValue); err != nil {
+			common.RespError(c, http.StatusBadRequest, "Failed to update default envs", err)
 			return
 		}
-
-		service.DefaultEnvsJSON = string(defaultEnvsJSON)
 		if err := model.UpdateService(service); err != nil {
 			common.RespError(c, http.StatusInternalServerError, "Failed to update service", err)
 			return
@@ -1576,46 +1994,25 @@ func PatchEnvVar(c *gin.Context) {
 
 	} else {
 		// 普通用户：保存为个人配置
+		service, err := model.GetServiceByID(req.ServiceID)
+		if err != nil {
+			common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+			return
+		}
 		// 查找或创建变量定义
-		configOpt, err := model.GetConfigOptionByKey(req.ServiceID, req.VarName)
+		configOpt, _, err := ensureEnvConfigOption(service, req.VarName)
 		if err != nil {
-			if err.Error() == model.ErrRecordNotFound.Error() || err.Error() == "config_service_not_found" || strings.Contains(err.Error(), "not found") {
-				// 如果ConfigService不存在，创建一个
-				service, serviceErr := model.GetServiceByID(req.ServiceID)
-				if serviceErr != nil {
-					common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), serviceErr)
-					return
-				}
-
-				newConfigOption := model.ConfigService{
-					ServiceID:   req.ServiceID,
-					Key:         req.VarName,
-					DisplayName: req.VarName,
-					Description: fmt.Sprintf("Environment variable %s for %s", req.VarName, service.DisplayName),
-					Type:        model.ConfigTypeString,
-					Required:    true,
-				}
-				if strings.Contains(strings.ToLower(req.VarName), "token") || strings.Contains(strings.ToLower(req.VarName), "key") || strings.Contains(strings.ToLower(req.VarName), "secret") {
-					newConfigOption.Type = model.ConfigTypeSecret
-				}
-				if errCreate := model.CreateConfigOption(&newConfigOption); errCreate != nil {
-					log.Printf("Failed to create ConfigService for key %s, serviceID %d: %v", req.VarName, req.ServiceID, errCreate)
-					common.RespError(c, http.StatusInternalServerError, "Failed to create config option", errCreate)
-					return
-				}
-				configOpt = &newConfigOption
-			} else {
-				common.RespError(c, http.StatusInternalServerError, "Failed to get config option", err)
-				return
-			}
+			common.RespError(c, http.StatusInternalServerError, "Failed to get config option", err)
+			return
 		}
 
 		// 保存用户配置
 		userConfig := &model.UserConfig{
-			UserID:    userID,
-			ServiceID: req.ServiceID,
-			ConfigID:  configOpt.ID,
-			Value:     req.VarValue,
+			UserID:      userID,
+			ServiceID:   req.ServiceID,
+			ConfigID:    configOpt.ID,
+			Value:       req.VarValue,
+			ProfileName: profile,
 		}
 		if err := model.SaveUserConfig(userConfig); err != nil {
 			common.RespError(c, http.StatusInternalServerError, i18n.Translate("save_user_config_failed", lang), err)
@@ -1627,6 +2024,221 @@ func PatchEnvVar(c *gin.Context) {
 	}
 }
 
+// editsDefaultEnvs reports whether env var edits of the user change the services' default envs (admins) rather
+// than the user's personal config
+func editsDefaultEnvs(userID int64) (bool, error) {
+	user, err := model.GetUserById(userID, false)
+	if err != nil {
+		return false, err
+	}
+	return user.Role == common.RoleAdminUser, nil
+}
+
+// ensureEnvConfigOption returns the per-user config option for an env var of the service, creating it if missing;
+// created reports whether the option was created by this call
+func ensureEnvConfigOption(service *model.MCPService, varName string) (option *model.ConfigService, created bool, err error) {
+	configOpt, err := model.GetConfigOptionByKey(service.ID, varName)
+	if err == nil {
+		return configOpt, false, nil
+	}
+	if err.Error() != model.ErrRecordNotFound.Error() && err.Error() != "config_service_not_found" && !strings.Contains(err.Error(), "not found") {
+		return nil, false, err
+	}
+	newConfigOption := model.ConfigService{
+		ServiceID:   service.ID,
+		Key:         varName,
+		DisplayName: varName,
+		Description: fmt.Sprintf("Environment variable %s for %s", varName, service.DisplayName),
+		Type:        model.ConfigTypeString,
+		Required:    true,
+	}
+	if strings.Contains(strings.ToLower(varName), "token") || strings.Contains(strings.ToLower(varName), "key") || strings.Contains(strings.ToLower(varName), "secret") {
+		newConfigOption.Type = model.ConfigTypeSecret
+	}
+	if err := model.CreateConfigOption(&newConfigOption); err != nil {
+		log.Printf("Failed to create ConfigService for key %s, serviceID %d: %v", varName, service.ID, err)
+		return nil, false, err
+	}
+	return &newConfigOption, true, nil
+}
+
+// restartUserServiceInstances stops a user's running instances of a service so they pick up new env values
+var restartUserServiceInstances = proxy.RestartUserServiceInstances
+
+// BulkPatchEnvVar godoc
+// @Summary 批量保存共享的环境变量
+// @Description 在多个服务上设置同一个环境变量（如共用的 API Key），与单个保存一致：管理员更新服务默认配置，普通用户保存为个人配置并重启其受影响的运行中实例。只更新定义了该变量的服务（指定 service_ids 时其余服务列在 skipped 中，文件管理的服务不更新默认配置）；任一保存失败则全部回滚
+// @Tags Market
+// @Accept json
+// @Produce json
+// @Param body body map[string]interface{} true "请求体"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/user/env_vars/bulk [patch]
+func BulkPatchEnvVar(c *gin.Context) {
+	lang := c.GetString("lang")
+	var req struct {
+		VarName    string  `json:"var_name" binding:"required"`
+		VarValue   string  `json:"var_value" binding:"required"`
+		ServiceIDs []int64 `json:"service_ids"` // 为空时更新所有定义了该变量的服务
+		Profile    string  `json:"profile"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	profile, ok := model.NormalizeEnvProfileName(req.Profile)
+	if !ok {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return
+	}
+
+	isAdmin, err := editsDefaultEnvs(userID)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, "Failed to get user info", err)
+		return
+	}
+
+	var candidates []*model.MCPService
+	if len(req.ServiceIDs) > 0 {
+		for _, id := range req.ServiceIDs {
+			service, err := model.GetServiceByID(id)
+			if err != nil {
+				common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+				return
+			}
+			candidates = append(candidates, service)
+		}
+	} else {
+		all, err := model.GetAllServices()
+		if err != nil {
+			common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_service_list_failed", lang), err)
+			return
+		}
+		candidates = all
+	}
+	var services []*model.MCPService
+	skipped := make([]gin.H, 0)
+	for _, service := range candidates {
+		// Services without the var are only listed when they were requested explicitly
+		reason := ""
+		switch {
+		case !service.DefinesEnvVar(req.VarName):
+			if len(req.ServiceIDs) == 0 {
+				continue
+			}
+			reason = "env var not defined by the service"
+		case isAdmin && service.IsFileManaged():
+			reason = i18n.Translate("service_managed_by_file", lang)
+		default:
+			services = append(services, service)
+			continue
+		}
+		skipped = append(skipped, gin.H{"service_id": service.ID, "service_name": service.Name, "reason": reason})
+	}
+	if len(services) == 0 {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("no_services_define_env_var", lang))
+		return
+	}
+
+	if isAdmin {
+		if err := bulkSetDefaultEnv(services, req.VarName, req.VarValue); err != nil {
+			common.RespError(c, http.StatusInternalServerError, "Failed to update service", err)
+			return
+		}
+	} else if err := bulkSaveUserEnv(services, userID, profile, req.VarName, req.VarValue); err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("save_user_config_failed", lang), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	updated := make([]gin.H, 0, len(services))
+	for _, service := range services {
+		restarted := 0
+		if !isAdmin {
+			restarted = restartUserServiceInstances(ctx, userID, service.ID)
+		}
+		updated = append(updated, gin.H{
+			"service_id":          service.ID,
+			"service_name":        service.Name,
+			"restarted_instances": restarted,
+		})
+	}
+	log.Printf("[BulkPatchEnvVar] User %d (admin: %t) saved env %s for %d services", userID, isAdmin, req.VarName, len(services))
+	common.RespSuccess(c, gin.H{"var_name": req.VarName, "updated": updated, "skipped": skipped})
+}
+
+// bulkSetDefaultEnv sets a default env var on every service, restoring the services already saved when one fails
+func bulkSetDefaultEnv(services []*model.MCPService, varName, varValue string) error {
+	previous := make([]string, 0, len(services))
+	rollback := func() {
+		for i := len(previous) - 1; i >= 0; i-- {
+			services[i].DefaultEnvsJSON = previous[i]
+			if err := model.UpdateService(services[i]); err != nil {
+				common.SysError(fmt.Sprintf("Failed to roll back default envs of service %d: %v", services[i].ID, err))
+			}
+		}
+	}
+	for _, service := range services {
+		before := service.DefaultEnvsJSON
+		if err := service.SetDefaultEnv(varName, varValue); err != nil {
+			rollback()
+			return fmt.Errorf("service %s: %w", service.Name, err)
+		}
+		if err := model.UpdateService(service); err != nil {
+			service.DefaultEnvsJSON = before
+			rollback()
+			return fmt.Errorf("service %s: %w", service.Name, err)
+		}
+		previous = append(previous, before)
+	}
+	return nil
+}
+
+// bulkSaveUserEnv saves a personal env var of the user on every service. Config options created for it are
+// removed again when saving fails, so a failed request leaves nothing behind.
+func bulkSaveUserEnv(services []*model.MCPService, userID int64, profile, varName, varValue string) error {
+	var createdOptions []*model.ConfigService
+	rollback := func() {
+		for _, option := range createdOptions {
+			if err := model.DeleteConfigOption(option.ID); err != nil {
+				common.SysError(fmt.Sprintf("Failed to roll back config option %s of service %d: %v", option.Key, option.ServiceID, err))
+			}
+		}
+	}
+	configs := make([]*model.UserConfig, 0, len(services))
+	for _, service := range services {
+		configOpt, created, err := ensureEnvConfigOption(service, varName)
+		if err != nil {
+			rollback()
+			return err
+		}
+		if created {
+			createdOptions = append(createdOptions, configOpt)
+		}
+		configs = append(configs, &model.UserConfig{
+			UserID:      userID,
+			ServiceID:   service.ID,
+			ConfigID:    configOpt.ID,
+			Value:       varValue,
+			ProfileName: profile,
+		})
+	}
+	if err := model.SaveUserConfigs(configs); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
 // CreateCustomService godoc
 // @Summary 创建自定义服务
 // @Description 创建一个自定义的MCP服务（支持stdio、sse、streamableHttp类型）
@@ -1650,6 +2262,7 @@ func CreateCustomService(c *gin.Context) {
 		Environments string `json:"environments"`
 		URL          string `json:"url"`
 		Headers      string `json:"headers"`
+		WorkingDir   string `json:"working_dir"` // stdio only
 	}
 
 	var requestBody CustomServiceRequest
@@ -1664,6 +2277,9 @@ func CreateCustomService(c *gin.Context) {
 		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("service_name_cannot_be_empty", lang))
 		return
 	}
+	if rejectDisallowedInstallCategory(c, lang, model.CategoryUtil) {
+		return
+	}
 
 	// 检查服务名称唯一性
 	existingService, err := model.GetServiceByName(sanitizedName)
@@ -1699,12 +2315,22 @@ func CreateCustomService(c *gin.Context) {
 		ClientConfigTemplates: "{}",
 		Enabled:               true, // 自定义服务默认启用
 		HealthStatus:          "unknown",
+		InstalledByUserID:     c.GetInt64("user_id"),
 	}
 
 	// 处理不同类型的配置
 	if requestBody.Type == "stdio" {
 		newService.Command = requestBody.Command
 
+		if requestBody.WorkingDir != "" {
+			workDir, err := common.ValidateWorkingDir(requestBody.WorkingDir)
+			if err != nil {
+				common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_working_dir", lang), err)
+				return
+			}
+			newService.WorkingDir = workDir
+		}
+
 		// 处理参数
 		if requestBody.Arguments != "" {
 			args := strings.Split(strings.ReplaceAll(requestBody.Arguments, "\r\n", "\n"), "\n")
@@ -1779,6 +2405,7 @@ func CreateCustomService(c *gin.Context) {
 		common.RespError(c, http.StatusInternalServerError, i18n.Translate("create_mcp_service_failed", lang), err)
 		return
 	}
+	logServiceInstaller(c.Request.Context(), &newService)
 
 	// 自动注册服务到 ServiceManager 以启用健康检查
 	serviceManager := proxy.GetServiceManager()
@@ -1917,6 +2544,91 @@ func processBatchImport(task *BatchImportTask) {
 	}
 }
 
+// ImportClientConfig godoc
+// @Summary 导入 claude_desktop_config.json
+// @Description 按 {"mcpServers": {...}} 格式批量创建服务：command/args/env 创建 stdio 服务，url 创建远程服务；同名服务跳过，逐项返回结果
+// @Tags Market
+// @Accept json
+// @Produce json
+// @Param body body market.MCPConfig true "claude_desktop_config.json 内容"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Router /api/mcp_market/import_config [post]
+func ImportClientConfig(c *gin.Context) {
+	lang := c.GetString("lang")
+	var config market.MCPConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	if len(config.MCPServers) == 0 {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("no_services_to_import", lang))
+		return
+	}
+
+	names := make([]string, 0, len(config.MCPServers))
+	for name := range config.MCPServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	summary := BatchImportSummary{}
+	results := make([]ProgressUpdate, 0, len(names))
+	for _, name := range names {
+		err := createSingleServiceFromBatch(c.Request.Context(), name, mcpServerConfigToMap(config.MCPServers[name]))
+		switch {
+		case err == nil:
+			summary.Success++
+			results = append(results, ProgressUpdate{Name: name, Status: "success", Message: "Service imported successfully."})
+		case errors.Is(err, ErrServiceExists):
+			summary.Skipped++
+			results = append(results, ProgressUpdate{Name: name, Status: "skipped", Message: "Service already exists"})
+		default:
+			summary.Failed++
+			results = append(results, ProgressUpdate{Name: name, Status: "failed", Message: err.Error()})
+		}
+	}
+
+	common.RespSuccess(c, gin.H{
+		"results": results,
+		"summary": summary,
+	})
+}
+
+// mcpServerConfigToMap converts a client config entry into the generic map consumed by createSingleServiceFromBatch
+func mcpServerConfigToMap(cfg market.MCPServerConfig) map[string]interface{} {
+	data := map[string]interface{}{}
+	if cfg.Command != "" {
+		data["command"] = cfg.Command
+	}
+	if cfg.URL != "" {
+		data["url"] = cfg.URL
+	}
+	if len(cfg.Args) > 0 {
+		args := make([]interface{}, len(cfg.Args))
+		for i, arg := range cfg.Args {
+			args[i] = arg
+		}
+		data["args"] = args
+	}
+	if len(cfg.Env) > 0 {
+		env := make(map[string]interface{}, len(cfg.Env))
+		for k, v := range cfg.Env {
+			env[k] = v
+		}
+		data["env"] = env
+	}
+	if len(cfg.Headers) > 0 {
+		headers := make(map[string]interface{}, len(cfg.Headers))
+		for k, v := range cfg.Headers {
+			headers[k] = v
+		}
+		data["headers"] = headers
+	}
+	return data
+}
+
 // createSingleServiceFromBatch handles the creation of a single service.
 // It manages its own transaction.
 // Returns: nil for success, ErrServiceExists for skip, other errors for failure
@@ -2103,7 +2815,7 @@ func createSingleServiceFromBatch(ctx context.Context, serviceName string, servi
 			ArgsJSON:              string(argsJSON),
 			DefaultEnvsJSON:       string(envsJSON),
 			Enabled:               true,
-			InstallerUserID:       0, // System user for batch import
+			InstalledByUserID:     0, // System user for batch import
 			PackageManager:        packageManager,
 			SourcePackageName:     sourcePackageName,
 		}
@@ -2135,7 +2847,7 @@ func createSingleServiceFromBatch(ctx context.Context, serviceName string, servi
 			HeadersJSON:           string(headersJSON),
 			DefaultEnvsJSON:       string(envsJSON),
 			Enabled:               true,
-			InstallerUserID:       0, // System user for batch import
+			InstalledByUserID:     0, // System user for batch import
 			PackageManager:        packageManager,
 			SourcePackageName:     sourcePackageName,
 		}
@@ -2158,13 +2870,11 @@ func createSingleServiceFromBatch(ctx context.Context, serviceName string, servi
 
 	// For stdio services, submit installation task asynchronously for batch import
 	if mcpService.Type == model.ServiceTypeStdio && mcpService.PackageManager != "custom" {
-		// Parse ArgsJSON to get command arguments
-		var args []string
-		if mcpService.ArgsJSON != "" {
-			if err := json.Unmarshal([]byte(mcpService.ArgsJSON), &args); err != nil {
-				common.SysLog(fmt.Sprintf("WARNING: Failed to parse ArgsJSON for service %s: %v", sanitizedName, err))
-				args = []string{} // Use empty args on parse error
-			}
+		// Build the command arguments the service runs with (ArgsJSON + RuntimeArgsJSON)
+		args, err := mcpService.CommandArgs()
+		if err != nil {
+			common.SysLog(fmt.Sprintf("WARNING: Failed to build args for service %s: %v", sanitizedName, err))
+			args = []string{} // Use empty args on parse error
 		}
 
 		installationTask := market.InstallationTask{
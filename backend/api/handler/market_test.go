@@ -2,11 +2,20 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/market"
 	"one-mcp/backend/model"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -340,3 +349,967 @@ func TestResolveUVSourceSpec(t *testing.T) {
 		})
 	}
 }
+
+func TestImportClientConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	// 已存在的同名服务应被跳过
+	assert.NoError(t, model.CreateService(&model.MCPService{Name: "existing", DisplayName: "Existing", Type: model.ServiceTypeStdio, Command: "node"}))
+
+	body := map[string]any{
+		"mcpServers": map[string]any{
+			"local-files": map[string]any{"command": "node", "args": []string{"/opt/server.js", "--root", "/data"}, "env": map[string]string{"LOG_LEVEL": "debug"}},
+			"remote-sse":  map[string]any{"url": "https://example.com/mcp/sse", "headers": map[string]string{"Authorization": "Bearer x"}},
+			"remote-http": map[string]any{"url": "https://example.com/mcp"},
+			"existing":    map[string]any{"command": "node"},
+			"broken":      map[string]any{},
+		},
+	}
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = newJSONRequest(t, http.MethodPost, "/api/mcp_market/import_config", body)
+	ImportClientConfig(ctx)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	resp := decodeAPIResponse(t, recorder)
+	var data struct {
+		Results []ProgressUpdate   `json:"results"`
+		Summary BatchImportSummary `json:"summary"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Data, &data))
+	assert.Equal(t, BatchImportSummary{Success: 3, Skipped: 1, Failed: 1}, data.Summary)
+	statuses := map[string]string{}
+	for _, result := range data.Results {
+		statuses[result.Name] = result.Status
+	}
+	assert.Equal(t, map[string]string{"broken": "failed", "existing": "skipped", "local-files": "success", "remote-http": "success", "remote-sse": "success"}, statuses)
+
+	tests := []struct {
+		name        string
+		wantType    model.ServiceType
+		wantCommand string
+		wantArgs    string
+		wantEnvs    string
+		wantHeaders string
+	}{
+		{"local-files", model.ServiceTypeStdio, "node", `["/opt/server.js","--root","/data"]`, `{"LOG_LEVEL":"debug"}`, ""},
+		{"remote-sse", model.ServiceTypeSSE, "https://example.com/mcp/sse", "", "", `{"Authorization":"Bearer x"}`},
+		{"remote-http", model.ServiceTypeStreamableHTTP, "https://example.com/mcp", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := model.GetServiceByName(tt.name)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantType, svc.Type)
+			assert.Equal(t, tt.wantCommand, svc.Command)
+			if tt.wantArgs != "" {
+				assert.Equal(t, tt.wantArgs, svc.ArgsJSON)
+			}
+			if tt.wantEnvs != "" {
+				assert.JSONEq(t, tt.wantEnvs, svc.DefaultEnvsJSON)
+			}
+			if tt.wantHeaders != "" {
+				assert.JSONEq(t, tt.wantHeaders, svc.HeadersJSON)
+			}
+		})
+	}
+}
+
+func TestListInstalledMCPServicesTagFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	// 标签相互重叠，用于区分 AND/OR 语义
+	fixtures := map[string][]string{
+		"svc-web":     {"search", "web"},
+		"svc-web-int": {"Search", "web", "internal"},
+		"svc-int":     {"internal"},
+		"svc-none":    nil,
+	}
+	for name, tags := range fixtures {
+		svc := &model.MCPService{Name: name, DisplayName: name, Type: model.ServiceTypeStdio, Command: "node"}
+		assert.NoError(t, svc.SetTags(tags))
+		assert.NoError(t, model.CreateService(svc))
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"no filter", "", []string{"svc-int", "svc-none", "svc-web", "svc-web-int"}},
+		{"single tag is case-insensitive", "?tag=SEARCH", []string{"svc-web", "svc-web-int"}},
+		{"comma separated defaults to any", "?tag=web,internal", []string{"svc-int", "svc-web", "svc-web-int"}},
+		{"repeated params with all", "?tag=web&tag=internal&tag_match=all", []string{"svc-web-int"}},
+		{"all with no match", "?tag=search,internal,missing&tag_match=all", []string{}},
+		{"any with unknown tag", "?tag=missing", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/api/mcp_market/installed"+tt.query, nil)
+			ListInstalledMCPServices(ctx)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			resp := decodeAPIResponse(t, recorder)
+			var services []map[string]any
+			assert.NoError(t, json.Unmarshal(resp.Data, &services))
+			names := []string{}
+			for _, svc := range services {
+				names = append(names, svc["name"].(string))
+			}
+			sort.Strings(names)
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestUpdateMCPServiceNormalizesTags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	svc := &model.MCPService{Name: "tagged", DisplayName: "Tagged", Type: model.ServiceTypeStdio, Command: "node"}
+	assert.NoError(t, model.CreateService(svc))
+
+	tests := []struct {
+		name     string
+		tagsJSON string
+		wantCode int
+		wantTags []string
+	}{
+		{"normalized and deduplicated", `[" Search ","search","Web",""]`, http.StatusOK, []string{"search", "web"}},
+		{"cleared", `[]`, http.StatusOK, []string{}},
+		{"not an array", `"search"`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(svc.ID, 10)}}
+			ctx.Request = newJSONRequest(t, http.MethodPut, "/api/mcp_services/1", map[string]any{
+				"name": "tagged", "display_name": "Tagged", "Type": string(model.ServiceTypeStdio), "command": "node", "tags_json": tt.tagsJSON,
+			})
+			UpdateMCPService(ctx)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			if tt.wantTags == nil {
+				return
+			}
+			updated, err := model.GetServiceByID(svc.ID)
+			assert.NoError(t, err)
+			tags, err := updated.GetTags()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTags, tags)
+		})
+	}
+}
+
+func TestSearchMCPMarketCursorPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	packages := []string{}
+	for i := 0; i < 7; i++ {
+		packages = append(packages, "pkg-"+strconv.Itoa(i))
+	}
+	original := searchNPMPackagesAt
+	searchNPMPackagesAt = func(ctx context.Context, query string, limit int, offset int) (*market.NPMSearchResult, error) {
+		objects := []map[string]any{}
+		for i := offset; i < len(packages) && i < offset+limit; i++ {
+			objects = append(objects, map[string]any{"package": map[string]any{"name": packages[i]}})
+		}
+		data, _ := json.Marshal(map[string]any{"objects": objects, "total": len(packages)})
+		var result market.NPMSearchResult
+		err := json.Unmarshal(data, &result)
+		return &result, err
+	}
+	defer func() { searchNPMPackagesAt = original }()
+
+	search := func(query string) (int, []string, string) {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/api/mcp_market/search"+query, nil)
+		SearchMCPMarket(ctx)
+		if recorder.Code != http.StatusOK {
+			return recorder.Code, nil, ""
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextCursor string `json:"next_cursor"`
+		}
+		assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &page))
+		names := []string{}
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+		return recorder.Code, names, page.NextCursor
+	}
+
+	_, first, cursor := search("?query=fs&size=3&cursor=")
+	assert.Equal(t, []string{"pkg-0", "pkg-1", "pkg-2"}, first)
+	assert.NotEmpty(t, cursor)
+
+	// 两个新包插到结果最前面，原有结果整体后移；继续翻页不应重复返回上一页的包
+	packages = append([]string{"new-a", "new-b"}, packages...)
+	_, second, cursor := search("?cursor=" + url.QueryEscape(cursor))
+	assert.Equal(t, []string{"pkg-3"}, second)
+	assert.NotEmpty(t, cursor)
+
+	_, third, cursor := search("?cursor=" + url.QueryEscape(cursor))
+	assert.Equal(t, []string{"pkg-4", "pkg-5", "pkg-6"}, third)
+	assert.Empty(t, cursor)
+
+	seen := map[string]bool{}
+	for _, name := range append(append(first, second...), third...) {
+		assert.False(t, seen[name], "duplicate %s", name)
+		seen[name] = true
+	}
+
+	code, _, _ := search("?cursor=not-a-cursor")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// 未传 cursor 时保持 page/size 分页并返回数组
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/api/mcp_market/search?query=fs&size=3&page=2", nil)
+	SearchMCPMarket(ctx)
+	var legacy []map[string]any
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &legacy))
+	if assert.Len(t, legacy, 3) {
+		assert.Equal(t, "pkg-1", legacy[0]["name"])
+	}
+
+	// 客户端伪造的游标中每页数量被限制在上限内
+	var requestedLimit int
+	searchNPMPackagesAt = func(ctx context.Context, query string, limit int, offset int) (*market.NPMSearchResult, error) {
+		requestedLimit = limit
+		return &market.NPMSearchResult{}, nil
+	}
+	forged := (&marketSearchCursor{Query: "fs", Sources: "npm", Size: 100000, Offsets: map[string]int{"npm": 0}}).encode()
+	code, _, _ = search("?cursor=" + url.QueryEscape(forged))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, marketSearchMaxPageSize, requestedLimit)
+}
+
+func TestSearchMCPMarketMergesPyPIResults(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	originalNPM, originalPyPI := searchNPMPackagesAt, searchPyPIPackagesAt
+	defer func() { searchNPMPackagesAt, searchPyPIPackagesAt = originalNPM, originalPyPI }()
+	searchNPMPackagesAt = func(ctx context.Context, query string, limit int, offset int) (*market.NPMSearchResult, error) {
+		data, _ := json.Marshal(map[string]any{"total": 2, "objects": []map[string]any{
+			{"package": map[string]any{"name": "npm-a"}, "score": map[string]any{"final": 0.9}},
+			{"package": map[string]any{"name": "npm-b"}, "score": map[string]any{"final": 0.3}},
+		}})
+		var result market.NPMSearchResult
+		err := json.Unmarshal(data, &result)
+		return &result, err
+	}
+	var pypiQuery string
+	searchPyPIPackagesAt = func(ctx context.Context, query string, limit int, offset int, installed map[string]int64) ([]market.SearchPackageResult, int, error) {
+		pypiQuery = query
+		results := []market.SearchPackageResult{{Name: "pypi-a", Score: 1}, {Name: "pypi-b", Score: 0.5}}
+		if offset >= len(results) {
+			return []market.SearchPackageResult{}, len(results), nil
+		}
+		return results[offset:min(offset+limit, len(results))], len(results), nil
+	}
+
+	search := func(query string, cursor bool) []string {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/api/mcp_market/search"+query, nil)
+		SearchMCPMarket(ctx)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var items []struct {
+			Name string `json:"name"`
+		}
+		data := decodeAPIResponse(t, recorder).Data
+		if cursor {
+			var page struct {
+				Items json.RawMessage `json:"items"`
+			}
+			assert.NoError(t, json.Unmarshal(data, &page))
+			data = page.Items
+		}
+		assert.NoError(t, json.Unmarshal(data, &items))
+		names := []string{}
+		for _, item := range items {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"pypi-a", "npm-a", "pypi-b", "npm-b"}, search("?query=fetch&sources=npm,pypi", false))
+	assert.Equal(t, "fetch mcp", pypiQuery)
+	assert.Equal(t, []string{"npm-a", "npm-b", "pypi-a", "pypi-b"}, search("?query=fetch&sources=npm,pypi&group_by_source=true", false))
+	assert.Equal(t, []string{"pypi-a", "npm-a", "pypi-b", "npm-b"}, search("?query=fetch&sources=npm,pypi&cursor=", true))
+	// 未指定 sources 时仍只搜索 npm
+	assert.Equal(t, []string{"npm-a", "npm-b"}, search("?query=fetch", false))
+}
+
+func TestSearchMCPMarketDefersStarsToEnrich(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	originalSearch, originalEnrich := searchNPMPackagesAt, enrichNPMPackage
+	defer func() { searchNPMPackagesAt, enrichNPMPackage = originalSearch, originalEnrich }()
+	searchNPMPackagesAt = func(ctx context.Context, query string, limit int, offset int) (*market.NPMSearchResult, error) {
+		data, _ := json.Marshal(map[string]any{"total": 1, "objects": []map[string]any{{"package": map[string]any{
+			"name":  "server-fs",
+			"links": map[string]any{"repository": "https://github.com/acme/server-fs"},
+		}}}})
+		var result market.NPMSearchResult
+		err := json.Unmarshal(data, &result)
+		return &result, err
+	}
+	enriched := []string{}
+	enrichNPMPackage = func(ctx context.Context, packageName string) (*market.PackageEnrichment, error) {
+		enriched = append(enriched, packageName)
+		if packageName == "missing-pkg" {
+			return nil, errors.New("not found")
+		}
+		return &market.PackageEnrichment{Name: packageName, RepositoryURL: "https://github.com/acme/server-fs", Stars: 4321}, nil
+	}
+
+	get := func(target string, handle gin.HandlerFunc) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodGet, target, nil)
+		handle(ctx)
+		return recorder
+	}
+
+	recorder := get("/api/mcp_market/search?query=fs", SearchMCPMarket)
+	var results []map[string]any
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &results))
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "https://github.com/acme/server-fs", results[0]["repository_url"])
+		assert.NotContains(t, results[0], "github_stars")
+	}
+	assert.Empty(t, enriched, "search must not fetch stars")
+
+	recorder = get("/api/mcp_market/enrich?name=server-fs", EnrichMCPMarketPackage)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var enrichment map[string]any
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &enrichment))
+	assert.Equal(t, float64(4321), enrichment["github_stars"])
+	assert.Equal(t, []string{"server-fs"}, enriched)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/mcp_market/enrich", EnrichMCPMarketPackage).Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/mcp_market/enrich?name=requests&package_manager=pypi", EnrichMCPMarketPackage).Code)
+	assert.Equal(t, http.StatusBadGateway, get("/api/mcp_market/enrich?name=missing-pkg", EnrichMCPMarketPackage).Code)
+}
+
+// 预置服务的添加路径不做必填环境变量检查，缺失的值由用户之后在配置中补齐
+func TestInstallOrAddServicePredefinedSkipsEnvVarCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	svc := &model.MCPService{Name: "modal", DisplayName: "Modal", Type: model.ServiceTypeStdio, Command: "npx", Enabled: true}
+	assert.NoError(t, svc.SetRequiredEnvVars([]model.EnvVarDefinition{
+		{Name: "MODE", Optional: true},
+		{Name: "API_KEY", RequiredIf: &model.EnvVarCondition{Name: "MODE", Value: "cloud"}},
+	}))
+	assert.NoError(t, model.CreateService(svc))
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Set("user_id", int64(1))
+	ctx.Request = newJSONRequest(t, http.MethodPost, "/api/mcp_market/install_or_add_service", map[string]any{
+		"source_type":            "predefined",
+		"mcp_service_id":         svc.ID,
+		"user_provided_env_vars": map[string]any{"MODE": "cloud"},
+	})
+	InstallOrAddService(ctx)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	resp := decodeAPIResponse(t, recorder)
+	assert.True(t, resp.Success, resp.Message)
+}
+
+func TestInstallOrAddServiceCategoryAllowlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	common.OptionMapRWMutex.Lock()
+	original := common.OptionMap[common.OptionInstallCategoryAllowlist]
+	common.OptionMapRWMutex.Unlock()
+	defer model.UpdateOptionMap(common.OptionInstallCategoryAllowlist, original)
+	model.UpdateOptionMap(common.OptionInstallCategoryAllowlist, "admin=search, fetch")
+
+	storageSvc := &model.MCPService{Name: "allowlist-storage", DisplayName: "Storage", Type: model.ServiceTypeStdio, Command: "npx", Category: model.CategoryStorage, Enabled: true}
+	searchSvc := &model.MCPService{Name: "allowlist-search", DisplayName: "Search", Type: model.ServiceTypeStdio, Command: "npx", Category: model.CategorySearch, Enabled: true}
+	assert.NoError(t, model.CreateService(storageSvc))
+	assert.NoError(t, model.CreateService(searchSvc))
+
+	tests := []struct {
+		name        string
+		role        int
+		serviceID   int64
+		wantBlocked bool
+	}{
+		{"admin blocked from storage", common.RoleAdminUser, storageSvc.ID, true},
+		{"admin allowed search", common.RoleAdminUser, searchSvc.ID, false},
+		{"root is not restricted", common.RoleRootUser, storageSvc.ID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Set("user_id", int64(9521))
+			ctx.Set("role", tt.role)
+			ctx.Request = newJSONRequest(t, http.MethodPost, "/api/mcp_market/install_or_add_service", map[string]any{
+				"source_type":    "predefined",
+				"mcp_service_id": tt.serviceID,
+			})
+			InstallOrAddService(ctx)
+
+			resp := decodeAPIResponse(t, recorder)
+			if tt.wantBlocked {
+				assert.Equal(t, http.StatusForbidden, recorder.Code)
+				assert.False(t, resp.Success)
+				assert.Contains(t, resp.Message, string(model.CategoryStorage))
+				return
+			}
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.True(t, resp.Success, resp.Message)
+		})
+	}
+}
+
+func TestBulkPatchEnvVar(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	user := &model.User{Username: "bulk-env-user", DisplayName: "bulk-env-user", Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, user.Insert())
+	userID := user.ID
+	withDefault := &model.MCPService{Name: "bulk-defaults", DisplayName: "Defaults", Type: model.ServiceTypeStdio, Command: "node", DefaultEnvsJSON: `{"SHARED_API_KEY":"old"}`}
+	withRequired := &model.MCPService{Name: "bulk-required", DisplayName: "Required", Type: model.ServiceTypeStdio, Command: "node"}
+	assert.NoError(t, withRequired.SetRequiredEnvVars([]model.EnvVarDefinition{{Name: "SHARED_API_KEY"}}))
+	withOption := &model.MCPService{Name: "bulk-option", DisplayName: "Option", Type: model.ServiceTypeStdio, Command: "node"}
+	unrelated := &model.MCPService{Name: "bulk-unrelated", DisplayName: "Unrelated", Type: model.ServiceTypeStdio, Command: "node", DefaultEnvsJSON: `{"OTHER":"x"}`}
+	for _, svc := range []*model.MCPService{withDefault, withRequired, withOption, unrelated} {
+		assert.NoError(t, model.CreateService(svc))
+	}
+	assert.NoError(t, model.CreateConfigOption(&model.ConfigService{ServiceID: withOption.ID, Key: "SHARED_API_KEY", DisplayName: "SHARED_API_KEY", Type: model.ConfigTypeSecret}))
+
+	var restarted []int64
+	originalRestart := restartUserServiceInstances
+	restartUserServiceInstances = func(ctx context.Context, uid, serviceID int64) int {
+		assert.Equal(t, userID, uid)
+		restarted = append(restarted, serviceID)
+		return 1
+	}
+	defer func() { restartUserServiceInstances = originalRestart }()
+
+	body, _ := json.Marshal(map[string]any{"var_name": "SHARED_API_KEY", "var_value": "new-shared-key"})
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPatch, "/api/user/env_vars/bulk", bytes.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	ctx.Set("user_id", userID)
+	BulkPatchEnvVar(ctx)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var data struct {
+		Updated []struct {
+			ServiceID          int64 `json:"service_id"`
+			RestartedInstances int   `json:"restarted_instances"`
+		} `json:"updated"`
+	}
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &data))
+	want := []int64{withDefault.ID, withRequired.ID, withOption.ID}
+	var updated []int64
+	for _, entry := range data.Updated {
+		updated = append(updated, entry.ServiceID)
+		assert.Equal(t, 1, entry.RestartedInstances)
+	}
+	assert.ElementsMatch(t, want, updated)
+	assert.ElementsMatch(t, want, restarted)
+
+	for _, serviceID := range want {
+		envs, err := model.GetUserSpecificEnvs(userID, serviceID)
+		assert.NoError(t, err)
+		assert.Equal(t, "new-shared-key", envs["SHARED_API_KEY"], "service %d", serviceID)
+	}
+	envs, err := model.GetUserSpecificEnvs(userID, unrelated.ID)
+	assert.NoError(t, err)
+	assert.NotContains(t, envs, "SHARED_API_KEY")
+
+	// Like PatchEnvVar, an admin updates the default envs; requested services without the var are skipped
+	admin := &model.User{Username: "bulk-env-admin", DisplayName: "bulk-env-admin", Role: common.RoleAdminUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, admin.Insert())
+	restarted = nil
+	body, _ = json.Marshal(map[string]any{"var_name": "SHARED_API_KEY", "var_value": "admin-key", "service_ids": []int64{withDefault.ID, unrelated.ID}})
+	recorder = httptest.NewRecorder()
+	ctx, _ = gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPatch, "/api/user/env_vars/bulk", bytes.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	ctx.Set("user_id", admin.ID)
+	BulkPatchEnvVar(ctx)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var adminData struct {
+		Updated []struct {
+			ServiceID int64 `json:"service_id"`
+		} `json:"updated"`
+		Skipped []struct {
+			ServiceID int64 `json:"service_id"`
+		} `json:"skipped"`
+	}
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &adminData))
+	if assert.Len(t, adminData.Updated, 1) {
+		assert.Equal(t, withDefault.ID, adminData.Updated[0].ServiceID)
+	}
+	if assert.Len(t, adminData.Skipped, 1) {
+		assert.Equal(t, unrelated.ID, adminData.Skipped[0].ServiceID)
+	}
+	assert.Empty(t, restarted)
+	reloaded, err := model.GetServiceByID(withDefault.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"SHARED_API_KEY": "admin-key"}, reloaded.ActiveDefaultEnvs())
+	reloaded, err = model.GetServiceByID(unrelated.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"OTHER":"x"}`, reloaded.DefaultEnvsJSON)
+	_, err = model.GetConfigOptionByKey(unrelated.ID, "SHARED_API_KEY")
+	assert.Error(t, err, "no config option is created for a service without the var")
+}
+
+func TestResetMCPServiceConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	const userID, otherUserID = int64(9531), int64(9532)
+	svc := &model.MCPService{Name: "reset-config-svc", DisplayName: "Reset", Type: model.ServiceTypeStdio, Command: "node", DefaultEnvsJSON: `{"API_KEY":"admin-default"}`}
+	assert.NoError(t, model.CreateService(svc))
+	option := &model.ConfigService{ServiceID: svc.ID, Key: "API_KEY", DisplayName: "API_KEY", Type: model.ConfigTypeSecret}
+	assert.NoError(t, model.CreateConfigOption(option))
+	assert.NoError(t, model.SaveUserConfig(&model.UserConfig{UserID: userID, ServiceID: svc.ID, ConfigID: option.ID, Value: "mine"}))
+	assert.NoError(t, model.SaveUserConfig(&model.UserConfig{UserID: userID, ServiceID: svc.ID, ConfigID: option.ID, Value: "mine-work", ProfileName: "work"}))
+	assert.NoError(t, model.SaveUserConfig(&model.UserConfig{UserID: otherUserID, ServiceID: svc.ID, ConfigID: option.ID, Value: "theirs"}))
+
+	var restarted []int64
+	originalRestart := restartUserServiceInstances
+	restartUserServiceInstances = func(ctx context.Context, uid, serviceID int64) int {
+		assert.Equal(t, userID, uid)
+		restarted = append(restarted, serviceID)
+		return 2
+	}
+	defer func() { restartUserServiceInstances = originalRestart }()
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/api/mcp_services/"+strconv.FormatInt(svc.ID, 10)+"/reset_config", nil)
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(svc.ID, 10)}}
+	ctx.Set("user_id", userID)
+	ResetMCPServiceConfig(ctx)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var data struct {
+		ServiceID          int64 `json:"service_id"`
+		RestartedInstances int   `json:"restarted_instances"`
+	}
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &data))
+	assert.Equal(t, svc.ID, data.ServiceID)
+	assert.Equal(t, 2, data.RestartedInstances)
+	assert.Equal(t, []int64{svc.ID}, restarted)
+
+	// 当前用户的所有 profile 均被清除，回退到默认值
+	configs, err := model.GetUserConfigsForService(userID, svc.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, configs)
+	envs, err := model.GetUserProfileEnvs(userID, svc.ID, "work")
+	assert.NoError(t, err)
+	assert.Empty(t, envs)
+	reloaded, err := model.GetServiceByID(svc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"API_KEY":"admin-default"}`, reloaded.DefaultEnvsJSON)
+
+	// 其他用户的配置不受影响
+	envs, err = model.GetUserSpecificEnvs(otherUserID, svc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "theirs", envs["API_KEY"])
+}
+
+func TestGetMyServiceEnv(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	const userID = int64(9551)
+	newService := func(name string, allowOverride bool) *model.MCPService {
+		svc := &model.MCPService{Name: name, DisplayName: name, Type: model.ServiceTypeStdio, Command: "node", AllowUserOverride: allowOverride,
+			DefaultEnvsJSON: `{"API_KEY":"admin-key-value","REGION":"us","LOG_LEVEL":"info"}`}
+		assert.NoError(t, model.CreateService(svc))
+		optionIDs := map[string]int64{}
+		for key, configType := range map[string]model.ConfigType{"API_KEY": model.ConfigTypeSecret, "REGION": model.ConfigTypeString, "PROJECT": model.ConfigTypeString} {
+			option := &model.ConfigService{ServiceID: svc.ID, Key: key, DisplayName: key, Type: configType}
+			assert.NoError(t, model.CreateConfigOption(option))
+			optionIDs[key] = option.ID
+		}
+		for key, value := range map[string]string{"API_KEY": "user-key-value", "REGION": "eu", "PROJECT": "demo"} {
+			assert.NoError(t, model.SaveUserConfig(&model.UserConfig{UserID: userID, ServiceID: svc.ID, ConfigID: optionIDs[key], Value: value}))
+		}
+		return svc
+	}
+
+	type envVar struct {
+		Value            string `json:"value"`
+		Source           string `json:"source"`
+		Masked           bool   `json:"masked"`
+		OverridesDefault bool   `json:"overrides_default"`
+	}
+	role := common.RoleAdminUser
+	query := func(svc *model.MCPService) (map[string]envVar, []string) {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/api/mcp_services/"+strconv.FormatInt(svc.ID, 10)+"/my_env", nil)
+		ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(svc.ID, 10)}}
+		ctx.Set("user_id", userID)
+		ctx.Set("role", role)
+		GetMyServiceEnv(ctx)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var data struct {
+			Env []struct {
+				Name string `json:"name"`
+				envVar
+			} `json:"env"`
+			IgnoredUserVars []string `json:"ignored_user_vars"`
+		}
+		assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &data))
+		env := map[string]envVar{}
+		for _, entry := range data.Env {
+			env[entry.Name] = entry.envVar
+		}
+		return env, data.IgnoredUserVars
+	}
+
+	overridable := newService("my-env-overridable", true)
+	env, ignored := query(overridable)
+	assert.Empty(t, ignored)
+	assert.Equal(t, map[string]envVar{
+		"API_KEY":   {Value: common.RedactedPlaceholder, Source: "user", Masked: true, OverridesDefault: true},
+		"REGION":    {Value: "eu", Source: "user", OverridesDefault: true},
+		"PROJECT":   {Value: "demo", Source: "user"},
+		"LOG_LEVEL": {Value: "info", Source: "default"},
+	}, env)
+
+	// 不允许用户覆盖时，实例只使用默认值，用户配置被忽略
+	locked := newService("my-env-locked", false)
+	env, ignored = query(locked)
+	assert.Equal(t, []string{"API_KEY", "PROJECT", "REGION"}, ignored)
+	assert.Equal(t, map[string]envVar{
+		"API_KEY":   {Value: common.RedactedPlaceholder, Source: "locked", Masked: true},
+		"REGION":    {Value: "us", Source: "locked"},
+		"LOG_LEVEL": {Value: "info", Source: "locked"},
+	}, env)
+
+	// 非管理员只能看到自己的值，管理员默认值一律隐藏
+	role = common.RoleCommonUser
+	env, _ = query(overridable)
+	assert.Equal(t, map[string]envVar{
+		"API_KEY":   {Value: common.RedactedPlaceholder, Source: "user", Masked: true, OverridesDefault: true},
+		"REGION":    {Value: "eu", Source: "user", OverridesDefault: true},
+		"PROJECT":   {Value: "demo", Source: "user"},
+		"LOG_LEVEL": {Value: common.RedactedPlaceholder, Source: "default", Masked: true},
+	}, env)
+	env, _ = query(locked)
+	assert.Equal(t, map[string]envVar{
+		"API_KEY":   {Value: common.RedactedPlaceholder, Source: "locked", Masked: true},
+		"REGION":    {Value: common.RedactedPlaceholder, Source: "locked", Masked: true},
+		"LOG_LEVEL": {Value: common.RedactedPlaceholder, Source: "locked", Masked: true},
+	}, env)
+}
+
+func TestInstallOrAddServiceForceNew(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	originalUVX, originalSubmit := checkUVXAvailable, submitInstallationTask
+	defer func() { checkUVXAvailable, submitInstallationTask = originalUVX, originalSubmit }()
+	checkUVXAvailable = func() bool { return true }
+	var submitted []market.InstallationTask
+	submitInstallationTask = func(task market.InstallationTask) { submitted = append(submitted, task) }
+
+	existing := &model.MCPService{Name: "demo-mcp", DisplayName: "Demo", Type: model.ServiceTypeStdio, Command: "uvx", PackageManager: "pypi", SourcePackageName: "demo-mcp", Enabled: true}
+	assert.NoError(t, model.CreateService(existing))
+
+	install := func(forceNew bool) (int64, string) {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Set("user_id", int64(9571))
+		ctx.Request = newJSONRequest(t, http.MethodPost, "/api/mcp_market/install_or_add_service", map[string]any{
+			"source_type":     "custom",
+			"package_name":    "demo-mcp",
+			"package_manager": "pypi",
+			"custom_args":     []string{"--from", "/opt/tools/demo-mcp", "demo-mcp"},
+			"force_new":       forceNew,
+		})
+		InstallOrAddService(ctx)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		resp := decodeAPIResponse(t, recorder)
+		assert.True(t, resp.Success, resp.Message)
+		var data struct {
+			MCPServiceID int64  `json:"mcp_service_id"`
+			Status       string `json:"status"`
+		}
+		assert.NoError(t, json.Unmarshal(resp.Data, &data))
+		return data.MCPServiceID, data.Status
+	}
+
+	// 默认复用已安装的服务
+	serviceID, status := install(false)
+	assert.Equal(t, existing.ID, serviceID)
+	assert.Equal(t, "already_installed_instance_added", status)
+	assert.Empty(t, submitted)
+
+	// force_new 为同一个包创建独立的服务，名称自动加序号
+	for i, wantName := range []string{"demo-mcp-2", "demo-mcp-3"} {
+		serviceID, status = install(true)
+		assert.NotEqual(t, existing.ID, serviceID)
+		assert.Equal(t, string(market.StatusPending), status)
+		created, err := model.GetServiceByID(serviceID)
+		assert.NoError(t, err)
+		assert.Equal(t, wantName, created.Name)
+		assert.Equal(t, "demo-mcp", created.SourcePackageName)
+		assert.Len(t, submitted, i+1)
+		assert.Equal(t, serviceID, submitted[i].ServiceID)
+	}
+
+	services, err := model.GetServicesByPackageDetails("pypi", "demo-mcp")
+	assert.NoError(t, err)
+	assert.Len(t, services, 3)
+	assert.Equal(t, existing.ID, services[0].ID)
+	// 包仍被其他服务使用时，卸载其中一个不能删除包
+	assert.True(t, packageSharedWithOtherServices(existing))
+	lone := &model.MCPService{Name: "lone-mcp", Type: model.ServiceTypeStdio, PackageManager: "pypi", SourcePackageName: "lone-mcp"}
+	assert.NoError(t, model.CreateService(lone))
+	assert.False(t, packageSharedWithOtherServices(lone))
+}
+
+func TestReinstallService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	originalSubmit := submitInstallationTask
+	defer func() { submitInstallationTask = originalSubmit }()
+	var submitted []market.InstallationTask
+	submitInstallationTask = func(task market.InstallationTask) { submitted = append(submitted, task) }
+
+	reinstall := func(id int64) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Set("user_id", int64(9641))
+		ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(id, 10)}}
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/api/mcp_services/"+strconv.FormatInt(id, 10)+"/reinstall", nil)
+		ReinstallService(ctx)
+		return recorder
+	}
+
+	svc := &model.MCPService{Name: "reinstall-mcp", DisplayName: "Reinstall", Type: model.ServiceTypeStdio, Command: "npx", ArgsJSON: `["-y","reinstall-mcp"]`, RuntimeArgsJSON: `["--port","0"]`,
+		PackageManager: "npm", SourcePackageName: "reinstall-mcp", InstalledVersion: "1.2.3", DefaultEnvsJSON: `{"API_KEY":"k"}`, Enabled: true}
+	assert.NoError(t, model.CreateService(svc))
+	recorder := reinstall(svc.ID)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, submitted, 1)
+	assert.Equal(t, svc.ID, submitted[0].ServiceID)
+	assert.Equal(t, "reinstall-mcp", submitted[0].PackageName)
+	assert.Equal(t, "1.2.3", submitted[0].Version)
+	assert.Equal(t, []string{"-y", "reinstall-mcp", "--port", "0"}, submitted[0].Args, "runtime args are kept")
+	assert.Equal(t, map[string]string{"API_KEY": "k"}, submitted[0].EnvVars)
+
+	// 自定义服务没有可重新安装的包
+	custom := &model.MCPService{Name: "reinstall-custom", DisplayName: "Custom", Type: model.ServiceTypeStdio, Command: "/opt/server", PackageManager: "custom"}
+	assert.NoError(t, model.CreateService(custom))
+	assert.Equal(t, http.StatusBadRequest, reinstall(custom.ID).Code)
+	assert.Len(t, submitted, 1)
+}
+
+func TestInstallOrAddServiceRecordsInstaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	originalUVX, originalSubmit := checkUVXAvailable, submitInstallationTask
+	defer func() { checkUVXAvailable, submitInstallationTask = originalUVX, originalSubmit }()
+	checkUVXAvailable = func() bool { return true }
+	submitInstallationTask = func(task market.InstallationTask) {}
+
+	installer := &model.User{Username: "installer-admin", DisplayName: "Installer", Role: common.RoleAdminUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, installer.Insert())
+	otherAdmin := &model.User{Username: "other-admin", DisplayName: "Other", Role: common.RoleAdminUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, otherAdmin.Insert())
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Set("user_id", installer.ID)
+	ctx.Request = newJSONRequest(t, http.MethodPost, "/api/mcp_market/install_or_add_service", map[string]any{
+		"source_type":     "custom",
+		"package_name":    "audited-mcp",
+		"package_manager": "pypi",
+		"custom_args":     []string{"--from", "/opt/tools/audited-mcp", "audited-mcp"},
+	})
+	before := time.Now()
+	InstallOrAddService(ctx)
+	resp := decodeAPIResponse(t, recorder)
+	assert.True(t, resp.Success, resp.Message)
+	var data struct {
+		MCPServiceID int64 `json:"mcp_service_id"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Data, &data))
+
+	created, err := model.GetServiceByID(data.MCPServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, installer.ID, created.InstalledByUserID)
+	assert.WithinDuration(t, before, created.InstalledAt, time.Minute)
+
+	// 安装记录写入服务的安装日志
+	logs, err := model.MCPLogDB.Where("service_id = ? AND phase = ?", created.ID, model.MCPLogPhaseInstall).Fetch(0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 1) {
+		assert.Contains(t, logs[0].Message, fmt.Sprintf("installed by installer-admin (ID: %d)", installer.ID))
+	}
+
+	// 列表中展示安装者
+	recorder = httptest.NewRecorder()
+	ctx, _ = gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/api/mcp_market/installed", nil)
+	ListInstalledMCPServices(ctx)
+	var services []map[string]any
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &services))
+	var listed map[string]any
+	for _, svc := range services {
+		if svc["id"] == float64(created.ID) {
+			listed = svc
+		}
+	}
+	if assert.NotNil(t, listed) {
+		assert.Equal(t, "installer-admin", listed["installed_by"])
+		assert.Equal(t, float64(installer.ID), listed["installed_by_user_id"])
+		assert.NotEmpty(t, listed["installed_at"])
+	}
+
+	// 开启 UninstallInstallerOnly 后其他管理员不能卸载
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap[common.OptionUninstallInstallerOnly] = "true"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		delete(common.OptionMap, common.OptionUninstallInstallerOnly)
+		common.OptionMapRWMutex.Unlock()
+	}()
+	uninstall := func(userID int64, role int) int {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Set("user_id", userID)
+		ctx.Set("role", role)
+		ctx.Request = newJSONRequest(t, http.MethodPost, "/api/mcp_market/uninstall", map[string]any{"service_id": created.ID})
+		UninstallService(ctx)
+		return recorder.Code
+	}
+	assert.Equal(t, http.StatusForbidden, uninstall(otherAdmin.ID, common.RoleAdminUser))
+	assert.Equal(t, http.StatusOK, uninstall(installer.ID, common.RoleAdminUser))
+}
+
+func TestListInstalledMCPServicesHidesOAuthSecret(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	svc := &model.MCPService{
+		Name:            "oauth-svc",
+		DisplayName:     "oauth-svc",
+		Type:            model.ServiceTypeStreamableHTTP,
+		Command:         "https://mcp.example/mcp",
+		OAuthConfigJSON: `{"grant_type": "client_credentials", "token_url": "https://auth.example/token", "client_id": "one-mcp", "client_secret": "top-secret"}`,
+	}
+	assert.NoError(t, model.CreateService(svc))
+
+	for _, role := range []int{common.RoleCommonUser, common.RoleObserverUser, common.RoleAdminUser} {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/api/mcp_market/installed", nil)
+		ctx.Set("user_id", int64(1))
+		ctx.Set("role", role)
+		ListInstalledMCPServices(ctx)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "top-secret", "role %d", role)
+
+		var services []map[string]any
+		assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &services))
+		var listed map[string]any
+		for _, service := range services {
+			if service["id"] == float64(svc.ID) {
+				listed = service
+			}
+		}
+		if !assert.NotNil(t, listed) {
+			continue
+		}
+		if role < common.RoleAdminUser {
+			assert.NotContains(t, listed, "oauth_config_json", "role %d", role)
+		} else {
+			assert.Contains(t, listed["oauth_config_json"], common.RedactedPlaceholder)
+		}
+	}
+}
+
+func TestPatchEnvVarKeepsEnvironmentProfiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	common.OptionMapRWMutex.Lock()
+	originalEnvironment, hadEnvironment := common.OptionMap[common.OptionActiveEnvironment]
+	common.OptionMap[common.OptionActiveEnvironment] = "prod"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		if hadEnvironment {
+			common.OptionMap[common.OptionActiveEnvironment] = originalEnvironment
+		} else {
+			delete(common.OptionMap, common.OptionActiveEnvironment)
+		}
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	admin := &model.User{Username: "profile-admin", DisplayName: "Admin", Role: common.RoleAdminUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, admin.Insert())
+	svc := &model.MCPService{Name: "profiled-envs", DisplayName: "Profiled", Type: model.ServiceTypeStdio, Command: "node",
+		DefaultEnvsJSON: `{"default": {"API_URL": "https://staging.example", "REGION": "eu"}, "prod": {"API_URL": "https://api.example"}}`}
+	assert.NoError(t, model.CreateService(svc))
+
+	body, _ := json.Marshal(map[string]any{"service_id": svc.ID, "var_name": "API_KEY", "var_value": "prod-key"})
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPatch, "/api/mcp_market/env_var", bytes.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	ctx.Set("user_id", admin.ID)
+	PatchEnvVar(ctx)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	updated, err := model.GetServiceByID(svc.ID)
+	assert.NoError(t, err)
+	var profiles map[string]map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(updated.DefaultEnvsJSON), &profiles))
+	assert.Equal(t, map[string]string{"API_URL": "https://staging.example", "REGION": "eu"}, profiles["default"])
+	assert.Equal(t, map[string]string{"API_URL": "https://api.example", "API_KEY": "prod-key"}, profiles["prod"])
+	assert.Equal(t, map[string]string{"API_URL": "https://api.example", "REGION": "eu", "API_KEY": "prod-key"}, updated.ActiveDefaultEnvs())
+}
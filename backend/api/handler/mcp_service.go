@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"net/url"
 	"one-mcp/backend/common"
 	"one-mcp/backend/common/i18n"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -45,11 +50,19 @@ func UpdateMCPService(c *gin.Context) {
 		return
 	}
 
+	if service.IsFileManaged() {
+		common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("service_managed_by_file", lang))
+		return
+	}
+
 	// 保存原始值用于比较
 	oldPackageManager := service.PackageManager
 	oldSourcePackageName := service.SourcePackageName
 	oldCommand := service.Command                 // For SSE/HTTP services, this is the URL
 	oldDefaultEnvsJSON := service.DefaultEnvsJSON // For stdio services, check env changes
+	oldWorkingDir := service.WorkingDir
+	oldOAuthConfigJSON := service.OAuthConfigJSON
+	installedBy, installedAt := service.InstalledByUserID, service.InstalledAt
 	// Preserve original Command and ArgsJSON before binding, so we can see if user explicitly changed them
 	// or if our PackageManager logic should take precedence if they become empty after binding.
 	// However, the current logic is that PackageManager dictates Command/ArgsJSON if they are empty.
@@ -58,6 +71,8 @@ func UpdateMCPService(c *gin.Context) {
 		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
 		return
 	}
+	// 安装者与安装时间只在创建时记录
+	service.InstalledByUserID, service.InstalledAt = installedBy, installedAt
 
 	// 基本验证
 	if service.Name == "" || service.DisplayName == "" {
@@ -79,6 +94,103 @@ func UpdateMCPService(c *gin.Context) {
 		}
 	}
 
+	// 验证运行时参数
+	if err := model.ValidateRuntimeArgsJSON(service.RuntimeArgsJSON); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_runtime_args", lang), err)
+		return
+	}
+
+	// 验证启动前/停止后钩子
+	if err := service.ValidateHookCommands(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_hook_command", lang), err)
+		return
+	}
+
+	// 验证 uvx 的 Python 版本与索引地址
+	if err := service.ValidateUVXOptions(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_uvx_options", lang), err)
+		return
+	}
+
+	// 验证健康检查地址
+	if err := service.ValidateHealthCheckURL(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_health_check_url", lang), err)
+		return
+	}
+
+	// 验证备用端点
+	if err := service.ValidateFallbackEndpoints(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_fallback_endpoints", lang), err)
+		return
+	}
+
+	// 验证 OAuth 配置
+	// 响应中的 client_secret 已脱敏，原样提交时沿用已保存的值
+	service.RestoreOAuthClientSecret(oldOAuthConfigJSON)
+	if err := service.ValidateOAuthConfig(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_oauth_config", lang), err)
+		return
+	}
+
+	// 验证代理端点的自定义响应头
+	if err := service.ValidateResponseHeaders(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_response_headers", lang), err)
+		return
+	}
+
+	// 验证维护窗口
+	if strings.TrimSpace(service.MaintenanceWindow) != "" {
+		if _, _, err := common.ParseMaintenanceWindow(service.MaintenanceWindow); err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_maintenance_window", lang), err)
+			return
+		}
+	}
+
+	// 验证日志脱敏规则
+	if _, err := common.ParseRedactionRules(service.RedactionRulesJSON); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_redaction_rules", lang), err)
+		return
+	}
+
+	if !model.IsValidRateLimitScope(service.RateLimitScope) {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_rate_limit_scope", lang))
+		return
+	}
+
+	// 验证并规范化标签
+	tags, err := parseTagsJSON(service.TagsJSON)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_tags", lang), err)
+		return
+	}
+	if err := service.SetTags(tags); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_tags", lang), err)
+		return
+	}
+
+	// 验证建议的替代服务
+	service.ReplacedBy = strings.TrimSpace(service.ReplacedBy)
+	if service.ReplacedBy != "" {
+		if service.ReplacedBy == service.Name {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_replacement_service", lang))
+			return
+		}
+		if _, err := model.GetServiceByName(service.ReplacedBy); err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_replacement_service", lang), err)
+			return
+		}
+	}
+
+	// 验证工作目录 (仅 stdio 服务使用)
+	if service.WorkingDir != "" {
+		workDir, err := common.ValidateWorkingDir(service.WorkingDir)
+		if err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_working_dir", lang), err)
+			return
+		}
+		service.WorkingDir = workDir
+	}
+
 	// 如果是marketplace服务（stdio类型且PackageManager不为空），验证相关字段
 	if service.Type == model.ServiceTypeStdio && service.PackageManager != "" {
 		if service.SourcePackageName == "" {
@@ -125,6 +237,12 @@ func UpdateMCPService(c *gin.Context) {
 			service.Name, service.ID, oldDefaultEnvsJSON, service.DefaultEnvsJSON))
 	}
 
+	if service.Type == model.ServiceTypeStdio && oldWorkingDir != service.WorkingDir {
+		needsRestart = true
+		common.SysLog(fmt.Sprintf("Working directory changed for stdio service %s (ID: %d) from '%s' to '%s', will restart instance",
+			service.Name, service.ID, oldWorkingDir, service.WorkingDir))
+	}
+
 	// Skip immediate restart preparation - we'll handle everything in background after DB update
 	// This avoids blocking the HTTP response
 	var needsRestartAfterUpdate = needsRestart
@@ -137,6 +255,13 @@ func UpdateMCPService(c *gin.Context) {
 	}
 	common.SysLog(fmt.Sprintf("Successfully updated service %s (ID: %d) in database", service.Name, service.ID))
 
+	// Settings that don't require a restart (e.g. deep health check) are pushed to the running service
+	if !needsRestartAfterUpdate {
+		if err := proxy.GetServiceManager().RefreshServiceDBConfig(service); err != nil && !errors.Is(err, proxy.ErrServiceNotFound) {
+			common.SysError(fmt.Sprintf("Failed to refresh runtime config for service %s (ID: %d): %v", service.Name, service.ID, err))
+		}
+	}
+
 	// Restart the service if configuration changed - do everything in background to avoid blocking
 	if needsRestartAfterUpdate {
 		common.SysLog(fmt.Sprintf("Configuration changed for service %s (ID: %d), starting background restart process", service.Name, service.ID))
@@ -179,7 +304,9 @@ func UpdateMCPService(c *gin.Context) {
 		}()
 	}
 
-	common.RespSuccess(c, service)
+	response := *service
+	response.OAuthConfigJSON = service.MaskedOAuthConfigJSON()
+	common.RespSuccess(c, &response)
 }
 
 // ToggleMCPService godoc
@@ -211,6 +338,11 @@ func ToggleMCPService(c *gin.Context) {
 		return
 	}
 
+	if service.IsFileManaged() {
+		common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("service_managed_by_file", lang))
+		return
+	}
+
 	wasEnabled := service.Enabled
 	if err := model.ToggleServiceEnabled(id); err != nil {
 		common.RespError(c, http.StatusInternalServerError, i18n.Translate("toggle_service_status_failed", lang), err)
@@ -234,7 +366,7 @@ func ToggleMCPService(c *gin.Context) {
 	defer cancel()
 
 	if wasEnabled {
-		if err := serviceManager.UnregisterService(ctx, id); err != nil && err != proxy.ErrServiceNotFound {
+		if err := serviceManager.UnregisterService(ctx, id); err != nil && !errors.Is(err, proxy.ErrServiceNotFound) {
 			common.SysError(fmt.Sprintf("failed to unregister disabled service %d: %v", id, err))
 			if revertErr := model.ToggleServiceEnabled(id); revertErr != nil {
 				common.SysError(fmt.Sprintf("failed to revert service %d enabled state after unregister failure: %v", id, revertErr))
@@ -243,7 +375,7 @@ func ToggleMCPService(c *gin.Context) {
 			return
 		}
 	} else {
-		if err := serviceManager.RegisterService(ctx, updatedService); err != nil && err != proxy.ErrServiceAlreadyExists {
+		if err := serviceManager.RegisterService(ctx, updatedService); err != nil {
 			common.SysError(fmt.Sprintf("failed to register enabled service %d: %v", id, err))
 			if revertErr := model.ToggleServiceEnabled(id); revertErr != nil {
 				common.SysError(fmt.Sprintf("failed to revert service %d enabled state after register failure: %v", id, revertErr))
@@ -414,6 +546,264 @@ func GetMCPServiceTools(c *gin.Context) {
 	})
 }
 
+// GetMCPServiceServerInfo godoc
+// @Summary 获取MCP服务的初始化信息
+// @Description 返回服务在 initialize 握手中返回的原始结果（协议版本、capabilities、serverInfo 及 instructions）；优先使用共享实例创建时缓存的结果，服务未运行时会启动共享实例获取
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 502 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/server_info [get]
+func GetMCPServiceServerInfo(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+
+	mcpService, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found_or_not_running", lang), err)
+		return
+	}
+	if !mcpService.Enabled {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found_or_not_running", lang), errors.New("service is disabled"))
+		return
+	}
+
+	// 共享实例已存在时直接返回其缓存的结果，否则创建实例完成一次 initialize 握手
+	sharedInst, err := proxy.GetOrCreateSharedMcpInstanceWithKey(c.Request.Context(), mcpService, proxy.SharedServiceCacheKey(id), proxy.SharedServiceInstanceName(id), mcpService.DefaultEnvsJSON)
+	if err != nil {
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("get_server_info_failed", lang), err)
+		return
+	}
+	if sharedInst == nil || sharedInst.InitResult == nil {
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("get_server_info_failed", lang), errors.New("no initialize result recorded for the service instance"))
+		return
+	}
+	common.RespSuccess(c, sharedInst.InitResult)
+}
+
+// proxyKeyPlaceholder stands for the caller's API key in the endpoint URLs returned by GetMCPServiceEndpoints
+const proxyKeyPlaceholder = "<YOUR_TOKEN>"
+
+// serviceEndpoint is one proxy URL through which clients can reach a service
+type serviceEndpoint struct {
+	Transport string `json:"transport"` // "sse", "sse_message" or "streamable_http"
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	Native    bool   `json:"native"` // 上游本身使用该传输方式，代理无需转换
+}
+
+// proxyEndpointsFor returns the proxy endpoints of a service under baseURL. The proxy converts between
+// transports, so stdio, SSE and streamable HTTP services are all served over SSE (/sse, then POSTs to the
+// /message URL announced in the endpoint event) and streamable HTTP (/mcp).
+func proxyEndpointsFor(svc *model.MCPService, baseURL string) []serviceEndpoint {
+	switch svc.Type {
+	case model.ServiceTypeStdio, model.ServiceTypeSSE, model.ServiceTypeStreamableHTTP:
+	default:
+		return []serviceEndpoint{}
+	}
+	prefix := strings.TrimSuffix(baseURL, "/") + "/proxy/" + url.PathEscape(svc.Name)
+	query := "?key=" + proxyKeyPlaceholder
+	return []serviceEndpoint{
+		{Transport: "sse", Method: http.MethodGet, URL: prefix + "/sse" + query, Native: svc.Type == model.ServiceTypeSSE},
+		{Transport: "sse_message", Method: http.MethodPost, URL: prefix + "/message" + query, Native: svc.Type == model.ServiceTypeSSE},
+		{Transport: "streamable_http", Method: http.MethodPost, URL: prefix + "/mcp" + query, Native: svc.Type == model.ServiceTypeStreamableHTTP},
+	}
+}
+
+// GetMCPServiceEndpoints godoc
+// @Summary 获取MCP服务的代理端点
+// @Description 根据服务类型和服务器地址返回客户端可用的完整代理 URL（SSE、SSE 消息及 Streamable HTTP），其中 key 参数为 API 密钥占位符 <YOUR_TOKEN>；经可信代理访问时使用 X-Forwarded-Host 对应的外部地址
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/endpoints [get]
+func GetMCPServiceEndpoints(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+
+	mcpService, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+
+	baseURL := forwardedBaseURL(c.Request, c.RemoteIP())
+	if baseURL == "" {
+		baseURL = common.GetServerAddress()
+	}
+	common.RespSuccess(c, gin.H{
+		"service_id":      mcpService.ID,
+		"service_name":    mcpService.Name,
+		"service_type":    mcpService.Type,
+		"key_placeholder": proxyKeyPlaceholder,
+		"endpoints":       proxyEndpointsFor(mcpService, baseURL),
+	})
+}
+
+// Sources of the variables reported by GetMyServiceEnv
+const (
+	envSourceDefault = "default" // 管理员默认值，用户未覆盖
+	envSourceUser    = "user"    // 用户配置（覆盖或补充默认值）
+	envSourceLocked  = "locked"  // 管理员默认值，服务不允许用户覆盖
+)
+
+// effectiveEnvVar is one variable of the env a user's instance is started with
+type effectiveEnvVar struct {
+	Name             string `json:"name"`
+	Value            string `json:"value"`
+	Source           string `json:"source"`
+	Masked           bool   `json:"masked"`
+	OverridesDefault bool   `json:"overrides_default"`
+}
+
+// GetMyServiceEnv godoc
+// @Summary 查看当前用户的有效环境变量
+// @Description 返回代理为当前用户启动该服务实例时使用的合并后环境变量（默认值 + 用户配置，可通过 profile 参数或 X-MCP-Env-Profile 请求头选择 profile），并标明每个变量的来源；敏感值会被隐藏，非管理员看不到管理员配置的默认值
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param id path int true "服务ID"
+// @Param profile query string false "环境变量 profile"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/my_env [get]
+func GetMyServiceEnv(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return
+	}
+	mcpService, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+
+	profile := resolveEnvProfile(c, userID)
+	defaults, userEnvs, merged := userServiceEnvs(mcpService, userID, profile)
+	// 与代理一致：只有允许用户覆盖的 stdio 服务才会为用户使用个人配置
+	overridable := mcpService.AllowUserOverride && mcpService.Type == model.ServiceTypeStdio
+	var ignored []string
+	if !overridable {
+		merged = defaults
+		ignored = slices.Sorted(maps.Keys(userEnvs))
+	}
+
+	secretKeys := make(map[string]bool)
+	if options, err := model.GetConfigOptionsForService(mcpService.ID); err == nil {
+		for _, option := range options {
+			if option.Type == model.ConfigTypeSecret {
+				secretKeys[option.Key] = true
+			}
+		}
+	}
+	redactor := mcpService.LogRedactor()
+	// 管理员默认值可能包含内嵌凭据的 URL 等未标记为敏感的数据，只对管理员展示
+	showDefaults := c.GetInt("role") >= common.RoleAdminUser
+
+	env := make([]effectiveEnvVar, 0, len(merged))
+	for name, value := range merged {
+		entry := effectiveEnvVar{Name: name, Value: value, Source: envSourceDefault}
+		defaultValue, hasDefault := defaults[name]
+		_, fromUser := userEnvs[name]
+		switch {
+		case !overridable:
+			entry.Source = envSourceLocked
+		case fromUser:
+			entry.Source = envSourceUser
+			entry.OverridesDefault = hasDefault && defaultValue != value
+		}
+		fromDefault := entry.Source != envSourceUser
+		if value != "" && (secretKeys[name] || redactor.IsSensitiveKey(name) || (fromDefault && !showDefaults)) {
+			entry.Value = common.RedactedPlaceholder
+			entry.Masked = true
+		}
+		env = append(env, entry)
+	}
+	sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+
+	common.RespSuccess(c, gin.H{
+		"service_id":           mcpService.ID,
+		"profile":              profile,
+		"allow_user_override":  overridable,
+		"uses_global_instance": !overridable || (common.GetReuseGlobalUserInstances() && maps.Equal(merged, defaults)),
+		"env":                  env,
+		"ignored_user_vars":    ignored,
+	})
+}
+
+// ResetMCPServiceConfig godoc
+// @Summary 恢复服务默认配置
+// @Description 删除当前用户对该服务的所有个人环境变量（含各 profile），回退到管理员配置的默认值，并重启该用户的专属实例。不影响其他用户和默认配置
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/reset_config [post]
+func ResetMCPServiceConfig(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return
+	}
+	mcpService, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+
+	if err := model.DeleteUserConfigsForService(userID, mcpService.ID); err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("reset_service_config_failed", lang), err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	restarted := restartUserServiceInstances(ctx, userID, mcpService.ID)
+
+	common.SysLog(fmt.Sprintf("User %d reset their configuration of service %s (ID: %d), %d instance(s) restarted", userID, mcpService.Name, mcpService.ID, restarted))
+	common.RespSuccess(c, gin.H{
+		"service_id":          mcpService.ID,
+		"restarted_instances": restarted,
+	})
+}
+
 // 辅助函数：验证服务类型
 func isValidServiceType(sType model.ServiceType) bool {
 	return sType == model.ServiceTypeStdio ||
@@ -432,12 +822,27 @@ func validateRequiredEnvVarsJSON(envVarsJSON string) error {
 		return err
 	}
 
-	// 验证每个环境变量是否有name字段
-	for _, envVar := range envVars {
-		if envVar.Name == "" {
-			return errors.New("missing name field in env var definition")
-		}
+	// 验证每个环境变量是否有name字段，以及 required_if 条件引用
+	return model.ValidateEnvVarDefinitions(envVars)
+}
+
+// maxServiceTagLength 单个标签的最大长度
+const maxServiceTagLength = 64
+
+// 辅助函数：解析并验证 TagsJSON（字符串数组）
+func parseTagsJSON(tagsJSON string) ([]string, error) {
+	if strings.TrimSpace(tagsJSON) == "" {
+		return nil, nil
 	}
 
-	return nil
+	var tags []string
+	if err := json.Unmarshal([]byte(tagsJSON), &tags); err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if len(strings.TrimSpace(tag)) > maxServiceTagLength {
+			return nil, fmt.Errorf("tag %q exceeds %d characters", tag, maxServiceTagLength)
+		}
+	}
+	return tags, nil
 }
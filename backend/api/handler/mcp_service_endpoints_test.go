@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMCPServiceEndpoints_MatchServiceType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	common.OptionMapRWMutex.Lock()
+	originalAddress := common.OptionMap["ServerAddress"]
+	common.OptionMap["ServerAddress"] = "https://mcp.example.com/one-mcp/"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap["ServerAddress"] = originalAddress
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	r := gin.New()
+	r.GET("/api/mcp_services/:id/endpoints", GetMCPServiceEndpoints)
+	base := "https://mcp.example.com/one-mcp/proxy/"
+
+	tests := []struct {
+		name    string
+		svcType model.ServiceType
+		want    []serviceEndpoint
+	}{
+		{"stdio is converted to sse and streamable http", model.ServiceTypeStdio, []serviceEndpoint{
+			{Transport: "sse", Method: http.MethodGet, URL: base + "endpoints-stdio/sse?key=<YOUR_TOKEN>"},
+			{Transport: "sse_message", Method: http.MethodPost, URL: base + "endpoints-stdio/message?key=<YOUR_TOKEN>"},
+			{Transport: "streamable_http", Method: http.MethodPost, URL: base + "endpoints-stdio/mcp?key=<YOUR_TOKEN>"},
+		}},
+		{"sse is native over sse", model.ServiceTypeSSE, []serviceEndpoint{
+			{Transport: "sse", Method: http.MethodGet, URL: base + "endpoints-sse/sse?key=<YOUR_TOKEN>", Native: true},
+			{Transport: "sse_message", Method: http.MethodPost, URL: base + "endpoints-sse/message?key=<YOUR_TOKEN>", Native: true},
+			{Transport: "streamable_http", Method: http.MethodPost, URL: base + "endpoints-sse/mcp?key=<YOUR_TOKEN>"},
+		}},
+		{"streamable http is native over mcp", model.ServiceTypeStreamableHTTP, []serviceEndpoint{
+			{Transport: "sse", Method: http.MethodGet, URL: base + "endpoints-streamable_http/sse?key=<YOUR_TOKEN>"},
+			{Transport: "sse_message", Method: http.MethodPost, URL: base + "endpoints-streamable_http/message?key=<YOUR_TOKEN>"},
+			{Transport: "streamable_http", Method: http.MethodPost, URL: base + "endpoints-streamable_http/mcp?key=<YOUR_TOKEN>", Native: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &model.MCPService{Name: "endpoints-" + string(tt.svcType), DisplayName: "Endpoints", Type: tt.svcType, Command: "http://upstream.invalid/mcp"}
+			assert.NoError(t, model.CreateService(svc))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/mcp_services/%d/endpoints", svc.ID), nil))
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var resp struct {
+				Success bool `json:"success"`
+				Data    struct {
+					ServiceType    model.ServiceType `json:"service_type"`
+					KeyPlaceholder string            `json:"key_placeholder"`
+					Endpoints      []serviceEndpoint `json:"endpoints"`
+				} `json:"data"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.True(t, resp.Success)
+			assert.Equal(t, tt.svcType, resp.Data.ServiceType)
+			assert.Equal(t, "<YOUR_TOKEN>", resp.Data.KeyPlaceholder)
+			assert.Equal(t, tt.want, resp.Data.Endpoints)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/mcp_services/999999/endpoints", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
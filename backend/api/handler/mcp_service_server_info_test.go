@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMCPServiceServerInfo_ReturnsInitializeResult(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	var initializeCount atomic.Int32
+	hooks := &mcpserver.Hooks{}
+	hooks.AddAfterInitialize(func(ctx context.Context, id any, message *mcp.InitializeRequest, result *mcp.InitializeResult) {
+		initializeCount.Add(1)
+	})
+	upstream := mcpserver.NewMCPServer("info-upstream", "2.3.4",
+		mcpserver.WithToolCapabilities(true),
+		mcpserver.WithInstructions("query the info upstream"),
+		mcpserver.WithHooks(hooks),
+	)
+	upstream.AddTool(mcp.NewTool("noop"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	httpServer := httptest.NewServer(mcpserver.NewStreamableHTTPServer(upstream))
+	defer httpServer.Close()
+
+	svc := &model.MCPService{Name: "server-info-svc", DisplayName: "Server Info Svc", Type: model.ServiceTypeStreamableHTTP, Command: httpServer.URL + "/mcp", Enabled: true}
+	assert.NoError(t, model.CreateService(svc))
+	disabled := &model.MCPService{Name: "server-info-disabled", DisplayName: "Disabled", Type: model.ServiceTypeStreamableHTTP, Command: httpServer.URL + "/mcp"}
+	assert.NoError(t, model.CreateService(disabled))
+
+	// 使用独立的缓存键创建真实实例，避免与其他测试共用的服务 ID 冲突
+	var instances []*proxy.SharedMcpInstance
+	originalGetOrCreate := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, dbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSON string) (*proxy.SharedMcpInstance, error) {
+		inst, err := originalGetOrCreate(ctx, dbService, cacheKey+"-server-info-test", instanceNameDetail, effectiveEnvsJSON)
+		if inst != nil {
+			instances = append(instances, inst)
+		}
+		return inst, err
+	}
+	defer func() {
+		proxy.GetOrCreateSharedMcpInstanceWithKey = originalGetOrCreate
+		if len(instances) > 0 {
+			_ = instances[0].Shutdown(context.Background())
+		}
+	}()
+
+	r := gin.New()
+	r.GET("/api/mcp_services/:id/server_info", GetMCPServiceServerInfo)
+	get := func(id int64) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/mcp_services/%d/server_info", id), nil))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := get(svc.ID)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Success bool                 `json:"success"`
+			Data    mcp.InitializeResult `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.Success)
+		assert.Equal(t, mcp.LATEST_PROTOCOL_VERSION, resp.Data.ProtocolVersion)
+		assert.Equal(t, "info-upstream", resp.Data.ServerInfo.Name)
+		assert.Equal(t, "2.3.4", resp.Data.ServerInfo.Version)
+		assert.Equal(t, "query the info upstream", resp.Data.Instructions)
+		if assert.NotNil(t, resp.Data.Capabilities.Tools) {
+			assert.True(t, resp.Data.Capabilities.Tools.ListChanged)
+		}
+	}
+	// 第二次请求使用共享实例缓存的结果，不会再次握手
+	assert.Equal(t, int32(1), initializeCount.Load())
+	if assert.Len(t, instances, 2) {
+		assert.Same(t, instances[0], instances[1])
+	}
+
+	assert.Equal(t, http.StatusNotFound, get(disabled.ID).Code)
+	assert.Equal(t, http.StatusNotFound, get(99999).Code)
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricLabel is one Prometheus label pair; order is preserved in the output
+type metricLabel struct {
+	name  string
+	value string
+}
+
+// serviceMetricLabels derives the label set of a service from its row. Package labels are added unless the
+// MetricsPackageLabels option is "false"; user-level labels are never emitted to keep cardinality bounded.
+func serviceMetricLabels(svc *model.MCPService, withPackage bool) []metricLabel {
+	labels := []metricLabel{{"service_id", fmt.Sprint(svc.ID)}, {"service", svc.Name}}
+	if withPackage {
+		labels = append(labels,
+			metricLabel{"package_manager", svc.PackageManager},
+			metricLabel{"installed_version", svc.InstalledVersion},
+		)
+	}
+	return labels
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatMetricLabels(labels []metricLabel) string {
+	parts := make([]string, 0, len(labels))
+	for _, label := range labels {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, label.name, metricLabelEscaper.Replace(label.value)))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// GetPrometheusMetrics godoc
+// @Summary Prometheus 格式的服务指标
+// @Description 以 Prometheus 文本格式导出每个服务的启用状态、健康状态与调用数（调用数为进程内计数，重启后清零）
+// @Tags Analytics
+// @Produce plain
+// @Security ApiKeyAuth
+// @Success 200 {string} string "Prometheus text exposition format"
+// @Router /api/stats/metrics [get]
+func GetPrometheusMetrics(c *gin.Context) {
+	services, err := model.GetInstalledServices()
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, "failed to load services", err)
+		return
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].ID < services[j].ID })
+
+	live := make(map[int64]model.LiveServiceStats)
+	for _, stats := range model.GetLiveStats() {
+		live[stats.ServiceID] = stats
+	}
+	withPackage := common.GetMetricsPackageLabels()
+	healthCache := proxy.GetHealthCacheManager()
+
+	// 每个服务的标签只根据服务行计算一次
+	serviceLabels := make([]string, len(services))
+	for i, svc := range services {
+		serviceLabels[i] = formatMetricLabels(serviceMetricLabels(svc, withPackage))
+	}
+
+	families := []struct {
+		name, kind, help string
+		value            func(svc *model.MCPService) int64
+	}{
+		{"onemcp_service_enabled", "gauge", "Whether the service is enabled (1) or disabled (0).", func(svc *model.MCPService) int64 {
+			return boolMetric(svc.Enabled)
+		}},
+		{"onemcp_service_up", "gauge", "Whether the last health check reported the service healthy.", func(svc *model.MCPService) int64 {
+			health, ok := healthCache.GetServiceHealth(svc.ID)
+			return boolMetric(ok && health.Status == proxy.StatusHealthy)
+		}},
+		{"onemcp_service_tool_calls_total", "counter", "Tool calls proxied to the service since process start.", func(svc *model.MCPService) int64 {
+			return live[svc.ID].TotalCalls
+		}},
+		{"onemcp_service_tool_calls_last_minute", "gauge", "Tool calls proxied to the service in the last minute.", func(svc *model.MCPService) int64 {
+			return live[svc.ID].CallsLastMin
+		}},
+		{"onemcp_service_sse_slow_client_drops_total", "counter", "SSE clients disconnected for falling behind the event buffer since process start.", func(svc *model.MCPService) int64 {
+			return sseSlowClientDropCount(svc.ID)
+		}},
+	}
+
+	var b strings.Builder
+	for _, family := range families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.kind)
+		for i, svc := range services {
+			fmt.Fprintf(&b, "%s%s %d\n", family.name, serviceLabels[i], family.value(svc))
+		}
+	}
+	// 进程级指标，不区分服务
+	fmt.Fprintf(&b, "# HELP onemcp_write_retry_pending Failed stat and log writes waiting to be retried.\n# TYPE onemcp_write_retry_pending gauge\nonemcp_write_retry_pending %d\n", model.PendingWriteCount())
+	fmt.Fprintf(&b, "# HELP onemcp_write_retry_dropped_total Stat and log writes dropped because the retry queue was full or every retry failed.\n# TYPE onemcp_write_retry_dropped_total counter\nonemcp_write_retry_dropped_total %d\n", model.DroppedWriteCount())
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+func boolMetric(v bool) int64 {
+	if v {
+		return 1
+	}
+	return 0
+}
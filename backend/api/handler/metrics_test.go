@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPrometheusMetricsPackageLabels(t *testing.T) {
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+	model.ResetLiveStats()
+	defer model.ResetLiveStats()
+
+	svc := &model.MCPService{
+		Name:              "fetch",
+		DisplayName:       "Fetch",
+		Type:              model.ServiceTypeStdio,
+		Enabled:           true,
+		PackageManager:    "npm",
+		SourcePackageName: "@modelcontextprotocol/server-fetch",
+		InstalledVersion:  "1.2.3",
+	}
+	assert.NoError(t, model.CreateService(svc))
+	proxy.GetHealthCacheManager().SetServiceHealth(svc.ID, &proxy.ServiceHealth{Status: proxy.StatusHealthy})
+	defer proxy.GetHealthCacheManager().DeleteServiceHealth(svc.ID)
+	model.RecordLiveCall(svc.ID, svc.Name)
+	model.RecordLiveCall(svc.ID, svc.Name)
+
+	tests := []struct {
+		name       string
+		option     string
+		wantLabels string
+	}{
+		// 未配置时默认带包标签
+		{"package labels by default", "", fmt.Sprintf(`{service_id="%d",service="fetch",package_manager="npm",installed_version="1.2.3"}`, svc.ID)},
+		{"package labels enabled", "true", fmt.Sprintf(`{service_id="%d",service="fetch",package_manager="npm",installed_version="1.2.3"}`, svc.ID)},
+		{"package labels disabled", "false", fmt.Sprintf(`{service_id="%d",service="fetch"}`, svc.ID)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.OptionMapRWMutex.Lock()
+			if tt.option == "" {
+				delete(common.OptionMap, common.OptionMetricsPackageLabels)
+			} else {
+				common.OptionMap[common.OptionMetricsPackageLabels] = tt.option
+			}
+			common.OptionMapRWMutex.Unlock()
+			defer func() {
+				common.OptionMapRWMutex.Lock()
+				delete(common.OptionMap, common.OptionMetricsPackageLabels)
+				common.OptionMapRWMutex.Unlock()
+			}()
+
+			router := gin.New()
+			router.GET("/api/stats/metrics", GetPrometheusMetrics)
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/stats/metrics", nil)
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+			body := recorder.Body.String()
+			assert.Contains(t, body, "# TYPE onemcp_service_tool_calls_total counter")
+			assert.Contains(t, body, "onemcp_service_up"+tt.wantLabels+" 1\n")
+			assert.Contains(t, body, "onemcp_service_enabled"+tt.wantLabels+" 1\n")
+			assert.Contains(t, body, "onemcp_service_tool_calls_total"+tt.wantLabels+" 2\n")
+			assert.NotContains(t, body, "user")
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"one-mcp/backend/common"
+	"one-mcp/backend/library/market"
 	"one-mcp/backend/model"
 
 	"github.com/gin-gonic/gin"
@@ -42,6 +43,33 @@ func GetStatus(c *gin.Context) {
 	return
 }
 
+// packageManagerAvailability is mockable in tests
+var packageManagerAvailability = market.GetPackageManagerAvailability
+
+// GetMeta 返回实例元数据（版本、可用功能、注册/登录开关、MOTD），供前端和 CLI 工具适配
+func GetMeta(c *gin.Context) {
+	availability := packageManagerAvailability()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"version":     common.Version,
+			"start_time":  common.StartTime,
+			"system_name": common.GetSystemName(),
+			"motd":        common.GetMOTD(),
+			"features": gin.H{
+				"package_managers":  availability,
+				"register_enabled":  common.GetRegisterEnabled(),
+				"password_login":    common.PasswordLoginEnabled,
+				"password_register": common.PasswordRegisterEnabled,
+				"github_oauth":      common.GetGitHubOAuthEnabled(),
+				"google_oauth":      common.GetGoogleOAuthEnabled(),
+				"wechat_login":      common.GetWeChatAuthEnabled(),
+			},
+		},
+	})
+}
+
 func GetNotice(c *gin.Context) {
 	common.OptionMapRWMutex.RLock()
 	defer common.OptionMapRWMutex.RUnlock()
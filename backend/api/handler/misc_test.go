@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/market"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMeta(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalAvailability := packageManagerAvailability
+	originalOptions := common.OptionMap
+	originalVersion := common.Version
+	defer func() {
+		packageManagerAvailability = originalAvailability
+		common.OptionMap = originalOptions
+		common.Version = originalVersion
+	}()
+	common.Version = "v9.9.9"
+
+	tests := []struct {
+		name         string
+		options      map[string]string
+		availability market.PackageManagerAvailability
+	}{
+		{
+			name:         "registration open with npx only",
+			options:      map[string]string{"RegisterEnabled": "true", "GitHubOAuthEnabled": "true", common.OptionMOTD: "Maintenance at 22:00"},
+			availability: market.PackageManagerAvailability{NPX: true},
+		},
+		{
+			name:         "registration closed with both package managers",
+			options:      map[string]string{"RegisterEnabled": "false"},
+			availability: market.PackageManagerAvailability{NPX: true, UVX: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.OptionMap = tt.options
+			packageManagerAvailability = func() market.PackageManagerAvailability { return tt.availability }
+
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request, _ = http.NewRequest(http.MethodGet, "/api/meta", nil)
+			GetMeta(ctx)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var meta struct {
+				Version  string `json:"version"`
+				MOTD     string `json:"motd"`
+				Features struct {
+					PackageManagers market.PackageManagerAvailability `json:"package_managers"`
+					RegisterEnabled bool                              `json:"register_enabled"`
+					GitHubOAuth     bool                              `json:"github_oauth"`
+				} `json:"features"`
+			}
+			assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &meta))
+			assert.Equal(t, "v9.9.9", meta.Version)
+			assert.Equal(t, tt.options[common.OptionMOTD], meta.MOTD)
+			assert.Equal(t, tt.availability, meta.Features.PackageManagers)
+			assert.Equal(t, tt.options["RegisterEnabled"] == "true", meta.Features.RegisterEnabled)
+			assert.Equal(t, tt.options["GitHubOAuthEnabled"] == "true", meta.Features.GitHubOAuth)
+		})
+	}
+}
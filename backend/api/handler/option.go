@@ -1,12 +1,17 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"one-mcp/backend/common"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 	"one-mcp/backend/service"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -42,6 +47,7 @@ func UpdateOption(c *gin.Context) {
 	switch option.Key {
 	case "ServerAddress":
 		proxy.ClearSSEProxyCache()
+		proxy.ClearHTTPProxyCache()
 	case "GitHubOAuthEnabled":
 		if option.Value == "true" && common.GetGitHubClientId() == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -82,6 +88,124 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case common.OptionUVXPythonVersion:
+		if err := model.ValidatePythonVersion(option.Value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case common.OptionUpstreamErrorRestartThreshold:
+		if value, err := strconv.Atoi(strings.TrimSpace(option.Value)); err != nil || value < 0 || value > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid upstream error restart threshold, expected a percentage between 0 and 100",
+			})
+			return
+		}
+	case common.OptionToolDescriptionMaxLength:
+		if value, err := strconv.Atoi(strings.TrimSpace(option.Value)); err != nil || value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid tool description max length, expected a non-negative integer",
+			})
+			return
+		}
+	case common.OptionWriteRetryQueueSize:
+		if value, err := strconv.Atoi(strings.TrimSpace(option.Value)); err != nil || value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid write retry queue size, expected a non-negative integer",
+			})
+			return
+		}
+	case common.OptionWriteRetryMaxAttempts:
+		if value, err := strconv.Atoi(strings.TrimSpace(option.Value)); err != nil || value < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid write retry max attempts, expected a positive integer",
+			})
+			return
+		}
+	case common.OptionMCPRequestBodyMaxSize:
+		if value, err := strconv.ParseInt(strings.TrimSpace(option.Value), 10, 64); err != nil || value < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid MCP request body max size, expected a positive number of bytes",
+			})
+			return
+		}
+	case common.OptionGroupToolsFetchConcurrency:
+		if value, err := strconv.Atoi(strings.TrimSpace(option.Value)); err != nil || value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid group tools fetch concurrency, expected a non-negative integer",
+			})
+			return
+		}
+	case common.OptionGroupToolsFetchTimeout:
+		if _, ok := common.ParsePositiveDuration(option.Value); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid group tools fetch timeout, expected a positive duration (e.g. \"10s\") or number of seconds",
+			})
+			return
+		}
+	case common.OptionMaxUserInstancesPerService:
+		if value, err := strconv.Atoi(strings.TrimSpace(option.Value)); err != nil || value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid max user instances per service, expected a non-negative integer",
+			})
+			return
+		}
+	case common.OptionGroupToolNameCollisions:
+		switch strings.TrimSpace(option.Value) {
+		case common.GroupToolNameCollisionsWarn, common.GroupToolNameCollisionsReject, common.GroupToolNameCollisionsOff:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid group tool name collision policy, only 'warn', 'reject' or 'off' are supported",
+			})
+			return
+		}
+	case common.OptionProxyKillSwitch:
+		if _, err := strconv.ParseBool(strings.TrimSpace(option.Value)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid proxy kill-switch value, only 'true' or 'false' are supported",
+			})
+			return
+		}
+	case common.OptionExecuteArgsStrictness:
+		switch strings.TrimSpace(option.Value) {
+		case common.ExecuteArgsLenient, common.ExecuteArgsWarn, common.ExecuteArgsStrict:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid execute_tool arguments strictness, only 'lenient', 'warn' or 'strict' are supported",
+			})
+			return
+		}
+	case common.OptionMaintenanceWindow:
+		if strings.TrimSpace(option.Value) != "" {
+			if _, _, err := common.ParseMaintenanceWindow(option.Value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+	case common.OptionUVXIndexURL:
+		if err := model.ValidateIndexURL(option.Value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 	err = service.UpdateOption(option.Key, option.Value)
 	if err != nil {
@@ -91,9 +215,70 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	if option.Key == common.OptionProxyKillSwitch {
+		logProxyKillSwitchToggle(c)
+	}
+	if option.Key == common.OptionActiveEnvironment {
+		environment := common.GetActiveEnvironment()
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			restarted := proxy.GetServiceManager().RestartEnvironmentProfiledServices(ctx)
+			common.SysLog(fmt.Sprintf("Active environment switched to %q, restarted %d service(s) with environment profiles", environment, restarted))
+		}()
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 	})
 	return
 }
+
+// logProxyKillSwitchToggle records who engaged or released the proxy kill-switch
+func logProxyKillSwitchToggle(c *gin.Context) {
+	state := "released"
+	if common.GetProxyKillSwitch() {
+		state = "engaged"
+	}
+	common.SysLog(fmt.Sprintf("[KillSwitch] proxy kill-switch %s by %s (ID: %d)", state, c.GetString("username"), c.GetInt64("user_id")))
+}
+
+// GetProxyKillSwitch reports whether the proxy kill-switch is engaged. Unlike the options API it is open to admins.
+func GetProxyKillSwitch(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    gin.H{"enabled": common.GetProxyKillSwitch()},
+	})
+}
+
+// proxyKillSwitchRequest is the body of SetProxyKillSwitch
+type proxyKillSwitchRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// SetProxyKillSwitch engages or releases the proxy kill-switch, so admins can stop proxying during an incident
+// without root access to the other options.
+func SetProxyKillSwitch(c *gin.Context) {
+	var req proxyKillSwitchRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request, expected {\"enabled\": true|false}",
+		})
+		return
+	}
+	if err := service.UpdateOption(common.OptionProxyKillSwitch, strconv.FormatBool(*req.Enabled)); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	logProxyKillSwitchToggle(c)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    gin.H{"enabled": common.GetProxyKillSwitch()},
+	})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader carries a client-provided request ID into the access log and the upstream tool calls
+const requestIDHeader = proxy.CorrelationHeader
+
+// maxRequestIDLength bounds a client-provided request ID, longer ones are replaced by a generated ID
+const maxRequestIDLength = 128
+
+// ensureRequestID returns the request ID of a proxy request, generating one when the client sent none or an
+// unusable one. The ID is echoed in the response so clients can quote it.
+func ensureRequestID(c *gin.Context) string {
+	requestID := strings.TrimSpace(c.Request.Header.Get(requestIDHeader))
+	if requestID == "" || len(requestID) > maxRequestIDLength || strings.ContainsFunc(requestID, unicode.IsControl) {
+		requestID = common.GetUUID()
+	}
+	c.Request.Header.Set(requestIDHeader, requestID)
+	c.Header(requestIDHeader, requestID)
+	return requestID
+}
+
+// proxyAccessLogEntry holds the fields available to the proxy access log formats
+type proxyAccessLogEntry struct {
+	UserID     int64  `json:"user"`
+	Service    string `json:"service"`
+	Type       string `json:"type"`
+	Action     string `json:"action"`
+	Path       string `json:"path"`
+	DurationMs int64  `json:"duration_ms"`
+	Status     int    `json:"status"`
+	Client     string `json:"client"`
+	Tool       string `json:"tool,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// formatProxyAccessLog renders entry according to format (see common.OptionProxyAccessLogFormat)
+func formatProxyAccessLog(format string, entry proxyAccessLogEntry) string {
+	switch format {
+	case "", common.ProxyAccessLogFormatText:
+		msg := fmt.Sprintf("MCP request OK | user=%d | type=%s | action=%s | path=%s | duration=%dms | status=%d | client=%s",
+			entry.UserID, entry.Type, entry.Action, entry.Path, entry.DurationMs, entry.Status, entry.Client)
+		if entry.Tool != "" {
+			msg += " | tool=" + entry.Tool
+		}
+		if entry.RequestID != "" {
+			msg += " | request_id=" + entry.RequestID
+		}
+		return msg
+	case common.ProxyAccessLogFormatJSON:
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return formatProxyAccessLog(common.ProxyAccessLogFormatText, entry)
+		}
+		return string(data)
+	default:
+		return strings.NewReplacer(
+			"{user}", strconv.FormatInt(entry.UserID, 10),
+			"{service}", entry.Service,
+			"{type}", entry.Type,
+			"{action}", entry.Action,
+			"{path}", entry.Path,
+			"{duration_ms}", strconv.FormatInt(entry.DurationMs, 10),
+			"{status}", strconv.Itoa(entry.Status),
+			"{client}", entry.Client,
+			"{tool}", entry.Tool,
+			"{request_id}", entry.RequestID,
+		).Replace(format)
+	}
+}
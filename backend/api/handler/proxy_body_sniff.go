@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+
+	"one-mcp/backend/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bodySniffBufferPool recycles the buffers holding sniffed body prefixes, so sniffing does not
+// allocate a limit-sized slice on every proxied request.
+var bodySniffBufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// sniffedBody replays the sniffed prefix followed by the untouched remainder of the original body.
+// The prefix buffer goes back to the pool once it has been replayed or the body is closed.
+type sniffedBody struct {
+	mu     sync.Mutex
+	prefix *bytes.Buffer // nil once released
+	body   io.ReadCloser
+}
+
+func (b *sniffedBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.prefix != nil {
+		if b.prefix.Len() > 0 {
+			n, _ := b.prefix.Read(p)
+			if b.prefix.Len() == 0 {
+				b.releaseLocked()
+			}
+			b.mu.Unlock()
+			return n, nil
+		}
+		b.releaseLocked()
+	}
+	b.mu.Unlock()
+	return b.body.Read(p)
+}
+
+func (b *sniffedBody) Close() error {
+	b.mu.Lock()
+	b.releaseLocked()
+	b.mu.Unlock()
+	return b.body.Close()
+}
+
+func (b *sniffedBody) releaseLocked() {
+	if b.prefix == nil {
+		return
+	}
+	b.prefix.Reset()
+	bodySniffBufferPool.Put(b.prefix)
+	b.prefix = nil
+}
+
+// sniffedJSONRPC holds the JSON-RPC fields found in the sniffed prefix of a request body.
+type sniffedJSONRPC struct {
+	Method   string
+	ToolName string
+}
+
+// sniffJSONRPCRequest reads at most limit bytes from body to extract the JSON-RPC "method"
+// and, for tools/call, "params.name". It never buffers more than limit bytes: the returned
+// ReadCloser yields the sniffed prefix and then streams the rest of the original body.
+// Fields not found within the prefix are left empty.
+func sniffJSONRPCRequest(body io.ReadCloser, limit int) (sniffed sniffedJSONRPC, restored io.ReadCloser, err error) {
+	prefix := bodySniffBufferPool.Get().(*bytes.Buffer)
+	_, readErr := prefix.ReadFrom(io.LimitReader(body, int64(limit)))
+	// The scanned strings are copies, so they stay valid after the buffer is recycled
+	sniffed = scanJSONRPCFields(prefix.Bytes())
+	restored = &sniffedBody{prefix: prefix, body: body}
+	if readErr != nil {
+		return sniffedJSONRPC{}, restored, readErr
+	}
+	return sniffed, restored, nil
+}
+
+// scanJSONRPCFields walks the top-level object of a (possibly truncated) JSON document
+// and returns the "method" and "params" fields seen before the data runs out.
+func scanJSONRPCFields(data []byte) (sniffed sniffedJSONRPC) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return sniffed
+	}
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return sniffed
+		}
+		key, _ := keyTok.(string)
+		switch key {
+		case "method":
+			tok, err := dec.Token()
+			if err != nil {
+				return sniffed
+			}
+			sniffed.Method, _ = tok.(string)
+		case "params":
+			if !scanParams(dec, &sniffed) {
+				return sniffed
+			}
+		default:
+			if !skipJSONValue(dec) {
+				return sniffed
+			}
+		}
+	}
+	return sniffed
+}
+
+// scanParams consumes the "params" value and records its "name" field if it is an object.
+func scanParams(dec *json.Decoder, sniffed *sniffedJSONRPC) bool {
+	tok, err := dec.Token()
+	if err != nil {
+		return false
+	}
+	if tok != json.Delim('{') {
+		if delim, isDelim := tok.(json.Delim); isDelim {
+			return skipJSONContainer(dec, delim)
+		}
+		return true
+	}
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch keyTok {
+		case "name":
+			valTok, err := dec.Token()
+			if err != nil {
+				return false
+			}
+			if s, ok := valTok.(string); ok {
+				sniffed.ToolName = s
+			} else if delim, isDelim := valTok.(json.Delim); isDelim && !skipJSONContainer(dec, delim) {
+				return false
+			}
+		default:
+			if !skipJSONValue(dec) {
+				return false
+			}
+		}
+	}
+	// closing '}'
+	if _, err := dec.Token(); err != nil {
+		return false
+	}
+	return true
+}
+
+// skipJSONValue consumes the next value token by token, so a truncated value simply fails
+// instead of being buffered as a whole.
+func skipJSONValue(dec *json.Decoder) bool {
+	tok, err := dec.Token()
+	if err != nil {
+		return false
+	}
+	if delim, ok := tok.(json.Delim); ok {
+		return skipJSONContainer(dec, delim)
+	}
+	return true
+}
+
+func skipJSONContainer(dec *json.Decoder, open json.Delim) bool {
+	if open != '{' && open != '[' {
+		return true
+	}
+	depth := 1
+	for depth > 0 {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+		}
+	}
+	return true
+}
+
+// normalizeJSONRequestBody makes MCP POST endpoints tolerant of clients that send JSON with a wrong
+// or missing Content-Type (e.g. text/plain): the body is checked to be JSON and the header is rewritten
+// to application/json before the request reaches the MCP server. A body that is not JSON gets a
+// JSON-RPC parse error and false is returned; a body larger than MCPRequestBodyMaxSize is rejected
+// with 413 before it is fully read.
+func normalizeJSONRequestBody(c *gin.Context) bool {
+	if c.Request.Method != http.MethodPost {
+		return true
+	}
+	if mediaType, _, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type")); err == nil && mediaType == "application/json" {
+		return true
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		maxSize := common.GetMCPRequestBodyMaxSize()
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSize+1))
+		_ = c.Request.Body.Close()
+		if err != nil {
+			common.RespJSONRPCError(c, http.StatusBadRequest, common.JSONRPCErrorCodeParseError, fmt.Sprintf("Failed to read request body: %v", err))
+			return false
+		}
+		if int64(len(data)) > maxSize {
+			common.RespJSONRPCError(c, http.StatusRequestEntityTooLarge, common.JSONRPCErrorCodeInvalidRequest,
+				fmt.Sprintf("Request body exceeds %d bytes; send it with Content-Type: application/json", maxSize))
+			return false
+		}
+		body = data
+	}
+	if !json.Valid(body) {
+		declared := c.Request.Header.Get("Content-Type")
+		if declared == "" {
+			declared = "none"
+		}
+		common.RespJSONRPCError(c, http.StatusBadRequest, common.JSONRPCErrorCodeParseError,
+			fmt.Sprintf("Request body is not valid JSON (Content-Type: %s); MCP requests must be JSON-RPC 2.0 messages", declared))
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return true
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProxyHandlerCaches godoc
+// @Summary 查看代理 handler 缓存
+// @Description 返回当前缓存了 SSE / HTTP 代理 handler 的服务 ID 列表
+// @Tags Admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse{data=proxy.ProxyHandlerCacheInfo}
+// @Router /api/admin/caches [get]
+func GetProxyHandlerCaches(c *gin.Context) {
+	common.RespSuccess(c, proxy.GetProxyHandlerCacheInfo())
+}
+
+// ClearProxyHandlerCaches godoc
+// @Summary 清理代理 handler 缓存
+// @Description 清理缓存的 SSE 和 HTTP 代理 handler（可通过 service_id 限定单个服务），适用于 ServerAddress 或模板变更后
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param service_id query int false "仅清理该服务的缓存"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Router /api/admin/caches/clear [post]
+func ClearProxyHandlerCaches(c *gin.Context) {
+	lang := c.GetString("lang")
+	var requestBody struct {
+		ServiceID int64 `json:"service_id"`
+	}
+	if c.Request.Body != nil {
+		if err := c.ShouldBindJSON(&requestBody); err != nil && !errors.Is(err, io.EOF) {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+			return
+		}
+	}
+	serviceID := requestBody.ServiceID
+	if raw := c.Query("service_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang))
+			return
+		}
+		serviceID = id
+	}
+
+	sseCleared, httpCleared := proxy.ClearProxyHandlerCaches(serviceID)
+	common.RespSuccess(c, gin.H{
+		"service_id":   serviceID,
+		"sse_cleared":  sseCleared,
+		"http_cleared": httpCleared,
+	})
+}
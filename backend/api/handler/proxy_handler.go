@@ -1,17 +1,18 @@
 package handler
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"maps"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"one-mcp/backend/common"
+	"one-mcp/backend/library/market"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 
@@ -44,7 +45,7 @@ func parseInt64(value interface{}) (int64, error) {
 }
 
 // checkDailyRequestLimit checks if the user has exceeded their daily request limit for the service
-func checkDailyRequestLimit(serviceID int64, userID int64, rpdLimit int) error {
+func checkDailyRequestLimit(serviceID int64, userID int64, limitTokenID string, rpdLimit int) error {
 	// If RPD limit is 0, no limit is enforced
 	if rpdLimit <= 0 {
 		return nil
@@ -59,8 +60,8 @@ func checkDailyRequestLimit(serviceID int64, userID int64, rpdLimit int) error {
 	}
 
 	today := time.Now().Format("2006-01-02")
-	// Use a different cache key for user-specific request counts (different from global service counts)
-	cacheKey := fmt.Sprintf("user_request:%s:%d:%d:count", today, serviceID, userID)
+	// Use a different cache key for user- or token-specific request counts (different from global service counts)
+	cacheKey := model.RequestCounterKey(today, serviceID, userID, limitTokenID)
 
 	ctx := context.Background()
 	countStr, err := cacheClient.Get(ctx, cacheKey)
@@ -83,31 +84,102 @@ func checkDailyRequestLimit(serviceID int64, userID int64, rpdLimit int) error {
 	return nil
 }
 
-// tryGetOrCreateUserSpecificHandler attempts to find or create a handler tailored for a specific user.
-// proxyType should be "sseproxy" or "httpproxy"
-func tryGetOrCreateUserSpecificHandler(c *gin.Context, mcpDBService *model.MCPService, userID int64, proxyType string) (http.Handler, error) {
+// envProfileHeader selects a named env profile of the user's config for this request
+const envProfileHeader = "X-MCP-Env-Profile"
 
-	// Prepare user-specific environment variables
-	currentEnvMap := make(map[string]string)
-	// Populate currentEnvMap from DefaultEnvsJSON first
-	if mcpDBService.DefaultEnvsJSON != "" && mcpDBService.DefaultEnvsJSON != "{}" {
-		if err := json.Unmarshal([]byte(mcpDBService.DefaultEnvsJSON), &currentEnvMap); err != nil {
-			common.SysError(fmt.Sprintf("[ProxyHandler] Error unmarshalling DefaultEnvsJSON for %s (user-specific): %v", mcpDBService.Name, err))
-			currentEnvMap = make(map[string]string)
+// resolveEnvProfile picks the env profile for a request: the header (or "profile" query parameter)
+// wins, otherwise the profile bound to the user's token, otherwise the default profile. Proxy requests
+// carry the bound profile from TokenAuth; other callers (e.g. JWT API routes) look the user up.
+func resolveEnvProfile(c *gin.Context, userID int64) string {
+	requested := c.GetHeader(envProfileHeader)
+	if requested == "" {
+		requested = c.Query("profile")
+	}
+	if requested == "" {
+		if bound, ok := c.Get("env_profile"); ok {
+			requested, _ = bound.(string)
+		} else if user, err := model.GetUserById(userID, false); err == nil {
+			requested = user.EnvProfile
+		}
+	}
+	profile, ok := model.NormalizeEnvProfileName(requested)
+	if !ok {
+		common.SysLog(fmt.Sprintf("WARN: [ProxyHandler] Ignoring invalid env profile %q for user %d", requested, userID))
+		return model.DefaultEnvProfile
+	}
+	return profile
+}
+
+// deprecationNoticeHeader carries the deprecation message of a deprecated service on proxied responses
+const deprecationNoticeHeader = "X-MCP-Deprecation-Notice"
+
+// setDeprecationHeaders marks responses of a deprecated service: "Deprecation: true", the notice, and a
+// successor-version Link when a replacement service is suggested. The request itself is proxied as usual.
+func setDeprecationHeaders(c *gin.Context, svc *model.MCPService) {
+	notice := svc.DeprecationNotice()
+	if notice == "" {
+		return
+	}
+	c.Header("Deprecation", "true")
+	c.Header(deprecationNoticeHeader, strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
 		}
+		return r
+	}, notice))
+	if svc.ReplacedBy != "" {
+		c.Header("Link", fmt.Sprintf("</proxy/%s/mcp>; rel=\"successor-version\"", url.PathEscape(svc.ReplacedBy)))
 	}
+}
 
-	// Fetch and merge user-specific ENVs
-	userEnvs, userEnvErr := model.GetUserSpecificEnvs(userID, mcpDBService.ID)
-	if userEnvErr != nil {
-		common.SysError(fmt.Sprintf("[ProxyHandler] Error fetching user-specific ENVs for user %d, service %s: %v", userID, mcpDBService.Name, userEnvErr))
+// setResponseHeaders adds the static response headers configured for the service. They are set before the
+// request is delegated, so headers the MCP transport writes itself still take precedence.
+func setResponseHeaders(c *gin.Context, svc *model.MCPService) {
+	if err := svc.ValidateResponseHeaders(); err != nil {
+		common.SysError(fmt.Sprintf("[ProxyHandler] Ignoring invalid response headers of %s: %v", svc.Name, err))
+		return
 	}
+	headers, _ := svc.ResponseHeaders()
+	for name, value := range headers {
+		c.Header(name, value)
+	}
+}
 
-	if len(userEnvs) > 0 {
-		for k, v := range userEnvs {
-			currentEnvMap[k] = v // User-specific ENVs override DefaultEnvsJSON
+// userServiceEnvs returns the service defaults, the user's values for the profile (default profile merged
+// with the selected one) and the merged env that a user-specific instance is started with.
+func userServiceEnvs(mcpDBService *model.MCPService, userID int64, profile string) (defaults, userEnvs, merged map[string]string) {
+	defaults = make(map[string]string)
+	if envsJSON := mcpDBService.ActiveDefaultEnvsJSON(); envsJSON != "" && envsJSON != "{}" {
+		if err := json.Unmarshal([]byte(envsJSON), &defaults); err != nil {
+			common.SysError(fmt.Sprintf("[ProxyHandler] Error unmarshalling DefaultEnvsJSON for %s (user-specific): %v", mcpDBService.Name, err))
+			defaults = make(map[string]string)
 		}
 	}
+	// Populate merged from DefaultEnvsJSON first
+	merged = maps.Clone(defaults)
+
+	// Fetch and merge user-specific ENVs (default profile + selected profile)
+	userEnvs, err := model.GetUserProfileEnvs(userID, mcpDBService.ID, profile)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[ProxyHandler] Error fetching user-specific ENVs for user %d, service %s, profile %q: %v", userID, mcpDBService.Name, profile, err))
+	}
+	for k, v := range userEnvs {
+		merged[k] = v // User-specific ENVs override DefaultEnvsJSON
+	}
+	return defaults, userEnvs, merged
+}
+
+// tryGetOrCreateUserSpecificHandler attempts to find or create a handler tailored for a specific user.
+// proxyType should be "sseproxy" or "httpproxy"
+func tryGetOrCreateUserSpecificHandler(c *gin.Context, mcpDBService *model.MCPService, userID int64, proxyType string) (http.Handler, error) {
+	profile := resolveEnvProfile(c, userID)
+
+	defaultEnvMap, _, currentEnvMap := userServiceEnvs(mcpDBService, userID, profile)
+
+	// 用户没有实际覆盖任何值时复用全局实例，避免为每个用户多启动一个子进程
+	if common.GetReuseGlobalUserInstances() && maps.Equal(currentEnvMap, defaultEnvMap) {
+		return tryGetOrCreateGlobalHandler(c, mcpDBService, proxyType)
+	}
 
 	// Marshal the merged env map back to JSON
 	mergedEnvsJSONBytes, marshalErr := json.Marshal(currentEnvMap)
@@ -119,8 +191,13 @@ func tryGetOrCreateUserSpecificHandler(c *gin.Context, mcpDBService *model.MCPSe
 
 	// Create user-specific shared MCP instance
 	ctx := c.Request.Context()
-	userSharedCacheKey := fmt.Sprintf("user-%d-service-%d-shared", userID, mcpDBService.ID)
+	userSharedCacheKey := proxy.UserServiceCacheKey(userID, mcpDBService.ID)
 	instanceNameDetail := fmt.Sprintf("user-%d-shared-svc-%d", userID, mcpDBService.ID)
+	if profile != model.DefaultEnvProfile {
+		// 每个 profile 使用独立实例，避免不同配置共享同一子进程
+		userSharedCacheKey += "-profile-" + profile
+		instanceNameDetail += "-profile-" + profile
+	}
 
 	sharedInst, err := proxy.GetOrCreateSharedMcpInstanceWithKey(ctx, mcpDBService, userSharedCacheKey, instanceNameDetail, mergedEnvsJSON)
 	if err != nil {
@@ -158,7 +235,12 @@ func tryGetOrCreateUserSpecificHandler(c *gin.Context, mcpDBService *model.MCPSe
 		return nil, fmt.Errorf("unsupported proxy type for user-specific handler: %s", proxyType)
 	}
 
-	return targetHandler, nil
+	// 请求进行期间实例不会因 MaxUserInstancesPerService 上限被淘汰
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done := sharedInst.BeginUse()
+		defer done()
+		targetHandler.ServeHTTP(w, r)
+	}), nil
 }
 
 // tryGetOrCreateGlobalHandler attempts to find or create a global handler for the service.
@@ -210,6 +292,16 @@ func tryGetOrCreateGlobalHandler(c *gin.Context, mcpDBService *model.MCPService,
 	return targetHandler, nil
 }
 
+// installTaskInProgress reports whether a market install task is running for the service; replaceable in tests
+var installTaskInProgress = func(serviceID int64) bool {
+	return market.GetInstallationManager().IsInstalling(serviceID)
+}
+
+// isServiceInstalling reports whether the service is still inside its market install window
+func isServiceInstalling(svc *model.MCPService) bool {
+	return svc.InstalledVersion == "installing" || installTaskInProgress(svc.ID)
+}
+
 // ProxyHandler handles GET and POST /proxy/:serviceName/*action
 func ProxyHandler(c *gin.Context) {
 	serviceName := c.Param("serviceName")
@@ -228,11 +320,25 @@ func ProxyHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Service not found: " + serviceName})
 		return
 	}
+	if isServiceInstalling(mcpDBService) {
+		// 安装窗口内给客户端明确的可重试信号，而不是当作不可用服务
+		retryAfter := common.GetInstallingRetryAfter()
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success":     false,
+			"message":     fmt.Sprintf("Service %s is installing, try again in %d seconds", serviceName, retryAfter),
+			"error_code":  "SERVICE_INSTALLING",
+			"retry_after": retryAfter,
+		})
+		return
+	}
 	if !mcpDBService.Enabled {
 		common.SysLog(fmt.Sprintf("WARN: [ProxyHandler] Service not enabled: %s", serviceName))
 		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "message": "Service not enabled: " + serviceName})
 		return
 	}
+	setDeprecationHeaders(c, mcpDBService)
+	setResponseHeaders(c, mcpDBService)
 
 	var serviceManager *proxy.ServiceManager
 	var targetHandler http.Handler
@@ -258,9 +364,15 @@ func ProxyHandler(c *gin.Context) {
 		return
 	}
 
+	// Tool calls of this request are queued fairly with those of other users when the instance is busy,
+	// and carry the request ID upstream for log correlation
+	requestCtx := proxy.WithToolCallCaller(c.Request.Context(), strconv.FormatInt(userID, 10))
+	c.Request = c.Request.WithContext(proxy.WithRequestID(requestCtx, ensureRequestID(c)))
+
 	// Check daily request limit (RPD) if user is authenticated and limit is set
+	limitTokenID := mcpDBService.LimitTokenID(c.GetString("token_id"))
 	if userID > 0 && mcpDBService.RPDLimit > 0 {
-		if rpdErr := checkDailyRequestLimit(mcpDBService.ID, userID, mcpDBService.RPDLimit); rpdErr != nil {
+		if rpdErr := checkDailyRequestLimit(mcpDBService.ID, userID, limitTokenID, mcpDBService.RPDLimit); rpdErr != nil {
 			common.SysLog(fmt.Sprintf("[RPD] User %d exceeded limit for %s: %v", userID, serviceName, rpdErr))
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"success":    false,
@@ -340,47 +452,54 @@ func ProxyHandler(c *gin.Context) {
 	}
 
 	if targetHandler != nil {
+		if (action == "/message" || action == "/mcp") && !normalizeJSONRequestBody(c) {
+			return
+		}
 
 		// Unified logic for determining if this request should be recorded for statistics
 		shouldRecordStat := false
 		requestTypeForStat := ""
 		methodForStat := ""
+		toolNameForLog := ""
 		// Capture client name
 		clientName := c.Request.Header.Get("User-Agent")
 
 		if requestMethod == http.MethodPost {
 			if action == "/message" || action == "/mcp" {
-				if c.Request.Body != nil {
-					// Read the entire request body to inspect it.
-					bodyBytes, err := io.ReadAll(c.Request.Body)
+				if c.Request.Body != nil && c.Request.Body != http.NoBody {
+					// Sniff only a bounded prefix of the body; the rest is streamed through untouched.
+					sniffed, restoredBody, err := sniffJSONRPCRequest(c.Request.Body, common.GetProxyBodySniffLimit())
 					if err != nil {
 						common.SysError(fmt.Sprintf("[ProxyHandler] failed to read request body for stat check: %v", err))
 					}
-					// Always restore body
-					c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-					// Parse body: detect tools/call and extract client name if present
-					if err == nil && len(bodyBytes) > 0 {
-						var parsedBody map[string]interface{}
-						if json.Unmarshal(bodyBytes, &parsedBody) == nil {
-							if actualMethod, ok := parsedBody["method"].(string); ok && actualMethod == "tools/call" {
-								shouldRecordStat = true
-								methodForStat = "tools/call"
-								if action == "/message" {
-									requestTypeForStat = "sse"
-								} else {
-									requestTypeForStat = "http"
-								}
-							}
+					c.Request.Body = restoredBody
+
+					if err == nil && sniffed.Method == "tools/call" {
+						shouldRecordStat = true
+						methodForStat = "tools/call"
+						toolNameForLog = sniffed.ToolName
+						if action == "/message" {
+							requestTypeForStat = "sse"
+						} else {
+							requestTypeForStat = "http"
 						}
 					}
 				}
 			}
 		}
 
+		if shouldRecordStat {
+			model.RecordLiveCall(mcpDBService.ID, mcpDBService.Name)
+		}
+
 		// Measure and serve
 		startTime := time.Now()
-		targetHandler.ServeHTTP(c.Writer, c.Request)
+		if requestMethod == http.MethodGet && (action == "/sse" || strings.HasPrefix(action, "/sse/")) {
+			// SSE 长连接：慢客户端超过缓冲上限时断开，而不是无限缓冲上游事件
+			serveSSEWithBackpressure(sseCallbackWriter(c), c.Request, targetHandler, mcpDBService, common.GetSSEMaxBufferedEvents())
+		} else {
+			targetHandler.ServeHTTP(c.Writer, c.Request)
+		}
 		duration := time.Since(startTime)
 		statusCode := c.Writer.Status()
 		success := statusCode >= 200 && statusCode < 300
@@ -391,6 +510,7 @@ func ProxyHandler(c *gin.Context) {
 				mcpDBService.ID,
 				mcpDBService.Name,
 				userID,
+				limitTokenID,
 				model.ProxyRequestType(requestTypeForStat),
 				methodForStat,
 				requestPath,
@@ -411,8 +531,20 @@ func ProxyHandler(c *gin.Context) {
 			default:
 				reqType = requestMethod
 			}
-			msg := fmt.Sprintf("MCP request OK | user=%d | type=%s | action=%s | path=%s | duration=%dms | status=%d | client=%s",
-				userID, reqType, action, requestPath, duration.Milliseconds(), statusCode, clientName)
+			// 仅对日志内容脱敏，转发给上游的请求体保持不变
+			redactor := mcpDBService.LogRedactor()
+			msg := formatProxyAccessLog(common.GetProxyAccessLogFormat(), proxyAccessLogEntry{
+				UserID:     userID,
+				Service:    mcpDBService.Name,
+				Type:       reqType,
+				Action:     action,
+				Path:       requestPath,
+				DurationMs: duration.Milliseconds(),
+				Status:     statusCode,
+				Client:     clientName,
+				Tool:       redactor.RedactString(toolNameForLog),
+				RequestID:  c.Request.Header.Get(requestIDHeader),
+			})
 			if saveErr := model.SaveMCPLog(c.Request.Context(), mcpDBService.ID, mcpDBService.Name, model.MCPLogPhaseRun, model.MCPLogLevelInfo, msg); saveErr != nil {
 				common.SysError(fmt.Sprintf("Failed to save MCP access log for %s: %v", mcpDBService.Name, saveErr))
 			}
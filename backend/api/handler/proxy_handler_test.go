@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"one-mcp/backend/common"
@@ -264,7 +265,328 @@ func TestProxyHandler_UserSpecific_CallsNewUncachedHandlerWithCorrectConfig(t *t
 	t.Logf("Response status: %d (may be error due to mocking, which is expected)", w.Code)
 }
 
+// TestProxyHandler_UserEnvProfiles verifies that named env profiles of the same user/service
+// merge on top of the default profile and get their own shared instance.
+func TestProxyHandler_UserEnvProfiles(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+
+	gin.SetMode(gin.TestMode)
+
+	user := &model.User{Username: "profile-user", DisplayName: "Profile User", Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, model.UserDB.Save(user))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", user.ID)
+		c.Set("env_profile", user.EnvProfile) // TokenAuth 从已加载的用户中带出绑定的 profile
+		c.Next()
+	})
+	router.GET("/proxy/:serviceName/sse/*action", ProxyHandler)
+
+	svc := &model.MCPService{
+		Name:              "profile-stdio-svc",
+		DisplayName:       "Profile Stdio Service",
+		Type:              model.ServiceTypeStdio,
+		Command:           "base-cmd",
+		AllowUserOverride: true,
+		Enabled:           true,
+		DefaultEnvsJSON:   `{"BASE_ENV":"base_val"}`,
+	}
+	assert.NoError(t, model.CreateService(svc))
+
+	apiKey := &model.ConfigService{ServiceID: svc.ID, Key: "API_KEY", DisplayName: "API Key", Type: model.ConfigTypeSecret}
+	region := &model.ConfigService{ServiceID: svc.ID, Key: "REGION", DisplayName: "Region", Type: model.ConfigTypeString}
+	assert.NoError(t, model.ConfigServiceDB.Save(apiKey))
+	assert.NoError(t, model.ConfigServiceDB.Save(region))
+
+	for _, uc := range []*model.UserConfig{
+		{UserID: user.ID, ServiceID: svc.ID, ConfigID: apiKey.ID, Value: "default-key"},
+		{UserID: user.ID, ServiceID: svc.ID, ConfigID: region.ID, Value: "us"},
+		{UserID: user.ID, ServiceID: svc.ID, ConfigID: apiKey.ID, Value: "prod-key", ProfileName: "prod"},
+		{UserID: user.ID, ServiceID: svc.ID, ConfigID: apiKey.ID, Value: "test-key", ProfileName: "test"},
+		{UserID: user.ID, ServiceID: svc.ID, ConfigID: region.ID, Value: "eu", ProfileName: "test"},
+	} {
+		assert.NoError(t, model.SaveUserConfig(uc))
+	}
+
+	var capturedEnvs, capturedCacheKey string
+	originalGetOrCreate := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, dbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSON string) (*proxy.SharedMcpInstance, error) {
+		capturedEnvs = effectiveEnvsJSON
+		capturedCacheKey = cacheKey
+		return &proxy.SharedMcpInstance{Server: &mcpserver.MCPServer{}}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = originalGetOrCreate }()
+
+	defaultKey := fmt.Sprintf("user-%d-service-%d-shared", user.ID, svc.ID)
+	tests := []struct {
+		name         string
+		header       string
+		query        string
+		boundProfile string
+		wantAPIKey   string
+		wantRegion   string
+		wantCacheKey string
+	}{
+		{name: "default profile", wantAPIKey: "default-key", wantRegion: "us", wantCacheKey: defaultKey},
+		{name: "prod via header", header: "prod", wantAPIKey: "prod-key", wantRegion: "us", wantCacheKey: defaultKey + "-profile-prod"},
+		{name: "test via query", query: "test", wantAPIKey: "test-key", wantRegion: "eu", wantCacheKey: defaultKey + "-profile-test"},
+		{name: "token-bound profile", boundProfile: "test", wantAPIKey: "test-key", wantRegion: "eu", wantCacheKey: defaultKey + "-profile-test"},
+		{name: "header overrides token-bound", header: "prod", boundProfile: "test", wantAPIKey: "prod-key", wantRegion: "us", wantCacheKey: defaultKey + "-profile-prod"},
+		{name: "unknown profile falls back to default values", header: "staging", wantAPIKey: "default-key", wantRegion: "us", wantCacheKey: defaultKey + "-profile-staging"},
+		{name: "invalid profile name is ignored", header: "../etc", wantAPIKey: "default-key", wantRegion: "us", wantCacheKey: defaultKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user.EnvProfile = tt.boundProfile
+			assert.NoError(t, model.UserDB.Save(user))
+			capturedEnvs, capturedCacheKey = "", ""
+
+			target := "/proxy/" + svc.Name + "/sse/someaction"
+			if tt.query != "" {
+				target += "?profile=" + tt.query
+			}
+			req, _ := http.NewRequest("GET", target, nil)
+			if tt.header != "" {
+				req.Header.Set(envProfileHeader, tt.header)
+			}
+			reqCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			router.ServeHTTP(httptest.NewRecorder(), req.WithContext(reqCtx))
+
+			var envs map[string]string
+			assert.NoError(t, json.Unmarshal([]byte(capturedEnvs), &envs))
+			assert.Equal(t, "base_val", envs["BASE_ENV"])
+			assert.Equal(t, tt.wantAPIKey, envs["API_KEY"])
+			assert.Equal(t, tt.wantRegion, envs["REGION"])
+			assert.Equal(t, tt.wantCacheKey, capturedCacheKey)
+		})
+	}
+}
+
+// TestProxyHandler_UserInstanceReuse verifies that a user whose merged env equals the service defaults
+// is served by the global instance, while a user with a genuinely different value gets their own.
+func TestProxyHandler_UserInstanceReuse(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+
+	gin.SetMode(gin.TestMode)
+
+	svc := &model.MCPService{
+		Name:              "reuse-stdio-svc",
+		DisplayName:       "Reuse Stdio Service",
+		Type:              model.ServiceTypeStdio,
+		Command:           "base-cmd",
+		AllowUserOverride: true,
+		Enabled:           true,
+		DefaultEnvsJSON:   `{"API_KEY":"shared-key"}`,
+	}
+	assert.NoError(t, model.CreateService(svc))
+	apiKey := &model.ConfigService{ServiceID: svc.ID, Key: "API_KEY", DisplayName: "API Key", Type: model.ConfigTypeSecret}
+	assert.NoError(t, model.ConfigServiceDB.Save(apiKey))
+
+	newUser := func(name, value string) *model.User {
+		user := &model.User{Username: name, DisplayName: name, Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+		assert.NoError(t, model.UserDB.Save(user))
+		if value != "" {
+			assert.NoError(t, model.SaveUserConfig(&model.UserConfig{UserID: user.ID, ServiceID: svc.ID, ConfigID: apiKey.ID, Value: value}))
+		}
+		return user
+	}
+	noConfig := newUser("reuse-no-config", "")
+	sameValue := newUser("reuse-same-value", "shared-key")
+	ownValue := newUser("reuse-own-value", "own-key")
+
+	var capturedCacheKey string
+	originalGetOrCreate := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, dbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSON string) (*proxy.SharedMcpInstance, error) {
+		capturedCacheKey = cacheKey
+		return &proxy.SharedMcpInstance{Server: &mcpserver.MCPServer{}}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = originalGetOrCreate }()
+
+	globalKey := fmt.Sprintf("global-service-%d-shared", svc.ID)
+	// 使用独立的 profile，避免命中其他测试（相同用户/服务 ID）留下的 user_configs 查询缓存
+	const profile = "reuse"
+	userKey := func(user *model.User) string {
+		return fmt.Sprintf("user-%d-service-%d-shared-profile-%s", user.ID, svc.ID, profile)
+	}
+	tests := []struct {
+		name         string
+		user         *model.User
+		policy       string
+		wantCacheKey string
+	}{
+		{"no user values reuses global instance", noConfig, "", globalKey},
+		{"value equal to default reuses global instance", sameValue, "", globalKey},
+		{"different value gets own instance", ownValue, "", userKey(ownValue)},
+		{"policy disabled always creates user instance", sameValue, "false", userKey(sameValue)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.OptionMapRWMutex.Lock()
+			common.OptionMap[common.OptionReuseGlobalUserInstances] = tt.policy
+			common.OptionMapRWMutex.Unlock()
+			defer func() {
+				common.OptionMapRWMutex.Lock()
+				delete(common.OptionMap, common.OptionReuseGlobalUserInstances)
+				common.OptionMapRWMutex.Unlock()
+			}()
+			capturedCacheKey = ""
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("userID", tt.user.ID)
+				c.Next()
+			})
+			router.GET("/proxy/:serviceName/sse/*action", ProxyHandler)
+			req, _ := http.NewRequest("GET", "/proxy/"+svc.Name+"/sse/someaction", nil)
+			req.Header.Set(envProfileHeader, profile)
+			reqCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			router.ServeHTTP(httptest.NewRecorder(), req.WithContext(reqCtx))
+
+			assert.Equal(t, tt.wantCacheKey, capturedCacheKey)
+		})
+	}
+}
+
+// TestProxyHandler_DeprecatedService verifies that a deprecated service is still proxied but its responses
+// carry the deprecation headers, and that the installed services listing reflects the state.
+func TestProxyHandler_DeprecatedService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	replacement := &model.MCPService{Name: "fetch-v2", DisplayName: "Fetch v2", Type: model.ServiceTypeStdio, Command: "node", Enabled: true}
+	deprecated := &model.MCPService{
+		Name:               "fetch-old",
+		DisplayName:        "Fetch (old)",
+		Type:               model.ServiceTypeStdio,
+		Command:            "node",
+		Enabled:            true,
+		Deprecated:         true,
+		DeprecationMessage: "Upstream package is no longer maintained",
+		ReplacedBy:         "fetch-v2",
+	}
+	assert.NoError(t, model.CreateService(replacement))
+	assert.NoError(t, model.CreateService(deprecated))
+
+	proxied := map[string]bool{}
+	originalGetOrCreate := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, dbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSON string) (*proxy.SharedMcpInstance, error) {
+		proxied[dbService.Name] = true
+		return &proxy.SharedMcpInstance{Server: &mcpserver.MCPServer{}}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = originalGetOrCreate }()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		c.Next()
+	})
+	router.GET("/proxy/:serviceName/sse/*action", ProxyHandler)
+	tests := []struct {
+		name       string
+		service    string
+		wantNotice string
+		wantLink   string
+	}{
+		{"deprecated service carries headers", "fetch-old", "Service fetch-old is deprecated: Upstream package is no longer maintained. Use fetch-v2 instead.", `</proxy/fetch-v2/mcp>; rel="successor-version"`},
+		{"active service has no headers", "fetch-v2", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/proxy/"+tt.service+"/sse/someaction", nil)
+			reqCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			router.ServeHTTP(recorder, req.WithContext(reqCtx))
+
+			assert.True(t, proxied[tt.service], "request should still be proxied")
+			assert.Equal(t, tt.wantNotice, recorder.Header().Get(deprecationNoticeHeader))
+			assert.Equal(t, tt.wantLink, recorder.Header().Get("Link"))
+			if tt.wantNotice != "" {
+				assert.Equal(t, "true", recorder.Header().Get("Deprecation"))
+			} else {
+				assert.Empty(t, recorder.Header().Get("Deprecation"))
+			}
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/api/mcp_market/installed", nil)
+	ListInstalledMCPServices(ctx)
+	var services []map[string]any
+	assert.NoError(t, json.Unmarshal(decodeAPIResponse(t, recorder).Data, &services))
+	listed := map[string]map[string]any{}
+	for _, svc := range services {
+		listed[svc["name"].(string)] = svc
+	}
+	if assert.Contains(t, listed, "fetch-old") {
+		assert.Equal(t, true, listed["fetch-old"]["deprecated"])
+		assert.Equal(t, "Upstream package is no longer maintained", listed["fetch-old"]["deprecation_message"])
+		assert.Equal(t, "fetch-v2", listed["fetch-old"]["replaced_by"])
+	}
+	if assert.Contains(t, listed, "fetch-v2") {
+		assert.Equal(t, false, listed["fetch-v2"]["deprecated"])
+	}
+
+	config := generateMCPConfig([]*model.MCPService{deprecated, replacement}, &model.User{Token: "tok"}, "http://localhost")
+	assert.Contains(t, config, `"note": "Service fetch-old is deprecated`)
+	assert.Equal(t, 1, strings.Count(config, `"note"`))
+}
+
 // TestProxyHandler_ProxyTypeRouting tests the proxy type routing logic
+// TestProxyHandler_ResponseHeaders verifies that the configured static response headers are added to proxied
+// responses while the headers of the MCP transport are left intact.
+func TestProxyHandler_ResponseHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	svc := &model.MCPService{
+		Name:                "headers-svc",
+		DisplayName:         "Headers",
+		Type:                model.ServiceTypeStdio,
+		Command:             "node",
+		Enabled:             true,
+		ResponseHeadersJSON: `{"access-control-allow-origin": "https://app.example", "Cache-Control": "no-store"}`,
+	}
+	assert.NoError(t, model.CreateService(svc))
+	proxy.ClearProxyHandlerCaches(svc.ID)
+	defer proxy.ClearProxyHandlerCaches(svc.ID)
+
+	originalGetOrCreate := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, dbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSON string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Server: mcpserver.NewMCPServer("headers-upstream", "1.0.0")}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = originalGetOrCreate }()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		c.Next()
+	})
+	router.POST("/proxy/:serviceName/*action", ProxyHandler)
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/proxy/"+svc.Name+"/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "https://app.example", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.NotEmpty(t, recorder.Header().Get("Mcp-Session-Id"))
+	assert.Contains(t, recorder.Body.String(), "headers-upstream")
+}
+
 func TestProxyHandler_ProxyTypeRouting(t *testing.T) {
 	teardown := setupTestEnvironmentForProxyHandler()
 	defer teardown()
@@ -886,3 +1208,257 @@ func TestProxyHandler_CacheConsistency(t *testing.T) {
 		// 404s are OK if they come from the handlers themselves, not the service lookup
 	}
 }
+
+// countingReadCloser records how many bytes have been pulled from the underlying body
+type countingReadCloser struct {
+	r      io.Reader
+	read   int
+	closed bool
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func (c *countingReadCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSniffJSONRPCRequest(t *testing.T) {
+	largeArg := strings.Repeat("x", 1<<20)
+	testCases := []struct {
+		name       string
+		body       string
+		limit      int
+		wantMethod string
+		wantTool   string
+	}{
+		{
+			name:       "tools/call with large arguments",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","arguments":{"q":"` + largeArg + `"}}}`,
+			limit:      1024,
+			wantMethod: "tools/call",
+			wantTool:   "search",
+		},
+		{
+			name:       "params before method",
+			body:       `{"jsonrpc":"2.0","params":{"arguments":{"a":[1,{"b":2}]},"name":"echo"},"method":"tools/call","id":1}`,
+			limit:      1024,
+			wantMethod: "tools/call",
+			wantTool:   "echo",
+		},
+		{
+			name:       "method beyond sniff limit is not detected",
+			body:       `{"jsonrpc":"2.0","params":{"name":"echo","arguments":{"q":"` + largeArg + `"}},"method":"tools/call"}`,
+			limit:      1024,
+			wantMethod: "",
+			wantTool:   "echo",
+		},
+		{
+			name:       "non tools/call method",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+			limit:      1024,
+			wantMethod: "initialize",
+		},
+		{
+			name:  "not json",
+			body:  `hello`,
+			limit: 1024,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &countingReadCloser{r: strings.NewReader(tc.body)}
+			sniffed, restored, err := sniffJSONRPCRequest(src, tc.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantMethod, sniffed.Method)
+			assert.Equal(t, tc.wantTool, sniffed.ToolName)
+			assert.LessOrEqual(t, src.read, tc.limit, "sniffing must not read beyond the limit")
+
+			// The downstream handler still receives the complete, unmodified body
+			var received []byte
+			downstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+				r.Body.Close()
+			})
+			req := httptest.NewRequest(http.MethodPost, "/proxy/svc/mcp", nil)
+			req.Body = restored
+			downstream.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tc.body, string(received))
+			assert.True(t, src.closed)
+		})
+	}
+}
+
+func TestFormatProxyAccessLog(t *testing.T) {
+	// Tool name comes from the same sniffed body the handler already parses
+	body := io.NopCloser(strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"search_repos","arguments":{"q":"mcp"}}}`))
+	sniffed, _, err := sniffJSONRPCRequest(body, common.DefaultProxyBodySniffLimit)
+	assert.NoError(t, err)
+	assert.Equal(t, "tools/call", sniffed.Method)
+	toolName := sniffed.ToolName
+
+	entry := proxyAccessLogEntry{
+		UserID:     42,
+		Service:    "github",
+		Type:       "http",
+		Action:     "/mcp",
+		Path:       "/proxy/github/mcp",
+		DurationMs: 120,
+		Status:     200,
+		Client:     "cursor",
+		Tool:       toolName,
+		RequestID:  "req-abc",
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{
+			name:   "default text format",
+			format: "",
+			want:   "MCP request OK | user=42 | type=http | action=/mcp | path=/proxy/github/mcp | duration=120ms | status=200 | client=cursor | tool=search_repos | request_id=req-abc",
+		},
+		{
+			name:   "explicit text format",
+			format: common.ProxyAccessLogFormatText,
+			want:   "MCP request OK | user=42 | type=http | action=/mcp | path=/proxy/github/mcp | duration=120ms | status=200 | client=cursor | tool=search_repos | request_id=req-abc",
+		},
+		{
+			name:   "template format",
+			format: "{service} {tool} {status} {duration_ms}ms user={user} rid={request_id}",
+			want:   "github search_repos 200 120ms user=42 rid=req-abc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatProxyAccessLog(tt.format, entry))
+		})
+	}
+
+	t.Run("json format", func(t *testing.T) {
+		var decoded map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(formatProxyAccessLog(common.ProxyAccessLogFormatJSON, entry)), &decoded))
+		assert.Equal(t, "search_repos", decoded["tool"])
+		assert.Equal(t, "req-abc", decoded["request_id"])
+		assert.Equal(t, float64(200), decoded["status"])
+		assert.Equal(t, float64(120), decoded["duration_ms"])
+	})
+}
+
+func TestProxyHandler_ServiceInstalling(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+	gin.SetMode(gin.TestMode)
+
+	originalInProgress := installTaskInProgress
+	defer func() { installTaskInProgress = originalInProgress }()
+
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap[common.OptionInstallingRetryAfter] = "15"
+	common.OptionMapRWMutex.Unlock()
+
+	tests := []struct {
+		name             string
+		installedVersion string
+		taskInProgress   bool
+	}{
+		{"install task in progress", "1.0.0", true},
+		{"installing placeholder version", "installing", false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &model.MCPService{
+				Name:             fmt.Sprintf("installing-svc-%d", i),
+				DisplayName:      "Installing",
+				Type:             model.ServiceTypeStdio,
+				Command:          "npx",
+				InstalledVersion: tt.installedVersion,
+				Enabled:          false, // 安装完成前服务通常尚未启用
+			}
+			assert.NoError(t, model.CreateService(svc))
+			installTaskInProgress = func(serviceID int64) bool { return tt.taskInProgress && serviceID == svc.ID }
+
+			r := gin.New()
+			r.POST("/proxy/:serviceName/*action", func(c *gin.Context) {
+				c.Set("userID", int64(1))
+				ProxyHandler(c)
+			})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/proxy/"+svc.Name+"/mcp", strings.NewReader(`{}`))
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.Equal(t, "15", w.Header().Get("Retry-After"))
+			assert.Contains(t, w.Body.String(), "SERVICE_INSTALLING")
+			assert.Contains(t, w.Body.String(), "is installing")
+		})
+	}
+}
+
+func TestCheckDailyRequestLimit_TokenScope(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	tokenA := (&model.User{TokenID: common.GetUUID()}).LimitCredentialID()
+	tokenB := (&model.User{TokenID: common.GetUUID()}).LimitCredentialID()
+	tests := []struct {
+		name     string
+		scope    string
+		wantAErr bool
+		wantBErr bool
+	}{
+		// 两个令牌以同一用户计数时：按令牌计数互不影响，按用户计数共用限额
+		{name: "token scope keeps independent counters", scope: model.RateLimitScopeToken, wantAErr: true, wantBErr: false},
+		{name: "user scope shares the user's counter", scope: model.RateLimitScopeUser, wantAErr: true, wantBErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &model.MCPService{Name: "rpd-" + tt.scope, DisplayName: "RPD", Type: model.ServiceTypeStdio, Command: "echo", RPDLimit: 2, RateLimitScope: tt.scope}
+			assert.NoError(t, model.CreateService(svc))
+
+			for i := 0; i < svc.RPDLimit; i++ {
+				model.RecordRequestStat(svc.ID, svc.Name, 1, svc.LimitTokenID(tokenA), model.ProxyRequestTypeHTTP, "tools/call", "/proxy/rpd/mcp", 1, http.StatusOK, true)
+			}
+
+			errA := checkDailyRequestLimit(svc.ID, 1, svc.LimitTokenID(tokenA), svc.RPDLimit)
+			errB := checkDailyRequestLimit(svc.ID, 1, svc.LimitTokenID(tokenB), svc.RPDLimit)
+			assert.Equal(t, tt.wantAErr, errA != nil, "token A: %v", errA)
+			assert.Equal(t, tt.wantBErr, errB != nil, "token B: %v", errB)
+		})
+	}
+}
+
+// TestResolveEnvProfileBoundProfile verifies the token-bound profile is taken from TokenAuth on proxy
+// requests and looked up from the user on routes without it (e.g. JWT API routes).
+func TestResolveEnvProfileBoundProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	user := &model.User{Username: "profile-bound", DisplayName: "profile-bound", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, EnvProfile: "test"}
+	assert.NoError(t, model.UserDB.Save(user))
+
+	newContext := func() *gin.Context {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		return ctx
+	}
+
+	ctx := newContext()
+	assert.Equal(t, "test", resolveEnvProfile(ctx, user.ID))
+
+	ctx = newContext()
+	ctx.Set("env_profile", "prod")
+	assert.Equal(t, "prod", resolveEnvProfile(ctx, user.ID))
+
+	ctx = newContext()
+	ctx.Set("env_profile", "")
+	assert.Equal(t, model.DefaultEnvProfile, resolveEnvProfile(ctx, user.ID))
+}
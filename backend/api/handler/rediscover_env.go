@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// envVarRequirementChange 描述一个已有环境变量的必填/可选状态变化
+type envVarRequirementChange struct {
+	Name           string `json:"name"`
+	RequiredBefore bool   `json:"required_before"`
+	RequiredAfter  bool   `json:"required_after"`
+}
+
+// envVarDiscoveryDiff 是重新发现的环境变量与当前 ConfigService 定义之间的差异。
+// Removed 仅作提示：未再发现的配置项及用户已填写的值在应用时会保留
+type envVarDiscoveryDiff struct {
+	Added   []model.EnvVarDefinition  `json:"added"`
+	Removed []string                  `json:"removed"`
+	Changed []envVarRequirementChange `json:"changed"`
+}
+
+// isEmpty reports whether applying the diff changes nothing; Removed is informational only
+func (d envVarDiscoveryDiff) isEmpty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0
+}
+
+// diffDiscoveredEnvVars compares discovered definitions against the stored config options (sorted by name).
+// An optional variable only becomes required when the discovery is authoritative, since guessed definitions are
+// always marked required.
+func diffDiscoveredEnvVars(current []*model.ConfigService, discovered []model.EnvVarDefinition, authoritative bool) envVarDiscoveryDiff {
+	diff := envVarDiscoveryDiff{
+		Added:   []model.EnvVarDefinition{},
+		Removed: []string{},
+		Changed: []envVarRequirementChange{},
+	}
+	existing := make(map[string]*model.ConfigService, len(current))
+	for _, option := range current {
+		existing[option.Key] = option
+	}
+	seen := make(map[string]bool, len(discovered))
+	for _, def := range discovered {
+		if def.Name == "" || seen[def.Name] {
+			continue
+		}
+		seen[def.Name] = true
+		option, ok := existing[def.Name]
+		if !ok {
+			diff.Added = append(diff.Added, def)
+			continue
+		}
+		if option.Required != !def.Optional && (authoritative || def.Optional) {
+			diff.Changed = append(diff.Changed, envVarRequirementChange{Name: def.Name, RequiredBefore: option.Required, RequiredAfter: !def.Optional})
+		}
+	}
+	for _, option := range current {
+		if !seen[option.Key] {
+			diff.Removed = append(diff.Removed, option.Key)
+		}
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Name < diff.Added[j].Name })
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Name < diff.Changed[j].Name })
+	return diff
+}
+
+// applyEnvVarDiscoveryDiff 将新增项与必填状态变化写入 ConfigService，并同步服务的 RequiredEnvVarsJSON。
+// 未再发现的配置项、其定义及用户已填写的值都不会被删除
+func applyEnvVarDiscoveryDiff(service *model.MCPService, current []*model.ConfigService, diff envVarDiscoveryDiff) error {
+	existing := make(map[string]*model.ConfigService, len(current))
+	for _, option := range current {
+		existing[option.Key] = option
+	}
+
+	for _, change := range diff.Changed {
+		option := existing[change.Name]
+		option.Required = change.RequiredAfter
+		if err := model.UpdateConfigOption(option); err != nil {
+			return err
+		}
+	}
+	for i, def := range diff.Added {
+		option := &model.ConfigService{
+			ServiceID:   service.ID,
+			Key:         def.Name,
+			DisplayName: def.Name,
+			Description: def.Description,
+			Type:        model.ConfigTypeString,
+			Required:    !def.Optional,
+			OrderNum:    len(current) + i,
+		}
+		if def.IsSecret {
+			option.Type = model.ConfigTypeSecret
+		}
+		if err := model.CreateConfigOption(option); err != nil {
+			return err
+		}
+	}
+
+	definitions, err := service.GetRequiredEnvVars()
+	if err != nil {
+		definitions = []model.EnvVarDefinition{}
+	}
+	requiredAfter := make(map[string]bool, len(diff.Changed))
+	for _, change := range diff.Changed {
+		requiredAfter[change.Name] = change.RequiredAfter
+	}
+	for i := range definitions {
+		if required, ok := requiredAfter[definitions[i].Name]; ok {
+			definitions[i].Optional = !required
+		}
+	}
+	definitions = append(definitions, diff.Added...)
+	if err := service.SetRequiredEnvVars(definitions); err != nil {
+		return err
+	}
+	return model.UpdateService(service)
+}
+
+// RediscoverServiceEnvVars godoc
+// @Summary 重新发现已安装服务的环境变量
+// @Description 重新获取包详情/README，返回发现的环境变量与当前配置定义的差异（新增、未再发现、必填状态变化）；apply=true 时应用新增与必填状态变化，未再发现的配置项与用户值保留；仅当发现结果来自包声明而非 README 猜测时才会把可选项改为必填
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param id path int true "服务ID"
+// @Param apply query bool false "是否应用差异"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/rediscover_env [post]
+func RediscoverServiceEnvVars(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+
+	var requestBody struct {
+		Apply bool `json:"apply"`
+	}
+	// 请求体可选：允许无 body 或空 body，仅通过 ?apply=true 控制
+	if c.Request.Body != nil {
+		if err := c.ShouldBindJSON(&requestBody); err != nil && !errors.Is(err, io.EOF) {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+			return
+		}
+	}
+	apply := requestBody.Apply || strings.EqualFold(c.Query("apply"), "true")
+
+	service, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+	if service.PackageManager == "" || service.SourcePackageName == "" {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_package_manager", lang))
+		return
+	}
+	if apply && service.IsFileManaged() {
+		common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("service_managed_by_file", lang))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	discovered, authoritative, err := discoverEnvVarDefinitions(ctx, service.PackageManager, service.SourcePackageName)
+	if err != nil {
+		if errors.Is(err, errUnsupportedPackageManager) {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_package_manager", lang))
+			return
+		}
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("get_npm_package_details_failed", lang), err)
+		return
+	}
+
+	current, err := model.GetConfigOptionsForService(service.ID)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_service_config_options_failed", lang), err)
+		return
+	}
+
+	diff := diffDiscoveredEnvVars(current, discovered, authoritative)
+	applied := false
+	if apply && !diff.isEmpty() {
+		if err := applyEnvVarDiscoveryDiff(service, current, diff); err != nil {
+			common.RespError(c, http.StatusInternalServerError, i18n.Translate("update_service_failed", lang), err)
+			return
+		}
+		applied = true
+	}
+
+	common.RespSuccess(c, gin.H{
+		"service_id":    service.ID,
+		"package_name":  service.SourcePackageName,
+		"added":         diff.Added,
+		"removed":       diff.Removed,
+		"changed":       diff.Changed,
+		"authoritative": authoritative,
+		"applied":       applied,
+	})
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRediscoverServiceEnvVars(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	originalDiscover := discoverEnvVarDefinitions
+	defer func() { discoverEnvVarDefinitions = originalDiscover }()
+	authoritative := true
+	discoverEnvVarDefinitions = func(ctx context.Context, packageManager, packageName string) ([]model.EnvVarDefinition, bool, error) {
+		return []model.EnvVarDefinition{
+			{Name: "KEEP_KEY", Optional: false},
+			{Name: "NEW_TOKEN", IsSecret: true, Optional: true},
+		}, authoritative, nil
+	}
+
+	service := &model.MCPService{
+		Name:              "rediscover-svc",
+		DisplayName:       "Rediscover",
+		Type:              model.ServiceTypeStdio,
+		Command:           "npx",
+		PackageManager:    "npm",
+		SourcePackageName: "@example/mcp-server",
+		Enabled:           true,
+	}
+	assert.NoError(t, model.CreateService(service))
+	oldOption := &model.ConfigService{ServiceID: service.ID, Key: "OLD_KEY", Type: model.ConfigTypeString, Required: true}
+	keepOption := &model.ConfigService{ServiceID: service.ID, Key: "KEEP_KEY", Type: model.ConfigTypeString, Required: false, OrderNum: 1}
+	assert.NoError(t, model.CreateConfigOption(oldOption))
+	assert.NoError(t, model.CreateConfigOption(keepOption))
+	guessedOption := &model.ConfigService{ServiceID: service.ID, Key: "GUESSED_KEY", Type: model.ConfigTypeString, Required: false, OrderNum: 2}
+	assert.NoError(t, model.CreateConfigOption(guessedOption))
+	assert.NoError(t, model.SaveUserConfig(&model.UserConfig{UserID: 1, ServiceID: service.ID, ConfigID: oldOption.ID, ProfileName: model.DefaultEnvProfile, Value: "stale"}))
+
+	tests := []struct {
+		name        string
+		path        string
+		wantApplied bool
+		wantKeys    []string
+	}{
+		{"preview only", fmt.Sprintf("/api/mcp_services/%d/rediscover_env", service.ID), false, []string{"OLD_KEY", "KEEP_KEY", "GUESSED_KEY"}},
+		{"apply", fmt.Sprintf("/api/mcp_services/%d/rediscover_env?apply=true", service.ID), true, []string{"OLD_KEY", "KEEP_KEY", "GUESSED_KEY", "NEW_TOKEN"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request, _ = http.NewRequest(http.MethodPost, tt.path, nil)
+			ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(service.ID)}}
+			RediscoverServiceEnvVars(ctx)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			resp := decodeAPIResponse(t, recorder)
+			assert.True(t, resp.Success)
+			var diff struct {
+				envVarDiscoveryDiff
+				Applied bool `json:"applied"`
+			}
+			assert.NoError(t, json.Unmarshal(resp.Data, &diff))
+			assert.Equal(t, tt.wantApplied, diff.Applied)
+			if assert.Len(t, diff.Added, 1) {
+				assert.Equal(t, "NEW_TOKEN", diff.Added[0].Name)
+			}
+			assert.Equal(t, []string{"GUESSED_KEY", "OLD_KEY"}, diff.Removed)
+			assert.Equal(t, []envVarRequirementChange{{Name: "KEEP_KEY", RequiredBefore: false, RequiredAfter: true}}, diff.Changed)
+
+			options, err := model.GetConfigOptionsForService(service.ID)
+			assert.NoError(t, err)
+			var keys []string
+			for _, option := range options {
+				keys = append(keys, option.Key)
+			}
+			assert.ElementsMatch(t, tt.wantKeys, keys)
+		})
+	}
+
+	// 应用后再次发现应无差异，新增项与必填状态已生效，未再发现的配置项与用户值保留
+	options, err := model.GetConfigOptionsForService(service.ID)
+	assert.NoError(t, err)
+	for _, option := range options {
+		switch option.Key {
+		case "KEEP_KEY":
+			assert.True(t, option.Required)
+		case "NEW_TOKEN":
+			assert.Equal(t, model.ConfigTypeSecret, option.Type)
+			assert.False(t, option.Required)
+		}
+	}
+	assert.Empty(t, diffDiscoveredEnvVars(options, []model.EnvVarDefinition{{Name: "KEEP_KEY"}, {Name: "NEW_TOKEN", Optional: true}}, true).Changed)
+	value, err := model.GetUserConfigValue(1, oldOption.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "stale", value.Value)
+	}
+
+	// 从 README 猜测的定义都标为必填，不能把可选项改为必填
+	authoritative = false
+	discoverEnvVarDefinitions = func(ctx context.Context, packageManager, packageName string) ([]model.EnvVarDefinition, bool, error) {
+		return []model.EnvVarDefinition{{Name: "GUESSED_KEY"}}, authoritative, nil
+	}
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/api/mcp_services/%d/rediscover_env?apply=true", service.ID), nil)
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(service.ID)}}
+	RediscoverServiceEnvVars(ctx)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	options, err = model.GetConfigOptionsForService(service.ID)
+	assert.NoError(t, err)
+	assert.Len(t, options, 4)
+	for _, option := range options {
+		if option.Key == "GUESSED_KEY" {
+			assert.False(t, option.Required)
+		}
+	}
+
+	updated, err := model.GetServiceByID(service.ID)
+	assert.NoError(t, err)
+	assert.Contains(t, updated.RequiredEnvVarsJSON, "NEW_TOKEN")
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+	"one-mcp/backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServeServiceIcon serves a locally cached service icon.
+// GET /api/icons/:file
+func ServeServiceIcon(c *gin.Context) {
+	path, ok := service.ServiceIconPath(c.Param("file"))
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	// 文件名是内容哈希，内容不会变化
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.File(path)
+}
+
+// UploadMCPServiceIcon replaces the icon of a service with an uploaded image (multipart field "icon").
+// POST /api/mcp_services/:id/icon
+func UploadMCPServiceIcon(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+	svc, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+
+	fileHeader, err := c.FormFile("icon")
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_icon", lang), err)
+		return
+	}
+	if fileHeader.Size > service.MaxServiceIconSize {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_service_icon", lang))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_icon", lang), err)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, service.MaxServiceIconSize+1))
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_icon", lang), err)
+		return
+	}
+
+	iconURL, err := service.SaveServiceIcon(data)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidServiceIcon) {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_icon", lang), err)
+			return
+		}
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("save_service_icon_failed", lang), err)
+		return
+	}
+	svc.Icon = iconURL
+	if err := model.UpdateService(svc); err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("save_service_icon_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, gin.H{"icon": iconURL})
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIconUploadRequest(t *testing.T, serviceID int64, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("icon", "icon.png")
+	assert.NoError(t, err)
+	_, _ = part.Write(content)
+	assert.NoError(t, writer.Close())
+	req, err := http.NewRequest(http.MethodPost, "/api/mcp_services/"+strconv.FormatInt(serviceID, 10)+"/icon", &body)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestUploadMCPServiceIcon(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	svc := &model.MCPService{Name: "iconic", DisplayName: "Iconic", Type: model.ServiceTypeStdio, Icon: "https://flaky.example.com/icon.png"}
+	assert.NoError(t, model.CreateService(svc))
+
+	router := gin.New()
+	router.POST("/api/mcp_services/:id/icon", UploadMCPServiceIcon)
+	router.GET("/api/icons/:file", ServeServiceIcon)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+	tests := []struct {
+		name       string
+		content    []byte
+		wantStatus int
+	}{
+		{"png upload replaces icon", png, http.StatusOK},
+		{"script is rejected", []byte("<script>alert(1)</script>"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newIconUploadRequest(t, svc.ID, tt.content))
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus != http.StatusOK {
+				updated, err := model.GetServiceByID(svc.ID)
+				assert.NoError(t, err)
+				assert.NotContains(t, updated.Icon, "script")
+				return
+			}
+
+			resp := decodeAPIResponse(t, recorder)
+			var data struct {
+				Icon string `json:"icon"`
+			}
+			assert.NoError(t, json.Unmarshal(resp.Data, &data))
+			assert.True(t, strings.HasPrefix(data.Icon, "/api/icons/"), data.Icon)
+			updated, err := model.GetServiceByID(svc.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, data.Icon, updated.Icon)
+
+			served := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, data.Icon, nil)
+			router.ServeHTTP(served, req)
+			assert.Equal(t, http.StatusOK, served.Code)
+			assert.Equal(t, png, served.Body.Bytes())
+		})
+	}
+}
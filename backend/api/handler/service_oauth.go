@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serviceOAuthStatus 服务的 OAuth 授权状态，不包含 token 本身
+type serviceOAuthStatus struct {
+	GrantType           string     `json:"grant_type"`
+	Authorized          bool       `json:"authorized"`
+	ExpiresAt           *time.Time `json:"expires_at,omitempty"`
+	Pending             bool       `json:"pending"` // device flow 已开始，等待用户在 verification_uri 输入 user_code
+	UserCode            string     `json:"user_code,omitempty"`
+	VerificationURI     string     `json:"verification_uri,omitempty"`
+	DeviceCodeExpiresAt *time.Time `json:"device_code_expires_at,omitempty"`
+	PollInterval        int        `json:"poll_interval,omitempty"`
+}
+
+func newServiceOAuthStatus(config *model.ServiceOAuthConfig, record *model.ServiceOAuthToken) serviceOAuthStatus {
+	status := serviceOAuthStatus{GrantType: config.GrantType}
+	if record == nil {
+		return status
+	}
+	status.Authorized = record.Usable(time.Now()) || (record.AccessToken != "" && record.RefreshToken != "")
+	if status.Authorized && !record.ExpiresAt.IsZero() {
+		status.ExpiresAt = &record.ExpiresAt
+	}
+	if record.DeviceCode != "" {
+		status.Pending = true
+		status.UserCode = record.UserCode
+		status.VerificationURI = record.VerificationURI
+		status.DeviceCodeExpiresAt = &record.DeviceCodeExpiresAt
+		status.PollInterval = record.PollInterval
+	}
+	return status
+}
+
+// oauthServiceFromRequest loads the service of the request and its OAuth configuration, answering the request
+// itself when either is missing
+func oauthServiceFromRequest(c *gin.Context) (*model.MCPService, *model.ServiceOAuthConfig, bool) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return nil, nil, false
+	}
+	service, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return nil, nil, false
+	}
+	config, err := service.OAuthConfig()
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_oauth_config", lang), err)
+		return nil, nil, false
+	}
+	if config == nil {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("oauth_not_configured", lang))
+		return nil, nil, false
+	}
+	return service, config, true
+}
+
+// restartAuthorizedService restarts a running service in the background so its instance connects with the new token
+func restartAuthorizedService(service *model.MCPService) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		serviceManager := proxy.GetServiceManager()
+		if registered, err := serviceManager.GetService(service.ID); err != nil || !registered.IsRunning() {
+			return
+		}
+		if err := serviceManager.RestartService(ctx, service.ID); err != nil {
+			common.SysError(fmt.Sprintf("Failed to restart service %s (ID: %d) after OAuth authorization: %v", service.Name, service.ID, err))
+		}
+	}()
+}
+
+// GetMCPServiceOAuth godoc
+// @Summary 获取MCP服务的OAuth授权状态
+// @Description 返回服务是否已获取可用的 access token，以及进行中的 device flow 的 user_code 与验证地址
+// @Tags MCP Services
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/oauth [get]
+func GetMCPServiceOAuth(c *gin.Context) {
+	service, config, ok := oauthServiceFromRequest(c)
+	if !ok {
+		return
+	}
+	record, err := model.GetServiceOAuthToken(service.ID)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("oauth_authorization_failed", c.GetString("lang")), err)
+		return
+	}
+	common.RespSuccess(c, newServiceOAuthStatus(config, record))
+}
+
+// StartMCPServiceOAuth godoc
+// @Summary 开始MCP服务的OAuth授权
+// @Description client_credentials 服务立即获取新的 access token；device_code 服务返回 user_code 与验证地址，用户确认后调用 complete 接口
+// @Tags MCP Services
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 502 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/oauth/start [post]
+func StartMCPServiceOAuth(c *gin.Context) {
+	service, config, ok := oauthServiceFromRequest(c)
+	if !ok {
+		return
+	}
+	record, err := proxy.StartServiceOAuth(c.Request.Context(), service)
+	if err != nil {
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("oauth_authorization_failed", c.GetString("lang")), err)
+		return
+	}
+	if config.GrantType == model.OAuthGrantClientCredentials {
+		restartAuthorizedService(service)
+	}
+	common.RespSuccess(c, newServiceOAuthStatus(config, record))
+}
+
+// CompleteMCPServiceOAuth godoc
+// @Summary 完成MCP服务的OAuth device flow
+// @Description 向 token 端点查询一次 device flow 的结果；用户尚未确认时返回 pending，成功后保存 token 并重启运行中的服务
+// @Tags MCP Services
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 502 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/oauth/complete [post]
+func CompleteMCPServiceOAuth(c *gin.Context) {
+	service, config, ok := oauthServiceFromRequest(c)
+	if !ok {
+		return
+	}
+	record, err := proxy.CompleteServiceOAuth(c.Request.Context(), service)
+	if errors.Is(err, proxy.ErrOAuthAuthorizationPending) {
+		common.RespSuccess(c, newServiceOAuthStatus(config, record))
+		return
+	}
+	if err != nil {
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("oauth_authorization_failed", c.GetString("lang")), err)
+		return
+	}
+	restartAuthorizedService(service)
+	common.RespSuccess(c, newServiceOAuthStatus(config, record))
+}
@@ -5,11 +5,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"one-mcp/backend/common"
 	"one-mcp/backend/common/i18n"
-	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 	"one-mcp/backend/templates"
 	"strconv"
@@ -20,8 +20,29 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// emptyToolsPolicy decides how a skill export handles services that have no tools (down or broken)
+type emptyToolsPolicy string
+
+const (
+	// emptyToolsInclude keeps the service and notes in its docs why the tools are unavailable
+	emptyToolsInclude emptyToolsPolicy = "include"
+	// emptyToolsSkip leaves the service out of the skill entirely
+	emptyToolsSkip emptyToolsPolicy = "skip"
+	// emptyToolsFail aborts the export
+	emptyToolsFail emptyToolsPolicy = "fail"
+)
+
+// emptyToolsError reports the services without tools that made an export with emptyToolsFail abort
+type emptyToolsError struct {
+	reasons []string
+}
+
+func (e *emptyToolsError) Error() string {
+	return "services without tools: " + strings.Join(e.reasons, "; ")
+}
+
 // ExportGroupSkill exports a group as an Anthropic Skill zip package
-// GET /api/groups/:id/export
+// GET /api/groups/:id/export?empty_tools=include|skip|fail
 func ExportGroupSkill(c *gin.Context) {
 	lang := c.GetString("lang")
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -29,9 +50,14 @@ func ExportGroupSkill(c *gin.Context) {
 		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
 		return
 	}
+	policy := emptyToolsPolicy(c.DefaultQuery("empty_tools", string(emptyToolsInclude)))
+	if policy != emptyToolsInclude && policy != emptyToolsSkip && policy != emptyToolsFail {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+		return
+	}
 
 	userID := c.GetInt64("user_id")
-	group, err := model.GetMCPServiceGroupByID(id, userID)
+	group, err := model.GetAccessibleMCPServiceGroupByID(id, userID, c.GetInt("role"), model.GroupPermissionRead)
 	if err != nil {
 		common.RespError(c, http.StatusNotFound, "group not found", err)
 		return
@@ -44,19 +70,13 @@ func ExportGroupSkill(c *gin.Context) {
 		return
 	}
 
-	// Get server address from config or use default
-	serverAddress := common.OptionMap["ServerAddress"]
-	if serverAddress == "" {
-		serverAddress = c.Request.Host
-		scheme := "https"
-		if c.Request.TLS == nil && !strings.HasPrefix(c.Request.Header.Get("X-Forwarded-Proto"), "https") {
-			scheme = "http"
-		}
-		serverAddress = scheme + "://" + serverAddress
-	}
-
 	// Build the skill zip
-	zipBuffer, err := buildSkillZip(c.Request.Context(), group, user, serverAddress)
+	zipBuffer, err := buildSkillZip(c.Request.Context(), group, user, requestServerAddress(c), policy)
+	var emptyErr *emptyToolsError
+	if errors.As(err, &emptyErr) {
+		common.RespError(c, http.StatusUnprocessableEntity, "some services have no tools", err)
+		return
+	}
 	if err != nil {
 		common.RespError(c, http.StatusInternalServerError, "failed to generate skill zip", err)
 		return
@@ -72,43 +92,66 @@ func ExportGroupSkill(c *gin.Context) {
 	c.Data(http.StatusOK, "application/zip", zipBuffer.Bytes())
 }
 
+// requestServerAddress returns the configured ServerAddress, or derives it from the request
+func requestServerAddress(c *gin.Context) string {
+	serverAddress := common.OptionMap["ServerAddress"]
+	if serverAddress == "" {
+		serverAddress = c.Request.Host
+		scheme := "https"
+		if c.Request.TLS == nil && !strings.HasPrefix(c.Request.Header.Get("X-Forwarded-Proto"), "https") {
+			scheme = "http"
+		}
+		serverAddress = scheme + "://" + serverAddress
+	}
+	return serverAddress
+}
+
 // normalizeSkillName replaces underscores with hyphens for consistent naming
 func normalizeSkillName(name string) string {
 	return strings.ReplaceAll(name, "_", "-")
 }
 
-func buildSkillZip(ctx context.Context, group *model.MCPServiceGroup, user *model.User, serverAddress string) (*bytes.Buffer, error) {
+// toolsUnavailableReason explains why a service contributes no tools to a skill
+func toolsUnavailableReason(fetchErr error) string {
+	if fetchErr != nil {
+		return fmt.Sprintf("fetching tools failed: %v", fetchErr)
+	}
+	return "the service reported no tools"
+}
+
+func buildSkillZip(ctx context.Context, group *model.MCPServiceGroup, user *model.User, serverAddress string, policy emptyToolsPolicy) (*bytes.Buffer, error) {
 	buf := new(bytes.Buffer)
 	zipWriter := zip.NewWriter(buf)
 	defer zipWriter.Close()
 
-	serviceIDs := group.GetServiceIDs()
-	services := make([]*model.MCPService, 0, len(serviceIDs))
-	toolsCache := proxy.GetToolsCacheManager()
+	members := groupMemberServices(group)
+	services := make([]*model.MCPService, 0, len(members))
 
 	// Collect services and their tools
-	servicesWithTools := make([]skillServiceWithTools, 0, len(serviceIDs))
-
-	for _, svcID := range serviceIDs {
-		svc, err := model.GetServiceByID(svcID)
-		if err != nil {
-			continue
-		}
-		services = append(services, svc)
-
-		var tools []mcp.Tool
-		// Try cache first
-		if entry, ok := toolsCache.GetServiceTools(svcID); ok && len(entry.Tools) > 0 {
-			tools = entry.Tools
-		} else {
-			// Fetch tools from service if cache is empty
-			fetchedTools, fetchErr := fetchToolsFromService(ctx, svc)
-			if fetchErr == nil {
-				tools = fetchedTools
+	servicesWithTools := make([]skillServiceWithTools, 0, len(members))
+	var emptyReasons []string
+
+	// Cached tools are used unless stale; the cache is only empty when the service has never been reached
+	memberTools, fetchErrs := fetchGroupServiceTools(ctx, members)
+	for i, svc := range members {
+		tools, fetchErr := memberTools[i], fetchErrs[i]
+		unavailable := ""
+		if len(tools) == 0 {
+			unavailable = toolsUnavailableReason(fetchErr)
+			common.SysLog(fmt.Sprintf("[SkillExport] group %s: service %s has no tools (%s), policy %s", group.Name, svc.Name, unavailable, policy))
+			switch policy {
+			case emptyToolsSkip:
+				continue
+			case emptyToolsFail:
+				emptyReasons = append(emptyReasons, fmt.Sprintf("%s: %s", svc.Name, unavailable))
+				continue
 			}
-			// If fetch fails, tools remains empty - continue anyway
 		}
-		servicesWithTools = append(servicesWithTools, skillServiceWithTools{service: svc, tools: tools})
+		services = append(services, svc)
+		servicesWithTools = append(servicesWithTools, skillServiceWithTools{service: svc, tools: tools, unavailable: unavailable})
+	}
+	if len(emptyReasons) > 0 {
+		return nil, &emptyToolsError{reasons: emptyReasons}
 	}
 
 	// 1. Generate SKILL.md
@@ -119,7 +162,7 @@ func buildSkillZip(ctx context.Context, group *model.MCPServiceGroup, user *mode
 
 	// 2. Generate tools/*.md for each service
 	for _, swt := range servicesWithTools {
-		toolsMD := generateToolsMD(swt.service, swt.tools)
+		toolsMD := generateToolsMD(swt)
 		filename := fmt.Sprintf("tools/%s.md", swt.service.Name)
 		if err := addFileToZip(zipWriter, filename, toolsMD); err != nil {
 			return nil, err
@@ -167,18 +210,23 @@ func addFileToZip(zipWriter *zip.Writer, filename string, content string) error
 	return err
 }
 
-// truncateString truncates a string to maxRunes characters, handling UTF-8 properly
+// truncateString truncates a string to maxRunes characters, handling UTF-8 properly.
+// The result ends with "..." when it was cut; maxRunes <= 0 means no limit.
 func truncateString(s string, maxRunes int) string {
 	runes := []rune(s)
-	if len(runes) <= maxRunes {
+	if maxRunes <= 0 || len(runes) <= maxRunes {
 		return s
 	}
+	if maxRunes <= 3 {
+		return string(runes[:maxRunes])
+	}
 	return string(runes[:maxRunes-3]) + "..."
 }
 
 type skillServiceWithTools struct {
-	service *model.MCPService
-	tools   []mcp.Tool
+	service     *model.MCPService
+	tools       []mcp.Tool
+	unavailable string // why the service has no tools, empty when it has some
 }
 
 func generateSkillMD(group *model.MCPServiceGroup, services []skillServiceWithTools) string {
@@ -263,6 +311,12 @@ func generateSkillMD(group *model.MCPServiceGroup, services []skillServiceWithTo
 			desc = swt.service.DisplayName
 		}
 		sb.WriteString(fmt.Sprintf("### %s (%d tools)\n\n", swt.service.Name, toolCount))
+		if notice := swt.service.DeprecationNotice(); notice != "" {
+			sb.WriteString(fmt.Sprintf("> **Deprecated:** %s\n\n", notice))
+		}
+		if swt.unavailable != "" {
+			sb.WriteString(fmt.Sprintf("> **Tools unavailable:** %s. Run `python refresh_tool_docs.py` once the service is back.\n\n", swt.unavailable))
+		}
 		sb.WriteString(fmt.Sprintf("%s\n\n", desc))
 		sb.WriteString(fmt.Sprintf("- [View all tools](tools/%s.md)\n", swt.service.Name))
 
@@ -364,12 +418,18 @@ func generateExampleParams(schema mcp.ToolInputSchema) string {
 	return string(jsonBytes)
 }
 
-func generateToolsMD(service *model.MCPService, tools []mcp.Tool) string {
+func generateToolsMD(swt skillServiceWithTools) string {
 	var sb strings.Builder
 
-	sb.WriteString(fmt.Sprintf("# %s Tools\n\n", service.DisplayName))
+	sb.WriteString(fmt.Sprintf("# %s Tools\n\n", swt.service.DisplayName))
+	if notice := swt.service.DeprecationNotice(); notice != "" {
+		sb.WriteString(fmt.Sprintf("> **Deprecated:** %s\n\n", notice))
+	}
+	if swt.unavailable != "" {
+		sb.WriteString(fmt.Sprintf("> **Tools unavailable:** %s. Run `python refresh_tool_docs.py` once the service is back.\n\n", swt.unavailable))
+	}
 
-	for _, tool := range tools {
+	for _, tool := range sortToolsByName(swt.tools) {
 		sb.WriteString(fmt.Sprintf("## %s\n\n", tool.Name))
 		if tool.Description != "" {
 			sb.WriteString(tool.Description + "\n\n")
@@ -388,9 +448,9 @@ func generateToolsMD(service *model.MCPService, tools []mcp.Tool) string {
 	return sb.String()
 }
 
-// convertInputSchemaToYAML converts inputSchema to compact YAML format
+// convertInputSchemaToYAML converts inputSchema to compact YAML format with a stable parameter order
 func convertInputSchemaToYAML(schema mcp.ToolInputSchema) string {
-	params := make(map[string]map[string]any)
+	params := make(map[string]any)
 
 	requiredSet := make(map[string]bool)
 	for _, r := range schema.Required {
@@ -433,7 +493,14 @@ func convertInputSchemaToYAML(schema mcp.ToolInputSchema) string {
 		params[name] = param
 	}
 
-	yamlBytes, _ := yaml.Marshal(params)
+	// 排序依据取原始 schema（可能带有 x-order 提示），而非精简后的 param
+	ordered := &orderedProperties{values: params}
+	for _, name := range sortedPropertyNames(schema.Properties) {
+		if _, ok := params[name]; ok {
+			ordered.keys = append(ordered.keys, name)
+		}
+	}
+	yamlBytes, _ := yaml.Marshal(ordered)
 	return string(yamlBytes)
 }
 
@@ -445,9 +512,13 @@ func generateMCPConfig(services []*model.MCPService, user *model.User, serverAdd
 	mcpServers := config["mcpServers"].(map[string]interface{})
 	for _, svc := range services {
 		url := fmt.Sprintf("%s/proxy/%s/mcp?key=%s", serverAddress, svc.Name, user.Token)
-		mcpServers[svc.Name] = map[string]string{
+		entry := map[string]string{
 			"url": url,
 		}
+		if notice := svc.DeprecationNotice(); notice != "" {
+			entry["note"] = notice
+		}
+		mcpServers[svc.Name] = entry
 	}
 
 	jsonBytes, _ := json.MarshalIndent(config, "", "  ")
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func readZipFile(t *testing.T, buf *bytes.Buffer, name string) string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	for _, f := range reader.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		assert.NoError(t, err)
+		return string(data)
+	}
+	t.Fatalf("%s not found in zip", name)
+	return ""
+}
+
+func TestBuildSkillZipRefreshesStaleToolsCache(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	upstream := mcpserver.NewMCPServer("stale", "1.0.0")
+	upstream.AddTool(mcp.Tool{Name: "new_tool", Description: "added upstream", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("ok"), nil
+		})
+	cli, err := mcpclient.NewInProcessClient(upstream)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	originalTimeout := toolsRefreshTimeout
+	toolsRefreshTimeout = 200 * time.Millisecond
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	defer func() {
+		proxy.GetOrCreateSharedMcpInstanceWithKey = original
+		toolsRefreshTimeout = originalTimeout
+	}()
+
+	oldTools := []mcp.Tool{{Name: "old_tool", InputSchema: mcp.ToolInputSchema{Type: "object"}}}
+	tests := []struct {
+		name      string
+		fetchedAt func(svc *model.MCPService) time.Time
+		hang      bool
+		wantTool  string
+		wantFetch bool
+	}{
+		{"fresh cache is used as is", func(svc *model.MCPService) time.Time { return svc.UpdatedAt.Add(time.Minute) }, false, "old_tool", false},
+		{"stale cache is refreshed", func(svc *model.MCPService) time.Time { return svc.UpdatedAt.Add(-time.Hour) }, false, "new_tool", true},
+		{"slow refresh falls back to cache", func(svc *model.MCPService) time.Time { return svc.UpdatedAt.Add(-time.Hour) }, true, "old_tool", true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched := false
+			proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+				fetched = true
+				if tt.hang {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				return &proxy.SharedMcpInstance{Client: cli}, nil
+			}
+
+			svc := &model.MCPService{Name: "svc-stale-" + string(rune('a'+i)), DisplayName: "Stale", Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+			assert.NoError(t, model.CreateService(svc))
+			proxy.GetToolsCacheManager().SetServiceTools(svc.ID, &proxy.ToolsCacheEntry{Tools: oldTools, FetchedAt: tt.fetchedAt(svc)})
+			defer proxy.GetToolsCacheManager().DeleteServiceTools(svc.ID)
+
+			group := &model.MCPServiceGroup{UserID: 1, Name: "group-stale-" + string(rune('a'+i)), DisplayName: "Stale", Enabled: true}
+			group.SetServiceIDs([]int64{svc.ID})
+			assert.NoError(t, group.Insert())
+
+			start := time.Now()
+			buf, err := buildSkillZip(context.Background(), group, &model.User{Token: "tok"}, "http://localhost", emptyToolsInclude)
+			assert.NoError(t, err)
+			assert.Less(t, time.Since(start), 2*time.Second)
+			assert.Equal(t, tt.wantFetch, fetched)
+
+			toolsMD := readZipFile(t, buf, "tools/"+svc.Name+".md")
+			assert.Contains(t, toolsMD, tt.wantTool)
+			if tt.hang {
+				// 刷新失败后的退避期内直接使用缓存，不再等待上游
+				fetched = false
+				buf, err = buildSkillZip(context.Background(), group, &model.User{Token: "tok"}, "http://localhost", emptyToolsInclude)
+				assert.NoError(t, err)
+				assert.False(t, fetched)
+				assert.Contains(t, readZipFile(t, buf, "tools/"+svc.Name+".md"), "old_tool")
+			}
+			if tt.wantTool == "new_tool" {
+				assert.NotContains(t, toolsMD, "old_tool")
+				entry, ok := proxy.GetToolsCacheManager().GetServiceTools(svc.ID)
+				if assert.True(t, ok) {
+					assert.Equal(t, "new_tool", entry.Tools[0].Name)
+					assert.False(t, isToolsCacheStale(svc, entry))
+				}
+			}
+		})
+	}
+}
+
+func TestBuildSkillZipEmptyToolsPolicy(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	// 上游可以连接但没有任何工具
+	empty := mcpserver.NewMCPServer("empty", "1.0.0", mcpserver.WithToolCapabilities(false))
+	cli, err := mcpclient.NewInProcessClient(empty)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	working := &model.MCPService{Name: "svc-working", DisplayName: "Working", Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+	noTools := &model.MCPService{Name: "svc-no-tools", DisplayName: "No Tools", Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+	broken := &model.MCPService{Name: "svc-broken", DisplayName: "Broken", Type: model.ServiceTypeStdio, Command: "echo", Enabled: true}
+	for _, svc := range []*model.MCPService{working, noTools, broken} {
+		assert.NoError(t, model.CreateService(svc))
+		defer proxy.GetToolsCacheManager().DeleteServiceTools(svc.ID)
+	}
+	proxy.GetToolsCacheManager().SetServiceTools(working.ID, &proxy.ToolsCacheEntry{
+		Tools:     []mcp.Tool{{Name: "work", InputSchema: mcp.ToolInputSchema{Type: "object"}}},
+		FetchedAt: working.UpdatedAt.Add(time.Minute),
+	})
+
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		if svc.ID == broken.ID {
+			return nil, errors.New("connection refused")
+		}
+		return &proxy.SharedMcpInstance{Client: cli}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	group := &model.MCPServiceGroup{UserID: 1, Name: "group-empty-tools", DisplayName: "Empty Tools", Enabled: true}
+	group.SetServiceIDs([]int64{working.ID, noTools.ID, broken.ID})
+	assert.NoError(t, group.Insert())
+	build := func(policy emptyToolsPolicy) (*bytes.Buffer, error) {
+		return buildSkillZip(context.Background(), group, &model.User{Token: "tok"}, "http://localhost", policy)
+	}
+
+	t.Run("include notes why the tools are unavailable", func(t *testing.T) {
+		buf, err := build(emptyToolsInclude)
+		assert.NoError(t, err)
+		assert.Contains(t, readZipFile(t, buf, "tools/svc-no-tools.md"), "**Tools unavailable:** the service reported no tools")
+		assert.Contains(t, readZipFile(t, buf, "tools/svc-broken.md"), "**Tools unavailable:** fetching tools failed")
+		assert.Contains(t, readZipFile(t, buf, "tools/svc-broken.md"), "connection refused")
+		skillMD := readZipFile(t, buf, "SKILL.md")
+		assert.Contains(t, skillMD, "### svc-broken (0 tools)")
+		assert.Contains(t, skillMD, "> **Tools unavailable:** the service reported no tools")
+		assert.NotContains(t, readZipFile(t, buf, "tools/svc-working.md"), "Tools unavailable")
+	})
+
+	t.Run("skip leaves the services out", func(t *testing.T) {
+		buf, err := build(emptyToolsSkip)
+		assert.NoError(t, err)
+		skillMD := readZipFile(t, buf, "SKILL.md")
+		assert.Contains(t, skillMD, "svc-working")
+		assert.NotContains(t, skillMD, "svc-no-tools")
+		assert.NotContains(t, skillMD, "svc-broken")
+		mcpConfig := readZipFile(t, buf, "mcp-config.json")
+		assert.Contains(t, mcpConfig, "svc-working")
+		assert.NotContains(t, mcpConfig, "svc-broken")
+		reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		for _, f := range reader.File {
+			assert.NotEqual(t, "tools/svc-no-tools.md", f.Name)
+		}
+	})
+
+	t.Run("fail reports each service and reason", func(t *testing.T) {
+		_, err := build(emptyToolsFail)
+		var emptyErr *emptyToolsError
+		if assert.ErrorAs(t, err, &emptyErr) {
+			assert.Equal(t, []string{"svc-no-tools: the service reported no tools", "svc-broken: fetching tools failed: failed to fetch tools from svc-broken: connection refused"}, emptyErr.reasons)
+		}
+	})
+}
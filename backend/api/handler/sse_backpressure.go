@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// errSSEClientGone is returned to the SSE handler once its client has been dropped or has gone away
+var errSSEClientGone = errors.New("sse client connection closed")
+
+// sseBufferFullTimeout is how long a write may wait for room in a full buffer before the client is
+// considered too slow; short bursts above the buffer size are absorbed instead of dropping the client.
+var sseBufferFullTimeout = 5 * time.Second
+
+// sseDropNoticeTimeout bounds the best-effort write of the drop reason to a client that is already behind
+const sseDropNoticeTimeout = 500 * time.Millisecond
+
+// sseSlowClientDrops counts, per service, downstream SSE clients dropped for not keeping up
+var sseSlowClientDrops sync.Map // serviceID -> *atomic.Int64
+
+func recordSSESlowClientDrop(serviceID int64) {
+	value, _ := sseSlowClientDrops.LoadOrStore(serviceID, &atomic.Int64{})
+	value.(*atomic.Int64).Add(1)
+}
+
+// sseSlowClientDropCount returns how many SSE clients of the service have been dropped since process start
+func sseSlowClientDropCount(serviceID int64) int64 {
+	if value, ok := sseSlowClientDrops.Load(serviceID); ok {
+		return value.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// sseBackpressureWriter decouples the SSE handler from the client connection: events are queued into a
+// bounded buffer and written by a separate goroutine. A full buffer blocks the handler (backpressure);
+// if it stays full for sseBufferFullTimeout the client is dropped: the request context is cancelled so
+// the handler stops, and pending writes are aborted.
+type sseBackpressureWriter struct {
+	w       http.ResponseWriter
+	queue   chan []byte
+	cancel  context.CancelFunc
+	dropped atomic.Bool // client dropped for being too slow
+	failed  atomic.Bool // writing to the client failed (e.g. it disconnected)
+	done    chan struct{}
+}
+
+func newSSEBackpressureWriter(w http.ResponseWriter, limit int, cancel context.CancelFunc) *sseBackpressureWriter {
+	s := &sseBackpressureWriter{
+		w:      w,
+		queue:  make(chan []byte, limit),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.drain()
+	return s
+}
+
+func (s *sseBackpressureWriter) Header() http.Header {
+	return s.w.Header()
+}
+
+func (s *sseBackpressureWriter) WriteHeader(statusCode int) {
+	s.w.WriteHeader(statusCode)
+}
+
+func (s *sseBackpressureWriter) Write(p []byte) (int, error) {
+	if s.dropped.Load() || s.failed.Load() {
+		return 0, errSSEClientGone
+	}
+	event := append([]byte(nil), p...)
+	select {
+	case s.queue <- event:
+		return len(p), nil
+	default:
+	}
+	timer := time.NewTimer(sseBufferFullTimeout)
+	defer timer.Stop()
+	select {
+	case s.queue <- event:
+		return len(p), nil
+	case <-timer.C:
+		s.drop()
+		return 0, errSSEClientGone
+	}
+}
+
+// Flush is a no-op: the drain goroutine flushes after every event it writes
+func (s *sseBackpressureWriter) Flush() {}
+
+func (s *sseBackpressureWriter) drop() {
+	if !s.dropped.CompareAndSwap(false, true) {
+		return
+	}
+	s.cancel()
+	// 不让卡住的写操作无限等待：给出很短的时间写完当前事件与断开原因
+	_ = http.NewResponseController(s.w).SetWriteDeadline(time.Now().Add(sseDropNoticeTimeout))
+}
+
+func (s *sseBackpressureWriter) drain() {
+	defer close(s.done)
+	flusher, _ := s.w.(http.Flusher)
+	for event := range s.queue {
+		if s.dropped.Load() || s.failed.Load() {
+			continue
+		}
+		if _, err := s.w.Write(event); err != nil {
+			s.failed.Store(true)
+			s.cancel()
+			continue
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// close waits for the drain goroutine; it must be called once the SSE handler has returned.
+// It reports whether the client was dropped for being too slow.
+func (s *sseBackpressureWriter) close(reason string) bool {
+	close(s.queue)
+	<-s.done
+	if !s.dropped.Load() {
+		return false
+	}
+	_, _ = fmt.Fprintf(s.w, "event: error\ndata: {\"error\":%q}\n\n", reason)
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return true
+}
+
+// serveSSEWithBackpressure serves an SSE stream through a bounded event buffer; a client that stays
+// more than limit events behind is disconnected, logged and counted in the service metrics.
+func serveSSEWithBackpressure(w http.ResponseWriter, r *http.Request, handler http.Handler, svc *model.MCPService, limit int) {
+	if limit <= 0 {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	writer := newSSEBackpressureWriter(w, limit, cancel)
+	handler.ServeHTTP(writer, r.WithContext(ctx))
+
+	reason := fmt.Sprintf("client fell more than %d events behind, connection closed", limit)
+	if writer.close(reason) {
+		recordSSESlowClientDrop(svc.ID)
+		msg := fmt.Sprintf("[SSE] Dropped slow client of %s (ID: %d): %s", svc.Name, svc.ID, reason)
+		common.SysLog(msg)
+		if err := model.SaveMCPLog(context.Background(), svc.ID, svc.Name, model.MCPLogPhaseRun, model.MCPLogLevelWarn, msg); err != nil {
+			common.SysError(fmt.Sprintf("Failed to save SSE drop log for %s: %v", svc.Name, err))
+		}
+	}
+}
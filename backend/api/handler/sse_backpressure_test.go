@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// floodingSSEHandler 持续推送大事件直到请求被取消，或推送 maxEvents 个后返回
+func floodingSSEHandler(eventSize, maxEvents int, finished chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(finished)
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		payload := strings.Repeat("x", eventSize)
+		for i := 0; maxEvents <= 0 || i < maxEvents; i++ {
+			select {
+			case <-r.Context().Done():
+				return
+			default:
+			}
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", payload)
+			flusher.Flush()
+		}
+	})
+}
+
+func TestServeSSEWithBackpressure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+	originalTimeout := sseBufferFullTimeout
+	sseBufferFullTimeout = 200 * time.Millisecond
+	defer func() { sseBufferFullTimeout = originalTimeout }()
+
+	tests := []struct {
+		name      string
+		serviceID int64
+		eventSize int
+		maxEvents int
+		slow      bool
+		wantDrop  bool
+	}{
+		{"slow reader is dropped after the buffer fills", 938001, 64 * 1024, 0, true, true},
+		{"fast reader receives a burst larger than the buffer", 938002, 16, 200, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sseSlowClientDrops.Delete(tt.serviceID)
+			finished := make(chan struct{})
+			svc := &model.MCPService{Name: "sse-svc", Type: model.ServiceTypeSSE}
+			svc.ID = tt.serviceID
+
+			router := gin.New()
+			router.GET("/sse", func(c *gin.Context) {
+				serveSSEWithBackpressure(c.Writer, c.Request, floodingSSEHandler(tt.eventSize, tt.maxEvents, finished), svc, 4)
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/sse")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			if tt.slow {
+				// 不读取响应，处理器应在缓冲区写满后被取消，而不是无限推送
+				select {
+				case <-finished:
+				case <-time.After(10 * time.Second):
+					t.Fatal("slow client was never dropped")
+				}
+			}
+
+			done := make(chan string, 1)
+			go func() {
+				data, _ := io.ReadAll(resp.Body)
+				done <- string(data)
+			}()
+			var body string
+			select {
+			case body = <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("connection was not closed")
+			}
+
+			if tt.wantDrop {
+				assert.Equal(t, int64(1), sseSlowClientDropCount(tt.serviceID))
+				return
+			}
+			assert.Equal(t, int64(0), sseSlowClientDropCount(tt.serviceID))
+			assert.Equal(t, tt.maxEvents, strings.Count(body, "event: message"))
+			assert.NotContains(t, body, "event: error")
+		})
+	}
+}
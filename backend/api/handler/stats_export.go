@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	statsExportDateLayout = "2006-01-02"
+	// statsExportFlushEvery is the number of rows written between flushes to the client
+	statsExportFlushEvery = 200
+	// defaultStatsExportDays is the length of the date range exported when none is given
+	defaultStatsExportDays = 7
+)
+
+var rawStatsCSVHeader = []string{"id", "created_at", "service_id", "service_name", "user_id", "request_type", "method", "request_path", "response_time_ms", "status_code", "success"}
+
+var dailyStatsCSVHeader = []string{"date", "service_id", "service_name", "requests", "successful_requests", "failed_requests", "avg_response_time_ms", "max_response_time_ms"}
+
+// dailyStat aggregates the requests of one service on one day
+type dailyStat struct {
+	date        string
+	serviceID   int64
+	serviceName string
+	requests    int64
+	successes   int64
+	totalTimeMs int64
+	maxTimeMs   int64
+}
+
+// ExportStats godoc
+// @Summary 导出请求统计
+// @Description 以 CSV 流式导出日期范围内的 tools/call 请求统计；mode=raw 导出逐条记录，mode=daily 按天和服务汇总。管理员和观察者可导出全部数据（可按 user_id 过滤），普通用户只能导出自己的数据
+// @Tags Analytics
+// @Produce text/csv
+// @Param format query string false "导出格式，目前仅支持 csv"
+// @Param mode query string false "raw(默认) 或 daily"
+// @Param start_date query string false "开始日期 YYYY-MM-DD，默认为结束日期前 6 天"
+// @Param end_date query string false "结束日期 YYYY-MM-DD（含），默认为今天"
+// @Param service_id query int false "服务ID"
+// @Param user_id query int false "用户ID（仅管理员和观察者）"
+// @Security ApiKeyAuth
+// @Success 200 {string} string "CSV"
+// @Failure 400 {object} common.APIResponse
+// @Router /api/stats/export [get]
+func ExportStats(c *gin.Context) {
+	lang := c.GetString("lang")
+	if format := c.DefaultQuery("format", "csv"); format != "csv" {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_export_format", lang))
+		return
+	}
+	mode := c.DefaultQuery("mode", "raw")
+	if mode != "raw" && mode != "daily" {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_stats_export_mode", lang))
+		return
+	}
+	from, to, err := parseStatsExportRange(c.Query("start_date"), c.Query("end_date"))
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_date_range", lang), err)
+		return
+	}
+	filter := model.ProxyRequestStatFilter{From: from, To: to}
+	if raw := c.Query("service_id"); raw != "" {
+		if filter.ServiceID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+			return
+		}
+	}
+	// 普通用户只能导出自己的请求统计，管理员和观察者可导出全部
+	if c.GetInt("role") >= common.RoleObserverUser {
+		if raw := c.Query("user_id"); raw != "" {
+			if filter.UserID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+				common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+				return
+			}
+		}
+	} else {
+		filter.UserID = c.GetInt64("user_id")
+	}
+	if _, err := model.GetProxyRequestStatThing(); err != nil {
+		common.RespError(c, http.StatusInternalServerError, "Error accessing statistics data store", err)
+		return
+	}
+
+	filename := fmt.Sprintf("stats-%s-%s-%s.csv", mode, from.Format(statsExportDateLayout), to.AddDate(0, 0, -1).Format(statsExportDateLayout))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if mode == "daily" {
+		err = writeDailyStatsCSV(writer, filter)
+	} else {
+		err = writeRawStatsCSV(c, writer, filter)
+	}
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		// 响应头已发出，只能记录错误并截断输出
+		common.SysError(fmt.Sprintf("[ExportStats] Failed to export stats: %v", err))
+	}
+}
+
+// parseStatsExportRange returns the [from, to) range of the inclusive start and end dates
+func parseStatsExportRange(startDate, endDate string) (time.Time, time.Time, error) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if endDate != "" {
+		parsed, err := time.ParseInLocation(statsExportDateLayout, endDate, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end_date %q, expected YYYY-MM-DD", endDate)
+		}
+		end = parsed
+	}
+	start := end.AddDate(0, 0, -(defaultStatsExportDays - 1))
+	if startDate != "" {
+		parsed, err := time.ParseInLocation(statsExportDateLayout, startDate, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start_date %q, expected YYYY-MM-DD", startDate)
+		}
+		start = parsed
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_date %s is after end_date %s", start.Format(statsExportDateLayout), end.Format(statsExportDateLayout))
+	}
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+// writeRawStatsCSV streams one row per recorded request, flushing to the client as it goes
+func writeRawStatsCSV(c *gin.Context, writer *csv.Writer, filter model.ProxyRequestStatFilter) error {
+	if err := writer.Write(rawStatsCSVHeader); err != nil {
+		return err
+	}
+	rows := 0
+	return model.EachProxyRequestStat(filter, func(stat *model.ProxyRequestStat) error {
+		err := writer.Write([]string{
+			strconv.FormatInt(stat.ID, 10),
+			stat.CreatedAt.Format(time.RFC3339),
+			strconv.FormatInt(stat.ServiceID, 10),
+			csvSafe(stat.ServiceName),
+			strconv.FormatInt(stat.UserID, 10),
+			string(stat.RequestType),
+			csvSafe(stat.Method),
+			csvSafe(stat.RequestPath),
+			strconv.FormatInt(stat.ResponseTimeMs, 10),
+			strconv.Itoa(stat.StatusCode),
+			strconv.FormatBool(stat.Success),
+		})
+		if err != nil {
+			return err
+		}
+		if rows++; rows%statsExportFlushEvery == 0 {
+			writer.Flush()
+			c.Writer.Flush()
+			return writer.Error()
+		}
+		return nil
+	})
+}
+
+// writeDailyStatsCSV writes one row per service and day, ordered by date and service ID
+func writeDailyStatsCSV(writer *csv.Writer, filter model.ProxyRequestStatFilter) error {
+	byKey := map[string]*dailyStat{}
+	err := model.EachProxyRequestStat(filter, func(stat *model.ProxyRequestStat) error {
+		date := stat.CreatedAt.In(time.Local).Format(statsExportDateLayout)
+		key := date + "/" + strconv.FormatInt(stat.ServiceID, 10)
+		day, ok := byKey[key]
+		if !ok {
+			day = &dailyStat{date: date, serviceID: stat.ServiceID, serviceName: stat.ServiceName}
+			byKey[key] = day
+		}
+		day.requests++
+		if stat.Success {
+			day.successes++
+		}
+		day.totalTimeMs += stat.ResponseTimeMs
+		day.maxTimeMs = max(day.maxTimeMs, stat.ResponseTimeMs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	days := make([]*dailyStat, 0, len(byKey))
+	for _, day := range byKey {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].date != days[j].date {
+			return days[i].date < days[j].date
+		}
+		return days[i].serviceID < days[j].serviceID
+	})
+	if err := writer.Write(dailyStatsCSVHeader); err != nil {
+		return err
+	}
+	for _, day := range days {
+		err := writer.Write([]string{
+			day.date,
+			strconv.FormatInt(day.serviceID, 10),
+			csvSafe(day.serviceName),
+			strconv.FormatInt(day.requests, 10),
+			strconv.FormatInt(day.successes, 10),
+			strconv.FormatInt(day.requests-day.successes, 10),
+			strconv.FormatFloat(float64(day.totalTimeMs)/float64(day.requests), 'f', 1, 64),
+			strconv.FormatInt(day.maxTimeMs, 10),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvSafe keeps spreadsheet applications from evaluating a text cell as a formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportStatsCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	model.RecordRequestStat(96601, "search", 9661, "", model.ProxyRequestTypeHTTP, "tools/call", "/proxy/search/mcp", 100, 200, true)
+	model.RecordRequestStat(96601, "search", 9661, "", model.ProxyRequestTypeHTTP, "tools/call", "/proxy/search/mcp", 300, 500, false)
+	model.RecordRequestStat(96602, "=cmd", 9662, "", model.ProxyRequestTypeSSE, "tools/call", "/proxy/cmd/message", 50, 202, true)
+
+	export := func(role int, userID int64, query string) (*httptest.ResponseRecorder, [][]string) {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Set("role", role)
+		ctx.Set("user_id", userID)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/api/stats/export?"+query, nil)
+		ExportStats(ctx)
+		if recorder.Code != http.StatusOK {
+			return recorder, nil
+		}
+		records, err := csv.NewReader(strings.NewReader(recorder.Body.String())).ReadAll()
+		assert.NoError(t, err)
+		return recorder, records
+	}
+	today := time.Now().Format(statsExportDateLayout)
+
+	recorder, records := export(common.RoleAdminUser, 1, "format=csv")
+	assert.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Header().Get("Content-Disposition"), "attachment;")
+	assert.Equal(t, rawStatsCSVHeader, records[0])
+	assert.Len(t, records, 4)
+	assert.Equal(t, []string{"96601", "search", "9661", "http", "tools/call", "/proxy/search/mcp", "100", "200", "true"}, records[1][2:])
+	// 以公式字符开头的文本单元格会被转义
+	assert.Equal(t, "'=cmd", records[3][3])
+
+	// 普通用户只能导出自己的记录，user_id 参数被忽略
+	_, records = export(common.RoleCommonUser, 9662, "format=csv&user_id=9661")
+	assert.Len(t, records, 2)
+	assert.Equal(t, "9662", records[1][4])
+
+	_, records = export(common.RoleAdminUser, 1, "format=csv&mode=daily&service_id=96601&start_date="+today+"&end_date="+today)
+	assert.Equal(t, [][]string{dailyStatsCSVHeader, {today, "96601", "search", "2", "1", "1", "200.0", "300"}}, records)
+
+	// 日期范围之外没有数据
+	yesterday := time.Now().AddDate(0, 0, -1).Format(statsExportDateLayout)
+	_, records = export(common.RoleAdminUser, 1, "format=csv&end_date="+yesterday)
+	assert.Equal(t, [][]string{rawStatsCSVHeader}, records)
+
+	for _, query := range []string{"format=json", "mode=hourly", "start_date=2024-02-10&end_date=2024-02-01", "end_date=yesterday"} {
+		recorder, _ = export(common.RoleAdminUser, 1, query)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+}
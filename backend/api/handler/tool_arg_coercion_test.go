@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+var coercionTestTool = mcp.Tool{
+	Name: "search",
+	InputSchema: mcp.ToolInputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"limit":   map[string]any{"type": "integer"},
+			"ratio":   map[string]any{"type": "number"},
+			"verbose": map[string]any{"type": "boolean"},
+			"query":   map[string]any{"type": "string"},
+			"page":    map[string]any{"type": []any{"integer", "string"}},
+			"filter":  map[string]any{"type": "object", "properties": map[string]any{"min": map[string]any{"type": "number"}}},
+			"ids":     map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+		},
+	},
+}
+
+func TestExecuteGroupToolCoercesArgumentsWhenEnabled(t *testing.T) {
+	teardown := setupGroupTestDB(t)
+	defer teardown()
+
+	var received map[string]any
+	upstream := mcpserver.NewMCPServer("coerce", "1.0.0")
+	upstream.AddTool(coercionTestTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		received = request.GetArguments()
+		return mcp.NewToolResultText("ok"), nil
+	})
+	cli, err := mcpclient.NewInProcessClient(upstream)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	original := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, svc *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Client: cli}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	tests := []struct {
+		name   string
+		coerce bool
+		want   map[string]any
+	}{
+		// 参数经 JSON 传输，数字在上游解码为 float64
+		{"enabled", true, map[string]any{"limit": float64(10), "verbose": true}},
+		{"disabled by default", false, map[string]any{"limit": "10", "verbose": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &model.MCPService{
+				Name:            "svc-coerce-" + tt.name,
+				DisplayName:     "Coerce",
+				Type:            model.ServiceTypeStdio,
+				Command:         "echo",
+				ArgsJSON:        `[]`,
+				Enabled:         true,
+				CoerceArguments: tt.coerce,
+			}
+			assert.NoError(t, model.CreateService(svc))
+			proxy.GetToolsCacheManager().SetServiceTools(svc.ID, &proxy.ToolsCacheEntry{Tools: []mcp.Tool{coercionTestTool}})
+			defer proxy.GetToolsCacheManager().DeleteServiceTools(svc.ID)
+
+			group := &model.MCPServiceGroup{UserID: 1, Name: "group-coerce-" + tt.name, DisplayName: "Coerce", Enabled: true}
+			group.SetServiceIDs([]int64{svc.ID})
+			assert.NoError(t, group.Insert())
+
+			_, err := executeGroupTool(context.Background(), group, &executeArgs{
+				MCPName:   svc.Name,
+				ToolName:  "search",
+				Arguments: map[string]any{"limit": "10", "verbose": "true"},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, received)
+		})
+	}
+}
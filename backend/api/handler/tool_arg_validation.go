@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"one-mcp/backend/library/proxy"
+
+	mcp "github.com/mark3labs/mcp-go/mcp"
+)
+
+// applyToolArgumentDefaults returns a copy of args in which top-level properties that are missing but
+// declare a "default" in the tool's input schema are filled in, together with the defaults that were applied.
+func applyToolArgumentDefaults(tool mcp.Tool, args map[string]any) (map[string]any, map[string]any) {
+	out := make(map[string]any, len(args))
+	for key, value := range args {
+		out[key] = value
+	}
+	applied := map[string]any{}
+	for key, raw := range tool.InputSchema.Properties {
+		schema, _ := raw.(map[string]any)
+		if schema == nil {
+			continue
+		}
+		if _, exists := out[key]; exists {
+			continue
+		}
+		if def, ok := schema["default"]; ok {
+			out[key] = def
+			applied[key] = def
+		}
+	}
+	return out, applied
+}
+
+// validateToolArguments checks args against the tool's input schema and returns one message per problem.
+// Only the commonly used keywords are checked: required, type, enum, and nested properties/items.
+func validateToolArguments(tool mcp.Tool, args map[string]any) []string {
+	var errs []string
+	for _, name := range tool.InputSchema.Required {
+		if _, ok := args[name]; !ok {
+			errs = append(errs, fmt.Sprintf("missing required argument %q", name))
+		}
+	}
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		schema, _ := tool.InputSchema.Properties[key].(map[string]any)
+		errs = append(errs, validateValue(key, schema, args[key])...)
+	}
+	return errs
+}
+
+func validateValue(path string, schema map[string]any, value any) []string {
+	if schema == nil {
+		return nil
+	}
+	types := proxy.SchemaTypes(schema)
+	if len(types) > 0 && !matchesSchemaType(types, value) {
+		return []string{fmt.Sprintf("argument %q must be of type %s", path, schemaTypeNames(types))}
+	}
+	if enum := schemaEnum(schema); len(enum) > 0 && !containsEnumValue(enum, value) {
+		return []string{fmt.Sprintf("argument %q must be one of %v", path, enum)}
+	}
+
+	var errs []string
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for _, name := range schemaRequired(schema) {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, fmt.Sprintf("missing required argument %q", path+"."+name))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child, _ := properties[key].(map[string]any)
+			errs = append(errs, validateValue(path+"."+key, child, v[key])...)
+		}
+	case []any:
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range v {
+			errs = append(errs, validateValue(fmt.Sprintf("%s[%d]", path, i), items, item)...)
+		}
+	}
+	return errs
+}
+
+func matchesSchemaType(types map[string]bool, value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return types["null"]
+	case string:
+		return types["string"]
+	case bool:
+		return types["boolean"]
+	case float64:
+		return types["number"] || (types["integer"] && v == math.Trunc(v))
+	case float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return types["number"] || types["integer"]
+	case map[string]any:
+		return types["object"]
+	case []any:
+		return types["array"]
+	default:
+		return true
+	}
+}
+
+func schemaTypeNames(types map[string]bool) string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 1 {
+		return names[0]
+	}
+	return fmt.Sprintf("%v", names)
+}
+
+func schemaRequired(schema map[string]any) []string {
+	switch required := schema["required"].(type) {
+	case []string:
+		return required
+	case []any:
+		names := make([]string, 0, len(required))
+		for _, item := range required {
+			if s, ok := item.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+func schemaEnum(schema map[string]any) []any {
+	switch enum := schema["enum"].(type) {
+	case []any:
+		return enum
+	case []string:
+		values := make([]any, len(enum))
+		for i, item := range enum {
+			values[i] = item
+		}
+		return values
+	}
+	return nil
+}
+
+func containsEnumValue(enum []any, value any) bool {
+	for _, candidate := range enum {
+		if reflect.DeepEqual(candidate, value) {
+			return true
+		}
+		// 数值比较忽略 int/float 的差异
+		if a, ok := toFloat(candidate); ok {
+			if b, ok := toFloat(value); ok && a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+	return 0, false
+}
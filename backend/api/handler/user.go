@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 	"strconv"
 
@@ -112,9 +116,7 @@ func GenerateToken(c *gin.Context) {
 		})
 		return
 	}
-	user.Token = model.GenerateUserToken()
-
-	if err := user.Update(false); err != nil {
+	if _, err := user.RotateToken(); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
@@ -130,6 +132,53 @@ func GenerateToken(c *gin.Context) {
 	return
 }
 
+// RotateToken replaces the current user's proxy token. The old token stops authenticating immediately;
+// requests already past authentication finish normally, later ones get an explicit "rotated" error.
+// Skill exports embed the token, so the groups to re-export are returned with the new token.
+// POST /api/user/token/rotate
+func RotateToken(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt64("user_id"), true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	token, err := user.RotateToken()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("User %d (%s) rotated the proxy token", user.ID, user.Username))
+
+	reexport := []gin.H{}
+	groups, err := model.GetMCPServiceGroupsByUserID(user.ID)
+	if err != nil {
+		common.SysError(fmt.Sprintf("Failed to list groups of user %d after token rotation: %v", user.ID, err))
+	}
+	for _, group := range groups {
+		reexport = append(reexport, gin.H{
+			"id":           group.ID,
+			"name":         group.Name,
+			"display_name": group.DisplayName,
+			"export_url":   fmt.Sprintf("/api/groups/%d/export", group.ID),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"token":           token,
+			"reexport_groups": reexport,
+		},
+	})
+}
+
 func GetSelf(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -295,7 +344,10 @@ func UpdateUser(c *gin.Context) {
 func UpdateSelf(c *gin.Context) {
 	lang := c.GetString("lang")
 	var user model.User
-	err := json.NewDecoder(c.Request.Body).Decode(&user)
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &user)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -345,6 +397,21 @@ func UpdateSelf(c *gin.Context) {
 	currentUser.Username = user.Username
 	currentUser.DisplayName = user.DisplayName
 	currentUser.Email = user.Email
+	// env_profile 仅在请求中显式提供时更新，避免旧客户端提交资料时将其清空
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) == nil {
+		if _, ok := fields["env_profile"]; ok {
+			profile, valid := model.NormalizeEnvProfileName(user.EnvProfile)
+			if !valid {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": i18n.Translate("invalid_param", lang),
+				})
+				return
+			}
+			currentUser.EnvProfile = profile
+		}
+	}
 
 	updatePassword := false
 	if user.Password != "" && user.Password != "$I_LOVE_U" {
@@ -401,6 +468,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	cleanupDeletedUser(c.Request.Context(), int64(id))
 	// 删除成功，返回成功响应
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -511,6 +579,7 @@ func DeleteSelf(c *gin.Context) {
 		})
 		return
 	}
+	cleanupDeletedUser(c.Request.Context(), id)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -518,6 +587,18 @@ func DeleteSelf(c *gin.Context) {
 	return
 }
 
+// cleanupDeletedUser 停止已删除用户的专属服务实例并删除其服务配置，避免遗留子进程；
+// 可通过 CleanupUserInstancesOnDelete 选项关闭
+func cleanupDeletedUser(ctx context.Context, userID int64) {
+	if !common.GetCleanupUserInstancesOnDelete() {
+		return
+	}
+	proxy.ShutdownUserInstances(ctx, userID)
+	if err := model.DeleteUserConfigsForUser(userID); err != nil {
+		common.SysError(fmt.Sprintf("Failed to delete service configs of deleted user %d: %v", userID, err))
+	}
+}
+
 // UserCreateRequestPayload defines the structure for a create user request.
 // It includes all fields that can be set when creating a new user, especially Password.
 type UserCreateRequestPayload struct {
@@ -654,6 +735,7 @@ func ManageUser(c *gin.Context) {
 			})
 			return
 		}
+		cleanupDeletedUser(c.Request.Context(), user.ID)
 	case "promote":
 		if myRole != common.RoleRootUser {
 			c.JSON(http.StatusOK, gin.H{
@@ -686,6 +768,22 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = common.RoleCommonUser
+	case "observe":
+		if user.Role == common.RoleRootUser {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": i18n.Translate("cannot_demote_root_user", lang),
+			})
+			return
+		}
+		if user.Role == common.RoleObserverUser {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": i18n.Translate("user_already_observer", lang),
+			})
+			return
+		}
+		user.Role = common.RoleObserverUser
 	}
 
 	// Only save if action wasn't delete
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteUserCleansUpUserInstances(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	// 上游收到 DELETE 说明实例的客户端已关闭会话
+	var sessionsClosed atomic.Int32
+	upstream := mcpserver.NewStreamableHTTPServer(mcpserver.NewMCPServer("user-upstream", "1.0.0"))
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			sessionsClosed.Add(1)
+		}
+		upstream.ServeHTTP(w, r)
+	}))
+	defer httpServer.Close()
+
+	svc := &model.MCPService{Name: "user-cleanup-svc", DisplayName: "User Cleanup", Type: model.ServiceTypeStreamableHTTP, Command: httpServer.URL + "/mcp", Enabled: true}
+	assert.NoError(t, model.CreateService(svc))
+
+	newUser := func(name string) *model.User {
+		user := &model.User{Username: name, DisplayName: name, Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+		assert.NoError(t, user.Insert())
+		assert.NoError(t, model.SaveUserConfig(&model.UserConfig{UserID: user.ID, ServiceID: svc.ID, ConfigID: 1, Value: "secret"}))
+		return user
+	}
+	deleteUser := func(user *model.User) {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Set("role", common.RoleRootUser)
+		ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(user.ID, 10)}}
+		ctx.Request = httptest.NewRequest(http.MethodDelete, "/api/user/"+strconv.FormatInt(user.ID, 10), nil)
+		DeleteUser(ctx)
+		assert.Contains(t, recorder.Body.String(), `"success":true`)
+	}
+
+	user := newUser("cleanup-user")
+	cacheKey := proxy.UserServiceCacheKey(user.ID, svc.ID)
+	instance, err := proxy.GetOrCreateSharedMcpInstanceWithKey(context.Background(), svc, cacheKey, "user-cleanup-test", "{}")
+	assert.NoError(t, err)
+
+	deleteUser(user)
+	assert.Equal(t, int32(1), sessionsClosed.Load(), "the user's instance should be shut down")
+	configs, err := model.GetUserConfigsForUser(user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, configs)
+
+	// 实例已从缓存中移除，再次获取会创建新实例
+	recreated, err := proxy.GetOrCreateSharedMcpInstanceWithKey(context.Background(), svc, cacheKey, "user-cleanup-test", "{}")
+	assert.NoError(t, err)
+	assert.NotSame(t, instance, recreated)
+	assert.Equal(t, 1, proxy.ShutdownUserInstances(context.Background(), user.ID))
+
+	// 通过管理接口删除用户同样会清理
+	managed := newUser("managed-user")
+	_, err = proxy.GetOrCreateSharedMcpInstanceWithKey(context.Background(), svc, proxy.UserServiceCacheKey(managed.ID, svc.ID), "user-cleanup-test", "{}")
+	assert.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Set("role", common.RoleRootUser)
+	ctx.Request = newJSONRequest(t, http.MethodPost, "/api/user/manage", map[string]string{"username": managed.Username, "action": "delete"})
+	ManageUser(ctx)
+	assert.Contains(t, recorder.Body.String(), `"success":true`)
+	assert.Equal(t, int32(3), sessionsClosed.Load(), "the managed user's instance should be shut down")
+	configs, err = model.GetUserConfigsForUser(managed.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, configs)
+
+	// 关闭清理后保留用户配置
+	originalOption := common.OptionMap[common.OptionCleanupUserInstancesOnDelete]
+	common.OptionMap[common.OptionCleanupUserInstancesOnDelete] = "false"
+	defer func() { common.OptionMap[common.OptionCleanupUserInstancesOnDelete] = originalOption }()
+	kept := newUser("kept-user")
+	deleteUser(kept)
+	configs, err = model.GetUserConfigsForUser(kept.ID)
+	assert.NoError(t, err)
+	assert.Len(t, configs, 1)
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValidateAllServices godoc
+// @Summary 校验所有已启用的MCP服务
+// @Description 以有限并发为每个已启用服务创建一次性实例并完成 initialize，返回各服务通过/失败及错误，不影响运行中的实例；客户端断开或超过 max_duration_seconds 时停止，未完成的服务记为失败
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param body body object false "concurrency(默认4，最大32)、timeout_seconds(单个服务，默认30，最大300)、max_duration_seconds(默认300，最大1800)"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse{data=proxy.ServiceValidationReport}
+// @Failure 400 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/admin/validate_all [post]
+func ValidateAllServices(c *gin.Context) {
+	lang := c.GetString("lang")
+	var requestBody struct {
+		Concurrency        int `json:"concurrency"`
+		TimeoutSeconds     int `json:"timeout_seconds"`
+		MaxDurationSeconds int `json:"max_duration_seconds"`
+	}
+	if c.Request.Body != nil {
+		if err := c.ShouldBindJSON(&requestBody); err != nil && !errors.Is(err, io.EOF) {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+			return
+		}
+	}
+	if requestBody.Concurrency < 0 || requestBody.TimeoutSeconds < 0 || requestBody.MaxDurationSeconds < 0 {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang))
+		return
+	}
+	concurrency := min(requestBody.Concurrency, proxy.MaxValidateConcurrency)
+	timeout := min(time.Duration(requestBody.TimeoutSeconds)*time.Second, proxy.MaxValidateTimeout)
+	maxDuration := proxy.DefaultValidateMaxDuration
+	if requestBody.MaxDurationSeconds > 0 {
+		maxDuration = min(time.Duration(requestBody.MaxDurationSeconds)*time.Second, proxy.MaxValidateMaxDuration)
+	}
+
+	services, err := model.GetEnabledServices()
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_service_list_failed", lang), err)
+		return
+	}
+
+	// 请求取消（客户端断开）或超过整体时长时停止校验
+	ctx, cancel := context.WithTimeout(c.Request.Context(), maxDuration)
+	defer cancel()
+	report := proxy.ValidateServices(ctx, services, concurrency, timeout)
+	common.SysLog(fmt.Sprintf("Validated %d enabled services: %d passed, %d failed (canceled: %t, %dms)", report.Total, report.Passed, report.Failed, report.Canceled, report.DurationMs))
+	common.RespSuccess(c, report)
+}
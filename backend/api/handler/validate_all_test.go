@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAllServices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := setupGroupTestDB(t)
+	defer cleanup()
+
+	upstream := mcpserver.NewMCPServer("valid-upstream", "1.2.3", mcpserver.WithToolCapabilities(true))
+	upstream.AddTool(mcp.NewTool("noop"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	validServer := httptest.NewServer(mcpserver.NewStreamableHTTPServer(upstream))
+	defer validServer.Close()
+	brokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer brokenServer.Close()
+	hangingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reading the body lets the server notice when the client gives up
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer hangingServer.Close()
+
+	services := []*model.MCPService{
+		{Name: "validate-ok", DisplayName: "OK", Type: model.ServiceTypeStreamableHTTP, Command: validServer.URL + "/mcp", Enabled: true},
+		{Name: "validate-broken", DisplayName: "Broken", Type: model.ServiceTypeStreamableHTTP, Command: brokenServer.URL + "/mcp", Enabled: true},
+		{Name: "validate-hanging", DisplayName: "Hanging", Type: model.ServiceTypeStreamableHTTP, Command: hangingServer.URL + "/mcp", Enabled: true},
+		{Name: "validate-fallback", DisplayName: "Fallback", Type: model.ServiceTypeStreamableHTTP, Command: brokenServer.URL + "/mcp", FallbackEndpointsJSON: `["` + validServer.URL + `/mcp"]`, Enabled: true},
+		{Name: "validate-disabled", DisplayName: "Disabled", Type: model.ServiceTypeStreamableHTTP, Command: brokenServer.URL + "/mcp"},
+	}
+	for _, svc := range services {
+		assert.NoError(t, model.CreateService(svc))
+	}
+
+	validate := func(ctx context.Context, body string) proxy.ServiceValidationReport {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = newJSONRequest(t, http.MethodPost, "/api/admin/validate_all", json.RawMessage(body)).WithContext(ctx)
+		ValidateAllServices(c)
+		assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		response := decodeAPIResponse(t, recorder)
+		assert.True(t, response.Success, response.Message)
+		var report proxy.ServiceValidationReport
+		assert.NoError(t, json.Unmarshal(response.Data, &report))
+		return report
+	}
+
+	report := validate(context.Background(), `{"concurrency": 2, "timeout_seconds": 1}`)
+	assert.False(t, report.Canceled)
+	assert.Equal(t, 4, report.Total, "disabled services are not validated")
+	assert.Equal(t, 2, report.Passed)
+	assert.Equal(t, 2, report.Failed)
+	results := map[string]proxy.ServiceValidationResult{}
+	for _, result := range report.Results {
+		results[result.Name] = result
+	}
+	assert.NotContains(t, results, "validate-disabled")
+	if ok := results["validate-ok"]; assert.True(t, ok.Passed, ok.Error) {
+		assert.Equal(t, "valid-upstream", ok.ServerName)
+		assert.Equal(t, "1.2.3", ok.ServerVersion)
+		assert.Equal(t, 1, ok.ToolCount)
+	}
+	assert.False(t, results["validate-broken"].Passed)
+	assert.NotEmpty(t, results["validate-broken"].Error)
+	assert.False(t, results["validate-hanging"].Passed)
+	assert.Contains(t, results["validate-hanging"].Error, context.DeadlineExceeded.Error())
+	assert.Less(t, results["validate-hanging"].DurationMs, int64(5000), "the per-service timeout bounds the initialize")
+	if fallback := results["validate-fallback"]; assert.True(t, fallback.Passed, fallback.Error) {
+		assert.Equal(t, validServer.URL+"/mcp", fallback.Endpoint)
+	}
+
+	// A canceled request stops the run; services not yet validated fail
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	report = validate(canceled, `{}`)
+	assert.True(t, report.Canceled)
+	assert.Equal(t, 4, report.Failed)
+	for _, result := range report.Results {
+		assert.NotEmpty(t, result.Error)
+	}
+}
+
+func TestValidateAllServicesRejectsInvalidParameters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = newJSONRequest(t, http.MethodPost, "/api/admin/validate_all", map[string]int{"concurrency": -1})
+	ValidateAllServices(c)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaOrderKeys are per-property hints some servers emit to preserve declaration order
+var schemaOrderKeys = []string{"x-order", "propertyOrder"}
+
+// orderedProperties serializes JSON schema properties as a YAML mapping with a stable key order,
+// so search_tools output and skill exports are identical between runs.
+type orderedProperties struct {
+	keys   []string
+	values map[string]any
+}
+
+func newOrderedProperties(props map[string]any) *orderedProperties {
+	if len(props) == 0 {
+		return nil
+	}
+	return &orderedProperties{keys: sortedPropertyNames(props), values: props}
+}
+
+func (p *orderedProperties) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range p.keys {
+		var value yaml.Node
+		if err := value.Encode(p.values[key]); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &value)
+	}
+	return node, nil
+}
+
+// sortedPropertyNames orders properties by a schema-provided order hint first, then by name
+func sortedPropertyNames(props map[string]any) []string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		oi, hasI := propertyOrderHint(props[names[i]])
+		oj, hasJ := propertyOrderHint(props[names[j]])
+		if hasI != hasJ {
+			return hasI
+		}
+		if hasI && oi != oj {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func propertyOrderHint(prop any) (float64, bool) {
+	propMap, ok := prop.(map[string]any)
+	if !ok {
+		return 0, false
+	}
+	for _, key := range schemaOrderKeys {
+		switch v := propMap[key].(type) {
+		case float64:
+			return v, true
+		case int:
+			return float64(v), true
+		case int64:
+			return float64(v), true
+		}
+	}
+	return 0, false
+}
+
+// sortToolsByName returns a copy of tools sorted by name, leaving the caller's slice untouched
+func sortToolsByName(tools []mcp.Tool) []mcp.Tool {
+	sorted := make([]mcp.Tool, len(tools))
+	copy(sorted, tools)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
@@ -84,6 +84,10 @@ func TokenAuth() gin.HandlerFunc {
 		var userID int64
 		var username string
 		var role int
+		var envProfile string
+		// 按令牌计数的限额所用的令牌标识；会话和 SSO 请求与令牌共用同一计数
+		var limitCredentialID string
+		var mustChangePassword bool
 
 		// First, try to get user token from Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -96,6 +100,9 @@ func TokenAuth() gin.HandlerFunc {
 					userID = user.ID
 					username = user.Username
 					role = user.Role
+					envProfile = user.EnvProfile
+					limitCredentialID = user.LimitCredentialID()
+					mustChangePassword = user.MustChangePassword
 				}
 			}
 		}
@@ -109,10 +116,41 @@ func TokenAuth() gin.HandlerFunc {
 					userID = user.ID
 					username = user.Username
 					role = user.Role
+					envProfile = user.EnvProfile
+					limitCredentialID = user.LimitCredentialID()
+					mustChangePassword = user.MustChangePassword
 				}
 			}
 		}
 
+		// Requests from a trusted SSO proxy identify the already authenticated user by header
+		if userID == 0 {
+			if user := trustedHeaderUser(c); user != nil {
+				userID = user.ID
+				username = user.Username
+				role = user.Role
+				envProfile = user.EnvProfile
+				limitCredentialID = user.LimitCredentialID()
+				mustChangePassword = user.MustChangePassword
+			}
+		}
+
+		// A rotated token must not silently fall back to global access; tell the client to update its config
+		if userID == 0 && presentedTokenRotated(c) {
+			common.RespJSONRPCError(c, http.StatusUnauthorized, common.JSONRPCErrorCodeInvalidRequest,
+				"Authentication failed: this API key has been rotated. Update your client configuration with the new key from Profile settings.")
+			c.Abort()
+			return
+		}
+
+		// 仍在使用默认密码的用户在修改密码前不能使用代理
+		if userID > 0 && mustChangePassword {
+			common.RespJSONRPCError(c, http.StatusForbidden, common.JSONRPCErrorCodeInvalidRequest,
+				"Password change required: change the default password in Profile settings before using this API key.")
+			c.Abort()
+			return
+		}
+
 		// If still no valid user found, continue without authentication
 		// This allows the proxy to work in global mode if no valid authentication is provided
 		if userID > 0 {
@@ -120,6 +158,9 @@ func TokenAuth() gin.HandlerFunc {
 			c.Set("user_id", userID) // Also set this for compatibility
 			c.Set("username", username)
 			c.Set("role", role)
+			c.Set("token_id", limitCredentialID) // 用于按令牌计数的限额，令牌轮换后保持不变
+			// 令牌绑定的 profile，代理据此选择环境变量而无需再查用户
+			c.Set("env_profile", envProfile)
 			common.SysLog(fmt.Sprintf("[TokenAuth] Authenticated user %d (%s) for proxy request", userID, username))
 		} else {
 			common.SysLog("[TokenAuth] No valid authentication found, proceeding with global access")
@@ -129,6 +170,53 @@ func TokenAuth() gin.HandlerFunc {
 	}
 }
 
+// trustedHeaderUser maps the common.TrustedAuthHeader header to a user. The header is only honoured when
+// the connection comes directly from one of common.TrustedAuthProxies; unknown users are created when
+// common.TrustedAuthAutoProvision is enabled.
+func trustedHeaderUser(c *gin.Context) *model.User {
+	if common.TrustedAuthHeader == "" {
+		return nil
+	}
+	username := strings.TrimSpace(c.GetHeader(common.TrustedAuthHeader))
+	if username == "" {
+		return nil
+	}
+	// 只认 TCP 对端地址，X-Forwarded-For 等可被客户端伪造
+	if !common.IsTrustedAuthProxy(c.RemoteIP()) {
+		common.SysLog(fmt.Sprintf("[TokenAuth] Ignoring %s header from untrusted address %s", common.TrustedAuthHeader, c.RemoteIP()))
+		return nil
+	}
+	user := &model.User{Username: username}
+	if err := user.FillUserByUsername(); err != nil {
+		if !common.TrustedAuthAutoProvision {
+			common.SysLog(fmt.Sprintf("[TokenAuth] Trusted header user %s does not exist and auto-provisioning is disabled", username))
+			return nil
+		}
+		user = &model.User{
+			Username:    username,
+			DisplayName: username,
+			Role:        common.RoleCommonUser,
+			Status:      common.UserStatusEnabled,
+		}
+		if err := user.Insert(); err != nil {
+			common.SysError(fmt.Sprintf("[TokenAuth] Failed to provision trusted header user %s: %v", username, err))
+			return nil
+		}
+		common.SysLog(fmt.Sprintf("[TokenAuth] Provisioned user %d (%s) from trusted header", user.ID, username))
+	}
+	if user.Status != common.UserStatusEnabled {
+		return nil
+	}
+	return user
+}
+
+// mustChangePasswordRoutes are the only JWT routes a user with MustChangePassword may use. Logout does not
+// require a login and stays available as well.
+var mustChangePasswordRoutes = map[string]bool{
+	"GET /api/user/self":             true,
+	"POST /api/user/change-password": true,
+}
+
 // JWTAuth is a middleware that validates JWT tokens
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -179,10 +267,26 @@ func JWTAuth() gin.HandlerFunc {
 			}
 		}
 
+		// 登录会话与用户的访问令牌共用按令牌计数的限额
+		limitCredentialID := fmt.Sprintf("user-%d", claims.UserID)
+		if user, err := model.GetUserById(claims.UserID, false); err == nil {
+			// 前端的跳转可以被绕过，仍在使用默认密码的用户在服务端同样只能查看自身信息和修改密码
+			if user.MustChangePassword && !mustChangePasswordRoutes[c.Request.Method+" "+c.FullPath()] {
+				c.JSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"message": "Password change required: change the default password before continuing",
+				})
+				c.Abort()
+				return
+			}
+			limitCredentialID = user.LimitCredentialID()
+		}
+
 		// Set user information in the context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("token_id", limitCredentialID)
 
 		c.Next()
 	}
@@ -227,6 +331,67 @@ func AdminAuth() gin.HandlerFunc {
 	}
 }
 
+// ObserverAuth middleware verifies the user has observer role or higher, for read-only management endpoints
+// Note: This middleware assumes JWTAuth has already been called to set user info in context
+func ObserverAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt("role") < common.RoleObserverUser {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "Observer privileges required",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyObserver middleware rejects observers on endpoints that change state
+// Note: This middleware assumes JWTAuth has already been called to set user info in context
+func DenyObserver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt("role") == common.RoleObserverUser {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "Observer accounts are read-only",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyObserverProxy middleware rejects proxy and group MCP requests of observers.
+// Note: This middleware assumes TokenAuth has already been called to set user info in context
+func DenyObserverProxy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt64("user_id") > 0 && c.GetInt("role") == common.RoleObserverUser {
+			common.RespJSONRPCError(c, http.StatusForbidden, common.JSONRPCErrorCodeInvalidRequest,
+				"Observer accounts cannot send requests through the proxy")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ProxyKillSwitch middleware rejects proxy and group MCP requests with 503 while the global kill-switch is on.
+// It runs before authentication so no upstream or database work is done for blocked requests.
+func ProxyKillSwitch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if common.GetProxyKillSwitch() {
+			c.Header("Retry-After", "60")
+			common.RespJSONRPCError(c, http.StatusServiceUnavailable, common.JSONRPCErrorCodeServerError,
+				"MCP proxying is temporarily stopped by an administrator for maintenance, please try again later")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // RootAuth middleware verifies the user has root role
 // Note: This middleware assumes JWTAuth has already been called to set user info in context
 func RootAuth() gin.HandlerFunc {
@@ -311,3 +476,11 @@ func TokenOnlyAuth() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// presentedTokenRotated reports whether the bearer token or ?key= of the request was rotated away
+func presentedTokenRotated(c *gin.Context) bool {
+	if parts := strings.Split(c.GetHeader("Authorization"), " "); len(parts) == 2 && parts[0] == "Bearer" && model.IsRotatedToken(parts[1]) {
+		return true
+	}
+	return model.IsRotatedToken(c.Query("key"))
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+	"one-mcp/backend/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenAuthTrustedHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalPath := common.SQLitePath
+	originalHeader, originalProxies, originalProvision := common.TrustedAuthHeader, common.TrustedAuthProxies, common.TrustedAuthAutoProvision
+	defer func() {
+		common.SQLitePath = originalPath
+		common.TrustedAuthHeader, common.TrustedAuthProxies, common.TrustedAuthAutoProvision = originalHeader, originalProxies, originalProvision
+	}()
+	common.SQLitePath = filepath.Join(t.TempDir(), "trusted_header_test.db")
+	assert.NoError(t, model.InitDB())
+
+	existing := &model.User{Username: "sso-alice", DisplayName: "Alice", Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, existing.Insert())
+
+	common.TrustedAuthHeader = "X-Forwarded-User"
+	common.TrustedAuthProxies = "10.0.0.5, 192.168.1.0/24"
+
+	router := gin.New()
+	router.Use(TokenAuth())
+	router.GET("/proxy/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt64("userID"), "username": c.GetString("username")})
+	})
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		user          string
+		forwardedFor  string
+		autoProvision bool
+		wantUsername  string
+	}{
+		{"trusted proxy address", "10.0.0.5:41000", "sso-alice", "", false, "sso-alice"},
+		{"trusted proxy range", "192.168.1.20:41000", "sso-alice", "", false, "sso-alice"},
+		{"untrusted source", "203.0.113.9:41000", "sso-alice", "", false, ""},
+		{"spoofed forwarded-for", "203.0.113.9:41000", "sso-alice", "10.0.0.5", false, ""},
+		{"unknown user without provisioning", "10.0.0.5:41000", "sso-bob", "", false, ""},
+		{"unknown user with provisioning", "10.0.0.5:41000", "sso-carol", "", true, "sso-carol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.TrustedAuthAutoProvision = tt.autoProvision
+			req := httptest.NewRequest(http.MethodGet, "/proxy/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-User", tt.user)
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var body struct {
+				UserID   int64  `json:"user_id"`
+				Username string `json:"username"`
+			}
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantUsername, body.Username)
+			if tt.wantUsername == "" {
+				assert.Zero(t, body.UserID)
+				return
+			}
+			user := &model.User{Username: tt.wantUsername}
+			assert.NoError(t, user.FillUserByUsername())
+			assert.Equal(t, user.ID, body.UserID)
+		})
+	}
+}
+
+func TestAuthLimitCredentialID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalPath := common.SQLitePath
+	originalHeader, originalProxies, originalRedis := common.TrustedAuthHeader, common.TrustedAuthProxies, common.RedisEnabled
+	defer func() {
+		common.SQLitePath = originalPath
+		common.TrustedAuthHeader, common.TrustedAuthProxies, common.RedisEnabled = originalHeader, originalProxies, originalRedis
+	}()
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "limit_credential_test.db")
+	assert.NoError(t, model.InitDB())
+	common.TrustedAuthHeader = "X-Forwarded-User"
+	common.TrustedAuthProxies = "10.0.0.5"
+
+	user := &model.User{Username: "limit-alice", DisplayName: "Alice", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, Token: model.GenerateUserToken()}
+	assert.NoError(t, user.Insert())
+	other := &model.User{Username: "limit-bob", DisplayName: "Bob", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, Token: model.GenerateUserToken()}
+	assert.NoError(t, other.Insert())
+
+	router := gin.New()
+	handler := func(c *gin.Context) { c.String(http.StatusOK, c.GetString("token_id")) }
+	router.GET("/proxy/test", TokenAuth(), handler)
+	router.GET("/api/test", JWTAuth(), handler)
+	tokenID := func(req *http.Request) string {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		return recorder.Body.String()
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy/test?key="+user.Token, nil)
+	beforeRotation := tokenID(req)
+	assert.Equal(t, "token-"+user.TokenID, beforeRotation)
+	assert.NotEmpty(t, user.TokenID)
+	// 不同的令牌有不同的标识
+	assert.NotEqual(t, beforeRotation, tokenID(httptest.NewRequest(http.MethodGet, "/proxy/test?key="+other.Token, nil)))
+
+	// 令牌绑定的 profile 随认证一起带出，代理无需再次查询用户
+	user.EnvProfile = "prod"
+	assert.NoError(t, model.UserDB.Save(user))
+	router.GET("/proxy/profile", TokenAuth(), func(c *gin.Context) { c.String(http.StatusOK, c.GetString("env_profile")) })
+	assert.Equal(t, "prod", tokenID(httptest.NewRequest(http.MethodGet, "/proxy/profile?key="+user.Token, nil)))
+
+	// 轮换令牌不能重置按令牌计数的限额
+	newToken, err := user.RotateToken()
+	assert.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, "/proxy/test", nil)
+	req.Header.Set("Authorization", "Bearer "+newToken)
+	assert.Equal(t, beforeRotation, tokenID(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/proxy/test", nil)
+	req.RemoteAddr = "10.0.0.5:41000"
+	req.Header.Set("X-Forwarded-User", user.Username)
+	// SSO 和登录会话与令牌共用计数，切换认证方式不会得到额外的限额
+	assert.Equal(t, beforeRotation, tokenID(req))
+
+	jwtToken, err := service.GenerateToken(user)
+	assert.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	assert.Equal(t, beforeRotation, tokenID(req))
+}
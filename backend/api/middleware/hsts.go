@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"strconv"
+
+	"one-mcp/backend/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HSTS sets Strict-Transport-Security on responses served over TLS
+func HSTS() gin.HandlerFunc {
+	value := "max-age=" + strconv.Itoa(common.HSTSMaxAge) + "; includeSubDomains"
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", value)
+		}
+		c.Next()
+	}
+}
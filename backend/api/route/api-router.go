@@ -14,6 +14,7 @@ func SetApiRouter(route *gin.Engine) {
 	{
 		// Public routes (no authentication required)
 		apiRouter.GET("/status", handler.GetStatus)
+		apiRouter.GET("/meta", handler.GetMeta)
 		apiRouter.GET("/notice", handler.GetNotice)
 		apiRouter.GET("/about", handler.GetAbout)
 		apiRouter.GET("/verification", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), handler.SendEmailVerification)
@@ -58,7 +59,9 @@ func SetApiRouter(route *gin.Engine) {
 				selfRoute.PUT("/self", handler.UpdateSelf)
 				selfRoute.DELETE("/self", handler.DeleteSelf)
 				selfRoute.GET("/token", handler.GenerateToken)
+				selfRoute.POST("/token/rotate", handler.RotateToken)
 				selfRoute.POST("/change-password", handler.ChangePassword)
+				selfRoute.PATCH("/env_vars/bulk", middleware.DenyObserver(), handler.BulkPatchEnvVar)
 			}
 
 			// Admin-only endpoints
@@ -85,14 +88,36 @@ func SetApiRouter(route *gin.Engine) {
 			optionRoute.PUT("/", handler.UpdateOption)
 		}
 
+		// Admin maintenance routes
+		adminCacheRoute := apiRouter.Group("/admin/caches")
+		adminCacheRoute.Use(middleware.JWTAuth())   // First authenticate with JWT
+		adminCacheRoute.Use(middleware.AdminAuth()) // Then check admin privileges
+		{
+			adminCacheRoute.GET("", handler.GetProxyHandlerCaches)
+			adminCacheRoute.POST("/clear", handler.ClearProxyHandlerCaches)
+		}
+		adminMaintenanceRoute := apiRouter.Group("/admin")
+		adminMaintenanceRoute.Use(middleware.JWTAuth())   // First authenticate with JWT
+		adminMaintenanceRoute.Use(middleware.AdminAuth()) // Then check admin privileges
+		{
+			adminMaintenanceRoute.POST("/validate_all", handler.ValidateAllServices)
+			// 紧急开关对管理员开放，其余系统选项仍只允许 root 修改
+			adminMaintenanceRoute.GET("/proxy_kill_switch", handler.GetProxyKillSwitch)
+			adminMaintenanceRoute.PUT("/proxy_kill_switch", handler.SetProxyKillSwitch)
+		}
+
 		// MCP Service routes
 		mcpServiceRoute := apiRouter.Group("/mcp_services")
 		{
 			// Public endpoints (read-only, require authentication)
 			mcpServiceRoute.Use(middleware.JWTAuth())
 			{
-				mcpServiceRoute.POST("/:id/health/check", handler.CheckMCPServiceHealth)
+				mcpServiceRoute.POST("/:id/health/check", middleware.DenyObserver(), handler.CheckMCPServiceHealth)
 				mcpServiceRoute.GET("/:id/tools", handler.GetMCPServiceTools)
+				mcpServiceRoute.GET("/:id/server_info", handler.GetMCPServiceServerInfo)
+				mcpServiceRoute.GET("/:id/endpoints", handler.GetMCPServiceEndpoints)
+				mcpServiceRoute.GET("/:id/my_env", handler.GetMyServiceEnv)
+				mcpServiceRoute.POST("/:id/reset_config", middleware.DenyObserver(), handler.ResetMCPServiceConfig)
 			}
 
 			// Admin-only endpoints (write operations)
@@ -101,14 +126,24 @@ func SetApiRouter(route *gin.Engine) {
 			adminMCPServiceRoute.Use(middleware.AdminAuth()) // Then check admin privileges
 			{
 				adminMCPServiceRoute.PUT("/:id", handler.UpdateMCPService)
+				adminMCPServiceRoute.GET("/:id/diagnostics", handler.GetMCPServiceDiagnostics)
 				adminMCPServiceRoute.POST("/:id/toggle", handler.ToggleMCPService)
+				adminMCPServiceRoute.POST("/:id/rediscover_env", handler.RediscoverServiceEnvVars)
+				adminMCPServiceRoute.POST("/:id/reinstall", handler.ReinstallService)
+				adminMCPServiceRoute.POST("/:id/icon", handler.UploadMCPServiceIcon)
+				adminMCPServiceRoute.GET("/:id/oauth", handler.GetMCPServiceOAuth)
+				adminMCPServiceRoute.POST("/:id/oauth/start", handler.StartMCPServiceOAuth)
+				adminMCPServiceRoute.POST("/:id/oauth/complete", handler.CompleteMCPServiceOAuth)
 			}
 		}
 
-		// MCP Logs routes (Admin-only)
+		// Locally cached service icons (public, loaded by <img> tags without credentials)
+		apiRouter.GET("/icons/:file", handler.ServeServiceIcon)
+
+		// MCP Logs routes (Admin and observer)
 		mcpLogsRoute := apiRouter.Group("/mcp_logs")
-		mcpLogsRoute.Use(middleware.JWTAuth())   // First authenticate with JWT
-		mcpLogsRoute.Use(middleware.AdminAuth()) // Then check admin privileges
+		mcpLogsRoute.Use(middleware.JWTAuth())      // First authenticate with JWT
+		mcpLogsRoute.Use(middleware.ObserverAuth()) // Then check observer privileges
 		{
 			mcpLogsRoute.GET("", handler.GetMCPLogs)
 		}
@@ -118,10 +153,11 @@ func SetApiRouter(route *gin.Engine) {
 		groupRoute.Use(middleware.JWTAuth())
 		{
 			groupRoute.GET("", handler.GetGroups)
-			groupRoute.POST("", handler.CreateGroup)
-			groupRoute.PUT("/:id", handler.UpdateGroup)
-			groupRoute.DELETE("/:id", handler.DeleteGroup)
+			groupRoute.POST("", middleware.DenyObserver(), handler.CreateGroup)
+			groupRoute.PUT("/:id", middleware.DenyObserver(), handler.UpdateGroup)
+			groupRoute.DELETE("/:id", middleware.DenyObserver(), handler.DeleteGroup)
 			groupRoute.GET("/:id/export", handler.ExportGroupSkill)
+			groupRoute.GET("/:id/openapi", handler.GetGroupOpenAPI)
 		}
 
 		// Market API routes
@@ -132,8 +168,9 @@ func SetApiRouter(route *gin.Engine) {
 			marketRoute.GET("/discover_env_vars", handler.DiscoverEnvVars)
 			marketRoute.GET("/installed", handler.ListInstalledMCPServices)
 			marketRoute.GET("/package_details", handler.GetPackageDetails)
+			marketRoute.GET("/enrich", handler.EnrichMCPMarketPackage)
 			marketRoute.GET("/install_status/:id", handler.GetInstallationStatus)
-			marketRoute.PATCH("/env_var", handler.PatchEnvVar)
+			marketRoute.PATCH("/env_var", middleware.DenyObserver(), handler.PatchEnvVar)
 
 			// Admin-only endpoints
 			adminMarketRoute := marketRoute.Group("/")
@@ -141,6 +178,7 @@ func SetApiRouter(route *gin.Engine) {
 			{
 				adminMarketRoute.POST("/install_or_add_service", handler.InstallOrAddService)
 				adminMarketRoute.POST("/batch-import", handler.StartBatchImport)
+				adminMarketRoute.POST("/import_config", handler.ImportClientConfig)
 				adminMarketRoute.POST("/uninstall", handler.UninstallService)
 				adminMarketRoute.POST("/custom_service", handler.CreateCustomService)
 			}
@@ -180,13 +218,25 @@ func SetApiRouter(route *gin.Engine) {
 		analyticsRoute.GET("/services/utilization", handler.GetServiceUtilization)
 		analyticsRoute.GET("/services/metrics", handler.GetServiceMetrics)
 		analyticsRoute.GET("/system/overview", handler.GetSystemOverview)
+		analyticsRoute.GET("/tools/feedback", handler.GetToolFeedbackStats)
+	}
+
+	// Stats routes use JWT auth; only tool-call feedback from MCP clients takes the proxy user token
+	statsRoute := apiRouter.Group("/stats")
+	{
+		statsRoute.POST("/feedback", middleware.TokenAuth(), handler.SubmitToolFeedback)
+		statsRoute.GET("/live", middleware.JWTAuth(), middleware.ObserverAuth(), handler.GetLiveStats)
+		statsRoute.GET("/metrics", middleware.JWTAuth(), middleware.ObserverAuth(), handler.GetPrometheusMetrics)
+		statsRoute.GET("/export", middleware.JWTAuth(), handler.ExportStats)
 	}
 
 	// Define routes under /proxy, outside the /api group
 	proxyRouter := route.Group("/proxy")
 	proxyRouter.Use(middleware.LangMiddleware()) // Apply similar general middlewares
+	proxyRouter.Use(middleware.ProxyKillSwitch())
 	proxyRouter.Use(middleware.GlobalAPIRateLimit())
 	proxyRouter.Use(middleware.TokenAuth()) // Add token-based authentication for proxy endpoints
+	proxyRouter.Use(middleware.DenyObserverProxy())
 	{
 		// SSE proxy routes - for SSE endpoints and stdio->SSE conversion
 		// proxyRouter.Any("/:serviceName/sse/*action", handler.ProxyHandler)
@@ -201,9 +251,12 @@ func SetApiRouter(route *gin.Engine) {
 	// Group MCP routes (token auth, outside /api)
 	groupMcpRoute := route.Group("/group")
 	groupMcpRoute.Use(middleware.LangMiddleware())
+	groupMcpRoute.Use(middleware.ProxyKillSwitch())
 	groupMcpRoute.Use(middleware.GlobalAPIRateLimit())
 	groupMcpRoute.Use(middleware.TokenAuth())
+	groupMcpRoute.Use(middleware.DenyObserverProxy())
 	{
 		groupMcpRoute.Any("/:name/mcp", handler.GroupMCPHandler)
+		groupMcpRoute.POST("/:name/tools/:mcp_name/:tool_name", handler.GroupExecuteToolHandler)
 	}
 }
@@ -0,0 +1,180 @@
+package route
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+	"one-mcp/backend/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserverRoleIsReadOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalPath, originalRedis := common.SQLitePath, common.RedisEnabled
+	defer func() { common.SQLitePath, common.RedisEnabled = originalPath, originalRedis }()
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "observer_role_test.db")
+	assert.NoError(t, model.InitDB())
+
+	newUser := func(name string, role int) (jwt string, token string) {
+		user := &model.User{Username: name, DisplayName: name, Role: role, Status: common.UserStatusEnabled, Token: "token-" + name}
+		assert.NoError(t, user.Insert())
+		jwt, err := service.GenerateToken(user)
+		assert.NoError(t, err)
+		return jwt, user.Token
+	}
+	observerJWT, observerToken := newUser("observer-969", common.RoleObserverUser)
+	commonJWT, _ := newUser("common-969", common.RoleCommonUser)
+
+	router := gin.New()
+	SetApiRouter(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		bearer     string
+		wantStatus int
+	}{
+		{"observer reads logs", http.MethodGet, "/api/mcp_logs", observerJWT, http.StatusOK},
+		{"observer reads services and health", http.MethodGet, "/api/mcp_market/installed", observerJWT, http.StatusOK},
+		{"observer reads live stats", http.MethodGet, "/api/stats/live", observerJWT, http.StatusOK},
+		{"proxy key cannot read live stats", http.MethodGet, "/api/stats/live?key=" + observerToken, observerToken, http.StatusUnauthorized},
+		{"common user cannot read logs", http.MethodGet, "/api/mcp_logs", commonJWT, http.StatusForbidden},
+		{"observer cannot toggle", http.MethodPost, "/api/mcp_services/1/toggle", observerJWT, http.StatusForbidden},
+		{"observer cannot trigger health checks", http.MethodPost, "/api/mcp_services/1/health/check", observerJWT, http.StatusForbidden},
+		{"observer cannot install", http.MethodPost, "/api/mcp_market/install_or_add_service", observerJWT, http.StatusForbidden},
+		{"observer cannot create groups", http.MethodPost, "/api/groups", observerJWT, http.StatusForbidden},
+		{"observer cannot proxy", http.MethodPost, "/proxy/some-service/mcp", observerToken, http.StatusForbidden},
+		{"observer cannot use group endpoints", http.MethodPost, "/group/some-group/mcp", observerToken, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.wantStatus, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+func TestProxyKillSwitchBlocksProxyOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalPath, originalRedis := common.SQLitePath, common.RedisEnabled
+	defer func() { common.SQLitePath, common.RedisEnabled = originalPath, originalRedis }()
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "kill_switch_test.db")
+	assert.NoError(t, model.InitDB())
+	defer model.UpdateOptionMap(common.OptionProxyKillSwitch, "false")
+
+	root := &model.User{Username: "root-992", DisplayName: "root-992", Role: common.RoleRootUser, Status: common.UserStatusEnabled, Token: "token-root-992"}
+	assert.NoError(t, root.Insert())
+	rootJWT, err := service.GenerateToken(root)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	SetApiRouter(router)
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	setSwitch := func(value string) {
+		w := do(http.MethodPut, "/api/option/", rootJWT, `{"key": "ProxyKillSwitch", "value": "`+value+`"}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"success":true`)
+	}
+
+	// 关闭时请求照常进入代理（服务不存在返回 404）
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/proxy/some-service/mcp", root.Token, `{}`).Code)
+
+	setSwitch("true")
+	for _, path := range []string{"/proxy/some-service/mcp", "/proxy/some-service/sse", "/group/some-group/mcp", "/group/some-group/tools/svc/echo"} {
+		w := do(http.MethodPost, path, root.Token, `{}`)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+		assert.Contains(t, w.Body.String(), "maintenance", path)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"), path)
+	}
+	// 管理接口不受影响，仍可关闭开关
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/mcp_market/installed", rootJWT, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/option/", rootJWT, "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/option/", rootJWT, `{"key": "ProxyKillSwitch", "value": "maybe"}`).Code)
+
+	setSwitch("false")
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/proxy/some-service/mcp", root.Token, `{}`).Code)
+
+	// 管理员不能修改系统选项，但可以通过专用接口切换紧急开关
+	admin := &model.User{Username: "admin-992", DisplayName: "admin-992", Role: common.RoleAdminUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, admin.Insert())
+	adminJWT, err := service.GenerateToken(admin)
+	assert.NoError(t, err)
+	commonUser := &model.User{Username: "common-992", DisplayName: "common-992", Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+	assert.NoError(t, commonUser.Insert())
+	commonJWT, err := service.GenerateToken(commonUser)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/api/option/", adminJWT, `{"key": "ProxyKillSwitch", "value": "true"}`).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/api/admin/proxy_kill_switch", commonJWT, `{"enabled": true}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/admin/proxy_kill_switch", adminJWT, `{}`).Code)
+
+	w := do(http.MethodPut, "/api/admin/proxy_kill_switch", adminJWT, `{"enabled": true}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"enabled":true`)
+	assert.Equal(t, http.StatusServiceUnavailable, do(http.MethodPost, "/proxy/some-service/mcp", root.Token, `{}`).Code)
+	assert.Contains(t, do(http.MethodGet, "/api/admin/proxy_kill_switch", adminJWT, "").Body.String(), `"enabled":true`)
+
+	w = do(http.MethodPut, "/api/admin/proxy_kill_switch", adminJWT, `{"enabled": false}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/proxy/some-service/mcp", root.Token, `{}`).Code)
+}
+
+func TestMustChangePasswordIsEnforcedByServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalPath, originalRedis := common.SQLitePath, common.RedisEnabled
+	defer func() { common.SQLitePath, common.RedisEnabled = originalPath, originalRedis }()
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "must_change_password_test.db")
+	assert.NoError(t, model.InitDB())
+
+	user := &model.User{Username: "root-941", DisplayName: "root-941", Password: "123456", Role: common.RoleRootUser, Status: common.UserStatusEnabled, Token: "token-root-941", MustChangePassword: true}
+	assert.NoError(t, user.Insert())
+	jwt, err := service.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	SetApiRouter(router)
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// 修改密码前只能查看自身信息和修改密码，直接调用其他接口或代理都被拒绝
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/self", jwt, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/mcp_market/installed", jwt, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/option/", jwt, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/proxy/some-service/mcp", user.Token, `{}`).Code)
+
+	w := do(http.MethodPost, "/api/user/change-password", jwt, `{"current_password": "123456", "new_password": "a-new-password"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"success":true`)
+
+	// 修改密码后恢复正常访问
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/mcp_market/installed", jwt, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/proxy/some-service/mcp", user.Token, `{}`).Code)
+}
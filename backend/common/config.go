@@ -1,5 +1,13 @@
 package common
 
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // GetGitHubClientId 获取GitHub客户端ID
 func GetGitHubClientId() string {
 	return OptionMap["GitHubClientId"]
@@ -116,3 +124,418 @@ func GetEnableGzip() bool {
 	// We treat any value other than "false" as true for safety.
 	return OptionMap["EnableGzip"] != "false"
 }
+
+// GetProxyBodySniffLimit 获取代理请求体方法探测的最大读取字节数
+func GetProxyBodySniffLimit() int {
+	OptionMapRWMutex.RLock()
+	raw := OptionMap[OptionProxyBodySniffLimit]
+	OptionMapRWMutex.RUnlock()
+	if limit, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil && limit > 0 {
+		return limit
+	}
+	return DefaultProxyBodySniffLimit
+}
+
+// GetMCPRequestBodyMaxSize 获取 Content-Type 不是 JSON 时允许缓冲校验的 MCP 请求体最大字节数
+func GetMCPRequestBodyMaxSize() int64 {
+	OptionMapRWMutex.RLock()
+	raw := OptionMap[OptionMCPRequestBodyMaxSize]
+	OptionMapRWMutex.RUnlock()
+	if limit, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return DefaultMCPRequestBodyMaxSize
+}
+
+// GetSSEMaxBufferedEvents 获取 SSE 代理为单个下游客户端缓冲的最大事件数，0 表示不限制
+func GetSSEMaxBufferedEvents() int {
+	OptionMapRWMutex.RLock()
+	raw, ok := OptionMap[OptionSSEMaxBufferedEvents]
+	OptionMapRWMutex.RUnlock()
+	if !ok || strings.TrimSpace(raw) == "" {
+		return DefaultSSEMaxBufferedEvents
+	}
+	if limit, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil && limit >= 0 {
+		return limit
+	}
+	return DefaultSSEMaxBufferedEvents
+}
+
+// GetMaxInstanceTools 获取创建实例时最多拉取的工具数，0 表示不限制
+func GetMaxInstanceTools() int {
+	return getInstanceListLimit(OptionMaxInstanceTools)
+}
+
+// GetMaxInstancePrompts 获取创建实例时最多拉取的 prompt 数，0 表示不限制
+func GetMaxInstancePrompts() int {
+	return getInstanceListLimit(OptionMaxInstancePrompts)
+}
+
+// GetMaxInstanceResources 获取创建实例时最多拉取的资源（及资源模板）数，0 表示不限制
+func GetMaxInstanceResources() int {
+	return getInstanceListLimit(OptionMaxInstanceResources)
+}
+
+func getInstanceListLimit(key string) int {
+	OptionMapRWMutex.RLock()
+	raw, ok := OptionMap[key]
+	OptionMapRWMutex.RUnlock()
+	if !ok || strings.TrimSpace(raw) == "" {
+		return DefaultMaxInstanceListItems
+	}
+	if limit, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil && limit >= 0 {
+		return limit
+	}
+	return DefaultMaxInstanceListItems
+}
+
+// GetRegistryConnLimits 获取 registry 共享 HTTP 客户端的连接上限：全局空闲连接数、单 host 空闲连接数和单 host 最大连接数
+func GetRegistryConnLimits() (maxIdleConns, maxIdleConnsPerHost, maxConnsPerHost int) {
+	return getNonNegativeIntOption(OptionRegistryMaxIdleConns, DefaultRegistryMaxIdleConns),
+		getNonNegativeIntOption(OptionRegistryMaxIdleConnsPerHost, DefaultRegistryMaxIdleConnsPerHost),
+		getNonNegativeIntOption(OptionRegistryMaxConnsPerHost, DefaultRegistryMaxConnsPerHost)
+}
+
+func getNonNegativeIntOption(key string, def int) int {
+	OptionMapRWMutex.RLock()
+	raw, ok := OptionMap[key]
+	OptionMapRWMutex.RUnlock()
+	if !ok || strings.TrimSpace(raw) == "" {
+		return def
+	}
+	if value, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil && value >= 0 {
+		return value
+	}
+	return def
+}
+
+// GetUVXDefaults 获取全局默认的 uvx --python 版本和 --index-url，未配置时为空
+func GetUVXDefaults() (pythonVersion, indexURL string) {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	return strings.TrimSpace(OptionMap[OptionUVXPythonVersion]), strings.TrimSpace(OptionMap[OptionUVXIndexURL])
+}
+
+// GetProxyAccessLogFormat 获取代理访问日志格式，默认为 text
+func GetProxyAccessLogFormat() string {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if format := strings.TrimSpace(OptionMap[OptionProxyAccessLogFormat]); format != "" {
+		return format
+	}
+	return ProxyAccessLogFormatText
+}
+
+// getPositiveDurationOption 读取时长配置，支持 "10m" 或秒数两种写法，未配置或不是正数时返回 def
+func getPositiveDurationOption(key string, def time.Duration) time.Duration {
+	OptionMapRWMutex.RLock()
+	raw := OptionMap[key]
+	OptionMapRWMutex.RUnlock()
+	if d, ok := ParsePositiveDuration(raw); ok {
+		return d
+	}
+	return def
+}
+
+// ParsePositiveDuration 解析时长类配置项，支持 "10s" 或秒数两种写法，只接受正值
+func ParsePositiveDuration(raw string) (time.Duration, bool) {
+	raw = strings.TrimSpace(raw)
+	if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+		return d, true
+	}
+	if seconds, err := strconv.Atoi(raw); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// GetMcpInstallTimeout 获取市场安装任务的最大时长，支持 "10m" 或秒数两种写法
+func GetMcpInstallTimeout() time.Duration {
+	return getPositiveDurationOption(OptionMcpInstallTimeout, DefaultMcpInstallTimeout)
+}
+
+// GetToolCallQueueConfig 获取单个实例的 tools/call 并发上限(0 表示不限制)、排队上限和最长排队时间
+func GetToolCallQueueConfig() (maxConcurrency, queueDepth int, queueTimeout time.Duration) {
+	maxConcurrency = getNonNegativeIntOption(OptionToolCallMaxConcurrency, 0)
+	queueDepth = getNonNegativeIntOption(OptionToolCallQueueDepth, DefaultToolCallQueueDepth)
+	queueTimeout = getPositiveDurationOption(OptionToolCallQueueTimeout, DefaultToolCallQueueTimeout)
+	return maxConcurrency, queueDepth, queueTimeout
+}
+
+// GetGroupToolsFetchConfig 获取 group 批量获取成员工具时的并发上限(0 表示不限制)和整体超时时间
+func GetGroupToolsFetchConfig() (concurrency int, timeout time.Duration) {
+	concurrency = getNonNegativeIntOption(OptionGroupToolsFetchConcurrency, DefaultGroupToolsFetchConcurrency)
+	timeout = getPositiveDurationOption(OptionGroupToolsFetchTimeout, DefaultGroupToolsFetchTimeout)
+	return concurrency, timeout
+}
+
+// GetHealthCheckMaxConcurrency 获取同时进行的后台健康检查数上限，0 表示不限制
+func GetHealthCheckMaxConcurrency() int {
+	return getNonNegativeIntOption(OptionHealthCheckMaxConcurrency, DefaultHealthCheckMaxConcurrency)
+}
+
+// GetWriteRetryConfig 获取写库失败的统计/日志的重试队列长度(0 表示不重试)和每条记录的最多重试次数
+func GetWriteRetryConfig() (queueSize, maxAttempts int) {
+	queueSize = getNonNegativeIntOption(OptionWriteRetryQueueSize, DefaultWriteRetryQueueSize)
+	maxAttempts = getNonNegativeIntOption(OptionWriteRetryMaxAttempts, DefaultWriteRetryMaxAttempts)
+	if maxAttempts == 0 {
+		maxAttempts = DefaultWriteRetryMaxAttempts
+	}
+	return queueSize, maxAttempts
+}
+
+// GetUpstreamErrorRestartConfig 获取 SSE/HTTP 实例因上游 5xx 过多而自动重建的阈值(百分比，0 表示关闭)、
+// 最少调用次数、统计窗口和两次重建之间的冷却时间
+func GetUpstreamErrorRestartConfig() (thresholdPercent, minCalls int, window, cooldown time.Duration) {
+	thresholdPercent = getNonNegativeIntOption(OptionUpstreamErrorRestartThreshold, DefaultUpstreamErrorRestartThreshold)
+	minCalls = getNonNegativeIntOption(OptionUpstreamErrorRestartMinCalls, DefaultUpstreamErrorRestartMinCalls)
+	window = getPositiveDurationOption(OptionUpstreamErrorRestartWindow, DefaultUpstreamErrorRestartWindow)
+	cooldown = getPositiveDurationOption(OptionUpstreamErrorRestartCooldown, DefaultUpstreamErrorRestartCooldown)
+	return thresholdPercent, minCalls, window, cooldown
+}
+
+// GetToolDescriptionMaxLength 获取分组 search_tools 输出中工具描述的最大长度，0 表示不截断
+func GetToolDescriptionMaxLength() int {
+	return getNonNegativeIntOption(OptionToolDescriptionMaxLength, 0)
+}
+
+// GetMaxConcurrentInstallsPerUser 获取单个用户同时进行中的安装任务上限，<= 0 表示不限制
+func GetMaxConcurrentInstallsPerUser() int {
+	OptionMapRWMutex.RLock()
+	raw, ok := OptionMap[OptionMaxConcurrentInstallsPerUser]
+	OptionMapRWMutex.RUnlock()
+	if !ok || strings.TrimSpace(raw) == "" {
+		return DefaultMaxConcurrentInstallsPerUser
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return DefaultMaxConcurrentInstallsPerUser
+	}
+	return limit
+}
+
+// GetAutoGenerateUserToken 是否在注册/登录时自动为没有访问令牌的用户生成令牌，默认开启
+func GetAutoGenerateUserToken() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	return strings.TrimSpace(OptionMap[OptionAutoGenerateUserToken]) != "false"
+}
+
+// GetMarketSourcePriority 返回市场搜索数据源的优先级顺序，未配置时为 DefaultMarketSourcePriority
+func GetMarketSourcePriority() []string {
+	OptionMapRWMutex.RLock()
+	raw := strings.TrimSpace(OptionMap[OptionMarketSourcePriority])
+	OptionMapRWMutex.RUnlock()
+	if raw == "" {
+		raw = DefaultMarketSourcePriority
+	}
+	var sources []string
+	for _, source := range strings.Split(raw, ",") {
+		if source = strings.ToLower(strings.TrimSpace(source)); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// GetHookCommandAllowlist 返回启动前/停止后钩子允许执行的命令，未配置时为 DefaultHookCommandAllowlist
+func GetHookCommandAllowlist() []string {
+	OptionMapRWMutex.RLock()
+	raw := strings.TrimSpace(OptionMap[OptionHookCommandAllowlist])
+	OptionMapRWMutex.RUnlock()
+	if raw == "" {
+		raw = DefaultHookCommandAllowlist
+	}
+	var commands []string
+	for _, command := range strings.Split(raw, ",") {
+		if command = strings.TrimSpace(command); command != "" {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// IsHookCommandAllowed 报告钩子命令的可执行文件是否在允许列表中（按原样精确匹配）
+func IsHookCommandAllowed(executable string) bool {
+	return slices.Contains(GetHookCommandAllowlist(), executable)
+}
+
+// GetInstallCategoryAllowlist 返回该角色允许安装的服务分类；restricted 为 false 表示不限制。
+// 安装接口只对管理员开放，因此只有 "admin" 条目生效，root 用户不受限制
+func GetInstallCategoryAllowlist(role int) (categories []string, restricted bool) {
+	if role >= RoleRootUser || role < RoleAdminUser {
+		return nil, false
+	}
+	const roleName = "admin"
+	OptionMapRWMutex.RLock()
+	raw := OptionMap[OptionInstallCategoryAllowlist]
+	OptionMapRWMutex.RUnlock()
+	for _, entry := range strings.Split(raw, ";") {
+		name, list, ok := strings.Cut(entry, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), roleName) {
+			continue
+		}
+		categories = []string{}
+		for _, category := range strings.Split(list, ",") {
+			if category = strings.ToLower(strings.TrimSpace(category)); category != "" {
+				categories = append(categories, category)
+			}
+		}
+		return categories, true
+	}
+	return nil, false
+}
+
+// GetReuseGlobalUserInstances 用户合并后的环境变量与服务默认值相同时是否复用全局实例，默认开启
+func GetReuseGlobalUserInstances() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	return strings.TrimSpace(OptionMap[OptionReuseGlobalUserInstances]) != "false"
+}
+
+// GetMaxUserInstancesPerService 获取单个服务缓存的用户专属实例上限，0 表示不限制
+func GetMaxUserInstancesPerService() int {
+	return getNonNegativeIntOption(OptionMaxUserInstancesPerService, 0)
+}
+
+// GetCleanupUserInstancesOnDelete 删除用户时是否停止其专属实例并删除其服务配置，默认开启
+func GetCleanupUserInstancesOnDelete() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	return strings.TrimSpace(OptionMap[OptionCleanupUserInstancesOnDelete]) != "false"
+}
+
+// GetRejectUnknownTools group 调用前是否校验工具名存在于服务的工具列表，默认开启
+func GetRejectUnknownTools() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	return strings.TrimSpace(OptionMap[OptionRejectUnknownTools]) != "false"
+}
+
+// GetGroupToolNameCollisions 获取保存 group 时对成员工具重名的处理方式(warn/reject/off)，默认 warn
+func GetGroupToolNameCollisions() string {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	switch policy := strings.TrimSpace(OptionMap[OptionGroupToolNameCollisions]); policy {
+	case GroupToolNameCollisionsReject, GroupToolNameCollisionsOff:
+		return policy
+	default:
+		return GroupToolNameCollisionsWarn
+	}
+}
+
+// GetProxyKillSwitch 是否已开启全局停止代理开关，开启后所有 /proxy 和 /group 请求返回 503
+func GetProxyKillSwitch() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(OptionMap[OptionProxyKillSwitch]))
+	return enabled
+}
+
+// GetExecuteArgsStrictness 获取 execute_tool 对 arguments 别名及顶层参数的处理方式(lenient/warn/strict)，默认 warn
+func GetExecuteArgsStrictness() string {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	switch strictness := strings.TrimSpace(OptionMap[OptionExecuteArgsStrictness]); strictness {
+	case ExecuteArgsLenient, ExecuteArgsStrict:
+		return strictness
+	default:
+		return ExecuteArgsWarn
+	}
+}
+
+// GetActiveEnvironment 获取当前生效的环境 profile 名称(如 dev/staging/prod)，未设置时为 default
+func GetActiveEnvironment() string {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if environment := strings.TrimSpace(OptionMap[OptionActiveEnvironment]); environment != "" {
+		return environment
+	}
+	return DefaultActiveEnvironment
+}
+
+// GetUninstallInstallerOnly 是否只允许服务的安装者或 root 用户卸载服务，默认关闭
+func GetUninstallInstallerOnly() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(OptionMap[OptionUninstallInstallerOnly]))
+	return enabled
+}
+
+// GetNpmVerifyIntegrity 是否在安装 npm 包前校验 registry 完整性值，默认关闭
+func GetNpmVerifyIntegrity() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(OptionMap[OptionNpmVerifyIntegrity]))
+	return enabled
+}
+
+// GetCacheServiceIcons 是否在安装时把服务图标下载到本地缓存，默认关闭
+func GetCacheServiceIcons() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(OptionMap[OptionCacheServiceIcons]))
+	return enabled
+}
+
+// GetMetricsPackageLabels 是否在服务指标中附带包管理器与安装版本标签，默认开启
+func GetMetricsPackageLabels() bool {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	return strings.TrimSpace(OptionMap[OptionMetricsPackageLabels]) != "false"
+}
+
+// GetInstallingRetryAfter 获取服务安装中时代理返回的 Retry-After 秒数
+func GetInstallingRetryAfter() int {
+	OptionMapRWMutex.RLock()
+	raw := OptionMap[OptionInstallingRetryAfter]
+	OptionMapRWMutex.RUnlock()
+	if seconds, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil && seconds > 0 {
+		return seconds
+	}
+	return DefaultInstallingRetryAfter
+}
+
+// GetMOTD 获取管理员配置的横幅/每日消息
+func GetMOTD() string {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	return OptionMap[OptionMOTD]
+}
+
+// GetMCPProtocolVersion 获取配置的 MCP 协议版本上限，为空表示使用 mcp-go 支持的最新版本
+func GetMCPProtocolVersion() string {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	return strings.TrimSpace(OptionMap[OptionMCPProtocolVersion])
+}
+
+// ParseMaintenanceWindow 解析 "开始/结束" 形式的维护窗口(RFC3339 时间)，结束时间须晚于开始时间
+func ParseMaintenanceWindow(value string) (start, end time.Time, err error) {
+	startRaw, endRaw, found := strings.Cut(strings.TrimSpace(value), "/")
+	if !found {
+		return start, end, fmt.Errorf("maintenance window %q must be \"start/end\"", value)
+	}
+	if start, err = time.Parse(time.RFC3339, strings.TrimSpace(startRaw)); err != nil {
+		return start, end, fmt.Errorf("invalid maintenance window start: %w", err)
+	}
+	if end, err = time.Parse(time.RFC3339, strings.TrimSpace(endRaw)); err != nil {
+		return start, end, fmt.Errorf("invalid maintenance window end: %w", err)
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("maintenance window end must be after its start")
+	}
+	return start, end, nil
+}
+
+// GetMaintenanceWindow 获取全局维护窗口，未配置或格式无效时 ok 为 false
+func GetMaintenanceWindow() (start, end time.Time, ok bool) {
+	OptionMapRWMutex.RLock()
+	raw := strings.TrimSpace(OptionMap[OptionMaintenanceWindow])
+	OptionMapRWMutex.RUnlock()
+	if raw == "" {
+		return start, end, false
+	}
+	start, end, err := ParseMaintenanceWindow(raw)
+	return start, end, err == nil
+}
@@ -92,12 +92,52 @@ func applyConfigMap(configMap map[string]string) error {
 		JWTSecret = configValue
 	}
 
+	if configValue, ok := configMap["SERVICES_CONFIG_DIR"]; ok && configValue != "" {
+		ServicesConfigDir = configValue
+	}
+
 	if configValue, ok := configMap["JWT_REFRESH_SECRET"]; ok && configValue != "" {
 		JWTRefreshSecret = configValue
 	} else if configValue, ok := configMap["JWT_SECRET"]; ok && configValue != "" {
 		JWTRefreshSecret = configValue
 	}
 
+	if configValue, ok := configMap["ROOT_USERNAME"]; ok && configValue != "" {
+		RootUsername = configValue
+	}
+
+	if configValue, ok := configMap["ROOT_PASSWORD"]; ok && configValue != "" {
+		RootPassword = configValue
+	}
+
+	if configValue, ok := configMap["EXTERNAL_IDENTITY_PROVIDER"]; ok && configValue != "" {
+		externalIdentityProvider, err := strconv.ParseBool(configValue)
+		if err != nil {
+			return fmt.Errorf("invalid value for EXTERNAL_IDENTITY_PROVIDER: %w", err)
+		}
+		ExternalIdentityProvider = externalIdentityProvider
+	}
+
+	if configValue, ok := configMap["TRUSTED_AUTH_HEADER"]; ok && configValue != "" {
+		TrustedAuthHeader = configValue
+	}
+
+	if configValue, ok := configMap["TRUSTED_AUTH_PROXIES"]; ok && configValue != "" {
+		TrustedAuthProxies = configValue
+	}
+
+	if configValue, ok := configMap["TRUSTED_FORWARDED_PROXIES"]; ok && configValue != "" {
+		TrustedForwardedProxies = configValue
+	}
+
+	if configValue, ok := configMap["TRUSTED_AUTH_AUTO_PROVISION"]; ok && configValue != "" {
+		autoProvision, err := strconv.ParseBool(configValue)
+		if err != nil {
+			return fmt.Errorf("invalid value for TRUSTED_AUTH_AUTO_PROVISION: %w", err)
+		}
+		TrustedAuthAutoProvision = autoProvision
+	}
+
 	if configValue, ok := configMap["PORT"]; ok && configValue != "" {
 		portInt, err := strconv.Atoi(configValue)
 		if err != nil {
@@ -106,6 +146,26 @@ func applyConfigMap(configMap map[string]string) error {
 		*Port = portInt
 	}
 
+	if configValue, ok := configMap["UNIX_SOCKET"]; ok && configValue != "" {
+		*UnixSocket = configValue
+	}
+
+	if configValue, ok := configMap["TLS_CERT_FILE"]; ok && configValue != "" {
+		*TLSCertFile = configValue
+	}
+
+	if configValue, ok := configMap["TLS_KEY_FILE"]; ok && configValue != "" {
+		*TLSKeyFile = configValue
+	}
+
+	if configValue, ok := configMap["HTTP_REDIRECT_PORT"]; ok && configValue != "" {
+		redirectPort, err := strconv.Atoi(configValue)
+		if err != nil {
+			return fmt.Errorf("invalid value for HTTP_REDIRECT_PORT: %w", err)
+		}
+		*RedirectPort = redirectPort
+	}
+
 	if configValue, ok := configMap["ENABLE_GZIP"]; ok && configValue != "" {
 		enableGzipBool, err := strconv.ParseBool(configValue)
 		if err != nil {
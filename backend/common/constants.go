@@ -19,6 +19,30 @@ var HomePageLink = ""
 var SessionSecret = uuid.New().String()
 var SQLitePath = "data/one-mcp.db"
 
+// DefaultRootPassword 是未配置 ROOT_PASSWORD 时自动创建的 root 账号使用的默认密码
+const DefaultRootPassword = "123456"
+
+// RootUsername / RootPassword 为首次启动时自动创建的 root 账号凭据，可通过 ROOT_USERNAME / ROOT_PASSWORD 配置；
+// RootPassword 为空时使用 DefaultRootPassword，并要求首次登录后修改密码
+var RootUsername = "root"
+var RootPassword = ""
+
+// ExternalIdentityProvider 为 true 时表示账号由外部身份提供方（OAuth 等）管理，不自动创建 root 账号
+var ExternalIdentityProvider = false
+
+// TrustedAuthHeader 非空时启用受信任请求头认证：来自 TrustedAuthProxies 的请求可通过该请求头（如 X-Forwarded-User）指定用户名；
+// TrustedAuthProxies 为逗号分隔的 IP 或 CIDR；TrustedAuthAutoProvision 为 true 时自动创建不存在的用户
+var TrustedAuthHeader = ""
+var TrustedAuthProxies = ""
+var TrustedAuthAutoProvision = false
+
+// TrustedForwardedProxies 为逗号分隔的 IP 或 CIDR；来自这些地址的请求可通过 X-Forwarded-Host / X-Forwarded-Proto
+// 指定对外可见的地址，用于生成 SSE 代理回调的 message endpoint，否则使用 ServerAddress
+var TrustedForwardedProxies = ""
+
+// ServicesConfigDir 为空时不启用；非空时启动和 SIGHUP 时从该目录的 JSON 文件同步服务定义
+var ServicesConfigDir = ""
+
 var OptionMap = make(map[string]string)
 
 var OptionMapRWMutex sync.RWMutex
@@ -44,8 +68,11 @@ var JWTRefreshExpiryHours = 168            // Refresh token expiry in hours (7 d
 const (
 	RoleGuestUser  = 0
 	RoleCommonUser = 1
-	RoleAdminUser  = 10
-	RoleRootUser   = 100
+	// RoleObserverUser can view services, health, logs and stats like an admin but cannot change state
+	// or send requests through the proxy and group endpoints
+	RoleObserverUser = 5
+	RoleAdminUser    = 10
+	RoleRootUser     = 100
 )
 
 var (
@@ -103,3 +130,361 @@ const (
 const (
 	OptionMcpToolCallTimeout = "McpToolCallTimeout"
 )
+
+// MCP warm-up ping timeout
+// A ping is sent right after the initialize handshake of every new upstream instance; if it fails, instance creation fails.
+// Values are parsed as time.Duration first (e.g. "5s"), then as seconds. "0" disables the warm-up ping. Default is 5 seconds.
+const (
+	OptionMcpWarmupPingTimeout = "McpWarmupPingTimeout"
+)
+
+// MCP initialize handshake timeout
+// Bounds how long a new upstream instance may take to answer the initialize request, separately from the overall
+// connect deadline and the tool call timeout; servers that load indexes or models on startup may need more.
+// Values are parsed as time.Duration first (e.g. "2m"), then as seconds. "0" leaves only the connect deadline.
+// Default is 30 seconds.
+const (
+	OptionMcpInitializeTimeout = "McpInitializeTimeout"
+)
+
+// Access time tracking granularity
+// Proxied requests record the last access time of their service, which drives the idle stop of on-demand stdio
+// services. The time is only rewritten when the recorded one is older than AccessTimeGranularity, so busy
+// services do not take a write lock on every request. Values are parsed as time.Duration first (e.g. "30s"),
+// then as seconds; "0" records every request. Default is 30 seconds, capped at half the idle timeout.
+const (
+	OptionAccessTimeGranularity = "AccessTimeGranularity"
+)
+
+// Maximum number of items listed from an upstream server while an instance is created.
+// Tools, prompts, resources and resource templates are each paginated until the cap is reached; the rest is
+// not exposed by the instance and a warning is logged, so a server with thousands of items cannot stall startup.
+// "0" disables the cap. Default is 1000 for each kind.
+const (
+	OptionMaxInstanceTools      = "MaxInstanceTools"
+	OptionMaxInstancePrompts    = "MaxInstancePrompts"
+	OptionMaxInstanceResources  = "MaxInstanceResources"
+	DefaultMaxInstanceListItems = 1000
+)
+
+// Connection limits of the HTTP client shared by npm registry and GitHub API requests.
+// MaxIdleConns caps idle keep-alive connections across all hosts, MaxIdleConnsPerHost caps them per host and
+// MaxConnsPerHost caps all (active + idle) connections to one host. "0" means unlimited for MaxIdleConns and
+// MaxConnsPerHost. Defaults are 100, 10 and 20.
+const (
+	OptionRegistryMaxIdleConns         = "RegistryMaxIdleConns"
+	OptionRegistryMaxIdleConnsPerHost  = "RegistryMaxIdleConnsPerHost"
+	OptionRegistryMaxConnsPerHost      = "RegistryMaxConnsPerHost"
+	DefaultRegistryMaxIdleConns        = 100
+	DefaultRegistryMaxIdleConnsPerHost = 10
+	DefaultRegistryMaxConnsPerHost     = 20
+)
+
+// uvx defaults
+// Default options passed to uvx when starting or installing Python services that do not set their own,
+// e.g. "3.12" for --python so services run on an isolated interpreter instead of the system Python, and
+// a private mirror for --index-url. Empty values add nothing.
+const (
+	OptionUVXPythonVersion = "UVXPythonVersion"
+	OptionUVXIndexURL      = "UVXIndexURL"
+)
+
+// MCP package install timeout
+// Maximum duration of a market installation task (package download + MCP initialize handshake).
+// Values are parsed as time.Duration first (e.g. "90s", "10m"), then as seconds if duration parsing fails.
+// Individual installation tasks may override it. Default is 5 minutes.
+const (
+	OptionMcpInstallTimeout  = "McpInstallTimeout"
+	DefaultMcpInstallTimeout = 5 * time.Minute
+)
+
+// Tool call fair queuing
+// ToolCallMaxConcurrency caps the tools/call requests running at once on one MCP instance; further calls wait
+// in a queue that is served round-robin across users, so a user sending a burst cannot starve the others.
+// "0" disables the limit and the queue. ToolCallQueueDepth caps the number of waiting calls per instance
+// (calls beyond it are rejected), and ToolCallQueueTimeout bounds how long a call may wait; it accepts
+// time.Duration values (e.g. "30s") or seconds. Defaults are 0 (unlimited), 100 and 30 seconds.
+const (
+	OptionToolCallMaxConcurrency = "ToolCallMaxConcurrency"
+	OptionToolCallQueueDepth     = "ToolCallQueueDepth"
+	OptionToolCallQueueTimeout   = "ToolCallQueueTimeout"
+	DefaultToolCallQueueDepth    = 100
+	DefaultToolCallQueueTimeout  = 30 * time.Second
+)
+
+// Group tools fetching
+// Group operations that need the tools of every member (list_all_tools, flat mode, OpenAPI and skill export)
+// fetch them with at most GroupToolsFetchConcurrency services in flight ("0" means no limit), and give up after
+// GroupToolsFetchTimeout: services that did not answer by then are reported as failed while the others are still
+// returned. The timeout accepts time.Duration values (e.g. "10s") or seconds. Defaults are 4 and 10 seconds.
+const (
+	OptionGroupToolsFetchConcurrency  = "GroupToolsFetchConcurrency"
+	OptionGroupToolsFetchTimeout      = "GroupToolsFetchTimeout"
+	DefaultGroupToolsFetchConcurrency = 4
+	DefaultGroupToolsFetchTimeout     = 10 * time.Second
+)
+
+// Maintenance window
+// MaintenanceWindow is a global "start/end" pair of RFC3339 times (e.g. "2026-01-02T22:00:00Z/2026-01-03T02:00:00Z").
+// Within it, and within a service's own window, health checks still run but the reported status stays as it was
+// when the window began, flagged as maintenance, so planned upstream downtime raises no alerts or auto-restarts.
+// Empty disables it.
+const (
+	OptionMaintenanceWindow = "MaintenanceWindow"
+)
+
+// Group tool name collisions
+// Saving a group checks the cached tools of its members for tool names provided by several services and, in flat
+// mode, for member tools that map to the same namespaced name. "warn" (default) returns the collisions with the
+// saved group, "reject" refuses to save a group with collisions, "off" skips the check.
+const (
+	OptionGroupToolNameCollisions = "GroupToolNameCollisions"
+	GroupToolNameCollisionsWarn   = "warn"
+	GroupToolNameCollisionsReject = "reject"
+	GroupToolNameCollisionsOff    = "off"
+)
+
+// Proxy kill-switch
+// When ProxyKillSwitch is "true" every /proxy and /group request is answered with 503 and a maintenance message
+// without reaching any upstream service, while the admin and management API keeps working so the switch can be
+// released. It is meant to stop all MCP traffic at once during an incident. Default is "false".
+const (
+	OptionProxyKillSwitch = "ProxyKillSwitch"
+)
+
+// Execute tool arguments strictness
+// execute_tool of a group takes the tool arguments as an object in "arguments". "lenient" also accepts them in
+// "parameters" and, when neither is given, collects the remaining top-level fields; "warn" (default) accepts the
+// same shapes but logs which fallback was used and reports it in the tool result; "strict" requires "arguments".
+const (
+	OptionExecuteArgsStrictness = "ExecuteArgsStrictness"
+	ExecuteArgsLenient          = "lenient"
+	ExecuteArgsWarn             = "warn"
+	ExecuteArgsStrict           = "strict"
+)
+
+// Active environment
+// DefaultEnvsJSON of a service may be written as environment profiles, an object of profile name to env map such
+// as {"default": {...}, "prod": {...}}. ActiveEnvironment selects the profile whose envs override those of the
+// "default" profile; a service without a profile of that name gets the "default" one. Flat env maps are used as
+// is. Switching it restarts the running instances of services with profiles. Default is "default".
+const (
+	OptionActiveEnvironment  = "ActiveEnvironment"
+	DefaultActiveEnvironment = "default"
+)
+
+// Uninstall scope
+// When UninstallInstallerOnly is "true" a service can only be uninstalled by the admin who installed it or by a
+// root user; services created by the system (batch import) stay uninstallable by any admin. Default is "false".
+const (
+	OptionUninstallInstallerOnly = "UninstallInstallerOnly"
+)
+
+// Health check concurrency
+// HealthCheckMaxConcurrency caps the background health checks running at once, so a check round over many
+// services does not ping or re-create all of them simultaneously; the remaining checks wait for a free slot.
+// "0" disables the limit. Default is 4.
+const (
+	OptionHealthCheckMaxConcurrency  = "HealthCheckMaxConcurrency"
+	DefaultHealthCheckMaxConcurrency = 4
+)
+
+// Stat/log write retry
+// Request stats and MCP logs whose database write failed are kept in a bounded in-memory queue and retried in the
+// background with exponential backoff until a row has been attempted WriteRetryMaxAttempts times in total. When
+// WriteRetryQueueSize writes are already waiting, further failed writes are dropped and counted. "0" queue size
+// disables the retry.
+// Defaults are 1000 queued writes and 5 attempts.
+const (
+	OptionWriteRetryQueueSize    = "WriteRetryQueueSize"
+	OptionWriteRetryMaxAttempts  = "WriteRetryMaxAttempts"
+	DefaultWriteRetryQueueSize   = 1000
+	DefaultWriteRetryMaxAttempts = 5
+)
+
+// Tool description trimming
+// Maximum number of characters of a tool description in the search_tools and list_all_tools output of group
+// endpoints; longer descriptions are cut with an ellipsis and the full text is returned when search_tools is
+// called with detail_tool. Groups may set their own limit. "0" (default) keeps descriptions untrimmed.
+const (
+	OptionToolDescriptionMaxLength = "ToolDescriptionMaxLength"
+)
+
+// Upstream 5xx storm restart (SSE/StreamableHTTP)
+// When at least UpstreamErrorRestartMinCalls tools/call requests ran on an instance within
+// UpstreamErrorRestartWindow and UpstreamErrorRestartThreshold percent of them failed with an upstream 5xx,
+// the instance is dropped and re-created, as after a failed ping. UpstreamErrorRestartCooldown is the minimum
+// time between two such restarts of the same instance. Durations accept time.Duration values or seconds.
+// A threshold of "0" disables the check. Defaults are 50%, 10 calls, 1 minute and 5 minutes.
+const (
+	OptionUpstreamErrorRestartThreshold  = "UpstreamErrorRestartThreshold"
+	OptionUpstreamErrorRestartMinCalls   = "UpstreamErrorRestartMinCalls"
+	OptionUpstreamErrorRestartWindow     = "UpstreamErrorRestartWindow"
+	OptionUpstreamErrorRestartCooldown   = "UpstreamErrorRestartCooldown"
+	DefaultUpstreamErrorRestartThreshold = 50
+	DefaultUpstreamErrorRestartMinCalls  = 10
+	DefaultUpstreamErrorRestartWindow    = time.Minute
+	DefaultUpstreamErrorRestartCooldown  = 5 * time.Minute
+)
+
+// Per-user install concurrency
+// Maximum number of pending/installing market installation tasks a single user may have at once.
+// 0 or a negative value disables the limit. Default is 3.
+const (
+	OptionMaxConcurrentInstallsPerUser  = "MaxConcurrentInstallsPerUser"
+	DefaultMaxConcurrentInstallsPerUser = 3
+)
+
+// Automatic proxy token generation
+// When enabled (default), new users get a proxy access token at registration and users without one get it
+// on their next login, so the proxy and exports work immediately. Set to "false" to require users to
+// generate the token manually.
+const (
+	OptionAutoGenerateUserToken = "AutoGenerateUserToken"
+)
+
+// Market search source priority
+// Comma-separated list of market search sources (e.g. "npm,pypi"). Results from all sources are merged by score;
+// ties, and the group order when a request asks for per-source grouping, follow this list. Default is "npm,pypi".
+const (
+	OptionMarketSourcePriority  = "MarketSourcePriority"
+	DefaultMarketSourcePriority = "npm,pypi"
+)
+
+// Install category allowlist for admins
+// Semicolon-separated "role=categories" entries, e.g. "admin=search,fetch,ai,utility". Install routes are
+// admin-only, so "admin" is the only role that applies: admins may only install services of the listed
+// categories. Entries for other roles are ignored; the root user is never restricted. Empty (default) disables the check.
+const (
+	OptionInstallCategoryAllowlist = "InstallCategoryAllowlist"
+)
+
+// Global instance reuse for user-specific handlers
+// When enabled (default), a user of a service with AllowUserOverride whose merged env is identical to the
+// service defaults is served by the global instance instead of a dedicated subprocess. Set to "false" to
+// always start a per-user instance.
+const (
+	OptionReuseGlobalUserInstances = "ReuseGlobalUserInstances"
+)
+
+// Cap on user-specific instances
+// MaxUserInstancesPerService caps the cached user-specific instances of one service. When a new one would exceed
+// it, the least recently used idle instances of the service are shut down; instances with requests in flight are
+// never evicted, so the cap may be exceeded while all of them are busy. "0" (default) means unlimited.
+const (
+	OptionMaxUserInstancesPerService = "MaxUserInstancesPerService"
+)
+
+// Cleanup of user-specific instances on user deletion
+// When enabled (default), deleting a user shuts down that user's dedicated service instances and removes the
+// user's service configs, so no subprocess outlives its owner. Set to "false" to keep them.
+const (
+	OptionCleanupUserInstancesOnDelete = "CleanupUserInstancesOnDelete"
+)
+
+// Unknown tool names in group calls
+// When enabled (default), execute_tool checks tool_name against the service's tool list before calling the upstream
+// and answers an unknown name with the available tools. Set to "false" to forward every call unchanged, e.g. for
+// upstreams that accept tools they do not list.
+const (
+	OptionRejectUnknownTools = "RejectUnknownTools"
+)
+
+// npm package integrity verification
+// When "true", market installs of npm packages first download the registry tarball and compare it with the
+// integrity value (and registry signatures when published) from the package metadata. Off by default.
+const (
+	OptionNpmVerifyIntegrity = "NpmVerifyIntegrity"
+)
+
+// Local service icon cache
+// When "true", the remote icon URL of a service installed from the market is downloaded into the data
+// directory and the service icon is rewritten to the local URL. The original URL is kept if the download fails.
+const (
+	OptionCacheServiceIcons = "CacheServiceIcons"
+)
+
+// Prometheus metrics package labels
+// Unless "false", onemcp_service_* metrics also carry package_manager and installed_version labels
+// taken from the service row. Labels never include users, so cardinality stays bounded by the service count.
+const (
+	OptionMetricsPackageLabels = "MetricsPackageLabels"
+)
+
+// Retry-After (seconds) returned by the proxy while a service is still being installed. Default is 10.
+const (
+	OptionInstallingRetryAfter  = "InstallingRetryAfter"
+	DefaultInstallingRetryAfter = 10
+)
+
+// Stdio working directory roots
+// Comma-separated list of absolute directories under which a service's WorkingDir must live.
+// Empty means any existing absolute directory is permitted.
+const (
+	OptionStdioWorkingDirRoots = "StdioWorkingDirRoots"
+)
+
+// Instance banner / message of the day shown by the frontend and CLI tools (returned by GET /api/meta)
+const (
+	OptionMOTD = "MOTD"
+)
+
+// Subprocess environment sanitizer
+// Controls which host environment variables are inherited by MCP subprocesses (install and runtime).
+// Both options are comma-separated lists of variable names; a trailing "*" matches a prefix (e.g. "NODE_*").
+// Passthrough extends the built-in safe allowlist, "*" restores full host inheritance.
+// Deny always wins over the allowlist and passthrough.
+const (
+	OptionSubprocessEnvPassthrough = "SubprocessEnvPassthrough"
+	OptionSubprocessEnvDeny        = "SubprocessEnvDeny"
+)
+
+// MCP protocol version advertised by groups and per-service proxies in their initialize result.
+// The version requested by the client is echoed when it is a known version not newer than this one;
+// otherwise this version is returned. Empty (default) uses the latest version supported by mcp-go.
+const (
+	OptionMCPProtocolVersion = "MCPProtocolVersion"
+)
+
+// Proxy request body sniffing
+// Maximum number of bytes read from a proxied POST body to detect the JSON-RPC method (and tool name).
+// The body is never fully buffered; the sniffed prefix is replayed in front of the remaining stream.
+// Default is 64KB.
+const (
+	OptionProxyBodySniffLimit  = "ProxyBodySniffLimit"
+	DefaultProxyBodySniffLimit = 64 * 1024
+)
+
+// Maximum size of an MCP request body sent with a wrong or missing Content-Type. Such a body is buffered
+// in full to check that it is JSON, so larger bodies are rejected with 413. Default is 4MB.
+const (
+	OptionMCPRequestBodyMaxSize  = "MCPRequestBodyMaxSize"
+	DefaultMCPRequestBodyMaxSize = 4 * 1024 * 1024
+)
+
+// Maximum number of SSE events buffered for a downstream client on the SSE proxy path.
+// When a slow client lets the buffer fill up, the client is disconnected instead of buffering more.
+// "0" disables the limit. Default is 256.
+const (
+	OptionSSEMaxBufferedEvents  = "SSEMaxBufferedEvents"
+	DefaultSSEMaxBufferedEvents = 256
+)
+
+// Proxy access log format for successful tools/call requests.
+// "text" (default) keeps the human-readable "MCP request OK | ..." line, "json" emits one JSON object,
+// any other value is a template with {user}, {service}, {type}, {action}, {path}, {duration_ms},
+// {status}, {client}, {tool} and {request_id} placeholders. Tool arguments are never logged.
+const (
+	OptionProxyAccessLogFormat = "ProxyAccessLogFormat"
+	ProxyAccessLogFormatText   = "text"
+	ProxyAccessLogFormatJSON   = "json"
+)
+
+// Executables that pre-start/post-stop hooks of stdio services may run.
+// Comma-separated; an entry matches the first word of a hook command exactly, either a bare name resolved
+// via PATH (e.g. "docker") or an absolute path (e.g. "/opt/hooks/prepare"). Hooks whose executable is not
+// listed are rejected when the service is saved and are not run. Default is DefaultHookCommandAllowlist.
+const (
+	OptionHookCommandAllowlist  = "HookCommandAllowlist"
+	DefaultHookCommandAllowlist = "docker,podman,mkdir,touch,cp,mv,rm"
+)
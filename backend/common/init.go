@@ -15,12 +15,16 @@ var (
 	PrintHelpFlag = flag.Bool("help", false, "print help and exit")
 	LogDir        = flag.String("log-dir", "", "specify the log directory")
 	EnableGzip    = flag.Bool("gzip", true, "enable gzip compression")
+	UnixSocket    = flag.String("unix-socket", "", "also listen on this Unix domain socket path (use --port 0 to disable TCP)")
+	TLSCertFile   = flag.String("tls-cert", "", "TLS certificate file; enables HTTPS on --port together with --tls-key")
+	TLSKeyFile    = flag.String("tls-key", "", "TLS private key file")
+	RedirectPort  = flag.Int("http-redirect-port", 0, "when TLS is enabled, redirect plain HTTP on this port to HTTPS (0 disables)")
 )
 
 func PrintHelp() {
 	fmt.Println("Copyright (C) 2025 Buru. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/burugo/one-mcp")
-	fmt.Println("Usage: one-mcp [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: one-mcp [--port <port>] [--unix-socket <path>] [--tls-cert <file> --tls-key <file>] [--log-dir <log directory>] [--version] [--help]")
 }
 
 func init() {
@@ -46,11 +50,43 @@ func init() {
 	if os.Getenv("JWT_SECRET") != "" {
 		JWTSecret = os.Getenv("JWT_SECRET")
 	}
+	if os.Getenv("SERVICES_CONFIG_DIR") != "" {
+		ServicesConfigDir = os.Getenv("SERVICES_CONFIG_DIR")
+	}
 	if os.Getenv("JWT_REFRESH_SECRET") != "" {
 		JWTRefreshSecret = os.Getenv("JWT_REFRESH_SECRET")
 	} else if os.Getenv("JWT_SECRET") != "" {
 		JWTRefreshSecret = os.Getenv("JWT_SECRET")
 	}
+	if os.Getenv("ROOT_USERNAME") != "" {
+		RootUsername = os.Getenv("ROOT_USERNAME")
+	}
+	if os.Getenv("ROOT_PASSWORD") != "" {
+		RootPassword = os.Getenv("ROOT_PASSWORD")
+	}
+	if os.Getenv("EXTERNAL_IDENTITY_PROVIDER") != "" {
+		externalIdentityProvider, err := strconv.ParseBool(os.Getenv("EXTERNAL_IDENTITY_PROVIDER"))
+		if err != nil {
+			log.Fatalf("invalid value for EXTERNAL_IDENTITY_PROVIDER: %v", err)
+		}
+		ExternalIdentityProvider = externalIdentityProvider
+	}
+	if os.Getenv("TRUSTED_AUTH_HEADER") != "" {
+		TrustedAuthHeader = os.Getenv("TRUSTED_AUTH_HEADER")
+	}
+	if os.Getenv("TRUSTED_AUTH_PROXIES") != "" {
+		TrustedAuthProxies = os.Getenv("TRUSTED_AUTH_PROXIES")
+	}
+	if os.Getenv("TRUSTED_FORWARDED_PROXIES") != "" {
+		TrustedForwardedProxies = os.Getenv("TRUSTED_FORWARDED_PROXIES")
+	}
+	if os.Getenv("TRUSTED_AUTH_AUTO_PROVISION") != "" {
+		autoProvision, err := strconv.ParseBool(os.Getenv("TRUSTED_AUTH_AUTO_PROVISION"))
+		if err != nil {
+			log.Fatalf("invalid value for TRUSTED_AUTH_AUTO_PROVISION: %v", err)
+		}
+		TrustedAuthAutoProvision = autoProvision
+	}
 	if os.Getenv("PORT") != "" {
 		portInt, err := strconv.Atoi(os.Getenv("PORT"))
 		if err != nil {
@@ -59,6 +95,24 @@ func init() {
 		*Port = portInt
 	}
 
+	if os.Getenv("UNIX_SOCKET") != "" {
+		*UnixSocket = os.Getenv("UNIX_SOCKET")
+	}
+
+	if os.Getenv("TLS_CERT_FILE") != "" {
+		*TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	}
+	if os.Getenv("TLS_KEY_FILE") != "" {
+		*TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	}
+	if os.Getenv("HTTP_REDIRECT_PORT") != "" {
+		redirectPort, err := strconv.Atoi(os.Getenv("HTTP_REDIRECT_PORT"))
+		if err != nil {
+			log.Fatalf("invalid value for HTTP_REDIRECT_PORT: %v", err)
+		}
+		*RedirectPort = redirectPort
+	}
+
 	if os.Getenv("ENABLE_GZIP") != "" {
 		enableGzipBool, err := strconv.ParseBool(os.Getenv("ENABLE_GZIP"))
 		if err != nil {
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// ListenUnixSocket 在 path 上监听 Unix domain socket。
+// 上次异常退出遗留的 socket 文件会被清理；已存在的普通文件不会被覆盖。
+func ListenUnixSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("unix socket path %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket %s: %w", path, err)
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// 允许同组的 sidecar 进程访问
+	if err := os.Chmod(path, 0o660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// RemoveUnixSocket unlinks the socket file; a missing file is not an error
+func RemoveUnixSocket(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		SysError(fmt.Sprintf("Failed to remove unix socket %s: %v", path, err))
+	}
+}
+
+// ServeListeners serves srv on every listener and returns the first error other than http.ErrServerClosed
+func ServeListeners(srv *http.Server, listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("no listeners configured")
+	}
+	errCh := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(l net.Listener) {
+			if tl, ok := l.(tlsListener); ok {
+				errCh <- srv.ServeTLS(tl.Listener, "", "")
+				return
+			}
+			errCh <- srv.Serve(l)
+		}(listener)
+	}
+	for range listeners {
+		if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeListenersOverUnixSocket(t *testing.T) {
+	// Unix socket paths are limited to ~104 bytes, so avoid the long t.TempDir path
+	dir, err := os.MkdirTemp("", "omcp")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "one-mcp.sock")
+
+	// A stale socket left by a crashed process is replaced
+	stale, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	unixListener, err := ListenUnixSocket(socketPath)
+	assert.NoError(t, err)
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	})}
+	done := make(chan error, 1)
+	go func() { done <- ServeListeners(srv, tcpListener, unixListener) }()
+
+	clients := map[string]*http.Client{
+		"unix": {Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		}}},
+		"tcp": http.DefaultClient,
+	}
+	urls := map[string]string{"unix": "http://unix/ping", "tcp": "http://" + tcpListener.Addr().String() + "/ping"}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			resp, err := client.Get(urls[name])
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, "pong", string(body))
+		})
+	}
+
+	// Shutting down closes the listeners, which unlinks the socket
+	assert.NoError(t, srv.Shutdown(context.Background()))
+	assert.NoError(t, <-done)
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestListenUnixSocketRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0o644))
+	_, err := ListenUnixSocket(path)
+	assert.Error(t, err)
+}
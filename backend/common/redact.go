@@ -0,0 +1,148 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RedactedPlaceholder 替换被脱敏的值
+const RedactedPlaceholder = "[REDACTED]"
+
+// defaultRedactKeyFragments 键名（小写、去掉 - 和 _ 后）包含这些片段时默认脱敏
+var defaultRedactKeyFragments = []string{
+	"password", "passwd", "secret", "token", "apikey", "accesskey", "privatekey",
+	"authorization", "credential", "cookie", "sessionid",
+}
+
+// RedactionRules 是服务级的日志脱敏规则（MCPService.RedactionRulesJSON）
+type RedactionRules struct {
+	Keys     []string `json:"keys"`     // 额外需要脱敏的参数名（不区分大小写，精确匹配）
+	Patterns []string `json:"patterns"` // 正则表达式，匹配到的文本替换为 [REDACTED]
+}
+
+// Redactor 在写日志前对工具参数和文本做脱敏，不会修改传入的原始数据
+type Redactor struct {
+	keys     map[string]bool
+	patterns []*regexp.Regexp
+}
+
+var redactorCache sync.Map // rules JSON -> *Redactor
+
+// ParseRedactionRules 解析并编译脱敏规则；空字符串表示只使用默认规则
+func ParseRedactionRules(rulesJSON string) (*Redactor, error) {
+	redactor := &Redactor{keys: make(map[string]bool)}
+	if strings.TrimSpace(rulesJSON) == "" {
+		return redactor, nil
+	}
+	var rules RedactionRules
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		return nil, fmt.Errorf("invalid redaction rules: %w", err)
+	}
+	for _, key := range rules.Keys {
+		if key = strings.TrimSpace(key); key != "" {
+			redactor.keys[strings.ToLower(key)] = true
+		}
+	}
+	for _, pattern := range rules.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		redactor.patterns = append(redactor.patterns, re)
+	}
+	return redactor, nil
+}
+
+// GetRedactor 返回规则对应的已编译 Redactor（带缓存）；规则无效时退回默认规则
+func GetRedactor(rulesJSON string) *Redactor {
+	if cached, ok := redactorCache.Load(rulesJSON); ok {
+		return cached.(*Redactor)
+	}
+	redactor, err := ParseRedactionRules(rulesJSON)
+	if err != nil {
+		SysError(fmt.Sprintf("[Redact] %v, falling back to default rules", err))
+		redactor, _ = ParseRedactionRules("")
+	}
+	redactorCache.Store(rulesJSON, redactor)
+	return redactor
+}
+
+// IsSensitiveKey reports whether values stored under key are redacted (default fragments or configured keys)
+func (r *Redactor) IsSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	if r.keys[lower] {
+		return true
+	}
+	normalized := strings.NewReplacer("-", "", "_", "").Replace(lower)
+	for _, fragment := range defaultRedactKeyFragments {
+		if strings.Contains(normalized, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactValue 返回 value 的脱敏副本：敏感键的值被替换，字符串按正则规则替换
+func (r *Redactor) RedactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			if r.IsSensitiveKey(key) {
+				out[key] = RedactedPlaceholder
+				continue
+			}
+			out[key] = r.RedactValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = r.RedactValue(item)
+		}
+		return out
+	case string:
+		return r.RedactString(v)
+	default:
+		return value
+	}
+}
+
+// RedactString 对文本应用正则规则
+func (r *Redactor) RedactString(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, RedactedPlaceholder)
+	}
+	return s
+}
+
+// RedactArgs 返回命令行参数的脱敏副本：敏感选项（如 --api-key=x 或 --token x）的值被替换，其余参数按正则规则替换
+func (r *Redactor) RedactArgs(args []string) []string {
+	out := make([]string, len(args))
+	maskNext := false
+	for i, arg := range args {
+		if maskNext {
+			out[i] = RedactedPlaceholder
+			maskNext = false
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			out[i] = r.RedactString(arg)
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch {
+		case !r.IsSensitiveKey(name):
+			out[i] = r.RedactString(arg)
+		case hasValue:
+			out[i] = arg[:strings.Index(arg, "=")+1] + RedactedPlaceholder
+		default:
+			out[i] = arg
+			maskNext = true
+		}
+	}
+	return out
+}
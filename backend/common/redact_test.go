@@ -0,0 +1,74 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactorRedactValue(t *testing.T) {
+	args := map[string]any{
+		"query":   "weather in paris",
+		"api_key": "sk-123",
+		"nested":  map[string]any{"Authorization": "Bearer abc", "items": []any{"card 4111-1111-1111-1111"}},
+		"ssn":     "123-45-6789",
+	}
+
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{
+			name:  "default secret keys",
+			rules: "",
+			want:  `{"api_key":"[REDACTED]","nested":{"Authorization":"[REDACTED]","items":["card 4111-1111-1111-1111"]},"query":"weather in paris","ssn":"123-45-6789"}`,
+		},
+		{
+			name:  "custom keys and patterns",
+			rules: `{"keys":["SSN"],"patterns":["\\d{4}-\\d{4}-\\d{4}-\\d{4}"]}`,
+			want:  `{"api_key":"[REDACTED]","nested":{"Authorization":"[REDACTED]","items":["card [REDACTED]"]},"query":"weather in paris","ssn":"[REDACTED]"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redactor, err := ParseRedactionRules(tt.rules)
+			assert.NoError(t, err)
+			data, err := json.Marshal(redactor.RedactValue(args))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+
+	// 脱敏只作用于副本
+	assert.Equal(t, "sk-123", args["api_key"])
+	assert.Equal(t, "Bearer abc", args["nested"].(map[string]any)["Authorization"])
+}
+
+func TestParseRedactionRulesRejectsInvalidRules(t *testing.T) {
+	for _, rules := range []string{`{"patterns":["("]}`, `not json`} {
+		_, err := ParseRedactionRules(rules)
+		assert.Error(t, err, rules)
+	}
+}
+
+func TestRedactorRedactArgs(t *testing.T) {
+	redactor, err := ParseRedactionRules(`{"patterns":["sk-[a-z0-9]+"]}`)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"inline value", []string{"--api-key=abc", "--port=8080"}, []string{"--api-key=[REDACTED]", "--port=8080"}},
+		{"separate value", []string{"-y", "--token", "abc", "server.js"}, []string{"-y", "--token", "[REDACTED]", "server.js"}},
+		{"pattern in positional arg", []string{"run", "sk-abc123"}, []string{"run", "[REDACTED]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, redactor.RedactArgs(tt.args))
+		})
+	}
+}
@@ -64,7 +64,9 @@ func FormatTime(t time.Time) string {
 
 // JSON-RPC 2.0 error codes
 const (
+	JSONRPCErrorCodeParseError     = -32700
 	JSONRPCErrorCodeInvalidRequest = -32600
+	JSONRPCErrorCodeServerError    = -32000
 )
 
 // RespJSONRPCError returns a JSON-RPC 2.0 formatted error response for MCP clients
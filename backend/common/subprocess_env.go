@@ -0,0 +1,117 @@
+package common
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// defaultSubprocessEnvAllowlist 是子进程默认可继承的宿主环境变量（路径、区域设置、代理等运行必需项）
+var defaultSubprocessEnvAllowlist = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"SHELL",
+	"TERM",
+	"TZ",
+	"LANG",
+	"LANGUAGE",
+	"LC_*",
+	"TMPDIR",
+	"TEMP",
+	"TMP",
+	"XDG_*",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"http_proxy",
+	"https_proxy",
+	"no_proxy",
+	"SSL_CERT_FILE",
+	"SSL_CERT_DIR",
+	"NODE_EXTRA_CA_CERTS",
+	// Windows essentials
+	"SystemRoot",
+	"SystemDrive",
+	"ComSpec",
+	"PATHEXT",
+	"WINDIR",
+	"APPDATA",
+	"LOCALAPPDATA",
+	"USERPROFILE",
+	"PROGRAMDATA",
+	"ProgramFiles",
+	"ProgramFiles(x86)",
+}
+
+// SubprocessEnv 返回传递给 MCP 子进程的环境变量：经过过滤的宿主环境 + 服务自身的环境变量。
+// 服务自身的 serviceEnv（KEY=VALUE 形式）始终保留，且在同名时覆盖宿主值。
+func SubprocessEnv(serviceEnv []string) []string {
+	OptionMapRWMutex.RLock()
+	passthrough := OptionMap[OptionSubprocessEnvPassthrough]
+	deny := OptionMap[OptionSubprocessEnvDeny]
+	OptionMapRWMutex.RUnlock()
+	return BuildSubprocessEnv(os.Environ(), serviceEnv, splitEnvPatterns(passthrough), splitEnvPatterns(deny))
+}
+
+// BuildSubprocessEnv filters hostEnv through the default allowlist plus passthrough patterns,
+// drops anything matching deny, then appends serviceEnv.
+func BuildSubprocessEnv(hostEnv []string, serviceEnv []string, passthrough []string, deny []string) []string {
+	allow := append(append([]string{}, defaultSubprocessEnvAllowlist...), passthrough...)
+	env := make([]string, 0, len(hostEnv)+len(serviceEnv))
+	for _, kv := range hostEnv {
+		key, _, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			continue
+		}
+		if matchEnvPatterns(key, deny) || !matchEnvPatterns(key, allow) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(env, serviceEnv...)
+}
+
+func splitEnvPatterns(raw string) []string {
+	var patterns []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func matchEnvPatterns(key string, patterns []string) bool {
+	for _, p := range patterns {
+		if p == "*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if envKeyHasPrefix(key, prefix) {
+				return true
+			}
+			continue
+		}
+		if envKeyEqual(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Windows 环境变量名大小写不敏感
+func envKeyEqual(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func envKeyHasPrefix(key, prefix string) bool {
+	if runtime.GOOS == "windows" {
+		return len(key) >= len(prefix) && strings.EqualFold(key[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(key, prefix)
+}
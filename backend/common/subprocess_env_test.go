@@ -0,0 +1,101 @@
+package common
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSubprocessEnv(t *testing.T) {
+	hostEnv := []string{
+		"PATH=/usr/bin",
+		"LANG=en_US.UTF-8",
+		"LC_ALL=C",
+		"GITHUB_TOKEN=ghp_secret",
+		"AWS_SECRET_ACCESS_KEY=aws_secret",
+		"NODE_OPTIONS=--max-old-space-size=4096",
+	}
+
+	tests := []struct {
+		name        string
+		passthrough []string
+		deny        []string
+		serviceEnv  []string
+		wantKeys    []string
+		absentKeys  []string
+	}{
+		{
+			name:       "default allowlist drops host secrets",
+			serviceEnv: []string{"API_KEY=svc"},
+			wantKeys:   []string{"PATH", "LANG", "LC_ALL", "API_KEY"},
+			absentKeys: []string{"GITHUB_TOKEN", "AWS_SECRET_ACCESS_KEY", "NODE_OPTIONS"},
+		},
+		{
+			name:        "passthrough supports exact names and prefixes",
+			passthrough: []string{"GITHUB_TOKEN", "NODE_*"},
+			wantKeys:    []string{"PATH", "GITHUB_TOKEN", "NODE_OPTIONS"},
+			absentKeys:  []string{"AWS_SECRET_ACCESS_KEY"},
+		},
+		{
+			name:        "deny wins over wildcard passthrough",
+			passthrough: []string{"*"},
+			deny:        []string{"GITHUB_TOKEN", "AWS_*"},
+			wantKeys:    []string{"PATH", "NODE_OPTIONS"},
+			absentKeys:  []string{"GITHUB_TOKEN", "AWS_SECRET_ACCESS_KEY"},
+		},
+		{
+			name:       "service env is kept even if the key is not allowlisted",
+			deny:       []string{"GITHUB_TOKEN"},
+			serviceEnv: []string{"GITHUB_TOKEN=service_owned"},
+			wantKeys:   []string{"GITHUB_TOKEN"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := BuildSubprocessEnv(hostEnv, tt.serviceEnv, tt.passthrough, tt.deny)
+			keys := map[string]bool{}
+			for _, kv := range env {
+				key, _, _ := strings.Cut(kv, "=")
+				keys[key] = true
+			}
+			for _, k := range tt.wantKeys {
+				assert.True(t, keys[k], "expected %s in env", k)
+			}
+			for _, k := range tt.absentKeys {
+				assert.False(t, keys[k], "did not expect %s in env", k)
+			}
+		})
+	}
+}
+
+func TestSubprocessEnv_DeniedHostVarNotInChildProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on the POSIX env command")
+	}
+	envPath, err := exec.LookPath("env")
+	if err != nil {
+		t.Skip("env command not available")
+	}
+
+	t.Setenv("GITHUB_TOKEN", "ghp_should_not_leak")
+	OptionMapRWMutex.Lock()
+	original := OptionMap
+	OptionMap = map[string]string{}
+	OptionMapRWMutex.Unlock()
+	defer func() {
+		OptionMapRWMutex.Lock()
+		OptionMap = original
+		OptionMapRWMutex.Unlock()
+	}()
+
+	cmd := exec.Command(envPath)
+	cmd.Env = SubprocessEnv([]string{"SERVICE_VAR=ok"})
+	out, err := cmd.Output()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "GITHUB_TOKEN=")
+	assert.Contains(t, string(out), "SERVICE_VAR=ok")
+}
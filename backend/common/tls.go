@@ -0,0 +1,140 @@
+package common
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HSTSMaxAge is the max-age (seconds) advertised in Strict-Transport-Security when TLS is enabled
+const HSTSMaxAge = 365 * 24 * 60 * 60
+
+// certReloadCheckInterval 限制检查证书文件是否更新的频率
+const certReloadCheckInterval = 10 * time.Second
+
+// TLSEnabled reports whether HTTPS is configured. Configuring only one of the certificate and key files is an
+// error instead of silently serving plain HTTP.
+func TLSEnabled(certFile, keyFile string) (bool, error) {
+	if certFile == "" && keyFile == "" {
+		return false, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return false, errors.New("TLS needs both --tls-cert (TLS_CERT_FILE) and --tls-key (TLS_KEY_FILE), only one of them is set")
+	}
+	return true, nil
+}
+
+// CertReloader 提供 tls.Config.GetCertificate，在证书/私钥文件被替换（如 certbot 续期）后自动加载新证书
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader loads the certificate pair and returns a reloader for it
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
+
+func (r *CertReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return fmt.Errorf("failed to stat TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. A failed reload keeps serving the previous certificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	cert, modTime, checkedAt := r.cert, r.modTime, r.checkedAt
+	r.mu.RUnlock()
+
+	if time.Since(checkedAt) < certReloadCheckInterval {
+		return cert, nil
+	}
+	latest, err := r.latestModTime()
+	if err == nil && latest.After(modTime) {
+		if err := r.reload(); err != nil {
+			SysError("TLS certificate reload failed, keeping previous certificate: " + err.Error())
+		} else {
+			SysLog("TLS certificate reloaded from " + r.certFile)
+		}
+	}
+	r.mu.Lock()
+	r.checkedAt = time.Now()
+	cert = r.cert
+	r.mu.Unlock()
+	return cert, nil
+}
+
+// TLSConfig returns a server TLS config backed by the reloader
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// tlsListener marks a listener that ServeListeners must serve with TLS (srv.TLSConfig)
+type tlsListener struct {
+	net.Listener
+}
+
+// TLSListener wraps l so that ServeListeners serves it over TLS using the server's TLSConfig.
+// ServeTLS is used instead of tls.NewListener so HTTP/2 is negotiated as well.
+func TLSListener(l net.Listener) net.Listener {
+	return tlsListener{Listener: l}
+}
+
+// HTTPSRedirectHandler redirects plain HTTP requests to the HTTPS listener on httpsPort
+func HTTPSRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,161 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and returns its parsed form
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, commonName string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
+
+func TestServeListenersOverTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	cert := writeSelfSignedCert(t, certFile, keyFile, "one-mcp-test")
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	assert.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	// SSE-style handler: every event must reach the client as soon as it is flushed
+	release := make(chan struct{})
+	srv := &http.Server{
+		TLSConfig: reloader.TLSConfig(),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: first\n\n")
+			w.(http.Flusher).Flush()
+			<-release
+			fmt.Fprint(w, "data: second\n\n")
+		}),
+	}
+	done := make(chan error, 1)
+	go func() { done <- ServeListeners(srv, TLSListener(listener)) }()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	for _, forceHTTP2 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("http2=%v", forceHTTP2), func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: pool},
+				ForceAttemptHTTP2: forceHTTP2,
+			}}
+			resp, err := client.Get("https://" + listener.Addr().String() + "/events")
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			assert.NotNil(t, resp.TLS)
+			if forceHTTP2 {
+				assert.Equal(t, 2, resp.ProtoMajor)
+			}
+
+			reader := bufio.NewReader(resp.Body)
+			line, err := reader.ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, "data: first\n", line)
+			release <- struct{}{}
+		})
+	}
+
+	assert.NoError(t, srv.Shutdown(context.Background()))
+	assert.NoError(t, <-done)
+}
+
+func TestCertReloaderPicksUpRotatedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile, "original")
+	reloader, err := NewCertReloader(certFile, keyFile)
+	assert.NoError(t, err)
+
+	rotated := writeSelfSignedCert(t, certFile, keyFile, "rotated")
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, future, future))
+	reloader.checkedAt = time.Time{} // skip the reload check throttle
+
+	current, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, rotated.Raw, current.Certificate[0])
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsPort int
+		host      string
+		want      string
+	}{
+		{443, "example.com:80", "https://example.com/api/status?x=1"},
+		{8443, "example.com", "https://example.com:8443/api/status?x=1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/api/status?x=1", nil)
+		recorder := httptest.NewRecorder()
+		HTTPSRedirectHandler(tt.httpsPort).ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusPermanentRedirect, recorder.Code)
+		assert.Equal(t, tt.want, recorder.Header().Get("Location"))
+	}
+}
+
+func TestTLSEnabledRequiresCertAndKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		want     bool
+		wantErr  bool
+	}{
+		{"not configured", "", "", false, false},
+		{"cert and key", "cert.pem", "key.pem", true, false},
+		{"cert only", "cert.pem", "", false, true},
+		{"key only", "", "key.pem", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enabled, err := TLSEnabled(tt.certFile, tt.keyFile)
+			assert.Equal(t, tt.want, enabled)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// IsTrustedAuthProxy reports whether ip (the direct peer of the connection) is listed in TrustedAuthProxies.
+// Entries may be single addresses or CIDR ranges; invalid entries are ignored.
+func IsTrustedAuthProxy(ip string) bool {
+	return addressListed(ip, TrustedAuthProxies)
+}
+
+// IsTrustedForwardedProxy reports whether ip (the direct peer of the connection) is listed in
+// TrustedForwardedProxies, i.e. whether its X-Forwarded-Host / X-Forwarded-Proto headers may be honoured.
+func IsTrustedForwardedProxy(ip string) bool {
+	return addressListed(ip, TrustedForwardedProxies)
+}
+
+// addressListed reports whether ip matches one of the comma separated addresses or CIDR ranges in list
+func addressListed(ip string, list string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if prefix, err := netip.ParsePrefix(entry); err == nil && prefix.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if trusted, err := netip.ParseAddr(entry); err == nil && trusted.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateWorkingDir 校验 stdio 服务的工作目录：必须是已存在的绝对路径目录，
+// 且在配置了 StdioWorkingDirRoots 时位于其中某个根目录之下。返回清理后的路径。
+func ValidateWorkingDir(dir string) (string, error) {
+	OptionMapRWMutex.RLock()
+	roots := OptionMap[OptionStdioWorkingDirRoots]
+	OptionMapRWMutex.RUnlock()
+	return ValidateWorkingDirWithRoots(dir, splitEnvPatterns(roots))
+}
+
+// ValidateWorkingDirWithRoots validates dir against an explicit list of allowed roots (empty allows any directory)
+func ValidateWorkingDirWithRoots(dir string, roots []string) (string, error) {
+	dir = strings.TrimSpace(dir)
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("working directory %q must be an absolute path", dir)
+	}
+	dir = filepath.Clean(dir)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("working directory %q is not accessible: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("working directory %q is not a directory", dir)
+	}
+	if len(roots) == 0 {
+		return dir, nil
+	}
+
+	// 解析符号链接，避免通过链接跳出允许的根目录
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("working directory %q cannot be resolved: %w", dir, err)
+	}
+	for _, root := range roots {
+		resolvedRoot, err := filepath.EvalSymlinks(filepath.Clean(root))
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(resolvedRoot, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("working directory %q is outside the permitted roots", dir)
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWorkingDirWithRoots(t *testing.T) {
+	root := t.TempDir()
+	inside := filepath.Join(root, "project")
+	assert.NoError(t, os.Mkdir(inside, 0o755))
+	outside := t.TempDir()
+	file := filepath.Join(root, "file.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("x"), 0o644))
+
+	tests := []struct {
+		name    string
+		dir     string
+		roots   []string
+		want    string
+		wantErr bool
+	}{
+		{"any directory without roots", outside, nil, outside, false},
+		{"cleans path", inside + "/../project/", nil, inside, false},
+		{"inside root", inside, []string{root}, inside, false},
+		{"root itself", root, []string{root}, root, false},
+		{"outside root", outside, []string{root}, "", true},
+		{"relative path", "project", nil, "", true},
+		{"missing directory", filepath.Join(root, "missing"), nil, "", true},
+		{"not a directory", file, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateWorkingDirWithRoots(tt.dir, tt.roots)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
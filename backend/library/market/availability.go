@@ -0,0 +1,47 @@
+package market
+
+import (
+	"sync"
+	"time"
+)
+
+// packageManagerAvailabilityTTL 控制包管理器检测结果的缓存时长，避免每次请求都启动子进程
+const packageManagerAvailabilityTTL = 5 * time.Minute
+
+// PackageManagerAvailability 表示运行时可用的包管理器
+type PackageManagerAvailability struct {
+	NPX bool `json:"npx"`
+	UVX bool `json:"uvx"`
+}
+
+var (
+	availabilityMu        sync.Mutex
+	availabilityCached    PackageManagerAvailability
+	availabilityCheckedAt time.Time
+
+	// Mockable in tests
+	checkNPXAvailableFunc = CheckNPXAvailable
+	checkUVXAvailableFunc = CheckUVXAvailable
+)
+
+// GetPackageManagerAvailability returns the cached npx/uvx availability, re-detecting after the TTL expires
+func GetPackageManagerAvailability() PackageManagerAvailability {
+	availabilityMu.Lock()
+	defer availabilityMu.Unlock()
+	if !availabilityCheckedAt.IsZero() && time.Since(availabilityCheckedAt) < packageManagerAvailabilityTTL {
+		return availabilityCached
+	}
+	availabilityCached = PackageManagerAvailability{
+		NPX: checkNPXAvailableFunc(),
+		UVX: checkUVXAvailableFunc(),
+	}
+	availabilityCheckedAt = time.Now()
+	return availabilityCached
+}
+
+// ResetPackageManagerAvailability drops the cached result so the next call re-detects
+func ResetPackageManagerAvailability() {
+	availabilityMu.Lock()
+	defer availabilityMu.Unlock()
+	availabilityCheckedAt = time.Time{}
+}
@@ -0,0 +1,30 @@
+package market
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPackageManagerAvailabilityCaches(t *testing.T) {
+	originalNPX, originalUVX := checkNPXAvailableFunc, checkUVXAvailableFunc
+	defer func() {
+		checkNPXAvailableFunc, checkUVXAvailableFunc = originalNPX, originalUVX
+		ResetPackageManagerAvailability()
+	}()
+
+	npxCalls, uvxCalls := 0, 0
+	checkNPXAvailableFunc = func() bool { npxCalls++; return true }
+	checkUVXAvailableFunc = func() bool { uvxCalls++; return false }
+	ResetPackageManagerAvailability()
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, PackageManagerAvailability{NPX: true, UVX: false}, GetPackageManagerAvailability())
+	}
+	assert.Equal(t, 1, npxCalls)
+	assert.Equal(t, 1, uvxCalls)
+
+	ResetPackageManagerAvailability()
+	GetPackageManagerAvailability()
+	assert.Equal(t, 2, npxCalls)
+}
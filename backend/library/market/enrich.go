@@ -0,0 +1,93 @@
+package market
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// npmEnrichmentTTL 控制按需补充的包元数据(GitHub stars 等)的内存缓存时长，与 stars 的 Redis 缓存一致
+const npmEnrichmentTTL = 10 * time.Minute
+
+// PackageEnrichment 是搜索结果之外按需补充的包元数据，前端只为可见的结果请求
+type PackageEnrichment struct {
+	Name          string `json:"name"`
+	RepositoryURL string `json:"repository_url,omitempty"`
+	Homepage      string `json:"homepage,omitempty"`
+	License       string `json:"license,omitempty"`
+	Stars         int    `json:"github_stars"`
+}
+
+type npmEnrichmentEntry struct {
+	enrichment *PackageEnrichment
+	storedAt   time.Time
+}
+
+var (
+	npmEnrichmentMu    sync.Mutex
+	npmEnrichmentCache = map[string]npmEnrichmentEntry{}
+	// npmEnrichmentMaxEntries 限制缓存条目数：包名来自用户输入，不加上限时缓存会无限增长
+	npmEnrichmentMaxEntries = 1024
+
+	// Mockable in tests
+	getNPMPackageDetailsFunc = GetNPMPackageDetails
+	fetchGitHubStarsFunc     = FetchGitHubStars
+)
+
+// EnrichNPMPackage 返回 npm 包的 GitHub stars 与仓库信息，结果按包名缓存 npmEnrichmentTTL；
+// 获取包详情失败时返回错误且不缓存，stars 获取失败时为 0
+func EnrichNPMPackage(ctx context.Context, packageName string) (*PackageEnrichment, error) {
+	npmEnrichmentMu.Lock()
+	entry, ok := npmEnrichmentCache[packageName]
+	npmEnrichmentMu.Unlock()
+	if ok && time.Since(entry.storedAt) < npmEnrichmentTTL {
+		return entry.enrichment, nil
+	}
+
+	details, err := getNPMPackageDetailsFunc(ctx, packageName)
+	if err != nil {
+		return nil, err
+	}
+	enrichment := &PackageEnrichment{
+		Name:          packageName,
+		RepositoryURL: details.Repository.URL,
+		Homepage:      details.Homepage,
+		License:       details.License,
+	}
+	for _, candidate := range []string{details.Repository.URL, details.Homepage} {
+		if !strings.Contains(candidate, "github.com") {
+			continue
+		}
+		if owner, repo := ParseGitHubRepo(candidate); owner != "" && repo != "" {
+			enrichment.Stars = fetchGitHubStarsFunc(ctx, owner, repo)
+			break
+		}
+	}
+
+	storeNPMEnrichment(packageName, enrichment)
+	return enrichment, nil
+}
+
+// storeNPMEnrichment 写入缓存；达到上限时先清理过期条目，仍然已满则淘汰最早写入的条目
+func storeNPMEnrichment(packageName string, enrichment *PackageEnrichment) {
+	npmEnrichmentMu.Lock()
+	defer npmEnrichmentMu.Unlock()
+
+	if _, exists := npmEnrichmentCache[packageName]; !exists && len(npmEnrichmentCache) >= npmEnrichmentMaxEntries {
+		oldestKey, oldestAt := "", time.Time{}
+		for key, entry := range npmEnrichmentCache {
+			if time.Since(entry.storedAt) >= npmEnrichmentTTL {
+				delete(npmEnrichmentCache, key)
+				continue
+			}
+			if oldestKey == "" || entry.storedAt.Before(oldestAt) {
+				oldestKey, oldestAt = key, entry.storedAt
+			}
+		}
+		if len(npmEnrichmentCache) >= npmEnrichmentMaxEntries {
+			delete(npmEnrichmentCache, oldestKey)
+		}
+	}
+	npmEnrichmentCache[packageName] = npmEnrichmentEntry{enrichment: enrichment, storedAt: time.Now()}
+}
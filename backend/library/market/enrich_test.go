@@ -0,0 +1,79 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrichNPMPackageCachesResult(t *testing.T) {
+	originalDetails, originalStars := getNPMPackageDetailsFunc, fetchGitHubStarsFunc
+	defer func() {
+		getNPMPackageDetailsFunc, fetchGitHubStarsFunc = originalDetails, originalStars
+		npmEnrichmentMu.Lock()
+		npmEnrichmentCache = map[string]npmEnrichmentEntry{}
+		npmEnrichmentMu.Unlock()
+	}()
+
+	detailCalls, starCalls := 0, 0
+	getNPMPackageDetailsFunc = func(ctx context.Context, packageName string) (*NPMPackageDetails, error) {
+		detailCalls++
+		if packageName == "missing-pkg" {
+			return nil, errors.New("npm API returned error: not found, status code: 404")
+		}
+		details := &NPMPackageDetails{Name: packageName, License: "MIT"}
+		details.Repository.URL = "git+https://github.com/acme/" + packageName + ".git"
+		return details, nil
+	}
+	fetchGitHubStarsFunc = func(ctx context.Context, owner, repo string) int {
+		starCalls++
+		assert.Equal(t, "acme", owner)
+		assert.Equal(t, "server-fs", repo)
+		return 1234
+	}
+
+	for i := 0; i < 2; i++ {
+		enrichment, err := EnrichNPMPackage(context.Background(), "server-fs")
+		assert.NoError(t, err)
+		assert.Equal(t, &PackageEnrichment{Name: "server-fs", RepositoryURL: "git+https://github.com/acme/server-fs.git", License: "MIT", Stars: 1234}, enrichment)
+	}
+	assert.Equal(t, 1, detailCalls)
+	assert.Equal(t, 1, starCalls)
+
+	// 失败的结果不缓存，下次请求会重试
+	for i := 0; i < 2; i++ {
+		_, err := EnrichNPMPackage(context.Background(), "missing-pkg")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 3, detailCalls)
+}
+
+func TestEnrichNPMPackageCacheIsBounded(t *testing.T) {
+	originalDetails, originalStars, originalMax := getNPMPackageDetailsFunc, fetchGitHubStarsFunc, npmEnrichmentMaxEntries
+	defer func() {
+		getNPMPackageDetailsFunc, fetchGitHubStarsFunc, npmEnrichmentMaxEntries = originalDetails, originalStars, originalMax
+		npmEnrichmentMu.Lock()
+		npmEnrichmentCache = map[string]npmEnrichmentEntry{}
+		npmEnrichmentMu.Unlock()
+	}()
+	npmEnrichmentMaxEntries = 3
+	getNPMPackageDetailsFunc = func(ctx context.Context, packageName string) (*NPMPackageDetails, error) {
+		return &NPMPackageDetails{Name: packageName}, nil
+	}
+	fetchGitHubStarsFunc = func(ctx context.Context, owner, repo string) int { return 0 }
+
+	for _, name := range []string{"pkg-a", "pkg-b", "pkg-c", "pkg-d", "pkg-e"} {
+		_, err := EnrichNPMPackage(context.Background(), name)
+		assert.NoError(t, err)
+	}
+
+	// 超过上限后淘汰最早写入的条目
+	npmEnrichmentMu.Lock()
+	defer npmEnrichmentMu.Unlock()
+	assert.Len(t, npmEnrichmentCache, 3)
+	assert.NotContains(t, npmEnrichmentCache, "pkg-a")
+	assert.NotContains(t, npmEnrichmentCache, "pkg-b")
+	assert.Contains(t, npmEnrichmentCache, "pkg-e")
+}
@@ -3,8 +3,10 @@ package market
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"one-mcp/backend/common"
 	"one-mcp/backend/model"
 	"strings"
 	"sync"
@@ -35,18 +37,48 @@ type InstallationTask struct {
 	Command          string                // 命令
 	Args             []string              // 参数列表
 	EnvVars          map[string]string     // 环境变量
+	Timeout          time.Duration         // 最大安装时长, 为 0 时使用全局 McpInstallTimeout
 	Status           InstallationStatus    // 状态
 	StartTime        time.Time             // 开始时间
 	EndTime          time.Time             // 结束时间
 	Output           string                // 输出信息
 	Error            string                // 错误信息
+	TimedOut         bool                  // 是否因超时失败
+	Integrity        string                // 安装前校验通过的 npm 包完整性值(开启 NpmVerifyIntegrity 时)
 	CompletionNotify chan InstallationTask // 完成通知
 }
 
+// Elapsed 返回任务已运行的时长；任务结束后返回最终耗时
+func (t *InstallationTask) Elapsed() time.Duration {
+	if t.StartTime.IsZero() {
+		return 0
+	}
+	if t.EndTime.IsZero() {
+		return time.Since(t.StartTime)
+	}
+	return t.EndTime.Sub(t.StartTime)
+}
+
+// effectiveTimeout 返回任务级超时，未设置时回退到全局配置
+func (t *InstallationTask) effectiveTimeout() time.Duration {
+	if t.Timeout > 0 {
+		return t.Timeout
+	}
+	return common.GetMcpInstallTimeout()
+}
+
+// 实际执行安装的函数，测试中可替换
+var (
+	installNPMPackageFunc  = InstallNPMPackage
+	installPyPIPackageFunc = InstallPyPIPackage
+	verifyNPMIntegrityFunc = VerifyNPMPackageIntegrity
+)
+
 // InstallationManager 管理安装任务
 type InstallationManager struct {
-	tasks      map[int64]*InstallationTask // ServiceID -> Task
-	tasksMutex sync.RWMutex
+	tasks        map[int64]*InstallationTask // ServiceID -> Task
+	reservations map[int64]int               // UserID -> 已预留但尚未提交任务的名额
+	tasksMutex   sync.RWMutex
 }
 
 // 全局安装管理器
@@ -80,6 +112,73 @@ func (m *InstallationManager) GetTaskStatus(serviceID int64) (*InstallationTask,
 	return task, exists
 }
 
+// ActiveTaskCountForUser 返回用户处于 pending/installing 状态的任务数；任务进入终态后自动释放名额
+func (m *InstallationManager) ActiveTaskCountForUser(userID int64) int {
+	m.tasksMutex.RLock()
+	defer m.tasksMutex.RUnlock()
+
+	return m.activeTaskCountLocked(userID)
+}
+
+func (m *InstallationManager) activeTaskCountLocked(userID int64) int {
+	count := 0
+	for _, task := range m.tasks {
+		if task.UserID == userID && (task.Status == StatusPending || task.Status == StatusInstalling) {
+			count++
+		}
+	}
+	return count
+}
+
+// UserAtInstallLimit 报告用户进行中（含已预留）的安装任务是否已达到上限（limit <= 0 表示不限制）
+func (m *InstallationManager) UserAtInstallLimit(userID int64, limit int) bool {
+	m.tasksMutex.RLock()
+	defer m.tasksMutex.RUnlock()
+
+	return limit > 0 && m.activeTaskCountLocked(userID)+m.reservations[userID] >= limit
+}
+
+// ReserveInstallSlot 在同一把锁内检查上限并为用户预留一个安装名额，避免并发请求同时通过检查而超过上限。
+// 返回的 release 在任务提交（或放弃安装）后调用以归还预留；达到上限时返回 false。
+func (m *InstallationManager) ReserveInstallSlot(userID int64, limit int) (release func(), ok bool) {
+	if limit <= 0 {
+		return func() {}, true
+	}
+
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+
+	if m.activeTaskCountLocked(userID)+m.reservations[userID] >= limit {
+		return nil, false
+	}
+	if m.reservations == nil {
+		m.reservations = make(map[int64]int)
+	}
+	m.reservations[userID]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.tasksMutex.Lock()
+			defer m.tasksMutex.Unlock()
+			if m.reservations[userID] <= 1 {
+				delete(m.reservations, userID)
+			} else {
+				m.reservations[userID]--
+			}
+		})
+	}, true
+}
+
+// IsInstalling 报告服务是否有处于 pending/installing 状态的安装任务
+func (m *InstallationManager) IsInstalling(serviceID int64) bool {
+	m.tasksMutex.RLock()
+	defer m.tasksMutex.RUnlock()
+
+	task, exists := m.tasks[serviceID]
+	return exists && (task.Status == StatusPending || task.Status == StatusInstalling)
+}
+
 // SubmitTask 提交安装任务
 func (m *InstallationManager) SubmitTask(task InstallationTask) {
 	m.tasksMutex.Lock()
@@ -124,8 +223,9 @@ func (m *InstallationManager) runInstallationTask(task *InstallationTask) {
 		log.Printf("[runInstallationTask] Failed to save MCP start log: %v", err)
 	}
 
-	// 创建上下文
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	// 创建上下文；安装函数中的子进程绑定到该上下文，超时后会被杀死
+	timeout := task.effectiveTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	var err error
@@ -134,7 +234,40 @@ func (m *InstallationManager) runInstallationTask(task *InstallationTask) {
 
 	switch task.PackageManager {
 	case "npm":
-		serverInfo, err = InstallNPMPackage(ctx, task.PackageName, task.Version, task.Command, task.Args, "", task.EnvVars)
+		// 开启校验时，先确认 registry 上的 tarball 与元数据中的完整性值一致，再运行包
+		if common.GetNpmVerifyIntegrity() {
+			var integrity *NPMIntegrity
+			integrity, err = verifyNPMIntegrityFunc(ctx, task.PackageName, task.Version)
+			if err != nil {
+				err = fmt.Errorf("integrity verification failed: %w", err)
+				output = fmt.Sprintf("NPM package %s failed integrity verification: %v", task.PackageName, err)
+				break
+			}
+			// 安装固定到校验过的版本，避免 latest 在校验后变化
+			var pinnedArgs []string
+			pinnedArgs, err = PinNPMPackageArgs(task.Args, task.PackageName, integrity.Version)
+			if err != nil {
+				err = fmt.Errorf("integrity verification failed: %w", err)
+				output = fmt.Sprintf("NPM package %s failed integrity verification: %v", task.PackageName, err)
+				break
+			}
+			m.tasksMutex.Lock()
+			task.Integrity = integrity.Integrity
+			task.Version = integrity.Version
+			task.Args = pinnedArgs
+			m.tasksMutex.Unlock()
+			verifiedMsg := fmt.Sprintf("Verified integrity of %s@%s (%s): %s (registry signature verified: %t)", task.PackageName, integrity.Version, integrity.Tarball, integrity.Integrity, integrity.SignatureVerified)
+			if logErr := model.SaveMCPLog(context.Background(), task.ServiceID, task.PackageName, model.MCPLogPhaseInstall, model.MCPLogLevelInfo, verifiedMsg); logErr != nil {
+				log.Printf("[runInstallationTask] Failed to save MCP integrity log: %v", logErr)
+			}
+			if !integrity.SignatureVerified {
+				skippedMsg := fmt.Sprintf("Registry signature of %s@%s was NOT verified (%s); only the integrity value was checked", task.PackageName, integrity.Version, integrity.SignatureSkipped)
+				if logErr := model.SaveMCPLog(context.Background(), task.ServiceID, task.PackageName, model.MCPLogPhaseInstall, model.MCPLogLevelWarn, skippedMsg); logErr != nil {
+					log.Printf("[runInstallationTask] Failed to save MCP integrity log: %v", logErr)
+				}
+			}
+		}
+		serverInfo, err = installNPMPackageFunc(ctx, task.PackageName, task.Version, task.Command, task.Args, "", task.EnvVars)
 		if err == nil && serverInfo != nil {
 			output = fmt.Sprintf("NPM package %s initialized. Server: %s, Version: %s, Protocol: %s", task.PackageName, serverInfo.Name, serverInfo.Version, serverInfo.ProtocolVersion)
 		} else if err == nil {
@@ -143,7 +276,7 @@ func (m *InstallationManager) runInstallationTask(task *InstallationTask) {
 			output = fmt.Sprintf("InstallNPMPackage error: %v", err)
 		}
 	case "pypi", "uv", "pip":
-		serverInfo, err = InstallPyPIPackage(ctx, task.PackageName, task.Version, task.Command, task.Args, "", task.EnvVars)
+		serverInfo, err = installPyPIPackageFunc(ctx, task.PackageName, task.Version, task.Command, task.Args, "", task.EnvVars)
 		if err == nil && serverInfo != nil {
 			output = fmt.Sprintf("PyPI package %s initialized. Server: %s, Version: %s, Protocol: %s", task.PackageName, serverInfo.Name, serverInfo.Version, serverInfo.ProtocolVersion)
 		} else if err == nil {
@@ -156,6 +289,11 @@ func (m *InstallationManager) runInstallationTask(task *InstallationTask) {
 		output = fmt.Sprintf("不支持的包管理器: %s", task.PackageManager)
 	}
 
+	timedOut := err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if timedOut {
+		err = fmt.Errorf("installation timed out after %s: %w", timeout, err)
+	}
+
 	// 更新任务状态
 	m.tasksMutex.Lock()
 	task.EndTime = time.Now()
@@ -163,6 +301,7 @@ func (m *InstallationManager) runInstallationTask(task *InstallationTask) {
 
 	if err != nil {
 		task.Status = StatusFailed
+		task.TimedOut = timedOut
 		task.Error = err.Error()
 		log.Printf("[InstallTask] 任务失败: ServiceID=%d, Package=%s, Error=%v", task.ServiceID, task.PackageName, err)
 
@@ -261,6 +400,18 @@ func (m *InstallationManager) updateServiceStatus(task *InstallationTask, server
 	if task.Version != "" {
 		serviceToUpdate.InstalledVersion = task.Version
 	}
+	if task.Integrity != "" {
+		serviceToUpdate.PackageIntegrity = task.Integrity
+		// 服务之后也运行校验过的版本
+		var args []string
+		if err := json.Unmarshal([]byte(serviceToUpdate.ArgsJSON), &args); err == nil {
+			if pinned, err := PinNPMPackageArgs(args, task.PackageName, task.Version); err == nil {
+				if argsJSON, err := json.Marshal(pinned); err == nil {
+					serviceToUpdate.ArgsJSON = string(argsJSON)
+				}
+			}
+		}
+	}
 
 	if serverInfo != nil {
 		healthDetails := map[string]interface{}{
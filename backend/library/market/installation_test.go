@@ -1,6 +1,18 @@
 package market
 
-import "testing"
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
 
 func TestResolvePyPIInstallTarget(t *testing.T) {
 	tests := []struct {
@@ -50,3 +62,229 @@ func TestResolvePyPIInstallTarget(t *testing.T) {
 		})
 	}
 }
+
+func TestRunInstallationTaskTimeout(t *testing.T) {
+	originalSQLitePath := common.SQLitePath
+	common.SQLitePath = filepath.Join(t.TempDir(), "install_test.db")
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	defer func() { common.SQLitePath = originalSQLitePath }()
+
+	svc := &model.MCPService{
+		Name:           "slow-install",
+		DisplayName:    "Slow Install",
+		Type:           model.ServiceTypeStdio,
+		PackageManager: "npm",
+	}
+	if err := model.CreateService(svc); err != nil {
+		t.Fatalf("CreateService failed: %v", err)
+	}
+
+	// 模拟一个超出超时时间的安装：阻塞直到 ctx 结束，并记录子进程清理
+	var killed atomic.Bool
+	originalInstall := installNPMPackageFunc
+	installNPMPackageFunc = func(ctx context.Context, packageName, version, command string, args []string, workDir string, envVars map[string]string) (*MCPServerInfo, error) {
+		<-ctx.Done()
+		killed.Store(true)
+		return nil, ctx.Err()
+	}
+	defer func() { installNPMPackageFunc = originalInstall }()
+
+	manager := &InstallationManager{tasks: make(map[int64]*InstallationTask)}
+	manager.SubmitTask(InstallationTask{
+		ServiceID:      svc.ID,
+		PackageName:    "slow-pkg",
+		PackageManager: "npm",
+		Command:        "npx",
+		Timeout:        50 * time.Millisecond,
+	})
+	task, ok := manager.GetTaskStatus(svc.ID)
+	if !ok {
+		t.Fatal("expected task to be registered")
+	}
+
+	var result InstallationTask
+	select {
+	case result = <-task.CompletionNotify:
+	case <-time.After(5 * time.Second):
+		t.Fatal("installation did not fail after timeout")
+	}
+
+	if result.Status != StatusFailed {
+		t.Fatalf("expected status %q, got %q", StatusFailed, result.Status)
+	}
+	if !result.TimedOut {
+		t.Fatal("expected task to be marked as timed out")
+	}
+	if !strings.Contains(result.Error, "timed out after 50ms") {
+		t.Fatalf("expected timeout reason in error, got %q", result.Error)
+	}
+	if !killed.Load() {
+		t.Fatal("expected installer to observe cancellation and clean up")
+	}
+	if elapsed := result.Elapsed(); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected elapsed >= timeout, got %s", elapsed)
+	}
+	if _, err := model.GetServiceByID(svc.ID); err == nil {
+		t.Fatal("expected pre-created service to be removed after failed install")
+	}
+}
+
+func TestRunInstallationTaskKillsHangingServer(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+	originalSQLitePath := common.SQLitePath
+	common.SQLitePath = filepath.Join(t.TempDir(), "install_hang_test.db")
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	defer func() { common.SQLitePath = originalSQLitePath }()
+
+	svc := &model.MCPService{
+		Name:           "hanging-install",
+		DisplayName:    "Hanging Install",
+		Type:           model.ServiceTypeStdio,
+		PackageManager: "npm",
+	}
+	if err := model.CreateService(svc); err != nil {
+		t.Fatalf("CreateService failed: %v", err)
+	}
+
+	// 使用真实的安装函数：服务进程永远不回应 initialize，也不理会 stdin 关闭
+	manager := &InstallationManager{tasks: make(map[int64]*InstallationTask)}
+	manager.SubmitTask(InstallationTask{
+		ServiceID:      svc.ID,
+		PackageName:    "hanging-pkg",
+		PackageManager: "npm",
+		Command:        "sleep",
+		Args:           []string{"1000"},
+		Timeout:        200 * time.Millisecond,
+	})
+	task, ok := manager.GetTaskStatus(svc.ID)
+	if !ok {
+		t.Fatal("expected task to be registered")
+	}
+
+	var result InstallationTask
+	select {
+	case result = <-task.CompletionNotify:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the hanging server was not killed after the install timeout")
+	}
+	if result.Status != StatusFailed || !result.TimedOut {
+		t.Fatalf("expected a timed out failure, got status %q (timed out: %t)", result.Status, result.TimedOut)
+	}
+	if manager.UserAtInstallLimit(0, 1) {
+		t.Fatal("expected the install slot to be released after the timeout")
+	}
+}
+
+func TestUserInstallLimit(t *testing.T) {
+	originalSQLitePath := common.SQLitePath
+	common.SQLitePath = filepath.Join(t.TempDir(), "install_limit_test.db")
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	defer func() { common.SQLitePath = originalSQLitePath }()
+
+	// 每个安装阻塞到对应的 release 通道被关闭
+	releases := map[string]chan struct{}{"pkg-a": make(chan struct{}), "pkg-b": make(chan struct{}), "pkg-c": make(chan struct{})}
+	originalInstall := installNPMPackageFunc
+	installNPMPackageFunc = func(ctx context.Context, packageName, version, command string, args []string, workDir string, envVars map[string]string) (*MCPServerInfo, error) {
+		<-releases[packageName]
+		return &MCPServerInfo{Name: packageName}, nil
+	}
+	defer func() { installNPMPackageFunc = originalInstall }()
+
+	manager := &InstallationManager{tasks: make(map[int64]*InstallationTask)}
+	submit := func(serviceID, userID int64, pkg string) {
+		manager.SubmitTask(InstallationTask{ServiceID: serviceID, UserID: userID, PackageName: pkg, PackageManager: "npm", Command: "npx"})
+	}
+	submit(1, 7, "pkg-a")
+	submit(2, 7, "pkg-b")
+	submit(3, 8, "pkg-c")
+
+	tests := []struct {
+		name   string
+		userID int64
+		limit  int
+		want   bool
+	}{
+		{"user at cap is blocked", 7, 2, true},
+		{"higher cap allows more", 7, 3, false},
+		{"other users are not affected", 8, 2, false},
+		{"zero disables the cap", 7, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := manager.UserAtInstallLimit(tt.userID, tt.limit); got != tt.want {
+				t.Fatalf("UserAtInstallLimit(%d, %d) = %v, want %v", tt.userID, tt.limit, got, tt.want)
+			}
+		})
+	}
+
+	// 任务完成后名额被释放
+	task, _ := manager.GetTaskStatus(1)
+	close(releases["pkg-a"])
+	select {
+	case <-task.CompletionNotify:
+	case <-time.After(5 * time.Second):
+		t.Fatal("installation did not complete")
+	}
+	if manager.UserAtInstallLimit(7, 2) {
+		t.Fatal("expected user to be unblocked after a task completed")
+	}
+	if got := manager.ActiveTaskCountForUser(7); got != 1 {
+		t.Fatalf("expected 1 active task, got %d", got)
+	}
+	if manager.IsInstalling(1) || !manager.IsInstalling(2) {
+		t.Fatal("expected only the unfinished task to be reported as installing")
+	}
+	close(releases["pkg-b"])
+	close(releases["pkg-c"])
+}
+
+func TestReserveInstallSlotIsAtomic(t *testing.T) {
+	manager := &InstallationManager{tasks: make(map[int64]*InstallationTask)}
+
+	// 并发预留时只有 limit 个请求能拿到名额
+	const limit = 2
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		releases []func()
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, ok := manager.ReserveInstallSlot(7, limit); ok {
+				mu.Lock()
+				releases = append(releases, release)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(releases) != limit {
+		t.Fatalf("expected %d reservations, got %d", limit, len(releases))
+	}
+	if !manager.UserAtInstallLimit(7, limit) {
+		t.Fatal("expected reservations to count towards the limit")
+	}
+
+	// 归还（重复调用无副作用）后名额可再次使用
+	releases[0]()
+	releases[0]()
+	if _, ok := manager.ReserveInstallSlot(7, limit); !ok {
+		t.Fatal("expected a released slot to be reusable")
+	}
+	if _, ok := manager.ReserveInstallSlot(7, limit); ok {
+		t.Fatal("expected the limit to hold after re-reserving")
+	}
+	if _, ok := manager.ReserveInstallSlot(7, 0); !ok {
+		t.Fatal("expected zero limit to disable the cap")
+	}
+}
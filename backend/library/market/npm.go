@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -19,6 +18,7 @@ import (
 	"one-mcp/backend/model"
 
 	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
@@ -111,7 +111,7 @@ type SearchPackageResult struct {
 	RepositoryURL      string   `json:"repository_url,omitempty"`
 	License            string   `json:"license"`
 	IconURL            string   `json:"icon_url"`
-	Stars              int      `json:"github_stars"`
+	Stars              int      `json:"github_stars,omitempty"` // 搜索结果不含 stars，由 /api/mcp_market/enrich 按需补充
 	Downloads          int      `json:"downloads,omitempty"`    // Monthly downloads, if available
 	LastUpdated        string   `json:"last_updated,omitempty"` // ISO 8601 date string
 	Keywords           []string `json:"keywords,omitempty"`
@@ -129,6 +129,17 @@ func SearchNPMPackages(ctx context.Context, query string, limit int, page int) (
 	if page <= 0 {
 		page = 1
 	}
+	return SearchNPMPackagesAt(ctx, query, limit, (page-1)*limit)
+}
+
+// SearchNPMPackagesAt 从指定偏移量开始搜索npm包，供游标分页使用
+func SearchNPMPackagesAt(ctx context.Context, query string, limit int, offset int) (*NPMSearchResult, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
 
 	// 构建请求URL
 	reqURL, err := url.Parse(NPMAPI)
@@ -140,7 +151,7 @@ func SearchNPMPackages(ctx context.Context, query string, limit int, page int) (
 	q := reqURL.Query()
 	q.Set("text", query)
 	q.Set("size", fmt.Sprintf("%d", limit))
-	q.Set("from", fmt.Sprintf("%d", (page-1)*limit))
+	q.Set("from", fmt.Sprintf("%d", offset))
 	reqURL.RawQuery = q.Encode()
 
 	// 创建带上下文的请求
@@ -153,23 +164,15 @@ func SearchNPMPackages(ctx context.Context, query string, limit int, page int) (
 	req.Header.Set("Accept", "application/json")
 
 	// 发送请求
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	statusCode, data, err := FetchRegistry(ctx, registryHTTPClient(), req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to perform search: %w", err)
 	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
 	// log.Printf("[NPM_SEARCH_API_RESPONSE] Query: %s, Response Body: %s", reqURL.String(), string(data))
 
 	// 检查HTTP状态码
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("npm API returned error: %s, status code: %d", string(data), resp.StatusCode)
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("npm API returned error: %s, status code: %d", string(data), statusCode)
 	}
 
 	// 解析响应
@@ -180,7 +183,7 @@ func SearchNPMPackages(ctx context.Context, query string, limit int, page int) (
 
 	// 添加分页信息
 	result.PerPage = limit
-	result.CurrentPage = page
+	result.CurrentPage = offset/limit + 1
 	result.TotalPages = (result.Total + limit - 1) / limit
 
 	return &result, nil
@@ -201,23 +204,15 @@ func GetNPMPackageDetails(ctx context.Context, packageName string) (*NPMPackageD
 	req.Header.Set("Accept", "application/json")
 
 	// 发送请求
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	statusCode, data, err := FetchRegistry(ctx, registryHTTPClient(), req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get package details: %w", err)
 	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
 	// log.Printf("[NPM_PACKAGE_API_RESPONSE] Package: %s, Response Body: %s", packageName, string(data))
 
 	// 检查HTTP状态码
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("npm API returned error: %s, status code: %d", string(data), resp.StatusCode)
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("npm API returned error: %s, status code: %d", string(data), statusCode)
 	}
 
 	// 解析响应
@@ -308,7 +303,7 @@ func FetchGitHubStars(ctx context.Context, owner, repo string) int {
 	}
 	apiURL := "https://api.github.com/repos/" + owner + "/" + repo
 	// log.Printf("[stars] 请求 GitHub API: %s", apiURL)
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		log.Printf("[stars] 创建请求失败: %v", err)
 		return 0
@@ -320,17 +315,17 @@ func FetchGitHubStars(ctx context.Context, owner, repo string) int {
 	} else {
 		log.Printf("[stars] 未读取到 GITHUB_TOKEN 环境变量")
 	}
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
+	// star 数只是展示用，比 registry 请求更早放弃
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	statusCode, body, err := FetchRegistry(reqCtx, registryHTTPClient(), req)
 	if err != nil {
 		log.Printf("[stars] 请求 GitHub API 失败: %v", err)
 		return 0
 	}
-	defer resp.Body.Close()
-	// log.Printf("[stars] GitHub API 响应状态码: %d", resp.StatusCode)
-	body, _ := io.ReadAll(resp.Body)
+	// log.Printf("[stars] GitHub API 响应状态码: %d", statusCode)
 	// log.Printf("[stars] GitHub API 响应体: %s", string(body))
-	if resp.StatusCode != 200 {
+	if statusCode != 200 {
 		return 0
 	}
 	var data struct {
@@ -347,8 +342,8 @@ func FetchGitHubStars(ctx context.Context, owner, repo string) int {
 	return data.Stars
 }
 
-// ConvertNPMToSearchResult 将npm搜索结果转换为统一格式
-func ConvertNPMToSearchResult(ctx context.Context, npmResult *NPMSearchResult, installedPackageIDs map[string]int64) []SearchPackageResult {
+// ConvertNPMToSearchResult 将npm搜索结果转换为统一格式。为保证搜索响应速度不获取 GitHub stars，见 EnrichNPMPackage
+func ConvertNPMToSearchResult(npmResult *NPMSearchResult, installedPackageIDs map[string]int64) []SearchPackageResult {
 	results := make([]SearchPackageResult, 0, len(npmResult.Objects))
 
 	for _, obj := range npmResult.Objects {
@@ -360,18 +355,6 @@ func ConvertNPMToSearchResult(ctx context.Context, npmResult *NPMSearchResult, i
 			author = npmPkg.Maintainers[0].Username
 		}
 
-		stars := 0
-		repoURL := ""
-		if npmPkg.Links.Repository != "" {
-			repoURL = npmPkg.Links.Repository
-			if strings.Contains(repoURL, "github.com") {
-				owner, repo := ParseGitHubRepo(repoURL)
-				if owner != "" && repo != "" {
-					stars = FetchGitHubStars(ctx, owner, repo)
-				}
-			}
-		}
-
 		isInstalled := false
 		var installedIDPtr *int64
 		if id, ok := installedPackageIDs[npmPkg.Name]; ok {
@@ -387,10 +370,9 @@ func ConvertNPMToSearchResult(ctx context.Context, npmResult *NPMSearchResult, i
 			PackageManager:     "npm",
 			SourceURL:          npmPkg.Links.NPM,
 			Homepage:           npmPkg.Links.Homepage,
-			RepositoryURL:      repoURL,
+			RepositoryURL:      npmPkg.Links.Repository,
 			Keywords:           npmPkg.Keywords,
 			Author:             author,
-			Stars:              stars,
 			Downloads:          obj.Downloads.Weekly,
 			Score:              obj.Score.Final,
 			LastUpdated:        npmPkg.Date.Format(time.RFC3339),
@@ -409,22 +391,24 @@ func InstallNPMPackage(ctx context.Context, packageName, version, command string
 	// but for now, the primary command execution relies on the provided `command` and `args`.
 	// The installation logic via `npx` implicitly handles fetching the package.
 
-	// Prepare effective environment variables
-	env := os.Environ()
+	// Prepare effective environment variables (sanitized host env + service env)
+	serviceEnv := make([]string, 0, len(envVars))
 	for key, value := range envVars {
-		env = append(env, fmt.Sprintf("%s=%s", key, value))
+		serviceEnv = append(serviceEnv, fmt.Sprintf("%s=%s", key, value))
 	}
+	env := common.SubprocessEnv(serviceEnv)
 
 	// Use the provided command and args to create the stdio client
 	// The logic assumes that if `command` is 'npx', the installation will be handled automatically.
-	mcpClient, err := client.NewStdioMCPClient(command, env, args...)
+	mcpClient, err := newInstallStdioClient(ctx, command, env, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MCP client: %w", err)
 	}
 	defer mcpClient.Close()
 
-	// Set context and timeout for MCP initialization
-	initCtx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	// Set context for MCP initialization
+	// The overall deadline comes from the caller (see InstallationTask.Timeout / McpInstallTimeout)
+	initCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// Start the client
@@ -456,6 +440,19 @@ func InstallNPMPackage(ctx context.Context, packageName, version, command string
 	return serverInfo, nil
 }
 
+// newInstallStdioClient starts command for install-time initialization. Like the proxy's buildStdioCmd the process
+// gets exactly env (the sanitized SubprocessEnv), without mcp-go putting os.Environ() in front of it. mcp-go starts
+// the transport with context.Background(), so the process is bound to ctx here: it is killed when the install
+// deadline passes even if it never answers initialize or ignores stdin being closed.
+func newInstallStdioClient(ctx context.Context, command string, env []string, args []string) (*client.Client, error) {
+	return client.NewStdioMCPClientWithOptions(command, env, args, transport.WithCommandFunc(
+		func(_ context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+			cmd := exec.CommandContext(ctx, command, args...)
+			cmd.Env = env
+			return cmd, nil
+		}))
+}
+
 // GuessMCPEnvVarsFromReadme 从README中猜测环境变量
 func GuessMCPEnvVarsFromReadme(readme string) []string {
 	var envVars []string
@@ -549,6 +546,8 @@ type MCPServerConfig struct {
 	Command string            `json:"command"`
 	Args    []string          `json:"args"`
 	Env     map[string]string `json:"env"`
+	URL     string            `json:"url,omitempty"`     // 远程服务（SSE / Streamable HTTP）
+	Headers map[string]string `json:"headers,omitempty"` // 远程服务的自定义请求头
 }
 
 // MCPConfig 表示MCP配置
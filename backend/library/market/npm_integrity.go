@@ -0,0 +1,226 @@
+package market
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrIntegrityMismatch 表示下载的 npm 包与 registry 元数据中的完整性校验值或签名不一致
+var ErrIntegrityMismatch = errors.New("npm package integrity mismatch")
+
+// npmRegistryBaseURL 完整性校验使用的 registry 地址，测试中可替换
+var npmRegistryBaseURL = NPMPackageInfo
+
+// npmTarballMaxSize 校验时允许下载的最大 tarball 大小
+const npmTarballMaxSize = 200 * 1024 * 1024
+
+// NPMIntegrity 是一次成功校验的结果
+type NPMIntegrity struct {
+	Version           string // 实际校验的版本（dist-tag 已解析），安装时必须固定到该版本
+	Tarball           string // 校验过的 tarball 地址
+	Integrity         string // SRI 形式的校验值，如 sha512-...
+	SignatureVerified bool   // registry 提供签名且验证通过
+	SignatureSkipped  string // 未验证签名的原因（registry 未提供签名或公钥），SignatureVerified 为 false 时设置
+}
+
+type npmVersionDocument struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Dist    struct {
+		Integrity  string `json:"integrity"`
+		Shasum     string `json:"shasum"`
+		Tarball    string `json:"tarball"`
+		Signatures []struct {
+			KeyID string `json:"keyid"`
+			Sig   string `json:"sig"`
+		} `json:"signatures"`
+	} `json:"dist"`
+}
+
+type npmRegistryKeys struct {
+	Keys []struct {
+		KeyID string `json:"keyid"`
+		Key   string `json:"key"`
+	} `json:"keys"`
+}
+
+// VerifyNPMPackageIntegrity 下载 registry 元数据中声明的 tarball 并校验其完整性；
+// 若 registry 为该版本提供了签名，同时使用 registry 公钥验证签名。version 为空时校验 latest。
+func VerifyNPMPackageIntegrity(ctx context.Context, packageName, version string) (*NPMIntegrity, error) {
+	if version == "" {
+		version = "latest"
+	}
+	client := &http.Client{Timeout: 60 * time.Second}
+
+	var doc npmVersionDocument
+	if err := fetchRegistryJSON(ctx, client, fmt.Sprintf("%s%s/%s", npmRegistryBaseURL, packageName, url.PathEscape(version)), &doc); err != nil {
+		return nil, fmt.Errorf("failed to fetch metadata for %s@%s: %w", packageName, version, err)
+	}
+	if doc.Dist.Tarball == "" {
+		return nil, fmt.Errorf("registry metadata for %s@%s has no tarball", packageName, version)
+	}
+
+	expected := doc.Dist.Integrity
+	if expected == "" && doc.Dist.Shasum != "" {
+		// 旧包只有 sha1 shasum，转成 SRI 形式统一比较
+		sum, err := hex.DecodeString(doc.Dist.Shasum)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shasum for %s@%s: %w", packageName, doc.Version, err)
+		}
+		expected = "sha1-" + base64.StdEncoding.EncodeToString(sum)
+	}
+	if expected == "" {
+		return nil, fmt.Errorf("registry metadata for %s@%s has no integrity value", packageName, doc.Version)
+	}
+
+	actual, err := tarballIntegrity(ctx, client, doc.Dist.Tarball, expected)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash tarball of %s@%s: %w", packageName, doc.Version, err)
+	}
+	if actual != expected {
+		return nil, fmt.Errorf("%w: %s@%s expected %s, got %s", ErrIntegrityMismatch, packageName, doc.Version, expected, actual)
+	}
+
+	result := &NPMIntegrity{Version: doc.Version, Tarball: doc.Dist.Tarball, Integrity: expected}
+	if len(doc.Dist.Signatures) == 0 || doc.Dist.Integrity == "" {
+		result.SignatureSkipped = "registry metadata has no signatures"
+		log.Printf("[npm-integrity] WARNING: %s@%s is not signed by the registry, only its integrity value was verified", packageName, doc.Version)
+		return result, nil
+	}
+
+	var keys npmRegistryKeys
+	if err := fetchRegistryJSON(ctx, client, npmRegistryBaseURL+"-/npm/v1/keys", &keys); err != nil {
+		// 镜像源通常不提供公钥，此时仅依赖完整性校验
+		result.SignatureSkipped = fmt.Sprintf("registry keys unavailable: %v", err)
+		log.Printf("[npm-integrity] WARNING: registry keys unavailable, skipping signature check for %s@%s: %v", packageName, doc.Version, err)
+		return result, nil
+	}
+	message := fmt.Sprintf("%s@%s:%s", doc.Name, doc.Version, doc.Dist.Integrity)
+	for _, signature := range doc.Dist.Signatures {
+		if err := verifyNPMSignature(keys, signature.KeyID, signature.Sig, message); err != nil {
+			return nil, fmt.Errorf("%w: %s@%s signature %s: %v", ErrIntegrityMismatch, packageName, doc.Version, signature.KeyID, err)
+		}
+	}
+	result.SignatureVerified = true
+	return result, nil
+}
+
+func fetchRegistryJSON(ctx context.Context, client *http.Client, reqURL string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	statusCode, data, err := FetchRegistry(ctx, client, req)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("registry returned status code %d", statusCode)
+	}
+	return json.Unmarshal(data, target)
+}
+
+// tarballIntegrity 下载 tarball 并按 expected 所用的算法计算 SRI 校验值
+func tarballIntegrity(ctx context.Context, client *http.Client, tarballURL, expected string) (string, error) {
+	algorithm, _, _ := strings.Cut(expected, "-")
+	var h hash.Hash
+	switch algorithm {
+	case "sha512":
+		h = sha512.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha256":
+		h = sha256.New()
+	case "sha1":
+		h = sha1.New()
+	default:
+		return "", fmt.Errorf("unsupported integrity algorithm %q", algorithm)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tarballURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("tarball download returned status code %d", resp.StatusCode)
+	}
+	n, err := io.Copy(h, io.LimitReader(resp.Body, npmTarballMaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if n > npmTarballMaxSize {
+		return "", fmt.Errorf("tarball exceeds %d bytes", npmTarballMaxSize)
+	}
+	return algorithm + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyNPMSignature 使用 registry 公钥（base64 SPKI 形式的 ECDSA P-256）验证签名
+func verifyNPMSignature(keys npmRegistryKeys, keyID, sig, message string) error {
+	for _, key := range keys.Keys {
+		if key.KeyID != keyID {
+			continue
+		}
+		der, err := base64.StdEncoding.DecodeString(key.Key)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+		parsed, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+		publicKey, ok := parsed.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("public key is not ECDSA")
+		}
+		signature, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			return fmt.Errorf("invalid signature encoding: %w", err)
+		}
+		digest := sha256.Sum256([]byte(message))
+		if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+			return errors.New("signature does not match")
+		}
+		return nil
+	}
+	return errors.New("no registry key matches the signature")
+}
+
+// PinNPMPackageArgs 将 args 中引用 packageName 的参数（不带版本或带任意版本/dist-tag）替换为 packageName@version，
+// 使 npx 运行的正是校验过的版本。args 中没有引用该包时返回错误
+func PinNPMPackageArgs(args []string, packageName, version string) ([]string, error) {
+	pinned := make([]string, len(args))
+	found := false
+	for i, arg := range args {
+		pinned[i] = arg
+		if arg == packageName || strings.HasPrefix(arg, packageName+"@") {
+			pinned[i] = packageName + "@" + version
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("cannot pin %s@%s: the command arguments do not reference the package", packageName, version)
+	}
+	return pinned, nil
+}
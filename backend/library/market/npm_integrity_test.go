@@ -0,0 +1,211 @@
+package market
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockNPMRegistry 提供 pkg@1.0.0 的版本元数据、tarball 与 registry 公钥
+type mockNPMRegistry struct {
+	tarball    []byte
+	integrity  string
+	signWith   *ecdsa.PrivateKey // 为 nil 时元数据不带签名
+	registered *ecdsa.PrivateKey // keys 接口返回的公钥
+}
+
+func (m *mockNPMRegistry) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pkg/1.0.0", "/pkg/latest":
+			dist := map[string]any{"integrity": m.integrity, "tarball": server.URL + "/pkg/-/pkg-1.0.0.tgz"}
+			if m.signWith != nil {
+				digest := sha256.Sum256([]byte("pkg@1.0.0:" + m.integrity))
+				sig, err := ecdsa.SignASN1(rand.Reader, m.signWith, digest[:])
+				assert.NoError(t, err)
+				dist["signatures"] = []map[string]string{{"keyid": "SHA256:test", "sig": base64.StdEncoding.EncodeToString(sig)}}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "pkg", "version": "1.0.0", "dist": dist})
+		case "/pkg/-/pkg-1.0.0.tgz":
+			_, _ = w.Write(m.tarball)
+		case "/-/npm/v1/keys":
+			der, err := x509.MarshalPKIXPublicKey(&m.registered.PublicKey)
+			assert.NoError(t, err)
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{"keyid": "SHA256:test", "key": base64.StdEncoding.EncodeToString(der)}}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	original := npmRegistryBaseURL
+	npmRegistryBaseURL = server.URL + "/"
+	t.Cleanup(func() {
+		npmRegistryBaseURL = original
+		server.Close()
+	})
+	return server
+}
+
+func sriSHA512(data []byte) string {
+	sum := sha512.Sum512(data)
+	return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyNPMPackageIntegrity(t *testing.T) {
+	tarball := []byte("package contents")
+	registryKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		registry     mockNPMRegistry
+		version      string
+		wantMismatch bool
+		wantSigned   bool
+	}{
+		{"matching integrity", mockNPMRegistry{tarball: tarball, integrity: sriSHA512(tarball), registered: registryKey}, "1.0.0", false, false},
+		{"empty version resolves latest", mockNPMRegistry{tarball: tarball, integrity: sriSHA512(tarball), registered: registryKey}, "", false, false},
+		{"mismatching integrity", mockNPMRegistry{tarball: tarball, integrity: sriSHA512([]byte("tampered")), registered: registryKey}, "1.0.0", true, false},
+		{"valid registry signature", mockNPMRegistry{tarball: tarball, integrity: sriSHA512(tarball), signWith: registryKey, registered: registryKey}, "1.0.0", false, true},
+		{"signature from unknown key", mockNPMRegistry{tarball: tarball, integrity: sriSHA512(tarball), signWith: otherKey, registered: registryKey}, "1.0.0", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFastRegistryRetry(t)
+			tt.registry.start(t)
+
+			result, err := VerifyNPMPackageIntegrity(context.Background(), "pkg", tt.version)
+			if tt.wantMismatch {
+				assert.True(t, errors.Is(err, ErrIntegrityMismatch), "expected mismatch, got %v", err)
+				assert.Nil(t, result)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, "1.0.0", result.Version)
+				assert.Equal(t, sriSHA512(tarball), result.Integrity)
+				assert.Equal(t, tt.wantSigned, result.SignatureVerified)
+				assert.Equal(t, tt.wantSigned, result.SignatureSkipped == "", "an unverified signature has a reason")
+				assert.NotEmpty(t, result.Tarball)
+			}
+		})
+	}
+}
+
+func TestRunInstallationTaskVerifiesIntegrity(t *testing.T) {
+	originalSQLitePath := common.SQLitePath
+	common.SQLitePath = filepath.Join(t.TempDir(), "install_integrity_test.db")
+	assert.NoError(t, model.InitDB())
+	defer func() { common.SQLitePath = originalSQLitePath }()
+
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap[common.OptionNpmVerifyIntegrity] = "true"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		delete(common.OptionMap, common.OptionNpmVerifyIntegrity)
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	installed := false
+	var installedVersion string
+	var installedArgs []string
+	originalInstall := installNPMPackageFunc
+	installNPMPackageFunc = func(ctx context.Context, packageName, version, command string, args []string, workDir string, envVars map[string]string) (*MCPServerInfo, error) {
+		installed = true
+		installedVersion, installedArgs = version, args
+		return &MCPServerInfo{Name: packageName}, nil
+	}
+	defer func() { installNPMPackageFunc = originalInstall }()
+
+	tarball := []byte("package contents")
+	tests := []struct {
+		name      string
+		integrity string
+		wantOK    bool
+	}{
+		{"mismatch fails before running the package", sriSHA512([]byte("tampered")), false},
+		{"match installs and records the hash", sriSHA512(tarball), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFastRegistryRetry(t)
+			installed = false
+			registry := mockNPMRegistry{tarball: tarball, integrity: tt.integrity}
+			registry.start(t)
+
+			svc := &model.MCPService{Name: "pkg-" + tt.name[:5], DisplayName: "pkg", Type: model.ServiceTypeStdio, Command: "npx", ArgsJSON: `["-y","pkg"]`, PackageManager: "npm", Enabled: true}
+			assert.NoError(t, model.CreateService(svc))
+
+			manager := &InstallationManager{tasks: make(map[int64]*InstallationTask)}
+			// No version: latest is verified, and the install is pinned to what it resolved to
+			manager.SubmitTask(InstallationTask{ServiceID: svc.ID, PackageName: "pkg", PackageManager: "npm", Command: "npx", Args: []string{"-y", "pkg"}})
+			task, _ := manager.GetTaskStatus(svc.ID)
+
+			var result InstallationTask
+			select {
+			case result = <-task.CompletionNotify:
+			case <-time.After(5 * time.Second):
+				t.Fatal("installation did not finish")
+			}
+
+			assert.Equal(t, tt.wantOK, installed)
+			if !tt.wantOK {
+				assert.Equal(t, StatusFailed, result.Status)
+				assert.Contains(t, result.Error, "integrity")
+				return
+			}
+			assert.Equal(t, StatusCompleted, result.Status)
+			assert.Equal(t, "1.0.0", installedVersion)
+			assert.Equal(t, []string{"-y", "pkg@1.0.0"}, installedArgs)
+			assert.Eventually(t, func() bool {
+				updated, err := model.GetServiceByID(svc.ID)
+				return err == nil && updated.PackageIntegrity == tt.integrity && updated.ArgsJSON == `["-y","pkg@1.0.0"]` && updated.InstalledVersion == "1.0.0"
+			}, 2*time.Second, 20*time.Millisecond)
+		})
+	}
+}
+
+func TestPinNPMPackageArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"unversioned", []string{"-y", "@scope/pkg"}, []string{"-y", "@scope/pkg@1.2.3"}, false},
+		{"dist-tag", []string{"-y", "@scope/pkg@latest", "--flag"}, []string{"-y", "@scope/pkg@1.2.3", "--flag"}, false},
+		{"other package only", []string{"-y", "@scope/pkg-extra"}, nil, true},
+		{"no args", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PinNPMPackageArgs(tt.args, "@scope/pkg", "1.2.3")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
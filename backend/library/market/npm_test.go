@@ -3,6 +3,7 @@ package market
 import (
 	"context"
 	"os"
+	"os/exec"
 	"strings"
 	"testing"
 	"time"
@@ -235,6 +236,33 @@ func TestInstallNPMPackage(t *testing.T) {
 	t.Logf("Protocol Version: %s", serverInfo.ProtocolVersion)
 }
 
+// fakeMCPServerScript 是一个最小的 stdio MCP 服务：回应 initialize，并把 serverInfo 的 name/version
+// 设为它看到的 ONE_MCP_HOST_ONLY_SECRET 与 SERVICE_VAR，用于检查子进程的环境变量
+const fakeMCPServerScript = `read line
+id=$(printf '%s' "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+printf '{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2024-11-05","capabilities":{},"serverInfo":{"name":"%s","version":"%s"}}}\n' "$id" "${ONE_MCP_HOST_ONLY_SECRET:-absent}" "${SERVICE_VAR:-absent}"
+cat >/dev/null`
+
+func TestInstallNPMPackageDoesNotLeakHostEnv(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	t.Setenv("ONE_MCP_HOST_ONLY_SECRET", "leaked")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	serverInfo, err := InstallNPMPackage(ctx, "fake-env-pkg", "", "sh", []string{"-c", fakeMCPServerScript}, "", map[string]string{"SERVICE_VAR": "svc"})
+	if err != nil {
+		t.Fatalf("InstallNPMPackage failed: %v", err)
+	}
+	if serverInfo.Name != "absent" {
+		t.Fatalf("expected the host-only variable to be hidden from the package process, got %q", serverInfo.Name)
+	}
+	if serverInfo.Version != "svc" {
+		t.Fatalf("expected the service env to reach the package process, got %q", serverInfo.Version)
+	}
+}
+
 func TestCheckNPXAvailable(t *testing.T) {
 	// 跳过实际执行，仅在明确指定TEST_NPX_CHECK环境变量时运行
 	if os.Getenv("TEST_NPX_CHECK") != "true" {
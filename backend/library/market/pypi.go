@@ -9,11 +9,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
+	"one-mcp/backend/common"
 	"one-mcp/backend/model"
 
-	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	// Assuming MCPServerInfo is in the same package, or import if it's moved to a common place.
 	// For now, let's assume it's accessible as it's in the same package 'market'
@@ -56,6 +55,26 @@ func resolvePyPIInstallTarget(packageName, version string, args []string) string
 	return packageName
 }
 
+// uvxOptionValue returns the value of the first of names found in the uvx options before the tool name,
+// written either as "--opt value" or "--opt=value".
+func uvxOptionValue(args []string, names ...string) string {
+	packageArgs, _, ok := model.SplitPackageArgs("uvx", args)
+	if !ok {
+		packageArgs = args
+	}
+	for i, arg := range packageArgs {
+		for _, name := range names {
+			if arg == name && i+1 < len(packageArgs) {
+				return packageArgs[i+1]
+			}
+			if value, found := strings.CutPrefix(arg, name+"="); found {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
 // InstallPyPIPackage installs a Python package using uv, creates a virtual environment,
 // and then attempts to initialize it as an MCP server.
 // workDir is currently unused, venvsBaseDir is used instead.
@@ -71,8 +90,17 @@ func InstallPyPIPackage(ctx context.Context, packageName, version, command strin
 
 	pkgVenvDir := filepath.Join(pythonVenvsBaseDir, packageName, "venv")
 
+	// The uvx --python / --index-url options of the service also apply to the install environment
+	pythonVersion, indexURL := uvxOptionValue(args, "--python", "-p"), uvxOptionValue(args, "--index-url", "-i")
+
 	// Create virtual environment using uv
-	venvCmd := exec.CommandContext(ctx, "uv", "venv", pkgVenvDir)
+	venvArgs := []string{"venv", pkgVenvDir}
+	if pythonVersion != "" {
+		venvArgs = append(venvArgs, "--python", pythonVersion)
+	}
+	// uv runs with the sanitized host env as well, so host secrets do not reach package build scripts
+	venvCmd := exec.CommandContext(ctx, "uv", venvArgs...)
+	venvCmd.Env = common.SubprocessEnv(nil)
 	var stderrVenv bytes.Buffer
 	venvCmd.Stderr = &stderrVenv
 	if err := venvCmd.Run(); err != nil {
@@ -83,7 +111,12 @@ func InstallPyPIPackage(ctx context.Context, packageName, version, command strin
 	packageToInstall := resolvePyPIInstallTarget(packageName, version, args)
 
 	pythonExecutable := filepath.Join(pkgVenvDir, "bin", "python")
-	pipInstallCmd := exec.CommandContext(ctx, "uv", "pip", "install", packageToInstall, "--python", pythonExecutable)
+	pipArgs := []string{"pip", "install", packageToInstall, "--python", pythonExecutable}
+	if indexURL != "" {
+		pipArgs = append(pipArgs, "--index-url", indexURL)
+	}
+	pipInstallCmd := exec.CommandContext(ctx, "uv", pipArgs...)
+	pipInstallCmd.Env = common.SubprocessEnv(nil)
 	var stdoutPip, stderrPip bytes.Buffer
 	pipInstallCmd.Stdout = &stdoutPip
 	pipInstallCmd.Stderr = &stderrPip
@@ -113,21 +146,22 @@ func InstallPyPIPackage(ctx context.Context, packageName, version, command strin
 	}
 
 	// Prepare environment variables for the MCP client
-	effectiveEnv := os.Environ() // Get current environment
+	serviceEnv := make([]string, 0, len(envVars))
 	for key, value := range envVars {
-		effectiveEnv = append(effectiveEnv, fmt.Sprintf("%s=%s", key, value))
+		serviceEnv = append(serviceEnv, fmt.Sprintf("%s=%s", key, value))
 	}
+	effectiveEnv := common.SubprocessEnv(serviceEnv) // Sanitized host env + service env
 
 	// Use mark3labs/mcp-go to create stdio client with proper command and args
-	mcpClient, err := client.NewStdioMCPClient(mcpCommandPath, effectiveEnv, args...)
+	mcpClient, err := newInstallStdioClient(ctx, mcpCommandPath, effectiveEnv, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MCP client for %s: %w", packageName, err)
 	}
 	defer mcpClient.Close()
 
-	// Set context and timeout for MCP initialization
-	// Using a shorter timeout for initialization as in npm.go
-	initCtx, cancel := context.WithTimeout(ctx, 3*time.Minute) // Original was 3*time.Minute in npm.go
+	// Set context for MCP initialization
+	// The overall deadline comes from the caller (see InstallationTask.Timeout / McpInstallTimeout)
+	initCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// Start client (mcp-go Start might be called internally by Initialize or might need explicit call)
@@ -0,0 +1,168 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// pypiJSONAPIBaseURL PyPI 单个项目的 JSON API，测试中可替换
+var pypiJSONAPIBaseURL = "https://pypi.org/pypi/"
+
+// pypiProjectResponse 是 PyPI JSON API 返回中搜索结果用到的字段
+type pypiProjectResponse struct {
+	Info struct {
+		Name        string            `json:"name"`
+		Version     string            `json:"version"`
+		Summary     string            `json:"summary"`
+		HomePage    string            `json:"home_page"`
+		PackageURL  string            `json:"package_url"`
+		ProjectURLs map[string]string `json:"project_urls"`
+		License     string            `json:"license"`
+		Keywords    string            `json:"keywords"`
+		Author      string            `json:"author"`
+	} `json:"info"`
+	URLs []struct {
+		UploadTime string `json:"upload_time_iso_8601"`
+	} `json:"urls"`
+}
+
+// pypiSearchCandidate 是由搜索词推导出的 PyPI 项目名及其相关度
+type pypiSearchCandidate struct {
+	Name  string
+	Score float64
+}
+
+// pypiSearchCandidates 由搜索词推导出可能的 MCP 项目名。PyPI 没有可用的全文搜索 API，
+// 因此按 MCP 服务常见的命名方式（mcp-server-x、x-mcp 等）逐个查询；符合 MCP 命名的候选相关度更高。
+// 搜索词中的 "mcp" 会被忽略，其余词以 "-" 连接
+func pypiSearchCandidates(query string) []pypiSearchCandidate {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if word != "mcp" {
+			words = append(words, word)
+		}
+	}
+	term := strings.Join(words, "-")
+	if term == "" {
+		return nil
+	}
+	names := []pypiSearchCandidate{
+		{"mcp-server-" + term, 1},
+		{term + "-mcp", 0.95},
+		{term + "-mcp-server", 0.9},
+		{"mcp-" + term, 0.85},
+	}
+	if strings.Contains(term, "mcp") {
+		names = append(names, pypiSearchCandidate{term, 0.95})
+	} else {
+		names = append(names, pypiSearchCandidate{term, 0.5})
+	}
+	return names
+}
+
+// SearchPyPIPackagesAt 按 pypiSearchCandidates 查询 PyPI，返回从 offset 开始的至多 limit 个存在的项目，
+// 以及存在的项目总数。不存在的候选（404）被跳过；其他查询失败时返回错误
+func SearchPyPIPackagesAt(ctx context.Context, query string, limit int, offset int, installedPackageIDs map[string]int64) ([]SearchPackageResult, int, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	candidates := pypiSearchCandidates(query)
+	found := make([]*SearchPackageResult, len(candidates))
+	errs := make([]error, len(candidates))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found[i], errs[i] = getPyPISearchResult(ctx, candidate)
+		}()
+	}
+	wg.Wait()
+
+	results := []SearchPackageResult{}
+	names := make(map[string]bool, len(candidates))
+	for i, result := range found {
+		if errs[i] != nil {
+			return nil, 0, errs[i]
+		}
+		// PyPI 对项目名做规范化，不同候选可能指向同一个项目
+		if result == nil || names[result.Name] {
+			continue
+		}
+		names[result.Name] = true
+		if id, ok := installedPackageIDs[result.Name]; ok {
+			installedID := id
+			result.IsInstalled = true
+			result.InstalledServiceID = &installedID
+		}
+		results = append(results, *result)
+	}
+	total := len(results)
+	if offset >= total {
+		return []SearchPackageResult{}, total, nil
+	}
+	return results[offset:min(offset+limit, total)], total, nil
+}
+
+// getPyPISearchResult 查询单个 PyPI 项目；项目不存在时返回 nil
+func getPyPISearchResult(ctx context.Context, candidate pypiSearchCandidate) (*SearchPackageResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pypiJSONAPIBaseURL+url.PathEscape(candidate.Name)+"/json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	statusCode, data, err := FetchRegistry(ctx, registryHTTPClient(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up PyPI project %s: %w", candidate.Name, err)
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("PyPI API returned status code %d for %s", statusCode, candidate.Name)
+	}
+
+	var project pypiProjectResponse
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse PyPI response for %s: %w", candidate.Name, err)
+	}
+	info := project.Info
+	result := &SearchPackageResult{
+		Name:           info.Name,
+		Version:        info.Version,
+		Description:    info.Summary,
+		PackageManager: "pypi",
+		SourceURL:      info.PackageURL,
+		Homepage:       info.HomePage,
+		License:        info.License,
+		Author:         info.Author,
+		Score:          candidate.Score,
+	}
+	if result.Name == "" {
+		result.Name = candidate.Name
+	}
+	for label, link := range info.ProjectURLs {
+		switch strings.ToLower(label) {
+		case "homepage":
+			if result.Homepage == "" {
+				result.Homepage = link
+			}
+		case "repository", "source", "source code":
+			result.RepositoryURL = link
+		}
+	}
+	result.Keywords = strings.FieldsFunc(info.Keywords, func(r rune) bool { return r == ',' || r == ' ' })
+	if n := len(project.URLs); n > 0 {
+		result.LastUpdated = project.URLs[n-1].UploadTime
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package market
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchPyPIPackagesAt(t *testing.T) {
+	withFastRegistryRetry(t)
+
+	projects := map[string]string{
+		"mcp-server-fetch": `{"info":{"name":"mcp-server-fetch","version":"1.2.0","summary":"Fetch MCP server","package_url":"https://pypi.org/project/mcp-server-fetch/","project_urls":{"Repository":"https://github.com/example/fetch"},"keywords":"mcp, fetch"},"urls":[{"upload_time_iso_8601":"2025-01-02T03:04:05Z"}]}`,
+		// PyPI 会把规范化后相同的项目名指向同一项目
+		"mcp-fetch": `{"info":{"name":"mcp-server-fetch","version":"1.2.0"}}`,
+		"fetch":     `{"info":{"name":"fetch","version":"0.1.0","summary":"Unrelated"}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/pypi/"), "/json")
+		body, ok := projects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	original := pypiJSONAPIBaseURL
+	pypiJSONAPIBaseURL = server.URL + "/pypi/"
+	defer func() { pypiJSONAPIBaseURL = original }()
+
+	results, total, err := SearchPyPIPackagesAt(context.Background(), "fetch mcp", 20, 0, map[string]int64{"fetch": 7})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "mcp-server-fetch", results[0].Name)
+		assert.Equal(t, "pypi", results[0].PackageManager)
+		assert.Equal(t, "Fetch MCP server", results[0].Description)
+		assert.Equal(t, "https://github.com/example/fetch", results[0].RepositoryURL)
+		assert.Equal(t, []string{"mcp", "fetch"}, results[0].Keywords)
+		assert.Equal(t, "2025-01-02T03:04:05Z", results[0].LastUpdated)
+		assert.False(t, results[0].IsInstalled)
+		// 不符合 MCP 命名的同名项目相关度较低
+		assert.Equal(t, "fetch", results[1].Name)
+		assert.Less(t, results[1].Score, results[0].Score)
+		assert.True(t, results[1].IsInstalled)
+		assert.Equal(t, int64(7), *results[1].InstalledServiceID)
+	}
+
+	results, total, err = SearchPyPIPackagesAt(context.Background(), "fetch mcp", 1, 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "fetch", results[0].Name)
+	}
+
+	results, total, err = SearchPyPIPackagesAt(context.Background(), "mcp", 20, 0, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, results)
+}
@@ -0,0 +1,206 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+)
+
+// ErrRegistryUnavailable 表示上游仓库（npm / PyPI / GitHub）暂时不可用，且没有可用的缓存数据
+var ErrRegistryUnavailable = errors.New("registry unavailable")
+
+// 重试与熔断参数；测试中可调整
+var (
+	registryMaxAttempts      = 3
+	registryRetryBaseDelay   = 200 * time.Millisecond
+	registryBreakerThreshold = 5
+	registryBreakerCooldown  = 30 * time.Second
+	registryStaleTTL         = time.Hour
+	registryStaleMaxEntries  = 512
+)
+
+// registryBreaker 按 host 记录连续失败次数，超过阈值后在冷却期内直接失败
+type registryBreaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+type registryStaleEntry struct {
+	body     []byte
+	storedAt time.Time
+}
+
+var (
+	registryBreakersMu sync.Mutex
+	registryBreakers   = make(map[string]*registryBreaker)
+
+	registryStaleMu    sync.RWMutex
+	registryStaleCache = make(map[string]registryStaleEntry)
+)
+
+// registryClientTimeout 共享客户端单次请求的超时
+const registryClientTimeout = 10 * time.Second
+
+var (
+	registryClientMu     sync.Mutex
+	registryClient       *http.Client
+	registryClientLimits [3]int
+)
+
+// registryHTTPClient 返回 npm registry 与 GitHub API 请求共用的 HTTP 客户端，复用 keep-alive 连接。
+// 连接上限取自系统选项，选项变化后重建 Transport 并关闭旧 Transport 的空闲连接。
+func registryHTTPClient() *http.Client {
+	maxIdle, maxIdlePerHost, maxPerHost := common.GetRegistryConnLimits()
+	limits := [3]int{maxIdle, maxIdlePerHost, maxPerHost}
+
+	registryClientMu.Lock()
+	defer registryClientMu.Unlock()
+	if registryClient != nil && registryClientLimits == limits {
+		return registryClient
+	}
+	if registryClient != nil {
+		registryClient.CloseIdleConnections()
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdle
+	transport.MaxIdleConnsPerHost = maxIdlePerHost
+	transport.MaxConnsPerHost = maxPerHost
+	registryClient = &http.Client{Transport: transport, Timeout: registryClientTimeout}
+	registryClientLimits = limits
+	return registryClient
+}
+
+func registryBreakerAllow(host string) bool {
+	registryBreakersMu.Lock()
+	defer registryBreakersMu.Unlock()
+	b, ok := registryBreakers[host]
+	if !ok {
+		return true
+	}
+	return !time.Now().Before(b.openUntil)
+}
+
+func registryBreakerRecord(host string, success bool) {
+	registryBreakersMu.Lock()
+	defer registryBreakersMu.Unlock()
+	if success {
+		delete(registryBreakers, host)
+		return
+	}
+	b, ok := registryBreakers[host]
+	if !ok {
+		b = &registryBreaker{}
+		registryBreakers[host] = b
+	}
+	b.failures++
+	if b.failures >= registryBreakerThreshold {
+		b.openUntil = time.Now().Add(registryBreakerCooldown)
+		log.Printf("[registry] circuit open for %s after %d consecutive failures", host, b.failures)
+	}
+}
+
+func resetRegistryState() {
+	registryBreakersMu.Lock()
+	registryBreakers = make(map[string]*registryBreaker)
+	registryBreakersMu.Unlock()
+	registryStaleMu.Lock()
+	registryStaleCache = make(map[string]registryStaleEntry)
+	registryStaleMu.Unlock()
+}
+
+func storeRegistryStale(key string, body []byte) {
+	registryStaleMu.Lock()
+	defer registryStaleMu.Unlock()
+	if _, exists := registryStaleCache[key]; !exists && len(registryStaleCache) >= registryStaleMaxEntries {
+		for k := range registryStaleCache {
+			delete(registryStaleCache, k)
+			break
+		}
+	}
+	registryStaleCache[key] = registryStaleEntry{body: body, storedAt: time.Now()}
+}
+
+func loadRegistryStale(key string) ([]byte, bool) {
+	registryStaleMu.RLock()
+	defer registryStaleMu.RUnlock()
+	entry, ok := registryStaleCache[key]
+	if !ok || time.Since(entry.storedAt) > registryStaleTTL {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+func isRetryableRegistryStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// FetchRegistry 发送一个无请求体的 GET 请求到外部仓库 API，对网络错误、429 和 5xx 做指数退避重试，
+// 并按 host 熔断。成功的 200 响应会被缓存；重试耗尽或熔断打开时，若有缓存则返回缓存数据，
+// 否则返回包装了 ErrRegistryUnavailable 的错误。非重试类状态码（如 404）原样返回给调用方处理。
+func FetchRegistry(ctx context.Context, client *http.Client, req *http.Request) (int, []byte, error) {
+	host := req.URL.Host
+	cacheKey := req.URL.String()
+
+	if !registryBreakerAllow(host) {
+		if body, ok := loadRegistryStale(cacheKey); ok {
+			log.Printf("[registry] circuit open for %s, serving cached response for %s", host, cacheKey)
+			return http.StatusOK, body, nil
+		}
+		return 0, nil, fmt.Errorf("%w: %s (circuit open)", ErrRegistryUnavailable, host)
+	}
+
+	var lastErr error
+	delay := registryRetryBaseDelay
+attempts:
+	for attempt := 1; attempt <= registryMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				lastErr = ctx.Err()
+				break attempts
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		resp, err := client.Do(req.Clone(ctx))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			lastErr = fmt.Errorf("failed to read response: %w", readErr)
+			continue
+		}
+		if isRetryableRegistryStatus(resp.StatusCode) {
+			lastErr = fmt.Errorf("status code %d", resp.StatusCode)
+			continue
+		}
+
+		registryBreakerRecord(host, true)
+		if resp.StatusCode == http.StatusOK {
+			storeRegistryStale(cacheKey, body)
+		}
+		return resp.StatusCode, body, nil
+	}
+
+	// 调用方取消或超时并不说明仓库故障，不计入熔断失败次数
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return 0, nil, fmt.Errorf("registry request to %s aborted: %w", host, ctxErr)
+	}
+	registryBreakerRecord(host, false)
+	if body, ok := loadRegistryStale(cacheKey); ok {
+		log.Printf("[registry] %s failed (%v), serving cached response", cacheKey, lastErr)
+		return http.StatusOK, body, nil
+	}
+	return 0, nil, fmt.Errorf("%w: %s: %v", ErrRegistryUnavailable, host, lastErr)
+}
@@ -0,0 +1,264 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withFastRegistryRetry(t *testing.T) {
+	t.Helper()
+	origDelay, origThreshold := registryRetryBaseDelay, registryBreakerThreshold
+	registryRetryBaseDelay = time.Millisecond
+	resetRegistryState()
+	t.Cleanup(func() {
+		registryRetryBaseDelay, registryBreakerThreshold = origDelay, origThreshold
+		resetRegistryState()
+	})
+}
+
+func newRegistryRequest(t *testing.T, url string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	return req
+}
+
+func TestFetchRegistry_RetryRecoversAfterTransientFailures(t *testing.T) {
+	withFastRegistryRetry(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	status, body, err := FetchRegistry(context.Background(), server.Client(), newRegistryRequest(t, server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"ok":true}`, string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestFetchRegistry_NonRetryableStatusReturnedAsIs(t *testing.T) {
+	withFastRegistryRetry(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	status, _, err := FetchRegistry(context.Background(), server.Client(), newRegistryRequest(t, server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFetchRegistry_ServesCachedDataWhenRegistryDown(t *testing.T) {
+	withFastRegistryRetry(t)
+
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`cached`))
+	}))
+	defer server.Close()
+
+	_, _, err := FetchRegistry(context.Background(), server.Client(), newRegistryRequest(t, server.URL))
+	assert.NoError(t, err)
+
+	failing.Store(true)
+	status, body, err := FetchRegistry(context.Background(), server.Client(), newRegistryRequest(t, server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "cached", string(body))
+}
+
+func TestFetchRegistry_CircuitOpensAfterRepeatedFailures(t *testing.T) {
+	withFastRegistryRetry(t)
+	registryBreakerThreshold = 2
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		_, _, err := FetchRegistry(context.Background(), server.Client(), newRegistryRequest(t, server.URL))
+		assert.True(t, errors.Is(err, ErrRegistryUnavailable))
+	}
+	callsBeforeOpen := atomic.LoadInt32(&calls)
+
+	_, _, err := FetchRegistry(context.Background(), server.Client(), newRegistryRequest(t, server.URL))
+	assert.True(t, errors.Is(err, ErrRegistryUnavailable))
+	assert.Contains(t, err.Error(), "circuit open")
+	assert.Equal(t, callsBeforeOpen, atomic.LoadInt32(&calls), "open circuit should not hit the registry")
+}
+
+func TestFetchRegistry_CallerCancellationDoesNotOpenCircuit(t *testing.T) {
+	withFastRegistryRetry(t)
+	registryBreakerThreshold = 1
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`ok`))
+	}))
+	defer server.Close()
+
+	// 调用方超时：返回调用方的错误，且不打开熔断
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := FetchRegistry(ctx, server.Client(), newRegistryRequest(t, server.URL))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, errors.Is(err, ErrRegistryUnavailable))
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	_, _, err = FetchRegistry(canceled, server.Client(), newRegistryRequest(t, server.URL))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	status, body, err := FetchRegistry(context.Background(), server.Client(), newRegistryRequest(t, server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", string(body))
+}
+
+func setRegistryConnLimits(t *testing.T, maxIdle, maxIdlePerHost, maxPerHost string) {
+	t.Helper()
+	keys := []string{common.OptionRegistryMaxIdleConns, common.OptionRegistryMaxIdleConnsPerHost, common.OptionRegistryMaxConnsPerHost}
+	values := []string{maxIdle, maxIdlePerHost, maxPerHost}
+	common.OptionMapRWMutex.Lock()
+	original := make(map[string]string, len(keys))
+	for i, key := range keys {
+		original[key] = common.OptionMap[key]
+		common.OptionMap[key] = values[i]
+	}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		for key, value := range original {
+			common.OptionMap[key] = value
+		}
+		common.OptionMapRWMutex.Unlock()
+	})
+}
+
+// rewriteTransport 记录经过共享客户端的请求，并把它们转发到测试服务器
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+	mu     sync.Mutex
+	hosts  []string
+}
+
+func (rt *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.hosts = append(rt.hosts, req.URL.Host)
+	rt.mu.Unlock()
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return rt.next.RoundTrip(req)
+}
+
+func TestRegistryHTTPClient_SharedAcrossRegistryCalls(t *testing.T) {
+	withFastRegistryRetry(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/-/v1/search"):
+			_, _ = w.Write([]byte(`{"objects":[],"total":0}`))
+		case strings.HasPrefix(r.URL.Path, "/repos/"):
+			_, _ = w.Write([]byte(`{"stargazers_count":42}`))
+		default:
+			_, _ = w.Write([]byte(`{"name":"shared-client-pkg"}`))
+		}
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	client := registryHTTPClient()
+	assert.Same(t, client, registryHTTPClient(), "the client must be reused while the limits are unchanged")
+	recorder := &rewriteTransport{target: target, next: client.Transport}
+	client.Transport = recorder
+	defer func() { client.Transport = recorder.next }()
+
+	_, err = SearchNPMPackages(context.Background(), "shared-client", 10, 1)
+	assert.NoError(t, err)
+	details, err := GetNPMPackageDetails(context.Background(), "shared-client-pkg")
+	assert.NoError(t, err)
+	assert.Equal(t, "shared-client-pkg", details.Name)
+	assert.Equal(t, 42, FetchGitHubStars(context.Background(), "owner", "shared-client-repo"))
+
+	assert.Equal(t, []string{"registry.npmjs.org", "registry.npmjs.org", "api.github.com"}, recorder.hosts)
+}
+
+func TestRegistryHTTPClient_HonorsConfiguredLimits(t *testing.T) {
+	withFastRegistryRetry(t)
+	setRegistryConnLimits(t, "7", "3", "1")
+
+	client := registryHTTPClient()
+	transport, ok := client.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, 7, transport.MaxIdleConns)
+	assert.Equal(t, 3, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 1, transport.MaxConnsPerHost)
+
+	var active, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _, err := FetchRegistry(context.Background(), client, newRegistryRequest(t, server.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, status)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&peak), "MaxConnsPerHost=1 must serialize requests to one host")
+
+	// 选项变化后重建客户端
+	setRegistryConnLimits(t, "7", "3", "2")
+	rebuilt := registryHTTPClient()
+	assert.NotSame(t, client, rebuilt)
+	assert.Equal(t, 2, rebuilt.Transport.(*http.Transport).MaxConnsPerHost)
+}
@@ -0,0 +1,51 @@
+package market
+
+import (
+	"sort"
+	"strings"
+)
+
+// SearchSourceResults 是单个数据源（npm、pypi 等）返回的一组搜索结果，保持数据源内的原始顺序
+type SearchSourceResults struct {
+	Source  string
+	Results []SearchPackageResult
+}
+
+// MergeSearchResults 合并多个数据源的搜索结果。
+// 默认按 Score 从高到低交错排列，分数相同时按 priority 中的数据源顺序，再按数据源内的原始顺序；
+// grouped 为 true 时保持按数据源分组，各组按 priority 排列。未出现在 priority 中的数据源排在最后，保持传入顺序。
+func MergeSearchResults(sources []SearchSourceResults, priority []string, grouped bool) []SearchPackageResult {
+	rank := make(map[string]int, len(priority))
+	for i, source := range priority {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if _, exists := rank[source]; !exists && source != "" {
+			rank[source] = i
+		}
+	}
+	sourceRank := func(source string) int {
+		if r, ok := rank[strings.ToLower(source)]; ok {
+			return r
+		}
+		return len(priority)
+	}
+
+	ordered := make([]SearchSourceResults, len(sources))
+	copy(ordered, sources)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return sourceRank(ordered[i].Source) < sourceRank(ordered[j].Source)
+	})
+
+	merged := []SearchPackageResult{}
+	for _, group := range ordered {
+		merged = append(merged, group.Results...)
+	}
+	if grouped {
+		return merged
+	}
+
+	// 数据源已按优先级排好且组内保持原顺序，稳定排序后同分结果自然按优先级与原顺序排列
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	return merged
+}
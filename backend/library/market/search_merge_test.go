@@ -0,0 +1,69 @@
+package market
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeSearchResults(t *testing.T) {
+	npm := SearchSourceResults{Source: "npm", Results: []SearchPackageResult{
+		{Name: "npm-a", Score: 0.9},
+		{Name: "npm-b", Score: 0.4},
+		{Name: "npm-c", Score: 0.2},
+	}}
+	pypi := SearchSourceResults{Source: "pypi", Results: []SearchPackageResult{
+		{Name: "pypi-a", Score: 0.95},
+		{Name: "pypi-b", Score: 0.4},
+		{Name: "pypi-c", Score: 0.1},
+	}}
+
+	tests := []struct {
+		name     string
+		sources  []SearchSourceResults
+		priority []string
+		grouped  bool
+		want     []string
+	}{
+		{
+			name:     "interleaved by score, ties follow source priority",
+			sources:  []SearchSourceResults{npm, pypi},
+			priority: []string{"npm", "pypi"},
+			want:     []string{"pypi-a", "npm-a", "npm-b", "pypi-b", "npm-c", "pypi-c"},
+		},
+		{
+			name:     "pypi preferred on ties",
+			sources:  []SearchSourceResults{npm, pypi},
+			priority: []string{"pypi", "npm"},
+			want:     []string{"pypi-a", "npm-a", "pypi-b", "npm-b", "npm-c", "pypi-c"},
+		},
+		{
+			name:     "grouped by source in priority order",
+			sources:  []SearchSourceResults{npm, pypi},
+			priority: []string{"pypi", "npm"},
+			grouped:  true,
+			want:     []string{"pypi-a", "pypi-b", "pypi-c", "npm-a", "npm-b", "npm-c"},
+		},
+		{
+			name:     "unlisted sources go last",
+			sources:  []SearchSourceResults{pypi, npm},
+			priority: []string{"npm"},
+			grouped:  true,
+			want:     []string{"npm-a", "npm-b", "npm-c", "pypi-a", "pypi-b", "pypi-c"},
+		},
+		{
+			name:    "no sources",
+			sources: nil,
+			want:    []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := []string{}
+			for _, result := range MergeSearchResults(tt.sources, tt.priority, tt.grouped) {
+				names = append(names, result.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
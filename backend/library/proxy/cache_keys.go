@@ -11,3 +11,9 @@ func SharedServiceCacheKey(serviceID int64) string {
 func SharedServiceInstanceName(serviceID int64) string {
 	return fmt.Sprintf("global-shared-svc-%d", serviceID)
 }
+
+// UserServiceCacheKey generates the cache key for a user-specific MCP service instance.
+// Instances of named env profiles append "-profile-<name>" to it.
+func UserServiceCacheKey(userID, serviceID int64) string {
+	return fmt.Sprintf("user-%d-service-%d-shared", userID, serviceID)
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"maps"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Request correlation
+//
+// The request ID of a downstream proxy request (X-Request-ID, generated when the client sends none) is forwarded
+// with every tools/call sent upstream on its behalf, so upstream logs can be tied back to one-mcp's access log:
+//   - all transports: in the request's _meta under CorrelationMetaKey, visible to any server that logs _meta;
+//   - SSE and streamable HTTP: additionally as the CorrelationHeader on the HTTP request that carries the call.
+//
+// stdio upstreams share one long-lived process and pipe, so there is no per-request header and only _meta is
+// available. Over SSE the header is set on the POST of the message; the response arrives on the shared event
+// stream, so upstream logs of the stream itself cannot be correlated. Other upstream requests (tools/list, ping)
+// are not tied to a downstream request and carry neither.
+const (
+	CorrelationHeader  = "X-Request-ID"
+	CorrelationMetaKey = "one-mcp/request-id"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose upstream tool calls are correlated with requestID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID set by WithRequestID, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// correlationHeaders is the header function of HTTP upstream transports: it adds the CorrelationHeader to the
+// upstream HTTP requests made for a correlated context
+func correlationHeaders(ctx context.Context) map[string]string {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		return map[string]string{CorrelationHeader: requestID}
+	}
+	return nil
+}
+
+// WithCorrelationMeta returns request with the request ID of ctx added to its _meta. The meta of the downstream
+// request (e.g. its progress token) is kept and not modified in place.
+func WithCorrelationMeta(ctx context.Context, request mcp.CallToolRequest) mcp.CallToolRequest {
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		return request
+	}
+	meta := &mcp.Meta{}
+	if request.Params.Meta != nil {
+		meta.ProgressToken = request.Params.Meta.ProgressToken
+		meta.AdditionalFields = maps.Clone(request.Params.Meta.AdditionalFields)
+	}
+	if meta.AdditionalFields == nil {
+		meta.AdditionalFields = make(map[string]any)
+	}
+	meta.AdditionalFields[CorrelationMetaKey] = requestID
+	request.Params.Meta = meta
+	return request
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// forwardedToolCall is what the upstream received for a tools/call
+type forwardedToolCall struct {
+	header string
+	meta   map[string]any
+}
+
+// newCorrelationUpstream starts a streamable HTTP upstream with an "echo" tool that records the correlation
+// header and _meta of every tools/call it receives
+func newCorrelationUpstream(t *testing.T) (*httptest.Server, func() []forwardedToolCall) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []forwardedToolCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Meta map[string]any `json:"_meta"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(req.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		response := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "initialize":
+			response["result"] = map[string]any{
+				"protocolVersion": mcp.LATEST_PROTOCOL_VERSION,
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "correlation-upstream", "version": "1.0.0"},
+			}
+		case "tools/list":
+			response["result"] = map[string]any{"tools": []any{
+				map[string]any{"name": "echo", "inputSchema": map[string]any{"type": "object"}},
+			}}
+		case "tools/call":
+			mu.Lock()
+			calls = append(calls, forwardedToolCall{header: r.Header.Get(CorrelationHeader), meta: req.Params.Meta})
+			mu.Unlock()
+			response["result"] = map[string]any{"content": []any{map[string]any{"type": "text", "text": "ok"}}}
+		default:
+			response["result"] = map[string]any{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []forwardedToolCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]forwardedToolCall(nil), calls...)
+	}
+}
+
+func TestToolCallForwardsRequestIDOverHTTP(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	defer func() { common.SQLitePath = originalPath }()
+
+	upstream, forwarded := newCorrelationUpstream(t)
+	svc := &model.MCPService{Name: "correlation-svc", Type: model.ServiceTypeStreamableHTTP, Command: upstream.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv, cli, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "correlation-key", svc, "test", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cli.Close()
+
+	callTool := func(ctx context.Context) {
+		message := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{},"_meta":{"progressToken":"p-1"}}}`
+		response := srv.HandleMessage(ctx, json.RawMessage(message))
+		_, isError := response.(mcp.JSONRPCError)
+		assert.False(t, isError, "%+v", response)
+	}
+	callTool(WithRequestID(ctx, "req-996"))
+	callTool(ctx)
+
+	calls := forwarded()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "req-996", calls[0].header)
+		assert.Equal(t, "req-996", calls[0].meta[CorrelationMetaKey])
+		assert.Equal(t, "p-1", calls[0].meta["progressToken"], "the downstream meta is kept")
+
+		assert.Empty(t, calls[1].header, "calls without a request ID are not correlated")
+		assert.NotContains(t, calls[1].meta, CorrelationMetaKey)
+	}
+}
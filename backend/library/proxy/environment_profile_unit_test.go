@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveEnvironmentSelectsStdioEnvProfile(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	errStopAfterEnv := errors.New("stop after capturing the env")
+	var capturedEnv []string
+	originalNewClient := newStdioMCPClient
+	newStdioMCPClient = func(cmd *exec.Cmd, noise *stdoutNoise, clientOpts []mcpclient.ClientOption) (mcpclient.MCPClient, error) {
+		capturedEnv = cmd.Env
+		return nil, errStopAfterEnv
+	}
+	common.OptionMapRWMutex.Lock()
+	originalEnvironment := common.OptionMap[common.OptionActiveEnvironment]
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.SQLitePath = originalPath
+		newStdioMCPClient = originalNewClient
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionActiveEnvironment] = originalEnvironment
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	profiled := `{"default": {"API_URL": "http://localhost", "LOG_LEVEL": "debug"}, "prod": {"API_URL": "https://api.example.com"}}`
+	tests := []struct {
+		name        string
+		environment string
+		envsJSON    string
+		want        []string
+		notWant     []string
+	}{
+		{"default profile", "", profiled, []string{"API_URL=http://localhost", "LOG_LEVEL=debug"}, nil},
+		{"active profile overrides the default profile", "prod", profiled, []string{"API_URL=https://api.example.com", "LOG_LEVEL=debug"}, []string{"API_URL=http://localhost"}},
+		{"missing profile falls back to the default profile", "staging", profiled, []string{"API_URL=http://localhost", "LOG_LEVEL=debug"}, nil},
+		{"flat envs are used in every environment", "prod", `{"API_URL": "http://flat"}`, []string{"API_URL=http://flat"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.OptionMapRWMutex.Lock()
+			common.OptionMap[common.OptionActiveEnvironment] = tt.environment
+			common.OptionMapRWMutex.Unlock()
+			capturedEnv = nil
+
+			svc := &model.MCPService{Name: "env-profile-svc", Type: model.ServiceTypeStdio, Command: "server", Enabled: true, DefaultEnvsJSON: tt.envsJSON}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_, err := getOrCreateSharedMcpInstanceWithKeyInternal(ctx, svc, "env-profile-key", "test", svc.DefaultEnvsJSON)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), errStopAfterEnv.Error())
+			}
+			for _, entry := range tt.want {
+				assert.Contains(t, capturedEnv, entry)
+			}
+			for _, entry := range tt.notWant {
+				assert.NotContains(t, capturedEnv, entry)
+			}
+		})
+	}
+}
+
+func TestInstalledVersionUpdateKeepsEnvProfiles(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	defer func() { common.SQLitePath = originalPath }()
+
+	upstream := httptest.NewServer(mcpserver.NewStreamableHTTPServer(mcpserver.NewMCPServer("versioned-upstream", "2.0.0")))
+	defer upstream.Close()
+
+	profiled := `{"default": {"API_URL": "http://localhost"}, "prod": {"API_URL": "https://api.example.com"}}`
+	svc := &model.MCPService{Name: "versioned-svc", DisplayName: "Versioned", Type: model.ServiceTypeStreamableHTTP, Command: upstream.URL, Enabled: true, InstalledVersion: "1.0.0", DefaultEnvsJSON: profiled}
+	assert.NoError(t, model.CreateService(svc))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cacheKey := "versioned-key"
+	instance, err := getOrCreateSharedMcpInstanceWithKeyInternal(ctx, svc, cacheKey, "test", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		sharedMCPServersMutex.Lock()
+		delete(sharedMCPServers, cacheKey)
+		sharedMCPServersMutex.Unlock()
+		_ = instance.Shutdown(context.Background())
+	}()
+
+	// Only the version is saved: the instance config carries the envs resolved from the active profile
+	saved, err := model.GetServiceByID(svc.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2.0.0", saved.InstalledVersion)
+		assert.JSONEq(t, profiled, saved.DefaultEnvsJSON)
+	}
+}
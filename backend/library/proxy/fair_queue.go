@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+)
+
+var (
+	// ErrToolCallQueueFull is returned when an instance is at its concurrency limit and its queue is full
+	ErrToolCallQueueFull = errors.New("too many tool calls are queued for this service, try again later")
+	// ErrToolCallQueueTimeout is returned when a queued tool call did not get a slot within ToolCallQueueTimeout
+	ErrToolCallQueueTimeout = errors.New("timed out waiting in the tool call queue of this service")
+)
+
+type toolCallCallerKey struct{}
+
+// WithToolCallCaller returns a context whose tool calls are queued on behalf of caller (typically the user ID)
+func WithToolCallCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, toolCallCallerKey{}, caller)
+}
+
+func toolCallCaller(ctx context.Context) string {
+	caller, _ := ctx.Value(toolCallCallerKey{}).(string)
+	return caller
+}
+
+// fairWaiter is a queued tool call; ready is closed once it has been given a slot
+type fairWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// fairScheduler limits the tool calls running at once on an instance. Calls over the limit wait in one queue
+// per caller, and freed slots go to the callers in turn, so a caller with a burst of calls cannot delay the
+// others by more than one call each.
+type fairScheduler struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	waiting int
+	queues  map[string][]*fairWaiter
+	order   []string // callers with queued calls, in round-robin order
+	next    int      // index in order of the caller served next
+
+	cacheKey    string // key in toolCallSchedulers, "" when not registered
+	pruneOnIdle bool   // the instance was shut down: drop the scheduler once its calls are done
+	retired     bool   // dropped from toolCallSchedulers; acquire must look the scheduler up again
+}
+
+func newFairScheduler() *fairScheduler {
+	return &fairScheduler{queues: map[string][]*fairWaiter{}}
+}
+
+// errSchedulerRetired is returned by acquire when the scheduler was pruned after it was looked up
+var errSchedulerRetired = errors.New("tool call scheduler was pruned")
+
+func (f *fairScheduler) idleLocked() bool {
+	return f.active == 0 && f.waiting == 0
+}
+
+// acquire waits for a slot for a call of caller and returns the function that frees it. A limit <= 0 lets
+// every call through.
+func (f *fairScheduler) acquire(ctx context.Context, caller string, limit, depth int, timeout time.Duration) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+	f.mu.Lock()
+	if f.retired {
+		f.mu.Unlock()
+		return nil, errSchedulerRetired
+	}
+	f.limit = limit
+	if f.active < limit && f.waiting == 0 {
+		f.active++
+		f.mu.Unlock()
+		return f.releaseFunc(), nil
+	}
+	if f.waiting >= depth {
+		f.mu.Unlock()
+		return nil, ErrToolCallQueueFull
+	}
+	waiter := &fairWaiter{ready: make(chan struct{})}
+	if len(f.queues[caller]) == 0 {
+		f.order = append(f.order, caller)
+	}
+	f.queues[caller] = append(f.queues[caller], waiter)
+	f.waiting++
+	f.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-waiter.ready:
+		return f.releaseFunc(), nil
+	case <-timer.C:
+		err = ErrToolCallQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	f.mu.Lock()
+	if waiter.granted {
+		// 放弃的同时恰好分到了名额：交给下一个排队的调用
+		f.active--
+		f.dispatchLocked()
+	} else {
+		f.removeLocked(caller, waiter)
+	}
+	prune := f.pruneOnIdle && f.idleLocked()
+	f.mu.Unlock()
+	if prune {
+		pruneToolCallScheduler(f.cacheKey)
+	}
+	return nil, err
+}
+
+func (f *fairScheduler) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mu.Lock()
+			f.active--
+			f.dispatchLocked()
+			prune := f.pruneOnIdle && f.idleLocked()
+			f.mu.Unlock()
+			if prune {
+				pruneToolCallScheduler(f.cacheKey)
+			}
+		})
+	}
+}
+
+// dispatchLocked hands free slots to queued calls, one caller at a time. Caller must hold f.mu.
+func (f *fairScheduler) dispatchLocked() {
+	for f.active < f.limit && f.waiting > 0 {
+		if f.next >= len(f.order) {
+			f.next = 0
+		}
+		caller := f.order[f.next]
+		queue := f.queues[caller]
+		waiter := queue[0]
+		if len(queue) == 1 {
+			delete(f.queues, caller)
+			f.order = append(f.order[:f.next], f.order[f.next+1:]...)
+		} else {
+			f.queues[caller] = queue[1:]
+			f.next++
+		}
+		f.waiting--
+		f.active++
+		waiter.granted = true
+		close(waiter.ready)
+	}
+}
+
+// removeLocked drops a call that gave up waiting. Caller must hold f.mu.
+func (f *fairScheduler) removeLocked(caller string, waiter *fairWaiter) {
+	queue := f.queues[caller]
+	for i, w := range queue {
+		if w != waiter {
+			continue
+		}
+		f.waiting--
+		if len(queue) > 1 {
+			f.queues[caller] = append(queue[:i:i], queue[i+1:]...)
+			return
+		}
+		delete(f.queues, caller)
+		for j, c := range f.order {
+			if c == caller {
+				f.order = append(f.order[:j], f.order[j+1:]...)
+				if j < f.next {
+					f.next--
+				}
+				break
+			}
+		}
+		return
+	}
+}
+
+var (
+	toolCallSchedulersMu sync.Mutex
+	toolCallSchedulers   = map[string]*fairScheduler{}
+)
+
+// toolCallSchedulerFor returns the scheduler of the instance cached under cacheKey. It outlives re-creations
+// of the instance so calls queued across a restart keep their place.
+func toolCallSchedulerFor(cacheKey string) *fairScheduler {
+	toolCallSchedulersMu.Lock()
+	defer toolCallSchedulersMu.Unlock()
+	scheduler, ok := toolCallSchedulers[cacheKey]
+	if !ok {
+		scheduler = newFairScheduler()
+		scheduler.cacheKey = cacheKey
+		toolCallSchedulers[cacheKey] = scheduler
+	}
+	return scheduler
+}
+
+// pruneToolCallScheduler drops the scheduler of the instance cached under cacheKey once it has no running or
+// queued calls. Called when the instance shuts down; a scheduler that is still busy, e.g. with calls queued
+// across a re-creation, is dropped when its last call is done and the next call starts a new one.
+func pruneToolCallScheduler(cacheKey string) {
+	toolCallSchedulersMu.Lock()
+	defer toolCallSchedulersMu.Unlock()
+	scheduler, ok := toolCallSchedulers[cacheKey]
+	if !ok {
+		return
+	}
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	if !scheduler.idleLocked() {
+		scheduler.pruneOnIdle = true
+		return
+	}
+	scheduler.retired = true
+	delete(toolCallSchedulers, cacheKey)
+}
+
+// acquireToolCallSlot waits for a tool call slot on the instance cached under cacheKey, honoring the
+// ToolCallMaxConcurrency, ToolCallQueueDepth and ToolCallQueueTimeout options.
+func acquireToolCallSlot(ctx context.Context, cacheKey string) (func(), error) {
+	limit, depth, timeout := common.GetToolCallQueueConfig()
+	for {
+		release, err := toolCallSchedulerFor(cacheKey).acquire(ctx, toolCallCaller(ctx), limit, depth, timeout)
+		if !errors.Is(err, errSchedulerRetired) {
+			return release, err
+		}
+	}
+}
+
+// AcquireToolCallSlot waits for a slot to call a tool on the instance, queued fairly with the other callers
+// of the instance; see WithToolCallCaller. The returned function must be called when the call is done.
+func (s *SharedMcpInstance) AcquireToolCallSlot(ctx context.Context) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	return acquireToolCallSlot(ctx, s.cacheKey)
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+)
+
+// waitForQueued blocks until n calls are waiting in f
+func waitForQueued(t *testing.T, f *fairScheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		waiting := f.waiting
+		f.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d queued calls, got %d", n, waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFairSchedulerInterleavesUsers(t *testing.T) {
+	f := newFairScheduler()
+	hold, err := f.acquire(context.Background(), "alice", 1, 100, time.Minute)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	submit := func(caller string, n int) {
+		for i := 1; i <= n; i++ {
+			label := fmt.Sprintf("%s%d", caller, i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := f.acquire(context.Background(), caller, 1, 100, time.Minute)
+				if err != nil {
+					t.Errorf("acquire %s: %v", label, err)
+					return
+				}
+				mu.Lock()
+				order = append(order, label)
+				mu.Unlock()
+				release()
+			}()
+			f.mu.Lock()
+			queued := f.waiting
+			f.mu.Unlock()
+			waitForQueued(t, f, queued+1)
+		}
+	}
+	// alice 先提交一大批，bob 随后提交少量调用
+	submit("a", 5)
+	submit("b", 3)
+
+	hold()
+	wg.Wait()
+	want := []string{"a1", "b1", "a2", "b2", "a3", "b3", "a4", "a5"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("expected calls to alternate between users, got %v want %v", order, want)
+	}
+}
+
+func TestFairSchedulerQueueLimits(t *testing.T) {
+	f := newFairScheduler()
+	hold, err := f.acquire(context.Background(), "alice", 1, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer hold()
+
+	// 排队超时后让出位置
+	if _, err := f.acquire(context.Background(), "bob", 1, 1, 20*time.Millisecond); !errors.Is(err, ErrToolCallQueueTimeout) {
+		t.Fatalf("expected ErrToolCallQueueTimeout, got %v", err)
+	}
+	waitForQueued(t, f, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.acquire(ctx, "bob", 1, 1, time.Minute)
+		done <- err
+	}()
+	waitForQueued(t, f, 1)
+	if _, err := f.acquire(context.Background(), "carol", 1, 1, time.Minute); !errors.Is(err, ErrToolCallQueueFull) {
+		t.Fatalf("expected ErrToolCallQueueFull, got %v", err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	waitForQueued(t, f, 0)
+}
+
+func TestAcquireToolCallSlotHonorsOptions(t *testing.T) {
+	common.OptionMapRWMutex.Lock()
+	original := map[string]string{}
+	for _, key := range []string{common.OptionToolCallMaxConcurrency, common.OptionToolCallQueueDepth, common.OptionToolCallQueueTimeout} {
+		original[key] = common.OptionMap[key]
+	}
+	common.OptionMap[common.OptionToolCallMaxConcurrency] = "1"
+	common.OptionMap[common.OptionToolCallQueueDepth] = "0"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		defer common.OptionMapRWMutex.Unlock()
+		for key, value := range original {
+			common.OptionMap[key] = value
+		}
+	}()
+
+	ctx := WithToolCallCaller(context.Background(), "965")
+	release, err := acquireToolCallSlot(ctx, "fair-queue-options-key")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if _, err := acquireToolCallSlot(ctx, "fair-queue-options-key"); !errors.Is(err, ErrToolCallQueueFull) {
+		t.Fatalf("expected ErrToolCallQueueFull with a zero queue depth, got %v", err)
+	}
+	// 其他实例不受影响
+	other, err := acquireToolCallSlot(ctx, "fair-queue-options-other-key")
+	if err != nil {
+		t.Fatalf("acquire on another instance: %v", err)
+	}
+	other()
+	release()
+	release()
+	again, err := acquireToolCallSlot(ctx, "fair-queue-options-key")
+	if err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	again()
+}
+
+func TestPruneToolCallScheduler(t *testing.T) {
+	registered := func(cacheKey string) bool {
+		toolCallSchedulersMu.Lock()
+		defer toolCallSchedulersMu.Unlock()
+		_, ok := toolCallSchedulers[cacheKey]
+		return ok
+	}
+
+	// 空闲的调度器在实例关闭时立即移除
+	idle := toolCallSchedulerFor("fair-queue-prune-idle")
+	pruneToolCallScheduler("fair-queue-prune-idle")
+	if registered("fair-queue-prune-idle") {
+		t.Fatal("expected the idle scheduler to be pruned")
+	}
+	if _, err := idle.acquire(context.Background(), "alice", 1, 1, time.Minute); !errors.Is(err, errSchedulerRetired) {
+		t.Fatalf("expected a pruned scheduler to reject calls, got %v", err)
+	}
+
+	// 仍有调用的调度器在最后一个调用结束后移除
+	busy := toolCallSchedulerFor("fair-queue-prune-busy")
+	release, err := busy.acquire(context.Background(), "alice", 1, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	pruneToolCallScheduler("fair-queue-prune-busy")
+	if !registered("fair-queue-prune-busy") {
+		t.Fatal("expected the busy scheduler to be kept until its calls are done")
+	}
+	release()
+	if registered("fair-queue-prune-busy") {
+		t.Fatal("expected the scheduler to be pruned after its last call")
+	}
+}
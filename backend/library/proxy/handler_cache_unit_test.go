@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func populateProxyHandlerCaches(serviceIDs ...int64) {
+	sseWrappersMutex.Lock()
+	initializedSSEProxyWrappers = make(map[string]http.Handler)
+	for _, id := range serviceIDs {
+		initializedSSEProxyWrappers[proxyHandlerCacheKey(id, "sseproxy", SharedServiceCacheKey(id))] = http.NotFoundHandler()
+	}
+	sseWrappersMutex.Unlock()
+
+	httpWrappersMutex.Lock()
+	initializedHTTPProxyWrappers = make(map[string]http.Handler)
+	for _, id := range serviceIDs {
+		initializedHTTPProxyWrappers[proxyHandlerCacheKey(id, "httpproxy", SharedServiceCacheKey(id))] = http.NotFoundHandler()
+	}
+	httpWrappersMutex.Unlock()
+}
+
+func TestClearProxyHandlerCaches(t *testing.T) {
+	defer populateProxyHandlerCaches()
+
+	tests := []struct {
+		name          string
+		serviceID     int64
+		wantCleared   int
+		wantRemaining []int64
+	}{
+		{"single service", 2, 1, []int64{1, 3}},
+		{"unknown service", 42, 0, []int64{1, 2, 3}},
+		{"all services", 0, 3, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			populateProxyHandlerCaches(1, 2, 3)
+			if info := GetProxyHandlerCacheInfo(); !reflect.DeepEqual(info.SSEServiceIDs, []int64{1, 2, 3}) {
+				t.Fatalf("unexpected cache snapshot before clearing: %+v", info)
+			}
+
+			sseCleared, httpCleared := ClearProxyHandlerCaches(tt.serviceID)
+			if sseCleared != tt.wantCleared || httpCleared != tt.wantCleared {
+				t.Fatalf("cleared sse=%d http=%d, want %d each", sseCleared, httpCleared, tt.wantCleared)
+			}
+			info := GetProxyHandlerCacheInfo()
+			if !reflect.DeepEqual(info.SSEServiceIDs, tt.wantRemaining) || !reflect.DeepEqual(info.HTTPServiceIDs, tt.wantRemaining) {
+				t.Fatalf("remaining caches = %+v, want %v", info, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestRestartUserServiceInstances(t *testing.T) {
+	defer populateProxyHandlerCaches()
+	populateProxyHandlerCaches(7)
+
+	keys := []string{
+		UserServiceCacheKey(1, 7),
+		UserServiceCacheKey(1, 7) + "-profile-work",
+		UserServiceCacheKey(1, 70), // 另一个服务，ID 前缀相同
+		UserServiceCacheKey(2, 7),
+		SharedServiceCacheKey(7),
+	}
+	sharedMCPServersMutex.Lock()
+	for _, key := range keys {
+		sharedMCPServers[key] = &SharedMcpInstance{serviceID: 7, cacheKey: key}
+	}
+	sharedMCPServersMutex.Unlock()
+	httpWrappersMutex.Lock()
+	for _, key := range keys[:2] {
+		initializedHTTPProxyWrappers[proxyHandlerCacheKey(7, "httpproxy", key)] = http.NotFoundHandler()
+	}
+	httpWrappersMutex.Unlock()
+	defer func() {
+		sharedMCPServersMutex.Lock()
+		for _, key := range keys {
+			delete(sharedMCPServers, key)
+		}
+		sharedMCPServersMutex.Unlock()
+	}()
+
+	if stopped := RestartUserServiceInstances(context.Background(), 1, 7); stopped != 2 {
+		t.Fatalf("stopped %d instances, want 2", stopped)
+	}
+	sharedMCPServersMutex.Lock()
+	for i, key := range keys {
+		_, exists := sharedMCPServers[key]
+		if wantExists := i >= 2; exists != wantExists {
+			t.Errorf("instance %s exists = %v, want %v", key, exists, wantExists)
+		}
+	}
+	sharedMCPServersMutex.Unlock()
+	httpWrappersMutex.Lock()
+	for _, key := range keys[:2] {
+		if _, exists := initializedHTTPProxyWrappers[proxyHandlerCacheKey(7, "httpproxy", key)]; exists {
+			t.Errorf("proxy handler of the restarted instance %s should be cleared", key)
+		}
+	}
+	httpWrappersMutex.Unlock()
+	// The shared instance keeps its handlers, so its sessions are not cut
+	if info := GetProxyHandlerCacheInfo(); !reflect.DeepEqual(info.SSEServiceIDs, []int64{7}) || !reflect.DeepEqual(info.HTTPServiceIDs, []int64{7}) {
+		t.Fatalf("proxy handlers of the shared instance should be kept, got %+v", info)
+	}
+	if stopped := RestartUserServiceInstances(context.Background(), 1, 7); stopped != 0 {
+		t.Fatalf("second restart stopped %d instances, want 0", stopped)
+	}
+}
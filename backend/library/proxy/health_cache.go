@@ -17,8 +17,12 @@ type HealthCacheManager struct {
 	expireTime  time.Duration
 	mutex       sync.RWMutex // 用于保护并发访问
 	local       map[string]healthLocalCacheItem
+	history     map[int64][]ServiceHealth // 每个服务最近的健康检查结果（仅进程内，用于诊断）
 }
 
+// healthHistoryLimit 每个服务保留的健康历史条数
+const healthHistoryLimit = 20
+
 type healthLocalCacheItem struct {
 	value     string
 	expiresAt time.Time
@@ -34,6 +38,7 @@ func NewHealthCacheManager(expireTime time.Duration) *HealthCacheManager {
 		cacheClient: thing.Cache(), // 使用 Thing ORM v0.1.17 的全局缓存
 		expireTime:  expireTime,
 		local:       make(map[string]healthLocalCacheItem),
+		history:     make(map[int64][]ServiceHealth),
 	}
 }
 
@@ -56,6 +61,7 @@ func (hcm *HealthCacheManager) SetServiceHealth(serviceID int64, health *Service
 
 	// 创建健康状态的副本以避免并发修改
 	healthCopy := *health
+	hcm.appendHistoryLocked(serviceID, healthCopy)
 
 	// 将 ServiceHealth 序列化为 JSON 存储到缓存
 	healthJSON, err := json.Marshal(&healthCopy)
@@ -82,6 +88,29 @@ func (hcm *HealthCacheManager) SetServiceHealth(serviceID int64, health *Service
 	log.Printf("Successfully cached health status for service %d (key: %s)", serviceID, cacheKey)
 }
 
+// appendHistoryLocked 记录一条健康历史，超出 healthHistoryLimit 时丢弃最旧的记录（调用方需持有写锁）
+func (hcm *HealthCacheManager) appendHistoryLocked(serviceID int64, health ServiceHealth) {
+	if hcm.history == nil {
+		hcm.history = make(map[int64][]ServiceHealth)
+	}
+	entries := append(hcm.history[serviceID], health)
+	if len(entries) > healthHistoryLimit {
+		entries = entries[len(entries)-healthHistoryLimit:]
+	}
+	hcm.history[serviceID] = entries
+}
+
+// GetServiceHealthHistory 返回服务最近的健康检查结果（从旧到新）
+func (hcm *HealthCacheManager) GetServiceHealthHistory(serviceID int64) []ServiceHealth {
+	hcm.mutex.RLock()
+	defer hcm.mutex.RUnlock()
+
+	entries := hcm.history[serviceID]
+	history := make([]ServiceHealth, len(entries))
+	copy(history, entries)
+	return history
+}
+
 // GetServiceHealth 从缓存获取服务健康状态
 func (hcm *HealthCacheManager) GetServiceHealth(serviceID int64) (*ServiceHealth, bool) {
 	hcm.mutex.RLock()
@@ -3,9 +3,12 @@ package proxy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
+
+	"one-mcp/backend/common"
 )
 
 // HealthChecker 负责定期检查服务的健康状态
@@ -16,6 +19,15 @@ type HealthChecker struct {
 	stopChan        chan struct{}
 	running         bool
 	lastUpdateTimes map[int64]time.Time
+
+	// 后台检查的并发控制：activeChecks 受 HealthCheckMaxConcurrency 限制，
+	// pendingChecks 记录已排队或进行中的服务，慢检查不会在多轮之间堆积；
+	// checksStopped 在 Stop 后为 true，等待名额的检查随之放弃
+	checksMu      sync.Mutex
+	checksCond    *sync.Cond
+	activeChecks  int
+	pendingChecks map[int64]bool
+	checksStopped bool
 }
 
 // NewHealthChecker 创建一个新的健康检查管理器
@@ -24,13 +36,16 @@ func NewHealthChecker(checkInterval time.Duration) *HealthChecker {
 		checkInterval = 1 * time.Minute // 默认检查间隔为1分钟
 	}
 
-	return &HealthChecker{
+	hc := &HealthChecker{
 		services:        make(map[int64]Service),
 		checkInterval:   checkInterval,
 		stopChan:        make(chan struct{}),
 		running:         false,
 		lastUpdateTimes: make(map[int64]time.Time),
+		pendingChecks:   make(map[int64]bool),
 	}
+	hc.checksCond = sync.NewCond(&hc.checksMu)
+	return hc
 }
 
 // RegisterService 注册一个服务到健康检查管理器
@@ -46,8 +61,8 @@ func (hc *HealthChecker) RegisterService(service Service) {
 	if shouldCheckImmediately {
 		// Log that an immediate check is being scheduled for the new service.
 		log.Printf("HealthChecker: New service %s (ID: %d) registered, scheduling immediate check.", service.Name(), service.ID())
-		// Perform the check in a new goroutine to avoid blocking the registration process.
-		go hc.checkService(service)
+		// Perform the check in the background to avoid blocking the registration process.
+		hc.scheduleCheck(service)
 	}
 }
 
@@ -66,12 +81,20 @@ func (hc *HealthChecker) Start() {
 		return
 	}
 
+	hc.checksMu.Lock()
+	hc.checksStopped = false
+	hc.checksMu.Unlock()
 	hc.running = true
 	go hc.runChecks()
 }
 
-// Stop 停止健康检查任务
+// Stop 停止健康检查任务，并让仍在等待并发名额的后台检查直接放弃；进行中的检查会在各自超时内结束
 func (hc *HealthChecker) Stop() {
+	hc.checksMu.Lock()
+	hc.checksStopped = true
+	hc.checksMu.Unlock()
+	hc.checksCond.Broadcast()
+
 	if !hc.running {
 		return
 	}
@@ -80,8 +103,12 @@ func (hc *HealthChecker) Stop() {
 	hc.running = false
 }
 
-// runChecks 运行定期健康检查任务
+// runChecks 运行定期健康检查任务，循环 panic 时记录并重启
 func (hc *HealthChecker) runChecks() {
+	runWithPanicRestart(0, "health checker", "health check loop", hc.runCheckLoop)
+}
+
+func (hc *HealthChecker) runCheckLoop() {
 	ticker := time.NewTicker(hc.checkInterval)
 	defer ticker.Stop()
 
@@ -108,8 +135,56 @@ func (hc *HealthChecker) checkAllServices() {
 	hc.servicesMu.RUnlock()
 
 	for _, service := range services {
-		go hc.checkService(service)
+		hc.scheduleCheck(service)
+	}
+}
+
+// scheduleCheck 在后台检查服务，同时进行的检查数不超过 HealthCheckMaxConcurrency，
+// 每个检查各自超时，慢检查只占用一个名额；同一服务的上一次检查尚未结束时跳过本次
+func (hc *HealthChecker) scheduleCheck(service Service) {
+	serviceID := service.ID()
+	hc.checksMu.Lock()
+	if hc.pendingChecks[serviceID] {
+		hc.checksMu.Unlock()
+		return
 	}
+	hc.pendingChecks[serviceID] = true
+	hc.checksMu.Unlock()
+
+	go func() {
+		if !hc.acquireCheckSlot(serviceID) {
+			return
+		}
+		defer hc.releaseCheckSlot(serviceID)
+		hc.checkService(service)
+	}()
+}
+
+// acquireCheckSlot 等待一个检查名额；健康检查已停止时放弃本次检查并返回 false
+func (hc *HealthChecker) acquireCheckSlot(serviceID int64) bool {
+	hc.checksMu.Lock()
+	defer hc.checksMu.Unlock()
+	for {
+		if hc.checksStopped {
+			delete(hc.pendingChecks, serviceID)
+			return false
+		}
+		limit := common.GetHealthCheckMaxConcurrency()
+		if limit <= 0 || hc.activeChecks < limit {
+			break
+		}
+		hc.checksCond.Wait()
+	}
+	hc.activeChecks++
+	return true
+}
+
+func (hc *HealthChecker) releaseCheckSlot(serviceID int64) {
+	hc.checksMu.Lock()
+	hc.activeChecks--
+	delete(hc.pendingChecks, serviceID)
+	hc.checksMu.Unlock()
+	hc.checksCond.Broadcast()
 }
 
 // checkService 检查单个服务的健康状态
@@ -122,12 +197,24 @@ func (hc *HealthChecker) checkService(service Service) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	// 单个服务的检查 panic 时标记为异常，不影响其他服务与检查循环
+	defer func() {
+		if r := recover(); r != nil {
+			logServicePanic(service.ID(), service.Name(), "health check", r)
+			hc.updateCacheHealthStatus(service.ID(), &ServiceHealth{
+				Status:       StatusUnhealthy,
+				LastChecked:  time.Now(),
+				ErrorMessage: fmt.Sprintf("health check panicked: %v", r),
+			})
+		}
+	}()
+
 	health, err := service.CheckHealth(ctx)
 	if err != nil {
 		log.Printf("Error checking health for service %s (ID: %d) with timeout %v: %v", service.Name(), service.ID(), timeout, err)
-		// 错误情况下仍然更新健康状态为异常
+		// 错误情况下仍然更新健康状态为异常；命令已不存在时标记为需要重新安装
 		health = &ServiceHealth{
-			Status:       StatusUnhealthy,
+			Status:       healthStatusForError(err),
 			LastChecked:  time.Now(),
 			ErrorMessage: err.Error(),
 		}
@@ -172,7 +259,7 @@ func (hc *HealthChecker) updateCacheHealthStatus(serviceID int64, health *Servic
 	cacheManager := GetHealthCacheManager()
 
 	// 将健康状态存储到缓存中
-	cacheManager.SetServiceHealth(serviceID, health)
+	cacheManager.SetServiceHealth(serviceID, applyMaintenanceOverlay(serviceID, health))
 
 	// 更新最后更新时间
 	hc.servicesMu.Lock()
@@ -207,7 +294,7 @@ func (hc *HealthChecker) ForceCheckService(serviceID int64) (*ServiceHealth, err
 		}
 
 		// Ensure standard fields are set for an error scenario
-		healthForCache.Status = StatusUnhealthy
+		healthForCache.Status = healthStatusForError(returnedErrFromService)
 		healthForCache.LastChecked = time.Now() // Always update to current time for this check event
 		if healthForCache.ErrorMessage == "" {  // If not already set by service.CheckHealth
 			healthForCache.ErrorMessage = returnedErrFromService.Error()
@@ -227,6 +314,7 @@ func (hc *HealthChecker) ForceCheckService(serviceID int64) (*ServiceHealth, err
 			healthForCache.ToolCount = 0
 			healthForCache.ToolsFetched = false
 		}
+		healthForCache = applyMaintenanceOverlay(serviceID, healthForCache)
 		cacheManagerAfterError := GetHealthCacheManager()
 		cacheManagerAfterError.SetServiceHealth(serviceID, healthForCache)
 		hc.servicesMu.Lock()
@@ -281,6 +369,7 @@ func (hc *HealthChecker) ForceCheckService(serviceID int64) (*ServiceHealth, err
 	}
 
 	// Directly update the cache and the HealthChecker's last update time for this service
+	returnedHealthFromService = applyMaintenanceOverlay(serviceID, returnedHealthFromService)
 	cacheManagerSuccess := GetHealthCacheManager()
 	cacheManagerSuccess.SetServiceHealth(serviceID, returnedHealthFromService)
 	hc.servicesMu.Lock()
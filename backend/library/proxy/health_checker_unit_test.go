@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowHealthService 记录同时进行的健康检查数
+type slowHealthService struct {
+	fakeHealthyService
+	delay   time.Duration
+	active  *atomic.Int32
+	maxSeen *atomic.Int32
+	checks  atomic.Int32
+}
+
+func (s *slowHealthService) CheckHealth(ctx context.Context) (*ServiceHealth, error) {
+	current := s.active.Add(1)
+	for {
+		seen := s.maxSeen.Load()
+		if current <= seen || s.maxSeen.CompareAndSwap(seen, current) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+	s.active.Add(-1)
+	s.checks.Add(1)
+	return &ServiceHealth{Status: StatusHealthy, LastChecked: time.Now()}, nil
+}
+
+func TestHealthChecker_LimitsConcurrentChecks(t *testing.T) {
+	common.OptionMapRWMutex.Lock()
+	original, hadOriginal := common.OptionMap[common.OptionHealthCheckMaxConcurrency]
+	common.OptionMap[common.OptionHealthCheckMaxConcurrency] = "3"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		if hadOriginal {
+			common.OptionMap[common.OptionHealthCheckMaxConcurrency] = original
+		} else {
+			delete(common.OptionMap, common.OptionHealthCheckMaxConcurrency)
+		}
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	var active, maxSeen atomic.Int32
+	hc := NewHealthChecker(time.Hour)
+	var services []*slowHealthService
+	for i := 0; i < 12; i++ {
+		id := int64(980001 + i)
+		delay := 20 * time.Millisecond
+		if i == 0 {
+			// 一个慢检查只占用一个名额，不阻塞其他服务
+			delay = 300 * time.Millisecond
+		}
+		svc := &slowHealthService{fakeHealthyService: fakeHealthyService{id: id, name: "slow", running: true}, delay: delay, active: &active, maxSeen: &maxSeen}
+		services = append(services, svc)
+		hc.RegisterService(svc)
+		defer GetHealthCacheManager().DeleteServiceHealth(id)
+		defer GetToolsCacheManager().DeleteServiceTools(id)
+	}
+
+	hc.checkAllServices()
+	// 上一轮尚未结束的服务不会重复排队
+	hc.checkAllServices()
+
+	fastDone := func() bool {
+		for _, svc := range services[1:] {
+			if svc.checks.Load() == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	assert.Eventually(t, fastDone, 250*time.Millisecond, 5*time.Millisecond, "fast checks should finish while the slow one runs")
+	assert.Eventually(t, func() bool { return services[0].checks.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	assert.LessOrEqual(t, maxSeen.Load(), int32(3))
+	assert.Equal(t, int32(3), maxSeen.Load(), "checks should run in parallel up to the limit")
+	for _, svc := range services {
+		assert.Equal(t, int32(1), svc.checks.Load())
+	}
+}
+
+// blockingHealthService 的检查一直阻塞到 release 被关闭
+type blockingHealthService struct {
+	fakeHealthyService
+	release chan struct{}
+	checks  atomic.Int32
+}
+
+func (s *blockingHealthService) CheckHealth(ctx context.Context) (*ServiceHealth, error) {
+	s.checks.Add(1)
+	<-s.release
+	return &ServiceHealth{Status: StatusHealthy, LastChecked: time.Now()}, nil
+}
+
+func TestHealthChecker_StopReleasesChecksWaitingForSlot(t *testing.T) {
+	common.OptionMapRWMutex.Lock()
+	original, hadOriginal := common.OptionMap[common.OptionHealthCheckMaxConcurrency]
+	common.OptionMap[common.OptionHealthCheckMaxConcurrency] = "1"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		if hadOriginal {
+			common.OptionMap[common.OptionHealthCheckMaxConcurrency] = original
+		} else {
+			delete(common.OptionMap, common.OptionHealthCheckMaxConcurrency)
+		}
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	release := make(chan struct{})
+	hc := NewHealthChecker(time.Hour)
+	var services []*blockingHealthService
+	for i := 0; i < 3; i++ {
+		id := int64(980101 + i)
+		svc := &blockingHealthService{fakeHealthyService: fakeHealthyService{id: id, name: "blocking", running: true}, release: release}
+		services = append(services, svc)
+		defer GetHealthCacheManager().DeleteServiceHealth(id)
+		defer GetToolsCacheManager().DeleteServiceTools(id)
+		hc.scheduleCheck(svc)
+	}
+	totalChecks := func() int32 {
+		var total int32
+		for _, svc := range services {
+			total += svc.checks.Load()
+		}
+		return total
+	}
+	// 一个检查占用唯一名额，其余两个在等待
+	assert.Eventually(t, func() bool { return totalChecks() == 1 }, time.Second, 5*time.Millisecond)
+
+	hc.Stop()
+	pendingCount := func() int {
+		hc.checksMu.Lock()
+		defer hc.checksMu.Unlock()
+		return len(hc.pendingChecks)
+	}
+	// 等待中的检查在 Stop 后放弃，不会永久阻塞
+	assert.Eventually(t, func() bool { return pendingCount() == 1 }, time.Second, 5*time.Millisecond)
+
+	close(release)
+	assert.Eventually(t, func() bool { return pendingCount() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), totalChecks())
+
+	// Stop 之后新排队的检查也不会执行
+	for _, svc := range services {
+		hc.scheduleCheck(svc)
+	}
+	assert.Eventually(t, func() bool { return pendingCount() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), totalChecks())
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"one-mcp/backend/model"
+)
+
+const (
+	// healthEndpointTimeout bounds a health endpoint request when the caller's context has no earlier deadline
+	healthEndpointTimeout = 10 * time.Second
+	// maxHealthEndpointBodyLen bounds how much of a failing response body is kept in the health error message
+	maxHealthEndpointBodyLen = 200
+)
+
+// healthEndpointError reports that the service's health endpoint answered with a non-2xx status.
+// The server is reachable, so re-creating the MCP client would not help.
+type healthEndpointError struct {
+	url        string
+	statusCode int
+	body       string
+}
+
+func (e *healthEndpointError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("health endpoint %s returned status %d", e.url, e.statusCode)
+	}
+	return fmt.Sprintf("health endpoint %s returned status %d: %s", e.url, e.statusCode, e.body)
+}
+
+// healthEndpointClient is used for health endpoint requests instead of http.DefaultClient, so a request is
+// bounded even without a context deadline and the service's headers are not forwarded by a cross-origin redirect
+var healthEndpointClient = &http.Client{
+	Timeout: healthEndpointTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !sameOrigin(req.URL, via[0].URL) {
+			req.Header = make(http.Header)
+		}
+		return nil
+	},
+}
+
+// sameOrigin reports whether two URLs share scheme, host and port, with default ports made explicit
+func sameOrigin(a, b *url.URL) bool {
+	port := func(u *url.URL) string {
+		if p := u.Port(); p != "" {
+			return p
+		}
+		if strings.EqualFold(u.Scheme, "https") {
+			return "443"
+		}
+		return "80"
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Hostname(), b.Hostname()) && port(a) == port(b)
+}
+
+// checkHealthEndpoint sends a GET to the service's HealthCheckURL. The service's custom headers and OAuth access
+// token are only sent when the health endpoint has the same origin as the service URL, so credentials never
+// reach another host.
+// It returns nil for a 2xx response and a *healthEndpointError for any other status; other errors mean
+// the endpoint could not be reached.
+func checkHealthEndpoint(ctx context.Context, svc *model.MCPService) error {
+	ctx, cancel := context.WithTimeout(ctx, healthEndpointTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, svc.HealthCheckURL, nil)
+	if err != nil {
+		return fmt.Errorf("health endpoint: %w", err)
+	}
+	serviceURL, err := url.Parse(svc.Command)
+	sendHeaders := err == nil && svc.Type != model.ServiceTypeStdio && sameOrigin(req.URL, serviceURL)
+	if sendHeaders && svc.HeadersJSON != "" && svc.HeadersJSON != "{}" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(svc.HeadersJSON), &headers); err != nil {
+			return fmt.Errorf("health endpoint: invalid headers_json: %w", err)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+	}
+	if sendHeaders {
+		// Services behind OAuth authenticate with their current access token, as the MCP transport does
+		authorization, err := oauthAuthorization(ctx, svc)
+		if err != nil {
+			return fmt.Errorf("health endpoint: %w", err)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+	}
+
+	resp, err := healthEndpointClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health endpoint %s: %w", svc.HealthCheckURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxHealthEndpointBodyLen))
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHealthEndpointBodyLen+1))
+	detail := strings.TrimSpace(string(body))
+	if len(detail) > maxHealthEndpointBodyLen {
+		detail = detail[:maxHealthEndpointBodyLen] + "..."
+	}
+	return &healthEndpointError{url: svc.HealthCheckURL, statusCode: resp.StatusCode, body: detail}
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// serviceHookTimeout bounds a single pre-start or post-stop command
+var serviceHookTimeout = 60 * time.Second
+
+// maxHookOutputLen bounds how much hook output is stored in one MCP log entry
+const maxHookOutputLen = 2000
+
+// runServiceHook runs a pre-start or post-stop command of a stdio service with the same effective environment
+// and working directory as the server process, and records its output in the service's MCP logs.
+// svc is the instance config the server was started from, so its DefaultEnvsJSON already holds the merged
+// effective env. hook names the hook in logs and errors ("pre-start" or "post-stop"); an empty command is a no-op.
+// Executables outside the hook command allowlist are refused even if they were stored before the allowlist existed.
+func runServiceHook(ctx context.Context, svc *model.MCPService, hook string, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	command := strings.Join(args, " ")
+	if !common.IsHookCommandAllowed(args[0]) {
+		err := fmt.Errorf("%s command %q refused: %q is not in the hook command allowlist", hook, command, args[0])
+		common.SysError(fmt.Sprintf("Service %s (ID: %d): %v", svc.Name, svc.ID, err))
+		if saveErr := model.SaveMCPLog(context.Background(), svc.ID, svc.Name, model.MCPLogPhaseRun, model.MCPLogLevelError, err.Error()); saveErr != nil {
+			common.SysError(fmt.Sprintf("Failed to save %s hook log for %s: %v", hook, svc.Name, saveErr))
+		}
+		return err
+	}
+	env, workDir, err := instanceProcessEnv(svc)
+	if err != nil {
+		return fmt.Errorf("%s command %q: %w", hook, command, err)
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, serviceHookTimeout)
+	defer cancel()
+	output, runErr := buildStdioCmd(hookCtx, args[0], env, args[1:], workDir).CombinedOutput()
+	detail := strings.TrimSpace(string(output))
+	if len(detail) > maxHookOutputLen {
+		detail = detail[:maxHookOutputLen] + "..."
+	}
+
+	level := model.MCPLogLevelInfo
+	message := fmt.Sprintf("%s command %q finished", hook, command)
+	if runErr != nil {
+		if ctxErr := hookCtx.Err(); ctxErr != nil {
+			runErr = fmt.Errorf("did not finish: %w", ctxErr)
+		}
+		level = model.MCPLogLevelError
+		message = fmt.Sprintf("%s command %q failed: %v", hook, command, runErr)
+	}
+	if detail != "" {
+		message += "\n" + detail
+	}
+	if level == model.MCPLogLevelError {
+		common.SysError(fmt.Sprintf("Service %s (ID: %d): %s", svc.Name, svc.ID, message))
+	} else {
+		common.SysLog(fmt.Sprintf("Service %s (ID: %d): %s", svc.Name, svc.ID, message))
+	}
+	if saveErr := model.SaveMCPLog(context.Background(), svc.ID, svc.Name, model.MCPLogPhaseRun, level, message); saveErr != nil {
+		common.SysError(fmt.Sprintf("Failed to save %s hook log for %s: %v", hook, svc.Name, saveErr))
+	}
+	if runErr != nil {
+		return fmt.Errorf("%s command %q failed: %w", hook, command, runErr)
+	}
+	return nil
+}
+
+// instanceProcessEnv returns the env and working directory of the server process started from the instance
+// config svc. Unlike stdioProcessEnv it takes DefaultEnvsJSON verbatim, since the instance config already
+// carries the effective env (admin defaults, active profile and user overrides merged).
+func instanceProcessEnv(svc *model.MCPService) ([]string, string, error) {
+	var env []string
+	if svc.DefaultEnvsJSON != "" && svc.DefaultEnvsJSON != "{}" {
+		var envs map[string]string
+		if err := json.Unmarshal([]byte(svc.DefaultEnvsJSON), &envs); err != nil {
+			return nil, "", fmt.Errorf("invalid effective env: %w", err)
+		}
+		for key, value := range envs {
+			env = append(env, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	if svc.WorkingDir == "" {
+		return env, "", nil
+	}
+	workDir, err := common.ValidateWorkingDir(svc.WorkingDir)
+	if err != nil {
+		return nil, "", err
+	}
+	return env, workDir, nil
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+)
+
+func TestPreStartHookRunsBeforeServer(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	marker := filepath.Join(t.TempDir(), "prepared")
+	errStopAfterHook := errors.New("stop after the pre-start hook")
+	markerExisted := false
+	originalNewClient := newStdioMCPClient
+	newStdioMCPClient = func(cmd *exec.Cmd, noise *stdoutNoise, clientOpts []mcpclient.ClientOption) (mcpclient.MCPClient, error) {
+		_, err := os.Stat(marker)
+		markerExisted = err == nil
+		return nil, errStopAfterHook
+	}
+	defer func() {
+		common.SQLitePath = originalPath
+		newStdioMCPClient = originalNewClient
+	}()
+
+	svc := &model.MCPService{Name: "pre-start-hook-svc", Type: model.ServiceTypeStdio, Command: "server", PreStartCommand: "touch " + marker}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "pre-start-hook-key", svc, "test", nil)
+	if err == nil || !strings.Contains(err.Error(), errStopAfterHook.Error()) {
+		t.Fatalf("expected the server start to be attempted after the hook, got %v", err)
+	}
+	if !markerExisted {
+		t.Fatal("expected the pre-start command to have run before the server was started")
+	}
+}
+
+func TestFailingPreStartHookAbortsStartup(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	serverStarted := false
+	originalNewClient := newStdioMCPClient
+	newStdioMCPClient = func(cmd *exec.Cmd, noise *stdoutNoise, clientOpts []mcpclient.ClientOption) (mcpclient.MCPClient, error) {
+		serverStarted = true
+		return nil, errors.New("unexpected start")
+	}
+	defer func() {
+		common.SQLitePath = originalPath
+		newStdioMCPClient = originalNewClient
+	}()
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	svc := &model.MCPService{Name: "failing-pre-start-svc", Type: model.ServiceTypeStdio, Command: "server", PreStartCommand: "rm " + missing}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "failing-pre-start-key", svc, "test", nil)
+	if err == nil || !strings.Contains(err.Error(), "pre-start command") {
+		t.Fatalf("expected startup to be aborted by the pre-start command, got %v", err)
+	}
+	if serverStarted {
+		t.Fatal("the server must not be started when the pre-start command fails")
+	}
+
+	name := svc.Name
+	logs, _, err := model.GetMCPLogs(context.Background(), nil, &name, nil, nil, 1, 10)
+	if err != nil {
+		t.Fatalf("GetMCPLogs: %v", err)
+	}
+	found := false
+	for _, log := range logs {
+		if log.Level == model.MCPLogLevelError && strings.Contains(log.Message, "pre-start command") && strings.Contains(log.Message, "missing") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected the failing command and its output in the MCP logs, got %d logs", len(logs))
+	}
+}
+
+func TestPostStopHookRunsOnceAfterShutdown(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	dir := t.TempDir()
+	svc := &model.MCPService{Name: "post-stop-hook-svc", Type: model.ServiceTypeStdio, Command: "server", PostStopCommand: "mkdir " + filepath.Join(dir, "cleaned")}
+	client := &fakeMcpClient{}
+	instance := &SharedMcpInstance{Client: client, serviceName: svc.Name, serviceType: svc.Type, hookService: svc}
+	if err := instance.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if !client.closeCalled.Load() {
+		t.Fatal("expected the client to be closed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cleaned")); err != nil {
+		t.Fatalf("expected the post-stop command to have run: %v", err)
+	}
+	// mkdir 第二次执行会失败；重复 Shutdown 不应再次执行钩子
+	_ = instance.Shutdown(context.Background())
+	name := svc.Name
+	logs, _, err := model.GetMCPLogs(context.Background(), nil, &name, nil, nil, 1, 10)
+	if err != nil {
+		t.Fatalf("GetMCPLogs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Level != model.MCPLogLevelInfo {
+		t.Fatalf("expected a single successful post-stop log, got %+v", logs)
+	}
+}
+
+func TestServiceHookRunsWithEffectiveEnv(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hook.sh")
+	output := filepath.Join(dir, "env.out")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nprintf '%s' \"$HOOK_TOKEN\" > \"$1\"\n"), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	common.OptionMapRWMutex.Lock()
+	originalAllowlist := common.OptionMap[common.OptionHookCommandAllowlist]
+	common.OptionMap[common.OptionHookCommandAllowlist] = common.DefaultHookCommandAllowlist + "," + script
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.SQLitePath = originalPath
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionHookCommandAllowlist] = originalAllowlist
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	// 实例配置的 DefaultEnvsJSON 已是合并后的有效环境变量（此处为用户覆盖后的值）
+	svc := &model.MCPService{Name: "effective-env-hook-svc", Type: model.ServiceTypeStdio, DefaultEnvsJSON: `{"HOOK_TOKEN":"user-value"}`}
+	if err := runServiceHook(context.Background(), svc, "pre-start", []string{script, output}); err != nil {
+		t.Fatalf("runServiceHook: %v", err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("read hook output: %v", err)
+	}
+	if string(got) != "user-value" {
+		t.Fatalf("expected the hook to see the effective env value, got %q", got)
+	}
+}
+
+func TestServiceHookRefusesExecutableOutsideAllowlist(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	// 模拟允许列表生效前保存的钩子：运行时仍需拒绝
+	marker := filepath.Join(t.TempDir(), "created")
+	svc := &model.MCPService{Name: "refused-hook-svc", Type: model.ServiceTypeStdio}
+	err := runServiceHook(context.Background(), svc, "post-stop", []string{"sh", "-c", "touch " + marker})
+	if err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("expected the hook to be refused, got %v", err)
+	}
+	if _, statErr := os.Stat(marker); statErr == nil {
+		t.Fatal("the refused hook must not run")
+	}
+	name := svc.Name
+	logs, _, err := model.GetMCPLogs(context.Background(), nil, &name, nil, nil, 1, 10)
+	if err != nil {
+		t.Fatalf("GetMCPLogs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Level != model.MCPLogLevelError {
+		t.Fatalf("expected one error log for the refused hook, got %+v", logs)
+	}
+}
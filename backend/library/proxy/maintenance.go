@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// maintenanceWindow is the parsed MaintenanceWindow of a service
+type maintenanceWindow struct {
+	start, end time.Time
+}
+
+// serviceMaintenanceWindows 缓存已注册服务的维护窗口（service ID -> maintenanceWindow），在服务注册或刷新配置时更新，
+// 避免每次写入健康状态都查询数据库
+var serviceMaintenanceWindows sync.Map
+
+// cacheServiceMaintenanceWindow 按服务配置更新缓存的维护窗口，未配置或配置无效时移除
+func cacheServiceMaintenanceWindow(svc *model.MCPService) {
+	if svc == nil {
+		return
+	}
+	if start, end, ok := svc.MaintenanceWindowRange(); ok {
+		serviceMaintenanceWindows.Store(svc.ID, maintenanceWindow{start: start, end: end})
+		return
+	}
+	serviceMaintenanceWindows.Delete(svc.ID)
+}
+
+// serviceMaintenanceWindow 返回服务自身配置的维护窗口，测试中可替换
+var serviceMaintenanceWindow = func(serviceID int64) (start, end time.Time, ok bool) {
+	value, ok := serviceMaintenanceWindows.Load(serviceID)
+	if !ok {
+		return start, end, false
+	}
+	window := value.(maintenanceWindow)
+	return window.start, window.end, true
+}
+
+// activeMaintenanceEnd 判断 now 是否处于服务自身或全局的维护窗口内，并返回窗口的结束时间(两者都命中时取较晚者)
+func activeMaintenanceEnd(serviceID int64, now time.Time) (time.Time, bool) {
+	var latestEnd time.Time
+	active := false
+	check := func(start, end time.Time, ok bool) {
+		if ok && !now.Before(start) && now.Before(end) {
+			active = true
+			if end.After(latestEnd) {
+				latestEnd = end
+			}
+		}
+	}
+	check(serviceMaintenanceWindow(serviceID))
+	check(common.GetMaintenanceWindow())
+	return latestEnd, active
+}
+
+// applyMaintenanceOverlay 在维护窗口内返回要缓存的健康状态：检查照常进行，但状态、错误信息和警告级别保持缓存中
+// 窗口开始前的值，实际结果记在 ObservedStatus，避免计划内的停机触发告警。自动重启由 checkHealthLocked 在窗口内跳过。
+// 没有缓存状态时沿用检查结果。
+// 窗口结束后原样返回 health。
+func applyMaintenanceOverlay(serviceID int64, health *ServiceHealth) *ServiceHealth {
+	if health == nil {
+		return nil
+	}
+	end, active := activeMaintenanceEnd(serviceID, time.Now())
+	if !active {
+		return health
+	}
+	pinned := *health
+	pinned.Maintenance = true
+	pinned.MaintenanceUntil = end
+	pinned.ObservedStatus = health.Status
+	if previous, ok := GetHealthCacheManager().GetServiceHealth(serviceID); ok {
+		pinned.Status = previous.Status
+		pinned.ErrorMessage = previous.ErrorMessage
+		pinned.WarningLevel = previous.WarningLevel
+	}
+	return &pinned
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// switchableHealthService 的检查结果可在测试中切换
+type switchableHealthService struct {
+	fakeHealthyService
+	failWith error
+}
+
+func (s *switchableHealthService) CheckHealth(ctx context.Context) (*ServiceHealth, error) {
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+	return s.fakeHealthyService.CheckHealth(ctx)
+}
+
+func TestHealthChecker_MaintenanceWindowPinsStatus(t *testing.T) {
+	serviceID := int64(983001)
+	GetHealthCacheManager().DeleteServiceHealth(serviceID)
+	defer GetHealthCacheManager().DeleteServiceHealth(serviceID)
+	defer GetToolsCacheManager().DeleteServiceTools(serviceID)
+
+	var window [2]time.Time
+	original := serviceMaintenanceWindow
+	serviceMaintenanceWindow = func(id int64) (start, end time.Time, ok bool) {
+		return window[0], window[1], id == serviceID && !window[0].IsZero()
+	}
+	defer func() { serviceMaintenanceWindow = original }()
+
+	hc := NewHealthChecker(time.Hour)
+	svc := &switchableHealthService{fakeHealthyService: fakeHealthyService{id: serviceID, name: "maintained", running: true}}
+	hc.RegisterService(svc)
+
+	health, err := hc.ForceCheckService(serviceID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusHealthy, health.Status)
+	assert.False(t, health.Maintenance)
+
+	// 窗口内检查照常进行，但缓存的状态保持为窗口开始前的 healthy
+	window = [2]time.Time{time.Now().Add(-time.Minute), time.Now().Add(time.Hour)}
+	svc.failWith = errors.New("upstream down for maintenance")
+	for i := 0; i < 2; i++ {
+		health, err = hc.ForceCheckService(serviceID)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusHealthy, health.Status)
+		assert.True(t, health.Maintenance)
+		assert.Equal(t, StatusUnhealthy, health.ObservedStatus)
+		assert.Empty(t, health.ErrorMessage)
+		assert.WithinDuration(t, window[1], health.MaintenanceUntil, time.Second)
+		cached, ok := GetHealthCacheManager().GetServiceHealth(serviceID)
+		if assert.True(t, ok) {
+			assert.Equal(t, StatusHealthy, cached.Status)
+			assert.True(t, cached.Maintenance)
+		}
+	}
+
+	// 窗口结束后恢复正常上报
+	window = [2]time.Time{time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour)}
+	health, err = hc.ForceCheckService(serviceID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusUnhealthy, health.Status)
+	assert.False(t, health.Maintenance)
+	assert.Contains(t, health.ErrorMessage, "upstream down for maintenance")
+}
+
+func TestActiveMaintenanceEndGlobalWindow(t *testing.T) {
+	original := serviceMaintenanceWindow
+	serviceMaintenanceWindow = func(int64) (start, end time.Time, ok bool) { return start, end, false }
+	defer func() { serviceMaintenanceWindow = original }()
+
+	common.OptionMapRWMutex.Lock()
+	originalOption := common.OptionMap[common.OptionMaintenanceWindow]
+	common.OptionMapRWMutex.Unlock()
+	setWindow := func(value string) {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap[common.OptionMaintenanceWindow] = value
+		common.OptionMapRWMutex.Unlock()
+	}
+	defer setWindow(originalOption)
+
+	now := time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		window     string
+		wantActive bool
+	}{
+		{"unset", "", false},
+		{"inside", "2026-10-16T22:00:00Z/2026-10-17T02:00:00Z", true},
+		{"before start", "2026-10-17T00:00:00Z/2026-10-17T02:00:00Z", false},
+		{"after end", "2026-10-16T20:00:00Z/2026-10-16T22:00:00Z", false},
+		{"end before start", "2026-10-17T02:00:00Z/2026-10-16T22:00:00Z", false},
+		{"malformed", "tonight", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setWindow(tt.window)
+			end, active := activeMaintenanceEnd(1, now)
+			assert.Equal(t, tt.wantActive, active)
+			if tt.wantActive {
+				assert.Equal(t, "2026-10-17T02:00:00Z", end.Format(time.RFC3339))
+			}
+		})
+	}
+
+	_, _, err := common.ParseMaintenanceWindow("2026-10-17T02:00:00Z")
+	assert.Error(t, err)
+	_, _, err = common.ParseMaintenanceWindow(fmt.Sprintf("%s/%s", now.Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)))
+	assert.NoError(t, err)
+}
+
+func TestServiceMaintenanceWindowFollowsRegisteredConfig(t *testing.T) {
+	serviceID := int64(983002)
+	defer serviceMaintenanceWindows.Delete(serviceID)
+
+	config := &model.MCPService{Name: "maintained", Type: model.ServiceTypeSSE, MaintenanceWindow: "2026-10-16T22:00:00Z/2026-10-17T02:00:00Z"}
+	config.ID = serviceID
+	svc := NewMonitoredProxiedService(NewBaseService(serviceID, config.Name, model.ServiceTypeSSE), nil, config)
+	start, end, ok := serviceMaintenanceWindow(serviceID)
+	assert.True(t, ok)
+	assert.Equal(t, "2026-10-16T22:00:00Z", start.Format(time.RFC3339))
+	assert.Equal(t, "2026-10-17T02:00:00Z", end.Format(time.RFC3339))
+
+	// 刷新配置后使用新的窗口，无需查询数据库
+	updated := *config
+	updated.MaintenanceWindow = ""
+	svc.UpdateDBConfig(&updated)
+	_, _, ok = serviceMaintenanceWindow(serviceID)
+	assert.False(t, ok)
+}
@@ -14,7 +14,7 @@ import (
 )
 
 var (
-	// ErrServiceAlreadyExists 表示服务已经存在
+	// ErrServiceAlreadyExists 表示服务已经存在 (RegisterService 会协调已注册的服务，不再返回该错误)
 	ErrServiceAlreadyExists = errors.New("service already exists")
 	// ErrServiceNotFound 表示服务不存在
 	ErrServiceNotFound = errors.New("service not found")
@@ -31,6 +31,7 @@ type ServiceManager struct {
 	healthChecker            *HealthChecker
 	initialized              bool
 	lastAccessed             map[int64]time.Time
+	accessMu                 sync.RWMutex // 保护 lastAccessed，与 mutex 分开，代理请求记录访问时间不与服务管理争用
 	stdioOnDemandIdleTimeout time.Duration
 }
 
@@ -105,8 +106,10 @@ func (m *ServiceManager) Initialize(ctx context.Context) error {
 
 // Shutdown 关闭服务管理器
 func (m *ServiceManager) Shutdown(ctx context.Context) error {
-	// Note: HealthChecker doesn't run a separate daemon anymore, so no need to stop it.
+	// HealthChecker doesn't run a separate daemon anymore, but background checks may still be
+	// waiting for a concurrency slot; stopping it releases them instead of leaving them blocked.
 	// The StartDaemon goroutine will naturally terminate when the program exits.
+	m.healthChecker.Stop()
 
 	// 停止所有服务
 	m.mutex.Lock()
@@ -128,18 +131,34 @@ func (m *ServiceManager) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-// RegisterService 注册一个服务到管理器
+// serviceFactoryFunc creates the runtime service for a DB record; mockable in tests
+var serviceFactoryFunc = ServiceFactory
+
+// seedServiceHealth publishes the initial health of a newly registered service to the health cache; mockable in tests
+var seedServiceHealth = func(m *ServiceManager, serviceID int64) error {
+	return m.UpdateMCPServiceHealth(serviceID)
+}
+
+// RegisterService 注册一个服务到管理器。
+// 重复注册同一服务是幂等的：已注册的实例会与最新的数据库配置协调，而不是报错或重复创建；
+// 注册中途失败时会回滚已创建的实例和缓存，便于直接重试。
 func (m *ServiceManager) RegisterService(ctx context.Context, mcpService *model.MCPService) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	// 检查服务是否已经存在
-	if _, exists := m.services[mcpService.ID]; exists {
-		return ErrServiceAlreadyExists
+	// 已存在：协调而不是报错
+	if existing, exists := m.services[mcpService.ID]; exists {
+		if existing.Type() == mcpService.Type {
+			m.reconcileRegisteredServiceLocked(ctx, existing, mcpService)
+			return nil
+		}
+		// 类型变化无法原地协调，丢弃旧实例后重新注册
+		log.Printf("Service %s (ID: %d) changed type from %s to %s, re-creating instance", mcpService.Name, mcpService.ID, existing.Type(), mcpService.Type)
+		m.discardServiceLocked(ctx, mcpService.ID, existing)
 	}
 
 	// 创建服务实例
-	service, err := ServiceFactory(mcpService)
+	service, err := serviceFactoryFunc(mcpService)
 	if err != nil {
 		return fmt.Errorf("failed to create service instance: %w", err)
 	}
@@ -150,6 +169,12 @@ func (m *ServiceManager) RegisterService(ctx context.Context, mcpService *model.
 	// Register to health checker
 	m.healthChecker.RegisterService(service)
 
+	if err := seedServiceHealth(m, mcpService.ID); err != nil {
+		// Roll back so a retry starts from a clean state
+		m.discardServiceLocked(ctx, mcpService.ID, service)
+		return fmt.Errorf("failed to publish initial health for service %s (ID: %d): %w", mcpService.Name, mcpService.ID, err)
+	}
+
 	// Start service if it's enabled and default on (always start stdio services regardless of strategy)
 	if mcpService.DefaultOn && mcpService.Enabled {
 		if err := service.Start(ctx); err != nil {
@@ -176,16 +201,23 @@ func (m *ServiceManager) RegisterService(ctx context.Context, mcpService *model.
 	return nil
 }
 
-// UnregisterService 从管理器移除一个服务
-func (m *ServiceManager) UnregisterService(ctx context.Context, serviceID int64) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+// reconcileRegisteredServiceLocked 将已注册的服务与最新的数据库配置对齐（调用方需持有 m.mutex）
+func (m *ServiceManager) reconcileRegisteredServiceLocked(ctx context.Context, existing Service, mcpService *model.MCPService) {
+	if monitored, ok := existing.(*MonitoredProxiedService); ok {
+		monitored.UpdateDBConfig(mcpService)
+	}
+	// 健康检查器注册是幂等的，补齐上一次可能缺失的注册
+	m.healthChecker.RegisterService(existing)
 
-	service, exists := m.services[serviceID]
-	if !exists {
-		return ErrServiceNotFound
+	if mcpService.DefaultOn && mcpService.Enabled && !existing.IsRunning() {
+		if err := existing.Start(ctx); err != nil {
+			log.Printf("Failed to start already registered service %s (ID: %d): %v", mcpService.Name, mcpService.ID, err)
+		}
 	}
+}
 
+// discardServiceLocked 停止服务并清理所有注册状态（调用方需持有 m.mutex）
+func (m *ServiceManager) discardServiceLocked(ctx context.Context, serviceID int64, service Service) {
 	// Always stop the service to ensure thorough cleanup (don't rely on IsRunning() check)
 	// Add timeout control for stop operation to prevent hanging in container environments
 	stopCtx, stopCancel := context.WithTimeout(ctx, 15*time.Second)
@@ -202,10 +234,26 @@ func (m *ServiceManager) UnregisterService(ctx context.Context, serviceID int64)
 	// 从健康状态缓存中移除
 	cacheManager := GetHealthCacheManager()
 	cacheManager.DeleteServiceHealth(serviceID)
+	serviceMaintenanceWindows.Delete(serviceID)
 
 	// 从服务列表中移除
 	delete(m.services, serviceID)
+	m.accessMu.Lock()
+	delete(m.lastAccessed, serviceID)
+	m.accessMu.Unlock()
+}
+
+// UnregisterService 从管理器移除一个服务
+func (m *ServiceManager) UnregisterService(ctx context.Context, serviceID int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
+	service, exists := m.services[serviceID]
+	if !exists {
+		return ErrServiceNotFound
+	}
+
+	m.discardServiceLocked(ctx, serviceID, service)
 	return nil
 }
 
@@ -222,11 +270,44 @@ func (m *ServiceManager) GetService(serviceID int64) (Service, error) {
 	return service, nil
 }
 
-// UpdateServiceAccessTime 更新服务的最后访问时间
+// accessTimeGranularity 返回访问时间的记录粒度，最多为闲置超时的一半，保证持续访问的服务不会被判定为闲置
+func (m *ServiceManager) accessTimeGranularity() time.Duration {
+	granularity := parseDurationOption(common.OptionAccessTimeGranularity, 30*time.Second)
+	if limit := m.stdioOnDemandIdleTimeout / 2; granularity > limit {
+		granularity = limit
+	}
+	return granularity
+}
+
+// UpdateServiceAccessTime 更新服务的最后访问时间；记录的时间距今不到 AccessTimeGranularity 时不更新，
+// 热点服务的请求只需读锁
 func (m *ServiceManager) UpdateServiceAccessTime(serviceID int64) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	m.lastAccessed[serviceID] = time.Now()
+	now := time.Now()
+	granularity := m.accessTimeGranularity()
+	if granularity > 0 {
+		m.accessMu.RLock()
+		last, exists := m.lastAccessed[serviceID]
+		m.accessMu.RUnlock()
+		if exists && now.Sub(last) < granularity {
+			return
+		}
+	}
+	m.accessMu.Lock()
+	defer m.accessMu.Unlock()
+	if last, exists := m.lastAccessed[serviceID]; !exists || now.After(last) {
+		m.lastAccessed[serviceID] = now
+	}
+}
+
+// serviceIdleFor 返回服务自最后一次记录的访问以来的时长，没有访问记录时返回 false
+func (m *ServiceManager) serviceIdleFor(serviceID int64) (time.Duration, bool) {
+	m.accessMu.RLock()
+	last, exists := m.lastAccessed[serviceID]
+	m.accessMu.RUnlock()
+	if !exists {
+		return 0, false
+	}
+	return time.Since(last), true
 }
 
 // StartService 启动一个服务
@@ -289,6 +370,32 @@ func (m *ServiceManager) RestartService(ctx context.Context, serviceID int64) er
 	return nil
 }
 
+// RestartEnvironmentProfiledServices 重启默认环境变量按环境 profile 配置且正在运行的服务，
+// 使其按新的 ActiveEnvironment 启动（用户实例随之停止，下次请求时重建），返回重启的服务数量
+func (m *ServiceManager) RestartEnvironmentProfiledServices(ctx context.Context) int {
+	services, err := model.GetEnabledServices()
+	if err != nil {
+		common.SysError(fmt.Sprintf("Failed to load services for active environment change: %v", err))
+		return 0
+	}
+	restarted := 0
+	for _, mcpService := range services {
+		if !mcpService.HasEnvironmentProfiles() {
+			continue
+		}
+		service, err := m.GetService(mcpService.ID)
+		if err != nil || !service.IsRunning() {
+			continue
+		}
+		if err := m.RestartService(ctx, mcpService.ID); err != nil {
+			common.SysError(fmt.Sprintf("Failed to restart service %s (ID: %d) for active environment change: %v", mcpService.Name, mcpService.ID, err))
+			continue
+		}
+		restarted++
+	}
+	return restarted
+}
+
 // GetServiceHealth 获取服务的健康状态
 func (m *ServiceManager) GetServiceHealth(serviceID int64) (*ServiceHealth, error) {
 	return m.healthChecker.GetServiceHealth(serviceID)
@@ -309,6 +416,18 @@ func (m *ServiceManager) UpdateServiceConfig(serviceID int64, config map[string]
 	return service.UpdateConfig(config)
 }
 
+// RefreshServiceDBConfig 将最新的数据库配置同步到已注册的服务（不重启实例）
+func (m *ServiceManager) RefreshServiceDBConfig(mcpService *model.MCPService) error {
+	service, err := m.GetService(mcpService.ID)
+	if err != nil {
+		return err
+	}
+	if monitored, ok := service.(*MonitoredProxiedService); ok {
+		monitored.UpdateDBConfig(mcpService)
+	}
+	return nil
+}
+
 // GetAllServices 获取所有服务
 func (m *ServiceManager) GetAllServices() []Service {
 	m.mutex.RLock()
@@ -357,7 +476,7 @@ func (m *ServiceManager) UpdateMCPServiceHealth(serviceID int64) error {
 	cacheManager := GetHealthCacheManager()
 
 	// 将健康状态存储到缓存中
-	cacheManager.SetServiceHealth(serviceID, health)
+	cacheManager.SetServiceHealth(serviceID, applyMaintenanceOverlay(serviceID, health))
 
 	return nil
 }
@@ -391,10 +510,6 @@ func (m *ServiceManager) performHealthCheckAndManagement() {
 	for _, service := range m.services {
 		services = append(services, service)
 	}
-	lastAccessedCopy := make(map[int64]time.Time)
-	for k, v := range m.lastAccessed {
-		lastAccessedCopy[k] = v
-	}
 	m.mutex.RUnlock()
 
 	for _, service := range services {
@@ -403,14 +518,14 @@ func (m *ServiceManager) performHealthCheckAndManagement() {
 			strategy := common.OptionMap[common.OptionStdioServiceStartupStrategy]
 			if strategy == common.StrategyStartOnDemand && service.IsRunning() {
 				// Check for idle timeout
-				if lastAccess, exists := lastAccessedCopy[service.ID()]; exists {
-					if time.Since(lastAccess) > m.stdioOnDemandIdleTimeout {
+				if idleFor, exists := m.serviceIdleFor(service.ID()); exists {
+					if idleFor > m.stdioOnDemandIdleTimeout {
 						ctx := context.Background()
 						if err := m.StopService(ctx, service.ID()); err != nil {
 							log.Printf("Failed to stop idle stdio service %s (ID: %d): %v", service.Name(), service.ID(), err)
 						} else {
 							log.Printf("Stopped idle stdio service: %s (ID: %d) after %v of inactivity",
-								service.Name(), service.ID(), time.Since(lastAccess))
+								service.Name(), service.ID(), idleFor)
 							if _, err := m.healthChecker.ForceCheckService(service.ID()); err != nil {
 								log.Printf("Failed to refresh health after stopping idle stdio service %s (ID: %d): %v", service.Name(), service.ID(), err)
 							}
@@ -448,6 +563,9 @@ func (m *ServiceManager) performHealthCheckAndManagement() {
 			shouldAutoRestart = false
 			log.Printf("Skipping auto-restart for disabled service: %s (ID: %d)", service.Name(), service.ID())
 		}
+		if currentService.DisableSelfHealing || health.Maintenance {
+			shouldAutoRestart = false
+		}
 
 		if shouldAutoRestart && health.Status == StatusStopped {
 			ctx := context.Background()
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setAccessTimeGranularity(t *testing.T, value string) {
+	common.OptionMapRWMutex.Lock()
+	original, hadOriginal := common.OptionMap[common.OptionAccessTimeGranularity]
+	common.OptionMap[common.OptionAccessTimeGranularity] = value
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		if hadOriginal {
+			common.OptionMap[common.OptionAccessTimeGranularity] = original
+		} else {
+			delete(common.OptionMap, common.OptionAccessTimeGranularity)
+		}
+		common.OptionMapRWMutex.Unlock()
+	})
+}
+
+func TestUpdateServiceAccessTimeThrottled(t *testing.T) {
+	setAccessTimeGranularity(t, "40ms")
+	manager := newTestServiceManager()
+	manager.stdioOnDemandIdleTimeout = 150 * time.Millisecond
+	const serviceID = int64(982001)
+
+	_, exists := manager.serviceIdleFor(serviceID)
+	assert.False(t, exists)
+
+	manager.UpdateServiceAccessTime(serviceID)
+	first := manager.lastAccessed[serviceID]
+	manager.UpdateServiceAccessTime(serviceID)
+	assert.Equal(t, first, manager.lastAccessed[serviceID], "updates within the granularity are skipped")
+
+	// A service accessed continuously never looks idle
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		manager.UpdateServiceAccessTime(serviceID)
+		idleFor, exists := manager.serviceIdleFor(serviceID)
+		assert.True(t, exists)
+		assert.Less(t, idleFor, manager.stdioOnDemandIdleTimeout)
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.True(t, manager.lastAccessed[serviceID].After(first), "the access time advances once the granularity elapsed")
+
+	// Once requests stop the service becomes idle
+	time.Sleep(manager.stdioOnDemandIdleTimeout)
+	idleFor, _ := manager.serviceIdleFor(serviceID)
+	assert.Greater(t, idleFor, manager.stdioOnDemandIdleTimeout)
+}
+
+func TestAccessTimeGranularity(t *testing.T) {
+	manager := newTestServiceManager()
+	manager.stdioOnDemandIdleTimeout = 10 * time.Minute
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 30 * time.Second},
+		{"0", 0},
+		{"5", 5 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"1h", 5 * time.Minute}, // capped at half the idle timeout
+		{"-1s", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			setAccessTimeGranularity(t, tt.value)
+			assert.Equal(t, tt.want, manager.accessTimeGranularity())
+		})
+	}
+
+	// "0" records every request
+	setAccessTimeGranularity(t, "0")
+	manager.UpdateServiceAccessTime(982002)
+	first := manager.lastAccessed[982002]
+	time.Sleep(time.Millisecond)
+	manager.UpdateServiceAccessTime(982002)
+	assert.True(t, manager.lastAccessed[982002].After(first))
+}
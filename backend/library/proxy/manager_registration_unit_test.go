@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"one-mcp/backend/model"
+)
+
+func newTestServiceManager() *ServiceManager {
+	return &ServiceManager{
+		services:      make(map[int64]Service),
+		healthChecker: NewHealthChecker(10 * time.Minute),
+		lastAccessed:  make(map[int64]time.Time),
+	}
+}
+
+func TestRegisterServiceIdempotentAndRetryable(t *testing.T) {
+	originalFactory, originalSeed := serviceFactoryFunc, seedServiceHealth
+	defer func() { serviceFactoryFunc, seedServiceHealth = originalFactory, originalSeed }()
+
+	factoryCalls := 0
+	serviceFactoryFunc = func(svc *model.MCPService) (Service, error) {
+		factoryCalls++
+		return NewBaseService(svc.ID, svc.Name, svc.Type), nil
+	}
+
+	tests := []struct {
+		name          string
+		seedFailures  int // number of leading registrations whose health seeding fails
+		registrations int
+		wantErrs      []bool
+		wantFactory   int
+	}{
+		{"double registration reconciles", 0, 2, []bool{false, false}, 1},
+		{"failure then retry", 1, 2, []bool{true, false}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factoryCalls = 0
+			seedCalls := 0
+			seedServiceHealth = func(m *ServiceManager, serviceID int64) error {
+				seedCalls++
+				if seedCalls <= tt.seedFailures {
+					return errors.New("health cache unavailable")
+				}
+				return m.UpdateMCPServiceHealth(serviceID)
+			}
+
+			manager := newTestServiceManager()
+			svc := &model.MCPService{Name: "idempotent", Type: model.ServiceTypeSSE, Enabled: true, DefaultOn: true}
+			svc.ID = 4242
+			defer func() { _ = manager.UnregisterService(context.Background(), svc.ID) }()
+
+			for i := 0; i < tt.registrations; i++ {
+				err := manager.RegisterService(context.Background(), svc)
+				if gotErr := err != nil; gotErr != tt.wantErrs[i] {
+					t.Fatalf("registration %d: err = %v, want error %v", i, err, tt.wantErrs[i])
+				}
+				if err != nil {
+					// A failed registration leaves nothing behind
+					if _, getErr := manager.GetService(svc.ID); !errors.Is(getErr, ErrServiceNotFound) {
+						t.Fatalf("registration %d: expected rollback, service still registered", i)
+					}
+					if _, healthErr := manager.GetServiceHealth(svc.ID); !errors.Is(healthErr, ErrServiceNotRegistered) {
+						t.Fatalf("registration %d: expected health checker rollback, got %v", i, healthErr)
+					}
+				}
+			}
+
+			if factoryCalls != tt.wantFactory {
+				t.Fatalf("factory calls = %d, want %d", factoryCalls, tt.wantFactory)
+			}
+			if got := len(manager.GetAllServices()); got != 1 {
+				t.Fatalf("registered services = %d, want 1", got)
+			}
+			registered, err := manager.GetService(svc.ID)
+			if err != nil || !registered.IsRunning() {
+				t.Fatalf("expected running registered service, got %v (err %v)", registered, err)
+			}
+			if _, ok := GetHealthCacheManager().GetServiceHealth(svc.ID); !ok {
+				t.Fatal("expected initial health in the health cache")
+			}
+		})
+	}
+}
+
+func TestRegisterServiceRecreatesOnTypeChange(t *testing.T) {
+	originalFactory := serviceFactoryFunc
+	defer func() { serviceFactoryFunc = originalFactory }()
+	serviceFactoryFunc = func(svc *model.MCPService) (Service, error) {
+		return NewBaseService(svc.ID, svc.Name, svc.Type), nil
+	}
+
+	manager := newTestServiceManager()
+	svc := &model.MCPService{Name: "retyped", Type: model.ServiceTypeSSE, Enabled: true}
+	svc.ID = 4243
+	defer func() { _ = manager.UnregisterService(context.Background(), svc.ID) }()
+
+	if err := manager.RegisterService(context.Background(), svc); err != nil {
+		t.Fatalf("first registration: %v", err)
+	}
+	svc.Type = model.ServiceTypeStreamableHTTP
+	if err := manager.RegisterService(context.Background(), svc); err != nil {
+		t.Fatalf("re-registration: %v", err)
+	}
+	registered, err := manager.GetService(svc.ID)
+	if err != nil || registered.Type() != model.ServiceTypeStreamableHTTP {
+		t.Fatalf("expected re-created streamable HTTP service, got %v (err %v)", registered, err)
+	}
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+)
+
+// ErrCommandNotFound indicates the command of a stdio service could not be found when starting it, typically
+// because the npm/uv cache was cleared or the installed binary was removed after installation.
+var ErrCommandNotFound = errors.New("package no longer available, reinstall needed")
+
+// shellCommandNotFoundExitCode is the exit status shells and launchers such as npx use when the
+// command they were asked to run does not exist.
+const shellCommandNotFoundExitCode = 127
+
+// isMissingCommandError reports whether starting cmd failed because its executable does not exist,
+// either before the process started (startErr) or because the launcher exited with status 127.
+func isMissingCommandError(startErr error, cmd *exec.Cmd) bool {
+	if startErr != nil && (errors.Is(startErr, exec.ErrNotFound) || errors.Is(startErr, fs.ErrNotExist)) {
+		return true
+	}
+	return cmd != nil && cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == shellCommandNotFoundExitCode
+}
+
+// missingCommandError builds the error reported when the command of a stdio service is gone
+func missingCommandError(serviceName, instanceNameDetail, command string, cause error) error {
+	return fmt.Errorf("%w: command %q of service %s (%s) could not be found (%v); reinstall the service to restore it",
+		ErrCommandNotFound, command, serviceName, instanceNameDetail, cause)
+}
+
+// healthStatusForError returns the health status reported for a failed health check or start
+func healthStatusForError(err error) ServiceStatus {
+	if errors.Is(err, ErrCommandNotFound) {
+		return StatusNeedsReinstall
+	}
+	return StatusUnhealthy
+}
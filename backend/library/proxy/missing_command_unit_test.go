@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+func TestCreateMcpClientReportsMissingCommand(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	tests := []struct {
+		name    string
+		command string
+		args    string
+		needSh  bool
+	}{
+		{"absolute path removed", filepath.Join(t.TempDir(), "removed-mcp-server"), "", false},
+		{"not on PATH", "one-mcp-no-such-binary-964", "", false},
+		{"launcher exits with 127", "sh", `["-c", "echo 'sh: 1: mcp-server: not found' >&2; exit 127"]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath("sh"); tt.needSh && err != nil {
+				t.Skip("sh not available")
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			svc := &model.MCPService{Name: "missing-command-svc", Type: model.ServiceTypeStdio, Command: tt.command, ArgsJSON: tt.args}
+			_, _, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "missing-command-key", svc, "test", nil)
+			if !errors.Is(err, ErrCommandNotFound) {
+				t.Fatalf("expected ErrCommandNotFound, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "reinstall") || !strings.Contains(err.Error(), tt.command) {
+				t.Fatalf("expected a reinstall hint naming %q, got %v", tt.command, err)
+			}
+			if status := healthStatusForError(err); status != StatusNeedsReinstall {
+				t.Fatalf("expected status %s, got %s", StatusNeedsReinstall, status)
+			}
+		})
+	}
+}
+
+func TestMonitoredProxiedServiceReportsNeedsReinstall(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	dbConfig := &model.MCPService{Name: "missing-binary-svc", Type: model.ServiceTypeStdio, Enabled: true, Command: filepath.Join(t.TempDir(), "gone")}
+	dbConfig.ID = 964101
+	svc := NewMonitoredProxiedService(NewBaseService(dbConfig.ID, dbConfig.Name, model.ServiceTypeStdio), nil, dbConfig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	health, err := svc.CheckHealth(ctx)
+	if !errors.Is(err, ErrCommandNotFound) {
+		t.Fatalf("expected ErrCommandNotFound, got %v", err)
+	}
+	if health.Status != StatusNeedsReinstall {
+		t.Fatalf("expected status %s, got %s (%s)", StatusNeedsReinstall, health.Status, health.ErrorMessage)
+	}
+}
@@ -0,0 +1,353 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+var (
+	// ErrOAuthAuthorizationRequired indicates the service has no usable token and an admin has to complete the
+	// device flow (POST /api/mcp_services/:id/oauth/start, then /complete)
+	ErrOAuthAuthorizationRequired = errors.New("oauth authorization required")
+	// ErrOAuthAuthorizationPending indicates the user has not yet approved the device flow
+	ErrOAuthAuthorizationPending = errors.New("oauth authorization pending")
+	// ErrUpstreamUnauthorized indicates the upstream answered 401 to the credentials of the instance
+	ErrUpstreamUnauthorized = errors.New("upstream rejected the credentials (401)")
+)
+
+const oauthDeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// oauthHTTPClient sends the requests to token and device authorization endpoints
+var oauthHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// oauthTokenMu serializes token fetches and refreshes, so concurrent instance creations share one new token
+var oauthTokenMu sync.Mutex
+
+// oauthEndpointError is an error response (RFC 6749 section 5.2) of a token or device authorization endpoint
+type oauthEndpointError struct {
+	Status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthEndpointError) Error() string {
+	msg := fmt.Sprintf("oauth endpoint returned status %d", e.Status)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Description != "" {
+		msg += " (" + e.Description + ")"
+	}
+	return msg
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type oauthDeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// postOAuthForm posts form with the client credentials of config to endpoint and decodes the JSON answer into out
+func postOAuthForm(ctx context.Context, endpoint string, config *model.ServiceOAuthConfig, form url.Values, out any) error {
+	form.Set("client_id", config.ClientID)
+	if config.ClientSecret != "" {
+		form.Set("client_secret", config.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := oauthHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		endpointErr := &oauthEndpointError{Status: resp.StatusCode}
+		_ = json.Unmarshal(body, endpointErr)
+		return endpointErr
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid oauth endpoint response: %w", err)
+	}
+	return nil
+}
+
+// requestOAuthToken asks the token endpoint of config for a token with the given grant and stores it in record
+func requestOAuthToken(ctx context.Context, config *model.ServiceOAuthConfig, form url.Values, record *model.ServiceOAuthToken) error {
+	if config.Scope != "" && form.Get("grant_type") != "refresh_token" {
+		form.Set("scope", config.Scope)
+	}
+	if config.Audience != "" {
+		form.Set("audience", config.Audience)
+	}
+	var token oauthTokenResponse
+	if err := postOAuthForm(ctx, config.TokenURL, config, form, &token); err != nil {
+		return err
+	}
+	if token.AccessToken == "" {
+		return errors.New("oauth token endpoint returned no access_token")
+	}
+	record.AccessToken = token.AccessToken
+	record.TokenType = token.TokenType
+	record.ExpiresAt = time.Time{}
+	if token.ExpiresIn > 0 {
+		record.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	// 未返回新的 refresh token 时沿用原来的
+	if token.RefreshToken != "" {
+		record.RefreshToken = token.RefreshToken
+	}
+	return nil
+}
+
+// loadServiceOAuthToken returns the token record of the service, or a new unsaved one
+func loadServiceOAuthToken(serviceID int64) (*model.ServiceOAuthToken, error) {
+	record, err := model.GetServiceOAuthToken(serviceID)
+	if errors.Is(err, model.ErrRecordNotFound) {
+		return &model.ServiceOAuthToken{ServiceID: serviceID}, nil
+	}
+	return record, err
+}
+
+// serviceAccessToken returns a usable token record of the service: the stored one, or a refreshed or newly
+// fetched one when it expired or forceRefresh is set. Device flow services without a refresh token need an
+// admin to authorize them first (ErrOAuthAuthorizationRequired).
+func serviceAccessToken(ctx context.Context, svc *model.MCPService, config *model.ServiceOAuthConfig, forceRefresh bool) (*model.ServiceOAuthToken, error) {
+	oauthTokenMu.Lock()
+	defer oauthTokenMu.Unlock()
+
+	record, err := loadServiceOAuthToken(svc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !forceRefresh && record.Usable(time.Now()) {
+		return record, nil
+	}
+	if record.RefreshToken != "" {
+		refreshErr := requestOAuthToken(ctx, config, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {record.RefreshToken}}, record)
+		if refreshErr == nil {
+			common.SysLog(fmt.Sprintf("Refreshed OAuth token of service %s (ID: %d)", svc.Name, svc.ID))
+			return record, model.SaveServiceOAuthToken(record)
+		}
+		common.SysError(fmt.Sprintf("Failed to refresh OAuth token of service %s (ID: %d): %v", svc.Name, svc.ID, refreshErr))
+		record.RefreshToken = ""
+	}
+	if config.GrantType != model.OAuthGrantClientCredentials {
+		record.AccessToken = ""
+		if saveErr := model.SaveServiceOAuthToken(record); saveErr != nil {
+			common.SysError(fmt.Sprintf("Failed to clear OAuth token of service %s (ID: %d): %v", svc.Name, svc.ID, saveErr))
+		}
+		return nil, fmt.Errorf("%w: service %s has no valid token, complete the device flow via /api/mcp_services/%d/oauth/start", ErrOAuthAuthorizationRequired, svc.Name, svc.ID)
+	}
+	if err := requestOAuthToken(ctx, config, url.Values{"grant_type": {model.OAuthGrantClientCredentials}}, record); err != nil {
+		return nil, fmt.Errorf("failed to get OAuth token for service %s: %w", svc.Name, err)
+	}
+	common.SysLog(fmt.Sprintf("Obtained OAuth token of service %s (ID: %d)", svc.Name, svc.ID))
+	return record, model.SaveServiceOAuthToken(record)
+}
+
+// ensureOAuthToken makes sure a service configured with OAuth has a usable access token before an instance
+// connects, refreshing it first when forceRefresh is set. Other services are left unchanged. The token is sent
+// by the header function of upstreamHeaderFunc, not stored in svc.HeadersJSON.
+func ensureOAuthToken(ctx context.Context, svc *model.MCPService, forceRefresh bool) error {
+	config, err := svc.OAuthConfig()
+	if err != nil || config == nil {
+		return err
+	}
+	_, err = serviceAccessToken(ctx, svc, config, forceRefresh)
+	return err
+}
+
+// oauthAuthorizationValue returns the Authorization header value of a token record
+func oauthAuthorizationValue(record *model.ServiceOAuthToken) string {
+	tokenType := record.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + record.AccessToken
+}
+
+// oauthAuthorization returns the Authorization header value with the current access token of a service
+// configured with OAuth, or "" for other services
+func oauthAuthorization(ctx context.Context, svc *model.MCPService) (string, error) {
+	config, err := svc.OAuthConfig()
+	if err != nil || config == nil {
+		return "", err
+	}
+	record, err := serviceAccessToken(ctx, svc, config, false)
+	if err != nil {
+		return "", err
+	}
+	return oauthAuthorizationValue(record), nil
+}
+
+// upstreamHeaderFunc returns the header function of the HTTP transports of an instance of svc: the
+// correlationHeaders and, for a service configured with OAuth, its access token. The token is kept while it is
+// usable and refreshed shortly before it expires, so a long-lived instance does not wait for the upstream to
+// reject it. Each instance gets its own function, so a re-created instance starts from the stored token.
+func upstreamHeaderFunc(svc *model.MCPService) func(ctx context.Context) map[string]string {
+	config, err := svc.OAuthConfig()
+	if err != nil || config == nil {
+		return correlationHeaders
+	}
+	serviceConfig := *svc // shallow copy, the header function outlives the caller's config
+	var (
+		mu     sync.Mutex
+		record *model.ServiceOAuthToken
+	)
+	return func(ctx context.Context) map[string]string {
+		headers := map[string]string{}
+		for key, value := range correlationHeaders(ctx) {
+			headers[key] = value
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if record == nil || !record.Usable(time.Now()) {
+			fresh, err := serviceAccessToken(ctx, &serviceConfig, config, false)
+			if err != nil {
+				// The upstream rejects the request then, which re-creates the instance through the 401 path
+				common.SysError(fmt.Sprintf("Failed to get OAuth token of service %s (ID: %d): %v", serviceConfig.Name, serviceConfig.ID, err))
+			} else {
+				record = fresh
+			}
+		}
+		if record != nil {
+			headers["Authorization"] = oauthAuthorizationValue(record)
+		}
+		return headers
+	}
+}
+
+// expireServiceOAuthToken marks the stored access token of the service as expired after the upstream rejected
+// it, so the next instance creation refreshes it. It reports whether the service has a token.
+func expireServiceOAuthToken(serviceID int64) bool {
+	oauthTokenMu.Lock()
+	defer oauthTokenMu.Unlock()
+	record, err := model.GetServiceOAuthToken(serviceID)
+	if err != nil || record.AccessToken == "" {
+		return false
+	}
+	record.ExpiresAt = time.Now().Add(-time.Second)
+	if err := model.SaveServiceOAuthToken(record); err != nil {
+		common.SysError(fmt.Sprintf("Failed to expire OAuth token of service %d: %v", serviceID, err))
+	}
+	return true
+}
+
+// StartServiceOAuth starts the authorization of a service configured with OAuth. Client credentials services
+// get a new token right away; device flow services get a user code to approve at the verification URI, after
+// which CompleteServiceOAuth obtains the token.
+func StartServiceOAuth(ctx context.Context, svc *model.MCPService) (*model.ServiceOAuthToken, error) {
+	config, err := svc.OAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("service %s has no oauth configuration", svc.Name)
+	}
+	if config.GrantType == model.OAuthGrantClientCredentials {
+		return serviceAccessToken(ctx, svc, config, true)
+	}
+
+	form := url.Values{}
+	if config.Scope != "" {
+		form.Set("scope", config.Scope)
+	}
+	if config.Audience != "" {
+		form.Set("audience", config.Audience)
+	}
+	var device oauthDeviceAuthorizationResponse
+	if err := postOAuthForm(ctx, config.DeviceAuthorizationURL, config, form, &device); err != nil {
+		return nil, fmt.Errorf("failed to start device authorization for service %s: %w", svc.Name, err)
+	}
+	if device.DeviceCode == "" || device.UserCode == "" {
+		return nil, errors.New("device authorization endpoint returned no device_code or user_code")
+	}
+
+	oauthTokenMu.Lock()
+	defer oauthTokenMu.Unlock()
+	record, err := loadServiceOAuthToken(svc.ID)
+	if err != nil {
+		return nil, err
+	}
+	record.DeviceCode = device.DeviceCode
+	record.UserCode = device.UserCode
+	record.VerificationURI = device.VerificationURI
+	if device.VerificationURIComplete != "" {
+		record.VerificationURI = device.VerificationURIComplete
+	}
+	record.DeviceCodeExpiresAt = time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	record.PollInterval = device.Interval
+	return record, model.SaveServiceOAuthToken(record)
+}
+
+// CompleteServiceOAuth polls the token endpoint once for the device flow started by StartServiceOAuth. It
+// returns ErrOAuthAuthorizationPending while the user has not approved it yet.
+func CompleteServiceOAuth(ctx context.Context, svc *model.MCPService) (*model.ServiceOAuthToken, error) {
+	config, err := svc.OAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.GrantType != model.OAuthGrantDeviceCode {
+		return nil, fmt.Errorf("service %s does not use the oauth device flow", svc.Name)
+	}
+
+	oauthTokenMu.Lock()
+	defer oauthTokenMu.Unlock()
+	record, err := loadServiceOAuthToken(svc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if record.DeviceCode == "" {
+		return nil, fmt.Errorf("no device authorization in progress for service %s, start one first", svc.Name)
+	}
+	clearDeviceFlow := func() {
+		record.DeviceCode, record.UserCode, record.VerificationURI = "", "", ""
+		record.DeviceCodeExpiresAt, record.PollInterval = time.Time{}, 0
+	}
+	if !record.DeviceCodeExpiresAt.IsZero() && time.Now().After(record.DeviceCodeExpiresAt) {
+		clearDeviceFlow()
+		return nil, errors.Join(fmt.Errorf("device authorization of service %s expired, start a new one", svc.Name), model.SaveServiceOAuthToken(record))
+	}
+
+	err = requestOAuthToken(ctx, config, url.Values{"grant_type": {oauthDeviceCodeGrantType}, "device_code": {record.DeviceCode}}, record)
+	var endpointErr *oauthEndpointError
+	if errors.As(err, &endpointErr) && (endpointErr.Code == "authorization_pending" || endpointErr.Code == "slow_down") {
+		return record, ErrOAuthAuthorizationPending
+	}
+	if err != nil {
+		clearDeviceFlow()
+		return nil, errors.Join(fmt.Errorf("device authorization of service %s failed: %w", svc.Name, err), model.SaveServiceOAuthToken(record))
+	}
+	clearDeviceFlow()
+	common.SysLog(fmt.Sprintf("Completed OAuth device authorization of service %s (ID: %d)", svc.Name, svc.ID))
+	return record, model.SaveServiceOAuthToken(record)
+}
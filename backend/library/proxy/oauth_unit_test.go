@@ -0,0 +1,326 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockOAuthServer is a token and device authorization endpoint issuing token-1, token-2, ... and an upstream
+// that only accepts the latest issued token
+type mockOAuthServer struct {
+	mu           sync.Mutex
+	issued       int
+	grants       []string
+	devicePolls  int
+	approveAfter int // device flow polls answered with authorization_pending
+	expiresIn    int64
+	seenAuth     []string
+	tokenServer  *httptest.Server
+	upstreamMock *httptest.Server
+}
+
+func newMockOAuthServer(t *testing.T) *mockOAuthServer {
+	t.Helper()
+	m := &mockOAuthServer{expiresIn: 3600}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		grant := r.PostForm.Get("grant_type")
+		m.grants = append(m.grants, grant)
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("client_id") != "one-mcp" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": "invalid_client"})
+			return
+		}
+		if grant == oauthDeviceCodeGrantType {
+			m.devicePolls++
+			if m.devicePolls <= m.approveAfter {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]any{"error": "authorization_pending"})
+				return
+			}
+		}
+		m.issued++
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  fmt.Sprintf("token-%d", m.issued),
+			"token_type":    "bearer",
+			"expires_in":    m.expiresIn,
+			"refresh_token": "refresh",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"device_code":      "device-1",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": "https://example.com/device",
+			"expires_in":       600,
+			"interval":         5,
+		})
+	})
+	m.tokenServer = httptest.NewServer(mux)
+	t.Cleanup(m.tokenServer.Close)
+
+	m.upstreamMock = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.seenAuth = append(m.seenAuth, r.Header.Get("Authorization"))
+		accepted := m.issued > 0 && r.Header.Get("Authorization") == fmt.Sprintf("Bearer token-%d", m.issued)
+		m.mu.Unlock()
+		if !accepted {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(req.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		response := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "initialize":
+			response["result"] = map[string]any{
+				"protocolVersion": mcp.LATEST_PROTOCOL_VERSION,
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "oauth-upstream", "version": "1.0.0"},
+			}
+		case "tools/list":
+			response["result"] = map[string]any{"tools": []any{}}
+		default:
+			response["result"] = map[string]any{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(m.upstreamMock.Close)
+	return m
+}
+
+func (m *mockOAuthServer) service(t *testing.T, grantType string) *model.MCPService {
+	t.Helper()
+	config, err := json.Marshal(model.ServiceOAuthConfig{
+		GrantType:              grantType,
+		TokenURL:               m.tokenServer.URL + "/token",
+		DeviceAuthorizationURL: m.tokenServer.URL + "/device",
+		ClientID:               "one-mcp",
+		ClientSecret:           "secret",
+	})
+	assert.NoError(t, err)
+	return &model.MCPService{
+		Name:            "oauth-svc",
+		Type:            model.ServiceTypeStreamableHTTP,
+		Command:         m.upstreamMock.URL,
+		Enabled:         true,
+		OAuthConfigJSON: string(config),
+	}
+}
+
+func (m *mockOAuthServer) state() (grants []string, seenAuth []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.grants...), append([]string(nil), m.seenAuth...)
+}
+
+func setupOAuthTestDB(t *testing.T) {
+	t.Helper()
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	t.Cleanup(func() { common.SQLitePath = originalPath })
+}
+
+// createOAuthTestInstance creates a new shared instance of svc, evicting it from the cache so the next call
+// connects again
+func createOAuthTestInstance(t *testing.T, svc *model.MCPService) (*SharedMcpInstance, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cacheKey := fmt.Sprintf("oauth-key-%d", svc.ID)
+	instance, err := getOrCreateSharedMcpInstanceWithKeyInternal(ctx, svc, cacheKey, "test", "")
+	if err == nil {
+		sharedMCPServersMutex.Lock()
+		delete(sharedMCPServers, cacheKey)
+		sharedMCPServersMutex.Unlock()
+		t.Cleanup(func() { _ = instance.Shutdown(context.Background()) })
+	}
+	return instance, err
+}
+
+func TestOAuthTokenInjectedAndRefreshedOnExpiry(t *testing.T) {
+	setupOAuthTestDB(t)
+	mock := newMockOAuthServer(t)
+	svc := mock.service(t, model.OAuthGrantClientCredentials)
+	svc.ID = 101
+
+	_, err := createOAuthTestInstance(t, svc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	grants, seenAuth := mock.state()
+	assert.Equal(t, []string{model.OAuthGrantClientCredentials}, grants)
+	assert.Contains(t, seenAuth, "Bearer token-1")
+
+	// A usable stored token is reused
+	_, err = createOAuthTestInstance(t, svc)
+	assert.NoError(t, err)
+	grants, _ = mock.state()
+	assert.Len(t, grants, 1)
+
+	// An expired token is refreshed with the refresh token before the instance connects
+	record, err := model.GetServiceOAuthToken(svc.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	record.ExpiresAt = time.Now().Add(-time.Minute)
+	assert.NoError(t, model.SaveServiceOAuthToken(record))
+
+	_, err = createOAuthTestInstance(t, svc)
+	assert.NoError(t, err)
+	grants, seenAuth = mock.state()
+	assert.Equal(t, []string{model.OAuthGrantClientCredentials, "refresh_token"}, grants)
+	assert.Equal(t, "Bearer token-2", seenAuth[len(seenAuth)-1])
+
+	record, err = model.GetServiceOAuthToken(svc.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "token-2", record.AccessToken)
+		assert.True(t, record.Usable(time.Now()))
+	}
+}
+
+func TestOAuthTokenRefreshedWhenUpstreamRejectsIt(t *testing.T) {
+	setupOAuthTestDB(t)
+	mock := newMockOAuthServer(t)
+	svc := mock.service(t, model.OAuthGrantClientCredentials)
+	svc.ID = 102
+
+	// The stored token has not expired but the upstream no longer accepts it
+	assert.NoError(t, model.SaveServiceOAuthToken(&model.ServiceOAuthToken{
+		ServiceID:   svc.ID,
+		AccessToken: "revoked",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}))
+
+	_, err := createOAuthTestInstance(t, svc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	grants, seenAuth := mock.state()
+	assert.Equal(t, []string{model.OAuthGrantClientCredentials}, grants)
+	assert.Equal(t, "Bearer revoked", seenAuth[0])
+	assert.Equal(t, "Bearer token-1", seenAuth[len(seenAuth)-1])
+
+	// A 401 during a tool call expires the token so the next instance refreshes it
+	assert.True(t, expireServiceOAuthToken(svc.ID))
+	record, err := model.GetServiceOAuthToken(svc.ID)
+	if assert.NoError(t, err) {
+		assert.False(t, record.Usable(time.Now()))
+	}
+}
+
+func TestOAuthDeviceFlow(t *testing.T) {
+	setupOAuthTestDB(t)
+	mock := newMockOAuthServer(t)
+	mock.approveAfter = 1
+	svc := mock.service(t, model.OAuthGrantDeviceCode)
+	svc.ID = 103
+
+	_, err := createOAuthTestInstance(t, svc)
+	assert.True(t, errors.Is(err, ErrOAuthAuthorizationRequired), "%v", err)
+
+	ctx := context.Background()
+	record, err := StartServiceOAuth(ctx, svc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "ABCD-EFGH", record.UserCode)
+	assert.Equal(t, "https://example.com/device", record.VerificationURI)
+
+	_, err = CompleteServiceOAuth(ctx, svc)
+	assert.ErrorIs(t, err, ErrOAuthAuthorizationPending)
+
+	record, err = CompleteServiceOAuth(ctx, svc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "token-1", record.AccessToken)
+	assert.Empty(t, record.DeviceCode, "the finished device flow is cleared")
+
+	_, err = createOAuthTestInstance(t, svc)
+	assert.NoError(t, err)
+	_, seenAuth := mock.state()
+	assert.Equal(t, "Bearer token-1", seenAuth[len(seenAuth)-1])
+}
+
+func TestOAuthHeaderFuncRefreshesBeforeExpiry(t *testing.T) {
+	setupOAuthTestDB(t)
+	mock := newMockOAuthServer(t)
+	svc := mock.service(t, model.OAuthGrantClientCredentials)
+	svc.ID = 104
+
+	// The stored token is still valid but about to expire
+	assert.NoError(t, model.SaveServiceOAuthToken(&model.ServiceOAuthToken{
+		ServiceID:    svc.ID,
+		AccessToken:  "expiring",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(10 * time.Second),
+	}))
+
+	headerFunc := upstreamHeaderFunc(svc)
+	ctx := WithRequestID(context.Background(), "req-997")
+	headers := headerFunc(ctx)
+	assert.Equal(t, "Bearer token-1", headers["Authorization"])
+	assert.Equal(t, "req-997", headers[CorrelationHeader])
+
+	// The refreshed token is reused while it is usable
+	headers = headerFunc(context.Background())
+	assert.Equal(t, "Bearer token-1", headers["Authorization"])
+	grants, _ := mock.state()
+	assert.Equal(t, []string{"refresh_token"}, grants)
+
+	// Services without OAuth only get the correlation headers
+	plain := upstreamHeaderFunc(&model.MCPService{Name: "plain", Type: model.ServiceTypeStreamableHTTP})
+	assert.Equal(t, map[string]string{CorrelationHeader: "req-997"}, plain(ctx))
+}
+
+func TestOAuthTokenSentToHealthEndpoint(t *testing.T) {
+	setupOAuthTestDB(t)
+	mock := newMockOAuthServer(t)
+	svc := mock.service(t, model.OAuthGrantClientCredentials)
+	svc.ID = 105
+	svc.HealthCheckURL = mock.upstreamMock.URL + "/health"
+
+	// The upstream only allows POST, so the authorized health request is answered with 405
+	err := checkHealthEndpoint(context.Background(), svc)
+	var endpointErr *healthEndpointError
+	if assert.ErrorAs(t, err, &endpointErr) {
+		assert.Equal(t, http.StatusMethodNotAllowed, endpointErr.statusCode)
+	}
+	_, seenAuth := mock.state()
+	assert.Equal(t, []string{"Bearer token-1"}, seenAuth)
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// maxProbeOutputLen bounds how much probe output is kept in the health error message
+const maxProbeOutputLen = 200
+
+// runServiceProbe runs the service's probe command with the service's default env and working directory.
+// A zero exit status means the binary is runnable; otherwise the error carries the (truncated) output.
+func runServiceProbe(ctx context.Context, svc *model.MCPService) error {
+	args := svc.ProbeArgs()
+	if len(args) == 0 {
+		return errors.New("probe command is empty")
+	}
+	env, workDir, err := stdioProcessEnv(svc)
+	if err != nil {
+		return fmt.Errorf("probe: %w", err)
+	}
+
+	cmd := buildStdioCmd(ctx, args[0], env, args[1:], workDir)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("probe %q did not finish: %w", svc.ProbeCommand, ctxErr)
+	}
+	detail := strings.TrimSpace(string(output))
+	if len(detail) > maxProbeOutputLen {
+		detail = detail[:maxProbeOutputLen] + "..."
+	}
+	if detail == "" {
+		return fmt.Errorf("probe %q failed: %w", svc.ProbeCommand, err)
+	}
+	return fmt.Errorf("probe %q failed: %w: %s", svc.ProbeCommand, err, detail)
+}
+
+// stdioProcessEnv returns the service's default env as KEY=VALUE pairs and its validated working directory,
+// for auxiliary commands (probe, hooks) that run next to the stdio server process.
+func stdioProcessEnv(svc *model.MCPService) ([]string, string, error) {
+	var env []string
+	if envsJSON := svc.ActiveDefaultEnvsJSON(); envsJSON != "" && envsJSON != "{}" {
+		var envs map[string]string
+		if err := json.Unmarshal([]byte(envsJSON), &envs); err == nil {
+			for key, value := range envs {
+				env = append(env, fmt.Sprintf("%s=%s", key, value))
+			}
+		}
+	}
+	if svc.WorkingDir == "" {
+		return env, "", nil
+	}
+	workDir, err := common.ValidateWorkingDir(svc.WorkingDir)
+	if err != nil {
+		return nil, "", err
+	}
+	return env, workDir, nil
+}
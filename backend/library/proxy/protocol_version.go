@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"one-mcp/backend/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// AdvertisedProtocolVersion returns the highest MCP protocol version one-mcp speaks: the configured
+// MCPProtocolVersion when it is a version known to mcp-go, otherwise mcp.LATEST_PROTOCOL_VERSION.
+func AdvertisedProtocolVersion() string {
+	configured := common.GetMCPProtocolVersion()
+	if configured == "" {
+		return mcp.LATEST_PROTOCOL_VERSION
+	}
+	if !slices.Contains(mcp.ValidProtocolVersions, configured) {
+		common.SysError(fmt.Sprintf("Unknown MCP protocol version %q configured, using %s", configured, mcp.LATEST_PROTOCOL_VERSION))
+		return mcp.LATEST_PROTOCOL_VERSION
+	}
+	return configured
+}
+
+// NegotiateProtocolVersion picks the version returned to a client that requested the given one:
+// the requested version when it is known and not newer than AdvertisedProtocolVersion, else the latter.
+func NegotiateProtocolVersion(requested string) string {
+	advertised := AdvertisedProtocolVersion()
+	// 协议版本为日期格式，可按字符串比较新旧
+	if slices.Contains(mcp.ValidProtocolVersions, requested) && requested <= advertised {
+		return requested
+	}
+	return advertised
+}
+
+// ProtocolVersionHooks returns server hooks that apply NegotiateProtocolVersion to every initialize
+// result, so groups and per-service proxies advertise the same version.
+func ProtocolVersionHooks() *mcpserver.Hooks {
+	hooks := &mcpserver.Hooks{}
+	hooks.AddAfterInitialize(func(ctx context.Context, id any, message *mcp.InitializeRequest, result *mcp.InitializeResult) {
+		result.ProtocolVersion = NegotiateProtocolVersion(message.Params.ProtocolVersion)
+	})
+	return hooks
+}
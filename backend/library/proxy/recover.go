@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// maxLoopPanicRestarts 后台循环因 panic 被重启的最大次数，超过后放弃该循环，避免持续崩溃刷屏
+const maxLoopPanicRestarts = 5
+
+// saveServicePanicLog 持久化 panic 日志，测试中可替换
+var saveServicePanicLog = model.SaveMCPLog
+
+// logServicePanic 记录某个服务后台任务中恢复的 panic（系统日志附带堆栈，服务日志仅保存摘要）
+func logServicePanic(serviceID int64, serviceName string, where string, recovered any) {
+	msg := fmt.Sprintf("Recovered panic in %s for service %s (ID: %d): %v", where, serviceName, serviceID, recovered)
+	common.SysError(fmt.Sprintf("%s\n%s", msg, debug.Stack()))
+	if err := saveServicePanicLog(context.Background(), serviceID, serviceName, model.MCPLogPhaseRun, model.MCPLogLevelError, msg); err != nil {
+		common.SysError(fmt.Sprintf("Failed to save panic log for %s: %v", serviceName, err))
+	}
+}
+
+// runWithPanicRestart 运行 loop，若其 panic 则记录后重新运行，直到 loop 正常返回或达到重启上限。
+func runWithPanicRestart(serviceID int64, serviceName string, where string, loop func()) {
+	for attempt := 0; ; attempt++ {
+		if !runRecovered(serviceID, serviceName, where, loop) {
+			return
+		}
+		if attempt >= maxLoopPanicRestarts {
+			common.SysError(fmt.Sprintf("Giving up %s for service %s (ID: %d) after %d panics", where, serviceName, serviceID, attempt+1))
+			return
+		}
+	}
+}
+
+// runRecovered 运行 fn 并吞掉其 panic，返回是否发生了 panic
+func runRecovered(serviceID int64, serviceName string, where string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logServicePanic(serviceID, serviceName, where, r)
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
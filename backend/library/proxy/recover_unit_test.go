@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type panicLogRecorder struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *panicLogRecorder) save(ctx context.Context, serviceID int64, serviceName string, phase model.MCPLogPhase, level model.MCPLogLevel, message string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func (r *panicLogRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.messages)
+}
+
+func recordPanicLogs(t *testing.T) *panicLogRecorder {
+	recorder := &panicLogRecorder{}
+	original := saveServicePanicLog
+	saveServicePanicLog = recorder.save
+	t.Cleanup(func() { saveServicePanicLog = original })
+	return recorder
+}
+
+type panickingService struct {
+	fakeHealthyService
+	calls atomic.Int32
+}
+
+func (s *panickingService) CheckHealth(ctx context.Context) (*ServiceHealth, error) {
+	if s.calls.Add(1) == 1 {
+		panic("mock health check exploded")
+	}
+	return s.fakeHealthyService.CheckHealth(ctx)
+}
+
+func TestHealthChecker_RecoversFromPanickingService(t *testing.T) {
+	logs := recordPanicLogs(t)
+	serviceID := int64(992001)
+	GetToolsCacheManager().DeleteServiceTools(serviceID)
+	GetHealthCacheManager().DeleteServiceHealth(serviceID)
+	defer GetHealthCacheManager().DeleteServiceHealth(serviceID)
+
+	hc := NewHealthChecker(time.Hour)
+	svc := &panickingService{fakeHealthyService: fakeHealthyService{id: serviceID, name: "panicky", running: true}}
+	hc.RegisterService(svc)
+
+	assert.NotPanics(t, func() { hc.checkService(svc) })
+	health, ok := GetHealthCacheManager().GetServiceHealth(serviceID)
+	if assert.True(t, ok) {
+		assert.Equal(t, StatusUnhealthy, health.Status)
+		assert.Contains(t, health.ErrorMessage, "mock health check exploded")
+	}
+	if assert.Equal(t, 1, logs.count()) {
+		assert.Contains(t, logs.messages[0], "panicky")
+	}
+
+	// 下一轮检查照常进行
+	hc.servicesMu.Lock()
+	delete(hc.lastUpdateTimes, serviceID)
+	hc.servicesMu.Unlock()
+	hc.checkService(svc)
+	health, ok = GetHealthCacheManager().GetServiceHealth(serviceID)
+	if assert.True(t, ok) {
+		assert.Equal(t, StatusHealthy, health.Status)
+	}
+}
+
+func TestRunWithPanicRestart(t *testing.T) {
+	logs := recordPanicLogs(t)
+
+	tests := []struct {
+		name      string
+		panics    int
+		wantRuns  int
+		wantPanic int
+	}{
+		{"no panic runs once", 0, 1, 0},
+		{"restarts after panics", 2, 3, 2},
+		{"gives up after limit", 100, maxLoopPanicRestarts + 1, maxLoopPanicRestarts + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := logs.count()
+			runs := 0
+			assert.NotPanics(t, func() {
+				runWithPanicRestart(1, "svc", "test loop", func() {
+					runs++
+					if runs <= tt.panics {
+						panic("boom")
+					}
+				})
+			})
+			assert.Equal(t, tt.wantRuns, runs)
+			assert.Equal(t, tt.wantPanic, logs.count()-before)
+		})
+	}
+}
+
+func TestSharedMcpInstance_HeartbeatRecoversFromPanic(t *testing.T) {
+	logs := recordPanicLogs(t)
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap[common.OptionNetworkMcpHeartbeatInterval] = "10ms"
+	common.OptionMap[common.OptionNetworkMcpHeartbeatTimeout] = "5ms"
+	common.OptionMap[common.OptionNetworkMcpHeartbeatJitter] = "0s"
+	common.OptionMapRWMutex.Unlock()
+
+	var pings atomic.Int32
+	fake := &fakeMcpClient{pingFn: func(ctx context.Context) error {
+		if pings.Add(1) == 1 {
+			panic("mock ping exploded")
+		}
+		return errors.New("upstream gone")
+	}}
+	inst := &SharedMcpInstance{
+		Client:      fake,
+		cancel:      func() {},
+		serviceID:   992002,
+		serviceName: "panicky-http",
+		serviceType: model.ServiceTypeStreamableHTTP,
+		cacheKey:    "panic-heartbeat",
+	}
+	sharedMCPServersMutex.Lock()
+	sharedMCPServers[inst.cacheKey] = inst
+	sharedMCPServersMutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inst.startMaintenanceLoops(ctx)
+
+	// 重启后的循环继续 ping，并在失败时照常清理缓存
+	assert.Eventually(t, func() bool {
+		sharedMCPServersMutex.Lock()
+		defer sharedMCPServersMutex.Unlock()
+		_, exists := sharedMCPServers[inst.cacheKey]
+		return !exists
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, logs.count())
+	assert.GreaterOrEqual(t, pings.Load(), int32(2))
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// errNoDownstreamRequest is returned to the upstream server when it sends a request while no downstream
+// request is in progress on the instance, so there is no client to relay it to.
+var errNoDownstreamRequest = errors.New("no downstream request in progress to relay the server request to")
+
+// upstreamRequestRelay answers sampling/createMessage and roots/list requests sent by an upstream server
+// by forwarding them to the downstream client whose tool call is in progress on the same instance.
+// MCP does not tie a server request to the call that caused it, so the most recent call in flight is used.
+// That is only safe when every call on the instance comes from the same user, so relays are created for
+// user-specific instances only (see relayForInstance).
+type upstreamRequestRelay struct {
+	mu      sync.Mutex
+	pending []context.Context // downstream request contexts, oldest first
+}
+
+func newUpstreamRequestRelay() *upstreamRequestRelay {
+	return &upstreamRequestRelay{}
+}
+
+// relayForInstance returns the relay of the instance cached under cacheKey, or nil when the instance is shared
+// by several users: a server request could otherwise be answered by another user's client. Without a relay the
+// upstream client does not declare the sampling and roots capabilities.
+func relayForInstance(cacheKey string) *upstreamRequestRelay {
+	if !isUserServiceCacheKey(cacheKey) {
+		return nil
+	}
+	return newUpstreamRequestRelay()
+}
+
+// clientOptions makes the upstream client declare the sampling and roots capabilities and route the
+// corresponding server requests to the relay. A nil relay adds nothing.
+func (r *upstreamRequestRelay) clientOptions() []mcpclient.ClientOption {
+	if r == nil {
+		return nil
+	}
+	return []mcpclient.ClientOption{mcpclient.WithSamplingHandler(r), mcpclient.WithRootsHandler(r)}
+}
+
+// track registers ctx, the context of a downstream request handled by an mcp-go server, as a relay target
+// until the returned function is called.
+func (r *upstreamRequestRelay) track(ctx context.Context) func() {
+	if r == nil || mcpserver.ClientSessionFromContext(ctx) == nil || mcpserver.ServerFromContext(ctx) == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	r.pending = append(r.pending, ctx)
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i := len(r.pending) - 1; i >= 0; i-- {
+			if r.pending[i] == ctx {
+				r.pending = append(r.pending[:i], r.pending[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// downstream returns the most recent downstream request that is still active
+func (r *upstreamRequestRelay) downstream() (context.Context, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.pending) - 1; i >= 0; i-- {
+		if r.pending[i].Err() == nil {
+			return r.pending[i], true
+		}
+	}
+	return nil, false
+}
+
+// relayContext returns the downstream context to send the relayed request with; it is also cancelled when
+// the upstream gives up on its request.
+func (r *upstreamRequestRelay) relayContext(ctx context.Context, supported func(mcp.ClientCapabilities) bool) (context.Context, context.CancelFunc, error) {
+	downstreamCtx, ok := r.downstream()
+	if !ok {
+		return nil, nil, errNoDownstreamRequest
+	}
+	if session, ok := mcpserver.ClientSessionFromContext(downstreamCtx).(mcpserver.SessionWithClientInfo); ok && !supported(session.GetClientCapabilities()) {
+		return nil, nil, errors.New("the downstream client did not declare this capability")
+	}
+	relayCtx, cancel := context.WithCancel(downstreamCtx)
+	stop := context.AfterFunc(ctx, cancel)
+	return relayCtx, func() {
+		stop()
+		cancel()
+	}, nil
+}
+
+// CreateMessage relays a sampling request of the upstream server to the downstream client
+func (r *upstreamRequestRelay) CreateMessage(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	relayCtx, cancel, err := r.relayContext(ctx, func(c mcp.ClientCapabilities) bool { return c.Sampling != nil })
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return mcpserver.ServerFromContext(relayCtx).RequestSampling(relayCtx, request)
+}
+
+// ListRoots relays a roots request of the upstream server to the downstream client
+func (r *upstreamRequestRelay) ListRoots(ctx context.Context, request mcp.ListRootsRequest) (*mcp.ListRootsResult, error) {
+	relayCtx, cancel, err := r.relayContext(ctx, func(c mcp.ClientCapabilities) bool { return c.Roots != nil })
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return mcpserver.ServerFromContext(relayCtx).RequestRoots(relayCtx, request)
+}
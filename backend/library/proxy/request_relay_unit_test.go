@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// downstreamClientHandler answers the sampling and roots requests relayed to the downstream client
+type downstreamClientHandler struct {
+	samplingPrompts []string
+}
+
+func (h *downstreamClientHandler) CreateMessage(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	if text, ok := request.Messages[0].Content.(mcp.TextContent); ok {
+		h.samplingPrompts = append(h.samplingPrompts, text.Text)
+	}
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{Role: mcp.RoleAssistant, Content: mcp.NewTextContent("answer from the downstream model")},
+		Model:           "downstream-model",
+	}, nil
+}
+
+func (h *downstreamClientHandler) ListRoots(ctx context.Context, request mcp.ListRootsRequest) (*mcp.ListRootsResult, error) {
+	return &mcp.ListRootsResult{Roots: []mcp.Root{{URI: "file:///workspace", Name: "workspace"}}}, nil
+}
+
+// newSamplingUpstream starts a Streamable HTTP MCP server whose "ask" tool asks its client for the roots
+// and for a sampled message, and returns both in its result.
+func newSamplingUpstream(t *testing.T) *httptest.Server {
+	upstream := mcpserver.NewMCPServer("sampling-upstream", "1.0.0")
+	upstream.EnableSampling()
+	upstream.AddTool(mcp.NewTool("ask"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		server := mcpserver.ServerFromContext(ctx)
+		roots, err := server.RequestRoots(ctx, mcp.ListRootsRequest{})
+		if err != nil {
+			return mcp.NewToolResultError("roots: " + err.Error()), nil
+		}
+		sampling, err := server.RequestSampling(ctx, mcp.CreateMessageRequest{
+			CreateMessageParams: mcp.CreateMessageParams{
+				Messages:  []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.NewTextContent("what is the answer?")}},
+				MaxTokens: 16,
+			},
+		})
+		if err != nil {
+			return mcp.NewToolResultError("sampling: " + err.Error()), nil
+		}
+		text, _ := sampling.Content.(mcp.TextContent)
+		return mcp.NewToolResultText(fmt.Sprintf("root=%s model=%s text=%s", roots.Roots[0].URI, sampling.Model, text.Text)), nil
+	})
+	httpServer := httptest.NewServer(mcpserver.NewStreamableHTTPServer(upstream))
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func TestUpstreamSamplingAndRootsAreRelayedToDownstream(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	upstream := newSamplingUpstream(t)
+	svc := &model.MCPService{Name: "sampling-relay-svc", Type: model.ServiceTypeStreamableHTTP, Command: upstream.URL + "/mcp"}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv, upstreamClient, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, ctx, "sampling-relay-key", svc, "test", newUpstreamRequestRelay())
+	if err != nil {
+		t.Fatalf("create instance: %v", err)
+	}
+	defer upstreamClient.Close()
+
+	handler := &downstreamClientHandler{}
+	downstreamTransport := transport.NewInProcessTransportWithOptions(srv, transport.WithSamplingHandler(handler), transport.WithRootsHandler(handler))
+	downstream := mcpclient.NewClient(downstreamTransport, mcpclient.WithSamplingHandler(handler), mcpclient.WithRootsHandler(handler))
+	if err := downstream.Start(ctx); err != nil {
+		t.Fatalf("start downstream client: %v", err)
+	}
+	defer downstream.Close()
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	if _, err := downstream.Initialize(ctx, initRequest); err != nil {
+		t.Fatalf("initialize downstream client: %v", err)
+	}
+
+	callRequest := mcp.CallToolRequest{}
+	callRequest.Params.Name = "ask"
+	result, err := downstream.CallTool(ctx, callRequest)
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	text, _ := result.Content[0].(mcp.TextContent)
+	if result.IsError || !strings.Contains(text.Text, "root=file:///workspace model=downstream-model text=answer from the downstream model") {
+		t.Fatalf("expected the upstream to receive the downstream answers, got %q (error=%v)", text.Text, result.IsError)
+	}
+	if len(handler.samplingPrompts) != 1 || handler.samplingPrompts[0] != "what is the answer?" {
+		t.Fatalf("expected the sampling request to reach the downstream client, got %v", handler.samplingPrompts)
+	}
+}
+
+func TestUpstreamRequestRelayWithoutDownstreamRequest(t *testing.T) {
+	relay := newUpstreamRequestRelay()
+	if _, err := relay.CreateMessage(context.Background(), mcp.CreateMessageRequest{}); err != errNoDownstreamRequest {
+		t.Fatalf("expected errNoDownstreamRequest, got %v", err)
+	}
+	// 不含 mcp-go 会话的上下文不会成为转发目标
+	untrack := relay.track(context.Background())
+	defer untrack()
+	if _, err := relay.ListRoots(context.Background(), mcp.ListRootsRequest{}); err != errNoDownstreamRequest {
+		t.Fatalf("expected errNoDownstreamRequest, got %v", err)
+	}
+}
+
+func TestRelayOnlyForUserSpecificInstances(t *testing.T) {
+	if relay := relayForInstance(SharedServiceCacheKey(7)); relay != nil {
+		t.Fatalf("expected no relay on a shared instance, server requests could reach another user's client")
+	}
+	if relay := relayForInstance(UserServiceCacheKey(1, 7)); relay == nil {
+		t.Fatalf("expected a relay on a user-specific instance")
+	}
+	if relay := relayForInstance(UserServiceCacheKey(1, 7) + "-profile-work"); relay == nil {
+		t.Fatalf("expected a relay on a user-specific instance of an env profile")
+	}
+}
@@ -12,9 +12,12 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -192,20 +195,183 @@ func isBenignStderrLine(line string) bool {
 	return false
 }
 
+// ErrNotMCPServer indicates the stdio command ran but does not speak the MCP protocol
+// (e.g. the package's default bin is a CLI that prints usage and exits).
+var ErrNotMCPServer = errors.New("command is not an MCP server")
+
+// ErrInitializeTimeout indicates the upstream did not answer the initialize request within McpInitializeTimeout.
+var ErrInitializeTimeout = errors.New("MCP initialize handshake timed out")
+
+// maxStderrTailLines bounds how many recent stderr lines are kept for startup diagnostics
+const maxStderrTailLines = 20
+
+// stderrTail keeps the last stderr lines of a subprocess so initialize failures can be diagnosed
+type stderrTail struct {
+	mu    sync.Mutex
+	lines []string
+	done  chan struct{} // closed when the stderr reader exits
+}
+
+func newStderrTail() *stderrTail {
+	return &stderrTail{done: make(chan struct{})}
+}
+
+func (t *stderrTail) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, line)
+	if len(t.lines) > maxStderrTailLines {
+		t.lines = t.lines[len(t.lines)-maxStderrTailLines:]
+	}
+}
+
+// snapshot waits up to wait for the reader to finish, then returns the collected lines
+func (t *stderrTail) snapshot(wait time.Duration) []string {
+	select {
+	case <-t.done:
+	case <-time.After(wait):
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// isEarlyExitInitError reports whether an initialize error means the subprocess closed stdio
+// or replied with something that is not JSON-RPC, as opposed to a slow server timing out.
+func isEarlyExitInitError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, transport.ErrTransportClosed) || errors.Is(err, io.EOF) {
+		return true
+	}
+	lower := strings.ToLower(err.Error())
+	return strings.Contains(lower, "transport closed") ||
+		strings.Contains(lower, "parse error") ||
+		strings.Contains(lower, "invalid character") ||
+		strings.Contains(lower, "unexpected end of json")
+}
+
+// looksLikeUsageOutput reports whether stderr output resembles a CLI usage/help message
+func looksLikeUsageOutput(lines []string) bool {
+	for _, line := range lines {
+		lower := strings.ToLower(strings.TrimSpace(line))
+		if strings.HasPrefix(lower, "usage:") ||
+			strings.HasPrefix(lower, "usage ") ||
+			strings.HasPrefix(lower, "options:") ||
+			strings.HasPrefix(lower, "commands:") ||
+			strings.Contains(lower, "--help") {
+			return true
+		}
+	}
+	return false
+}
+
+// newStdioMCPClient starts cmd and connects an mcp-go client to its stdio. When noise is not nil, stdout lines
+// that are not JSON-RPC messages are recorded in it. Tests replace it to simulate client implementations that
+// do not expose the subprocess stderr.
+var newStdioMCPClient = func(cmd *exec.Cmd, noise *stdoutNoise, clientOpts []mcpclient.ClientOption) (mcpclient.MCPClient, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	var output io.Reader = stdout
+	if noise != nil {
+		output = noise.wrap(stdout)
+	}
+	stdioTransport := transport.NewIO(output, stdin, &processStderr{ReadCloser: stderr, cmd: cmd})
+	if err := stdioTransport.Start(context.Background()); err != nil {
+		_ = stdioTransport.Close()
+		return nil, fmt.Errorf("failed to start stdio transport: %w", err)
+	}
+	client := mcpclient.NewClient(stdioTransport, clientOpts...)
+	// 传输层已启动，这里只注册通知与服务端请求（sampling、roots）的处理器
+	if err := client.Start(context.Background()); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// processStderr is the stderr of a stdio server. The transport closes it after stdin, so closing it also
+// waits for the process to exit, as the mcp-go transport does for the processes it spawns itself.
+type processStderr struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (p *processStderr) Close() error {
+	err := p.ReadCloser.Close()
+	if waitErr := p.cmd.Wait(); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return err
+}
+
+// describeProcessExit reports how the stdio subprocess ended, for failures where its stderr could not be read.
+func describeProcessExit(cmd *exec.Cmd) string {
+	if cmd == nil || cmd.Process == nil {
+		return "the process was not started"
+	}
+	if cmd.ProcessState == nil {
+		return fmt.Sprintf("the process (pid %d) had not exited", cmd.Process.Pid)
+	}
+	return fmt.Sprintf("the process (pid %d) ended with %s", cmd.Process.Pid, cmd.ProcessState.String())
+}
+
+// buildStdioCmd builds the subprocess for a stdio service with the sanitized environment and working directory
+func buildStdioCmd(ctx context.Context, command string, env []string, args []string, workDir string) *exec.Cmd {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = common.SubprocessEnv(env)
+	cmd.Dir = workDir
+	return cmd
+}
+
 // SharedMcpInstance encapsulates a shared MCPServer and its MCPClient.
 type SharedMcpInstance struct {
 	Server        *mcpserver.MCPServer
 	Client        mcpclient.MCPClient
-	Tools         []mcp.Tool          // Cached tools list
-	ServerInfo    *mcp.Implementation // Server info from Initialize (name, version)
-	cancel        context.CancelFunc  // cancels background goroutines like heartbeat
-	serviceID     int64               // owning service ID for cleanup of user-specific instances
+	Tools         []mcp.Tool            // Cached tools list
+	ServerInfo    *mcp.Implementation   // Server info from Initialize (name, version)
+	InitResult    *mcp.InitializeResult // Raw Initialize result (protocol version, capabilities, instructions)
+	cancel        context.CancelFunc    // cancels background goroutines like heartbeat
+	serviceID     int64                 // owning service ID for cleanup of user-specific instances
 	serviceName   string
 	serviceType   model.ServiceType
 	cacheKey      string
 	instanceLabel string
 	cleanupOnce   sync.Once
 	stdioCmd      *exec.Cmd // tracks stdio-backed subprocess for forced termination
+	relay         *upstreamRequestRelay
+	hookService   *model.MCPService // effective service config whose post-stop command runs after shutdown
+	endpoint      string            // upstream URL or stdio command the instance is connected to, a fallback when the primary failed
+	postStopOnce  sync.Once
+	inFlight      atomic.Int64 // downstream requests using the instance, see BeginUse
+	lastUsed      atomic.Int64 // unix nanoseconds of the last use, for LRU eviction of user-specific instances
+}
+
+// TrackDownstreamRequest makes ctx, the context of a downstream MCP request that calls into this instance,
+// the target of sampling and roots requests sent by the upstream server until the returned function is called.
+func (s *SharedMcpInstance) TrackDownstreamRequest(ctx context.Context) func() {
+	if s == nil {
+		return func() {}
+	}
+	return s.relay.track(ctx)
 }
 
 // startMaintenanceLoops wires up background tasks (ping + connection loss handling) for network-based transports.
@@ -232,7 +398,8 @@ func (s *SharedMcpInstance) startMaintenanceLoops(runtimeCtx context.Context) {
 	}
 
 	// Heartbeat ping loop: proactively detects stale/broken upstream connections.
-	go func() {
+	// A panic inside the loop is logged and the loop restarted, so it never takes the process down.
+	go runWithPanicRestart(s.serviceID, s.serviceName, "heartbeat ping loop", func() {
 		jitter := networkHeartbeatJitter()
 		if jitter > 0 {
 			r := rand.New(rand.NewSource(time.Now().UnixNano() + s.serviceID))
@@ -269,7 +436,7 @@ func (s *SharedMcpInstance) startMaintenanceLoops(runtimeCtx context.Context) {
 				}
 			}
 		}
-	}()
+	})
 }
 
 // handleTransportDisruption performs one-time cleanup after we detect a fatal transport error.
@@ -292,21 +459,9 @@ func (s *SharedMcpInstance) handleTransportDisruption(trigger string, cause erro
 		}
 
 		if s.serviceType == model.ServiceTypeSSE || s.serviceType == model.ServiceTypeStreamableHTTP {
-			sseKey := fmt.Sprintf("service-%d-sseproxy", s.serviceID)
-			sseWrappersMutex.Lock()
-			if _, exists := initializedSSEProxyWrappers[sseKey]; exists {
-				delete(initializedSSEProxyWrappers, sseKey)
-				common.SysLog(fmt.Sprintf("Cleared SSE handler cache for %s due to %s disruption.", s.serviceName, trigger))
+			if sseCleared, httpCleared := clearInstanceProxyHandlers(s.serviceID, s.cacheKey); sseCleared > 0 || httpCleared > 0 {
+				common.SysLog(fmt.Sprintf("Cleared %d SSE and %d HTTP handler caches for %s due to %s disruption.", sseCleared, httpCleared, s.serviceName, trigger))
 			}
-			sseWrappersMutex.Unlock()
-
-			httpKey := fmt.Sprintf("service-%d-httpproxy", s.serviceID)
-			httpWrappersMutex.Lock()
-			if _, exists := initializedHTTPProxyWrappers[httpKey]; exists {
-				delete(initializedHTTPProxyWrappers, httpKey)
-				common.SysLog(fmt.Sprintf("Cleared HTTP handler cache for %s due to %s disruption.", s.serviceName, trigger))
-			}
-			httpWrappersMutex.Unlock()
 		}
 
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -388,6 +543,48 @@ func McpToolCallTimeout() time.Duration {
 	return parseDurationOption(common.OptionMcpToolCallTimeout, 5*time.Minute)
 }
 
+// mcpInitializeTimeout returns the timeout of the initialize request of a new instance; 0 leaves only the
+// deadline of the handshake context.
+func mcpInitializeTimeout() time.Duration {
+	return parseDurationOption(common.OptionMcpInitializeTimeout, 30*time.Second)
+}
+
+type noInitializeTimeoutKey struct{}
+
+// withoutInitializeTimeout marks a handshake context whose initialize request is bounded only by the context
+// itself, for prewarming where the first initialize also waits for the package download.
+func withoutInitializeTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noInitializeTimeoutKey{}, true)
+}
+
+type throwawayInstanceKey struct{}
+
+// asThrowawayInstance marks a handshake context of an instance created only to be checked and shut down right away,
+// such as a validation run: its pre-start hook does not run and it leaves no trace in shared state (the preferred
+// endpoint of the service, its stored installed version).
+func asThrowawayInstance(ctx context.Context) context.Context {
+	return context.WithValue(ctx, throwawayInstanceKey{}, true)
+}
+
+// isThrowawayInstance reports whether the handshake context belongs to a throwaway instance
+func isThrowawayInstance(handshakeCtx context.Context) bool {
+	throwaway, _ := handshakeCtx.Value(throwawayInstanceKey{}).(bool)
+	return throwaway
+}
+
+// initializeTimeoutFor returns the initialize timeout that applies to a handshake context
+func initializeTimeoutFor(handshakeCtx context.Context) time.Duration {
+	if skip, _ := handshakeCtx.Value(noInitializeTimeoutKey{}).(bool); skip {
+		return 0
+	}
+	return mcpInitializeTimeout()
+}
+
+// mcpWarmupPingTimeout returns the timeout of the ping sent right after instance initialization; 0 disables it.
+func mcpWarmupPingTimeout() time.Duration {
+	return parseDurationOption(common.OptionMcpWarmupPingTimeout, 5*time.Second)
+}
+
 type pingableMcpClient interface {
 	Ping(context.Context) error
 }
@@ -411,6 +608,10 @@ func shouldInvalidateInstanceAfterCallError(cli pingableMcpClient, err error) bo
 	if isTransportClosedError(err) {
 		return true
 	}
+	// The upstream answered: 5xx responses are counted by recordUpstreamCallResult instead
+	if isUpstreamServerError(err) {
+		return false
+	}
 
 	lower := strings.ToLower(err.Error())
 	// Errors that strongly suggest the underlying transport is unusable.
@@ -434,6 +635,10 @@ func shouldInvalidateInstanceAfterCallError(cli pingableMcpClient, err error) bo
 
 const stdioPrewarmTimeout = 5 * time.Minute
 
+// sharedInstanceConnectTimeout bounds starting a shared instance and listing its capabilities, excluding the
+// initialize request which is bounded by McpInitializeTimeout.
+const sharedInstanceConnectTimeout = 20 * time.Second
+
 // prewarmStdioService proactively starts and shuts down a stdio MCP service to install dependencies.
 func prewarmStdioService(ctx context.Context, svc *model.MCPService) error {
 	if svc == nil {
@@ -446,11 +651,12 @@ func prewarmStdioService(ctx context.Context, svc *model.MCPService) error {
 	common.SysLog(fmt.Sprintf("Prewarm: starting stdio service %s (ID: %d)", svc.Name, svc.ID))
 
 	serviceConfig := *svc // shallow copy to avoid mutating caller
+	serviceConfig.DefaultEnvsJSON = svc.ActiveDefaultEnvsJSON()
 
 	bgCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	handshakeCtx, handshakeCancel := context.WithTimeout(bgCtx, stdioPrewarmTimeout)
+	handshakeCtx, handshakeCancel := context.WithTimeout(withoutInitializeTimeout(bgCtx), stdioPrewarmTimeout)
 	defer handshakeCancel()
 
 	// Allow external cancellation
@@ -466,7 +672,7 @@ func prewarmStdioService(ctx context.Context, svc *model.MCPService) error {
 	cacheKey := fmt.Sprintf("prewarm-service-%d-%d", svc.ID, time.Now().UnixNano())
 	instanceLabel := fmt.Sprintf("prewarm-%d", svc.ID)
 
-	srv, cli, stdioCmd, _, serverInfo, err := createActualMcpGoServerAndClientUncached(handshakeCtx, bgCtx, cacheKey, &serviceConfig, instanceLabel)
+	srv, cli, stdioCmd, _, initResult, err := createActualMcpGoServerAndClientUncached(handshakeCtx, bgCtx, cacheKey, &serviceConfig, instanceLabel, nil)
 	close(handshakeDone)
 	if err != nil {
 		return fmt.Errorf("prewarm: failed to initialize stdio service %s (ID: %d): %w", svc.Name, svc.ID, err)
@@ -475,13 +681,15 @@ func prewarmStdioService(ctx context.Context, svc *model.MCPService) error {
 	shared := &SharedMcpInstance{
 		Server:      srv,
 		Client:      cli,
-		ServerInfo:  serverInfo,
+		ServerInfo:  initResultServerInfo(initResult),
+		InitResult:  initResult,
 		cancel:      cancel,
 		serviceID:   svc.ID,
 		serviceName: svc.Name,
 		serviceType: svc.Type,
 		cacheKey:    cacheKey,
 		stdioCmd:    stdioCmd,
+		hookService: &serviceConfig,
 	}
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -553,9 +761,23 @@ func (s *SharedMcpInstance) Shutdown(ctx context.Context) error {
 		}
 		s.stdioCmd = nil
 	}
+	s.runPostStopHook()
+	pruneToolCallScheduler(s.cacheKey)
+	pruneUpstreamErrorTracker(s.cacheKey)
 	return firstErr
 }
 
+// runPostStopHook runs the post-stop command of a stdio service once, after its server process was stopped.
+// Failures are only logged: the instance is already gone.
+func (s *SharedMcpInstance) runPostStopHook() {
+	if s.hookService == nil || s.hookService.Type != model.ServiceTypeStdio {
+		return
+	}
+	s.postStopOnce.Do(func() {
+		_ = runServiceHook(context.Background(), s.hookService, "post-stop", s.hookService.PostStopArgs())
+	})
+}
+
 func (s *SharedMcpInstance) forceTerminateStdioProcess() {
 	if s.stdioCmd == nil || s.stdioCmd.Process == nil {
 		return
@@ -578,6 +800,72 @@ func (s *SharedMcpInstance) forceTerminateStdioProcess() {
 	}
 }
 
+// RestartUserServiceInstances shuts down the running user-specific instances (all env profiles) of a service
+// so the next request starts them with the user's current configuration. It returns how many were stopped.
+func RestartUserServiceInstances(ctx context.Context, userID, serviceID int64) int {
+	prefix := UserServiceCacheKey(userID, serviceID)
+	var stopped []*SharedMcpInstance
+	sharedMCPServersMutex.Lock()
+	for key, inst := range sharedMCPServers {
+		if key == prefix || strings.HasPrefix(key, prefix+"-profile-") {
+			delete(sharedMCPServers, key)
+			stopped = append(stopped, inst)
+		}
+	}
+	sharedMCPServersMutex.Unlock()
+	if len(stopped) == 0 {
+		return 0
+	}
+
+	// 代理 handler 持有旧实例的 MCPServer，一并清除以便按新实例重建；同一服务的其他实例的会话不受影响
+	for _, inst := range stopped {
+		clearInstanceProxyHandlers(serviceID, inst.cacheKey)
+	}
+	for _, inst := range stopped {
+		if err := inst.Shutdown(ctx); err != nil {
+			common.SysError(fmt.Sprintf("Failed to shut down user %d instance of service %d for restart: %v", userID, serviceID, err))
+		}
+	}
+	common.SysLog(fmt.Sprintf("Stopped %d user-specific instance(s) of service %d for user %d; they restart on the next request", len(stopped), serviceID, userID))
+	return len(stopped)
+}
+
+// ShutdownUserInstances shuts down and removes every user-specific instance (all services and env profiles)
+// of a user, e.g. when the user is deleted. It returns how many were stopped.
+func ShutdownUserInstances(ctx context.Context, userID int64) int {
+	prefix := fmt.Sprintf("user-%d-service-", userID)
+	var stopped []*SharedMcpInstance
+	sharedMCPServersMutex.Lock()
+	for key, inst := range sharedMCPServers {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		delete(sharedMCPServers, key)
+		stopped = append(stopped, inst)
+	}
+	sharedMCPServersMutex.Unlock()
+	if len(stopped) == 0 {
+		return 0
+	}
+
+	// 代理 handler 持有已停止实例的 MCPServer，一并清除
+	for _, inst := range stopped {
+		if inst != nil {
+			clearInstanceProxyHandlers(inst.serviceID, inst.cacheKey)
+		}
+	}
+	for _, inst := range stopped {
+		if inst == nil {
+			continue
+		}
+		if err := inst.Shutdown(ctx); err != nil {
+			common.SysError(fmt.Sprintf("Failed to shut down instance of service %d for user %d: %v", inst.serviceID, userID, err))
+		}
+	}
+	common.SysLog(fmt.Sprintf("Stopped %d user-specific instance(s) of user %d", len(stopped), userID))
+	return len(stopped)
+}
+
 // ServiceStatus 表示服务的健康状态
 type ServiceStatus string
 
@@ -592,6 +880,8 @@ const (
 	StatusStarting ServiceStatus = "starting"
 	// StatusStopped 表示服务已停止
 	StatusStopped ServiceStatus = "stopped"
+	// StatusNeedsReinstall 表示服务的命令已不存在(如缓存被清理)，需要重新安装
+	StatusNeedsReinstall ServiceStatus = "needs_reinstall"
 )
 
 // ServiceHealth 包含服务健康相关的信息
@@ -608,6 +898,13 @@ type ServiceHealth struct {
 	InstanceCount int           `json:"instance_count,omitempty"`  // 实例数量（如有多实例）
 	ToolCount     int           `json:"tool_count,omitempty"`
 	ToolsFetched  bool          `json:"tools_fetched,omitempty"`
+	// 维护窗口内 Status 保持窗口开始前的值，ObservedStatus 为本次检查的实际结果
+	Maintenance      bool          `json:"maintenance,omitempty"`
+	MaintenanceUntil time.Time     `json:"maintenance_until,omitempty"`
+	ObservedStatus   ServiceStatus `json:"observed_status,omitempty"`
+	// 配置了备用端点时为当前实例连接的端点，FallbackActive 表示它不是主端点
+	ActiveEndpoint string `json:"active_endpoint,omitempty"`
+	FallbackActive bool   `json:"fallback_active,omitempty"`
 }
 
 // Service 接口定义了所有MCP服务必须实现的方法
@@ -874,6 +1171,7 @@ type MonitoredProxiedService struct {
 
 // NewMonitoredProxiedService creates a new monitored service.
 func NewMonitoredProxiedService(base *BaseService, instance *SharedMcpInstance, dbConfig *model.MCPService) *MonitoredProxiedService {
+	cacheServiceMaintenanceWindow(dbConfig)
 	return &MonitoredProxiedService{
 		BaseService:     base,
 		sharedInstance:  instance,
@@ -881,11 +1179,98 @@ func NewMonitoredProxiedService(base *BaseService, instance *SharedMcpInstance,
 	}
 }
 
-// CheckHealth for MonitoredProxiedService performs deep health checking using the shared MCP instance
+// CheckHealth for MonitoredProxiedService performs deep health checking using the shared MCP instance.
+// Within the service's startup grace period a failed check reports StatusStarting and is not counted as a failure.
 func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHealth, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	failuresBefore := s.health.FailureCount
+	health, err := s.checkHealthLocked(ctx)
+	if err == nil && health != nil && health.Status == StatusHealthy {
+		s.failBackLocked(ctx)
+	}
+	s.recordActiveEndpointLocked(health)
+	if health != nil && health.Status == StatusUnhealthy && s.inStartupGraceLocked(time.Now()) {
+		s.health.Status = StatusStarting
+		s.health.FailureCount = failuresBefore
+		s.health.WarningLevel = 0
+		healthCopy := s.health
+		return &healthCopy, nil
+	}
+	return health, err
+}
+
+// recordActiveEndpointLocked reports the endpoint of the shared instance in the health of a service with fallback
+// endpoints, on both the stored health and the returned copy. Caller must hold s.mu.
+func (s *MonitoredProxiedService) recordActiveEndpointLocked(health *ServiceHealth) {
+	s.health.ActiveEndpoint, s.health.FallbackActive = "", false
+	if s.dbServiceConfig != nil && len(s.dbServiceConfig.EndpointChain()) > 1 && s.sharedInstance != nil {
+		s.health.ActiveEndpoint = s.sharedInstance.endpoint
+		s.health.FallbackActive = s.sharedInstance.endpoint != s.dbServiceConfig.Command
+	}
+	if health != nil {
+		health.ActiveEndpoint, health.FallbackActive = s.health.ActiveEndpoint, s.health.FallbackActive
+	}
+}
+
+// failBackLocked moves a shared instance running on a fallback endpoint back to the primary endpoint once a probe of
+// the primary initializes, trying at most every endpointFailbackInterval. Caller must hold s.mu.
+func (s *MonitoredProxiedService) failBackLocked(ctx context.Context) {
+	config, current := s.dbServiceConfig, s.sharedInstance
+	if config == nil || current == nil || current.endpoint == "" || current.endpoint == config.Command || config.DisableSelfHealing || s.inMaintenanceLocked() || !failbackDue(config.ID) {
+		return
+	}
+	if err := probeEndpoint(ctx, config, config.Command); err != nil {
+		common.SysLog(fmt.Sprintf("CheckHealth: Primary endpoint of %s (ID: %d) still fails, staying on %s: %v", s.serviceName, s.serviceID, current.endpoint, err))
+		preferredEndpoints.Store(config.ID, preferredEndpoint{endpoint: current.endpoint, since: time.Now()})
+		return
+	}
+
+	common.SysLog(fmt.Sprintf("CheckHealth: Primary endpoint of %s (ID: %d) works again, moving back from %s", s.serviceName, s.serviceID, current.endpoint))
+	sharedMCPServersMutex.Lock()
+	if existing, ok := sharedMCPServers[current.cacheKey]; ok && existing == current {
+		delete(sharedMCPServers, current.cacheKey)
+	}
+	sharedMCPServersMutex.Unlock()
+	preferredEndpoints.Delete(config.ID)
+	newInstance, err := GetOrCreateSharedMcpInstanceWithKey(ctx, config, current.cacheKey, current.instanceLabel, config.DefaultEnvsJSON)
+	if err != nil {
+		// Keep serving from the fallback; the next check tries again
+		common.SysError(fmt.Sprintf("CheckHealth: Failed to re-create %s (ID: %d) on its primary endpoint: %v", s.serviceName, s.serviceID, err))
+		sharedMCPServersMutex.Lock()
+		if _, ok := sharedMCPServers[current.cacheKey]; !ok {
+			sharedMCPServers[current.cacheKey] = current
+		}
+		sharedMCPServersMutex.Unlock()
+		preferredEndpoints.Store(config.ID, preferredEndpoint{endpoint: current.endpoint, since: time.Now()})
+		return
+	}
+	s.sharedInstance = newInstance
+	clearInstanceProxyHandlers(config.ID, current.cacheKey)
+	if err := current.Shutdown(ctx); err != nil {
+		common.SysError(fmt.Sprintf("CheckHealth: Error shutting down the fallback instance of %s: %v", s.serviceName, err))
+	}
+}
+
+// inMaintenanceLocked reports whether the service is in its own or the global maintenance window, in which the
+// health check does not re-create its instance. Caller must hold s.mu.
+func (s *MonitoredProxiedService) inMaintenanceLocked() bool {
+	_, active := activeMaintenanceEnd(s.serviceID, time.Now())
+	return active
+}
+
+// inStartupGraceLocked reports whether the service was started less than HealthGracePeriod seconds ago. Caller must hold s.mu.
+func (s *MonitoredProxiedService) inStartupGraceLocked(now time.Time) bool {
+	if s.dbServiceConfig == nil || s.dbServiceConfig.HealthGracePeriod <= 0 || s.lastStartTime.IsZero() {
+		return false
+	}
+	return now.Sub(s.lastStartTime) < time.Duration(s.dbServiceConfig.HealthGracePeriod)*time.Second
+}
+
+// checkHealthLocked pings the shared instance, re-creating it when possible unless the service disabled
+// self-healing or is in a maintenance window. Caller must hold s.mu.
+func (s *MonitoredProxiedService) checkHealthLocked(ctx context.Context) (*ServiceHealth, error) {
 	// For on-demand stdio services that haven't been started yet, report as stopped without attempting self-healing
 	if s.Type() == model.ServiceTypeStdio && s.sharedInstance == nil {
 		strategy := common.OptionMap[common.OptionStdioServiceStartupStrategy]
@@ -925,6 +1310,14 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 				healthCopy.ResponseTime = s.health.ResponseTime
 				return &healthCopy, errors.New("service is disabled")
 			}
+			if s.dbServiceConfig.DisableSelfHealing {
+				common.SysLog(fmt.Sprintf("CheckHealth: Self-healing is disabled for %s (ID: %d), not re-creating the instance", s.serviceName, s.serviceID))
+				return &healthCopy, errors.New(s.health.ErrorMessage)
+			}
+			if s.inMaintenanceLocked() {
+				common.SysLog(fmt.Sprintf("CheckHealth: %s (ID: %d) is in a maintenance window, not re-creating the instance", s.serviceName, s.serviceID))
+				return &healthCopy, errors.New(s.health.ErrorMessage)
+			}
 
 			common.SysLog(fmt.Sprintf("CheckHealth: Instance for %s (ID: %d) is nil, attempting re-initialization.", s.serviceName, s.serviceID))
 			cacheKey := fmt.Sprintf("global-service-%d-shared", s.dbServiceConfig.ID)
@@ -933,14 +1326,14 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 
 			newInstance, recreateErr := GetOrCreateSharedMcpInstanceWithKey(ctx, s.dbServiceConfig, cacheKey, instanceNameDetail, effectiveEnvs)
 			if recreateErr != nil {
-				s.health.Status = StatusUnhealthy
+				s.health.Status = healthStatusForError(recreateErr)
 				s.health.ErrorMessage = fmt.Sprintf("Initial re-creation attempt failed: %v", recreateErr)
 				common.SysError(fmt.Sprintf("Failed to recreate shared instance for %s from CheckHealth (initial nil): %v", s.serviceName, recreateErr))
 				healthCopy.Status = s.health.Status
 				healthCopy.ErrorMessage = s.health.ErrorMessage
 				healthCopy.LastChecked = s.health.LastChecked
 				healthCopy.ResponseTime = s.health.ResponseTime
-				return &healthCopy, errors.New(s.health.ErrorMessage)
+				return &healthCopy, fmt.Errorf("initial re-creation attempt failed: %w", recreateErr)
 			}
 			s.sharedInstance = newInstance
 			common.SysLog(fmt.Sprintf("Successfully re-created shared MCP instance for %s from CheckHealth (initial nil). Performing immediate re-ping.", s.serviceName))
@@ -973,13 +1366,18 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 		}
 		return &healthCopy, errors.New(s.health.ErrorMessage)
 	}
-	originalPingErr := s.sharedInstance.Client.Ping(ctx)
+	originalPingErr := s.pingLocked(ctx)
 	finalErrToReturn := originalPingErr
 
 	if originalPingErr != nil {
 		serviceType := s.Type() // Get the service type from BaseService
+		var endpointErr *healthEndpointError
 
-		if serviceType == model.ServiceTypeSSE || serviceType == model.ServiceTypeStreamableHTTP {
+		if errors.As(originalPingErr, &endpointErr) {
+			// The server answered its health endpoint, so the client connection is not the problem
+			s.health.Status = StatusUnhealthy
+			s.health.ErrorMessage = originalPingErr.Error()
+		} else if serviceType == model.ServiceTypeSSE || serviceType == model.ServiceTypeStreamableHTTP {
 			common.SysLog(fmt.Sprintf("CheckHealth: Detected ping failure for network service %s (ID: %d, Type: %s): %v. Attempting to re-establish client.", s.serviceName, s.serviceID, serviceType, originalPingErr))
 
 			if s.dbServiceConfig == nil {
@@ -992,6 +1390,21 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 				s.health.Status = StatusStopped
 				s.health.ErrorMessage = "Service is disabled"
 				finalErrToReturn = errors.New("service is disabled")
+			} else if s.dbServiceConfig.DisableSelfHealing {
+				// The instance is kept as is so the failure stays visible until the service is restarted manually
+				common.SysLog(fmt.Sprintf("CheckHealth: Self-healing is disabled for %s (ID: %d), not re-creating the client", s.serviceName, s.serviceID))
+				s.health.Status = StatusUnhealthy
+				s.health.ErrorMessage = fmt.Sprintf("Ping failed: %v (self-healing disabled, restart the service manually)", originalPingErr)
+			} else if s.inMaintenanceLocked() {
+				// Planned downtime: the instance is re-created by the first check after the window
+				common.SysLog(fmt.Sprintf("CheckHealth: %s (ID: %d) is in a maintenance window, not re-creating the client", s.serviceName, s.serviceID))
+				s.health.Status = StatusUnhealthy
+				s.health.ErrorMessage = fmt.Sprintf("Ping failed: %v (maintenance window, not re-creating the client)", originalPingErr)
+			} else if s.inStartupGraceLocked(time.Now()) {
+				// A just-started server may not answer yet; CheckHealth reports it as starting instead
+				common.SysLog(fmt.Sprintf("CheckHealth: %s (ID: %d) is within its startup grace period, not re-creating the client", s.serviceName, s.serviceID))
+				s.health.Status = StatusUnhealthy
+				s.health.ErrorMessage = fmt.Sprintf("Ping failed: %v (startup grace period, not re-creating the client)", originalPingErr)
 			} else {
 				cacheKey := fmt.Sprintf("global-service-%d-shared", s.dbServiceConfig.ID)
 				instanceToShutdown := s.sharedInstance
@@ -1058,6 +1471,16 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 		finalErrToReturn = nil
 	}
 
+	// Opt-in deep check: a service may answer Ping but be unable to list its tools
+	if finalErrToReturn == nil && s.health.Status == StatusHealthy && s.dbServiceConfig != nil && s.dbServiceConfig.DeepHealthCheck {
+		if deepErr := s.checkToolsListingLocked(ctx); deepErr != nil {
+			s.health.Status = StatusUnhealthy
+			s.health.ErrorMessage = deepErr.Error()
+			s.health.FailureCount++
+			finalErrToReturn = deepErr
+		}
+	}
+
 	s.health.LastChecked = time.Now()
 	s.health.ResponseTime = time.Since(startTime).Milliseconds()
 
@@ -1079,6 +1502,67 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 	return &healthCopy, finalErrToReturn
 }
 
+// pingLocked checks that the service answers. Stdio services with a probe command run the probe instead of an
+// MCP Ping, which is cheaper for servers where a full round-trip is expensive. SSE/HTTP services with a health
+// check URL are checked with a GET to it; only when the endpoint cannot be reached does this fall back to the
+// MCP Ping. Caller must hold s.mu.
+func (s *MonitoredProxiedService) pingLocked(ctx context.Context) error {
+	if s.Type() == model.ServiceTypeStdio && s.dbServiceConfig != nil && s.dbServiceConfig.ProbeCommand != "" {
+		return runServiceProbe(ctx, s.dbServiceConfig)
+	}
+	if s.Type() != model.ServiceTypeStdio && s.dbServiceConfig != nil && s.dbServiceConfig.HealthCheckURL != "" {
+		err := checkHealthEndpoint(ctx, s.dbServiceConfig)
+		var endpointErr *healthEndpointError
+		if err == nil || errors.As(err, &endpointErr) {
+			return err
+		}
+		common.SysLog(fmt.Sprintf("CheckHealth: %v, falling back to MCP ping for %s (ID: %d)", err, s.serviceName, s.serviceID))
+	}
+	return s.sharedInstance.Client.Ping(ctx)
+}
+
+// checkToolsListingLocked calls ListTools on the shared instance. It fails when ListTools errors,
+// or when it returns no tools although the service previously exposed some.
+// On success the tools cache and tool count are refreshed. Caller must hold s.mu.
+func (s *MonitoredProxiedService) checkToolsListingLocked(ctx context.Context) error {
+	if s.sharedInstance == nil || s.sharedInstance.Client == nil {
+		return errors.New("deep health check: client is not initialized")
+	}
+	result, err := s.sharedInstance.Client.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		return fmt.Errorf("deep health check: ListTools failed: %w", err)
+	}
+	var tools []mcp.Tool
+	if result != nil {
+		tools = result.Tools
+	}
+
+	toolsCache := GetToolsCacheManager()
+	previousCount := s.health.ToolCount
+	if entry, found := toolsCache.GetServiceTools(s.serviceID); found && len(entry.Tools) > previousCount {
+		previousCount = len(entry.Tools)
+	}
+	if len(tools) == 0 && previousCount > 0 {
+		return fmt.Errorf("deep health check: ListTools returned no tools (previously %d)", previousCount)
+	}
+
+	s.health.ToolCount = len(tools)
+	s.health.ToolsFetched = true
+	if len(tools) > 0 {
+		toolsCache.SetServiceTools(s.serviceID, &ToolsCacheEntry{Tools: tools, FetchedAt: time.Now()})
+	}
+	return nil
+}
+
+// UpdateDBConfig replaces the stored service configuration used by health checks and
+// instance re-creation. It does not restart the running instance.
+func (s *MonitoredProxiedService) UpdateDBConfig(dbConfig *model.MCPService) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dbServiceConfig = dbConfig
+	cacheServiceMaintenanceWindow(dbConfig)
+}
+
 // Start for MonitoredProxiedService properly recreates the SharedMcpInstance when starting
 func (s *MonitoredProxiedService) Start(ctx context.Context) error {
 	// First call the base Start method to update basic state
@@ -1145,21 +1629,7 @@ func (s *MonitoredProxiedService) Stop(ctx context.Context) error {
 			}
 
 			// Also clear handler caches that reference the old SharedMcpInstance
-			sseHandlerCacheKey := fmt.Sprintf("service-%d-sseproxy", s.dbServiceConfig.ID)
-			sseWrappersMutex.Lock()
-			if _, exists := initializedSSEProxyWrappers[sseHandlerCacheKey]; exists {
-				delete(initializedSSEProxyWrappers, sseHandlerCacheKey)
-				common.SysLog(fmt.Sprintf("Cleared SSE handler cache for service %s (key: %s)", s.serviceName, sseHandlerCacheKey))
-			}
-			sseWrappersMutex.Unlock()
-
-			httpHandlerCacheKey := fmt.Sprintf("service-%d-httpproxy", s.dbServiceConfig.ID)
-			httpWrappersMutex.Lock()
-			if _, exists := initializedHTTPProxyWrappers[httpHandlerCacheKey]; exists {
-				delete(initializedHTTPProxyWrappers, httpHandlerCacheKey)
-				common.SysLog(fmt.Sprintf("Cleared HTTP handler cache for service %s (key: %s)", s.serviceName, httpHandlerCacheKey))
-			}
-			httpWrappersMutex.Unlock()
+			ClearProxyHandlerCaches(s.dbServiceConfig.ID)
 		}
 
 		s.sharedInstance = nil // Clear the reference
@@ -1255,6 +1725,14 @@ func updateServiceDescriptionFromInitResult(service *model.MCPService, initResul
 	}
 }
 
+// initResultServerInfo returns the server info of an Initialize result, or nil without one
+func initResultServerInfo(initResult *mcp.InitializeResult) *mcp.Implementation {
+	if initResult == nil {
+		return nil
+	}
+	return &initResult.ServerInfo
+}
+
 func getInitResultServerInfoDescription(initResult *mcp.InitializeResult) string {
 	if initResult == nil {
 		return ""
@@ -1309,21 +1787,159 @@ func getInitResultServerInfoName(initResult *mcp.InitializeResult) string {
 	return name
 }
 
-// createActualMcpGoServerAndClientUncached creates and initializes an mcp-go client and server instance.
-// For Stdio clients, client.Start() is not called.
-// It returns the mcp-go server, the mcp-go client, any spawned stdio command, tools, server info, and an error.
+// preferredEndpoints remembers per service ID the endpoint that last initialized successfully (a preferredEndpoint),
+// so re-creating an instance tries it before the rest of the fallback chain.
+var preferredEndpoints sync.Map
+
+// endpointFailbackInterval is how long a service stays on a fallback endpoint before the primary is tried again,
+// both when its instance is re-created and by the health check of a running instance
+var endpointFailbackInterval = 5 * time.Minute
+
+// preferredEndpoint is the endpoint a service last initialized on, and when the primary endpoint was last given up on
+type preferredEndpoint struct {
+	endpoint string
+	since    time.Time
+}
+
+// endpointAttemptOrder returns the endpoint chain of the service with the last working endpoint moved to the front.
+// A fallback endpoint stops being preferred after endpointFailbackInterval, so the primary is tried first again.
+func endpointAttemptOrder(svc *model.MCPService) []string {
+	chain := svc.EndpointChain()
+	value, ok := preferredEndpoints.Load(svc.ID)
+	if !ok {
+		return chain
+	}
+	preferred := value.(preferredEndpoint)
+	if time.Since(preferred.since) >= endpointFailbackInterval {
+		return chain
+	}
+	if index := slices.Index(chain, preferred.endpoint); index > 0 {
+		chain = append([]string{chain[index]}, slices.Delete(slices.Clone(chain), index, index+1)...)
+	}
+	return chain
+}
+
+// failbackDue reports whether a service running on a fallback endpoint should try its primary endpoint again
+func failbackDue(serviceID int64) bool {
+	value, ok := preferredEndpoints.Load(serviceID)
+	return !ok || time.Since(value.(preferredEndpoint).since) >= endpointFailbackInterval
+}
+
+// endpointAttemptContext bounds one endpoint attempt to an equal share of the handshake time left for the remaining
+// endpoints, so an endpoint that hangs until the deadline does not leave the ones after it without time
+func endpointAttemptContext(handshakeCtx context.Context, remaining int) (context.Context, context.CancelFunc) {
+	deadline, ok := handshakeCtx.Deadline()
+	if !ok || remaining <= 1 {
+		return context.WithCancel(handshakeCtx)
+	}
+	return context.WithTimeout(handshakeCtx, time.Until(deadline)/time.Duration(remaining))
+}
+
+// probeEndpoint initializes a throwaway instance of svc on endpoint and shuts it down again
+func probeEndpoint(ctx context.Context, svc *model.MCPService, endpoint string) error {
+	serviceConfig := *svc // shallow copy to avoid mutating caller
+	serviceConfig.DefaultEnvsJSON = svc.ActiveDefaultEnvsJSON()
+	serviceConfig.Command = endpoint
+	if err := ensureOAuthToken(ctx, &serviceConfig, false); err != nil {
+		return err
+	}
+
+	bgCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cacheKey := fmt.Sprintf("probe-service-%d-%d", svc.ID, time.Now().UnixNano())
+	srv, cli, stdioCmd, _, _, err := createMcpGoServerAndClientForEndpoint(asThrowawayInstance(ctx), bgCtx, cacheKey, &serviceConfig, fmt.Sprintf("probe-%d", svc.ID), nil)
+	if err != nil {
+		return err
+	}
+	instance := &SharedMcpInstance{
+		Server:      srv,
+		Client:      cli,
+		cancel:      cancel,
+		serviceID:   svc.ID,
+		serviceName: svc.Name,
+		serviceType: svc.Type,
+		cacheKey:    cacheKey,
+		stdioCmd:    stdioCmd,
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+	_ = instance.Shutdown(shutdownCtx)
+	return nil
+}
+
+// createActualMcpGoServerAndClientUncached creates and initializes an mcp-go client and server instance, trying the
+// service's fallback endpoints in order when one fails to initialize. On success serviceConfigForInstance.Command
+// is set to the endpoint that was used. For Stdio clients, client.Start() is not called.
+// It returns the mcp-go server, the mcp-go client, any spawned stdio command, tools, the initialize result, and an error.
 func createActualMcpGoServerAndClientUncached(
 	handshakeCtx context.Context,
 	runtimeCtx context.Context,
 	cacheKey string,
 	serviceConfigForInstance *model.MCPService,
 	instanceNameDetail string,
-) (*mcpserver.MCPServer, mcpclient.MCPClient, *exec.Cmd, []mcp.Tool, *mcp.Implementation, error) {
+	relay *upstreamRequestRelay,
+) (*mcpserver.MCPServer, mcpclient.MCPClient, *exec.Cmd, []mcp.Tool, *mcp.InitializeResult, error) {
+	chain := endpointAttemptOrder(serviceConfigForInstance)
+	if len(chain) == 1 {
+		return createMcpGoServerAndClientForEndpoint(handshakeCtx, runtimeCtx, cacheKey, serviceConfigForInstance, instanceNameDetail, relay)
+	}
+
+	var errs []error
+	for i, endpoint := range chain {
+		if i > 0 && handshakeCtx.Err() != nil {
+			break
+		}
+		attempt := *serviceConfigForInstance
+		attempt.Command = endpoint
+		attemptCtx, attemptCancel := endpointAttemptContext(handshakeCtx, len(chain)-i)
+		srv, cli, stdioCmd, tools, initResult, err := createMcpGoServerAndClientForEndpoint(attemptCtx, runtimeCtx, cacheKey, &attempt, instanceNameDetail, relay)
+		attemptCancel()
+		if err == nil {
+			if endpoint != serviceConfigForInstance.Command {
+				common.SysLog(fmt.Sprintf("Service %s (ID: %d) failed over to endpoint %s", serviceConfigForInstance.Name, serviceConfigForInstance.ID, endpoint))
+			}
+			if !isThrowawayInstance(handshakeCtx) {
+				preferredEndpoints.Store(serviceConfigForInstance.ID, preferredEndpoint{endpoint: endpoint, since: time.Now()})
+			}
+			serviceConfigForInstance.Command = endpoint
+			return srv, cli, stdioCmd, tools, initResult, nil
+		}
+		common.SysError(fmt.Sprintf("Endpoint %d/%d of service %s (ID: %d) failed: %v", i+1, len(chain), serviceConfigForInstance.Name, serviceConfigForInstance.ID, err))
+		errs = append(errs, err)
+	}
+	if !isThrowawayInstance(handshakeCtx) {
+		preferredEndpoints.Delete(serviceConfigForInstance.ID)
+	}
+	return nil, nil, nil, nil, nil, fmt.Errorf("all %d endpoints of service %s failed: %w", len(chain), serviceConfigForInstance.Name, errors.Join(errs...))
+}
+
+// updateInstalledVersion stores the version reported by the upstream on the service record
+func updateInstalledVersion(serviceID int64, version string) error {
+	service, err := model.GetServiceByID(serviceID)
+	if err != nil {
+		return err
+	}
+	service.InstalledVersion = version
+	return model.UpdateService(service)
+}
+
+// createMcpGoServerAndClientForEndpoint creates and initializes an mcp-go client and server instance for
+// serviceConfigForInstance.Command, the upstream URL or stdio command.
+func createMcpGoServerAndClientForEndpoint(
+	handshakeCtx context.Context,
+	runtimeCtx context.Context,
+	cacheKey string,
+	serviceConfigForInstance *model.MCPService,
+	instanceNameDetail string,
+	relay *upstreamRequestRelay,
+) (*mcpserver.MCPServer, mcpclient.MCPClient, *exec.Cmd, []mcp.Tool, *mcp.InitializeResult, error) {
 
 	var mcpGoClient mcpclient.MCPClient
 	var err error
 	var needManualStart bool
 	var stdioCmd *exec.Cmd
+	var stderrLines *stderrTail  // stdio only
+	var stdoutLines *stdoutNoise // stdio only
 
 	switch serviceConfigForInstance.Type {
 	case model.ServiceTypeStdio:
@@ -1336,13 +1952,11 @@ func createActualMcpGoServerAndClientUncached(
 				"PackageManager: %s, SourcePackageName: %s, InstanceDetail: %s",
 				serviceConfigForInstance.Name, serviceConfigForInstance.ID, serviceConfigForInstance.PackageManager, serviceConfigForInstance.SourcePackageName, instanceNameDetail)
 		}
-		if serviceConfigForInstance.ArgsJSON != "" {
-			if errJson := json.Unmarshal([]byte(serviceConfigForInstance.ArgsJSON), &stdioConf.Args); errJson != nil {
-				common.SysError(fmt.Sprintf("Failed to unmarshal ArgsJSON for service %s (ID: %d, Stdio): %v. Args will be empty.", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errJson))
-				stdioConf.Args = []string{}
-			}
-		} else {
+		if args, errArgs := serviceConfigForInstance.CommandArgs(); errArgs != nil {
+			common.SysError(fmt.Sprintf("Failed to build args for service %s (ID: %d, Stdio): %v. Args will be empty.", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errArgs))
 			stdioConf.Args = []string{}
+		} else {
+			stdioConf.Args = append([]string{}, args...)
 		}
 		stdioConf.Env = []string{}
 		if serviceConfigForInstance.DefaultEnvsJSON != "" && serviceConfigForInstance.DefaultEnvsJSON != "{}" {
@@ -1362,66 +1976,85 @@ func createActualMcpGoServerAndClientUncached(
 				envKeys = append(envKeys, parts[0])
 			}
 		}
-		common.SysLog(fmt.Sprintf("Stdio config for %s: Command=%s, Args=%v, EnvKeys=%v", serviceConfigForInstance.Name, stdioConf.Command, stdioConf.Args, envKeys))
-		stdioOption := transport.WithCommandFunc(func(cmdCtx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
-			if cmdCtx == nil {
-				cmdCtx = context.Background()
+		workDir := ""
+		if serviceConfigForInstance.WorkingDir != "" {
+			validDir, dirErr := common.ValidateWorkingDir(serviceConfigForInstance.WorkingDir)
+			if dirErr != nil {
+				errMsg := fmt.Sprintf("Invalid working directory for service %s (ID: %d): %v", serviceConfigForInstance.Name, serviceConfigForInstance.ID, dirErr)
+				if saveErr := model.SaveMCPLog(runtimeCtx, serviceConfigForInstance.ID, serviceConfigForInstance.Name, model.MCPLogPhaseRun, model.MCPLogLevelError, errMsg); saveErr != nil {
+					common.SysError(fmt.Sprintf("Failed to save MCP config error log for %s: %v", serviceConfigForInstance.Name, saveErr))
+				}
+				return nil, nil, nil, nil, nil, errors.New(errMsg)
+			}
+			workDir = validDir
+		}
+		common.SysLog(fmt.Sprintf("Stdio config for %s: Command=%s, Args=%v, EnvKeys=%v, WorkingDir=%s", serviceConfigForInstance.Name, stdioConf.Command, stdioConf.Args, envKeys, workDir))
+		if preStart := serviceConfigForInstance.PreStartArgs(); len(preStart) > 0 && !isThrowawayInstance(handshakeCtx) {
+			if hookErr := runServiceHook(handshakeCtx, serviceConfigForInstance, "pre-start", preStart); hookErr != nil {
+				return nil, nil, nil, nil, nil, fmt.Errorf("aborted start of service %s (ID: %d): %w", serviceConfigForInstance.Name, serviceConfigForInstance.ID, hookErr)
 			}
-			cmd := exec.CommandContext(cmdCtx, command, args...)
-			cmd.Env = append(os.Environ(), env...)
-			stdioCmd = cmd
-			return cmd, nil
-		})
-		mcpGoClient, err = mcpclient.NewStdioMCPClientWithOptions(stdioConf.Command, stdioConf.Env, stdioConf.Args, stdioOption)
+		}
+		stdioCmd = buildStdioCmd(context.Background(), stdioConf.Command, stdioConf.Env, stdioConf.Args, workDir)
+		stdoutLines = &stdoutNoise{}
+		mcpGoClient, err = newStdioMCPClient(stdioCmd, stdoutLines, relay.clientOptions())
 		if err == nil {
 			// Capture stderr output from the subprocess to get detailed error messages
 			if client, ok := mcpGoClient.(*mcpclient.Client); ok {
 				if stderrReader, hasStderr := mcpclient.GetStderr(client); hasStderr {
+					stderrLines = newStderrTail()
 					go func() {
-						scanner := bufio.NewScanner(stderrReader)
-						for scanner.Scan() {
-							line := scanner.Text()
-							if line != "" {
-								// Skip benign close-related lines
-								if isBenignStderrLine(line) {
-									// Optional: one-line info for visibility (not error, not DB)
-									// common.SysLog(fmt.Sprintf("Process stderr closed for %s (benign): %s", serviceConfigForInstance.Name, line))
-									continue
-								}
-								// Classify log level based on message content
-								logLevel := classifyStderrLogLevel(line)
-
-								// Log to system log (use appropriate level)
-								if logLevel == model.MCPLogLevelError {
-									common.SysError(fmt.Sprintf("Stderr from %s: %s", serviceConfigForInstance.Name, line))
-								} else {
-									common.SysLog(fmt.Sprintf("Stderr from %s: %s", serviceConfigForInstance.Name, line))
-								}
+						defer close(stderrLines.done)
+						// A panic while handling a line is logged and scanning resumes on the same pipe.
+						runWithPanicRestart(serviceConfigForInstance.ID, serviceConfigForInstance.Name, "stderr scanner", func() {
+							scanner := bufio.NewScanner(stderrReader)
+							for scanner.Scan() {
+								line := scanner.Text()
+								if line != "" {
+									stderrLines.add(line)
+									// Skip benign close-related lines
+									if isBenignStderrLine(line) {
+										// Optional: one-line info for visibility (not error, not DB)
+										// common.SysLog(fmt.Sprintf("Process stderr closed for %s (benign): %s", serviceConfigForInstance.Name, line))
+										continue
+									}
+									// Classify log level based on message content
+									logLevel := classifyStderrLogLevel(line)
+
+									// Log to system log (use appropriate level)
+									if logLevel == model.MCPLogLevelError {
+										common.SysError(fmt.Sprintf("Stderr from %s: %s", serviceConfigForInstance.Name, line))
+									} else {
+										common.SysLog(fmt.Sprintf("Stderr from %s: %s", serviceConfigForInstance.Name, line))
+									}
 
-								// Save to database with throttling to prevent high-frequency writes
-								if globalStderrThrottler.shouldLog(serviceConfigForInstance.ID, line) {
-									if err := model.SaveMCPLog(runtimeCtx, serviceConfigForInstance.ID, serviceConfigForInstance.Name, model.MCPLogPhaseRun, logLevel, line); err != nil {
-										common.SysError(fmt.Sprintf("Failed to save MCP log for %s: %v", serviceConfigForInstance.Name, err))
+									// Save to database with throttling to prevent high-frequency writes
+									if globalStderrThrottler.shouldLog(serviceConfigForInstance.ID, line) {
+										if err := model.SaveMCPLog(runtimeCtx, serviceConfigForInstance.ID, serviceConfigForInstance.Name, model.MCPLogPhaseRun, logLevel, line); err != nil {
+											common.SysError(fmt.Sprintf("Failed to save MCP log for %s: %v", serviceConfigForInstance.Name, err))
+										}
 									}
 								}
 							}
-						}
-						if err := scanner.Err(); err != nil {
-							// Skip benign/normal closure errors
-							if isBenignPipeClosedError(err) {
-								// common.SysLog(fmt.Sprintf("Process stderr closed for %s (benign): %v", serviceConfigForInstance.Name, err))
-								return
-							}
-							errMsg := fmt.Sprintf("Error reading stderr from %s: %v", serviceConfigForInstance.Name, err)
-							common.SysError(errMsg)
-							// Also save scanner error to database
-							if saveErr := model.SaveMCPLog(runtimeCtx, serviceConfigForInstance.ID, serviceConfigForInstance.Name, model.MCPLogPhaseRun, model.MCPLogLevelError, errMsg); saveErr != nil {
-								common.SysError(fmt.Sprintf("Failed to save MCP scanner error log for %s: %v", serviceConfigForInstance.Name, saveErr))
+							if err := scanner.Err(); err != nil {
+								// Skip benign/normal closure errors
+								if isBenignPipeClosedError(err) {
+									// common.SysLog(fmt.Sprintf("Process stderr closed for %s (benign): %v", serviceConfigForInstance.Name, err))
+									return
+								}
+								errMsg := fmt.Sprintf("Error reading stderr from %s: %v", serviceConfigForInstance.Name, err)
+								common.SysError(errMsg)
+								// Also save scanner error to database
+								if saveErr := model.SaveMCPLog(runtimeCtx, serviceConfigForInstance.ID, serviceConfigForInstance.Name, model.MCPLogPhaseRun, model.MCPLogLevelError, errMsg); saveErr != nil {
+									common.SysError(fmt.Sprintf("Failed to save MCP scanner error log for %s: %v", serviceConfigForInstance.Name, saveErr))
+								}
 							}
-						}
+						})
 					}()
 				}
 			}
+			if stderrLines == nil {
+				common.SysLog(fmt.Sprintf("Stderr of %s is not available (client %T); initialization failures will report the process exit status instead", serviceConfigForInstance.Name, mcpGoClient))
+			}
 		}
 		needManualStart = false
 
@@ -1448,15 +2081,15 @@ func createActualMcpGoServerAndClientUncached(
 		common.SysLog(fmt.Sprintf("SSE config for %s: URL=%s, HeaderKeys=%v", serviceConfigForInstance.Name, url, headerKeys))
 		// Use debug HTTP client to log response headers and detect gzip issues
 		debugHTTPClient := &http.Client{
-			Transport: &gzipDecompressTransport{
+			Transport: &upstreamStatusTransport{base: &gzipDecompressTransport{
 				base:        http.DefaultTransport,
 				serviceName: serviceConfigForInstance.Name,
-			},
+			}},
 		}
 		if len(headers) > 0 {
-			mcpGoClient, err = mcpclient.NewSSEMCPClient(url, mcpclient.WithHeaders(headers), mcpclient.WithHTTPClient(debugHTTPClient))
+			mcpGoClient, err = mcpclient.NewSSEMCPClient(url, mcpclient.WithHeaders(headers), mcpclient.WithHeaderFunc(upstreamHeaderFunc(serviceConfigForInstance)), mcpclient.WithHTTPClient(debugHTTPClient))
 		} else {
-			mcpGoClient, err = mcpclient.NewSSEMCPClient(url, mcpclient.WithHTTPClient(debugHTTPClient))
+			mcpGoClient, err = mcpclient.NewSSEMCPClient(url, mcpclient.WithHeaderFunc(upstreamHeaderFunc(serviceConfigForInstance)), mcpclient.WithHTTPClient(debugHTTPClient))
 		}
 		needManualStart = true
 
@@ -1484,18 +2117,26 @@ func createActualMcpGoServerAndClientUncached(
 
 		// Use debug HTTP client to log response headers and detect gzip issues
 		debugHTTPClient := &http.Client{
-			Transport: &gzipDecompressTransport{
+			Transport: &upstreamStatusTransport{base: &gzipDecompressTransport{
 				base:        http.DefaultTransport,
 				serviceName: serviceConfigForInstance.Name,
-			},
+			}},
 		}
 		var streamableOptions []transport.StreamableHTTPCOption
-		streamableOptions = append(streamableOptions, transport.WithHTTPBasicClient(debugHTTPClient))
+		streamableOptions = append(streamableOptions, transport.WithHTTPBasicClient(debugHTTPClient), transport.WithHTTPHeaderFunc(upstreamHeaderFunc(serviceConfigForInstance)))
 		if len(headers) > 0 {
 			streamableOptions = append(streamableOptions, transport.WithHTTPHeaders(headers))
 		}
 
-		mcpGoClient, err = mcpclient.NewStreamableHttpClient(url, streamableOptions...)
+		if relay != nil {
+			// 服务端发起的请求（sampling、roots）可能通过 GET 监听流下发，需要保持监听
+			streamableOptions = append(streamableOptions, transport.WithContinuousListening())
+		}
+		var streamableTransport *transport.StreamableHTTP
+		streamableTransport, err = transport.NewStreamableHTTP(url, streamableOptions...)
+		if err == nil {
+			mcpGoClient = mcpclient.NewClient(streamableTransport, relay.clientOptions()...)
+		}
 		needManualStart = true
 
 	default:
@@ -1504,6 +2145,11 @@ func createActualMcpGoServerAndClientUncached(
 
 	if err != nil { // Consolidated error check after switch
 		errMsg := fmt.Sprintf("Failed to create mcp-go client for %s (Type: %s, %s): %v", serviceConfigForInstance.Name, serviceConfigForInstance.Type, instanceNameDetail, err)
+		var returnErr error = errors.New(errMsg)
+		if serviceConfigForInstance.Type == model.ServiceTypeStdio && isMissingCommandError(err, nil) {
+			returnErr = missingCommandError(serviceConfigForInstance.Name, instanceNameDetail, serviceConfigForInstance.Command, err)
+			errMsg = returnErr.Error()
+		}
 		common.SysError(errMsg)
 
 		// Save client creation failure to database
@@ -1511,7 +2157,7 @@ func createActualMcpGoServerAndClientUncached(
 			common.SysError(fmt.Sprintf("Failed to save MCP client creation error log for %s: %v", serviceConfigForInstance.Name, saveErr))
 		}
 
-		return nil, nil, nil, nil, nil, errors.New(errMsg)
+		return nil, nil, nil, nil, nil, returnErr
 	}
 
 	// Call client.Start() if needed
@@ -1537,6 +2183,9 @@ func createActualMcpGoServerAndClientUncached(
 			if closeErr := mcpGoClient.Close(); closeErr != nil {
 				common.SysError(fmt.Sprintf("Failed to close mcp-go client for %s (%s) after Start() error: %v", serviceConfigForInstance.Name, instanceNameDetail, closeErr))
 			}
+			if errors.Is(startErr, transport.ErrUnauthorized) {
+				return nil, nil, nil, nil, nil, fmt.Errorf("%w: %s", ErrUpstreamUnauthorized, errMsg)
+			}
 			return nil, nil, nil, nil, nil, errors.New(errMsg)
 		}
 
@@ -1549,10 +2198,18 @@ func createActualMcpGoServerAndClientUncached(
 	}
 
 	initRequest := mcp.InitializeRequest{}
-	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ProtocolVersion = AdvertisedProtocolVersion()
 	initRequest.Params.ClientInfo = clientInfo
 
-	initResult, err := mcpGoClient.Initialize(handshakeCtx, initRequest)
+	initializeTimeout := initializeTimeoutFor(handshakeCtx)
+	initCtx, cancelInit := handshakeCtx, context.CancelFunc(func() {})
+	if initializeTimeout > 0 {
+		initCtx, cancelInit = context.WithTimeout(handshakeCtx, initializeTimeout)
+	}
+	initResult, err := mcpGoClient.Initialize(initCtx, initRequest)
+	// Only our own initialize deadline counts as a timeout, not the end of the overall handshake or a cancellation
+	initTimedOut := err != nil && initializeTimeout > 0 && errors.Is(initCtx.Err(), context.DeadlineExceeded) && handshakeCtx.Err() == nil
+	cancelInit()
 	if err != nil {
 		// Give stderr some time to output error details before we return
 		// This helps capture the actual error messages from the subprocess
@@ -1562,7 +2219,46 @@ func createActualMcpGoServerAndClientUncached(
 		if closeErr != nil {
 			common.SysError(fmt.Sprintf("Failed to close mcp-go client for %s (%s) after initialization error: %v", serviceConfigForInstance.Name, instanceNameDetail, closeErr))
 		}
-		errMsg := fmt.Sprintf("Failed to initialize mcp-go client for %s (%s): %v. Check stderr logs for detailed error messages from the subprocess.", serviceConfigForInstance.Name, instanceNameDetail, err)
+		hint := "Check stderr logs for detailed error messages from the subprocess."
+		// 拿不到 stderr 时至少报告进程的退出状态，避免初始化失败无迹可查
+		if serviceConfigForInstance.Type == model.ServiceTypeStdio && stderrLines == nil {
+			hint = fmt.Sprintf("Stderr of the subprocess was not available; %s.", describeProcessExit(stdioCmd))
+		}
+		errMsg := fmt.Sprintf("Failed to initialize mcp-go client for %s (%s): %v. %s", serviceConfigForInstance.Name, instanceNameDetail, err, hint)
+		var returnErr error = errors.New(errMsg)
+		if initTimedOut {
+			errMsg = fmt.Sprintf("%s (%s) did not answer the MCP initialize request within %s. Servers that load indexes or models "+
+				"on startup may need longer: raise McpInitializeTimeout (env MCP_INITIALIZE_TIMEOUT, e.g. \"2m\"). %s",
+				serviceConfigForInstance.Name, instanceNameDetail, initializeTimeout, hint)
+			returnErr = fmt.Errorf("%w: %s", ErrInitializeTimeout, errMsg)
+		} else if errors.Is(err, transport.ErrUnauthorized) {
+			returnErr = fmt.Errorf("%w: %s", ErrUpstreamUnauthorized, errMsg)
+		}
+
+		// 进程很快退出且 stderr 输出的是用法/帮助信息：多半是包的默认入口不是 MCP server
+		if stderrLines != nil && isEarlyExitInitError(err) {
+			if lines := stderrLines.snapshot(500 * time.Millisecond); looksLikeUsageOutput(lines) {
+				errMsg = fmt.Sprintf("%s (%s) exited without speaking the MCP stdio protocol and printed usage/help output instead. "+
+					"The package may not be an MCP server, or its command/args do not launch the MCP server entrypoint "+
+					"(check the bin name or required subcommand such as 'mcp' or 'serve'). Output: %s",
+					serviceConfigForInstance.Name, instanceNameDetail, strings.Join(lines, " | "))
+				returnErr = fmt.Errorf("%w: %s", ErrNotMCPServer, errMsg)
+			}
+		}
+		// 启动器(npx、uvx 或 shell 包装脚本)以 127 退出：要运行的命令已不存在
+		if serviceConfigForInstance.Type == model.ServiceTypeStdio && !errors.Is(returnErr, ErrNotMCPServer) && isMissingCommandError(nil, stdioCmd) {
+			returnErr = missingCommandError(serviceConfigForInstance.Name, instanceNameDetail, serviceConfigForInstance.Command, err)
+			errMsg = returnErr.Error()
+		}
+		// stdout 上出现了非 JSON-RPC 输出（日志、横幅等）：给出具体原因而不是笼统的初始化失败
+		if !errors.Is(returnErr, ErrNotMCPServer) && !errors.Is(returnErr, ErrCommandNotFound) {
+			if noise := stdoutLines.snapshot(); len(noise) > 0 {
+				errMsg = fmt.Sprintf("%s (%s): %v. The server must write only JSON-RPC messages to stdout and send logs to stderr. "+
+					"Initialize error: %v. Offending output: %s",
+					serviceConfigForInstance.Name, instanceNameDetail, ErrNonProtocolStdout, err, strings.Join(noise, " | "))
+				returnErr = fmt.Errorf("%w: %s", ErrNonProtocolStdout, errMsg)
+			}
+		}
 		common.SysError(errMsg)
 
 		// Save initialization failure to database
@@ -1570,7 +2266,26 @@ func createActualMcpGoServerAndClientUncached(
 			common.SysError(fmt.Sprintf("Failed to save MCP initialization error log for %s: %v", serviceConfigForInstance.Name, saveErr))
 		}
 
-		return nil, nil, nil, nil, nil, errors.New(errMsg)
+		return nil, nil, nil, nil, nil, returnErr
+	}
+
+	// Warm-up ping: a connection that initializes but is already broken should fail creation now,
+	// rather than be reported healthy until the first heartbeat.
+	if timeout := mcpWarmupPingTimeout(); timeout > 0 {
+		pingCtx, cancelPing := context.WithTimeout(handshakeCtx, timeout)
+		pingErr := mcpGoClient.Ping(pingCtx)
+		cancelPing()
+		if pingErr != nil {
+			if closeErr := mcpGoClient.Close(); closeErr != nil {
+				common.SysError(fmt.Sprintf("Failed to close mcp-go client for %s (%s) after warm-up ping error: %v", serviceConfigForInstance.Name, instanceNameDetail, closeErr))
+			}
+			errMsg := fmt.Sprintf("Warm-up ping failed for %s (%s) after initialization: %v", serviceConfigForInstance.Name, instanceNameDetail, pingErr)
+			common.SysError(errMsg)
+			if saveErr := model.SaveMCPLog(runtimeCtx, serviceConfigForInstance.ID, serviceConfigForInstance.Name, model.MCPLogPhaseRun, model.MCPLogLevelError, errMsg); saveErr != nil {
+				common.SysError(fmt.Sprintf("Failed to save MCP warm-up ping error log for %s: %v", serviceConfigForInstance.Name, saveErr))
+			}
+			return nil, nil, nil, nil, nil, errors.New(errMsg)
+		}
 	}
 
 	// Extract server info from initialization result
@@ -1587,9 +2302,11 @@ func createActualMcpGoServerAndClientUncached(
 	if serverInfo != nil && serverInfo.Version != "" {
 		serverVersion = serverInfo.Version
 		// Update InstalledVersion in database if different from ServerInfo
-		if serviceConfigForInstance.InstalledVersion != serverInfo.Version {
+		if serviceConfigForInstance.InstalledVersion != serverInfo.Version && !isThrowawayInstance(handshakeCtx) {
 			serviceConfigForInstance.InstalledVersion = serverInfo.Version
-			if updateErr := model.UpdateService(serviceConfigForInstance); updateErr != nil {
+			// Persist only the version: the instance config carries per-instance values such as the injected
+			// OAuth Authorization header, the resolved environment profile and the endpoint in use
+			if updateErr := updateInstalledVersion(serviceConfigForInstance.ID, serverInfo.Version); updateErr != nil {
 				common.SysError(fmt.Sprintf("Failed to update InstalledVersion for %s (ID: %d): %v", serviceConfigForInstance.Name, serviceConfigForInstance.ID, updateErr))
 			} else {
 				common.SysLog(fmt.Sprintf("Updated InstalledVersion for %s (ID: %d) to %s", serviceConfigForInstance.Name, serviceConfigForInstance.ID, serverInfo.Version))
@@ -1599,6 +2316,7 @@ func createActualMcpGoServerAndClientUncached(
 
 	serverOptions := []mcpserver.ServerOption{
 		mcpserver.WithResourceCapabilities(true, true),
+		mcpserver.WithHooks(ProtocolVersionHooks()),
 	}
 	if strings.TrimSpace(serviceConfigForInstance.Description) != "" {
 		serverOptions = append(serverOptions, mcpserver.WithInstructions(serviceConfigForInstance.Description))
@@ -1610,25 +2328,25 @@ func createActualMcpGoServerAndClientUncached(
 	)
 
 	// Populate server with resources from client
-	tools, err := addClientToolsToMCPServer(handshakeCtx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, cacheKey, serviceConfigForInstance.ID, serviceConfigForInstance.Type)
+	tools, err := addClientToolsToMCPServer(handshakeCtx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, cacheKey, serviceConfigForInstance.ID, serviceConfigForInstance.Type, serviceConfigForInstance.CoerceArguments, common.GetMaxInstanceTools(), relay)
 	if err != nil {
 		common.SysError(fmt.Sprintf("Failed to add tools for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err))
 	} else {
 		// Note: We don't store tools in the server object, but return them to be stored in SharedMcpInstance
 	}
-	if err := addClientPromptsToMCPServer(handshakeCtx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name); err != nil {
+	if err := addClientPromptsToMCPServer(handshakeCtx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, serviceConfigForInstance.ID, common.GetMaxInstancePrompts()); err != nil {
 		common.SysError(fmt.Sprintf("Failed to add prompts for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err))
 	}
-	if err := addClientResourcesToMCPServer(handshakeCtx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name); err != nil {
+	if err := addClientResourcesToMCPServer(handshakeCtx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, serviceConfigForInstance.ID, common.GetMaxInstanceResources()); err != nil {
 		common.SysError(fmt.Sprintf("Failed to add resources for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err))
 	}
-	if err := addClientResourceTemplatesToMCPServer(handshakeCtx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name); err != nil {
+	if err := addClientResourceTemplatesToMCPServer(handshakeCtx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, serviceConfigForInstance.ID, common.GetMaxInstanceResources()); err != nil {
 		common.SysError(fmt.Sprintf("Failed to add resource templates for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err))
 	}
 
 	// Note: Success initialization logs are not saved to avoid log spam
 
-	return mcpGoServer, mcpGoClient, stdioCmd, tools, serverInfo, nil
+	return mcpGoServer, mcpGoClient, stdioCmd, tools, initResult, nil
 }
 
 // createSSEHttpHandler creates an SSE http.Handler from an mcpserver.MCPServer.
@@ -1730,6 +2448,32 @@ func ServiceFactory(mcpDBService *model.MCPService) (Service, error) {
 
 // --- Helper functions to add resources to mcp-go server (adapted from user's example) ---
 
+// capListPage trims a listed page so that no more than limit items are kept in total, given how many were
+// already kept; it reports whether items were dropped. A limit <= 0 keeps everything.
+func capListPage[T any](page []T, kept, limit int) ([]T, bool) {
+	if limit <= 0 || kept+len(page) <= limit {
+		return page, false
+	}
+	return page[:limit-kept], true
+}
+
+// listLimitReached reports whether listing must stop: either items were dropped from the last page or the cap
+// is reached while the server still advertises another page.
+func listLimitReached(truncated bool, kept, limit int, nextCursor mcp.Cursor) bool {
+	return truncated || (limit > 0 && kept >= limit && nextCursor != "")
+}
+
+// warnListTruncated records that only the first limit items of the given kind are exposed by the instance
+func warnListTruncated(serviceID int64, mcpServerName, kind, option string, limit int) {
+	msg := fmt.Sprintf("Listing %s of %s stopped after %d items; the remaining %s are not exposed by this instance (raise the %s option to include them)", kind, mcpServerName, limit, kind, option)
+	common.SysLog(msg)
+	if err := model.SaveMCPLog(context.Background(), serviceID, mcpServerName, model.MCPLogPhaseRun, model.MCPLogLevelWarn, msg); err != nil {
+		common.SysError(fmt.Sprintf("Failed to save list truncation log for %s: %v", mcpServerName, err))
+	}
+}
+
+// addClientToolsToMCPServer registers the upstream tools on the instance's server. Their handlers forward calls to
+// the upstream client, converting string-encoded arguments per the tool's schema when coerceArguments is set.
 func addClientToolsToMCPServer(
 	ctx context.Context,
 	mcpGoClient mcpclient.MCPClient,
@@ -1738,6 +2482,9 @@ func addClientToolsToMCPServer(
 	cacheKey string,
 	serviceID int64,
 	serviceType model.ServiceType,
+	coerceArguments bool,
+	limit int,
+	relay *upstreamRequestRelay,
 ) ([]mcp.Tool, error) {
 	var allTools []mcp.Tool
 	toolsRequest := mcp.ListToolsRequest{}
@@ -1752,16 +2499,27 @@ func addClientToolsToMCPServer(
 			break
 		}
 		common.SysLog(fmt.Sprintf("Listed %d tools for %s", len(tools.Tools), mcpServerName))
-		allTools = append(allTools, tools.Tools...)
-		for _, tool := range tools.Tools {
+		page, truncated := capListPage(tools.Tools, len(allTools), limit)
+		allTools = append(allTools, page...)
+		for _, tool := range page {
 			common.SysLog(fmt.Sprintf("Adding tool %s to %s", tool.Name, mcpServerName))
 			toolName := tool.Name
 			mcpGoServer.AddTool(tool, func(callCtx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				if coerceArguments {
+					request.Params.Arguments = CoerceToolArguments(tool, request.GetArguments())
+				}
+				release, queueErr := acquireToolCallSlot(callCtx, cacheKey)
+				if queueErr != nil {
+					common.SysLog(fmt.Sprintf("Tool call %s on %s was not run: %v", toolName, mcpServerName, queueErr))
+					return nil, queueErr
+				}
+				defer release()
+				defer relay.track(callCtx)()
 				start := time.Now()
 				// Apply configurable timeout for MCP tool calls, consistent with group handler
 				toolCallCtx, toolCallCancel := context.WithTimeout(callCtx, McpToolCallTimeout())
 				defer toolCallCancel()
-				result, callErr := mcpGoClient.CallTool(toolCallCtx, request)
+				result, callErr := mcpGoClient.CallTool(toolCallCtx, WithCorrelationMeta(callCtx, request))
 				duration := time.Since(start)
 				if callErr != nil {
 					trigger := fmt.Sprintf("tool call (%s)", toolName)
@@ -1772,11 +2530,17 @@ func addClientToolsToMCPServer(
 					}
 					if shouldInvalidateInstanceAfterCallError(mcpGoClient, callErr) {
 						handleTransportErrorForCache(cacheKey, serviceID, mcpServerName, serviceType, trigger, callErr)
+						return result, callErr
 					}
 				}
+				recordUpstreamCallResult(cacheKey, serviceID, mcpServerName, serviceType, callErr)
 				return result, callErr
 			})
 		}
+		if listLimitReached(truncated, len(allTools), limit, tools.NextCursor) {
+			warnListTruncated(serviceID, mcpServerName, "tools", common.OptionMaxInstanceTools, limit)
+			break
+		}
 		if tools.NextCursor == "" {
 			break
 		}
@@ -1785,8 +2549,9 @@ func addClientToolsToMCPServer(
 	return allTools, nil
 }
 
-func addClientPromptsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string) error {
+func addClientPromptsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string, serviceID int64, limit int) error {
 	promptsRequest := mcp.ListPromptsRequest{}
+	kept := 0
 	for {
 		prompts, err := mcpGoClient.ListPrompts(ctx, promptsRequest)
 		if err != nil {
@@ -1798,10 +2563,16 @@ func addClientPromptsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPC
 			break
 		}
 		common.SysLog(fmt.Sprintf("Listed %d prompts for %s", len(prompts.Prompts), mcpServerName))
-		for _, prompt := range prompts.Prompts {
+		page, truncated := capListPage(prompts.Prompts, kept, limit)
+		kept += len(page)
+		for _, prompt := range page {
 			common.SysLog(fmt.Sprintf("Adding prompt %s to %s", prompt.Name, mcpServerName))
 			mcpGoServer.AddPrompt(prompt, mcpGoClient.GetPrompt)
 		}
+		if listLimitReached(truncated, kept, limit, prompts.NextCursor) {
+			warnListTruncated(serviceID, mcpServerName, "prompts", common.OptionMaxInstancePrompts, limit)
+			break
+		}
 		if prompts.NextCursor == "" {
 			break
 		}
@@ -1822,8 +2593,9 @@ func addClientPromptsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPC
 
 // --- New Helper Functions ---
 
-func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string) error {
+func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string, serviceID int64, limit int) error {
 	resourcesRequest := mcp.ListResourcesRequest{}
+	kept := 0
 	for {
 		resources, err := mcpGoClient.ListResources(ctx, resourcesRequest)
 		if err != nil {
@@ -1835,7 +2607,9 @@ func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MC
 			break
 		}
 		common.SysLog(fmt.Sprintf("Successfully listed %d resources for %s", len(resources.Resources), mcpServerName))
-		for _, resource := range resources.Resources {
+		page, truncated := capListPage(resources.Resources, kept, limit)
+		kept += len(page)
+		for _, resource := range page {
 			// Capture range variable for closure
 			resource := resource
 			common.SysLog(fmt.Sprintf("Adding resource %s to %s", resource.Name, mcpServerName))
@@ -1847,6 +2621,10 @@ func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MC
 				return readResource.Contents, nil
 			})
 		}
+		if listLimitReached(truncated, kept, limit, resources.NextCursor) {
+			warnListTruncated(serviceID, mcpServerName, "resources", common.OptionMaxInstanceResources, limit)
+			break
+		}
 		if resources.NextCursor == "" {
 			break
 		}
@@ -1855,8 +2633,9 @@ func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MC
 	return nil
 }
 
-func addClientResourceTemplatesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string) error {
+func addClientResourceTemplatesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string, serviceID int64, limit int) error {
 	resourceTemplatesRequest := mcp.ListResourceTemplatesRequest{}
+	kept := 0
 	for {
 		resourceTemplates, err := mcpGoClient.ListResourceTemplates(ctx, resourceTemplatesRequest)
 		if err != nil {
@@ -1868,7 +2647,9 @@ func addClientResourceTemplatesToMCPServer(ctx context.Context, mcpGoClient mcpc
 			break
 		}
 		common.SysLog(fmt.Sprintf("Successfully listed %d resource templates for %s", len(resourceTemplates.ResourceTemplates), mcpServerName))
-		for _, resourceTemplate := range resourceTemplates.ResourceTemplates {
+		page, truncated := capListPage(resourceTemplates.ResourceTemplates, kept, limit)
+		kept += len(page)
+		for _, resourceTemplate := range page {
 			// Capture range variable for closure
 			resourceTemplate := resourceTemplate
 			common.SysLog(fmt.Sprintf("Adding resource template %s to %s", resourceTemplate.Name, mcpServerName))
@@ -1884,6 +2665,10 @@ func addClientResourceTemplatesToMCPServer(ctx context.Context, mcpGoClient mcpc
 				return readResource.Contents, nil
 			})
 		}
+		if listLimitReached(truncated, kept, limit, resourceTemplates.NextCursor) {
+			warnListTruncated(serviceID, mcpServerName, "resource templates", common.OptionMaxInstanceResources, limit)
+			break
+		}
 		if resourceTemplates.NextCursor == "" {
 			break
 		}
@@ -1911,6 +2696,7 @@ func getOrCreateSharedMcpInstanceWithKeyInternal(ctx context.Context, originalDb
 	defer sharedMCPServersMutex.Unlock()
 
 	if inst, found := sharedMCPServers[cacheKey]; found && inst != nil {
+		inst.touch()
 		return inst, nil
 	}
 
@@ -1921,10 +2707,17 @@ func getOrCreateSharedMcpInstanceWithKeyInternal(ctx context.Context, originalDb
 	if originalDbService.Type == model.ServiceTypeStdio && effectiveEnvsJSONForStdio != "" {
 		serviceConfigForCreation.DefaultEnvsJSON = effectiveEnvsJSONForStdio
 	}
+	// Environment profiles resolve to the envs of the active environment, falling back to the default profile
+	serviceConfigForCreation.DefaultEnvsJSON = model.ResolveEnvironmentEnvsJSON(serviceConfigForCreation.DefaultEnvsJSON, common.GetActiveEnvironment())
+	// Services behind OAuth need a usable access token before connecting; the transport sends it, see upstreamHeaderFunc
+	if err := ensureOAuthToken(ctx, &serviceConfigForCreation, false); err != nil {
+		return nil, fmt.Errorf("failed to authorize %s: %w", originalDbService.Name, err)
+	}
 
 	// Build a background context we can cancel on shutdown, while still honoring caller cancellation during creation
 	bgCtx, cancel := context.WithCancel(context.Background())
-	handshakeCtx, handshakeCancel := context.WithTimeout(bgCtx, 20*time.Second)
+	// The initialize request has its own timeout on top of the connect budget, so raising it is not cut short
+	handshakeCtx, handshakeCancel := context.WithTimeout(bgCtx, sharedInstanceConnectTimeout+mcpInitializeTimeout())
 	handshakeDone := make(chan struct{})
 
 	go func() {
@@ -1935,7 +2728,16 @@ func getOrCreateSharedMcpInstanceWithKeyInternal(ctx context.Context, originalDb
 		}
 	}()
 
-	srv, cli, spawnedCmd, tools, serverInfo, err := createActualMcpGoServerAndClientUncached(handshakeCtx, bgCtx, cacheKey, &serviceConfigForCreation, instanceNameDetail)
+	relay := relayForInstance(cacheKey)
+	srv, cli, spawnedCmd, tools, initResult, err := createActualMcpGoServerAndClientUncached(handshakeCtx, bgCtx, cacheKey, &serviceConfigForCreation, instanceNameDetail, relay)
+	if errors.Is(err, ErrUpstreamUnauthorized) && serviceConfigForCreation.OAuthConfigJSON != "" {
+		// The token was rejected before it expired (e.g. revoked upstream): refresh it once and retry
+		if refreshErr := ensureOAuthToken(handshakeCtx, &serviceConfigForCreation, true); refreshErr != nil {
+			err = errors.Join(err, refreshErr)
+		} else {
+			srv, cli, spawnedCmd, tools, initResult, err = createActualMcpGoServerAndClientUncached(handshakeCtx, bgCtx, cacheKey, &serviceConfigForCreation, instanceNameDetail, relay)
+		}
+	}
 	close(handshakeDone)
 	if err != nil {
 		handshakeCancel()
@@ -1949,7 +2751,8 @@ func getOrCreateSharedMcpInstanceWithKeyInternal(ctx context.Context, originalDb
 		Server:        srv,
 		Client:        cli,
 		Tools:         tools,
-		ServerInfo:    serverInfo,
+		ServerInfo:    initResultServerInfo(initResult),
+		InitResult:    initResult,
 		cancel:        cancel,
 		serviceID:     originalDbService.ID,
 		serviceName:   originalDbService.Name,
@@ -1957,11 +2760,20 @@ func getOrCreateSharedMcpInstanceWithKeyInternal(ctx context.Context, originalDb
 		cacheKey:      cacheKey,
 		instanceLabel: instanceNameDetail,
 		stdioCmd:      spawnedCmd,
+		relay:         relay,
+		hookService:   &serviceConfigForCreation,
+		endpoint:      serviceConfigForCreation.Command,
 	}
+	instance.touch()
 
 	// Store in cache
 	sharedMCPServers[cacheKey] = instance
 	common.SysLog(fmt.Sprintf("Created new SharedMcpInstance for %s (key: %s, type: %s)", originalDbService.Name, cacheKey, serviceConfigForCreation.Type))
+	if isUserServiceCacheKey(cacheKey) {
+		if evicted := evictIdleUserInstancesLocked(originalDbService.ID, cacheKey); len(evicted) > 0 {
+			go shutdownEvictedUserInstances(originalDbService.ID, evicted)
+		}
+	}
 
 	// Start background maintenance loops (ping + connection lost handling) for network transports.
 	instance.startMaintenanceLoops(bgCtx)
@@ -1971,7 +2783,7 @@ func getOrCreateSharedMcpInstanceWithKeyInternal(ctx context.Context, originalDb
 
 // GetOrCreateProxyToSSEHandler creates or retrieves a cached SSE http.Handler using shared MCP instance
 func GetOrCreateProxyToSSEHandler(ctx context.Context, mcpDBService *model.MCPService, sharedInst *SharedMcpInstance) (http.Handler, error) {
-	handlerCacheKey := fmt.Sprintf("service-%d-sseproxy", mcpDBService.ID)
+	handlerCacheKey := proxyHandlerCacheKey(mcpDBService.ID, "sseproxy", sharedInst.cacheKey)
 
 	sseWrappersMutex.Lock()
 	defer sseWrappersMutex.Unlock()
@@ -1995,7 +2807,7 @@ func GetOrCreateProxyToSSEHandler(ctx context.Context, mcpDBService *model.MCPSe
 
 // GetOrCreateProxyToHTTPHandler creates or retrieves a cached HTTP/MCP http.Handler using shared MCP instance
 func GetOrCreateProxyToHTTPHandler(ctx context.Context, mcpDBService *model.MCPService, sharedInst *SharedMcpInstance) (http.Handler, error) {
-	handlerCacheKey := fmt.Sprintf("service-%d-httpproxy", mcpDBService.ID)
+	handlerCacheKey := proxyHandlerCacheKey(mcpDBService.ID, "httpproxy", sharedInst.cacheKey)
 
 	httpWrappersMutex.Lock()
 	defer httpWrappersMutex.Unlock()
@@ -2017,6 +2829,120 @@ func GetOrCreateProxyToHTTPHandler(ctx context.Context, mcpDBService *model.MCPS
 	return handler, nil
 }
 
+// proxyHandlerCacheKey returns the cache key of the proxy handler serving the instance cached under instanceKey,
+// e.g. "service-7-sseproxy/user-1-service-7-shared". Each instance has its own handler, so user-specific
+// instances are not served by the handler of another instance of the service.
+func proxyHandlerCacheKey(serviceID int64, proxyType, instanceKey string) string {
+	return fmt.Sprintf("service-%d-%s/%s", serviceID, proxyType, instanceKey)
+}
+
+// proxyHandlerCacheServiceID extracts the service ID from a "service-<id>-sseproxy/<instance>"/"service-<id>-httpproxy/<instance>" key
+func proxyHandlerCacheServiceID(key string) (int64, bool) {
+	rest, ok := strings.CutPrefix(key, "service-")
+	if !ok {
+		return 0, false
+	}
+	idStr, _, _ := strings.Cut(rest, "-")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	return id, err == nil
+}
+
+// ProxyHandlerCacheInfo lists the service IDs that currently have cached SSE/HTTP proxy handlers
+type ProxyHandlerCacheInfo struct {
+	SSEServiceIDs  []int64 `json:"sse_service_ids"`
+	HTTPServiceIDs []int64 `json:"http_service_ids"`
+}
+
+func cachedHandlerServiceIDs(cache map[string]http.Handler) []int64 {
+	ids := make([]int64, 0, len(cache))
+	seen := make(map[int64]bool, len(cache))
+	for key := range cache {
+		if id, ok := proxyHandlerCacheServiceID(key); ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// GetProxyHandlerCacheInfo returns a snapshot of the SSE and HTTP proxy handler caches
+func GetProxyHandlerCacheInfo() ProxyHandlerCacheInfo {
+	sseWrappersMutex.Lock()
+	sseIDs := cachedHandlerServiceIDs(initializedSSEProxyWrappers)
+	sseWrappersMutex.Unlock()
+
+	httpWrappersMutex.Lock()
+	httpIDs := cachedHandlerServiceIDs(initializedHTTPProxyWrappers)
+	httpWrappersMutex.Unlock()
+
+	return ProxyHandlerCacheInfo{SSEServiceIDs: sseIDs, HTTPServiceIDs: httpIDs}
+}
+
+// clearHandlerCache removes entries for serviceID (0 means all) and returns how many were removed
+func clearHandlerCache(cache map[string]http.Handler, serviceID int64) int {
+	cleared := 0
+	for key := range cache {
+		if id, ok := proxyHandlerCacheServiceID(key); serviceID == 0 || (ok && id == serviceID) {
+			delete(cache, key)
+			cleared++
+		}
+	}
+	return cleared
+}
+
+// clearInstanceProxyHandlers removes the cached SSE and HTTP proxy handlers of the instances cached under
+// instanceKeys, leaving the sessions of other instances of the service untouched
+func clearInstanceProxyHandlers(serviceID int64, instanceKeys ...string) (sseCleared int, httpCleared int) {
+	sseWrappersMutex.Lock()
+	for _, instanceKey := range instanceKeys {
+		key := proxyHandlerCacheKey(serviceID, "sseproxy", instanceKey)
+		if _, exists := initializedSSEProxyWrappers[key]; exists {
+			delete(initializedSSEProxyWrappers, key)
+			sseCleared++
+		}
+	}
+	sseWrappersMutex.Unlock()
+
+	httpWrappersMutex.Lock()
+	for _, instanceKey := range instanceKeys {
+		key := proxyHandlerCacheKey(serviceID, "httpproxy", instanceKey)
+		if _, exists := initializedHTTPProxyWrappers[key]; exists {
+			delete(initializedHTTPProxyWrappers, key)
+			httpCleared++
+		}
+	}
+	httpWrappersMutex.Unlock()
+	return sseCleared, httpCleared
+}
+
+// ClearProxyHandlerCaches clears the cached SSE and HTTP proxy handlers, optionally scoped to one
+// service (serviceID 0 clears everything). Handlers are rebuilt on the next request.
+func ClearProxyHandlerCaches(serviceID int64) (sseCleared int, httpCleared int) {
+	sseWrappersMutex.Lock()
+	sseCleared = clearHandlerCache(initializedSSEProxyWrappers, serviceID)
+	sseWrappersMutex.Unlock()
+
+	httpWrappersMutex.Lock()
+	httpCleared = clearHandlerCache(initializedHTTPProxyWrappers, serviceID)
+	httpWrappersMutex.Unlock()
+
+	if sseCleared > 0 || httpCleared > 0 {
+		common.SysLog(fmt.Sprintf("Cleared %d SSE and %d HTTP cached proxy handlers (service scope: %d).", sseCleared, httpCleared, serviceID))
+	}
+	return sseCleared, httpCleared
+}
+
+// ClearHTTPProxyCache clears the cached HTTP proxy handlers.
+func ClearHTTPProxyCache() {
+	httpWrappersMutex.Lock()
+	defer httpWrappersMutex.Unlock()
+	if len(initializedHTTPProxyWrappers) > 0 {
+		common.SysLog(fmt.Sprintf("Clearing %d cached HTTP proxy handlers due to configuration change.", len(initializedHTTPProxyWrappers)))
+		initializedHTTPProxyWrappers = make(map[string]http.Handler)
+	}
+}
+
 // ClearSSEProxyCache clears the cached SSE proxy handlers.
 // This should be called when global settings that affect handler creation (like ServerAddress) are changed.
 func ClearSSEProxyCache() {
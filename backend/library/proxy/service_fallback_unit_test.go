@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackEndpointTakesOverFromFailingPrimary(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	defer func() { common.SQLitePath = originalPath }()
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	backup := newSlowInitializeUpstream(t, 0)
+	fallbacks, _ := json.Marshal([]string{backup.URL})
+
+	dbConfig := &model.MCPService{Name: "fallback-svc", Type: model.ServiceTypeStreamableHTTP, Command: primary.URL, FallbackEndpointsJSON: string(fallbacks), Enabled: true}
+	dbConfig.ID = 995001
+	defer preferredEndpoints.Delete(dbConfig.ID)
+	svc := NewMonitoredProxiedService(NewBaseService(dbConfig.ID, dbConfig.Name, dbConfig.Type), nil, dbConfig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	health, err := svc.CheckHealth(ctx)
+	defer func() {
+		sharedMCPServersMutex.Lock()
+		delete(sharedMCPServers, SharedServiceCacheKey(dbConfig.ID))
+		sharedMCPServersMutex.Unlock()
+		if svc.sharedInstance != nil {
+			_ = svc.sharedInstance.Shutdown(context.Background())
+		}
+	}()
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, health) {
+		assert.Equal(t, StatusHealthy, health.Status)
+		assert.Equal(t, backup.URL, health.ActiveEndpoint)
+		assert.True(t, health.FallbackActive)
+	}
+	assert.Equal(t, backup.URL, svc.GetHealth().ActiveEndpoint)
+	assert.Equal(t, primary.URL, dbConfig.Command, "the stored configuration keeps its primary endpoint")
+
+	// Re-creating the instance tries the endpoint that worked first
+	assert.Equal(t, []string{backup.URL, primary.URL}, endpointAttemptOrder(dbConfig))
+}
+
+func TestHangingPrimaryLeavesTimeForFallback(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	defer func() { common.SQLitePath = originalPath }()
+
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reading the body lets the server notice when the client gives up
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+	backup := newSlowInitializeUpstream(t, 0)
+	svc := &model.MCPService{Name: "fallback-hanging-svc", Type: model.ServiceTypeStreamableHTTP, Command: hanging.URL, FallbackEndpointsJSON: `["` + backup.URL + `"]`}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	defer bgCancel()
+	_, cli, _, _, _, err := createActualMcpGoServerAndClientUncached(asThrowawayInstance(ctx), bgCtx, "fallback-hanging-key", svc, "test", nil)
+	if assert.NoError(t, err, "the hanging primary only gets its share of the handshake deadline") {
+		assert.Equal(t, backup.URL, svc.Command)
+		_ = cli.Close()
+	}
+}
+
+func TestHealthCheckFailsBackToRecoveredPrimary(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	originalInterval := endpointFailbackInterval
+	defer func() {
+		common.SQLitePath = originalPath
+		endpointFailbackInterval = originalInterval
+	}()
+
+	var primaryUp atomic.Bool
+	working := newSlowInitializeUpstream(t, 0)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !primaryUp.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		working.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer primary.Close()
+	backup := newSlowInitializeUpstream(t, 0)
+
+	dbConfig := &model.MCPService{Name: "failback-svc", Type: model.ServiceTypeStreamableHTTP, Command: primary.URL, FallbackEndpointsJSON: `["` + backup.URL + `"]`, Enabled: true}
+	dbConfig.ID = 995002
+	defer preferredEndpoints.Delete(dbConfig.ID)
+	svc := NewMonitoredProxiedService(NewBaseService(dbConfig.ID, dbConfig.Name, dbConfig.Type), nil, dbConfig)
+	defer func() {
+		sharedMCPServersMutex.Lock()
+		delete(sharedMCPServers, SharedServiceCacheKey(dbConfig.ID))
+		sharedMCPServersMutex.Unlock()
+		if svc.sharedInstance != nil {
+			_ = svc.sharedInstance.Shutdown(context.Background())
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	health, err := svc.CheckHealth(ctx)
+	assert.NoError(t, err)
+	if assert.NotNil(t, health) {
+		assert.Equal(t, backup.URL, health.ActiveEndpoint)
+	}
+
+	// A failed probe keeps the fallback
+	endpointFailbackInterval = 0
+	health, err = svc.CheckHealth(ctx)
+	assert.NoError(t, err)
+	if assert.NotNil(t, health) {
+		assert.Equal(t, backup.URL, health.ActiveEndpoint)
+		assert.True(t, health.FallbackActive)
+	}
+
+	primaryUp.Store(true)
+	health, err = svc.CheckHealth(ctx)
+	assert.NoError(t, err)
+	if assert.NotNil(t, health) {
+		assert.Equal(t, StatusHealthy, health.Status)
+		assert.Equal(t, primary.URL, health.ActiveEndpoint)
+		assert.False(t, health.FallbackActive)
+	}
+	assert.Equal(t, []string{primary.URL, backup.URL}, endpointAttemptOrder(dbConfig))
+}
+
+func TestAllEndpointsFailingReportsEveryError(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	defer func() { common.SQLitePath = originalPath }()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	svc := &model.MCPService{Name: "fallback-down-svc", Type: model.ServiceTypeStreamableHTTP, Command: failing.URL + "/primary", FallbackEndpointsJSON: `["` + failing.URL + `/backup"]`}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, cli, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "fallback-down-key", svc, "test", nil)
+	assert.Nil(t, cli)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "all 2 endpoints of service fallback-down-svc failed")
+	}
+	assert.Equal(t, failing.URL+"/primary", svc.Command)
+}
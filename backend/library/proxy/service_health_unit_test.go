@@ -0,0 +1,351 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitoredProxiedService_DeepHealthCheck(t *testing.T) {
+	twoTools := []mcp.Tool{{Name: "a"}, {Name: "b"}}
+
+	testCases := []struct {
+		name           string
+		serviceID      int64
+		deep           bool
+		cachedTools    []mcp.Tool
+		listToolsFn    func(context.Context) (*mcp.ListToolsResult, error)
+		wantStatus     ServiceStatus
+		wantErr        bool
+		wantToolCount  int
+		wantErrMessage string
+	}{
+		{
+			name:      "ping ok but ListTools errors",
+			serviceID: 992001,
+			deep:      true,
+			listToolsFn: func(ctx context.Context) (*mcp.ListToolsResult, error) {
+				return nil, errors.New("boom")
+			},
+			wantStatus:     StatusUnhealthy,
+			wantErr:        true,
+			wantErrMessage: "ListTools failed",
+		},
+		{
+			name:        "zero tools after previously having some",
+			serviceID:   992002,
+			deep:        true,
+			cachedTools: twoTools,
+			listToolsFn: func(ctx context.Context) (*mcp.ListToolsResult, error) {
+				return &mcp.ListToolsResult{}, nil
+			},
+			wantStatus:     StatusUnhealthy,
+			wantErr:        true,
+			wantErrMessage: "returned no tools",
+		},
+		{
+			name:      "tools listed refreshes tool count",
+			serviceID: 992003,
+			deep:      true,
+			listToolsFn: func(ctx context.Context) (*mcp.ListToolsResult, error) {
+				return &mcp.ListToolsResult{Tools: twoTools}, nil
+			},
+			wantStatus:    StatusHealthy,
+			wantToolCount: 2,
+		},
+		{
+			name:      "deep check disabled only pings",
+			serviceID: 992004,
+			deep:      false,
+			listToolsFn: func(ctx context.Context) (*mcp.ListToolsResult, error) {
+				return nil, errors.New("should not be called")
+			},
+			wantStatus: StatusHealthy,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			toolsCache := GetToolsCacheManager()
+			toolsCache.DeleteServiceTools(tc.serviceID)
+			defer toolsCache.DeleteServiceTools(tc.serviceID)
+			if tc.cachedTools != nil {
+				toolsCache.SetServiceTools(tc.serviceID, &ToolsCacheEntry{Tools: tc.cachedTools, FetchedAt: time.Now()})
+			}
+
+			client := &fakeMcpClient{listToolsFn: tc.listToolsFn}
+			dbConfig := &model.MCPService{Name: "deep-svc", Type: model.ServiceTypeStdio, Enabled: true, DeepHealthCheck: tc.deep}
+			dbConfig.ID = tc.serviceID
+			svc := NewMonitoredProxiedService(
+				NewBaseService(tc.serviceID, "deep-svc", model.ServiceTypeStdio),
+				&SharedMcpInstance{Client: client},
+				dbConfig,
+			)
+
+			health, err := svc.CheckHealth(context.Background())
+			assert.Equal(t, tc.wantStatus, health.Status)
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, health.ErrorMessage, tc.wantErrMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantToolCount, health.ToolCount)
+		})
+	}
+}
+
+func TestMonitoredProxiedService_StartupGracePeriod(t *testing.T) {
+	testCases := []struct {
+		name             string
+		gracePeriod      int
+		startedAgo       time.Duration
+		wantStatus       ServiceStatus
+		wantErr          bool
+		wantFailureCount int64
+	}{
+		{name: "failure within grace window", gracePeriod: 60, startedAgo: 5 * time.Second, wantStatus: StatusStarting, wantFailureCount: 0},
+		{name: "failure after grace window", gracePeriod: 60, startedAgo: 2 * time.Minute, wantStatus: StatusUnhealthy, wantErr: true, wantFailureCount: 1},
+		{name: "no grace period configured", gracePeriod: 0, startedAgo: time.Second, wantStatus: StatusUnhealthy, wantErr: true, wantFailureCount: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeMcpClient{pingFn: func(ctx context.Context) error { return errors.New("warming up") }}
+			dbConfig := &model.MCPService{Name: "slow-svc", Type: model.ServiceTypeStdio, Enabled: true, HealthGracePeriod: tc.gracePeriod}
+			dbConfig.ID = 992101
+			svc := NewMonitoredProxiedService(
+				NewBaseService(dbConfig.ID, "slow-svc", model.ServiceTypeStdio),
+				&SharedMcpInstance{Client: client},
+				dbConfig,
+			)
+			assert.NoError(t, svc.Start(context.Background()))
+			svc.lastStartTime = time.Now().Add(-tc.startedAgo)
+
+			health, err := svc.CheckHealth(context.Background())
+			assert.Equal(t, tc.wantStatus, health.Status)
+			assert.Equal(t, tc.wantFailureCount, health.FailureCount)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Contains(t, health.ErrorMessage, "warming up")
+			}
+		})
+	}
+}
+
+func TestMonitoredProxiedService_StartupGraceSkipsRecreation(t *testing.T) {
+	var recreations int
+	original := GetOrCreateSharedMcpInstanceWithKey
+	GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, dbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvs string) (*SharedMcpInstance, error) {
+		recreations++
+		return &SharedMcpInstance{Client: &fakeMcpClient{}}, nil
+	}
+	defer func() { GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	client := &fakeMcpClient{pingFn: func(ctx context.Context) error { return errors.New("warming up") }}
+	instance := &SharedMcpInstance{Client: client}
+	dbConfig := &model.MCPService{Name: "slow-remote", Type: model.ServiceTypeStreamableHTTP, Enabled: true, HealthGracePeriod: 60}
+	dbConfig.ID = 992102
+	svc := NewMonitoredProxiedService(NewBaseService(dbConfig.ID, dbConfig.Name, model.ServiceTypeStreamableHTTP), instance, dbConfig)
+	assert.NoError(t, svc.Start(context.Background()))
+
+	// 宽限期内 ping 失败只报告为启动中，不重建仍在预热的连接
+	health, err := svc.CheckHealth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, StatusStarting, health.Status)
+	assert.Equal(t, 0, recreations)
+	assert.Same(t, instance, svc.sharedInstance)
+	assert.False(t, client.closeCalled.Load())
+
+	// 宽限期过后恢复自愈
+	svc.lastStartTime = time.Now().Add(-2 * time.Minute)
+	health, err = svc.CheckHealth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, StatusHealthy, health.Status)
+	assert.Equal(t, 1, recreations)
+}
+
+func TestMonitoredProxiedService_ProbeCommand(t *testing.T) {
+	testCases := []struct {
+		name           string
+		probe          string
+		wantStatus     ServiceStatus
+		wantErrMessage string
+	}{
+		{name: "passing probe reports healthy", probe: "true", wantStatus: StatusHealthy},
+		{name: "failing probe reports unhealthy", probe: "false", wantStatus: StatusUnhealthy, wantErrMessage: `probe "false" failed`},
+		{name: "missing binary reports unhealthy", probe: "one-mcp-missing-probe-binary --version", wantStatus: StatusUnhealthy, wantErrMessage: "one-mcp-missing-probe-binary"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pinged := false
+			client := &fakeMcpClient{pingFn: func(ctx context.Context) error {
+				pinged = true
+				return errors.New("ping should not be used when a probe is configured")
+			}}
+			dbConfig := &model.MCPService{Name: "probe-svc", Type: model.ServiceTypeStdio, Enabled: true, ProbeCommand: tc.probe}
+			dbConfig.ID = 945001
+			svc := NewMonitoredProxiedService(
+				NewBaseService(dbConfig.ID, "probe-svc", model.ServiceTypeStdio),
+				&SharedMcpInstance{Client: client},
+				dbConfig,
+			)
+
+			health, err := svc.CheckHealth(context.Background())
+			assert.False(t, pinged)
+			assert.Equal(t, tc.wantStatus, health.Status)
+			if tc.wantErrMessage == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, health.ErrorMessage, tc.wantErrMessage)
+		})
+	}
+}
+
+func TestMonitoredProxiedService_HealthCheckURL(t *testing.T) {
+	var gotAuth string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/redirect":
+			http.Redirect(w, r, other.URL+"/ok", http.StatusFound)
+		default:
+			http.Error(w, "database down", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	testCases := []struct {
+		name           string
+		url            string
+		wantPinged     bool
+		wantStatus     ServiceStatus
+		wantErrMessage string
+		wantAuth       string
+	}{
+		{name: "2xx reports healthy without ping", url: server.URL + "/ok", wantStatus: StatusHealthy, wantAuth: "Bearer secret"},
+		{name: "5xx reports unhealthy without ping", url: server.URL + "/fail", wantStatus: StatusUnhealthy, wantErrMessage: "returned status 500: database down", wantAuth: "Bearer secret"},
+		{name: "headers are not sent to another origin", url: other.URL + "/ok", wantStatus: StatusHealthy},
+		{name: "headers are dropped on a cross-origin redirect", url: server.URL + "/redirect", wantStatus: StatusHealthy},
+		{name: "unreachable endpoint falls back to ping", url: unreachable.URL + "/ok", wantPinged: true, wantStatus: StatusHealthy},
+		{name: "no url uses ping", wantPinged: true, wantStatus: StatusHealthy},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotAuth = ""
+			pinged := false
+			client := &fakeMcpClient{pingFn: func(ctx context.Context) error {
+				pinged = true
+				return nil
+			}}
+			dbConfig := &model.MCPService{
+				Name:           "health-url-svc",
+				Type:           model.ServiceTypeStreamableHTTP,
+				Enabled:        true,
+				Command:        server.URL + "/mcp",
+				HeadersJSON:    `{"Authorization":"Bearer secret"}`,
+				HealthCheckURL: tc.url,
+			}
+			dbConfig.ID = 967001
+			svc := NewMonitoredProxiedService(
+				NewBaseService(dbConfig.ID, dbConfig.Name, model.ServiceTypeStreamableHTTP),
+				&SharedMcpInstance{Client: client},
+				dbConfig,
+			)
+
+			health, err := svc.CheckHealth(context.Background())
+			assert.Equal(t, tc.wantPinged, pinged)
+			assert.Equal(t, tc.wantStatus, health.Status)
+			if tc.url != "" && !tc.wantPinged {
+				assert.Equal(t, tc.wantAuth, gotAuth)
+			}
+			if tc.wantErrMessage == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, health.ErrorMessage, tc.wantErrMessage)
+		})
+	}
+}
+
+func TestMonitoredProxiedService_DisableSelfHealing(t *testing.T) {
+	var recreations int
+	original := GetOrCreateSharedMcpInstanceWithKey
+	GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, dbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSON string) (*SharedMcpInstance, error) {
+		recreations++
+		return &SharedMcpInstance{Client: &fakeMcpClient{}}, nil
+	}
+	defer func() { GetOrCreateSharedMcpInstanceWithKey = original }()
+
+	testCases := []struct {
+		name            string
+		disabled        bool
+		maintenance     bool
+		withInstance    bool
+		wantStatus      ServiceStatus
+		wantRecreations int
+		wantErrMessage  string
+	}{
+		{name: "ping failure re-creates the client by default", withInstance: true, wantStatus: StatusHealthy, wantRecreations: 1},
+		{name: "ping failure reported when self-healing disabled", disabled: true, withInstance: true, wantStatus: StatusUnhealthy, wantErrMessage: "self-healing disabled"},
+		{name: "missing instance re-created by default", wantStatus: StatusHealthy, wantRecreations: 1},
+		{name: "missing instance reported when self-healing disabled", disabled: true, wantStatus: StatusUnhealthy, wantErrMessage: "not initialized"},
+		{name: "ping failure not re-created in a maintenance window", maintenance: true, withInstance: true, wantStatus: StatusUnhealthy, wantErrMessage: "maintenance window"},
+		{name: "missing instance not re-created in a maintenance window", maintenance: true, wantStatus: StatusUnhealthy, wantErrMessage: "not initialized"},
+	}
+	defer serviceMaintenanceWindows.Delete(int64(987001))
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recreations = 0
+			client := &fakeMcpClient{pingFn: func(ctx context.Context) error { return errors.New("connection reset") }}
+			var instance *SharedMcpInstance
+			if tc.withInstance {
+				instance = &SharedMcpInstance{Client: client}
+			}
+			dbConfig := &model.MCPService{Name: "self-healing-svc", Type: model.ServiceTypeSSE, Enabled: true, DisableSelfHealing: tc.disabled}
+			dbConfig.ID = 987001
+			if tc.maintenance {
+				now := time.Now().UTC()
+				dbConfig.MaintenanceWindow = now.Add(-time.Minute).Format(time.RFC3339) + "/" + now.Add(time.Hour).Format(time.RFC3339)
+			}
+			svc := NewMonitoredProxiedService(NewBaseService(dbConfig.ID, dbConfig.Name, model.ServiceTypeSSE), instance, dbConfig)
+
+			health, err := svc.CheckHealth(context.Background())
+			assert.Equal(t, tc.wantStatus, health.Status)
+			assert.Equal(t, tc.wantRecreations, recreations)
+			if tc.wantErrMessage == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, health.ErrorMessage, tc.wantErrMessage)
+			assert.Same(t, instance, svc.sharedInstance, "the failing instance is left in place for a manual restart")
+			assert.False(t, client.closeCalled.Load())
+		})
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 type fakeMcpClient struct {
 	pingFn      func(context.Context) error
+	listToolsFn func(context.Context) (*mcp.ListToolsResult, error)
 	closeCalled atomic.Bool
 }
 
@@ -75,6 +76,9 @@ func (f *fakeMcpClient) ListToolsByPage(ctx context.Context, request mcp.ListToo
 }
 
 func (f *fakeMcpClient) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	if f.listToolsFn != nil {
+		return f.listToolsFn(ctx)
+	}
 	return &mcp.ListToolsResult{}, nil
 }
 
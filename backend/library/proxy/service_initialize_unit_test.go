@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSlowInitializeUpstream 启动一个 streamable HTTP upstream，initialize 在 delay 之后才返回
+func newSlowInitializeUpstream(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(req.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		response := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "initialize":
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			response["result"] = map[string]any{
+				"protocolVersion": mcp.LATEST_PROTOCOL_VERSION,
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "slow-index", "version": "1.0.0"},
+			}
+		case "ping":
+			response["result"] = map[string]any{}
+		case "tools/list":
+			response["result"] = map[string]any{"tools": []any{}}
+		default:
+			response["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCreateMcpClientInitializeTimeout(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	defer func() { common.SQLitePath = originalPath }()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		delete(common.OptionMap, common.OptionMcpInitializeTimeout)
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	tests := []struct {
+		name      string
+		timeout   string
+		delay     time.Duration
+		skipLimit bool
+		wantErr   bool
+	}{
+		{"initialize slower than the timeout", "100ms", 500 * time.Millisecond, false, true},
+		{"initialize within the timeout", "2s", 100 * time.Millisecond, false, false},
+		{"prewarm is bounded only by its context", "100ms", 300 * time.Millisecond, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.OptionMapRWMutex.Lock()
+			common.OptionMap[common.OptionMcpInitializeTimeout] = tt.timeout
+			common.OptionMapRWMutex.Unlock()
+			upstream := newSlowInitializeUpstream(t, tt.delay)
+			svc := &model.MCPService{Name: "slow-index", Type: model.ServiceTypeStreamableHTTP, Command: upstream.URL, InstalledVersion: "1.0.0"}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if tt.skipLimit {
+				ctx = withoutInitializeTimeout(ctx)
+			}
+			_, cli, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "initialize-timeout-key", svc, "test", nil)
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					assert.True(t, errors.Is(err, ErrInitializeTimeout), err.Error())
+					assert.Contains(t, err.Error(), "within 100ms")
+					assert.Contains(t, err.Error(), "McpInitializeTimeout")
+				}
+				assert.Nil(t, cli)
+				return
+			}
+			if assert.NoError(t, err) && assert.NotNil(t, cli) {
+				_ = cli.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// pagedMcpClient serves total tools and prompts in pages of pageSize, counting the list calls
+type pagedMcpClient struct {
+	fakeMcpClient
+	total, pageSize int
+	toolCalls       int
+	promptCalls     int
+}
+
+func (p *pagedMcpClient) page(cursor mcp.Cursor) (start, end int, next mcp.Cursor) {
+	start, _ = strconv.Atoi(string(cursor))
+	end = min(start+p.pageSize, p.total)
+	if end < p.total {
+		next = mcp.Cursor(strconv.Itoa(end))
+	}
+	return start, end, next
+}
+
+func (p *pagedMcpClient) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	p.toolCalls++
+	start, end, next := p.page(request.Params.Cursor)
+	result := &mcp.ListToolsResult{}
+	result.NextCursor = next
+	for i := start; i < end; i++ {
+		result.Tools = append(result.Tools, mcp.NewTool(fmt.Sprintf("tool_%d", i)))
+	}
+	return result, nil
+}
+
+func (p *pagedMcpClient) ListPrompts(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error) {
+	p.promptCalls++
+	start, end, next := p.page(request.Params.Cursor)
+	result := &mcp.ListPromptsResult{}
+	result.NextCursor = next
+	for i := start; i < end; i++ {
+		result.Prompts = append(result.Prompts, mcp.NewPrompt(fmt.Sprintf("prompt_%d", i)))
+	}
+	return result, nil
+}
+
+func TestAddClientToolsToMCPServerHonorsLimit(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	tests := []struct {
+		name          string
+		limit         int
+		wantTools     int
+		wantCalls     int
+		wantTruncated bool
+	}{
+		{"cap inside a page", 250, 250, 3, true},
+		{"cap on a page boundary", 300, 300, 3, true},
+		{"cap above the total", 10000, 5000, 50, false},
+		{"no cap", 0, 5000, 50, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceName := fmt.Sprintf("many-tools-svc-%d", i)
+			client := &pagedMcpClient{total: 5000, pageSize: 100}
+			server := mcpserver.NewMCPServer(serviceName, "1.0.0")
+
+			tools, err := addClientToolsToMCPServer(context.Background(), client, server, serviceName, "test-key", 954, model.ServiceTypeStdio, false, tt.limit, nil)
+			if err != nil {
+				t.Fatalf("addClientToolsToMCPServer: %v", err)
+			}
+			if len(tools) != tt.wantTools || len(server.ListTools()) != tt.wantTools {
+				t.Fatalf("expected %d tools, got %d returned and %d registered", tt.wantTools, len(tools), len(server.ListTools()))
+			}
+			if client.toolCalls != tt.wantCalls {
+				t.Fatalf("expected %d list calls, got %d", tt.wantCalls, client.toolCalls)
+			}
+
+			logs, _, err := model.GetMCPLogs(context.Background(), nil, &serviceName, nil, nil, 1, 10)
+			if err != nil {
+				t.Fatalf("GetMCPLogs: %v", err)
+			}
+			truncated := false
+			for _, log := range logs {
+				if log.Level == model.MCPLogLevelWarn && strings.Contains(log.Message, common.OptionMaxInstanceTools) {
+					truncated = true
+				}
+			}
+			if truncated != tt.wantTruncated {
+				t.Fatalf("expected truncation warning %v, got %v", tt.wantTruncated, truncated)
+			}
+		})
+	}
+}
+
+func TestAddClientPromptsToMCPServerHonorsLimit(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	client := &pagedMcpClient{total: 1000, pageSize: 100}
+	server := mcpserver.NewMCPServer("many-prompts-svc", "1.0.0")
+	if err := addClientPromptsToMCPServer(context.Background(), client, server, "many-prompts-svc", 954, 150); err != nil {
+		t.Fatalf("addClientPromptsToMCPServer: %v", err)
+	}
+	if client.promptCalls != 2 {
+		t.Fatalf("expected listing to stop after 2 pages, got %d calls", client.promptCalls)
+	}
+	result := server.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"prompts/list"}`))
+	response, ok := result.(mcp.JSONRPCResponse)
+	if !ok {
+		t.Fatalf("unexpected prompts/list response: %#v", result)
+	}
+	prompts, ok := response.Result.(mcp.ListPromptsResult)
+	if !ok {
+		t.Fatalf("unexpected prompts/list result: %#v", response.Result)
+	}
+	if len(prompts.Prompts) != 150 {
+		t.Fatalf("expected 150 prompts, got %d", len(prompts.Prompts))
+	}
+}
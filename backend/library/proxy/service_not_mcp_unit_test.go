@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+)
+
+func TestCreateMcpClientReportsNotMCPServer(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	tests := []struct {
+		name       string
+		script     string
+		wantNotMCP bool
+	}{
+		{"prints usage and exits", "echo 'Usage: some-cli [options] <file>' >&2; echo '  --help  show help' >&2; exit 1", true},
+		{"exits without usage", "echo 'boom: missing config' >&2; exit 1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, _ := json.Marshal([]string{"-c", tt.script})
+			svc := &model.MCPService{
+				Name:     "not-mcp",
+				Type:     model.ServiceTypeStdio,
+				Command:  "sh",
+				ArgsJSON: string(args),
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			start := time.Now()
+			_, _, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "test-key", svc, "test", nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := errors.Is(err, ErrNotMCPServer); got != tt.wantNotMCP {
+				t.Fatalf("errors.Is(err, ErrNotMCPServer) = %v, want %v (err: %v)", got, tt.wantNotMCP, err)
+			}
+			// 进程退出后应立即失败，而不是等到握手超时
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("initialize failure took %s, expected an early exit", elapsed)
+			}
+		})
+	}
+}
+
+func TestLooksLikeUsageOutput(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  bool
+	}{
+		{[]string{"Usage: foo [options]"}, true},
+		{[]string{"some banner", "Options:", "  -v"}, true},
+		{[]string{"Run with --help for more information"}, true},
+		{[]string{"Error: ENOENT"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeUsageOutput(tt.lines); got != tt.want {
+			t.Errorf("looksLikeUsageOutput(%q) = %v, want %v", tt.lines, got, tt.want)
+		}
+	}
+}
+
+// stderrlessClient hides the concrete *mcpclient.Client so its stderr cannot be obtained
+type stderrlessClient struct {
+	mcpclient.MCPClient
+}
+
+func TestCreateMcpClientWithoutStderrReportsExitStatus(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	originalNewClient := newStdioMCPClient
+	newStdioMCPClient = func(cmd *exec.Cmd, noise *stdoutNoise, clientOpts []mcpclient.ClientOption) (mcpclient.MCPClient, error) {
+		client, err := originalNewClient(cmd, noise, clientOpts)
+		if err != nil {
+			return nil, err
+		}
+		return &stderrlessClient{MCPClient: client}, nil
+	}
+	defer func() {
+		common.SQLitePath = originalPath
+		newStdioMCPClient = originalNewClient
+	}()
+
+	args, _ := json.Marshal([]string{"-c", "echo 'boom: missing config' >&2; exit 3"})
+	svc := &model.MCPService{
+		Name:     "stderrless-svc",
+		Type:     model.ServiceTypeStdio,
+		Command:  "sh",
+		ArgsJSON: string(args),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "test-key", svc, "test", nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("error should report the process exit status, got: %v", err)
+	}
+
+	name := svc.Name
+	logs, _, err := model.GetMCPLogs(context.Background(), nil, &name, nil, nil, 1, 10)
+	if err != nil {
+		t.Fatalf("GetMCPLogs: %v", err)
+	}
+	found := false
+	for _, log := range logs {
+		if strings.Contains(log.Message, "exit status 3") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected a logged initialization failure with the exit status, got %d logs", len(logs))
+	}
+}
+
+func TestCreateMcpClientReportsNonProtocolStdout(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	// 读取 initialize 请求后只在 stdout 打印日志，从不回复 JSON-RPC
+	script := `echo 'Server starting on port 3000'; read line; echo 'Loaded 3 plugins'; exit 0`
+	args, _ := json.Marshal([]string{"-c", script})
+	svc := &model.MCPService{
+		Name:     "noisy-stdout-svc",
+		Type:     model.ServiceTypeStdio,
+		Command:  "sh",
+		ArgsJSON: string(args),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "noisy-stdout-key", svc, "test", nil)
+	if !errors.Is(err, ErrNonProtocolStdout) {
+		t.Fatalf("expected ErrNonProtocolStdout, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "service wrote non-protocol data to stdout") || !strings.Contains(err.Error(), "Server starting on port 3000 | Loaded 3 plugins") {
+		t.Fatalf("error should name the problem and quote the offending output, got: %v", err)
+	}
+}
+
+func TestStdoutNoiseIgnoresProtocolMessages(t *testing.T) {
+	noise := &stdoutNoise{}
+	input := `{"jsonrpc":"2.0","id":1,"result":{}}` + "\n" +
+		"debug: connected\n" +
+		`[{"jsonrpc":"2.0","method":"notifications/initialized"}]` + "\n" +
+		"\n" +
+		"shutting " + "down"
+	reader := noise.wrap(strings.NewReader(input))
+	buf := make([]byte, 7) // 小块读取，验证跨读取拼接行
+	var out strings.Builder
+	for {
+		n, err := reader.Read(buf)
+		out.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	if out.String() != input {
+		t.Fatalf("stdout must pass through unchanged, got %q", out.String())
+	}
+	got := noise.snapshot()
+	if len(got) != 2 || got[0] != "debug: connected" || got[1] != "shutting down" {
+		t.Fatalf("unexpected recorded noise: %q", got)
+	}
+}
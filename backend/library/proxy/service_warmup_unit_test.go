@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPingFailingUpstream 启动一个 streamable HTTP upstream：initialize 正常完成，ping 在 failPings 为 true 时返回错误
+func newPingFailingUpstream(t *testing.T, failPings bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var pings atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(req.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		response := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "initialize":
+			response["result"] = map[string]any{
+				"protocolVersion": mcp.LATEST_PROTOCOL_VERSION,
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "mock", "version": "1.0.0"},
+			}
+		case "ping":
+			pings.Add(1)
+			if failPings {
+				response["error"] = map[string]any{"code": -32603, "message": "upstream session lost"}
+			} else {
+				response["result"] = map[string]any{}
+			}
+		case "tools/list":
+			response["result"] = map[string]any{"tools": []any{}}
+		default:
+			response["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &pings
+}
+
+func TestCreateMcpClientWarmupPing(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	defer func() { common.SQLitePath = originalPath }()
+
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap[common.OptionMcpWarmupPingTimeout] = "2s"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		delete(common.OptionMap, common.OptionMcpWarmupPingTimeout)
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	tests := []struct {
+		name      string
+		failPings bool
+		wantErr   bool
+	}{
+		{"first ping fails", true, true},
+		{"first ping succeeds", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, pings := newPingFailingUpstream(t, tt.failPings)
+			svc := &model.MCPService{Name: "warmup", Type: model.ServiceTypeStreamableHTTP, Command: upstream.URL, InstalledVersion: "1.0.0"}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_, cli, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "warmup-key", svc, "test", nil)
+			assert.Equal(t, int32(1), pings.Load())
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					assert.True(t, strings.Contains(err.Error(), "Warm-up ping failed"), err.Error())
+					assert.Contains(t, err.Error(), "upstream session lost")
+				}
+				assert.Nil(t, cli)
+				return
+			}
+			if assert.NoError(t, err) && assert.NotNil(t, cli) {
+				_ = cli.Close()
+			}
+		})
+	}
+}
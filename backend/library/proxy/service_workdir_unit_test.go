@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+func TestBuildStdioCmdUsesWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		workDir string
+	}{
+		{"configured", dir},
+		{"inherited", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := buildStdioCmd(context.Background(), "node", []string{"FOO=bar"}, []string{"server.js"}, tt.workDir)
+			if cmd.Dir != tt.workDir {
+				t.Fatalf("cmd.Dir = %q, want %q", cmd.Dir, tt.workDir)
+			}
+		})
+	}
+}
+
+func TestCreateMcpClientRunsInWorkingDir(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A directory that does not exist is rejected before spawning anything
+	missing := &model.MCPService{Name: "workdir-missing", Type: model.ServiceTypeStdio, Command: "sh", WorkingDir: filepath.Join(t.TempDir(), "missing")}
+	_, _, _, _, _, err := createActualMcpGoServerAndClientUncached(ctx, context.Background(), "test-key", missing, "test", nil)
+	if err == nil || !strings.Contains(err.Error(), "Invalid working directory") {
+		t.Fatalf("expected invalid working directory error, got %v", err)
+	}
+
+	// The spawned process runs inside the configured directory; it reports pwd as usage output,
+	// which the not-an-MCP-server diagnostics include in the returned error
+	dir := t.TempDir()
+	svc := &model.MCPService{Name: "workdir-ok", Type: model.ServiceTypeStdio, Command: "sh", ArgsJSON: `["-c", "echo \"Usage: cwd=$(pwd)\" >&2; exit 1"]`, WorkingDir: dir}
+	_, _, _, _, _, err = createActualMcpGoServerAndClientUncached(ctx, context.Background(), "test-key", svc, "test", nil)
+	if !errors.Is(err, ErrNotMCPServer) {
+		t.Fatalf("expected ErrNotMCPServer, got %v", err)
+	}
+	resolved, _ := filepath.EvalSymlinks(dir)
+	if !strings.Contains(err.Error(), "cwd="+dir) && !strings.Contains(err.Error(), "cwd="+resolved) {
+		t.Fatalf("expected subprocess to run in %s, got %v", dir, err)
+	}
+}
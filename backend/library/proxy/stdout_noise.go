@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrNonProtocolStdout indicates a stdio server wrote output that is not JSON-RPC to stdout, which corrupts
+// the MCP stream (typically logging or banners that belong on stderr).
+var ErrNonProtocolStdout = errors.New("service wrote non-protocol data to stdout")
+
+const (
+	// maxStdoutNoiseLines bounds how many non-protocol stdout lines are kept for diagnostics
+	maxStdoutNoiseLines = 5
+	// maxStdoutNoiseLineLen bounds the length of each kept line
+	maxStdoutNoiseLineLen = 200
+)
+
+// stdoutNoise records the first stdout lines of a stdio server that are not JSON-RPC messages.
+// The mcp-go transport silently skips such lines, so without it a noisy server only shows up as an
+// initialize timeout or a closed transport. Only the beginning of each line is buffered.
+type stdoutNoise struct {
+	mu    sync.Mutex
+	head  []byte // beginning of the current line
+	lines []string
+}
+
+// wrap returns a reader that passes stdout through unchanged while recording its non-protocol lines
+func (n *stdoutNoise) wrap(stdout io.Reader) io.Reader {
+	return &stdoutNoiseReader{noise: n, r: stdout}
+}
+
+func (n *stdoutNoise) observe(data []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for len(data) > 0 && len(n.lines) < maxStdoutNoiseLines {
+		idx := bytes.IndexByte(data, '\n')
+		chunk := data
+		if idx >= 0 {
+			chunk = data[:idx]
+		}
+		if room := maxStdoutNoiseLineLen + 1 - len(n.head); room > 0 {
+			n.head = append(n.head, chunk[:min(room, len(chunk))]...)
+		}
+		if idx < 0 {
+			return
+		}
+		n.flush()
+		data = data[idx+1:]
+	}
+}
+
+// flush records the buffered line unless it looks like a JSON-RPC message
+func (n *stdoutNoise) flush() {
+	text := strings.TrimSpace(string(n.head))
+	n.head = n.head[:0]
+	if text == "" || text[0] == '{' || text[0] == '[' || len(n.lines) >= maxStdoutNoiseLines {
+		return
+	}
+	if len(text) > maxStdoutNoiseLineLen {
+		text = text[:maxStdoutNoiseLineLen] + "..."
+	}
+	n.lines = append(n.lines, text)
+}
+
+// snapshot returns the recorded non-protocol lines
+func (n *stdoutNoise) snapshot() []string {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.lines...)
+}
+
+type stdoutNoiseReader struct {
+	noise *stdoutNoise
+	r     io.Reader
+}
+
+func (r *stdoutNoiseReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.noise.observe(p[:n])
+	}
+	if err != nil {
+		// 进程退出前最后一行可能没有换行符
+		r.noise.mu.Lock()
+		r.noise.flush()
+		r.noise.mu.Unlock()
+	}
+	return n, err
+}
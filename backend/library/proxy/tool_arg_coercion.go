@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	mcp "github.com/mark3labs/mcp-go/mcp"
+)
+
+// CoerceToolArguments returns a copy of args in which string values are converted to the
+// number/integer/boolean type declared by the tool's input schema. Values that don't parse,
+// or whose schema also allows "string", are passed through unchanged.
+func CoerceToolArguments(tool mcp.Tool, args map[string]any) map[string]any {
+	if len(args) == 0 || len(tool.InputSchema.Properties) == 0 {
+		return args
+	}
+	return coerceObject(tool.InputSchema.Properties, args)
+}
+
+func coerceObject(properties map[string]any, args map[string]any) map[string]any {
+	out := make(map[string]any, len(args))
+	for key, value := range args {
+		schema, _ := properties[key].(map[string]any)
+		out[key] = coerceValue(schema, value)
+	}
+	return out
+}
+
+func coerceValue(schema map[string]any, value any) any {
+	if schema == nil {
+		return value
+	}
+	types := SchemaTypes(schema)
+	switch v := value.(type) {
+	case string:
+		if types["string"] {
+			return value
+		}
+		s := strings.TrimSpace(v)
+		if types["integer"] {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n
+			}
+			if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+				return int64(f)
+			}
+		}
+		if types["number"] {
+			if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				return f
+			}
+		}
+		if types["boolean"] {
+			switch strings.ToLower(s) {
+			case "true":
+				return true
+			case "false":
+				return false
+			}
+		}
+		return value
+	case map[string]any:
+		if properties, ok := schema["properties"].(map[string]any); ok {
+			return coerceObject(properties, v)
+		}
+		return value
+	case []any:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return value
+		}
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = coerceValue(items, item)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// SchemaTypes returns the set of JSON Schema types declared by "type" (a string or an array of strings)
+func SchemaTypes(schema map[string]any) map[string]bool {
+	types := map[string]bool{}
+	switch t := schema["type"].(type) {
+	case string:
+		types[t] = true
+	case []any:
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types[s] = true
+			}
+		}
+	case []string:
+		for _, s := range t {
+			types[s] = true
+		}
+	}
+	return types
+}
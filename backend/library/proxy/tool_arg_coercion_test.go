@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+var coercionTestTool = mcp.Tool{
+	Name: "search",
+	InputSchema: mcp.ToolInputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"limit":   map[string]any{"type": "integer"},
+			"ratio":   map[string]any{"type": "number"},
+			"verbose": map[string]any{"type": "boolean"},
+			"query":   map[string]any{"type": "string"},
+			"page":    map[string]any{"type": []any{"integer", "string"}},
+			"filter":  map[string]any{"type": "object", "properties": map[string]any{"min": map[string]any{"type": "number"}}},
+			"ids":     map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+		},
+	},
+}
+
+func TestCoerceToolArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]any
+		want map[string]any
+	}{
+		{
+			name: "string encoded scalars",
+			args: map[string]any{"limit": "10", "ratio": "0.5", "verbose": "TRUE", "query": "42"},
+			want: map[string]any{"limit": int64(10), "ratio": 0.5, "verbose": true, "query": "42"},
+		},
+		{
+			name: "nested objects and arrays",
+			args: map[string]any{"filter": map[string]any{"min": "1.5"}, "ids": []any{"1", "2"}},
+			want: map[string]any{"filter": map[string]any{"min": 1.5}, "ids": []any{int64(1), int64(2)}},
+		},
+		{
+			name: "unparseable or string-allowed values are untouched",
+			args: map[string]any{"limit": "ten", "verbose": "yes", "page": "3", "unknown": "7"},
+			want: map[string]any{"limit": "ten", "verbose": "yes", "page": "3", "unknown": "7"},
+		},
+		{
+			name: "already typed values",
+			args: map[string]any{"limit": float64(10), "verbose": false},
+			want: map[string]any{"limit": float64(10), "verbose": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CoerceToolArguments(coercionTestTool, tt.args))
+		})
+	}
+}
+
+func TestInstanceToolCallCoercesArgumentsWhenEnabled(t *testing.T) {
+	var received map[string]any
+	upstream := mcpserver.NewMCPServer("coerce", "1.0.0")
+	upstream.AddTool(coercionTestTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		received = request.GetArguments()
+		return mcp.NewToolResultText("ok"), nil
+	})
+	cli, err := mcpclient.NewInProcessClient(upstream)
+	assert.NoError(t, err)
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = cli.Initialize(context.Background(), initReq)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		coerce bool
+		want   map[string]any
+	}{
+		// 参数经 JSON 传输，数字在上游解码为 float64
+		{"enabled", true, map[string]any{"limit": float64(10), "verbose": true}},
+		{"disabled by default", false, map[string]any{"limit": "10", "verbose": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 单服务代理路径：请求经实例的 MCP server 转发到上游
+			server := mcpserver.NewMCPServer("coerce-proxy", "1.0.0")
+			_, err := addClientToolsToMCPServer(context.Background(), cli, server, "coerce-svc", "coerce-key-"+tt.name, 916, model.ServiceTypeStdio, tt.coerce, 0, nil)
+			assert.NoError(t, err)
+
+			request := mcp.CallToolRequest{}
+			request.Params.Name = "search"
+			request.Params.Arguments = map[string]any{"limit": "10", "verbose": "true"}
+			_, err = server.GetTool("search").Handler(context.Background(), request)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, received)
+		})
+	}
+}
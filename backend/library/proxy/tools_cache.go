@@ -2,6 +2,8 @@ package proxy
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -28,6 +30,8 @@ type ToolsCacheManager struct {
 	expireTime  time.Duration
 	mutex       sync.RWMutex
 	local       map[string]toolsLocalCacheItem
+	digests     map[int64]string // digest of the last tool list stored per service
+	versions    map[int64]uint64 // bumped whenever the tool list of a service changes
 }
 
 func NewToolsCacheManager(expireTime time.Duration) *ToolsCacheManager {
@@ -39,9 +43,19 @@ func NewToolsCacheManager(expireTime time.Duration) *ToolsCacheManager {
 		cacheClient: thing.Cache(),
 		expireTime:  expireTime,
 		local:       make(map[string]toolsLocalCacheItem),
+		digests:     make(map[int64]string),
+		versions:    make(map[int64]uint64),
 	}
 }
 
+// ToolsVersion returns a counter that changes whenever a different tool list is stored for the service or its
+// tools are deleted, so handlers built from the tools can tell when they are out of date
+func (tcm *ToolsCacheManager) ToolsVersion(serviceID int64) uint64 {
+	tcm.mutex.RLock()
+	defer tcm.mutex.RUnlock()
+	return tcm.versions[serviceID]
+}
+
 func (tcm *ToolsCacheManager) generateCacheKey(serviceID int64) string {
 	return fmt.Sprintf("tools:service:%d", serviceID)
 }
@@ -63,6 +77,13 @@ func (tcm *ToolsCacheManager) SetServiceTools(serviceID int64, entry *ToolsCache
 		log.Printf("Error marshaling tools cache for service %d: %v", serviceID, err)
 		return
 	}
+	if toolsJSON, err := json.Marshal(entry.Tools); err == nil {
+		sum := sha256.Sum256(toolsJSON)
+		if digest := hex.EncodeToString(sum[:]); tcm.digests[serviceID] != digest {
+			tcm.digests[serviceID] = digest
+			tcm.versions[serviceID]++
+		}
+	}
 
 	if tcm.cacheClient == nil {
 		tcm.local[cacheKey] = toolsLocalCacheItem{
@@ -120,6 +141,10 @@ func (tcm *ToolsCacheManager) DeleteServiceTools(serviceID int64) {
 
 	ctx := context.Background()
 	cacheKey := tcm.generateCacheKey(serviceID)
+	if _, ok := tcm.digests[serviceID]; ok {
+		delete(tcm.digests, serviceID)
+		tcm.versions[serviceID]++
+	}
 
 	if tcm.cacheClient == nil {
 		delete(tcm.local, cacheKey)
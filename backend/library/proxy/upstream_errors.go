@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// upstreamStatusError is an HTTP 5xx response of the upstream server of an SSE/HTTP instance. The mcp-go
+// transports only report the status as text, so upstreamStatusTransport turns these responses into this error
+// before they reach them.
+type upstreamStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("upstream returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// upstreamStatusTransport wraps the http.RoundTripper of an SSE/HTTP instance and fails requests answered
+// with a 5xx status with an *upstreamStatusError
+type upstreamStatusTransport struct {
+	base http.RoundTripper
+}
+
+func (t *upstreamStatusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < http.StatusInternalServerError {
+		return resp, err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body.Close()
+	return nil, &upstreamStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
+
+// isUpstreamServerError reports whether err is an HTTP 5xx response of the upstream server
+func isUpstreamServerError(err error) bool {
+	var statusErr *upstreamStatusError
+	return errors.As(err, &statusErr)
+}
+
+type upstreamCallOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// upstreamErrorTracker keeps the outcome of the recent tool calls of one instance
+type upstreamErrorTracker struct {
+	mu          sync.Mutex
+	calls       []upstreamCallOutcome
+	lastRestart time.Time
+}
+
+// record adds a call outcome and reports whether the share of upstream 5xx failures within window reached
+// thresholdPercent over at least minCalls calls. A restart is reported at most once per cooldown; the window
+// starts over after it.
+func (t *upstreamErrorTracker) record(now time.Time, failed bool, thresholdPercent, minCalls int, window, cooldown time.Duration) (restart bool, failures, total int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := now.Add(-window)
+	kept := t.calls[:0]
+	for _, call := range t.calls {
+		if call.at.After(cutoff) {
+			kept = append(kept, call)
+		}
+	}
+	t.calls = append(kept, upstreamCallOutcome{at: now, failed: failed})
+
+	if !failed || thresholdPercent <= 0 {
+		return false, 0, len(t.calls)
+	}
+	for _, call := range t.calls {
+		if call.failed {
+			failures++
+		}
+	}
+	total = len(t.calls)
+	if total < minCalls || failures*100 < thresholdPercent*total {
+		return false, failures, total
+	}
+	if !t.lastRestart.IsZero() && now.Sub(t.lastRestart) < cooldown {
+		return false, failures, total
+	}
+	t.lastRestart = now
+	t.calls = nil
+	return true, failures, total
+}
+
+var (
+	upstreamErrorTrackersMu sync.Mutex
+	upstreamErrorTrackers   = map[string]*upstreamErrorTracker{}
+)
+
+// upstreamErrorTrackerFor returns the tracker of the instance cached under cacheKey. It outlives re-creations of
+// the instance until its restart cooldown is over, so the cooldown holds across them; see
+// pruneUpstreamErrorTracker.
+func upstreamErrorTrackerFor(cacheKey string) *upstreamErrorTracker {
+	upstreamErrorTrackersMu.Lock()
+	defer upstreamErrorTrackersMu.Unlock()
+	tracker, ok := upstreamErrorTrackers[cacheKey]
+	if !ok {
+		tracker = &upstreamErrorTracker{}
+		upstreamErrorTrackers[cacheKey] = tracker
+	}
+	return tracker
+}
+
+// pruneUpstreamErrorTracker drops the tracker of the instance cached under cacheKey when the instance shuts
+// down. A tracker still in its restart cooldown is kept until the cooldown is over, and for good when an
+// instance was cached under cacheKey again by then.
+func pruneUpstreamErrorTracker(cacheKey string) {
+	upstreamErrorTrackersMu.Lock()
+	defer upstreamErrorTrackersMu.Unlock()
+	tracker, ok := upstreamErrorTrackers[cacheKey]
+	if !ok {
+		return
+	}
+	_, _, _, cooldown := common.GetUpstreamErrorRestartConfig()
+	tracker.mu.Lock()
+	remaining := time.Duration(0)
+	if !tracker.lastRestart.IsZero() {
+		remaining = cooldown - time.Since(tracker.lastRestart)
+	}
+	tracker.mu.Unlock()
+	if remaining <= 0 {
+		delete(upstreamErrorTrackers, cacheKey)
+		return
+	}
+	time.AfterFunc(remaining, func() {
+		sharedMCPServersMutex.Lock()
+		_, cached := sharedMCPServers[cacheKey]
+		sharedMCPServersMutex.Unlock()
+		if !cached {
+			pruneUpstreamErrorTracker(cacheKey)
+		}
+	})
+}
+
+// recordUpstreamCallResult records the outcome of a tool call on an SSE/HTTP instance and drops the cached
+// instance when upstream 5xx errors exceed the UpstreamErrorRestart* options, so it is re-created. Errors
+// that already invalidated the instance should not be recorded.
+func recordUpstreamCallResult(cacheKey string, serviceID int64, serviceName string, serviceType model.ServiceType, callErr error) {
+	if cacheKey == "" || (serviceType != model.ServiceTypeSSE && serviceType != model.ServiceTypeStreamableHTTP) {
+		return
+	}
+	// A 401 for a service behind OAuth means its token is no longer accepted: the instance is re-created with a
+	// refreshed one
+	if errors.Is(callErr, transport.ErrUnauthorized) && expireServiceOAuthToken(serviceID) {
+		msg := "Upstream rejected the OAuth token (401), refreshing it and re-creating the instance"
+		common.SysError(fmt.Sprintf("%s (service %s, ID: %d)", msg, serviceName, serviceID))
+		_ = model.SaveMCPLog(context.Background(), serviceID, serviceName, model.MCPLogPhaseRun, model.MCPLogLevelWarn, msg)
+		handleTransportErrorForCache(cacheKey, serviceID, serviceName, serviceType, "upstream 401", callErr)
+		return
+	}
+	thresholdPercent, minCalls, window, cooldown := common.GetUpstreamErrorRestartConfig()
+	if thresholdPercent <= 0 {
+		return
+	}
+	restart, failures, total := upstreamErrorTrackerFor(cacheKey).record(time.Now(), isUpstreamServerError(callErr), thresholdPercent, minCalls, window, cooldown)
+	if !restart {
+		return
+	}
+	msg := fmt.Sprintf("Upstream returned 5xx for %d of the last %d tool calls within %s, restarting the instance", failures, total, window)
+	common.SysError(fmt.Sprintf("%s (service %s, ID: %d)", msg, serviceName, serviceID))
+	_ = model.SaveMCPLog(context.Background(), serviceID, serviceName, model.MCPLogPhaseRun, model.MCPLogLevelWarn, msg)
+	handleTransportErrorForCache(cacheKey, serviceID, serviceName, serviceType, "upstream 5xx storm", callErr)
+}
+
+// RecordUpstreamCallResult records the outcome of a tool call made directly on the instance's client;
+// see recordUpstreamCallResult.
+func (s *SharedMcpInstance) RecordUpstreamCallResult(callErr error) {
+	if s == nil {
+		return
+	}
+	recordUpstreamCallResult(s.cacheKey, s.serviceID, s.serviceName, s.serviceType, callErr)
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// failingCallMcpClient fails every tool call with callErr
+type failingCallMcpClient struct {
+	fakeMcpClient
+	callErr error
+}
+
+func (f *failingCallMcpClient) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if f.callErr != nil {
+		return nil, f.callErr
+	}
+	return &mcp.CallToolResult{}, nil
+}
+
+func TestUpstreamStatusTransport(t *testing.T) {
+	status := http.StatusOK
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("upstream says no"))
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: &upstreamStatusTransport{base: http.DefaultTransport}}
+
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusNotFound, false},
+		{http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		status = tt.status
+		resp, err := client.Get(upstream.URL)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		// mcp-go 包装传输错误后仍能识别
+		wrapped := fmt.Errorf("transport error: failed to send request: %w", err)
+		if got := isUpstreamServerError(wrapped); got != tt.want {
+			t.Errorf("status %d: isUpstreamServerError(%v) = %v, want %v", tt.status, wrapped, got, tt.want)
+		}
+		if tt.want && !strings.Contains(err.Error(), "upstream says no") {
+			t.Errorf("status %d: expected the response body in the error, got %v", tt.status, err)
+		}
+	}
+	// 仅文本中包含状态码的错误不算上游 5xx
+	if isUpstreamServerError(errors.New("request failed with status 502: Bad Gateway")) {
+		t.Errorf("expected an untyped error not to count as an upstream 5xx")
+	}
+}
+
+func TestPruneUpstreamErrorTracker(t *testing.T) {
+	registered := func(cacheKey string) bool {
+		upstreamErrorTrackersMu.Lock()
+		defer upstreamErrorTrackersMu.Unlock()
+		_, ok := upstreamErrorTrackers[cacheKey]
+		return ok
+	}
+
+	upstreamErrorTrackerFor("upstream-prune-idle")
+	pruneUpstreamErrorTracker("upstream-prune-idle")
+	if registered("upstream-prune-idle") {
+		t.Fatal("expected the tracker to be pruned on shutdown")
+	}
+
+	// 重建冷却期内保留，避免关闭后立即重建时再次触发重启
+	upstreamErrorTrackerFor("upstream-prune-cooldown").lastRestart = time.Now()
+	pruneUpstreamErrorTracker("upstream-prune-cooldown")
+	if !registered("upstream-prune-cooldown") {
+		t.Fatal("expected the tracker to be kept during the restart cooldown")
+	}
+	upstreamErrorTrackersMu.Lock()
+	delete(upstreamErrorTrackers, "upstream-prune-cooldown")
+	upstreamErrorTrackersMu.Unlock()
+}
+
+func TestUpstreamErrorTrackerThresholdAndCooldown(t *testing.T) {
+	tracker := &upstreamErrorTracker{}
+	now := time.Now()
+	record := func(offset time.Duration, failed bool) bool {
+		restart, _, _ := tracker.record(now.Add(offset), failed, 50, 4, time.Minute, 5*time.Minute)
+		return restart
+	}
+
+	// 成功调用稀释错误率，未达到最少调用次数时不触发
+	for i, failed := range []bool{false, true, false, true} {
+		if record(time.Duration(i)*time.Second, failed) != (i == 3) {
+			t.Fatalf("call %d: unexpected restart decision", i)
+		}
+	}
+	// 冷却期内再次出现错误风暴不会重复重建
+	for i := 0; i < 6; i++ {
+		if record(time.Duration(10+i)*time.Second, true) {
+			t.Fatalf("restart triggered again within the cooldown")
+		}
+	}
+	// 窗口外的旧失败不计入，冷却结束后重新触发
+	for i := 0; i < 3; i++ {
+		if record(6*time.Minute+time.Duration(i)*time.Second, true) {
+			t.Fatalf("restart triggered before reaching the minimum call count in the new window")
+		}
+	}
+	if !record(6*time.Minute+3*time.Second, true) {
+		t.Fatalf("expected a restart after the cooldown")
+	}
+}
+
+func TestToolCallUpstream5xxStormRestartsInstance(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer func() { common.SQLitePath = originalPath }()
+
+	common.OptionMapRWMutex.Lock()
+	original := map[string]string{}
+	for _, key := range []string{common.OptionUpstreamErrorRestartThreshold, common.OptionUpstreamErrorRestartMinCalls} {
+		original[key] = common.OptionMap[key]
+	}
+	common.OptionMap[common.OptionUpstreamErrorRestartThreshold] = "50"
+	common.OptionMap[common.OptionUpstreamErrorRestartMinCalls] = "4"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		defer common.OptionMapRWMutex.Unlock()
+		for key, value := range original {
+			common.OptionMap[key] = value
+		}
+	}()
+
+	const cacheKey = "upstream-5xx-storm-key"
+	client := &failingCallMcpClient{callErr: fmt.Errorf("transport error: failed to send request: %w", &upstreamStatusError{StatusCode: http.StatusBadGateway, Body: "Bad Gateway"})}
+	client.listToolsFn = func(ctx context.Context) (*mcp.ListToolsResult, error) {
+		return &mcp.ListToolsResult{Tools: []mcp.Tool{mcp.NewTool("search")}}, nil
+	}
+	server := mcpserver.NewMCPServer("storm-svc", "1.0.0")
+	if _, err := addClientToolsToMCPServer(context.Background(), client, server, "storm-svc", cacheKey, 970001, model.ServiceTypeStreamableHTTP, false, 0, nil); err != nil {
+		t.Fatalf("addClientToolsToMCPServer: %v", err)
+	}
+	inst := &SharedMcpInstance{Server: server, Client: client, cancel: func() {}, serviceID: 970001, serviceName: "storm-svc", serviceType: model.ServiceTypeStreamableHTTP, cacheKey: cacheKey}
+	sharedMCPServersMutex.Lock()
+	sharedMCPServers[cacheKey] = inst
+	sharedMCPServersMutex.Unlock()
+	defer func() {
+		sharedMCPServersMutex.Lock()
+		delete(sharedMCPServers, cacheKey)
+		sharedMCPServersMutex.Unlock()
+	}()
+
+	cached := func() bool {
+		sharedMCPServersMutex.Lock()
+		defer sharedMCPServersMutex.Unlock()
+		_, ok := sharedMCPServers[cacheKey]
+		return ok
+	}
+	tool := server.GetTool("search")
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "search"
+	for i := 1; i <= 4; i++ {
+		if _, err := tool.Handler(context.Background(), request); err == nil {
+			t.Fatalf("call %d: expected the upstream error", i)
+		}
+		if i < 4 && !cached() {
+			t.Fatalf("instance dropped after only %d failed calls", i)
+		}
+	}
+	if cached() {
+		t.Fatalf("expected the instance to be dropped for re-creation after a burst of upstream 5xx errors")
+	}
+	if !client.closeCalled.Load() {
+		t.Fatalf("expected the old instance to be shut down")
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+)
+
+// userInstanceShutdownTimeout bounds the shutdown of one evicted user-specific instance
+const userInstanceShutdownTimeout = 30 * time.Second
+
+// isUserServiceCacheKey reports whether key is the cache key of a user-specific instance (any env profile)
+func isUserServiceCacheKey(key string) bool {
+	return strings.HasPrefix(key, "user-") && strings.Contains(key, "-service-")
+}
+
+// BeginUse marks a downstream request as in flight on the instance until the returned function is called.
+// In-flight instances are never evicted by the MaxUserInstancesPerService cap, and idle ones are evicted least
+// recently used first.
+func (s *SharedMcpInstance) BeginUse() func() {
+	if s == nil {
+		return func() {}
+	}
+	s.inFlight.Add(1)
+	s.touch()
+	return func() {
+		s.touch()
+		s.inFlight.Add(-1)
+	}
+}
+
+// touch records the instance as used now
+func (s *SharedMcpInstance) touch() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+// evictIdleUserInstancesLocked removes the least recently used idle user-specific instances of a service from
+// the cache until it holds at most MaxUserInstancesPerService of them, never evicting keep or an instance with
+// requests in flight. It returns the evicted instances, which the caller shuts down. The caller holds
+// sharedMCPServersMutex.
+func evictIdleUserInstancesLocked(serviceID int64, keep string) []*SharedMcpInstance {
+	limit := common.GetMaxUserInstancesPerService()
+	if limit <= 0 {
+		return nil
+	}
+	count := 0
+	var idle []*SharedMcpInstance
+	for key, inst := range sharedMCPServers {
+		if inst == nil || inst.serviceID != serviceID || !isUserServiceCacheKey(key) {
+			continue
+		}
+		count++
+		if key != keep && inst.inFlight.Load() == 0 {
+			idle = append(idle, inst)
+		}
+	}
+	excess := count - limit
+	if excess <= 0 {
+		return nil
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i].lastUsed.Load() < idle[j].lastUsed.Load() })
+	if excess > len(idle) {
+		common.SysLog(fmt.Sprintf("Service %d has %d user-specific instances, over the cap of %d, but only %d are idle; the busy ones are kept", serviceID, count, limit, len(idle)))
+		excess = len(idle)
+	}
+	evicted := idle[:excess]
+	for _, inst := range evicted {
+		delete(sharedMCPServers, inst.cacheKey)
+	}
+	return evicted
+}
+
+// shutdownEvictedUserInstances stops user-specific instances evicted by the MaxUserInstancesPerService cap
+func shutdownEvictedUserInstances(serviceID int64, evicted []*SharedMcpInstance) {
+	// 只清除被淘汰实例的代理 handler，同一服务其他实例的会话不受影响
+	for _, inst := range evicted {
+		clearInstanceProxyHandlers(serviceID, inst.cacheKey)
+	}
+	for _, inst := range evicted {
+		ctx, cancel := context.WithTimeout(context.Background(), userInstanceShutdownTimeout)
+		if err := inst.Shutdown(ctx); err != nil {
+			common.SysError(fmt.Sprintf("Failed to shut down evicted user-specific instance %s of service %d: %v", inst.cacheKey, serviceID, err))
+		}
+		cancel()
+	}
+	common.SysLog(fmt.Sprintf("Evicted %d idle user-specific instance(s) of service %d to stay within the cap of %d", len(evicted), serviceID, common.GetMaxUserInstancesPerService()))
+}
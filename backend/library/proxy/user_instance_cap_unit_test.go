@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserInstanceCapEvictsLeastRecentlyUsedIdleInstances(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap[common.OptionMaxUserInstancesPerService] = "2"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.SQLitePath = originalPath
+		common.OptionMapRWMutex.Lock()
+		delete(common.OptionMap, common.OptionMaxUserInstancesPerService)
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	upstream, _ := newCorrelationUpstream(t)
+	svc := &model.MCPService{Name: "capped-svc", Type: model.ServiceTypeStreamableHTTP, Command: upstream.URL, Enabled: true}
+	svc.ID = 998
+	otherSvc := &model.MCPService{Name: "other-svc", Type: model.ServiceTypeStreamableHTTP, Command: upstream.URL, Enabled: true}
+	otherSvc.ID = 999
+
+	instances := map[string]*SharedMcpInstance{}
+	getOrCreate := func(svc *model.MCPService, userID int64) *SharedMcpInstance {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		key := UserServiceCacheKey(userID, svc.ID)
+		inst, err := getOrCreateSharedMcpInstanceWithKeyInternal(ctx, svc, key, "test", "")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		instances[key] = inst
+		// Separate timestamps so the LRU order is deterministic
+		time.Sleep(2 * time.Millisecond)
+		return inst
+	}
+	cached := func(userID int64) bool {
+		sharedMCPServersMutex.Lock()
+		defer sharedMCPServersMutex.Unlock()
+		_, ok := sharedMCPServers[UserServiceCacheKey(userID, svc.ID)]
+		return ok
+	}
+	defer func() {
+		sharedMCPServersMutex.Lock()
+		for key := range instances {
+			delete(sharedMCPServers, key)
+		}
+		sharedMCPServersMutex.Unlock()
+		for _, inst := range instances {
+			_ = inst.Shutdown(context.Background())
+		}
+	}()
+
+	handlerCached := func(userID int64) bool {
+		httpWrappersMutex.Lock()
+		defer httpWrappersMutex.Unlock()
+		_, ok := initializedHTTPProxyWrappers[proxyHandlerCacheKey(svc.ID, "httpproxy", UserServiceCacheKey(userID, svc.ID))]
+		return ok
+	}
+	defer ClearProxyHandlerCaches(svc.ID)
+
+	getOrCreate(otherSvc, 1) // instances of other services do not count towards the cap
+	handler1, err := GetOrCreateProxyToHTTPHandler(context.Background(), svc, getOrCreate(svc, 1))
+	assert.NoError(t, err)
+	handler2, err := GetOrCreateProxyToHTTPHandler(context.Background(), svc, getOrCreate(svc, 2))
+	assert.NoError(t, err)
+	assert.NotSame(t, handler1, handler2, "each user-specific instance is served by its own handler")
+	getOrCreate(svc, 1) // user 1 is used again, user 2 is now the least recently used
+	getOrCreate(svc, 3)
+	assert.True(t, cached(1))
+	assert.False(t, cached(2), "the least recently used idle instance is evicted")
+	assert.True(t, cached(3))
+	// Only the handler of the evicted instance is dropped, sessions on the other instances keep working
+	assert.Eventually(t, func() bool { return !handlerCached(2) }, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, handlerCached(1))
+
+	// An instance with a request in flight is kept even when it is the least recently used
+	done := instances[UserServiceCacheKey(1, svc.ID)].BeginUse()
+	time.Sleep(2 * time.Millisecond)
+	getOrCreate(svc, 3)
+	getOrCreate(svc, 4)
+	assert.True(t, cached(1), "the busy instance is not evicted")
+	assert.False(t, cached(3))
+	assert.True(t, cached(4))
+
+	// The cap is exceeded rather than evicting busy instances
+	doneOther := instances[UserServiceCacheKey(4, svc.ID)].BeginUse()
+	getOrCreate(svc, 5)
+	assert.True(t, cached(1))
+	assert.True(t, cached(4))
+	assert.True(t, cached(5))
+	done()
+	doneOther()
+
+	sharedMCPServersMutex.Lock()
+	_, otherCached := sharedMCPServers[UserServiceCacheKey(1, otherSvc.ID)]
+	sharedMCPServersMutex.Unlock()
+	assert.True(t, otherCached)
+}
+
+func TestUserInstanceCapDisabledByDefault(t *testing.T) {
+	sharedMCPServersMutex.Lock()
+	defer sharedMCPServersMutex.Unlock()
+	for _, userID := range []int64{1, 2, 3} {
+		key := UserServiceCacheKey(userID, 997)
+		sharedMCPServers[key] = &SharedMcpInstance{serviceID: 997, cacheKey: key}
+		defer delete(sharedMCPServers, key)
+	}
+	assert.Empty(t, evictIdleUserInstancesLocked(997, UserServiceCacheKey(3, 997)))
+}
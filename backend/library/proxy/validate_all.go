@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"one-mcp/backend/model"
+)
+
+// Defaults and bounds of ValidateServices
+const (
+	DefaultValidateConcurrency = 4
+	MaxValidateConcurrency     = 32
+	DefaultValidateTimeout     = 30 * time.Second // per service
+	MaxValidateTimeout         = 5 * time.Minute
+	DefaultValidateMaxDuration = 5 * time.Minute // whole run
+	MaxValidateMaxDuration     = 30 * time.Minute
+)
+
+// ServiceValidationResult is the outcome of the throwaway initialize of one service
+type ServiceValidationResult struct {
+	ServiceID     int64             `json:"service_id"`
+	Name          string            `json:"name"`
+	Type          model.ServiceType `json:"type"`
+	Passed        bool              `json:"passed"`
+	Error         string            `json:"error,omitempty"`
+	Endpoint      string            `json:"endpoint,omitempty"` // endpoint that initialized, a fallback when the primary failed
+	ServerName    string            `json:"server_name,omitempty"`
+	ServerVersion string            `json:"server_version,omitempty"`
+	ToolCount     int               `json:"tool_count"`
+	DurationMs    int64             `json:"duration_ms"`
+}
+
+// ServiceValidationReport is the result of ValidateServices, with one result per service in input order
+type ServiceValidationReport struct {
+	Total      int                       `json:"total"`
+	Passed     int                       `json:"passed"`
+	Failed     int                       `json:"failed"`
+	Canceled   bool                      `json:"canceled"` // the run was canceled or hit its deadline before every service finished
+	DurationMs int64                     `json:"duration_ms"`
+	Results    []ServiceValidationResult `json:"results"`
+}
+
+// ValidateServices attempts a throwaway initialize of each service, at most concurrency at a time and each
+// bounded by timeout. The instances are separate from the cached ones and shut down right away, so running
+// instances are not affected; their pre-start and post-stop hooks do not run and the preferred endpoint and
+// installed version of the services are left unchanged. Canceling ctx stops the run: services not yet validated
+// fail as canceled.
+func ValidateServices(ctx context.Context, services []*model.MCPService, concurrency int, timeout time.Duration) ServiceValidationReport {
+	if concurrency <= 0 {
+		concurrency = DefaultValidateConcurrency
+	}
+	if timeout <= 0 {
+		timeout = DefaultValidateTimeout
+	}
+	start := time.Now()
+	report := ServiceValidationReport{Total: len(services), Results: make([]ServiceValidationResult, len(services))}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, svc := range services {
+		report.Results[i] = ServiceValidationResult{ServiceID: svc.ID, Name: svc.Name, Type: svc.Type}
+		acquired := false
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+				acquired = true
+			case <-ctx.Done():
+			}
+		}
+		if !acquired {
+			report.Results[i].Error = fmt.Sprintf("not validated: %v", ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(result *ServiceValidationResult, svc *model.MCPService) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			validateService(ctx, svc, timeout, result)
+		}(&report.Results[i], svc)
+	}
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	report.Canceled = ctx.Err() != nil
+	report.DurationMs = time.Since(start).Milliseconds()
+	return report
+}
+
+// validateService initializes a throwaway instance of svc within timeout and records the outcome in result
+func validateService(ctx context.Context, svc *model.MCPService, timeout time.Duration, result *ServiceValidationResult) {
+	start := time.Now()
+	defer func() { result.DurationMs = time.Since(start).Milliseconds() }()
+
+	serviceConfig := *svc // shallow copy to avoid mutating caller
+	serviceConfig.DefaultEnvsJSON = svc.ActiveDefaultEnvsJSON()
+
+	bgCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	validateCtx, validateCancel := context.WithTimeout(ctx, timeout)
+	defer validateCancel()
+
+	if err := ensureOAuthToken(validateCtx, &serviceConfig, false); err != nil {
+		result.Error = fmt.Sprintf("authorization failed: %v", err)
+		return
+	}
+
+	// The instance must not outlive the validation, so its runtime context is canceled with it as well
+	stop := context.AfterFunc(validateCtx, cancel)
+	defer stop()
+
+	cacheKey := fmt.Sprintf("validate-service-%d-%d", svc.ID, time.Now().UnixNano())
+	srv, cli, stdioCmd, tools, initResult, err := createActualMcpGoServerAndClientUncached(asThrowawayInstance(validateCtx), bgCtx, cacheKey, &serviceConfig, fmt.Sprintf("validate-%d", svc.ID), nil)
+	if err != nil {
+		if ctxErr := validateCtx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+			err = fmt.Errorf("%w: %v", ctxErr, err)
+		}
+		result.Error = err.Error()
+		return
+	}
+
+	result.Passed = true
+	result.Endpoint = serviceConfig.Command
+	result.ToolCount = len(tools)
+	if initResult != nil {
+		result.ServerName = initResult.ServerInfo.Name
+		result.ServerVersion = initResult.ServerInfo.Version
+	}
+
+	// No hookService: the post-stop hook is skipped like the pre-start one
+	instance := &SharedMcpInstance{
+		Server:      srv,
+		Client:      cli,
+		cancel:      cancel,
+		serviceID:   svc.ID,
+		serviceName: svc.Name,
+		serviceType: svc.Type,
+		cacheKey:    cacheKey,
+		stdioCmd:    stdioCmd,
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+	_ = instance.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateServicesLeavesNoSideEffects(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	assert.NoError(t, model.InitDB())
+	originalNewClient := newStdioMCPClient
+	newStdioMCPClient = func(cmd *exec.Cmd, noise *stdoutNoise, clientOpts []mcpclient.ClientOption) (mcpclient.MCPClient, error) {
+		return nil, errors.New("no stdio server in this test")
+	}
+	defer func() {
+		common.SQLitePath = originalPath
+		newStdioMCPClient = originalNewClient
+	}()
+
+	upstream := httptest.NewServer(mcpserver.NewStreamableHTTPServer(mcpserver.NewMCPServer("validated-upstream", "2.0.0")))
+	defer upstream.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	marker := filepath.Join(t.TempDir(), "hook-ran")
+	fallback := &model.MCPService{Name: "validate-fallback-svc", DisplayName: "Fallback", Type: model.ServiceTypeStreamableHTTP, Command: broken.URL, FallbackEndpointsJSON: `["` + upstream.URL + `"]`, InstalledVersion: "1.0.0", Enabled: true}
+	hooked := &model.MCPService{Name: "validate-hooked-svc", DisplayName: "Hooked", Type: model.ServiceTypeStdio, Command: "server", PreStartCommand: "touch " + marker, PostStopCommand: "touch " + marker, Enabled: true}
+	for _, svc := range []*model.MCPService{fallback, hooked} {
+		assert.NoError(t, model.CreateService(svc))
+	}
+	defer preferredEndpoints.Delete(fallback.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report := ValidateServices(ctx, []*model.MCPService{fallback, hooked}, 2, 10*time.Second)
+	if assert.Len(t, report.Results, 2) {
+		assert.True(t, report.Results[0].Passed, report.Results[0].Error)
+		assert.Equal(t, upstream.URL, report.Results[0].Endpoint)
+		assert.False(t, report.Results[1].Passed)
+	}
+
+	_, preferred := preferredEndpoints.Load(fallback.ID)
+	assert.False(t, preferred, "validation does not change the endpoint running instances start with")
+	saved, err := model.GetServiceByID(fallback.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1.0.0", saved.InstalledVersion, "validation does not persist the reported version")
+	}
+	_, statErr := os.Stat(marker)
+	assert.True(t, os.IsNotExist(statErr), "validation does not run the service hooks")
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 实时调用计数：每个服务维护按秒（最近一分钟）与按分钟（最近一小时）的环形桶。
+// 每个桶把时间片编号与计数打包进同一个 uint64，通过 CAS 原子更新，热路径上无锁。
+const (
+	liveSecondBuckets = 60
+	liveMinuteBuckets = 60
+	liveCountBits     = 32
+	liveCountMask     = 1<<liveCountBits - 1
+)
+
+// liveStatsNow 可在测试中替换以模拟时间流逝
+var liveStatsNow = time.Now
+
+type liveBucket struct {
+	state atomic.Uint64 // 高 32 位：时间片编号；低 32 位：计数
+}
+
+func (b *liveBucket) add(slot int64) {
+	tag := uint64(uint32(slot)) << liveCountBits
+	for {
+		cur := b.state.Load()
+		next := tag | 1
+		if cur&^liveCountMask == tag {
+			next = cur + 1
+		}
+		if b.state.CompareAndSwap(cur, next) {
+			return
+		}
+	}
+}
+
+// count 返回该桶在 slot 时间片内的计数；桶已被其他时间片复用时返回 0
+func (b *liveBucket) count(slot int64) int64 {
+	cur := b.state.Load()
+	if cur&^liveCountMask != uint64(uint32(slot))<<liveCountBits {
+		return 0
+	}
+	return int64(cur & liveCountMask)
+}
+
+type liveServiceCounter struct {
+	name    atomic.Value // string
+	total   atomic.Int64
+	seconds [liveSecondBuckets]liveBucket
+	minutes [liveMinuteBuckets]liveBucket
+}
+
+var liveCounters sync.Map // serviceID -> *liveServiceCounter
+
+// LiveServiceStats 是单个服务的实时调用速率
+type LiveServiceStats struct {
+	ServiceID     int64  `json:"service_id"`
+	ServiceName   string `json:"service_name"`
+	CallsLastMin  int64  `json:"calls_last_minute"`
+	CallsLastHour int64  `json:"calls_last_hour"`
+	TotalCalls    int64  `json:"total_calls"` // 进程启动以来
+}
+
+// RecordLiveCall 记录一次 tools/call，供容量规划的实时统计使用
+func RecordLiveCall(serviceID int64, serviceName string) {
+	value, ok := liveCounters.Load(serviceID)
+	if !ok {
+		value, _ = liveCounters.LoadOrStore(serviceID, &liveServiceCounter{})
+	}
+	counter := value.(*liveServiceCounter)
+	if serviceName != "" {
+		if current, _ := counter.name.Load().(string); current != serviceName {
+			counter.name.Store(serviceName)
+		}
+	}
+
+	now := liveStatsNow().Unix()
+	counter.total.Add(1)
+	counter.seconds[now%liveSecondBuckets].add(now)
+	minute := now / 60
+	counter.minutes[minute%liveMinuteBuckets].add(minute)
+}
+
+// GetLiveStats 返回所有有调用记录的服务在最近一分钟/一小时内的调用数（按服务 ID 排序）
+func GetLiveStats() []LiveServiceStats {
+	now := liveStatsNow().Unix()
+	minute := now / 60
+	stats := []LiveServiceStats{}
+	liveCounters.Range(func(key, value any) bool {
+		counter := value.(*liveServiceCounter)
+		item := LiveServiceStats{ServiceID: key.(int64), TotalCalls: counter.total.Load()}
+		item.ServiceName, _ = counter.name.Load().(string)
+		for slot := now - liveSecondBuckets + 1; slot <= now; slot++ {
+			item.CallsLastMin += counter.seconds[slot%liveSecondBuckets].count(slot)
+		}
+		for slot := minute - liveMinuteBuckets + 1; slot <= minute; slot++ {
+			item.CallsLastHour += counter.minutes[slot%liveMinuteBuckets].count(slot)
+		}
+		stats = append(stats, item)
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ServiceID < stats[j].ServiceID })
+	return stats
+}
+
+// ResetLiveStats 清空实时统计（用于测试）
+func ResetLiveStats() {
+	liveCounters.Range(func(key, _ any) bool {
+		liveCounters.Delete(key)
+		return true
+	})
+}
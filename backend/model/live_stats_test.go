@@ -0,0 +1,70 @@
+package model
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveStatsWindows(t *testing.T) {
+	originalNow := liveStatsNow
+	defer func() {
+		liveStatsNow = originalNow
+		ResetLiveStats()
+	}()
+	ResetLiveStats()
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := base
+	liveStatsNow = func() time.Time { return now }
+
+	// 并发记录不应丢失计数
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RecordLiveCall(1, "fetch")
+		}()
+	}
+	wg.Wait()
+	now = base.Add(30 * time.Second)
+	RecordLiveCall(1, "fetch")
+	RecordLiveCall(2, "search")
+
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		wantMin  []int64
+		wantHour []int64
+	}{
+		{"recent calls", 30 * time.Second, []int64{51, 1}, []int64{51, 1}},
+		{"first burst leaves minute window", 75 * time.Second, []int64{1, 1}, []int64{51, 1}},
+		{"all calls leave minute window", 2 * time.Minute, []int64{0, 0}, []int64{51, 1}},
+		{"all calls leave hour window", 61 * time.Minute, []int64{0, 0}, []int64{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = base.Add(tt.elapsed)
+			stats := GetLiveStats()
+			if assert.Len(t, stats, 2) {
+				assert.Equal(t, "fetch", stats[0].ServiceName)
+				assert.Equal(t, int64(51), stats[0].TotalCalls)
+				for i := range stats {
+					assert.Equal(t, tt.wantMin[i], stats[i].CallsLastMin, "service %d last minute", stats[i].ServiceID)
+					assert.Equal(t, tt.wantHour[i], stats[i].CallsLastHour, "service %d last hour", stats[i].ServiceID)
+				}
+			}
+		})
+	}
+
+	// 桶被新的时间片复用时从零开始计数
+	now = base.Add(2 * time.Hour)
+	RecordLiveCall(1, "fetch")
+	stats := GetLiveStats()
+	assert.Equal(t, int64(1), stats[0].CallsLastMin)
+	assert.Equal(t, int64(1), stats[0].CallsLastHour)
+	assert.Equal(t, int64(52), stats[0].TotalCalls)
+}
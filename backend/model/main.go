@@ -1,6 +1,8 @@
 package model
 
 import (
+	"fmt"
+
 	"one-mcp/backend/common"
 
 	"github.com/burugo/thing"
@@ -13,7 +15,16 @@ import (
 
 func init() {}
 
+// warnInsecureRootAccount 在使用默认 root 密码时输出警告，测试中可替换
+var warnInsecureRootAccount = func(msg string) {
+	common.SysError(msg)
+}
+
 func createRootAccountIfNeed() error {
+	if common.ExternalIdentityProvider {
+		// 账号由外部身份提供方管理，不创建本地 root 账号
+		return nil
+	}
 	// 检查是否有用户，无则创建 root 用户
 	userThing, err := thing.Use[*User]()
 	if err != nil {
@@ -24,22 +35,37 @@ func createRootAccountIfNeed() error {
 		return err
 	}
 	if len(users) == 0 {
-		common.SysLog("no user exists, create a root user for you: username is root, password is 123456")
+		username := common.RootUsername
+		if username == "" {
+			username = "root"
+		}
+		password := common.RootPassword
+		usingDefaultPassword := password == ""
+		if usingDefaultPassword {
+			password = common.DefaultRootPassword
+		}
 		rootUser := &User{
-			Username:    "root",
-			Password:    "123456", // 直接使用明文密码，让Insert方法来处理哈希
-			Role:        common.RoleRootUser,
-			Status:      common.UserStatusEnabled,
-			DisplayName: "Root User",
-			Email:       "root@localhost",
-			GitHubId:    "",
-			WeChatId:    "",
+			Username:           username,
+			Password:           password, // 直接使用明文密码，让Insert方法来处理哈希
+			Role:               common.RoleRootUser,
+			Status:             common.UserStatusEnabled,
+			DisplayName:        "Root User",
+			Email:              "root@localhost",
+			GitHubId:           "",
+			WeChatId:           "",
+			MustChangePassword: usingDefaultPassword,
 			// Token will be auto-generated by Insert method
 		}
 		err = rootUser.Insert()
 		if err != nil {
 			return err
 		}
+		if usingDefaultPassword {
+			warnInsecureRootAccount(fmt.Sprintf("no user exists, created a root user with the INSECURE DEFAULT password: username is %s, password is %s. "+
+				"Change the password after the first login, or set ROOT_USERNAME / ROOT_PASSWORD before the first startup", username, password))
+		} else {
+			common.SysLog(fmt.Sprintf("no user exists, created a root user with the configured credentials: username is %s", username))
+		}
 	}
 	return nil
 }
@@ -61,7 +87,7 @@ func InitDB() (err error) {
 
 	// 1. AutoMigrate all models first
 	thing.AllowDropColumn = true
-	err = thing.AutoMigrate(&User{}, &Option{}, &MCPService{}, &UserConfig{}, &ConfigService{}, &ProxyRequestStat{}, &MCPLog{}, &MCPServiceGroup{})
+	err = thing.AutoMigrate(&User{}, &Option{}, &MCPService{}, &UserConfig{}, &ConfigService{}, &ProxyRequestStat{}, &MCPLog{}, &MCPServiceGroup{}, &ToolFeedback{}, &ServiceOAuthToken{})
 	if err != nil {
 		return err
 	}
@@ -91,8 +117,23 @@ func InitDB() (err error) {
 	if err := MCPLogInit(); err != nil {
 		return err
 	}
+	if err := ToolFeedbackInit(); err != nil {
+		return err
+	}
+	if err := ServiceOAuthTokenInit(); err != nil {
+		return err
+	}
+	if err := ProxyRequestStatInit(); err != nil {
+		return err
+	}
 
 	// 3. Perform data-dependent operations like creating a root account
+	if err := MigrateServiceRuntimeArgs(); err != nil {
+		return err
+	}
+	if err := BackfillUserTokenIDs(); err != nil {
+		return err
+	}
 	return createRootAccountIfNeed()
 }
 
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRootAccountIfNeed(t *testing.T) {
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		external       bool
+		wantUsername   string
+		wantPassword   string
+		wantMustChange bool
+		wantWarning    bool
+	}{
+		{"custom credentials", "admin", "s3cret-pass", false, "admin", "s3cret-pass", false, false},
+		{"insecure default", "", "", false, "root", common.DefaultRootPassword, true, true},
+		{"external identity provider", "idp-admin", "s3cret-pass", true, "", "", false, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalSQLitePath := common.SQLitePath
+			originalUsername, originalPassword, originalExternal := common.RootUsername, common.RootPassword, common.ExternalIdentityProvider
+			originalWarn := warnInsecureRootAccount
+			defer func() {
+				common.SQLitePath = originalSQLitePath
+				common.RootUsername, common.RootPassword, common.ExternalIdentityProvider = originalUsername, originalPassword, originalExternal
+				warnInsecureRootAccount = originalWarn
+			}()
+			var warnings []string
+			warnInsecureRootAccount = func(msg string) { warnings = append(warnings, msg) }
+			common.RootUsername, common.RootPassword, common.ExternalIdentityProvider = tt.username, tt.password, tt.external
+			common.SQLitePath = filepath.Join(t.TempDir(), fmt.Sprintf("root_account_test_%d.db", i))
+
+			assert.NoError(t, InitDB())
+
+			assert.Equal(t, tt.wantWarning, len(warnings) == 1)
+			if tt.wantUsername == "" {
+				users, err := UserDB.Where("username = ?", tt.username).Fetch(0, 1)
+				assert.NoError(t, err)
+				assert.Empty(t, users)
+				return
+			}
+
+			login := &User{Username: tt.wantUsername, Password: tt.wantPassword}
+			assert.NoError(t, login.ValidateAndFill())
+			assert.Equal(t, tt.wantMustChange, login.MustChangePassword)
+			if !tt.wantMustChange {
+				return
+			}
+
+			// 修改密码后不再要求修改
+			login.Password = "a-new-password"
+			assert.NoError(t, login.Update(true))
+			reloaded, err := GetUserById(login.ID, false)
+			assert.NoError(t, err)
+			assert.False(t, reloaded.MustChangePassword)
+		})
+	}
+}
@@ -104,7 +104,14 @@ func GetMCPLogThing() (*thing.Thing[*MCPLog], error) {
 	return MCPLogDB, nil
 }
 
-// SaveMCPLog is a utility function to save MCP logs with message length limit and sanitization
+// createMCPLogRow writes a log row. Mockable in tests
+var createMCPLogRow = func(db *thing.Thing[*MCPLog], log *MCPLog) error {
+	return db.Save(log)
+}
+
+// SaveMCPLog is a utility function to save MCP logs with message length limit and sanitization.
+// A failed write is queued for retry in the background and nil is returned; the error is only returned
+// when the retry queue is full.
 func SaveMCPLog(ctx context.Context, serviceID int64, serviceName string, phase MCPLogPhase, level MCPLogLevel, message string) error {
 	// Limit message length to prevent database bloat
 	const maxMessageLength = 8192
@@ -123,7 +130,19 @@ func SaveMCPLog(ctx context.Context, serviceID int64, serviceName string, phase
 		Message:     message,
 	}
 
-	return CreateMCPLog(log)
+	// The retry stays bound to this database even if MCPLogDB is re-initialized meanwhile
+	db := MCPLogDB
+	row := *log
+	if err := createMCPLogRow(db, log); err != nil {
+		if enqueueFailedWrite("MCP log", func() error {
+			retry := row
+			return createMCPLogRow(db, &retry)
+		}) {
+			return nil
+		}
+		return err
+	}
+	return nil
 }
 
 // sanitizeMessage removes potentially sensitive information from log messages
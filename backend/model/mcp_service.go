@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"one-mcp/backend/common"
+
 	"github.com/burugo/thing"
 )
 
@@ -29,6 +32,17 @@ const (
 	ServiceTypeStreamableHTTP ServiceType = "streamable_http"
 )
 
+// RateLimitScope controls whether per-service request limits are counted per user or per access token
+const (
+	RateLimitScopeUser  = "user"
+	RateLimitScopeToken = "token"
+)
+
+// IsValidRateLimitScope reports whether scope is a known rate limit scope (empty means user)
+func IsValidRateLimitScope(scope string) bool {
+	return scope == "" || scope == RateLimitScopeUser || scope == RateLimitScopeToken
+}
+
 // ClientTemplateDetail contains template info for a specific client type
 type ClientTemplateDetail struct {
 	TemplateString         string `json:"template_string"`
@@ -38,11 +52,63 @@ type ClientTemplateDetail struct {
 
 // EnvVarDefinition defines a required environment variable
 type EnvVarDefinition struct {
-	Name         string `json:"name"`
-	Description  string `json:"description"`
-	IsSecret     bool   `json:"is_secret"`
-	Optional     bool   `json:"optional"`
-	DefaultValue string `json:"default_value"`
+	Name         string           `json:"name"`
+	Description  string           `json:"description"`
+	IsSecret     bool             `json:"is_secret"`
+	Optional     bool             `json:"optional"`
+	DefaultValue string           `json:"default_value"`
+	RequiredIf   *EnvVarCondition `json:"required_if,omitempty"` // 设置时仅在条件满足时必填，Optional 被忽略
+}
+
+// EnvVarCondition 表示"另一个环境变量等于某值"的条件，如 {"name":"MODE","value":"cloud"}
+type EnvVarCondition struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// IsRequired 根据已提供的环境变量值判断该变量是否必填
+func (d EnvVarDefinition) IsRequired(values map[string]string) bool {
+	if d.RequiredIf != nil {
+		return values[d.RequiredIf.Name] == d.RequiredIf.Value
+	}
+	return !d.Optional
+}
+
+// MissingRequiredEnvVars 返回在 values 中缺失（或为空）且没有默认值的必填变量名
+func MissingRequiredEnvVars(definitions []EnvVarDefinition, values map[string]string) []string {
+	var missing []string
+	for _, def := range definitions {
+		if def.Name == "" || !def.IsRequired(values) {
+			continue
+		}
+		if strings.TrimSpace(values[def.Name]) == "" && def.DefaultValue == "" {
+			missing = append(missing, def.Name)
+		}
+	}
+	return missing
+}
+
+// ValidateEnvVarDefinitions 检查定义均有名称，且 required_if 引用的是另一个已定义的变量
+func ValidateEnvVarDefinitions(definitions []EnvVarDefinition) error {
+	names := make(map[string]bool, len(definitions))
+	for _, def := range definitions {
+		if def.Name == "" {
+			return errors.New("missing name field in env var definition")
+		}
+		names[def.Name] = true
+	}
+	for _, def := range definitions {
+		if def.RequiredIf == nil {
+			continue
+		}
+		if def.RequiredIf.Name == "" || def.RequiredIf.Name == def.Name {
+			return fmt.Errorf("env var %s: required_if must reference another variable", def.Name)
+		}
+		if !names[def.RequiredIf.Name] {
+			return fmt.Errorf("env var %s: required_if references undefined variable %s", def.Name, def.RequiredIf.Name)
+		}
+	}
+	return nil
 }
 
 // MCPService represents an MCP service that can be enabled or configured
@@ -66,13 +132,192 @@ type MCPService struct {
 	PackageManager        string          `db:"package_manager"`         // For marketplace services: npm, pypi
 	SourcePackageName     string          `db:"source_package_name"`     // For marketplace services: package name in the repository
 	InstalledVersion      string          `db:"installed_version"`       // For marketplace services: currently installed version
-	InstallerUserID       int64           `db:"installer_user_id"`       // 记录安装者的用户ID
 	HealthStatus          string          `db:"-"`                       // 健康状态: unknown, healthy, unhealthy, starting, stopped
 	LastHealthCheck       time.Time       `db:"-"`                       // 最后健康检查时间
 	HealthDetails         string          `db:"-"`                       // 健康详情的JSON字符串
 	DefaultEnvsJSON       string          `json:"default_envs_json,omitempty" db:"default_envs_json,default:'{}'"`
-	HeadersJSON           string          `json:"headers_json,omitempty" db:"headers_json,default:'{}'"` // JSON string for custom request headers map[string]string
-	RPDLimit              int             `json:"rpd_limit,omitempty" db:"rpd_limit,default:0"`          // 每日请求次数限制(0表示不限制)
+	HeadersJSON           string          `json:"headers_json,omitempty" db:"headers_json,default:'{}'"`                     // JSON string for custom request headers map[string]string
+	RPDLimit              int             `json:"rpd_limit,omitempty" db:"rpd_limit,default:0"`                              // 每日请求次数限制(0表示不限制)
+	InstalledByUserID     int64           `json:"installed_by_user_id" db:"installer_user_id"`                               // 安装者的用户ID，批量导入等系统创建时为 0
+	InstalledAt           time.Time       `json:"installed_at" db:"installed_at"`                                            // 安装(创建)时间，由 CreateService 设置
+	DeepHealthCheck       bool            `json:"deep_health_check" db:"deep_health_check"`                                  // 健康检查时除 Ping 外额外调用 ListTools
+	DisableSelfHealing    bool            `json:"disable_self_healing" db:"disable_self_healing"`                            // 健康检查失败时不自动重建实例或重启服务，仅报告 unhealthy，需手动重启（默认自动恢复）
+	HealthCheckURL        string          `json:"health_check_url,omitempty" db:"health_check_url,default:''"`               // SSE/HTTP 服务的健康检查地址，配置后健康检查以 GET 返回 2xx 代替 MCP Ping(无法连接时回退到 Ping)
+	ResponseHeadersJSON   string          `json:"response_headers_json,omitempty" db:"response_headers_json,default:''"`     // 代理端点响应中附加的静态响应头 JSON map[string]string(如 CORS、缓存指令)
+	ConfigFile            string          `json:"config_file,omitempty" db:"config_file,default:''"`                         // 由服务配置目录中的文件管理时为文件名，API 只读
+	WorkingDir            string          `json:"working_dir,omitempty" db:"working_dir,default:''"`                         // stdio 子进程的工作目录(为空时继承 one-mcp 的工作目录)
+	RedactionRulesJSON    string          `json:"redaction_rules_json,omitempty" db:"redaction_rules_json,default:''"`       // 日志脱敏规则 {"keys":[],"patterns":[]}，为空时仅使用默认规则
+	CoerceArguments       bool            `json:"coerce_arguments" db:"coerce_arguments"`                                    // 按工具 schema 将字符串参数转换为 number/integer/boolean（默认关闭）
+	ConfirmDestructive    bool            `json:"confirm_destructive" db:"confirm_destructive"`                              // execute_tool 调用标注为 destructive 的工具时要求 confirm: true（默认关闭）
+	TagsJSON              string          `json:"tags_json,omitempty" db:"tags_json,default:''"`                             // 自由标签 JSON 数组，用于分组与筛选，如 ["search","internal"]
+	HealthGracePeriod     int             `json:"health_grace_period,omitempty" db:"health_grace_period,default:0"`          // 启动后的健康检查宽限期(秒)，期间检查失败报告为 starting 且不计入失败次数
+	RateLimitScope        string          `json:"rate_limit_scope,omitempty" db:"rate_limit_scope,default:''"`               // 每日限额计数维度: user(默认) 或 token
+	PackageIntegrity      string          `json:"package_integrity,omitempty" db:"package_integrity,default:''"`             // 安装时校验通过的 npm 包完整性值(SRI)，未开启校验时为空
+	RuntimeArgsJSON       string          `json:"runtime_args_json,omitempty" db:"runtime_args_json,default:''"`             // stdio 运行时参数 JSON 数组，启动时追加在 ArgsJSON（包引用部分）之后
+	ProbeCommand          string          `json:"probe_command,omitempty" db:"probe_command,default:''"`                     // stdio 轻量健康探测命令(如 "npx -y pkg --version")，配置后健康检查以其退出码代替 MCP Ping
+	PreStartCommand       string          `json:"pre_start_command,omitempty" db:"pre_start_command,default:''"`             // stdio 实例启动前执行的命令(不经过 shell)，失败则中止启动
+	PostStopCommand       string          `json:"post_stop_command,omitempty" db:"post_stop_command,default:''"`             // stdio 实例停止后执行的清理命令(不经过 shell)，失败仅记录日志
+	UVXPythonVersion      string          `json:"uvx_python_version,omitempty" db:"uvx_python_version,default:''"`           // uvx 服务的 --python 版本(如 3.12)，为空时使用全局 UVXPythonVersion
+	UVXIndexURL           string          `json:"uvx_index_url,omitempty" db:"uvx_index_url,default:''"`                     // uvx 服务的 --index-url，为空时使用全局 UVXIndexURL
+	Deprecated            bool            `json:"deprecated" db:"deprecated"`                                                // 已弃用：仍可正常代理，但响应、列表和导出中带弃用提示
+	DeprecationMessage    string          `json:"deprecation_message,omitempty" db:"deprecation_message,default:''"`         // 弃用说明
+	ReplacedBy            string          `json:"replaced_by,omitempty" db:"replaced_by,default:''"`                         // 建议替代的服务名(可选)
+	MaintenanceWindow     string          `json:"maintenance_window,omitempty" db:"maintenance_window,default:''"`           // 维护窗口 "开始/结束"(RFC3339)，期间健康状态保持窗口开始前的值并标记为维护中
+	FallbackEndpointsJSON string          `json:"fallback_endpoints_json,omitempty" db:"fallback_endpoints_json,default:''"` // 备用端点 JSON 数组，主端点初始化失败或不健康时依次尝试: SSE/HTTP 为 upstream 地址，stdio 为命令
+	OAuthConfigJSON       string          `json:"oauth_config_json,omitempty" db:"oauth_config_json,default:''"`             // OAuth 配置 {"grant_type","token_url",...}，access token 在创建实例时注入 Authorization 请求头
+}
+
+// IsFileManaged reports whether the service is declared in the services config directory
+func (s *MCPService) IsFileManaged() bool {
+	return s.ConfigFile != ""
+}
+
+// DeprecationNotice returns a human-readable deprecation warning, or "" when the service is not deprecated
+func (s *MCPService) DeprecationNotice() string {
+	if !s.Deprecated {
+		return ""
+	}
+	notice := fmt.Sprintf("Service %s is deprecated", s.Name)
+	if msg := strings.TrimSpace(s.DeprecationMessage); msg != "" {
+		notice += ": " + strings.TrimSuffix(msg, ".")
+	}
+	if s.ReplacedBy != "" {
+		notice += fmt.Sprintf(". Use %s instead", s.ReplacedBy)
+	}
+	return notice + "."
+}
+
+// DefinesEnvVar reports whether the service declares the env var: as a required variable,
+// in its default envs, or as a per-user config option.
+func (s *MCPService) DefinesEnvVar(name string) bool {
+	if definitions, err := s.GetRequiredEnvVars(); err == nil {
+		for _, definition := range definitions {
+			if definition.Name == name {
+				return true
+			}
+		}
+	}
+	if profiles, ok := environmentProfiles(s.DefaultEnvsJSON); ok {
+		for _, envs := range profiles {
+			if _, ok := envs[name]; ok {
+				return true
+			}
+		}
+	} else if s.DefaultEnvsJSON != "" && s.DefaultEnvsJSON != "{}" {
+		var defaultEnvs map[string]string
+		if err := json.Unmarshal([]byte(s.DefaultEnvsJSON), &defaultEnvs); err == nil {
+			if _, ok := defaultEnvs[name]; ok {
+				return true
+			}
+		}
+	}
+	_, err := GetConfigOptionByKey(s.ID, name)
+	return err == nil
+}
+
+// environmentProfiles parses envs JSON written as environment profiles ({"default": {...}, "prod": {...}}).
+// ok is false for a flat env map, or when any value is not an object of strings.
+func environmentProfiles(envsJSON string) (profiles map[string]map[string]string, ok bool) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(envsJSON), &raw); err != nil || len(raw) == 0 {
+		return nil, false
+	}
+	for _, value := range raw {
+		if trimmed := strings.TrimSpace(string(value)); !strings.HasPrefix(trimmed, "{") {
+			return nil, false
+		}
+	}
+	if err := json.Unmarshal([]byte(envsJSON), &profiles); err != nil {
+		return nil, false
+	}
+	return profiles, true
+}
+
+// ResolveEnvironmentEnvsJSON returns envsJSON as a flat env map for the given environment: for profiles the
+// envs of the "default" profile overridden by those of the environment's profile. Flat env maps are returned as is.
+func ResolveEnvironmentEnvsJSON(envsJSON, environment string) string {
+	profiles, ok := environmentProfiles(envsJSON)
+	if !ok {
+		return envsJSON
+	}
+	envs := make(map[string]string)
+	for key, value := range profiles[common.DefaultActiveEnvironment] {
+		envs[key] = value
+	}
+	for key, value := range profiles[environment] {
+		envs[key] = value
+	}
+	resolved, err := json.Marshal(envs)
+	if err != nil {
+		return "{}"
+	}
+	return string(resolved)
+}
+
+// HasEnvironmentProfiles reports whether DefaultEnvsJSON is written as environment profiles
+func (s *MCPService) HasEnvironmentProfiles() bool {
+	_, ok := environmentProfiles(s.DefaultEnvsJSON)
+	return ok
+}
+
+// ActiveDefaultEnvsJSON returns the default envs of the service for the active environment as a flat env map
+func (s *MCPService) ActiveDefaultEnvsJSON() string {
+	return ResolveEnvironmentEnvsJSON(s.DefaultEnvsJSON, common.GetActiveEnvironment())
+}
+
+// ActiveDefaultEnvs returns the default envs of the service for the active environment; invalid JSON yields none
+func (s *MCPService) ActiveDefaultEnvs() map[string]string {
+	envs := make(map[string]string)
+	if active := s.ActiveDefaultEnvsJSON(); active != "" {
+		_ = json.Unmarshal([]byte(active), &envs)
+	}
+	return envs
+}
+
+// SetDefaultEnv sets one default env var of the service. With environment profiles it is written to the profile of
+// the active environment, where it takes effect, and the other profiles are kept. Invalid DefaultEnvsJSON is an
+// error rather than being overwritten.
+func (s *MCPService) SetDefaultEnv(name, value string) error {
+	if profiles, ok := environmentProfiles(s.DefaultEnvsJSON); ok {
+		environment := common.GetActiveEnvironment()
+		if profiles[environment] == nil {
+			profiles[environment] = make(map[string]string)
+		}
+		profiles[environment][name] = value
+		data, err := json.Marshal(profiles)
+		if err != nil {
+			return err
+		}
+		s.DefaultEnvsJSON = string(data)
+		return nil
+	}
+	envs := make(map[string]string)
+	if strings.TrimSpace(s.DefaultEnvsJSON) != "" {
+		if err := json.Unmarshal([]byte(s.DefaultEnvsJSON), &envs); err != nil {
+			return fmt.Errorf("invalid default_envs_json: %w", err)
+		}
+	}
+	envs[name] = value
+	data, err := json.Marshal(envs)
+	if err != nil {
+		return err
+	}
+	s.DefaultEnvsJSON = string(data)
+	return nil
+}
+
+// LogRedactor returns the redactor applied to tool names, errors and command args before they are written to logs
+func (s *MCPService) LogRedactor() *common.Redactor {
+	return common.GetRedactor(s.RedactionRulesJSON)
+}
+
+// LimitTokenID returns tokenID (a User.LimitCredentialID) when the service counts limits per access token, otherwise ""
+// (count per user)
+func (s *MCPService) LimitTokenID(tokenID string) string {
+	if s.RateLimitScope == RateLimitScopeToken {
+		return tokenID
+	}
+	return ""
 }
 
 // TableName sets the table name for the MCPService model
@@ -148,6 +393,85 @@ func (s *MCPService) GetRequiredEnvVars() ([]EnvVarDefinition, error) {
 	return envVars, nil
 }
 
+// NormalizeServiceTags trims, lowercases and de-duplicates tags, dropping empty ones
+func NormalizeServiceTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// SetTags sets the TagsJSON field from a slice of tags (normalized)
+func (s *MCPService) SetTags(tags []string) error {
+	tags = NormalizeServiceTags(tags)
+	if len(tags) == 0 {
+		s.TagsJSON = ""
+		return nil
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	s.TagsJSON = string(data)
+	return nil
+}
+
+// GetTags returns the TagsJSON as a slice of tags
+func (s *MCPService) GetTags() ([]string, error) {
+	if strings.TrimSpace(s.TagsJSON) == "" {
+		return []string{}, nil
+	}
+	var tags []string
+	if err := json.Unmarshal([]byte(s.TagsJSON), &tags); err != nil {
+		return nil, err
+	}
+	return NormalizeServiceTags(tags), nil
+}
+
+// HasTags reports whether the service carries all (matchAll) or any of the given normalized tags
+func (s *MCPService) HasTags(tags []string, matchAll bool) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	own, err := s.GetTags()
+	if err != nil {
+		return false
+	}
+	ownSet := make(map[string]bool, len(own))
+	for _, tag := range own {
+		ownSet[tag] = true
+	}
+	for _, tag := range tags {
+		if ownSet[tag] != matchAll {
+			// matchAll 时缺少任一标签即失败；matchAny 时命中任一标签即成功
+			return !matchAll
+		}
+	}
+	return matchAll
+}
+
+// FilterServicesByTags returns the services carrying all (matchAll) or any of the given tags
+func FilterServicesByTags(services []*MCPService, tags []string, matchAll bool) []*MCPService {
+	tags = NormalizeServiceTags(tags)
+	if len(tags) == 0 {
+		return services
+	}
+	filtered := make([]*MCPService, 0, len(services))
+	for _, svc := range services {
+		if svc.HasTags(tags, matchAll) {
+			filtered = append(filtered, svc)
+		}
+	}
+	return filtered
+}
+
 var MCPServiceDB *thing.Thing[*MCPService]
 
 // MCPServiceInit initializes the MCPServiceDB
@@ -182,6 +506,11 @@ func GetServiceByID(id int64) (*MCPService, error) {
 	return MCPServiceDB.ByID(id)
 }
 
+// GetFileManagedServices returns all services declared in the services config directory
+func GetFileManagedServices() ([]*MCPService, error) {
+	return MCPServiceDB.Where("config_file <> ''").All()
+}
+
 // GetServiceByName retrieves a specific service by name
 func GetServiceByName(name string) (*MCPService, error) {
 	return MCPServiceDB.Where("name = ?", name).First()
@@ -189,6 +518,9 @@ func GetServiceByName(name string) (*MCPService, error) {
 
 // CreateService creates a new MCP service
 func CreateService(service *MCPService) error {
+	if service.InstalledAt.IsZero() {
+		service.InstalledAt = time.Now()
+	}
 	return MCPServiceDB.Save(service)
 }
 
@@ -203,7 +535,10 @@ func DeleteService(id int64) error {
 	if err != nil {
 		return err
 	}
-	return MCPServiceDB.Delete(service)
+	if err := MCPServiceDB.Delete(service); err != nil {
+		return err
+	}
+	return DeleteServiceOAuthToken(id)
 }
 
 // ToggleServiceEnabled toggles the enabled status of a service
@@ -243,9 +578,10 @@ func GetServicesWithConfig() ([]map[string]interface{}, error) {
 	return result, nil
 }
 
-// GetServicesByPackageDetails retrieves services by package details
+// GetServicesByPackageDetails retrieves services by package details, oldest first.
+// A package may back several services when it was installed again with force_new.
 func GetServicesByPackageDetails(packageManager, packageName string) ([]*MCPService, error) {
-	return MCPServiceDB.Where("package_manager = ? AND source_package_name = ?", packageManager, packageName).All()
+	return MCPServiceDB.Where("package_manager = ? AND source_package_name = ?", packageManager, packageName).Order("id ASC").All()
 }
 
 // StdioConfig holds the configuration for an Stdio MCP service
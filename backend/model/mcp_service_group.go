@@ -3,6 +3,9 @@ package model
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+
+	"one-mcp/backend/common"
 
 	"github.com/burugo/thing"
 )
@@ -10,12 +13,59 @@ import (
 type MCPServiceGroup struct {
 	thing.BaseModel
 
-	UserID         int64  `db:"user_id,index:idx_group_owner" json:"user_id"`
-	Name           string `db:"name,index:idx_group_owner" json:"name"`
-	DisplayName    string `db:"display_name" json:"display_name"`
-	Description    string `db:"description" json:"description"`
-	ServiceIDsJSON string `db:"service_ids_json" json:"service_ids_json"`
-	Enabled        bool   `db:"enabled" json:"enabled"`
+	UserID           int64  `db:"user_id,index:idx_group_owner" json:"user_id"`
+	Name             string `db:"name,index:idx_group_owner" json:"name"`
+	DisplayName      string `db:"display_name" json:"display_name"`
+	Description      string `db:"description" json:"description"`
+	Instructions     string `db:"instructions" json:"instructions"`             // initialize 返回的 instructions，为空时使用默认说明
+	ServiceHintsJSON string `db:"service_hints_json" json:"service_hints_json"` // 按服务名的使用提示 (JSON 对象)，追加到 instructions
+	ServiceIDsJSON   string `db:"service_ids_json" json:"service_ids_json"`
+	Mode             string `db:"mode" json:"mode"` // facade (默认) 或 flat
+	Enabled          bool   `db:"enabled" json:"enabled"`
+	ACLJSON          string `db:"acl_json" json:"acl_json"`                   // 共享给其他成员的访问控制列表 (GroupACLEntry 的 JSON 数组)，为空时仅所有者可访问
+	ToolDescMaxLen   int    `db:"tool_desc_max_len" json:"tool_desc_max_len"` // search_tools 输出中工具描述的最大长度，0 表示使用全局 ToolDescriptionMaxLength
+}
+
+// Group access permissions granted to members of a shared group
+const (
+	// GroupPermissionRead allows exporting the group (skill zip, OpenAPI document)
+	GroupPermissionRead = "read"
+	// GroupPermissionExecute allows using the group MCP endpoint and calling its tools; it implies read
+	GroupPermissionExecute = "execute"
+)
+
+// GroupACLEntry grants a permission on a group to one user, or to every user whose role is at least Role
+type GroupACLEntry struct {
+	UserID     int64  `json:"user_id,omitempty"`
+	Role       int    `json:"role,omitempty"`
+	Permission string `json:"permission"`
+}
+
+// Group MCP modes
+const (
+	// GroupModeFacade exposes search_tools/execute_tool meta tools (default)
+	GroupModeFacade = "facade"
+	// GroupModeFlat exposes all member tools directly, namespaced by service name
+	GroupModeFlat = "flat"
+)
+
+// IsValidGroupMode reports whether mode is a known group mode (empty means facade)
+func IsValidGroupMode(mode string) bool {
+	return mode == "" || mode == GroupModeFacade || mode == GroupModeFlat
+}
+
+// IsFlat reports whether the group exposes member tools directly
+func (g *MCPServiceGroup) IsFlat() bool {
+	return g.Mode == GroupModeFlat
+}
+
+// ToolDescriptionMaxLength returns the effective maximum tool description length of the group's tool listings;
+// 0 means descriptions are not trimmed
+func (g *MCPServiceGroup) ToolDescriptionMaxLength() int {
+	if g.ToolDescMaxLen > 0 {
+		return g.ToolDescMaxLen
+	}
+	return common.GetToolDescriptionMaxLength()
 }
 
 var MCPServiceGroupDB *thing.Thing[*MCPServiceGroup]
@@ -44,6 +94,92 @@ func (g *MCPServiceGroup) SetServiceIDs(ids []int64) {
 	g.ServiceIDsJSON = string(bytes)
 }
 
+// GetServiceHints returns the per-service usage hints keyed by service name.
+func (g *MCPServiceGroup) GetServiceHints() map[string]string {
+	hints := map[string]string{}
+	if g.ServiceHintsJSON == "" {
+		return hints
+	}
+	_ = json.Unmarshal([]byte(g.ServiceHintsJSON), &hints)
+	return hints
+}
+
+// ParseGroupACL parses and validates an ACL JSON array; an empty string means no members
+func ParseGroupACL(raw string) ([]GroupACLEntry, error) {
+	var entries []GroupACLEntry
+	if raw == "" {
+		return entries, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if (entry.UserID > 0) == (entry.Role > 0) {
+			return nil, fmt.Errorf("acl entry %d must set exactly one of user_id and role", i)
+		}
+		if entry.Permission != GroupPermissionRead && entry.Permission != GroupPermissionExecute {
+			return nil, fmt.Errorf("acl entry %d has unknown permission %q", i, entry.Permission)
+		}
+	}
+	return entries, nil
+}
+
+// GetACL returns the group's ACL entries; invalid JSON grants nothing
+func (g *MCPServiceGroup) GetACL() []GroupACLEntry {
+	entries, err := ParseGroupACL(g.ACLJSON)
+	if err != nil {
+		return nil
+	}
+	return entries
+}
+
+// Allows reports whether the user may use the group with the given permission.
+// The owner has every permission; members need a matching ACL entry.
+func (g *MCPServiceGroup) Allows(userID int64, role int, permission string) bool {
+	if userID != 0 && g.UserID == userID {
+		return true
+	}
+	for _, entry := range g.GetACL() {
+		if entry.Permission != permission && entry.Permission != GroupPermissionExecute {
+			continue
+		}
+		if (entry.UserID > 0 && entry.UserID == userID) || (entry.Role > 0 && role >= entry.Role) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAccessibleMCPServiceGroupByName returns the user's own group with this name or, failing that, the oldest
+// group of another owner with this name that grants the user the permission.
+func GetAccessibleMCPServiceGroupByName(name string, userID int64, role int, permission string) (*MCPServiceGroup, error) {
+	if group, err := GetMCPServiceGroupByName(name, userID); err == nil {
+		return group, nil
+	}
+	shared, err := MCPServiceGroupDB.Where("name = ? AND acl_json != ''", name).Order("id ASC").Fetch(0, 1000)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range shared {
+		if group.Allows(userID, role, permission) {
+			return group, nil
+		}
+	}
+	return nil, errors.New("group_not_found")
+}
+
+// GetAccessibleMCPServiceGroupByID returns the group if the user owns it or is granted the permission
+func GetAccessibleMCPServiceGroupByID(id int64, userID int64, role int, permission string) (*MCPServiceGroup, error) {
+	group, err := MCPServiceGroupDB.ByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !group.Allows(userID, role, permission) {
+		return nil, errors.New("unauthorized")
+	}
+	return group, nil
+}
+
 func GetMCPServiceGroupsByUserID(userID int64) ([]*MCPServiceGroup, error) {
 	return MCPServiceGroupDB.Where("user_id = ?", userID).Order("id DESC").Fetch(0, 1000)
 }
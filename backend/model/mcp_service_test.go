@@ -0,0 +1,57 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingRequiredEnvVarsConditional(t *testing.T) {
+	definitions := []EnvVarDefinition{
+		{Name: "MODE", Optional: true},
+		{Name: "API_KEY", RequiredIf: &EnvVarCondition{Name: "MODE", Value: "cloud"}},
+		{Name: "REGION"},
+		{Name: "LOG_LEVEL", Optional: true},
+		{Name: "TIMEOUT", DefaultValue: "30"},
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   []string
+	}{
+		{"conditional var optional when condition unmet", map[string]string{"MODE": "local", "REGION": "eu"}, nil},
+		{"conditional var optional when referenced var absent", map[string]string{"REGION": "eu"}, nil},
+		{"conditional var required when condition met", map[string]string{"MODE": "cloud", "REGION": "eu"}, []string{"API_KEY"}},
+		{"conditional var provided", map[string]string{"MODE": "cloud", "API_KEY": "k", "REGION": "eu"}, nil},
+		{"unconditional required still enforced", map[string]string{"MODE": "local", "REGION": " "}, []string{"REGION"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MissingRequiredEnvVars(definitions, tt.values))
+		})
+	}
+}
+
+func TestValidateEnvVarDefinitions(t *testing.T) {
+	tests := []struct {
+		name        string
+		definitions []EnvVarDefinition
+		wantErr     bool
+	}{
+		{"valid condition", []EnvVarDefinition{{Name: "MODE"}, {Name: "API_KEY", RequiredIf: &EnvVarCondition{Name: "MODE", Value: "cloud"}}}, false},
+		{"missing name", []EnvVarDefinition{{Name: ""}}, true},
+		{"self reference", []EnvVarDefinition{{Name: "API_KEY", RequiredIf: &EnvVarCondition{Name: "API_KEY", Value: "x"}}}, true},
+		{"undefined reference", []EnvVarDefinition{{Name: "API_KEY", RequiredIf: &EnvVarCondition{Name: "MODE", Value: "cloud"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEnvVarDefinitions(tt.definitions)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
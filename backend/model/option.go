@@ -70,6 +70,156 @@ func InitOptionMap() error {
 	if mcpTimeout := os.Getenv("MCP_TOOL_CALL_TIMEOUT"); mcpTimeout != "" {
 		common.OptionMap[common.OptionMcpToolCallTimeout] = mcpTimeout
 	}
+	if warmupTimeout := os.Getenv("MCP_WARMUP_PING_TIMEOUT"); warmupTimeout != "" {
+		common.OptionMap[common.OptionMcpWarmupPingTimeout] = warmupTimeout
+	}
+	if initializeTimeout := os.Getenv("MCP_INITIALIZE_TIMEOUT"); initializeTimeout != "" {
+		common.OptionMap[common.OptionMcpInitializeTimeout] = initializeTimeout
+	}
+	if maxTools := os.Getenv("MAX_INSTANCE_TOOLS"); maxTools != "" {
+		common.OptionMap[common.OptionMaxInstanceTools] = maxTools
+	}
+	if maxPrompts := os.Getenv("MAX_INSTANCE_PROMPTS"); maxPrompts != "" {
+		common.OptionMap[common.OptionMaxInstancePrompts] = maxPrompts
+	}
+	if maxResources := os.Getenv("MAX_INSTANCE_RESOURCES"); maxResources != "" {
+		common.OptionMap[common.OptionMaxInstanceResources] = maxResources
+	}
+	if maxIdle := os.Getenv("REGISTRY_MAX_IDLE_CONNS"); maxIdle != "" {
+		common.OptionMap[common.OptionRegistryMaxIdleConns] = maxIdle
+	}
+	if maxIdlePerHost := os.Getenv("REGISTRY_MAX_IDLE_CONNS_PER_HOST"); maxIdlePerHost != "" {
+		common.OptionMap[common.OptionRegistryMaxIdleConnsPerHost] = maxIdlePerHost
+	}
+	if maxPerHost := os.Getenv("REGISTRY_MAX_CONNS_PER_HOST"); maxPerHost != "" {
+		common.OptionMap[common.OptionRegistryMaxConnsPerHost] = maxPerHost
+	}
+	if pythonVersion := os.Getenv("UVX_PYTHON_VERSION"); pythonVersion != "" {
+		common.OptionMap[common.OptionUVXPythonVersion] = pythonVersion
+	}
+	if indexURL := os.Getenv("UVX_INDEX_URL"); indexURL != "" {
+		common.OptionMap[common.OptionUVXIndexURL] = indexURL
+	}
+	if installTimeout := os.Getenv("MCP_INSTALL_TIMEOUT"); installTimeout != "" {
+		common.OptionMap[common.OptionMcpInstallTimeout] = installTimeout
+	}
+	if accessLogFormat := os.Getenv("PROXY_ACCESS_LOG_FORMAT"); accessLogFormat != "" {
+		common.OptionMap[common.OptionProxyAccessLogFormat] = accessLogFormat
+	}
+	if retryAfter := os.Getenv("INSTALLING_RETRY_AFTER"); retryAfter != "" {
+		common.OptionMap[common.OptionInstallingRetryAfter] = retryAfter
+	}
+	if fetchConcurrency := os.Getenv("GROUP_TOOLS_FETCH_CONCURRENCY"); fetchConcurrency != "" {
+		common.OptionMap[common.OptionGroupToolsFetchConcurrency] = fetchConcurrency
+	}
+	if fetchTimeout := os.Getenv("GROUP_TOOLS_FETCH_TIMEOUT"); fetchTimeout != "" {
+		common.OptionMap[common.OptionGroupToolsFetchTimeout] = fetchTimeout
+	}
+	if maxCalls := os.Getenv("TOOL_CALL_MAX_CONCURRENCY"); maxCalls != "" {
+		common.OptionMap[common.OptionToolCallMaxConcurrency] = maxCalls
+	}
+	if queueDepth := os.Getenv("TOOL_CALL_QUEUE_DEPTH"); queueDepth != "" {
+		common.OptionMap[common.OptionToolCallQueueDepth] = queueDepth
+	}
+	if queueTimeout := os.Getenv("TOOL_CALL_QUEUE_TIMEOUT"); queueTimeout != "" {
+		common.OptionMap[common.OptionToolCallQueueTimeout] = queueTimeout
+	}
+	if healthChecks := os.Getenv("HEALTH_CHECK_MAX_CONCURRENCY"); healthChecks != "" {
+		common.OptionMap[common.OptionHealthCheckMaxConcurrency] = healthChecks
+	}
+	if threshold := os.Getenv("UPSTREAM_ERROR_RESTART_THRESHOLD"); threshold != "" {
+		common.OptionMap[common.OptionUpstreamErrorRestartThreshold] = threshold
+	}
+	if minCalls := os.Getenv("UPSTREAM_ERROR_RESTART_MIN_CALLS"); minCalls != "" {
+		common.OptionMap[common.OptionUpstreamErrorRestartMinCalls] = minCalls
+	}
+	if window := os.Getenv("UPSTREAM_ERROR_RESTART_WINDOW"); window != "" {
+		common.OptionMap[common.OptionUpstreamErrorRestartWindow] = window
+	}
+	if cooldown := os.Getenv("UPSTREAM_ERROR_RESTART_COOLDOWN"); cooldown != "" {
+		common.OptionMap[common.OptionUpstreamErrorRestartCooldown] = cooldown
+	}
+	if descMaxLen := os.Getenv("TOOL_DESCRIPTION_MAX_LENGTH"); descMaxLen != "" {
+		common.OptionMap[common.OptionToolDescriptionMaxLength] = descMaxLen
+	}
+	if installCap := os.Getenv("MAX_CONCURRENT_INSTALLS_PER_USER"); installCap != "" {
+		common.OptionMap[common.OptionMaxConcurrentInstallsPerUser] = installCap
+	}
+	if autoToken := os.Getenv("AUTO_GENERATE_USER_TOKEN"); autoToken != "" {
+		common.OptionMap[common.OptionAutoGenerateUserToken] = autoToken
+	}
+	if sourcePriority := os.Getenv("MARKET_SOURCE_PRIORITY"); sourcePriority != "" {
+		common.OptionMap[common.OptionMarketSourcePriority] = sourcePriority
+	}
+	if categoryAllowlist := os.Getenv("INSTALL_CATEGORY_ALLOWLIST"); categoryAllowlist != "" {
+		common.OptionMap[common.OptionInstallCategoryAllowlist] = categoryAllowlist
+	}
+	if hookAllowlist := os.Getenv("HOOK_COMMAND_ALLOWLIST"); hookAllowlist != "" {
+		common.OptionMap[common.OptionHookCommandAllowlist] = hookAllowlist
+	}
+	if reuseGlobal := os.Getenv("REUSE_GLOBAL_USER_INSTANCES"); reuseGlobal != "" {
+		common.OptionMap[common.OptionReuseGlobalUserInstances] = reuseGlobal
+	}
+	if maxUserInstances := os.Getenv("MAX_USER_INSTANCES_PER_SERVICE"); maxUserInstances != "" {
+		common.OptionMap[common.OptionMaxUserInstancesPerService] = maxUserInstances
+	}
+	if cleanupOnDelete := os.Getenv("CLEANUP_USER_INSTANCES_ON_DELETE"); cleanupOnDelete != "" {
+		common.OptionMap[common.OptionCleanupUserInstancesOnDelete] = cleanupOnDelete
+	}
+	if rejectUnknown := os.Getenv("REJECT_UNKNOWN_TOOLS"); rejectUnknown != "" {
+		common.OptionMap[common.OptionRejectUnknownTools] = rejectUnknown
+	}
+	if granularity := os.Getenv("ACCESS_TIME_GRANULARITY"); granularity != "" {
+		common.OptionMap[common.OptionAccessTimeGranularity] = granularity
+	}
+	if maintenance := os.Getenv("MAINTENANCE_WINDOW"); maintenance != "" {
+		common.OptionMap[common.OptionMaintenanceWindow] = maintenance
+	}
+	if collisions := os.Getenv("GROUP_TOOL_NAME_COLLISIONS"); collisions != "" {
+		common.OptionMap[common.OptionGroupToolNameCollisions] = collisions
+	}
+	if strictness := os.Getenv("EXECUTE_ARGS_STRICTNESS"); strictness != "" {
+		common.OptionMap[common.OptionExecuteArgsStrictness] = strictness
+	}
+	if environment := os.Getenv("ACTIVE_ENVIRONMENT"); environment != "" {
+		common.OptionMap[common.OptionActiveEnvironment] = environment
+	}
+	if installerOnly := os.Getenv("UNINSTALL_INSTALLER_ONLY"); installerOnly != "" {
+		common.OptionMap[common.OptionUninstallInstallerOnly] = installerOnly
+	}
+	if retryQueue := os.Getenv("WRITE_RETRY_QUEUE_SIZE"); retryQueue != "" {
+		common.OptionMap[common.OptionWriteRetryQueueSize] = retryQueue
+	}
+	if retryAttempts := os.Getenv("WRITE_RETRY_MAX_ATTEMPTS"); retryAttempts != "" {
+		common.OptionMap[common.OptionWriteRetryMaxAttempts] = retryAttempts
+	}
+	if protocolVersion := os.Getenv("MCP_PROTOCOL_VERSION"); protocolVersion != "" {
+		common.OptionMap[common.OptionMCPProtocolVersion] = protocolVersion
+	}
+	if verifyIntegrity := os.Getenv("NPM_VERIFY_INTEGRITY"); verifyIntegrity != "" {
+		common.OptionMap[common.OptionNpmVerifyIntegrity] = verifyIntegrity
+	}
+	if bodyMaxSize := os.Getenv("MCP_REQUEST_BODY_MAX_SIZE"); bodyMaxSize != "" {
+		common.OptionMap[common.OptionMCPRequestBodyMaxSize] = bodyMaxSize
+	}
+	if sseBuffer := os.Getenv("SSE_MAX_BUFFERED_EVENTS"); sseBuffer != "" {
+		common.OptionMap[common.OptionSSEMaxBufferedEvents] = sseBuffer
+	}
+	if cacheIcons := os.Getenv("CACHE_SERVICE_ICONS"); cacheIcons != "" {
+		common.OptionMap[common.OptionCacheServiceIcons] = cacheIcons
+	}
+	if packageLabels := os.Getenv("METRICS_PACKAGE_LABELS"); packageLabels != "" {
+		common.OptionMap[common.OptionMetricsPackageLabels] = packageLabels
+	}
+	if workDirRoots := os.Getenv("STDIO_WORKING_DIR_ROOTS"); workDirRoots != "" {
+		common.OptionMap[common.OptionStdioWorkingDirRoots] = workDirRoots
+	}
+	if passthrough := os.Getenv("SUBPROCESS_ENV_PASSTHROUGH"); passthrough != "" {
+		common.OptionMap[common.OptionSubprocessEnvPassthrough] = passthrough
+	}
+	if deny := os.Getenv("SUBPROCESS_ENV_DENY"); deny != "" {
+		common.OptionMap[common.OptionSubprocessEnvDeny] = deny
+	}
 
 	return nil
 }
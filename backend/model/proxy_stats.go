@@ -48,6 +48,18 @@ var proxyRequestStatThing *thing.Thing[*ProxyRequestStat]
 var initStatThingOnce sync.Once
 var initStatThingErr error // To store initialization error
 
+// ProxyRequestStatInit binds the ProxyRequestStat ORM instance to the database configured by InitDB,
+// replacing the one a previous InitDB may have created.
+func ProxyRequestStatInit() error {
+	ormInstance, err := thing.Use[*ProxyRequestStat]()
+	if err != nil {
+		return err
+	}
+	initStatThingOnce.Do(func() {})
+	proxyRequestStatThing, initStatThingErr = ormInstance, nil
+	return nil
+}
+
 // GetProxyRequestStatThing initializes and returns the Thing ORM instance for ProxyRequestStat.
 // This function is now public.
 func GetProxyRequestStatThing() (*thing.Thing[*ProxyRequestStat], error) {
@@ -75,9 +87,83 @@ func GetProxyRequestStatThing() (*thing.Thing[*ProxyRequestStat], error) {
 	return proxyRequestStatThing, nil
 }
 
+// proxyRequestStatBatchSize is the number of stats read per query by EachProxyRequestStat
+const proxyRequestStatBatchSize = 500
+
+// ProxyRequestStatFilter selects the stats recorded in [From, To); a non-zero UserID or ServiceID
+// restricts them to that user or service.
+type ProxyRequestStatFilter struct {
+	From      time.Time
+	To        time.Time
+	UserID    int64
+	ServiceID int64
+}
+
+// EachProxyRequestStat calls fn for every stat matching filter in ID order, reading them in batches so
+// large ranges are never loaded at once. It stops at the first error returned by fn.
+func EachProxyRequestStat(filter ProxyRequestStatFilter, fn func(*ProxyRequestStat) error) error {
+	statThing, err := GetProxyRequestStatThing()
+	if err != nil {
+		return err
+	}
+	where := "created_at >= ? AND created_at < ?"
+	args := []interface{}{filter.From, filter.To}
+	if filter.UserID != 0 {
+		where += " AND user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.ServiceID != 0 {
+		where += " AND service_id = ?"
+		args = append(args, filter.ServiceID)
+	}
+	var lastID int64
+	for {
+		batch, err := statThing.Where(where+" AND id > ?", append(args, lastID)...).Order("id ASC").Fetch(0, proxyRequestStatBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, stat := range batch {
+			if err := fn(stat); err != nil {
+				return err
+			}
+			lastID = stat.ID
+		}
+		if len(batch) < proxyRequestStatBatchSize {
+			return nil
+		}
+	}
+}
+
+// LimitCredentialID identifies the proxy token of user for per-token limits. It is the token's TokenID, which
+// survives rotation, so a rotated token keeps its used quota. Session (JWT) and SSO requests of the user count
+// against the same token, so switching the authentication method does not grant another quota. A user without a
+// token is counted as the user.
+func (user *User) LimitCredentialID() string {
+	if user.TokenID != "" {
+		return "token-" + user.TokenID
+	}
+	return fmt.Sprintf("user-%d", user.ID)
+}
+
+// RequestCounterKey returns the cache key of a daily request counter. A non-empty tokenID
+// (a User.LimitCredentialID) counts requests per access token instead of per user.
+func RequestCounterKey(day string, serviceID int64, userID int64, tokenID string) string {
+	if tokenID != "" {
+		return fmt.Sprintf("token_request:%s:%d:%s:count", day, serviceID, tokenID)
+	}
+	return fmt.Sprintf("user_request:%s:%d:%d:count", day, serviceID, userID)
+}
+
+// saveProxyRequestStat writes a stat row. Mockable in tests
+var saveProxyRequestStat = func(statThing *thing.Thing[*ProxyRequestStat], stat *ProxyRequestStat) error {
+	return statThing.Save(stat)
+}
+
 // RecordRequestStat creates and saves a ProxyRequestStat entry.
+// limitTokenID selects a per-token daily counter (see RequestCounterKey); pass "" to count per user.
 // It will degrade gracefully (log and not save) if the ORM instance is not initialized.
-func RecordRequestStat(serviceID int64, serviceName string, userID int64, reqType ProxyRequestType, method string, requestPath string, responseTimeMs int64, statusCode int, success bool) {
+// A failed save is queued for retry (see enqueueFailedWrite) rather than lost.
+func RecordRequestStat(serviceID int64, serviceName string, userID int64, limitTokenID string, reqType ProxyRequestType, method string, requestPath string, responseTimeMs int64, statusCode int, success bool) {
 	statThing, err := GetProxyRequestStatThing()
 	if err != nil {
 		common.SysError(fmt.Sprintf("Failed to get ProxyRequestStatThing, cannot record stat: %v", err))
@@ -96,11 +182,14 @@ func RecordRequestStat(serviceID int64, serviceName string, userID int64, reqTyp
 		Success:        success,
 	}
 
-	if err := statThing.Save(&stat); err != nil {
+	row := stat
+	if err := saveProxyRequestStat(statThing, &stat); err != nil {
 		common.SysError(fmt.Sprintf("Error saving ProxyRequestStat: %v", err))
-		// Do not return here, try to update cache even if DB save fails for some reason?
-		// Or should we return? For now, let's try to update cache.
-		// User's original code proceeded with cache update irrespective of this specific error.
+		// The row is retried in the background; the cache counters below are updated either way
+		enqueueFailedWrite("request stat", func() error {
+			retry := row
+			return saveProxyRequestStat(statThing, &retry)
+		})
 	}
 
 	// Record daily request count to cache only if status is 200 or 202
@@ -133,7 +222,7 @@ func RecordRequestStat(serviceID int64, serviceName string, userID int64, reqTyp
 
 		// Increment user-specific request count if user is authenticated
 		if userID > 0 {
-			userCacheKey := fmt.Sprintf("user_request:%s:%d:%d:count", today, serviceID, userID)
+			userCacheKey := RequestCounterKey(today, serviceID, userID, limitTokenID)
 			userNewCount, userErr := cacheClient.Incr(ctx, userCacheKey)
 			if userErr != nil {
 				common.SysError(fmt.Sprintf("[RecordRequestStat-CACHE] Error incrementing user daily count for service %d, user %d: %v", serviceID, userID, userErr))
@@ -0,0 +1,377 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+)
+
+// parseArgsJSON 解析参数 JSON 数组，空字符串及列默认值 {} 视为无参数
+func parseArgsJSON(argsJSON string) ([]string, error) {
+	if trimmed := strings.TrimSpace(argsJSON); trimmed == "" || trimmed == "{}" {
+		return nil, nil
+	}
+	var args []string
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// ValidateRuntimeArgsJSON 检查 RuntimeArgsJSON 是否为字符串数组（允许为空）
+func ValidateRuntimeArgsJSON(runtimeArgsJSON string) error {
+	_, err := parseArgsJSON(runtimeArgsJSON)
+	return err
+}
+
+// CommandArgs 返回 stdio 启动参数：ArgsJSON（包引用部分，如 -y pkg）之后追加 RuntimeArgsJSON（运行时参数，如 --tools=x）
+func (s *MCPService) CommandArgs() ([]string, error) {
+	args, err := parseArgsJSON(s.ArgsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid args_json: %w", err)
+	}
+	runtimeArgs, err := parseArgsJSON(s.RuntimeArgsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid runtime_args_json: %w", err)
+	}
+	combined := make([]string, 0, len(args)+len(runtimeArgs))
+	combined = append(combined, args...)
+	return s.UVXArgs(append(combined, runtimeArgs...)), nil
+}
+
+// pythonVersionPattern 匹配 uv 接受的常见解释器请求：3、3.12、3.12.4，可带实现名前缀(cpython3.12、pypy@3.10)
+var pythonVersionPattern = regexp.MustCompile(`^((cpython|pypy|python)[@-]?)?\d+(\.\d+){0,2}$`)
+
+// ValidatePythonVersion 校验 uvx --python 的版本字符串，空字符串表示不指定
+func ValidatePythonVersion(version string) error {
+	version = strings.TrimSpace(version)
+	if version == "" || pythonVersionPattern.MatchString(version) {
+		return nil
+	}
+	return fmt.Errorf("invalid python version %q, expected something like 3.12 or cpython3.12", version)
+}
+
+// ValidateIndexURL 校验 uvx --index-url，必须是 http(s) 绝对地址，空字符串表示不指定
+func ValidateIndexURL(indexURL string) error {
+	indexURL = strings.TrimSpace(indexURL)
+	if indexURL == "" {
+		return nil
+	}
+	u, err := url.Parse(indexURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid index url %q, expected an absolute http(s) url", indexURL)
+	}
+	return nil
+}
+
+// ValidateUVXOptions 校验服务级的 uvx --python 与 --index-url 配置
+func (s *MCPService) ValidateUVXOptions() error {
+	if err := ValidatePythonVersion(s.UVXPythonVersion); err != nil {
+		return err
+	}
+	return ValidateIndexURL(s.UVXIndexURL)
+}
+
+// ValidateHealthCheckURL 校验健康检查地址：仅 SSE/HTTP 服务可配置，必须是 http(s) 绝对地址，空字符串表示使用 MCP Ping
+func (s *MCPService) ValidateHealthCheckURL() error {
+	s.HealthCheckURL = strings.TrimSpace(s.HealthCheckURL)
+	if s.HealthCheckURL == "" {
+		return nil
+	}
+	if s.Type != ServiceTypeSSE && s.Type != ServiceTypeStreamableHTTP {
+		return fmt.Errorf("health check url is only supported for sse and streamableHttp services")
+	}
+	u, err := url.Parse(s.HealthCheckURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid health check url %q, expected an absolute http(s) url", s.HealthCheckURL)
+	}
+	return nil
+}
+
+// FallbackEndpoints 解析 FallbackEndpointsJSON：SSE/HTTP 服务为备用 upstream 地址，stdio 服务为备用命令(参数与环境变量同主命令)
+func (s *MCPService) FallbackEndpoints() ([]string, error) {
+	if strings.TrimSpace(s.FallbackEndpointsJSON) == "" {
+		return nil, nil
+	}
+	var endpoints []string
+	if err := json.Unmarshal([]byte(s.FallbackEndpointsJSON), &endpoints); err != nil {
+		return nil, fmt.Errorf("invalid fallback_endpoints_json: %w", err)
+	}
+	return endpoints, nil
+}
+
+// ValidateFallbackEndpoints 校验备用端点：SSE/HTTP 服务必须是 http(s) 绝对地址，stdio 服务必须是非空命令
+func (s *MCPService) ValidateFallbackEndpoints() error {
+	endpoints, err := s.FallbackEndpoints()
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			return fmt.Errorf("fallback endpoint must not be empty")
+		}
+		if s.Type == ServiceTypeStdio {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid fallback endpoint %q, expected an absolute http(s) url", endpoint)
+		}
+	}
+	return nil
+}
+
+// EndpointChain 返回依次尝试的端点：Command 在前，其后为去重的备用端点；备用端点无效时只返回 Command
+func (s *MCPService) EndpointChain() []string {
+	chain := []string{s.Command}
+	endpoints, err := s.FallbackEndpoints()
+	if err != nil {
+		return chain
+	}
+	for _, endpoint := range endpoints {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" && !slices.Contains(chain, endpoint) {
+			chain = append(chain, endpoint)
+		}
+	}
+	return chain
+}
+
+// reservedResponseHeaders 由代理或 MCP 传输层管理，配置的响应头不能覆盖，否则会破坏 SSE/流式响应或会话
+var reservedResponseHeaders = map[string]bool{
+	"Connection":           true,
+	"Content-Encoding":     true,
+	"Content-Length":       true,
+	"Content-Type":         true,
+	"Keep-Alive":           true,
+	"Mcp-Protocol-Version": true,
+	"Mcp-Session-Id":       true,
+	"Retry-After":          true,
+	"Te":                   true,
+	"Trailer":              true,
+	"Transfer-Encoding":    true,
+	"Upgrade":              true,
+}
+
+// ResponseHeaders 解析代理端点附加的响应头，名称统一为规范形式；未配置时返回 nil
+func (s *MCPService) ResponseHeaders() (map[string]string, error) {
+	raw := strings.TrimSpace(s.ResponseHeadersJSON)
+	if raw == "" || raw == "{}" {
+		return nil, nil
+	}
+	var configured map[string]string
+	if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+		return nil, fmt.Errorf("response headers must be a JSON object of strings: %w", err)
+	}
+	headers := make(map[string]string, len(configured))
+	for name, value := range configured {
+		headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// MaintenanceWindowRange 返回服务配置的维护窗口，未配置或格式无效时 ok 为 false
+func (s *MCPService) MaintenanceWindowRange() (start, end time.Time, ok bool) {
+	if strings.TrimSpace(s.MaintenanceWindow) == "" {
+		return start, end, false
+	}
+	start, end, err := common.ParseMaintenanceWindow(s.MaintenanceWindow)
+	return start, end, err == nil
+}
+
+// ValidateResponseHeaders 校验代理端点附加的响应头：名称须为合法的 HTTP token 且不能是传输层管理的头，值不能包含控制字符
+func (s *MCPService) ValidateResponseHeaders() error {
+	headers, err := s.ResponseHeaders()
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		if !isHTTPToken(name) {
+			return fmt.Errorf("invalid response header name %q", name)
+		}
+		if reservedResponseHeaders[name] {
+			return fmt.Errorf("response header %s is managed by the proxy and cannot be configured", name)
+		}
+		if strings.IndexFunc(value, func(r rune) bool { return (r < 0x20 && r != '\t') || r == 0x7f }) >= 0 {
+			return fmt.Errorf("response header %s has a value with control characters", name)
+		}
+	}
+	return nil
+}
+
+// isHTTPToken 判断 name 是否为 RFC 9110 定义的 token(请求头名称的合法字符集)
+func isHTTPToken(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r >= 0x7f || r <= 0x20 || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// UVXOptions 返回服务生效的 uvx --python 版本与 --index-url：服务级配置优先，否则使用全局默认值
+func (s *MCPService) UVXOptions() (pythonVersion, indexURL string) {
+	pythonVersion, indexURL = common.GetUVXDefaults()
+	if v := strings.TrimSpace(s.UVXPythonVersion); v != "" {
+		pythonVersion = v
+	}
+	if v := strings.TrimSpace(s.UVXIndexURL); v != "" {
+		indexURL = v
+	}
+	return pythonVersion, indexURL
+}
+
+// UVXArgs 为 uvx 服务在 args 前加上生效的 --python / --index-url，非 uvx 命令原样返回
+func (s *MCPService) UVXArgs(args []string) []string {
+	pythonVersion, indexURL := s.UVXOptions()
+	return ApplyUVXOptions(s.Command, args, pythonVersion, indexURL)
+}
+
+// ApplyUVXOptions 在 uvx 参数前加上 --python 和 --index-url；args 中已显式指定的选项保持用户的值，
+// 非 uvx 命令或值无效时不做修改
+func ApplyUVXOptions(command string, args []string, pythonVersion, indexURL string) []string {
+	if strings.TrimSuffix(filepath.Base(command), ".cmd") != "uvx" {
+		return args
+	}
+	packageArgs, _, ok := SplitPackageArgs(command, args)
+	if !ok {
+		packageArgs = args
+	}
+	var prefix []string
+	if pythonVersion != "" && ValidatePythonVersion(pythonVersion) == nil && !hasOption(packageArgs, "--python", "-p") {
+		prefix = append(prefix, "--python", pythonVersion)
+	}
+	if indexURL != "" && ValidateIndexURL(indexURL) == nil && !hasOption(packageArgs, "--index-url", "-i", "--index", "--default-index") {
+		prefix = append(prefix, "--index-url", indexURL)
+	}
+	if len(prefix) == 0 {
+		return args
+	}
+	return append(prefix, args...)
+}
+
+// hasOption 判断 args 中是否出现任一选项(支持 --opt value 与 --opt=value 两种写法)
+func hasOption(args []string, names ...string) bool {
+	for _, arg := range args {
+		for _, name := range names {
+			if arg == name || strings.HasPrefix(arg, name+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ProbeArgs 返回拆分后的健康探测命令（按空白分隔），未配置时返回 nil
+func (s *MCPService) ProbeArgs() []string {
+	fields := strings.Fields(s.ProbeCommand)
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// hookShellMetachars 钩子命令按空白拆分后直接执行，不经过 shell；含有这些字符说明命令依赖管道、重定向等 shell 语法
+const hookShellMetachars = ";|&<>`$\n"
+
+// PreStartArgs 返回拆分后的启动前钩子命令，未配置时返回 nil
+func (s *MCPService) PreStartArgs() []string {
+	return strings.Fields(s.PreStartCommand)
+}
+
+// PostStopArgs 返回拆分后的停止后钩子命令，未配置时返回 nil
+func (s *MCPService) PostStopArgs() []string {
+	return strings.Fields(s.PostStopCommand)
+}
+
+// ValidateHookCommands 校验启动前/停止后钩子：仅 stdio 服务可配置，命令不能包含 shell 语法，
+// 且可执行文件必须在 HookCommandAllowlist 中
+func (s *MCPService) ValidateHookCommands() error {
+	hooks := []struct{ name, command string }{{"pre_start_command", s.PreStartCommand}, {"post_stop_command", s.PostStopCommand}}
+	for _, hook := range hooks {
+		if strings.TrimSpace(hook.command) == "" {
+			continue
+		}
+		if s.Type != ServiceTypeStdio {
+			return fmt.Errorf("%s is only supported for stdio services", hook.name)
+		}
+		if strings.ContainsAny(hook.command, hookShellMetachars) {
+			return fmt.Errorf("%s must be a plain command without shell syntax such as pipes, redirects or variables", hook.name)
+		}
+		if executable := strings.Fields(hook.command)[0]; !common.IsHookCommandAllowed(executable) {
+			return fmt.Errorf("%s runs %q, which is not in the hook command allowlist (%s)", hook.name, executable, strings.Join(common.GetHookCommandAllowlist(), ", "))
+		}
+	}
+	return nil
+}
+
+// SplitPackageArgs 按已知的启动器模式将参数拆分为包引用部分和运行时参数：
+//   - npx: 前导选项(-y/--yes, -p/--package <pkg> 等)及随后的包名
+//   - uvx: 前导选项(--from <spec>, --with <dep> 等)及随后的工具名
+//
+// 无法识别的命令返回 ok=false，调用方应保持参数不变。
+func SplitPackageArgs(command string, args []string) (packageArgs, runtimeArgs []string, ok bool) {
+	var optionsWithValue map[string]bool
+	switch strings.TrimSuffix(filepath.Base(command), ".cmd") {
+	case "npx":
+		optionsWithValue = map[string]bool{"-p": true, "--package": true, "-c": true, "--call": true}
+	case "uvx":
+		optionsWithValue = map[string]bool{"--from": true, "--with": true, "--python": true, "-p": true, "--index-url": true, "-i": true, "--index": true, "--default-index": true}
+	default:
+		return nil, nil, false
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			// 第一个非选项参数即包名/工具名
+			return args[:i+1], args[i+1:], true
+		}
+		if optionsWithValue[arg] {
+			i++
+		}
+	}
+	return nil, nil, false
+}
+
+// MigrateServiceRuntimeArgs 将已有 stdio 服务 ArgsJSON 中包名之后的参数迁移到 RuntimeArgsJSON。
+// 文件托管的服务、已设置 RuntimeArgsJSON 的服务以及无法识别的命令保持不变。
+func MigrateServiceRuntimeArgs() error {
+	services, err := MCPServiceDB.Where("type = ? AND deleted = ?", ServiceTypeStdio, false).All()
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		if svc.IsFileManaged() || svc.RuntimeArgsJSON != "" {
+			continue
+		}
+		args, err := parseArgsJSON(svc.ArgsJSON)
+		if err != nil {
+			continue
+		}
+		packageArgs, runtimeArgs, ok := SplitPackageArgs(svc.Command, args)
+		if !ok || len(runtimeArgs) == 0 {
+			continue
+		}
+		packageJSON, _ := json.Marshal(packageArgs)
+		runtimeJSON, _ := json.Marshal(runtimeArgs)
+		svc.ArgsJSON = string(packageJSON)
+		svc.RuntimeArgsJSON = string(runtimeJSON)
+		if err := MCPServiceDB.Save(svc); err != nil {
+			return fmt.Errorf("failed to migrate runtime args for service %s: %w", svc.Name, err)
+		}
+		common.SysLog(fmt.Sprintf("Migrated runtime args of service %s: %s", svc.Name, svc.RuntimeArgsJSON))
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMCPServiceCommandArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        string
+		runtimeArgs string
+		want        []string
+		wantErr     bool
+	}{
+		{"package and runtime args", `["-y","@scope/pkg"]`, `["--tools=x","--verbose"]`, []string{"-y", "@scope/pkg", "--tools=x", "--verbose"}, false},
+		{"package args only", `["-y","pkg"]`, "", []string{"-y", "pkg"}, false},
+		{"runtime args only", "", `["--port","1"]`, []string{"--port", "1"}, false},
+		{"column default", "{}", "", []string{}, false},
+		{"invalid runtime args", `["-y","pkg"]`, `"--tools=x"`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MCPService{ArgsJSON: tt.args, RuntimeArgsJSON: tt.runtimeArgs}
+			got, err := svc.CommandArgs()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateHookCommands(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceType ServiceType
+		preStart    string
+		postStop    string
+		wantErr     string
+	}{
+		{"no hooks", ServiceTypeSSE, "", "", ""},
+		{"plain commands", ServiceTypeStdio, "mkdir -p /tmp/svc-config", "rm -rf /tmp/svc-config", ""},
+		{"pipe", ServiceTypeStdio, "cat a | tee b", "", "pre_start_command"},
+		{"command substitution", ServiceTypeStdio, "", "rm $(ls)", "post_stop_command"},
+		{"chained commands", ServiceTypeStdio, "touch a; touch b", "", "pre_start_command"},
+		{"web service", ServiceTypeStreamableHTTP, "touch a", "", "only supported for stdio"},
+		{"not allowlisted", ServiceTypeStdio, "curl -o /tmp/x https://example.com", "", "allowlist"},
+		{"allowlisted name under another path", ServiceTypeStdio, "", "/tmp/rm -rf /", "allowlist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MCPService{Type: tt.serviceType, PreStartCommand: tt.preStart, PostStopCommand: tt.postStop}
+			err := svc.ValidateHookCommands()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestMCPServiceCommandArgsUVXOptions(t *testing.T) {
+	common.OptionMapRWMutex.Lock()
+	originalPython, originalIndex := common.OptionMap[common.OptionUVXPythonVersion], common.OptionMap[common.OptionUVXIndexURL]
+	common.OptionMapRWMutex.Unlock()
+	setDefaults := func(python, index string) {
+		common.OptionMapRWMutex.Lock()
+		defer common.OptionMapRWMutex.Unlock()
+		common.OptionMap[common.OptionUVXPythonVersion] = python
+		common.OptionMap[common.OptionUVXIndexURL] = index
+	}
+	defer setDefaults(originalPython, originalIndex)
+
+	tests := []struct {
+		name          string
+		command       string
+		args          string
+		servicePython string
+		serviceIndex  string
+		globalPython  string
+		globalIndex   string
+		want          []string
+	}{
+		{"no options", "uvx", `["--from","pkg","pkg"]`, "", "", "", "", []string{"--from", "pkg", "pkg"}},
+		{"service python", "uvx", `["--from","pkg","pkg"]`, "3.12", "", "", "", []string{"--python", "3.12", "--from", "pkg", "pkg"}},
+		{"global defaults", "uvx", `["pkg"]`, "", "", "3.11", "https://mirror.example/simple", []string{"--python", "3.11", "--index-url", "https://mirror.example/simple", "pkg"}},
+		{"service overrides global", "uvx", `["pkg"]`, "cpython3.13", "", "3.11", "", []string{"--python", "cpython3.13", "pkg"}},
+		{"explicit args win", "uvx", `["--python=3.10","pkg"]`, "3.12", "", "", "", []string{"--python=3.10", "pkg"}},
+		{"tool argument is not an uvx option", "uvx", `["pkg","--python","x"]`, "3.12", "", "", "", []string{"--python", "3.12", "pkg", "--python", "x"}},
+		{"not uvx", "npx", `["-y","pkg"]`, "3.12", "", "3.11", "", []string{"-y", "pkg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setDefaults(tt.globalPython, tt.globalIndex)
+			svc := &MCPService{Command: tt.command, ArgsJSON: tt.args, UVXPythonVersion: tt.servicePython, UVXIndexURL: tt.serviceIndex}
+			got, err := svc.CommandArgs()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateUVXOptions(t *testing.T) {
+	for _, version := range []string{"", "3", "3.12", "3.12.4", "cpython3.12", "pypy@3.10", "python-3.11"} {
+		assert.NoError(t, ValidatePythonVersion(version), version)
+	}
+	for _, version := range []string{"latest", "3.12; rm -rf /", "--python", "3..12", "/usr/bin/python3"} {
+		assert.Error(t, ValidatePythonVersion(version), version)
+	}
+	assert.NoError(t, ValidateIndexURL("https://pypi.example/simple"))
+	assert.Error(t, ValidateIndexURL("pypi.example/simple"))
+	assert.Error(t, ValidateIndexURL("file:///tmp/index"))
+}
+
+func TestValidateHealthCheckURL(t *testing.T) {
+	svc := &MCPService{Type: ServiceTypeStreamableHTTP, HealthCheckURL: " https://mcp.example/health "}
+	assert.NoError(t, svc.ValidateHealthCheckURL())
+	assert.Equal(t, "https://mcp.example/health", svc.HealthCheckURL)
+	assert.NoError(t, (&MCPService{Type: ServiceTypeStdio}).ValidateHealthCheckURL())
+	assert.Error(t, (&MCPService{Type: ServiceTypeStdio, HealthCheckURL: "http://localhost/health"}).ValidateHealthCheckURL())
+	assert.Error(t, (&MCPService{Type: ServiceTypeSSE, HealthCheckURL: "/health"}).ValidateHealthCheckURL())
+}
+
+func TestFallbackEndpoints(t *testing.T) {
+	svc := &MCPService{Type: ServiceTypeSSE, Command: "https://a.example/sse", FallbackEndpointsJSON: `["https://b.example/sse", " https://a.example/sse "]`}
+	assert.NoError(t, svc.ValidateFallbackEndpoints())
+	assert.Equal(t, []string{"https://a.example/sse", "https://b.example/sse"}, svc.EndpointChain())
+	assert.Equal(t, []string{"npx"}, (&MCPService{Type: ServiceTypeStdio, Command: "npx"}).EndpointChain())
+	assert.NoError(t, (&MCPService{Type: ServiceTypeStdio, FallbackEndpointsJSON: `["bunx"]`}).ValidateFallbackEndpoints())
+
+	assert.Error(t, (&MCPService{Type: ServiceTypeSSE, FallbackEndpointsJSON: `["/sse"]`}).ValidateFallbackEndpoints())
+	assert.Error(t, (&MCPService{Type: ServiceTypeStdio, FallbackEndpointsJSON: `[" "]`}).ValidateFallbackEndpoints())
+	assert.Error(t, (&MCPService{Type: ServiceTypeStreamableHTTP, FallbackEndpointsJSON: `"https://b.example/mcp"`}).ValidateFallbackEndpoints())
+}
+
+func TestValidateResponseHeaders(t *testing.T) {
+	svc := &MCPService{ResponseHeadersJSON: `{" x-frame-options ": "DENY", "Vary": "Origin"}`}
+	assert.NoError(t, svc.ValidateResponseHeaders())
+	headers, err := svc.ResponseHeaders()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"X-Frame-Options": "DENY", "Vary": "Origin"}, headers)
+	assert.NoError(t, (&MCPService{ResponseHeadersJSON: "{}"}).ValidateResponseHeaders())
+
+	for _, invalid := range []string{
+		`["X-Test"]`,
+		`{"X Test": "1"}`,
+		`{"X-Test:": "1"}`,
+		`{"X-Test": "a\r\nSet-Cookie: x=1"}`,
+		`{"content-type": "text/plain"}`,
+		`{"Mcp-Session-Id": "fixed"}`,
+	} {
+		assert.Error(t, (&MCPService{ResponseHeadersJSON: invalid}).ValidateResponseHeaders(), invalid)
+	}
+}
+
+func TestSplitPackageArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		args        []string
+		wantPackage []string
+		wantRuntime []string
+		wantOK      bool
+	}{
+		{"npx with flags", "npx", []string{"-y", "@scope/pkg@1.2.0", "--tools=x"}, []string{"-y", "@scope/pkg@1.2.0"}, []string{"--tools=x"}, true},
+		{"npx with package option", "/usr/bin/npx", []string{"--package", "pkg", "pkg-bin", "serve"}, []string{"--package", "pkg", "pkg-bin"}, []string{"serve"}, true},
+		{"uvx with from", "uvx", []string{"--from", "git+https://x/y", "tool", "--debug"}, []string{"--from", "git+https://x/y", "tool"}, []string{"--debug"}, true},
+		{"no runtime args", "npx", []string{"-y", "pkg"}, []string{"-y", "pkg"}, []string{}, true},
+		{"unknown command", "python", []string{"server.py", "--port", "1"}, nil, nil, false},
+		{"no package", "npx", []string{"-y"}, nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packageArgs, runtimeArgs, ok := SplitPackageArgs(tt.command, tt.args)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantPackage, packageArgs)
+			assert.Equal(t, tt.wantRuntime, runtimeArgs)
+		})
+	}
+}
+
+func TestMigrateServiceRuntimeArgs(t *testing.T) {
+	originalSQLitePath := common.SQLitePath
+	common.SQLitePath = filepath.Join(t.TempDir(), "runtime_args_test.db")
+	defer func() { common.SQLitePath = originalSQLitePath }()
+	assert.NoError(t, InitDB())
+
+	legacy := &MCPService{Name: "legacy", DisplayName: "legacy", Type: ServiceTypeStdio, Command: "npx", ArgsJSON: `["-y","pkg","--tools=x"]`}
+	fileManaged := &MCPService{Name: "file", DisplayName: "file", Type: ServiceTypeStdio, Command: "npx", ArgsJSON: `["-y","pkg","--tools=x"]`, ConfigFile: "file.json"}
+	custom := &MCPService{Name: "custom", DisplayName: "custom", Type: ServiceTypeStdio, Command: "python", ArgsJSON: `["server.py","--port","1"]`}
+	for _, svc := range []*MCPService{legacy, fileManaged, custom} {
+		assert.NoError(t, CreateService(svc))
+	}
+
+	assert.NoError(t, MigrateServiceRuntimeArgs())
+
+	migrated, err := GetServiceByID(legacy.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `["-y","pkg"]`, migrated.ArgsJSON)
+		assert.Equal(t, `["--tools=x"]`, migrated.RuntimeArgsJSON)
+		args, err := migrated.CommandArgs()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"-y", "pkg", "--tools=x"}, args)
+	}
+	for _, id := range []int64{fileManaged.ID, custom.ID} {
+		untouched, err := GetServiceByID(id)
+		if assert.NoError(t, err) {
+			assert.Empty(t, untouched.RuntimeArgsJSON)
+		}
+	}
+}
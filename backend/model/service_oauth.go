@@ -0,0 +1,174 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/burugo/thing"
+)
+
+// OAuth grant types for services whose upstream requires an access token
+const (
+	OAuthGrantClientCredentials = "client_credentials"
+	OAuthGrantDeviceCode        = "device_code"
+)
+
+// oauthTokenExpirySkew 提前视为过期的时间，避免 token 在请求途中失效
+const oauthTokenExpirySkew = 30 * time.Second
+
+// ServiceOAuthConfig 服务的 OAuth 配置(OAuthConfigJSON)，获取的 access token 在创建实例时以 Authorization 请求头注入
+type ServiceOAuthConfig struct {
+	GrantType              string `json:"grant_type"`                         // client_credentials 或 device_code
+	TokenURL               string `json:"token_url"`                          // token 端点
+	DeviceAuthorizationURL string `json:"device_authorization_url,omitempty"` // device_code 的设备授权端点
+	ClientID               string `json:"client_id"`
+	ClientSecret           string `json:"client_secret,omitempty"`
+	Scope                  string `json:"scope,omitempty"`
+	Audience               string `json:"audience,omitempty"`
+}
+
+// OAuthConfig 解析 OAuthConfigJSON，未配置时返回 nil
+func (s *MCPService) OAuthConfig() (*ServiceOAuthConfig, error) {
+	if strings.TrimSpace(s.OAuthConfigJSON) == "" {
+		return nil, nil
+	}
+	var config ServiceOAuthConfig
+	if err := json.Unmarshal([]byte(s.OAuthConfigJSON), &config); err != nil {
+		return nil, fmt.Errorf("invalid oauth_config_json: %w", err)
+	}
+	return &config, nil
+}
+
+// MaskedOAuthConfigJSON 返回隐藏 client_secret 后的 OAuthConfigJSON，用于接口响应；无法解析时整体隐藏
+func (s *MCPService) MaskedOAuthConfigJSON() string {
+	config, err := s.OAuthConfig()
+	if err != nil {
+		return common.RedactedPlaceholder
+	}
+	if config == nil {
+		return ""
+	}
+	if config.ClientSecret != "" {
+		config.ClientSecret = common.RedactedPlaceholder
+	}
+	data, _ := json.Marshal(config)
+	return string(data)
+}
+
+// RestoreOAuthClientSecret 提交的 client_secret 为脱敏占位符时，沿用 previousJSON 中保存的 client_secret
+func (s *MCPService) RestoreOAuthClientSecret(previousJSON string) {
+	config, err := s.OAuthConfig()
+	if err != nil || config == nil || config.ClientSecret != common.RedactedPlaceholder {
+		return
+	}
+	previous := &MCPService{OAuthConfigJSON: previousJSON}
+	if old, err := previous.OAuthConfig(); err == nil && old != nil {
+		config.ClientSecret = old.ClientSecret
+	} else {
+		config.ClientSecret = ""
+	}
+	data, _ := json.Marshal(config)
+	s.OAuthConfigJSON = string(data)
+}
+
+// ValidateOAuthConfig 校验 OAuth 配置：仅 SSE/HTTP 服务可配置，端点必须是 http(s) 绝对地址
+func (s *MCPService) ValidateOAuthConfig() error {
+	config, err := s.OAuthConfig()
+	if err != nil || config == nil {
+		return err
+	}
+	if s.Type != ServiceTypeSSE && s.Type != ServiceTypeStreamableHTTP {
+		return fmt.Errorf("oauth is only supported for sse and streamableHttp services")
+	}
+	if config.ClientID == "" {
+		return fmt.Errorf("oauth client_id is required")
+	}
+	endpoints := map[string]string{"token_url": config.TokenURL}
+	switch config.GrantType {
+	case OAuthGrantClientCredentials:
+	case OAuthGrantDeviceCode:
+		endpoints["device_authorization_url"] = config.DeviceAuthorizationURL
+	default:
+		return fmt.Errorf("unsupported oauth grant_type %q, expected %s or %s", config.GrantType, OAuthGrantClientCredentials, OAuthGrantDeviceCode)
+	}
+	for name, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid oauth %s %q, expected an absolute http(s) url", name, endpoint)
+		}
+	}
+	return nil
+}
+
+// ServiceOAuthToken 服务的 OAuth token 以及进行中的 device flow，每个服务一条记录
+type ServiceOAuthToken struct {
+	thing.BaseModel
+	ServiceID           int64     `db:"service_id,unique" json:"service_id"`
+	AccessToken         string    `db:"access_token" json:"-"`
+	RefreshToken        string    `db:"refresh_token" json:"-"`
+	TokenType           string    `db:"token_type" json:"token_type"`
+	ExpiresAt           time.Time `db:"expires_at" json:"expires_at"` // 零值表示 token 没有过期时间
+	DeviceCode          string    `db:"device_code" json:"-"`         // 进行中的 device flow，完成或过期后清空
+	UserCode            string    `db:"user_code" json:"user_code,omitempty"`
+	VerificationURI     string    `db:"verification_uri" json:"verification_uri,omitempty"`
+	DeviceCodeExpiresAt time.Time `db:"device_code_expires_at" json:"device_code_expires_at"`
+	PollInterval        int       `db:"poll_interval" json:"poll_interval,omitempty"` // 秒
+}
+
+// TableName sets the table name for the ServiceOAuthToken model
+func (t *ServiceOAuthToken) TableName() string {
+	return "service_oauth_tokens"
+}
+
+// Usable reports whether the access token is set and not about to expire
+func (t *ServiceOAuthToken) Usable(now time.Time) bool {
+	return t.AccessToken != "" && (t.ExpiresAt.IsZero() || now.Add(oauthTokenExpirySkew).Before(t.ExpiresAt))
+}
+
+var ServiceOAuthTokenDB *thing.Thing[*ServiceOAuthToken]
+
+// ServiceOAuthTokenInit initializes the ServiceOAuthTokenDB
+func ServiceOAuthTokenInit() error {
+	var err error
+	ServiceOAuthTokenDB, err = thing.Use[*ServiceOAuthToken]()
+	if err != nil {
+		return fmt.Errorf("failed to initialize ServiceOAuthTokenDB: %w", err)
+	}
+	return nil
+}
+
+// GetServiceOAuthToken returns the OAuth token record of a service, or ErrRecordNotFound
+func GetServiceOAuthToken(serviceID int64) (*ServiceOAuthToken, error) {
+	tokens, err := ServiceOAuthTokenDB.Where("service_id = ?", serviceID).Fetch(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return tokens[0], nil
+}
+
+// SaveServiceOAuthToken creates or updates the OAuth token record of a service
+func SaveServiceOAuthToken(token *ServiceOAuthToken) error {
+	return ServiceOAuthTokenDB.Save(token)
+}
+
+// DeleteServiceOAuthToken removes the OAuth token record of a service, if any
+func DeleteServiceOAuthToken(serviceID int64) error {
+	tokens, err := ServiceOAuthTokenDB.Where("service_id = ?", serviceID).All()
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := ServiceOAuthTokenDB.Delete(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
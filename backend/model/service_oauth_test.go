@@ -0,0 +1,60 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOAuthConfig(t *testing.T) {
+	assert.NoError(t, (&MCPService{Type: ServiceTypeSSE}).ValidateOAuthConfig())
+	assert.NoError(t, (&MCPService{Type: ServiceTypeStreamableHTTP, OAuthConfigJSON: `{"grant_type": "client_credentials", "token_url": "https://auth.example/token", "client_id": "one-mcp"}`}).ValidateOAuthConfig())
+	assert.NoError(t, (&MCPService{Type: ServiceTypeSSE, OAuthConfigJSON: `{"grant_type": "device_code", "token_url": "https://auth.example/token", "device_authorization_url": "https://auth.example/device", "client_id": "one-mcp"}`}).ValidateOAuthConfig())
+
+	for _, invalid := range []*MCPService{
+		{Type: ServiceTypeStdio, OAuthConfigJSON: `{"grant_type": "client_credentials", "token_url": "https://auth.example/token", "client_id": "one-mcp"}`},
+		{Type: ServiceTypeSSE, OAuthConfigJSON: `{"grant_type": "client_credentials", "token_url": "https://auth.example/token"}`},
+		{Type: ServiceTypeSSE, OAuthConfigJSON: `{"grant_type": "password", "token_url": "https://auth.example/token", "client_id": "one-mcp"}`},
+		{Type: ServiceTypeSSE, OAuthConfigJSON: `{"grant_type": "client_credentials", "token_url": "/token", "client_id": "one-mcp"}`},
+		{Type: ServiceTypeSSE, OAuthConfigJSON: `{"grant_type": "device_code", "token_url": "https://auth.example/token", "client_id": "one-mcp"}`},
+		{Type: ServiceTypeSSE, OAuthConfigJSON: `[]`},
+	} {
+		assert.Error(t, invalid.ValidateOAuthConfig(), invalid.OAuthConfigJSON)
+	}
+}
+
+func TestServiceOAuthTokenUsable(t *testing.T) {
+	now := time.Now()
+	assert.False(t, (&ServiceOAuthToken{}).Usable(now))
+	assert.True(t, (&ServiceOAuthToken{AccessToken: "t"}).Usable(now), "tokens without expiry stay usable")
+	assert.True(t, (&ServiceOAuthToken{AccessToken: "t", ExpiresAt: now.Add(time.Hour)}).Usable(now))
+	assert.False(t, (&ServiceOAuthToken{AccessToken: "t", ExpiresAt: now.Add(10 * time.Second)}).Usable(now), "tokens about to expire are refreshed early")
+}
+
+func TestMaskAndRestoreOAuthClientSecret(t *testing.T) {
+	saved := `{"grant_type": "client_credentials", "token_url": "https://auth.example/token", "client_id": "one-mcp", "client_secret": "top-secret"}`
+	svc := &MCPService{OAuthConfigJSON: saved}
+	masked := svc.MaskedOAuthConfigJSON()
+	assert.NotContains(t, masked, "top-secret")
+	assert.Contains(t, masked, common.RedactedPlaceholder)
+	assert.Empty(t, (&MCPService{}).MaskedOAuthConfigJSON())
+
+	// Submitting the masked config back keeps the saved secret
+	submitted := &MCPService{OAuthConfigJSON: masked}
+	submitted.RestoreOAuthClientSecret(saved)
+	config, err := submitted.OAuthConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "top-secret", config.ClientSecret)
+	}
+
+	// A new secret replaces the saved one
+	changed := &MCPService{OAuthConfigJSON: `{"grant_type": "client_credentials", "client_secret": "rotated"}`}
+	changed.RestoreOAuthClientSecret(saved)
+	config, err = changed.OAuthConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "rotated", config.ClientSecret)
+	}
+}
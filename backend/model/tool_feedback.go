@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/burugo/thing"
+)
+
+// ToolFeedback 记录客户端对一次工具调用是否有用的反馈 (仅保存评分，不保存调用内容)
+type ToolFeedback struct {
+	thing.BaseModel
+	ServiceID int64  `db:"service_id,index:idx_feedback_tool" json:"service_id"`
+	ToolName  string `db:"tool_name,index:idx_feedback_tool" json:"tool_name"`
+	UserID    int64  `db:"user_id,index:idx_feedback_request" json:"user_id"`
+	RequestID string `db:"request_id,index:idx_feedback_request" json:"request_id"` // 客户端提供的请求 ID, 用于去重
+	Useful    bool   `db:"useful" json:"useful"`
+}
+
+// TableName sets the table name for the ToolFeedback model
+func (f *ToolFeedback) TableName() string {
+	return "tool_feedbacks"
+}
+
+// ToolFeedbackSummary 按服务/工具聚合的反馈统计
+type ToolFeedbackSummary struct {
+	ServiceID int64   `json:"service_id"`
+	ToolName  string  `json:"tool_name"`
+	Up        int64   `json:"up"`
+	Down      int64   `json:"down"`
+	Score     float64 `json:"score"` // 好评占比, 0~1
+}
+
+var ToolFeedbackDB *thing.Thing[*ToolFeedback]
+
+// ToolFeedbackInit initializes the ToolFeedbackDB
+func ToolFeedbackInit() error {
+	var err error
+	ToolFeedbackDB, err = thing.Use[*ToolFeedback]()
+	if err != nil {
+		return fmt.Errorf("failed to initialize ToolFeedbackDB: %w", err)
+	}
+	return nil
+}
+
+// SaveToolFeedback 保存反馈；同一用户对同一 request_id 的重复提交会覆盖之前的评分
+func SaveToolFeedback(feedback *ToolFeedback) error {
+	if feedback.RequestID != "" {
+		existing, err := ToolFeedbackDB.Where("user_id = ? AND request_id = ?", feedback.UserID, feedback.RequestID).All()
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			record := existing[0]
+			record.ServiceID = feedback.ServiceID
+			record.ToolName = feedback.ToolName
+			record.Useful = feedback.Useful
+			if err := ToolFeedbackDB.Save(record); err != nil {
+				return err
+			}
+			*feedback = *record
+			return nil
+		}
+	}
+	return ToolFeedbackDB.Save(feedback)
+}
+
+// GetToolFeedbackSummaries 聚合反馈, serviceID 为 0 时返回所有服务; 结果按好评数降序排列。
+// 聚合在 SQL 中通过 GROUP BY 完成，避免把整张反馈表加载到内存
+func GetToolFeedbackSummaries(serviceID int64) ([]ToolFeedbackSummary, error) {
+	query := `SELECT service_id, tool_name,
+		SUM(CASE WHEN useful THEN 1 ELSE 0 END) AS up,
+		SUM(CASE WHEN useful THEN 0 ELSE 1 END) AS down
+		FROM tool_feedbacks WHERE deleted = ?`
+	args := []interface{}{false}
+	if serviceID > 0 {
+		query += " AND service_id = ?"
+		args = append(args, serviceID)
+	}
+	query += " GROUP BY service_id, tool_name ORDER BY up DESC, service_id ASC, tool_name ASC"
+
+	rows, err := ToolFeedbackDB.DB().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []ToolFeedbackSummary{}
+	for rows.Next() {
+		var summary ToolFeedbackSummary
+		if err := rows.Scan(&summary.ServiceID, &summary.ToolName, &summary.Up, &summary.Down); err != nil {
+			return nil, err
+		}
+		summary.Score = float64(summary.Up) / float64(summary.Up+summary.Down)
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
@@ -1,10 +1,13 @@
 package model
 
 import (
+	"context"
 	"errors" // Added for logging
+	"fmt"
 	"one-mcp/backend/common"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/burugo/thing"
 	"github.com/google/uuid"
@@ -26,6 +29,11 @@ type User struct {
 	WeChatId         string `json:"wechat_id" db:"wechat_id"`
 	VerificationCode string `json:"verification_code" db:"-"`
 	Token            string `json:"token" db:"token"`
+	EnvProfile       string `json:"env_profile" db:"env_profile,default:''"` // 使用该用户 token 访问代理时默认选择的环境变量 profile
+	// TokenID 是代理访问令牌的稳定标识，随令牌生成、令牌轮换后保持不变，按令牌计数的限额以它为键
+	TokenID string `json:"-" db:"token_id,default:''"`
+	// MustChangePassword 为 true 时用户仍在使用系统生成的默认密码，登录后需要先修改密码
+	MustChangePassword bool `json:"must_change_password" db:"must_change_password"`
 
 	// Fields from example, consider if needed later:
 	// LarkId           string `json:"lark_id" gorm:"column:lark_id;index"`
@@ -119,13 +127,90 @@ func (user *User) Insert() error {
 	}
 
 	// Generate token if not already set
-	if user.Token == "" {
+	if user.Token == "" && common.GetAutoGenerateUserToken() {
 		user.Token = GenerateUserToken()
 	}
+	if user.Token != "" && user.TokenID == "" {
+		user.TokenID = common.GetUUID()
+	}
 
 	return UserDB.Save(user)
 }
 
+// EnsureToken generates and saves a proxy access token if the user does not have one yet
+func (user *User) EnsureToken() error {
+	if user.Token != "" {
+		return nil
+	}
+	token := GenerateUserToken()
+	if token == "" {
+		return errors.New("failed_to_generate_token")
+	}
+	user.Token = token
+	if user.TokenID == "" {
+		user.TokenID = common.GetUUID()
+	}
+	return UserDB.Save(user)
+}
+
+// rotatedTokenTTL 轮换后旧令牌被记住的时长，期间使用旧令牌的请求会得到明确的错误而不是退化为匿名访问
+const rotatedTokenTTL = 24 * time.Hour
+
+func rotatedTokenKey(token string) string {
+	return "token:rotated:" + common.TokenID(token)
+}
+
+// RotateToken replaces the user's proxy token with a new unique one and remembers the old token as rotated.
+// The token keeps its TokenID, so quotas counted per token carry over to the new value.
+func (user *User) RotateToken() (string, error) {
+	oldToken, oldTokenID := user.Token, user.TokenID
+	token := GenerateUserToken()
+	if token == "" {
+		return "", errors.New("failed_to_generate_token")
+	}
+	user.Token = token
+	if user.TokenID == "" {
+		user.TokenID = common.GetUUID()
+	}
+	if err := UserDB.Save(user); err != nil {
+		user.Token, user.TokenID = oldToken, oldTokenID
+		return "", err
+	}
+	if oldToken != "" {
+		if cacheClient := thing.Cache(); cacheClient != nil {
+			if err := cacheClient.Set(context.Background(), rotatedTokenKey(oldToken), strconv.FormatInt(user.ID, 10), rotatedTokenTTL); err != nil {
+				common.SysError("Failed to remember rotated token: " + err.Error())
+			}
+		}
+	}
+	return token, nil
+}
+
+// IsRotatedToken reports whether token was replaced by RotateToken within rotatedTokenTTL
+func IsRotatedToken(token string) bool {
+	cacheClient := thing.Cache()
+	if token == "" || cacheClient == nil {
+		return false
+	}
+	value, err := cacheClient.Get(context.Background(), rotatedTokenKey(token))
+	return err == nil && value != ""
+}
+
+// BackfillUserTokenIDs gives existing tokens created before TokenID existed their identity
+func BackfillUserTokenIDs() error {
+	users, err := UserDB.Where("token <> ? AND token_id = ?", "", "").All()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		user.TokenID = common.GetUUID()
+		if err := UserDB.Save(user); err != nil {
+			return fmt.Errorf("failed to backfill token id of user %d: %w", user.ID, err)
+		}
+	}
+	return nil
+}
+
 // GenerateUserToken creates a new UUID token without dashes and ensures its uniqueness
 func GenerateUserToken() string {
 	for {
@@ -153,6 +238,7 @@ func (user *User) Update(updatePassword bool) error {
 		if err != nil {
 			return err
 		}
+		user.MustChangePassword = false
 	}
 	return UserDB.Save(user)
 }
@@ -3,6 +3,8 @@ package model
 import (
 	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 
 	"one-mcp/backend/common"
 
@@ -16,6 +18,29 @@ type UserConfig struct {
 	ServiceID int64  `db:"service_id,index:idx_user_config"`
 	ConfigID  int64  `db:"config_id,index:idx_user_config"`
 	Value     string `db:"value"`
+	// ProfileName 为空表示默认 profile；命名 profile 的值在默认 profile 之上合并
+	ProfileName string `db:"profile_name,default:''"`
+}
+
+// DefaultEnvProfile is the profile used when no profile is selected
+const DefaultEnvProfile = ""
+
+// maxEnvProfileNameLength 限制 profile 名称长度（名称会出现在实例缓存 key 中）
+const maxEnvProfileNameLength = 64
+
+var envProfileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// NormalizeEnvProfileName trims a profile name and reports whether it is valid.
+// An empty name is valid and selects the default profile.
+func NormalizeEnvProfileName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return DefaultEnvProfile, true
+	}
+	if len(name) > maxEnvProfileNameLength || !envProfileNamePattern.MatchString(name) {
+		return "", false
+	}
+	return name, true
 }
 
 // TableName sets the table name for the UserConfig model
@@ -40,14 +65,14 @@ func GetUserConfigsForUser(userID int64) ([]*UserConfig, error) {
 	return UserConfigDB.Where("user_id = ?", userID).All()
 }
 
-// GetUserConfigsForService returns all config values for a specific user and service
+// GetUserConfigsForService returns the default-profile config values for a specific user and service
 func GetUserConfigsForService(userID, serviceID int64) ([]*UserConfig, error) {
-	return UserConfigDB.Where("user_id = ? AND service_id = ?", userID, serviceID).All()
+	return UserConfigDB.Where("user_id = ? AND service_id = ? AND profile_name = ?", userID, serviceID, DefaultEnvProfile).All()
 }
 
-// GetUserConfigValue returns a specific config value for a user
+// GetUserConfigValue returns a specific default-profile config value for a user
 func GetUserConfigValue(userID, configID int64) (*UserConfig, error) {
-	configs, err := UserConfigDB.Where("user_id = ? AND config_id = ?", userID, configID).Fetch(0, 1)
+	configs, err := UserConfigDB.Where("user_id = ? AND config_id = ? AND profile_name = ?", userID, configID, DefaultEnvProfile).Fetch(0, 1)
 	if err != nil {
 		return nil, err
 	}
@@ -57,10 +82,10 @@ func GetUserConfigValue(userID, configID int64) (*UserConfig, error) {
 	return configs[0], nil
 }
 
-// SaveUserConfig creates or updates a user config value
+// SaveUserConfig creates or updates a user config value within its profile
 func SaveUserConfig(config *UserConfig) error {
 	// Check if record exists
-	existingConfigs, err := UserConfigDB.Where("user_id = ? AND config_id = ?", config.UserID, config.ConfigID).Fetch(0, 1)
+	existingConfigs, err := UserConfigDB.Where("user_id = ? AND config_id = ? AND profile_name = ?", config.UserID, config.ConfigID, config.ProfileName).Fetch(0, 1)
 	if err != nil {
 		return err
 	}
@@ -76,6 +101,52 @@ func SaveUserConfig(config *UserConfig) error {
 	return UserConfigDB.Save(config)
 }
 
+// SaveUserConfigs saves several config values as one unit: when a save fails, the values written before it
+// are restored (or removed if they were new) so the user's configuration is left as it was.
+func SaveUserConfigs(configs []*UserConfig) error {
+	type savedConfig struct {
+		config   *UserConfig
+		created  bool
+		oldValue string
+	}
+	saved := make([]savedConfig, 0, len(configs))
+	rollback := func() {
+		for i := len(saved) - 1; i >= 0; i-- {
+			entry := saved[i]
+			var err error
+			if entry.created {
+				err = UserConfigDB.Delete(entry.config)
+			} else {
+				entry.config.Value = entry.oldValue
+				err = UserConfigDB.Save(entry.config)
+			}
+			if err != nil {
+				common.SysError(fmt.Sprintf("Failed to roll back user config %d of user %d: %v", entry.config.ConfigID, entry.config.UserID, err))
+			}
+		}
+	}
+
+	for _, config := range configs {
+		existingConfigs, err := UserConfigDB.Where("user_id = ? AND config_id = ? AND profile_name = ?", config.UserID, config.ConfigID, config.ProfileName).Fetch(0, 1)
+		if err != nil {
+			rollback()
+			return err
+		}
+		entry := savedConfig{config: config, created: true}
+		if len(existingConfigs) > 0 {
+			existing := existingConfigs[0]
+			entry = savedConfig{config: existing, oldValue: existing.Value}
+			existing.Value = config.Value
+		}
+		if err := UserConfigDB.Save(entry.config); err != nil {
+			rollback()
+			return err
+		}
+		saved = append(saved, entry)
+	}
+	return nil
+}
+
 // DeleteUserConfig deletes a specific user config
 func DeleteUserConfig(userID, configID int64) error {
 	configs, err := UserConfigDB.Where("user_id = ? AND config_id = ?", userID, configID).All()
@@ -108,6 +179,22 @@ func DeleteUserConfigsForService(userID, serviceID int64) error {
 	return nil
 }
 
+// DeleteUserConfigsForUser deletes all of a user's configs across services (used when the user is deleted)
+func DeleteUserConfigsForUser(userID int64) error {
+	configs, err := UserConfigDB.Where("user_id = ?", userID).All()
+	if err != nil {
+		return err
+	}
+
+	for _, config := range configs {
+		if err := UserConfigDB.Delete(config); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetUserConfigsWithDetails returns user configs with service and config details
 func GetUserConfigsWithDetails(userID int64) ([]map[string]interface{}, error) {
 	configs, err := UserConfigDB.Where("user_id = ?", userID).All()
@@ -145,14 +232,21 @@ func GetUserConfigsWithDetails(userID int64) ([]map[string]interface{}, error) {
 }
 
 // GetUserSpecificEnvs retrieves a map of environment variable key-value pairs
-// for a specific user and service.
-// It joins UserConfig with ConfigService to get the actual ENV variable names (keys).
+// for a specific user and service, using the default profile.
 func GetUserSpecificEnvs(userID int64, mcpServiceID int64) (map[string]string, error) {
+	return GetUserProfileEnvs(userID, mcpServiceID, DefaultEnvProfile)
+}
+
+// GetUserProfileEnvs retrieves the user's environment variables for a service and profile.
+// Values of the default profile are applied first and the named profile overrides them,
+// so a profile only needs to store the variables that differ.
+// It joins UserConfig with ConfigService to get the actual ENV variable names (keys).
+func GetUserProfileEnvs(userID int64, mcpServiceID int64, profileName string) (map[string]string, error) {
 	if UserConfigDB == nil || ConfigServiceDB == nil {
 		return nil, errors.New("database connections not initialized for UserConfigDB or ConfigServiceDB")
 	}
 
-	userConfigs, err := UserConfigDB.Where("user_id = ? AND service_id = ?", userID, mcpServiceID).All()
+	userConfigs, err := UserConfigDB.Where("user_id = ? AND service_id = ? AND profile_name IN (?, ?)", userID, mcpServiceID, DefaultEnvProfile, profileName).All()
 	if err != nil {
 		return nil, fmt.Errorf("error fetching user configs for user %d, service %d: %w", userID, mcpServiceID, err)
 	}
@@ -162,14 +256,10 @@ func GetUserSpecificEnvs(userID int64, mcpServiceID int64) (map[string]string, e
 	}
 
 	envMap := make(map[string]string)
+	profileValues := make(map[string]string)
 	for _, uc := range userConfigs {
 		// Fetch the ConfigService entry to get the Key (ENV variable name)
 		// UserConfig.ConfigID links to ConfigService.ID
-		// ConfigService.ServiceID links this key definition to an MCPService.
-		// We are querying UserConfig by mcpServiceID, so the ConfigID should theoretically
-		// point to a ConfigService that is also relevant to this mcpServiceID.
-		// An additional check could be configService.ServiceID == mcpServiceID, but it might be overly restrictive
-		// if a ConfigID can be global or reused. The direct link UserConfig.ConfigID -> ConfigService.ID is primary.
 		configService, err := ConfigServiceDB.ByID(uc.ConfigID)
 		if err != nil {
 			// Log this error, but continue processing other configs.
@@ -183,7 +273,14 @@ func GetUserSpecificEnvs(userID int64, mcpServiceID int64) (map[string]string, e
 			common.SysLog(fmt.Sprintf("WARN: ConfigService with ID %d (for UserConfig ID %d) has an empty Key. Skipping this entry.", configService.ID, uc.ID))
 			continue
 		}
-		envMap[configService.Key] = uc.Value
+		if uc.ProfileName == DefaultEnvProfile {
+			envMap[configService.Key] = uc.Value
+		} else {
+			profileValues[configService.Key] = uc.Value
+		}
+	}
+	for key, value := range profileValues {
+		envMap[key] = value
 	}
 
 	return envMap, nil
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"one-mcp/backend/common"
+)
+
+// pendingWrite is a stat or log row whose database write failed and is waiting to be retried.
+type pendingWrite struct {
+	kind     string
+	save     func() error
+	attempts int
+	nextAt   time.Time
+}
+
+var (
+	writeRetryMu      sync.Mutex
+	writeRetryPending []*pendingWrite
+	writeRetryWake    = make(chan struct{}, 1)
+	writeRetryStart   sync.Once
+	droppedWrites     atomic.Int64
+
+	// Mockable in tests
+	writeRetryBaseBackoff = time.Second
+	writeRetryMaxBackoff  = time.Minute
+)
+
+// DroppedWriteCount returns the number of stat and log writes given up on since startup, either because the
+// retry queue was full or because every retry failed.
+func DroppedWriteCount() int64 {
+	return droppedWrites.Load()
+}
+
+// PendingWriteCount returns the number of failed writes currently waiting to be retried.
+func PendingWriteCount() int {
+	writeRetryMu.Lock()
+	defer writeRetryMu.Unlock()
+	return len(writeRetryPending)
+}
+
+// enqueueFailedWrite queues save to be retried in the background after a failed write. It never blocks: when
+// the queue is full (or disabled by WriteRetryQueueSize=0) the write is dropped and false is returned.
+func enqueueFailedWrite(kind string, save func() error) bool {
+	queueSize, _ := common.GetWriteRetryConfig()
+	writeRetryMu.Lock()
+	if len(writeRetryPending) >= queueSize {
+		writeRetryMu.Unlock()
+		dropped := droppedWrites.Add(1)
+		common.SysError(fmt.Sprintf("[WriteRetry] retry queue full, dropping failed %s write (%d dropped so far)", kind, dropped))
+		return false
+	}
+	writeRetryPending = append(writeRetryPending, &pendingWrite{
+		kind:     kind,
+		save:     save,
+		attempts: 1,
+		nextAt:   time.Now().Add(writeRetryBaseBackoff),
+	})
+	writeRetryMu.Unlock()
+
+	writeRetryStart.Do(func() { go runWriteRetries() })
+	select {
+	case writeRetryWake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// runWriteRetries retries the queued writes as they become due, sleeping until the next one or a new enqueue.
+func runWriteRetries() {
+	for {
+		wait := retryDueWrites(time.Now())
+		timer := time.NewTimer(wait)
+		select {
+		case <-writeRetryWake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// retryDueWrites retries every queued write whose backoff elapsed at now. Writes that fail again are requeued
+// with a doubled backoff until WriteRetryMaxAttempts is reached, after which they are dropped. It returns how
+// long to wait before the next write is due.
+func retryDueWrites(now time.Time) time.Duration {
+	writeRetryMu.Lock()
+	var due []*pendingWrite
+	remaining := writeRetryPending[:0]
+	for _, write := range writeRetryPending {
+		if now.Before(write.nextAt) {
+			remaining = append(remaining, write)
+		} else {
+			due = append(due, write)
+		}
+	}
+	writeRetryPending = remaining
+	writeRetryMu.Unlock()
+
+	// The saves run without the lock so enqueueFailedWrite never waits on the database
+	_, maxAttempts := common.GetWriteRetryConfig()
+	var failed []*pendingWrite
+	for _, write := range due {
+		err := write.save()
+		if err == nil {
+			continue
+		}
+		write.attempts++
+		if write.attempts >= maxAttempts {
+			dropped := droppedWrites.Add(1)
+			common.SysError(fmt.Sprintf("[WriteRetry] giving up on %s write after %d attempts (%d dropped so far): %v", write.kind, maxAttempts, dropped, err))
+			continue
+		}
+		backoff := writeRetryBaseBackoff << (write.attempts - 1)
+		if backoff <= 0 || backoff > writeRetryMaxBackoff {
+			backoff = writeRetryMaxBackoff
+		}
+		write.nextAt = time.Now().Add(backoff)
+		failed = append(failed, write)
+	}
+
+	writeRetryMu.Lock()
+	defer writeRetryMu.Unlock()
+	writeRetryPending = append(writeRetryPending, failed...)
+	wait := writeRetryMaxBackoff
+	for _, write := range writeRetryPending {
+		if until := time.Until(write.nextAt); until < wait {
+			wait = until
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
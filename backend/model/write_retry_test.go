@@ -0,0 +1,122 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/burugo/thing"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupWriteRetryTest(t *testing.T, options map[string]string) {
+	originalSQLitePath := common.SQLitePath
+	originalBase, originalMax := writeRetryBaseBackoff, writeRetryMaxBackoff
+	common.SQLitePath = filepath.Join(t.TempDir(), "write_retry_test.db")
+	writeRetryBaseBackoff, writeRetryMaxBackoff = 5*time.Millisecond, 20*time.Millisecond
+	assert.NoError(t, InitDB())
+
+	common.OptionMapRWMutex.Lock()
+	originals := map[string]string{}
+	for key, value := range options {
+		originals[key] = common.OptionMap[key]
+		common.OptionMap[key] = value
+	}
+	common.OptionMapRWMutex.Unlock()
+
+	t.Cleanup(func() {
+		assert.Eventually(t, func() bool { return PendingWriteCount() == 0 }, time.Second, 5*time.Millisecond)
+		common.OptionMapRWMutex.Lock()
+		for key, value := range originals {
+			common.OptionMap[key] = value
+		}
+		common.OptionMapRWMutex.Unlock()
+		common.SQLitePath = originalSQLitePath
+		writeRetryBaseBackoff, writeRetryMaxBackoff = originalBase, originalMax
+	})
+}
+
+// failingFirst fails the first n calls with a transient error before delegating to save
+func failingFirst[T any](n int32, calls *atomic.Int32, save func(T) error) func(T) error {
+	return func(row T) error {
+		if calls.Add(1) <= n {
+			return errors.New("database is locked")
+		}
+		return save(row)
+	}
+}
+
+func TestSaveMCPLogRetriesTransientFailures(t *testing.T) {
+	setupWriteRetryTest(t, nil)
+	var calls atomic.Int32
+	original := createMCPLogRow
+	createMCPLogRow = func(db *thing.Thing[*MCPLog], log *MCPLog) error {
+		return failingFirst(3, &calls, db.Save)(log)
+	}
+	defer func() { createMCPLogRow = original }()
+
+	err := SaveMCPLog(context.Background(), 985001, "retry-svc", MCPLogPhaseRun, MCPLogLevelError, "upstream crashed")
+	assert.NoError(t, err, "a queued write is not reported as failed")
+
+	assert.Eventually(t, func() bool {
+		logs, err := MCPLogDB.Where("service_id = ?", 985001).Fetch(0, 10)
+		return err == nil && len(logs) == 1
+	}, time.Second, 5*time.Millisecond)
+	logs, _ := MCPLogDB.Where("service_id = ?", 985001).Fetch(0, 10)
+	assert.Equal(t, "upstream crashed", logs[0].Message)
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestRecordRequestStatRetriesTransientFailures(t *testing.T) {
+	setupWriteRetryTest(t, nil)
+	var calls atomic.Int32
+	original := saveProxyRequestStat
+	saveProxyRequestStat = func(statThing *thing.Thing[*ProxyRequestStat], stat *ProxyRequestStat) error {
+		return failingFirst(2, &calls, statThing.Save)(stat)
+	}
+	defer func() { saveProxyRequestStat = original }()
+
+	RecordRequestStat(985002, "retry-svc", 7, "", ProxyRequestTypeHTTP, "tools/call", "/proxy/retry-svc/mcp", 12, 500, false)
+
+	statThing, err := GetProxyRequestStatThing()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		stats, err := statThing.Where("service_id = ?", 985002).Fetch(0, 10)
+		return err == nil && len(stats) == 1
+	}, time.Second, 5*time.Millisecond)
+	stats, _ := statThing.Where("service_id = ?", 985002).Fetch(0, 10)
+	assert.Equal(t, int64(7), stats[0].UserID)
+	assert.Equal(t, "tools/call", stats[0].Method)
+}
+
+func TestWriteRetryQueueOverflowDropsWrites(t *testing.T) {
+	setupWriteRetryTest(t, map[string]string{
+		common.OptionWriteRetryQueueSize:   "1",
+		common.OptionWriteRetryMaxAttempts: "3",
+	})
+	var calls atomic.Int32
+	original := createMCPLogRow
+	createMCPLogRow = func(*thing.Thing[*MCPLog], *MCPLog) error {
+		calls.Add(1)
+		return errors.New("disk full")
+	}
+	defer func() { createMCPLogRow = original }()
+
+	dropped := DroppedWriteCount()
+	start := time.Now()
+	assert.NoError(t, SaveMCPLog(context.Background(), 985003, "retry-svc", MCPLogPhaseRun, MCPLogLevelWarn, "first"))
+	// The queue holds one write, the next failure is dropped instead of blocking the caller
+	assert.Error(t, SaveMCPLog(context.Background(), 985003, "retry-svc", MCPLogPhaseRun, MCPLogLevelWarn, "second"))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, dropped+1, DroppedWriteCount())
+
+	// The queued write is given up on once every attempt failed
+	assert.Eventually(t, func() bool { return DroppedWriteCount() == dropped+2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(4), calls.Load(), "two initial writes plus two retries of the queued one")
+	assert.Equal(t, 0, PendingWriteCount())
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+)
+
+// ServiceDefinition 是服务配置目录中单个服务的声明，字段与 mcpServers 客户端配置保持一致
+type ServiceDefinition struct {
+	Name              string            `json:"name"`
+	DisplayName       string            `json:"display_name"`
+	Description       string            `json:"description"`
+	Type              string            `json:"type"` // stdio, sse, streamable_http；为空时按 command/url 推断
+	Command           string            `json:"command"`
+	Args              []string          `json:"args"`
+	Env               map[string]string `json:"env"`
+	URL               string            `json:"url"`
+	Headers           map[string]string `json:"headers"`
+	Enabled           *bool             `json:"enabled"`
+	AllowUserOverride bool              `json:"allow_user_override"`
+	RPDLimit          int               `json:"rpd_limit"`
+}
+
+// serviceDefinitionFile 支持 {"mcpServers": {...}} 形式，也支持单个带 name 的服务定义
+type serviceDefinitionFile struct {
+	MCPServers map[string]ServiceDefinition `json:"mcpServers"`
+}
+
+// ServiceConfigSyncResult 记录一次目录同步对数据库的改动，用于随后更新 ServiceManager
+type ServiceConfigSyncResult struct {
+	Created   []int64
+	Updated   []int64
+	Unchanged []int64
+	Removed   []int64
+	Skipped   []string // 名称与 API 创建的服务冲突或定义无效
+}
+
+// LoadServiceDefinitions 读取目录下所有 *.json 文件，返回 文件名 -> 服务定义 列表（按名称排序）。
+// 目录不存在或不是目录时返回错误，而不是当作没有任何定义
+func LoadServiceDefinitions(dir string) (map[string][]ServiceDefinition, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("service config dir: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("service config dir %s is not a directory", dir)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	result := make(map[string][]ServiceDefinition, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		var file serviceDefinitionFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+
+		var defs []ServiceDefinition
+		// {"mcpServers": {}} 是合法的空声明，可用于有意删除全部文件托管服务
+		if file.MCPServers != nil {
+			for name, def := range file.MCPServers {
+				if def.Name == "" {
+					def.Name = name
+				}
+				defs = append(defs, def)
+			}
+		} else {
+			var def ServiceDefinition
+			if err := json.Unmarshal(data, &def); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+			if def.Name == "" {
+				return nil, fmt.Errorf("parse %s: missing \"name\" or \"mcpServers\"", path)
+			}
+			defs = append(defs, def)
+		}
+		sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+		result[filepath.Base(path)] = defs
+	}
+	return result, nil
+}
+
+// applyServiceDefinition 将定义写入 svc，返回是否有字段发生变化
+func applyServiceDefinition(svc *model.MCPService, def ServiceDefinition, fileName string) (bool, error) {
+	serviceType := model.ServiceType(def.Type)
+	switch def.Type {
+	case "":
+		if def.URL != "" {
+			serviceType = model.ServiceTypeStreamableHTTP
+		} else {
+			serviceType = model.ServiceTypeStdio
+		}
+	case "streamableHttp", "http":
+		serviceType = model.ServiceTypeStreamableHTTP
+	}
+
+	command, argsJSON, headersJSON := def.Command, "[]", "{}"
+	switch serviceType {
+	case model.ServiceTypeStdio:
+		if def.Command == "" {
+			return false, errors.New("missing 'command' for stdio service")
+		}
+		if len(def.Args) > 0 {
+			data, _ := json.Marshal(def.Args)
+			argsJSON = string(data)
+		}
+	case model.ServiceTypeSSE, model.ServiceTypeStreamableHTTP:
+		if def.URL == "" {
+			return false, errors.New("missing 'url' for web service")
+		}
+		command = def.URL // URL is stored in Command for web services
+		if len(def.Headers) > 0 {
+			data, _ := json.Marshal(def.Headers)
+			headersJSON = string(data)
+		}
+	default:
+		return false, fmt.Errorf("unsupported service type: %s", def.Type)
+	}
+
+	envsJSON := "{}"
+	if len(def.Env) > 0 {
+		data, _ := json.Marshal(def.Env)
+		envsJSON = string(data)
+	}
+	displayName := def.DisplayName
+	if displayName == "" {
+		displayName = def.Name
+	}
+	enabled := def.Enabled == nil || *def.Enabled
+
+	before := *svc
+	svc.Name = def.Name
+	svc.DisplayName = displayName
+	svc.Description = def.Description
+	svc.Type = serviceType
+	svc.Command = command
+	svc.ArgsJSON = argsJSON
+	svc.HeadersJSON = headersJSON
+	svc.DefaultEnvsJSON = envsJSON
+	svc.Enabled = enabled
+	svc.DefaultOn = enabled
+	svc.AllowUserOverride = def.AllowUserOverride
+	svc.RPDLimit = def.RPDLimit
+	svc.ConfigFile = fileName
+	if svc.Category == "" {
+		svc.Category = model.CategoryUtil
+	}
+	if svc.PackageManager == "" {
+		svc.PackageManager = "custom"
+	}
+
+	changed := before.Name != svc.Name || before.DisplayName != svc.DisplayName || before.Description != svc.Description ||
+		before.Type != svc.Type || before.Command != svc.Command || before.ArgsJSON != svc.ArgsJSON ||
+		before.HeadersJSON != svc.HeadersJSON || before.DefaultEnvsJSON != svc.DefaultEnvsJSON ||
+		before.Enabled != svc.Enabled || before.DefaultOn != svc.DefaultOn || before.AllowUserOverride != svc.AllowUserOverride ||
+		before.RPDLimit != svc.RPDLimit || before.ConfigFile != svc.ConfigFile
+	return changed, nil
+}
+
+// SyncServiceConfigDir 将目录中的服务定义同步到数据库：新增、更新，并删除文件中已不存在的文件托管服务。
+// 与通过 API 创建的同名服务冲突时跳过该定义，不会接管已有服务。
+// 目录中没有任何定义文件时不删除服务：空目录多半是卷尚未挂载，而不是要删除所有服务。
+func SyncServiceConfigDir(dir string) (*ServiceConfigSyncResult, error) {
+	definitions, err := LoadServiceDefinitions(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ServiceConfigSyncResult{}
+	declared := make(map[string]bool)
+	fileNames := make([]string, 0, len(definitions))
+	for fileName := range definitions {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		for _, def := range definitions[fileName] {
+			def.Name = strings.TrimSpace(def.Name)
+			if def.Name == "" || declared[def.Name] {
+				common.SysError(fmt.Sprintf("[ServiceConfigDir] Skipping empty or duplicate service name %q in %s", def.Name, fileName))
+				result.Skipped = append(result.Skipped, def.Name)
+				continue
+			}
+
+			svc, lookupErr := model.GetServiceByName(def.Name)
+			isNew := lookupErr != nil || svc == nil
+			if isNew {
+				svc = &model.MCPService{}
+			} else if !svc.IsFileManaged() {
+				common.SysError(fmt.Sprintf("[ServiceConfigDir] Service %q in %s conflicts with a service managed via the API, skipping", def.Name, fileName))
+				result.Skipped = append(result.Skipped, def.Name)
+				continue
+			}
+			declared[def.Name] = true
+
+			changed, err := applyServiceDefinition(svc, def, fileName)
+			if err != nil {
+				common.SysError(fmt.Sprintf("[ServiceConfigDir] Invalid definition %q in %s: %v", def.Name, fileName, err))
+				result.Skipped = append(result.Skipped, def.Name)
+				continue
+			}
+
+			switch {
+			case isNew:
+				if err := model.CreateService(svc); err != nil {
+					return result, fmt.Errorf("create service %s: %w", def.Name, err)
+				}
+				result.Created = append(result.Created, svc.ID)
+			case changed:
+				if err := model.UpdateService(svc); err != nil {
+					return result, fmt.Errorf("update service %s: %w", def.Name, err)
+				}
+				result.Updated = append(result.Updated, svc.ID)
+			default:
+				result.Unchanged = append(result.Unchanged, svc.ID)
+			}
+		}
+	}
+
+	managed, err := model.GetFileManagedServices()
+	if err != nil {
+		return result, err
+	}
+	if len(definitions) == 0 && len(managed) > 0 {
+		common.SysError(fmt.Sprintf("[ServiceConfigDir] No service definition files found in %s, keeping %d file-managed services; "+
+			"add a file with an empty \"mcpServers\" object to remove them", dir, len(managed)))
+		managed = nil
+	}
+	for _, svc := range managed {
+		if declared[svc.Name] {
+			continue
+		}
+		if err := model.DeleteService(svc.ID); err != nil {
+			return result, fmt.Errorf("remove service %s: %w", svc.Name, err)
+		}
+		result.Removed = append(result.Removed, svc.ID)
+	}
+
+	common.SysLog(fmt.Sprintf("[ServiceConfigDir] Synced %s: %d created, %d updated, %d unchanged, %d removed, %d skipped",
+		dir, len(result.Created), len(result.Updated), len(result.Unchanged), len(result.Removed), len(result.Skipped)))
+	return result, nil
+}
+
+// ReloadServiceConfigDir 重新同步目录，并让 ServiceManager 中已注册的服务与数据库保持一致（用于 SIGHUP）
+func ReloadServiceConfigDir(ctx context.Context, dir string) error {
+	result, err := SyncServiceConfigDir(dir)
+	if err != nil {
+		return err
+	}
+
+	serviceManager := proxy.GetServiceManager()
+	for _, id := range result.Removed {
+		if err := serviceManager.UnregisterService(ctx, id); err != nil && !errors.Is(err, proxy.ErrServiceNotFound) {
+			common.SysError(fmt.Sprintf("[ServiceConfigDir] Failed to unregister removed service %d: %v", id, err))
+		}
+	}
+	for _, id := range append(append([]int64{}, result.Updated...), result.Created...) {
+		if err := serviceManager.UnregisterService(ctx, id); err != nil && !errors.Is(err, proxy.ErrServiceNotFound) {
+			common.SysError(fmt.Sprintf("[ServiceConfigDir] Failed to unregister service %d before reload: %v", id, err))
+		}
+		svc, err := model.GetServiceByID(id)
+		if err != nil || !svc.Enabled {
+			continue
+		}
+		if err := serviceManager.RegisterService(ctx, svc); err != nil {
+			common.SysError(fmt.Sprintf("[ServiceConfigDir] Failed to register service %s: %v", svc.Name, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupServiceConfigTestDB(t *testing.T) {
+	t.Helper()
+	originalSQLitePath := common.SQLitePath
+	common.SQLitePath = filepath.Join(t.TempDir(), "service_config_test.db")
+	assert.NoError(t, model.InitDB())
+	t.Cleanup(func() { common.SQLitePath = originalSQLitePath })
+}
+
+func writeServiceConfig(t *testing.T, dir, name, content string) {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestSyncServiceConfigDir(t *testing.T) {
+	setupServiceConfigTestDB(t)
+	dir := t.TempDir()
+
+	// 已通过 API 创建的同名服务不会被配置文件接管
+	apiService := &model.MCPService{Name: "api-owned", DisplayName: "API Owned", Type: model.ServiceTypeStdio, Command: "original"}
+	assert.NoError(t, model.CreateService(apiService))
+
+	writeServiceConfig(t, dir, "clients.json", `{
+		"mcpServers": {
+			"fetch": {"command": "uvx", "args": ["mcp-server-fetch"], "env": {"TIMEOUT": "30"}},
+			"remote": {"type": "streamableHttp", "url": "https://example.com/mcp", "headers": {"Authorization": "Bearer x"}},
+			"api-owned": {"command": "hijack"}
+		}
+	}`)
+	writeServiceConfig(t, dir, "single.json", `{"name": "single", "display_name": "Single", "type": "sse", "url": "https://example.com/sse", "enabled": false}`)
+	writeServiceConfig(t, dir, "ignored.txt", `not json`)
+
+	result, err := SyncServiceConfigDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, result.Created, 3)
+	assert.Equal(t, []string{"api-owned"}, result.Skipped)
+
+	tests := []struct {
+		name        string
+		wantType    model.ServiceType
+		wantCommand string
+		wantArgs    string
+		wantEnvs    string
+		wantHeaders string
+		wantEnabled bool
+		wantFile    string
+	}{
+		{"fetch", model.ServiceTypeStdio, "uvx", `["mcp-server-fetch"]`, `{"TIMEOUT":"30"}`, "{}", true, "clients.json"},
+		{"remote", model.ServiceTypeStreamableHTTP, "https://example.com/mcp", "[]", "{}", `{"Authorization":"Bearer x"}`, true, "clients.json"},
+		{"single", model.ServiceTypeSSE, "https://example.com/sse", "[]", "{}", "{}", false, "single.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := model.GetServiceByName(tt.name)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantType, svc.Type)
+			assert.Equal(t, tt.wantCommand, svc.Command)
+			assert.Equal(t, tt.wantArgs, svc.ArgsJSON)
+			assert.Equal(t, tt.wantEnvs, svc.DefaultEnvsJSON)
+			assert.Equal(t, tt.wantHeaders, svc.HeadersJSON)
+			assert.Equal(t, tt.wantEnabled, svc.Enabled)
+			assert.Equal(t, tt.wantFile, svc.ConfigFile)
+			assert.True(t, svc.IsFileManaged())
+		})
+	}
+
+	apiService, err = model.GetServiceByName("api-owned")
+	assert.NoError(t, err)
+	assert.Equal(t, "original", apiService.Command)
+	assert.False(t, apiService.IsFileManaged())
+
+	// 重新同步：修改的服务被更新，删除文件中的服务被移除，未变化的保持不动
+	writeServiceConfig(t, dir, "clients.json", `{"mcpServers": {"fetch": {"command": "uvx", "args": ["mcp-server-fetch", "--verbose"]}}}`)
+	single, err := model.GetServiceByName("single")
+	assert.NoError(t, err)
+	remote, err := model.GetServiceByName("remote")
+	assert.NoError(t, err)
+
+	result, err = SyncServiceConfigDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Created)
+	assert.Len(t, result.Updated, 1)
+	assert.Equal(t, []int64{single.ID}, result.Unchanged)
+	assert.Equal(t, []int64{remote.ID}, result.Removed)
+
+	fetch, err := model.GetServiceByName("fetch")
+	assert.NoError(t, err)
+	assert.Equal(t, `["mcp-server-fetch","--verbose"]`, fetch.ArgsJSON)
+	assert.Equal(t, "{}", fetch.DefaultEnvsJSON)
+
+	managed, err := model.GetFileManagedServices()
+	assert.NoError(t, err)
+	assert.Len(t, managed, 2)
+}
+
+func TestLoadServiceDefinitionsRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"malformed", `{"mcpServers": `},
+		{"unnamed", `{"command": "npx"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeServiceConfig(t, dir, "svc.json", tt.content)
+			_, err := LoadServiceDefinitions(dir)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSyncServiceConfigDirKeepsServicesWhenDirIsMissingOrEmpty(t *testing.T) {
+	setupServiceConfigTestDB(t)
+	dir := t.TempDir()
+	writeServiceConfig(t, dir, "clients.json", `{"mcpServers": {"mounted-fetch": {"command": "uvx", "args": ["mcp-server-fetch"]}}}`)
+	_, err := SyncServiceConfigDir(dir)
+	assert.NoError(t, err)
+
+	// 目录不存在（如卷未挂载）时同步失败，不删除任何服务
+	_, err = SyncServiceConfigDir(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+	managed, err := model.GetFileManagedServices()
+	assert.NoError(t, err)
+	assert.Len(t, managed, 1)
+
+	// 空目录不删除已有的文件托管服务
+	assert.NoError(t, os.Remove(filepath.Join(dir, "clients.json")))
+	result, err := SyncServiceConfigDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Removed)
+	managed, err = model.GetFileManagedServices()
+	assert.NoError(t, err)
+	assert.Len(t, managed, 1)
+
+	// 显式的空声明才会移除全部文件托管服务
+	writeServiceConfig(t, dir, "clients.json", `{"mcpServers": {}}`)
+	result, err = SyncServiceConfigDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, result.Removed, 1)
+	managed, err = model.GetFileManagedServices()
+	assert.NoError(t, err)
+	assert.Empty(t, managed)
+}
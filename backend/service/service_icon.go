@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+)
+
+// MaxServiceIconSize 单个服务图标允许的最大字节数
+const MaxServiceIconSize = 256 * 1024
+
+// ServiceIconURLPrefix 本地缓存图标的访问路径前缀
+const ServiceIconURLPrefix = "/api/icons/"
+
+// ErrInvalidServiceIcon 表示图标内容不是受支持的图片或超出大小限制
+var ErrInvalidServiceIcon = errors.New("invalid service icon")
+
+// serviceIconHTTPClient 下载远程图标使用的客户端，测试中可替换
+var serviceIconHTTPClient = &http.Client{Timeout: 5 * time.Second}
+
+// serviceIconExtensions 按探测出的内容类型确定文件扩展名。
+// SVG 可携带脚本，且与应用同源提供，因此不缓存，保留原始 URL。
+var serviceIconExtensions = map[string]string{
+	"image/png":                ".png",
+	"image/jpeg":               ".jpg",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+}
+
+var serviceIconFileName = regexp.MustCompile(`^[0-9a-f]{32}\.(png|jpg|gif|webp|ico)$`)
+
+// ServiceIconDir 返回图标缓存目录（数据库文件所在目录下的 icons）
+func ServiceIconDir() string {
+	return filepath.Join(filepath.Dir(common.SQLitePath), "icons")
+}
+
+// ServiceIconPath 返回缓存图标文件的路径；文件名不合法时返回 false
+func ServiceIconPath(fileName string) (string, bool) {
+	if !serviceIconFileName.MatchString(fileName) {
+		return "", false
+	}
+	return filepath.Join(ServiceIconDir(), fileName), true
+}
+
+// SaveServiceIcon 校验图片内容并以内容哈希为文件名保存，返回本地访问 URL
+func SaveServiceIcon(data []byte) (string, error) {
+	if len(data) == 0 || len(data) > MaxServiceIconSize {
+		return "", fmt.Errorf("%w: size must be between 1 and %d bytes", ErrInvalidServiceIcon, MaxServiceIconSize)
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := serviceIconExtensions[contentType]
+	if !ok {
+		return "", fmt.Errorf("%w: unsupported content type %s", ErrInvalidServiceIcon, contentType)
+	}
+
+	sum := sha256.Sum256(data)
+	fileName := hex.EncodeToString(sum[:16]) + ext
+	dir := ServiceIconDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fileName)
+	if _, err := os.Stat(path); err != nil {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return ServiceIconURLPrefix + fileName, nil
+}
+
+// CacheRemoteServiceIcon 下载远程图标并保存到本地缓存，返回本地访问 URL
+func CacheRemoteServiceIcon(ctx context.Context, iconURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iconURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := serviceIconHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("icon download returned status code %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxServiceIconSize+1))
+	if err != nil {
+		return "", err
+	}
+	return SaveServiceIcon(data)
+}
+
+// ResolveServiceIcon 在开启图标缓存时把远程图标替换为本地 URL；未开启、非 http(s) 地址或下载失败时返回原值
+func ResolveServiceIcon(ctx context.Context, iconURL string) string {
+	if !common.GetCacheServiceIcons() {
+		return iconURL
+	}
+	lower := strings.ToLower(iconURL)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return iconURL
+	}
+	localURL, err := CacheRemoteServiceIcon(ctx, iconURL)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("Failed to cache service icon %s, keeping the original URL: %v", iconURL, err))
+		return iconURL
+	}
+	return localURL
+}
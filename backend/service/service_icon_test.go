@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPNG 只需 PNG 文件签名即可被识别为 image/png
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+func TestResolveServiceIcon(t *testing.T) {
+	originalSQLitePath := common.SQLitePath
+	common.SQLitePath = filepath.Join(t.TempDir(), "icons_test.db")
+	defer func() { common.SQLitePath = originalSQLitePath }()
+
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap[common.OptionCacheServiceIcons] = "true"
+	common.OptionMapRWMutex.Unlock()
+	defer func() {
+		common.OptionMapRWMutex.Lock()
+		delete(common.OptionMap, common.OptionCacheServiceIcons)
+		common.OptionMapRWMutex.Unlock()
+	}()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/icon.png":
+			_, _ = w.Write(testPNG)
+		case "/page.html":
+			_, _ = w.Write([]byte("<html><body>not an image</body></html>"))
+		case "/huge.png":
+			_, _ = w.Write(append(testPNG, make([]byte, MaxServiceIconSize)...))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name       string
+		iconURL    string
+		wantCached bool
+	}{
+		{"remote image is cached", upstream.URL + "/icon.png", true},
+		{"non-image keeps original", upstream.URL + "/page.html", false},
+		{"oversized image keeps original", upstream.URL + "/huge.png", false},
+		{"fetch failure keeps original", upstream.URL + "/missing.png", false},
+		{"non-http icon untouched", "data:image/png;base64,AAAA", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResolveServiceIcon(context.Background(), tt.iconURL)
+			if !tt.wantCached {
+				assert.Equal(t, tt.iconURL, got)
+				return
+			}
+			if assert.True(t, strings.HasPrefix(got, ServiceIconURLPrefix), got) {
+				path, ok := ServiceIconPath(strings.TrimPrefix(got, ServiceIconURLPrefix))
+				assert.True(t, ok)
+				data, err := os.ReadFile(path)
+				assert.NoError(t, err)
+				assert.Equal(t, testPNG, data)
+			}
+		})
+	}
+}
+
+func TestServiceIconPathRejectsTraversal(t *testing.T) {
+	for _, name := range []string{"../one-mcp.db", "abc.png", "0123456789abcdef0123456789abcdef.svg"} {
+		_, ok := ServiceIconPath(name)
+		assert.False(t, ok, name)
+	}
+}
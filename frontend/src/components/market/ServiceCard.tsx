@@ -131,8 +131,41 @@ const ServiceCard: React.FC<ServiceCardProps> = ({ service, onSelect, onInstall
     const authorDisplay = getAuthorDisplay();
     const isGithub = !!(service.homepage && service.homepage.includes('github.com')); // Changed homepageUrl to homepage
 
+    // 搜索结果不含 stars，卡片进入可视区域后再按需获取（使用 fetch 以免失败时弹出错误提示）
+    const cardRef = useRef<HTMLDivElement>(null);
+    const [enrichedStars, setEnrichedStars] = useState<number | undefined>(undefined);
+    const stars = typeof service.stars === 'number' ? service.stars : enrichedStars;
+    useEffect(() => {
+        const node = cardRef.current;
+        if (!node || !isGithub || service.source !== 'npm' || typeof service.stars === 'number') {
+            return;
+        }
+        let cancelled = false;
+        const observer = new IntersectionObserver((entries) => {
+            if (!entries.some(entry => entry.isIntersecting)) {
+                return;
+            }
+            observer.disconnect();
+            fetch(`/api/mcp_market/enrich?name=${encodeURIComponent(service.name)}`, {
+                headers: { 'Authorization': `Bearer ${localStorage.getItem('token')}` },
+            })
+                .then(response => response.ok ? response.json() : null)
+                .then(body => {
+                    if (!cancelled && body?.success && typeof body.data?.github_stars === 'number') {
+                        setEnrichedStars(body.data.github_stars);
+                    }
+                })
+                .catch(() => { /* stars are optional */ });
+        });
+        observer.observe(node);
+        return () => {
+            cancelled = true;
+            observer.disconnect();
+        };
+    }, [isGithub, service.name, service.source, service.stars]);
+
     return (
-        <div className="relative bg-card border border-border rounded-lg p-4 flex flex-col h-full shadow-sm hover:shadow-md transition-shadow duration-200 group">
+        <div ref={cardRef} className="relative bg-card border border-border rounded-lg p-4 flex flex-col h-full shadow-sm hover:shadow-md transition-shadow duration-200 group">
             <div className="flex items-start gap-3 mb-2">
                 <div className="bg-muted p-2 rounded-md">
                     <Package size={24} className="text-primary" />
@@ -166,10 +199,10 @@ const ServiceCard: React.FC<ServiceCardProps> = ({ service, onSelect, onInstall
 
             <div className="mb-3 flex items-center gap-4 text-xs text-muted-foreground">
                 {/* GitHub Stars Display (仅主页为 GitHub 且 stars>0 时显示) */}
-                {isGithub && typeof service.stars === 'number' && service.stars > 0 && (
-                    <div className="flex items-center gap-1" title={`${service.stars} GitHub Stars`}>
+                {isGithub && typeof stars === 'number' && stars > 0 && (
+                    <div className="flex items-center gap-1" title={`${stars} GitHub Stars`}>
                         <Star size={14} className="text-yellow-400 fill-yellow-400" />
-                        <span>{service.stars.toLocaleString()}</span>
+                        <span>{stars.toLocaleString()}</span>
                     </div>
                 )}
 
@@ -11,6 +11,7 @@ import { copyToClipboard, getClipboardErrorMessage, isClipboardSupported } from
 import { Textarea } from '@/components/ui/textarea';
 import { Label } from "@/components/ui/label";
 import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select";
+import api, { APIResponse } from '@/utils/api';
 
 // Define a more specific type for the service object
 interface Service {
@@ -30,6 +31,19 @@ interface Service {
     // Add other properties from the service object as needed
 }
 
+// 后端返回的代理端点，url 中的 key 参数为占位符
+interface ServiceEndpoint {
+    transport: 'sse' | 'sse_message' | 'streamable_http';
+    method: string;
+    url: string;
+    native: boolean;
+}
+
+interface ServiceEndpointsResponse {
+    key_placeholder: string;
+    endpoints: ServiceEndpoint[];
+}
+
 interface ServiceConfigModalProps {
     open: boolean;
     service: Service | null; // Use the specific type
@@ -47,6 +61,26 @@ const ServiceConfigModal: React.FC<ServiceConfigModalProps> = ({ open, service,
     const { currentUser, updateUserInfo } = useAuth();
     const { toast } = useToast();
     const [selectedEndpointType, setSelectedEndpointType] = useState<'sse' | 'streamableHttp'>('streamableHttp');
+    const [serviceEndpoints, setServiceEndpoints] = useState<ServiceEndpointsResponse | null>(null);
+
+    // 获取服务的代理端点
+    React.useEffect(() => {
+        if (!open || !service?.id) {
+            setServiceEndpoints(null);
+            return;
+        }
+        const fetchEndpoints = async () => {
+            try {
+                const response = await api.get(`/mcp_services/${service.id}/endpoints`) as APIResponse<ServiceEndpointsResponse>;
+                if (response.success && response.data) {
+                    setServiceEndpoints(response.data);
+                }
+            } catch (error) {
+                console.error('Failed to fetch service endpoints:', error);
+            }
+        };
+        fetchEndpoints();
+    }, [open, service?.id]);
 
 
 
@@ -102,9 +136,15 @@ const ServiceConfigModal: React.FC<ServiceConfigModalProps> = ({ open, service,
     // 检查用户是否是管理员(role >= 10)
     const isAdmin = currentUser?.role && currentUser.role >= 10;
 
-    // 生成 endpoint
-    const sseEndpoint = serverAddress ? `${serverAddress}/proxy/${service?.name || ''}/sse` : '';
-    const httpEndpoint = serverAddress ? `${serverAddress}/proxy/${service?.name || ''}/mcp${userToken ? `?key=${userToken}` : ''}` : '';
+    // 生成 endpoint：优先使用后端返回的端点，未获取到时按服务器地址拼接
+    const endpointURL = (transport: ServiceEndpoint['transport']) => {
+        const endpoint = serviceEndpoints?.endpoints.find((e) => e.transport === transport);
+        if (!endpoint) return '';
+        return userToken ? endpoint.url.replace(serviceEndpoints!.key_placeholder, userToken) : endpoint.url;
+    };
+    // SSE 配置通过 Authorization 头携带 token，URL 中不带 key 参数
+    const sseEndpoint = endpointURL('sse').split('?')[0] || (serverAddress ? `${serverAddress}/proxy/${service?.name || ''}/sse` : '');
+    const httpEndpoint = endpointURL('streamable_http') || (serverAddress ? `${serverAddress}/proxy/${service?.name || ''}/mcp${userToken ? `?key=${userToken}` : ''}` : '');
 
     // 生成 SSE JSON 配置
     const generateSSEJSONConfig = () => {
@@ -7,7 +7,7 @@ import api, { APIResponse } from '@/utils/api';
 import { useAuth } from '@/contexts/AuthContext';
 
 interface LoginFormCommonProps {
-    onSuccess: () => void;
+    onSuccess: (mustChangePassword: boolean) => void; // mustChangePassword 为 true 时账号仍在使用默认密码
     isDialogMode?: boolean; // 可选，便于样式微调
 }
 
@@ -93,11 +93,20 @@ export function LoginFormCommon({ onSuccess, isDialogMode }: LoginFormCommonProp
                 if (apiResponse.data.refresh_token) {
                     localStorage.setItem('refresh_token', apiResponse.data.refresh_token);
                 }
-                toast({
-                    title: "登录成功",
-                    description: "欢迎回来！"
-                });
-                onSuccess();
+                const mustChangePassword = !!apiResponse.data.user.must_change_password;
+                if (mustChangePassword) {
+                    toast({
+                        variant: "destructive",
+                        title: "请修改默认密码",
+                        description: "当前账号仍在使用默认密码，请立即修改。"
+                    });
+                } else {
+                    toast({
+                        title: "登录成功",
+                        description: "欢迎回来！"
+                    });
+                }
+                onSuccess(mustChangePassword);
             } else {
                 const message = apiResponse?.message || "登录失败，请检查用户名和密码。";
                 toast({
@@ -9,10 +9,10 @@ interface LoginDialogProps {
 
 export function LoginDialog({ isOpen, onClose }: LoginDialogProps) {
     const navigate = useNavigate();
-    // 登录成功后关闭弹窗并跳转首页
-    const handleDialogSuccess = () => {
+    // 登录成功后关闭弹窗并跳转首页；仍在使用默认密码时跳转个人资料页修改密码
+    const handleDialogSuccess = (mustChangePassword: boolean) => {
         onClose();
-        navigate('/');
+        navigate(mustChangePassword ? '/profile' : '/');
     };
     return (
         <Dialog open={isOpen} onOpenChange={onClose}>
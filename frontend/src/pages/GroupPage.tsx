@@ -312,6 +312,10 @@ export const GroupPage = () => {
 
         if (resp.success) {
             toast({ title: t('common.success'), description: t('common.success') });
+            const warnings: string[] = resp.data?.tool_name_warnings || [];
+            if (warnings.length > 0) {
+                toast({ title: t('groups.toolNameWarnings'), description: warnings.join('\n') });
+            }
             fetchData();
         } else {
             toast({ variant: "destructive", title: t('common.error'), description: resp.message });
@@ -3,9 +3,9 @@ import { LoginFormCommon } from '@/components/ui/LoginFormCommon';
 
 const Login: React.FC = () => {
     const navigate = useNavigate();
-    // 登录成功后跳转首页
-    const handlePageSuccess = () => {
-        navigate('/');
+    // 登录成功后跳转首页；仍在使用默认密码时跳转个人资料页修改密码
+    const handlePageSuccess = (mustChangePassword: boolean) => {
+        navigate(mustChangePassword ? '/profile' : '/');
     };
     return (
         <div className="min-h-screen flex items-center justify-center bg-background">
@@ -32,11 +32,16 @@ export function PreferencesPage() {
     const [stdioStartupStrategy, setStdioStartupStrategy] = useState('boot');
     const [savingStartupStrategy, setSavingStartupStrategy] = useState(false);
 
+    // Proxy kill-switch
+    const [proxyKillSwitch, setProxyKillSwitch] = useState(false);
+    const [savingKillSwitch, setSavingKillSwitch] = useState(false);
+
     useEffect(() => {
         setLoading(true);
         Promise.all([
             fetchServerAddress(),
-            loadSettings()
+            loadSettings(),
+            loadKillSwitch()
         ]).finally(() => setLoading(false));
     }, [fetchServerAddress]);
 
@@ -65,6 +70,16 @@ export function PreferencesPage() {
         }
     };
 
+    // 紧急开关单独读取：管理员可以切换它，但无权读取其他系统选项
+    const loadKillSwitch = async () => {
+        try {
+            const res = await api.get('/admin/proxy_kill_switch') as APIResponse;
+            if (res.success && res.data) setProxyKillSwitch(res.data.enabled === true);
+        } catch (error) {
+            console.error('Failed to load proxy kill-switch:', error);
+        }
+    };
+
     const handleSave = async () => {
         setSaving(true);
         setMessage('');
@@ -214,6 +229,34 @@ export function PreferencesPage() {
         setSavingStartupStrategy(false);
     };
 
+    const handleSaveKillSwitch = async (newValue: boolean) => {
+        setSavingKillSwitch(true);
+        try {
+            const res = await api.put('/admin/proxy_kill_switch', { enabled: newValue }) as APIResponse;
+            if (res.success) {
+                toast({
+                    title: t('preferences.messages.saveSuccess'),
+                    description: newValue ? t('preferences.messages.killSwitchEngaged') : t('preferences.messages.killSwitchReleased')
+                });
+            } else {
+                setProxyKillSwitch(!newValue);
+                toast({
+                    variant: "destructive",
+                    title: t('preferences.messages.saveFailed'),
+                    description: res.message || t('preferences.messages.saveFailed')
+                });
+            }
+        } catch (error: any) {
+            setProxyKillSwitch(!newValue);
+            toast({
+                variant: "destructive",
+                title: t('preferences.messages.saveFailed'),
+                description: error.message || t('preferences.messages.saveFailed')
+            });
+        }
+        setSavingKillSwitch(false);
+    };
+
     return (
         <div className="w-full max-w-4xl mx-auto space-y-8 p-6">
             <div className="space-y-2">
@@ -313,6 +356,38 @@ export function PreferencesPage() {
                 </div>
             </div>
 
+            {/* 紧急停止所有代理 */}
+            <div className="space-y-6">
+                <div className="space-y-2">
+                    <h3 className="text-xl font-semibold">{t('preferences.killSwitch')}</h3>
+                    <p className="text-sm text-muted-foreground">{t('preferences.killSwitchDesc')}</p>
+                </div>
+                <div className="bg-card border border-border rounded-lg p-6 space-y-4">
+                    <div className="flex items-center justify-between p-4 border border-border rounded-lg bg-muted/30">
+                        <div className="flex items-center space-x-3">
+                            <input
+                                type="checkbox"
+                                id="proxyKillSwitch"
+                                checked={proxyKillSwitch}
+                                onChange={(e) => {
+                                    const newValue = e.target.checked;
+                                    setProxyKillSwitch(newValue);
+                                    setTimeout(() => handleSaveKillSwitch(newValue), 0);
+                                }}
+                                className="h-4 w-4 text-primary focus:ring-primary border-border rounded"
+                                disabled={loading || savingKillSwitch}
+                            />
+                            <label htmlFor="proxyKillSwitch" className="text-sm font-medium">
+                                {t('preferences.form.enableKillSwitch')}
+                            </label>
+                        </div>
+                        {savingKillSwitch && (
+                            <div className="text-sm text-muted-foreground">{t('preferences.actions.saving')}</div>
+                        )}
+                    </div>
+                </div>
+            </div>
+
             {/* 配置登录注册 */}
             <div className="space-y-6">
                 <div className="space-y-2">
@@ -581,7 +581,12 @@ export function ServicesPage() {
                                 </div>
                             </TableCell>
                             <TableCell>
-                                <Badge variant="outline">{service.version || 'unknown'}</Badge>
+                                <Badge
+                                    variant="outline"
+                                    title={service.installed_by ? t('services.installedBy', { user: service.installed_by, date: new Date(service.installed_at || '').toLocaleString() }) : undefined}
+                                >
+                                    {service.version || 'unknown'}
+                                </Badge>
                             </TableCell>
                             <TableCell>
                                 {(service.tool_count || 0) > 0 && (service.health_status === "healthy" || service.health_status === "Healthy") ? (
@@ -603,6 +608,15 @@ export function ServicesPage() {
                                 <Badge variant={service.health_status === "healthy" || service.health_status === "Healthy" ? "default" : "secondary"}>
                                     {service.health_status || 'unknown'}
                                 </Badge>
+                                {service.deprecated && (
+                                    <Badge
+                                        variant="outline"
+                                        className="ml-1 border-amber-500 text-amber-600"
+                                        title={[service.deprecation_message, service.replaced_by && `→ ${service.replaced_by}`].filter(Boolean).join(' ')}
+                                    >
+                                        deprecated
+                                    </Badge>
+                                )}
                             </TableCell>
                             <TableCell>
                                 <Switch
@@ -35,6 +35,13 @@ export interface ServiceType {
     args_json?: string;
     default_envs_json?: string;
     tool_count?: number; // 工具数量
+    // 安装者用户名（系统创建时为空）与安装时间
+    installed_by?: string;
+    installed_at?: string;
+    // 弃用状态
+    deprecated?: boolean;
+    deprecation_message?: string;
+    replaced_by?: string;
 }
 
 // 详细服务类型定义
@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"flag"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"one-mcp/backend/api/middleware"
 	"one-mcp/backend/api/route"
@@ -17,6 +21,7 @@ import (
 	"one-mcp/backend/common/i18n"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
+	"one-mcp/backend/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -92,6 +97,14 @@ func main() {
 	// 	// Depending on severity, might os.Exit(1) or just log
 	// }
 
+	// 从服务配置目录同步文件托管的服务（在 ServiceManager 加载服务之前）
+	if common.ServicesConfigDir != "" {
+		if _, err := service.SyncServiceConfigDir(common.ServicesConfigDir); err != nil {
+			common.SysError("Failed to sync services config dir: " + err.Error())
+		}
+		setupServiceConfigReload(common.ServicesConfigDir)
+	}
+
 	// Initialize service manager
 	serviceManager := proxy.GetServiceManager()
 	go func() {
@@ -106,30 +119,111 @@ func main() {
 	server := gin.Default()
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.CORS())
+	tlsEnabled, err := common.TLSEnabled(*common.TLSCertFile, *common.TLSKeyFile)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if tlsEnabled {
+		server.Use(middleware.HSTS())
+	}
 
 	route.SetRouter(server, buildFS, indexPage)
 
-	port := strconv.Itoa(*common.Port)
-	common.SysLog("Server listening on port: " + port)
+	httpServer := &http.Server{Handler: server.Handler()}
+	var listeners []net.Listener
+	if *common.Port > 0 {
+		port := strconv.Itoa(*common.Port)
+		tcpListener, err := net.Listen("tcp", ":"+port)
+		if err != nil {
+			log.Fatal("failed to listen on port " + port + ": " + err.Error())
+		}
+		if tlsEnabled {
+			certReloader, err := common.NewCertReloader(*common.TLSCertFile, *common.TLSKeyFile)
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			httpServer.TLSConfig = certReloader.TLSConfig()
+			tcpListener = common.TLSListener(tcpListener)
+			common.SysLog("Server listening on port (HTTPS): " + port)
+		} else {
+			common.SysLog("Server listening on port: " + port)
+		}
+		listeners = append(listeners, tcpListener)
+	}
+	var redirectServer *http.Server
+	if tlsEnabled && *common.RedirectPort > 0 {
+		redirectServer = &http.Server{
+			Addr:    ":" + strconv.Itoa(*common.RedirectPort),
+			Handler: common.HTTPSRedirectHandler(*common.Port),
+		}
+		go func() {
+			common.SysLog("Redirecting HTTP on " + redirectServer.Addr + " to HTTPS")
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				common.SysError("HTTP redirect listener stopped: " + err.Error())
+			}
+		}()
+	}
+	if *common.UnixSocket != "" {
+		unixListener, err := common.ListenUnixSocket(*common.UnixSocket)
+		if err != nil {
+			log.Fatal("failed to listen on unix socket " + *common.UnixSocket + ": " + err.Error())
+		}
+		listeners = append(listeners, unixListener)
+		common.SysLog("Server listening on unix socket: " + *common.UnixSocket)
+	}
 
 	// Setup graceful shutdown
-	setupGracefulShutdown()
+	shutdownDone := setupGracefulShutdown(httpServer, redirectServer)
 
-	err = server.Run(":" + port)
+	err = common.ServeListeners(httpServer, listeners...)
 	if err != nil {
 		log.Fatal("failed to start server: " + err.Error())
 	}
+	// Serving stops as soon as the HTTP server shuts down; wait for the remaining cleanup before exiting
+	<-shutdownDone
+}
+
+// setupServiceConfigReload re-syncs the services config directory on SIGHUP
+func setupServiceConfigReload(dir string) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		for range c {
+			common.SysLog("SIGHUP received, reloading services config dir: " + dir)
+			if err := service.ReloadServiceConfigDir(context.Background(), dir); err != nil {
+				common.SysError("Failed to reload services config dir: " + err.Error())
+			}
+		}
+	}()
 }
 
-// setupGracefulShutdown registers signal handlers to ensure clean shutdown
-func setupGracefulShutdown() {
+// setupGracefulShutdown registers signal handlers to ensure clean shutdown. redirectServer (the HTTP to HTTPS
+// redirect, may be nil) is shut down together with httpServer. The returned channel is closed once every resource
+// has been shut down.
+func setupGracefulShutdown(httpServer *http.Server, redirectServer *http.Server) <-chan struct{} {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
 
 	go func() {
+		defer close(done)
 		<-c
 		common.SysLog("Shutting down...")
 
+		// 停止接收新请求；关闭 listener 时会删除 unix socket 文件
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			common.SysLog("Error shutting down HTTP server: " + err.Error())
+		}
+		if redirectServer != nil {
+			if err := redirectServer.Shutdown(shutdownCtx); err != nil {
+				common.SysLog("Error shutting down HTTP redirect server: " + err.Error())
+			}
+		}
+		cancel()
+		common.RemoveUnixSocket(*common.UnixSocket)
+
 		// 关闭服务管理器
 		serviceManager := proxy.GetServiceManager()
 		if err := serviceManager.Shutdown(context.Background()); err != nil {
@@ -139,7 +233,6 @@ func setupGracefulShutdown() {
 		}
 
 		// 关闭其他资源...
-
-		os.Exit(0)
 	}()
+	return done
 }